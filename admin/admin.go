@@ -0,0 +1,332 @@
+/*
+Package admin provides an HTTP API to operate a running WACE
+instance: list plugins, change model weights, reload the
+configuration, inspect the status and replay payloads.
+*/
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	wace "github.com/tiroa-tilsor/wacelib"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// maxBodySize is the maximum size of a request body accepted by the API
+const maxBodySize = 10 << 20
+
+// Server is the admin API of a WACE instance
+type Server struct {
+	// ConfigPath is the config file read on reload
+	ConfigPath string
+	// Token, if not empty, must be sent as a bearer token in every request
+	Token string
+}
+
+// PluginInfo describes a configured plugin
+type PluginInfo struct {
+	ID     string
+	Kind   string
+	Type   string  `json:",omitempty"`
+	Mode   string  `json:",omitempty"`
+	Remote bool    `json:",omitempty"`
+	Weight float64 `json:",omitempty"`
+	Loaded bool
+	// Version and Age are those of the manifest of the model, if any
+	Version string        `json:",omitempty"`
+	Age     time.Duration `json:",omitempty"`
+	Stale   bool          `json:",omitempty"`
+}
+
+// WeightRequest is the body of a set weight request
+type WeightRequest struct {
+	Weight float64
+}
+
+// ReplayRequest is the body of a replay request: the payload is
+// analyzed as a new transaction by the given models and decision plugin
+type ReplayRequest struct {
+	Type      string
+	Payload   string
+	Models    []string
+	Decision  string
+	WAFParams map[string]string
+}
+
+// ReplayResult is the outcome of a replay request
+type ReplayResult struct {
+	TransactionID string
+	Verdict       wace.Verdict
+	Results       map[string]pm.ModelResults
+	Weights       map[string]float64
+	Log           []wace.DebugEntry
+	Error         string `json:",omitempty"`
+}
+
+// Handler returns the HTTP handler serving the admin API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/plugins", s.listPlugins)
+	mux.HandleFunc("PUT /v1/plugins/{id}/weight", s.setWeight)
+	mux.HandleFunc("POST /v1/reload", s.reload)
+	mux.HandleFunc("POST /v1/rollback", s.rollback)
+	mux.HandleFunc("GET /v1/status", s.status)
+	mux.HandleFunc("GET /v1/ready", s.ready)
+	mux.HandleFunc("GET /v1/version", s.version)
+	mux.HandleFunc("GET /v1/campaigns", s.campaigns)
+	mux.HandleFunc("GET /v1/dump", s.dump)
+	mux.HandleFunc("POST /v1/replay", s.replay)
+	mux.HandleFunc("POST /v1/validate-config", s.validateConfig)
+	mux.HandleFunc("GET /v1/schema", s.schema)
+	return s.authenticate(mux)
+}
+
+// ListenAndServe serves the admin API on the given address
+func (s *Server) ListenAndServe(addr string) error {
+	logger := lg.Get()
+	logger.Printf(lg.INFO, "admin | serving admin API on %s", addr)
+	if s.Token == "" {
+		logger.Printf(lg.WARN, "admin | admin API on %s has no token, every client can operate the instance", addr)
+	}
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+// authenticate rejects the requests without the configured token,
+// compared in constant time
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.Token)) != 1 {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid or missing token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) listPlugins(w http.ResponseWriter, r *http.Request) {
+	conf := cf.Snapshot()
+	loaded := make(map[string]bool)
+	if status, err := wace.Status(); err == nil {
+		for _, id := range status.ModelPlugins {
+			loaded[id] = true
+		}
+		for _, id := range status.DecisionPlugins {
+			loaded[id] = true
+		}
+	}
+
+	var infos []PluginInfo
+	now := time.Now()
+	for id, model := range conf.ModelPlugins {
+		age, _ := conf.ModelAge(id, now)
+		infos = append(infos, PluginInfo{
+			ID:      id,
+			Kind:    "model",
+			Type:    model.PluginType.String(),
+			Mode:    model.Mode,
+			Remote:  model.Remote,
+			Weight:  model.Weight,
+			Loaded:  loaded[id],
+			Version: model.Version,
+			Age:     age,
+			Stale:   conf.IsStale(id, now),
+		})
+	}
+	for id := range conf.DecisionPlugins {
+		infos = append(infos, PluginInfo{ID: id, Kind: "decision", Loaded: loaded[id]})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Kind != infos[j].Kind {
+			return infos[i].Kind > infos[j].Kind
+		}
+		return infos[i].ID < infos[j].ID
+	})
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (s *Server) setWeight(w http.ResponseWriter, r *http.Request) {
+	var req WeightRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	id := r.PathValue("id")
+	if err := cf.SetModelWeight(id, req.Weight); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	lg.Get().Printf(lg.INFO, "admin | model plugin %s weight set to %v", id, req.Weight)
+	writeJSON(w, http.StatusOK, req)
+}
+
+func (s *Server) reload(w http.ResponseWriter, r *http.Request) {
+	if s.ConfigPath == "" {
+		writeError(w, http.StatusNotImplemented, fmt.Errorf("no config file path configured"))
+		return
+	}
+	inConf, err := cf.LoadConfig(s.ConfigPath)
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := wace.Reload(inConf); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	lg.Get().Printf(lg.INFO, "admin | configuration reloaded from %s", s.ConfigPath)
+	s.status(w, r)
+}
+
+func (s *Server) rollback(w http.ResponseWriter, r *http.Request) {
+	if err := wace.RollbackConfig(); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	lg.Get().Printf(lg.INFO, "admin | configuration rolled back")
+	s.status(w, r)
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	status, err := wace.Status()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) ready(w http.ResponseWriter, r *http.Request) {
+	if err := wace.Ready(); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{ Ready bool }{true})
+}
+
+func (s *Server) version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, wace.Version())
+}
+
+func (s *Server) campaigns(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, wace.Campaigns())
+}
+
+func (s *Server) dump(w http.ResponseWriter, r *http.Request) {
+	status, _ := wace.Status()
+	writeJSON(w, http.StatusOK, struct {
+		Config *cf.ConfigStore
+		Status wace.StatusReport
+	}{cf.Snapshot().Redacted(), status})
+}
+
+func (s *Server) replay(w http.ResponseWriter, r *http.Request) {
+	var req ReplayRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	res, err := Replay(req)
+	if err != nil {
+		res.Error = err.Error()
+		writeJSON(w, http.StatusUnprocessableEntity, res)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) validateConfig(w http.ResponseWriter, r *http.Request) {
+	content, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	inConf, err := cf.ParseConfig(content)
+	if err == nil {
+		err = cf.ValidateConfig(inConf)
+	}
+	var validationErr *cf.ValidationError
+	if errors.As(err, &validationErr) {
+		// every problem is reported with the path of its field
+		writeJSON(w, http.StatusUnprocessableEntity, struct {
+			Error    string          `json:"error"`
+			Problems []cf.FieldError `json:"problems"`
+		}{err.Error(), validationErr.Problems})
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"valid": true})
+}
+
+func (s *Server) schema(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, cf.Schema())
+}
+
+// Replay analyzes the payload as a new debug transaction with the
+// models and decision plugin of the request. The result includes every
+// model score and the transaction log.
+func Replay(req ReplayRequest) (ReplayResult, error) {
+	if req.Type == "" {
+		req.Type = cf.AllRequest.String()
+	}
+	if req.WAFParams == nil {
+		req.WAFParams = make(map[string]string)
+	}
+	res := ReplayResult{TransactionID: fmt.Sprintf("replay-%d", time.Now().UnixNano())}
+	wace.InitTransactionWithOptions(res.TransactionID, wace.TransactionOptions{Debug: true})
+	defer wace.CloseTransaction(res.TransactionID)
+
+	err := wace.Analyze(req.Type, res.TransactionID, req.Payload, req.Models)
+	if err == nil {
+		res.Verdict, err = wace.CheckTransactionVerdict(res.TransactionID, req.Decision, req.WAFParams)
+	}
+	if bundle, bundleErr := wace.GetDebugBundle(res.TransactionID); bundleErr == nil {
+		res.Results = bundle.Results
+		res.Log = bundle.Entries
+	}
+	conf := cf.Snapshot()
+	res.Weights = make(map[string]float64, len(res.Results))
+	for modelID := range res.Results {
+		res.Weights[modelID] = conf.ModelWeight(modelID, time.Now())
+	}
+	return res, err
+}
+
+func decodeBody(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %v", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": strings.TrimSpace(err.Error())})
+}
@@ -0,0 +1,165 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	wace "github.com/tiroa-tilsor/wacelib"
+	"github.com/tiroa-tilsor/wacelib/campaign"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+)
+
+var validConfig = `---
+logpath: "/dev/null"
+loglevel: "WARN"
+decisionplugins:
+  - id: "categories"
+    kind: builtin
+    categories:
+      rce:
+        threshold: 0.5
+        action: block
+`
+
+func TestAuthentication(t *testing.T) {
+	handler := (&Server{Token: "secret"}).Handler()
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/plugins", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("request without token returned %d, expected %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/plugins", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("request with token returned %d, expected %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	handler := (&Server{}).Handler()
+
+	cases := []struct {
+		config string
+		code   int
+	}{
+		{validConfig, http.StatusOK},
+		{strings.Replace(validConfig, "block", "drop", 1), http.StatusUnprocessableEntity},
+		{"---\nloglevel: INVALID\nlogpath: /dev/null\n", http.StatusUnprocessableEntity},
+		{"---\nloglevel: ERROR\nlogpath: /dev/null\nloglevle: DEBUG\n", http.StatusUnprocessableEntity},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/v1/validate-config", strings.NewReader(c.config))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != c.code {
+			t.Errorf("validate-config returned %d, expected %d: %s", rec.Code, c.code, rec.Body.String())
+		}
+	}
+}
+
+func TestStatusUninitialized(t *testing.T) {
+	handler := (&Server{}).Handler()
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/status", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status of an uninitialized instance returned %d", rec.Code)
+	}
+}
+
+func TestRollbackUninitialized(t *testing.T) {
+	handler := (&Server{}).Handler()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/rollback", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("rollback of an uninitialized instance returned %d", rec.Code)
+	}
+}
+
+func TestReadyUninitialized(t *testing.T) {
+	handler := (&Server{}).Handler()
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/ready", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("readiness of an uninitialized instance returned %d", rec.Code)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	handler := (&Server{}).Handler()
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/version", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var info wace.BuildInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("version returned %d %s", rec.Code, rec.Body)
+	}
+	if info.Version == "" || info.GoVersion == "" || info.PluginAPIVersion != pm.PluginAPIVersion {
+		t.Errorf("build info is %+v", info)
+	}
+}
+
+func TestCampaigns(t *testing.T) {
+	handler := (&Server{}).Handler()
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/campaigns", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var campaigns []campaign.Campaign
+	if err := json.Unmarshal(rec.Body.Bytes(), &campaigns); err != nil || rec.Code != http.StatusOK || campaigns == nil {
+		t.Errorf("campaigns returned %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestValidateConfigProblems(t *testing.T) {
+	handler := (&Server{}).Handler()
+
+	config := "---\nlogpath: /dev/null\nloglevel: WARN\nmodelplugins:\n  - id: protocol\n    kind: builtin\n    weight: -1\n    plugintype: Headers\n"
+	req := httptest.NewRequest(http.MethodPost, "/v1/validate-config", strings.NewReader(config))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var res struct {
+		Error    string
+		Problems []cf.FieldError
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("validate-config returned %d %s", rec.Code, rec.Body)
+	}
+	if len(res.Problems) != 2 || res.Problems[0].Field != "modelplugins[0].plugintype" || res.Problems[1].Field != "modelplugins[0].weight" {
+		t.Errorf("problems are %+v", res.Problems)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	handler := (&Server{}).Handler()
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/schema", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var schema struct {
+		Type                 string
+		Properties           map[string]json.RawMessage
+		AdditionalProperties bool
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &schema); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("schema returned %d %s", rec.Code, rec.Body)
+	}
+	if schema.Type != "object" || schema.AdditionalProperties || schema.Properties["modelplugins"] == nil {
+		t.Errorf("schema is %s", rec.Body)
+	}
+}
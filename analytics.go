@@ -0,0 +1,109 @@
+package wace
+
+import (
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"github.com/tiroa-tilsor/wacelib/export"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// startExport starts the export of the transaction outcomes if
+// enabled, flushing and closing the previous exporter
+func (c *Core) startExport() {
+	// the previous exporter is closed outside of the lock, so its last
+	// flush does not hold up the transactions checked meanwhile
+	if old := c.swapExporter(c.newExporter()); old != nil {
+		if err := old.Close(); err != nil {
+			lg.Get().Printf(lg.WARN, "core | could not close the exporter: %v", err)
+		}
+	}
+}
+
+// newExporter creates the exporter of the configuration of the core, nil
+// if the export is disabled or cannot be started
+func (c *Core) newExporter() *export.Exporter {
+	conf := c.config().Export
+	var sink export.Sink
+	switch conf.Sink {
+	case "":
+		return nil
+	case cf.ExportClickHouse:
+		sink = export.NewClickHouseSink(conf.URL, conf.Table)
+	case cf.ExportJSONL:
+		jsonlSink, err := export.NewJSONLSink(conf.Dir, conf.Prefix, conf.MaxSize, conf.Rotate)
+		if err != nil {
+			lg.Get().Printf(lg.ERROR, "core | could not start the export to %s: %v", conf.Dir, err)
+			return nil
+		}
+		sink = jsonlSink
+	case cf.ExportParquet:
+		parquetSink, err := export.NewParquetSink(conf.Dir, conf.Prefix, conf.Fields, conf.MaxSize, conf.Rotate)
+		if err != nil {
+			lg.Get().Printf(lg.ERROR, "core | could not start the export to %s: %v", conf.Dir, err)
+			return nil
+		}
+		sink = parquetSink
+	}
+	lg.Get().Printf(lg.INFO, "Exporting %.2f%% of the transactions to %s", conf.SampleRate*100, conf.Sink)
+	return export.New(sink, export.Config{
+		SampleRate:    conf.SampleRate,
+		Fields:        conf.Fields,
+		BatchSize:     conf.BatchSize,
+		FlushInterval: conf.FlushInterval,
+	})
+}
+
+// swapExporter makes exporter the exporter of the core and returns the
+// previous one
+func (c *Core) swapExporter(exporter *export.Exporter) *export.Exporter {
+	c.exporterMutex.Lock()
+	defer c.exporterMutex.Unlock()
+	old := c.exporter
+	c.exporter = exporter
+	return old
+}
+
+// StopExport writes the pending transaction outcomes to the analytics
+// store and stops the export. Connectors should call it on shutdown.
+func StopExport() error {
+	return defaultCore.StopExport()
+}
+
+// StopExport is like the StopExport function
+func (c *Core) StopExport() error {
+	old := c.swapExporter(nil)
+	if old == nil {
+		return nil
+	}
+	return old.Close()
+}
+
+// exportVerdict queues the outcome of the checked transaction for
+// export
+func (c *Core) exportVerdict(transactionID, decisionPlugin string, verdict Verdict, results map[string]pm.ModelResults) {
+	c.exporterMutex.RLock()
+	defer c.exporterMutex.RUnlock()
+	if c.exporter == nil {
+		return
+	}
+	record := export.Record{
+		TransactionID: c.scope(transactionID),
+		Time:          time.Now(),
+		Block:         verdict.Block,
+		Decision:      decisionPlugin,
+		Scores:        make(map[string]float64, len(results)),
+		Categories:    make(map[string]float64, len(verdict.Categories)),
+		Tags:          verdict.Tags,
+		Metadata:      verdict.Metadata,
+	}
+	for id, res := range results {
+		record.Scores[id] = res.ProbAttack
+	}
+	for category, score := range verdict.Categories {
+		record.Categories[string(category)] = score
+	}
+	c.exporter.Export(record)
+}
@@ -0,0 +1,49 @@
+package wace
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+)
+
+func TestExportVerdict(t *testing.T) {
+	dir := t.TempDir()
+	cf.Update(func(cs *cf.ConfigStore) error {
+		cs.Export = cf.ExportConfig{Sink: cf.ExportJSONL, Dir: dir, Prefix: "test", SampleRate: 1, BatchSize: 10}
+		return nil
+	})
+	defer cf.Update(func(cs *cf.ConfigStore) error {
+		cs.Export = cf.ExportConfig{}
+		return nil
+	})
+	defaultCore.startExport()
+
+	verdict := Verdict{Block: true, Tags: []string{"sqli"}, Categories: map[pm.AttackCategory]float64{"sqli": 0.9}}
+	defaultCore.exportVerdict("tx-1", "combiner", verdict, map[string]pm.ModelResults{"m1": {ProbAttack: 0.8}})
+	if err := StopExport(); err != nil {
+		t.Fatalf("StopExport returned error: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "test-*.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("export files are %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	var row struct {
+		TransactionID string             `json:"transaction_id"`
+		Block         bool               `json:"block"`
+		Decision      string             `json:"decision"`
+		Scores        map[string]float64 `json:"scores"`
+		Categories    map[string]float64 `json:"categories"`
+	}
+	if err := json.Unmarshal(data, &row); err != nil {
+		t.Fatalf("invalid exported row %q: %v", data, err)
+	}
+	if row.TransactionID != "tx-1" || !row.Block || row.Decision != "combiner" || row.Scores["m1"] != 0.8 || row.Categories["sqli"] != 0.9 {
+		t.Errorf("exported row is %+v", row)
+	}
+}
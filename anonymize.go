@@ -0,0 +1,80 @@
+package wace
+
+import (
+	"sync"
+
+	"github.com/tiroa-tilsor/wacelib/anonymize"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+var (
+	// customAnonymizer is the anonymizer set by SetAnonymizer, nil to
+	// use the one of the configuration
+	customAnonymizer anonymize.Anonymizer
+	anonymizerMutex  sync.RWMutex
+)
+
+// SetAnonymizer replaces the HMAC anonymizer of the anonymization
+// configuration by a custom scheme, applied to the identifiers of the
+// configured keys. nil restores the configured one.
+func SetAnonymizer(a anonymize.Anonymizer) {
+	anonymizerMutex.Lock()
+	customAnonymizer = a
+	anonymizerMutex.Unlock()
+}
+
+// anonymizer returns the anonymizer of the configuration, or nil if
+// the identifiers are not pseudonymized
+func anonymizer(conf *cf.ConfigStore) anonymize.Anonymizer {
+	anonymizerMutex.RLock()
+	defer anonymizerMutex.RUnlock()
+	if customAnonymizer != nil {
+		return customAnonymizer
+	}
+	if len(conf.Anonymization.Secret) == 0 {
+		return nil
+	}
+	return anonymize.NewHMAC(conf.Anonymization.Secret, conf.Anonymization.Rotation)
+}
+
+// pseudonymize returns the metadata values given by the connector for
+// the transaction with the client identifiers replaced by their
+// pseudonyms, before they are stored or given to the plugins. The
+// client address is kept apart to locate the client.
+func (c *Core) pseudonymize(transactionID string, values map[string]string) map[string]string {
+	conf := c.config()
+	a := anonymizer(conf)
+	if a == nil {
+		return values
+	}
+	var pseudonymized map[string]string
+	for _, key := range conf.Anonymization.Keys {
+		value, ok := values[key]
+		if !ok || value == "" {
+			continue
+		}
+		if pseudonymized == nil {
+			pseudonymized = make(map[string]string, len(values))
+			for k, v := range values {
+				pseudonymized[k] = v
+			}
+		}
+		pseudonymized[key] = a.Anonymize(key, value)
+		if key == MetaClientIP {
+			c.clientAddresses.Store(transactionID, value)
+		}
+	}
+	if pseudonymized == nil {
+		return values
+	}
+	return pseudonymized
+}
+
+// clientAddress returns the client address of the transaction, before
+// its pseudonymization
+func (c *Core) clientAddress(transactionID string, meta map[string]string) string {
+	if address, ok := c.clientAddresses.Load(transactionID); ok {
+		return address.(string)
+	}
+	return meta[MetaClientIP]
+}
@@ -0,0 +1,65 @@
+/*
+Package anonymize pseudonymizes the client identifiers, such as the
+client addresses and the session IDs, before they are stored or sent to
+the plugins. The default scheme replaces them by their HMAC-SHA256 with
+a key rotated periodically: the same identifier gets the same pseudonym
+during a rotation period, so the requests of a client can still be
+correlated, but the pseudonyms cannot be linked to the identifiers
+without the secret, nor across periods.
+*/
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// Anonymizer replaces client identifiers by pseudonyms
+type Anonymizer interface {
+	// Anonymize returns the pseudonym of the value of the metadata key
+	Anonymize(key, value string) string
+}
+
+// pseudonymSize is the number of bytes of the HMAC kept in a pseudonym
+const pseudonymSize = 16
+
+// HMAC is an Anonymizer giving the HMAC-SHA256 of the identifiers with
+// a key derived from a secret for each rotation period. The instances
+// sharing the secret give the same pseudonyms.
+type HMAC struct {
+	secret   []byte
+	rotation time.Duration
+}
+
+// NewHMAC returns an HMAC anonymizer with the secret, whose key changes
+// every rotation, aligned on the Unix epoch. A zero rotation never
+// changes the key.
+func NewHMAC(secret []byte, rotation time.Duration) *HMAC {
+	return &HMAC{secret: secret, rotation: rotation}
+}
+
+// Anonymize returns the pseudonym of the value in the current period
+func (h *HMAC) Anonymize(key, value string) string {
+	return h.At(value, time.Now())
+}
+
+// At returns the pseudonym of the value in the rotation period of t
+func (h *HMAC) At(value string, t time.Time) string {
+	mac := hmac.New(sha256.New, h.periodKey(t))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)[:pseudonymSize])
+}
+
+// periodKey returns the key of the rotation period of t
+func (h *HMAC) periodKey(t time.Time) []byte {
+	var period int64
+	if h.rotation > 0 {
+		period = t.UnixNano() / int64(h.rotation)
+	}
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte("period " + strconv.FormatInt(period, 10)))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,35 @@
+package anonymize
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHMAC(t *testing.T) {
+	h := NewHMAC([]byte("0123456789abcdef"), time.Hour)
+	now := time.Date(2024, 5, 1, 10, 15, 0, 0, time.UTC)
+
+	pseudonym := h.At("203.0.113.7", now)
+	if pseudonym == "203.0.113.7" || len(pseudonym) != 2*pseudonymSize {
+		t.Errorf("pseudonym of 203.0.113.7 is %q", pseudonym)
+	}
+	if again := h.At("203.0.113.7", now.Add(30*time.Minute)); again != pseudonym {
+		t.Errorf("pseudonym changed within the rotation period: %q, %q", pseudonym, again)
+	}
+	if other := h.At("203.0.113.8", now); other == pseudonym {
+		t.Errorf("different identifiers share the pseudonym %q", pseudonym)
+	}
+	if rotated := h.At("203.0.113.7", now.Add(time.Hour)); rotated == pseudonym {
+		t.Errorf("pseudonym did not change with the rotation")
+	}
+	if shared := NewHMAC([]byte("0123456789abcdef"), time.Hour).At("203.0.113.7", now); shared != pseudonym {
+		t.Errorf("instances with the same secret give %q and %q", pseudonym, shared)
+	}
+	if other := NewHMAC([]byte("fedcba9876543210"), time.Hour).At("203.0.113.7", now); other == pseudonym {
+		t.Errorf("instances with different secrets give the same pseudonym")
+	}
+	fixed := NewHMAC([]byte("0123456789abcdef"), 0)
+	if fixed.At("203.0.113.7", now) != fixed.At("203.0.113.7", now.Add(1000*time.Hour)) {
+		t.Errorf("pseudonym changed without rotation")
+	}
+}
@@ -0,0 +1,100 @@
+package wace
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tiroa-tilsor/wacelib/anonymize"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"gopkg.in/yaml.v3"
+)
+
+// reverser is an anonymizer reversing the identifiers
+type reverser struct{}
+
+func (reverser) Anonymize(key, value string) string {
+	runes := []rune(value)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func TestAnonymization(t *testing.T) {
+	var mutex sync.Mutex
+	var seen map[string]string
+	err := pm.RegisterModel("anonymizedmeta", nil, func(input pm.ModelInput) (pm.ModelResults, error) {
+		mutex.Lock()
+		seen = input.Metadata
+		mutex.Unlock()
+		return pm.ModelResults{ProbAttack: 0.1}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inConf cf.ConfigFileData
+	err = yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: anonymizedmeta
+    kind: builtin
+    plugintype: RequestHeaders
+    weight: 1
+decisionplugins:
+  - id: combiner
+    kind: builtin
+anonymization:
+  secret: 0123456789abcdef0123
+  rotation: 0s
+  keys: [client.ip, session.id]
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("anonymization", conf, testMeter)
+	analyze := func() map[string]string {
+		id := generateRandomID()
+		engine.InitTransactionWithOptions(id, TransactionOptions{Metadata: map[string]string{MetaClientIP: "203.0.113.7", "request.host": "example.com"}})
+		defer CloseTransaction(id)
+		if err := AnalyzeWithMeta("RequestHeaders", id, "GET / HTTP/1.1\nHost: example.com\n", []string{"anonymizedmeta"}, map[string]string{pm.MetaClientIP: "203.0.113.7", "session.id": "s3cr3t"}); err != nil {
+			t.Fatalf("AnalyzeWithMeta returned error: %v", err)
+		}
+		verdict, err := CheckTransactionVerdict(id, "combiner", nil)
+		if err != nil {
+			t.Fatalf("CheckTransactionVerdict returned error: %v", err)
+		}
+		if engine.clientAddress(id, verdict.Metadata) != "203.0.113.7" {
+			t.Errorf("client address for the geolocation is %q", engine.clientAddress(id, verdict.Metadata))
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if seen[pm.MetaClientIP] != verdict.Metadata[MetaClientIP] || seen["session.id"] == "s3cr3t" || strings.Contains(seen["session.id"], "s3cr3t") {
+			t.Errorf("model metadata is %v, verdict metadata %v", seen, verdict.Metadata)
+		}
+		return verdict.Metadata
+	}
+
+	first := analyze()
+	expected := anonymize.NewHMAC([]byte("0123456789abcdef0123"), 0).At("203.0.113.7", time.Now())
+	if first[MetaClientIP] != expected || first["request.host"] != "example.com" {
+		t.Errorf("verdict metadata is %v", first)
+	}
+	if second := analyze(); second[MetaClientIP] != first[MetaClientIP] {
+		t.Errorf("client pseudonyms %q and %q cannot be correlated", first[MetaClientIP], second[MetaClientIP])
+	}
+
+	SetAnonymizer(reverser{})
+	defer SetAnonymizer(nil)
+	if reversed := analyze(); reversed[MetaClientIP] != "7.311.0.302" {
+		t.Errorf("custom anonymizer gives %v", reversed)
+	}
+}
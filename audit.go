@@ -0,0 +1,156 @@
+package wace
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/tiroa-tilsor/wacelib/audit"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// startAudit starts sending the blocked-transaction events if enabled,
+// closing the previous sink
+func (c *Core) startAudit() {
+	// the previous sink is closed outside of the lock, so writing its
+	// pending events does not hold up the transactions blocked meanwhile
+	if old := c.swapAuditSink(c.newAuditSink()); old != nil {
+		if err := old.Close(); err != nil {
+			lg.Get().Printf(lg.WARN, "core | could not close the audit sink: %v", err)
+		}
+	}
+}
+
+// newAuditSink connects the audit sink of the configuration of the
+// core, nil if the audit events are disabled or cannot be sent
+func (c *Core) newAuditSink() *audit.Sink {
+	conf := c.config().Audit
+	if conf.Format == "" {
+		return nil
+	}
+
+	var tlsConfig *tls.Config
+	if conf.Network == audit.NetworkTLS {
+		var err error
+		if tlsConfig, err = auditTLSConfig(conf.CAFile); err != nil {
+			lg.Get().Printf(lg.ERROR, "core | could not load the audit cafile %s: %v", conf.CAFile, err)
+			return nil
+		}
+	}
+	w, err := audit.Dial(conf.Network, conf.Address, tlsConfig, conf.Facility)
+	if err != nil {
+		lg.Get().Printf(lg.ERROR, "core | could not connect to the audit syslog server %s: %v", conf.Address, err)
+		return nil
+	}
+	sink, err := audit.NewSink(w, conf.Format, audit.DefaultProduct, 0)
+	if err != nil {
+		w.Close()
+		lg.Get().Printf(lg.ERROR, "core | could not start the audit events: %v", err)
+		return nil
+	}
+	lg.Get().Printf(lg.INFO, "Sending %s audit events to %s over %s", conf.Format, conf.Address, conf.Network)
+	return sink
+}
+
+// swapAuditSink makes sink the audit sink of the core and returns the
+// previous one
+func (c *Core) swapAuditSink(sink *audit.Sink) *audit.Sink {
+	c.auditSinkMutex.Lock()
+	defer c.auditSinkMutex.Unlock()
+	old := c.auditSink
+	c.auditSink = sink
+	return old
+}
+
+// auditTLSConfig returns the TLS configuration authenticating the
+// syslog server with the certificates of caFile, or the system ones
+func auditTLSConfig(caFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return tlsConfig, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found")
+	}
+	tlsConfig.RootCAs = pool
+	return tlsConfig, nil
+}
+
+// StopAudit writes the pending audit events and stops sending them.
+// Connectors should call it on shutdown.
+func StopAudit() error {
+	return defaultCore.StopAudit()
+}
+
+// StopAudit is like the StopAudit function
+func (c *Core) StopAudit() error {
+	old := c.swapAuditSink(nil)
+	if old == nil {
+		return nil
+	}
+	return old.Close()
+}
+
+// auditSeverity returns the severity of the blocked transaction, from
+// 1 to 10: the highest severity of its categories mapped in severities,
+// scaled by their scores, or else its highest score
+func auditSeverity(severities map[string]int, verdict Verdict, score float64) int {
+	severity := -1.0
+	for category, categoryScore := range verdict.Categories {
+		if mapped, ok := severities[string(category)]; ok {
+			severity = math.Max(severity, float64(mapped)*categoryScore)
+		}
+	}
+	if severity < 0 {
+		severity = score * 10
+	}
+	return int(math.Max(1, math.Min(10, math.Round(severity))))
+}
+
+// auditVerdict queues the event of the blocked transaction, unless its
+// severity is below the minimum one
+func (c *Core) auditVerdict(transactionID, decisionPlugin string, verdict Verdict, results map[string]pm.ModelResults) {
+	c.auditSinkMutex.RLock()
+	defer c.auditSinkMutex.RUnlock()
+	if c.auditSink == nil || !verdict.Block {
+		return
+	}
+	conf := c.config().Audit
+	event := audit.Event{
+		TransactionID: transactionID,
+		Time:          time.Now(),
+		Decision:      decisionPlugin,
+		Categories:    make(map[string]float64, len(verdict.Categories)),
+		Tags:          verdict.Tags,
+		Rescored:      c.rescored(transactionID),
+	}
+	for _, res := range results {
+		event.Score = math.Max(event.Score, res.ProbAttack)
+	}
+	for category, score := range verdict.Categories {
+		event.Categories[string(category)] = score
+		event.Score = math.Max(event.Score, score)
+	}
+	event.Severity = auditSeverity(conf.Severities, verdict, event.Score)
+	if event.Severity < conf.MinSeverity {
+		return
+	}
+	event.Priority = audit.Priority(event.Severity)
+	if set := c.pluginsOf(transactionID); set != nil {
+		meta := set.manager.TransactionMeta(c.scope(transactionID))
+		event.ClientIP = meta[pm.MetaClientIP]
+		event.Method = meta[pm.MetaMethod]
+		event.URI = meta[pm.MetaURI]
+	}
+	c.auditSink.Send(event)
+}
@@ -0,0 +1,253 @@
+/*
+Package audit sends the blocked-transaction events to SIEMs over
+syslog (RFC 5424, over UDP, TCP or TLS), formatted in the ArcSight
+Common Event Format (CEF) or the IBM QRadar Log Event Extended Format
+(LEEF), so they can be onboarded without parsing the application logs.
+*/
+package audit
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// Event formats
+const (
+	FormatCEF  = "cef"
+	FormatLEEF = "leef"
+)
+
+// Event is a blocked transaction
+type Event struct {
+	TransactionID string
+	Time          time.Time
+	// Decision is the decision plugin that blocked the transaction
+	Decision string
+	// Score is the highest model score of the transaction
+	Score float64
+	// Severity is the severity of the event, from 0 to 10
+	Severity int
+	// Priority labels the severity of the event, see Priority
+	Priority   string
+	Categories map[string]float64
+	Tags       []string
+	ClientIP   string
+	Method     string
+	URI        string
+	// Rescored are the models whose results were replaced after the
+	// connector transformed the payload
+	Rescored []string
+}
+
+// Priorities of the events
+const (
+	PriorityLow      = "low"
+	PriorityMedium   = "medium"
+	PriorityHigh     = "high"
+	PriorityCritical = "critical"
+)
+
+// Priority returns the priority of the events of the given severity:
+// critical from 9, high from 7, medium from 4 and low below
+func Priority(severity int) string {
+	switch {
+	case severity >= 9:
+		return PriorityCritical
+	case severity >= 7:
+		return PriorityHigh
+	case severity >= 4:
+		return PriorityMedium
+	default:
+		return PriorityLow
+	}
+}
+
+// Product identifies the product reporting the events in their headers
+type Product struct {
+	Vendor  string
+	Name    string
+	Version string
+}
+
+// DefaultProduct is the product of the events of WACE
+var DefaultProduct = Product{Vendor: "Tilsor", Name: "WACE", Version: "1.0"}
+
+// eventClassID and eventName describe the events in their headers
+const (
+	eventClassID = "block"
+	eventName    = "Blocked transaction"
+)
+
+// categories returns the categories of the event, sorted
+func (e Event) categories() string {
+	names := make([]string, 0, len(e.Categories))
+	for name := range e.Categories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// CEF returns the event in the Common Event Format
+func (e Event) CEF(p Product) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%s|%s|%d|", cefHeader(p.Vendor), cefHeader(p.Name), cefHeader(p.Version),
+		eventClassID, eventName, e.Severity)
+	ext := [][2]string{
+		{"rt", strconv.FormatInt(e.Time.UnixMilli(), 10)},
+		{"act", "block"},
+		{"src", e.ClientIP},
+		{"requestMethod", e.Method},
+		{"request", e.URI},
+		{"cat", e.categories()},
+		{"cs1Label", "transactionId"},
+		{"cs1", e.TransactionID},
+		{"cs2Label", "decision"},
+		{"cs2", e.Decision},
+		{"cs3Label", "tags"},
+		{"cs3", strings.Join(e.Tags, ",")},
+		{"cfp1Label", "score"},
+		{"cfp1", strconv.FormatFloat(e.Score, 'f', 4, 64)},
+	}
+	if e.Priority != "" {
+		ext = append(ext, [2]string{"cs4Label", "priority"}, [2]string{"cs4", e.Priority})
+	}
+	if len(e.Rescored) > 0 {
+		ext = append(ext, [2]string{"cs5Label", "rescored"}, [2]string{"cs5", strings.Join(e.Rescored, ",")})
+	}
+	sep := ""
+	for _, kv := range ext {
+		if kv[1] == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%s%s=%s", sep, kv[0], cefValue(kv[1]))
+		sep = " "
+	}
+	return b.String()
+}
+
+// LEEF returns the event in the Log Event Extended Format 1.0
+func (e Event) LEEF(p Product) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "LEEF:1.0|%s|%s|%s|%s|", leefHeader(p.Vendor), leefHeader(p.Name), leefHeader(p.Version), eventClassID)
+	attrs := [][2]string{
+		{"devTime", e.Time.UTC().Format("Jan 02 2006 15:04:05.000 UTC")},
+		{"devTimeFormat", "MMM dd yyyy HH:mm:ss.SSS z"},
+		{"sev", strconv.Itoa(e.Severity)},
+		{"cat", e.categories()},
+		{"src", e.ClientIP},
+		{"method", e.Method},
+		{"url", e.URI},
+		{"transactionId", e.TransactionID},
+		{"decision", e.Decision},
+		{"tags", strings.Join(e.Tags, ",")},
+		{"priority", e.Priority},
+		{"score", strconv.FormatFloat(e.Score, 'f', 4, 64)},
+		{"rescored", strings.Join(e.Rescored, ",")},
+	}
+	sep := ""
+	for _, kv := range attrs {
+		if kv[1] == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%s%s=%s", sep, kv[0], leefValue(kv[1]))
+		sep = "\t"
+	}
+	return b.String()
+}
+
+// cefHeader escapes a CEF header field
+func cefHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "|", `\|`, "\n", " ", "\r", " ").Replace(s)
+}
+
+// cefValue escapes a CEF extension value
+func cefValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+// leefHeader escapes a LEEF header field
+func leefHeader(s string) string {
+	return strings.NewReplacer("|", " ", "\n", " ", "\r", " ").Replace(s)
+}
+
+// leefValue removes the attribute delimiters from a LEEF value
+func leefValue(s string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(s)
+}
+
+// Sink formats the events and writes them to syslog in the background
+type Sink struct {
+	writer  *Writer
+	format  string
+	product Product
+	queue   chan Event
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Int64
+}
+
+// NewSink creates a sink writing the events in the format (FormatCEF
+// or FormatLEEF) with w, with at most queueSize events waiting (1000 if
+// zero), and starts it
+func NewSink(w *Writer, format string, product Product, queueSize int) (*Sink, error) {
+	if format != FormatCEF && format != FormatLEEF {
+		return nil, fmt.Errorf("unknown audit format %s", format)
+	}
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+	s := &Sink{
+		writer:  w,
+		format:  format,
+		product: product,
+		queue:   make(chan Event, queueSize),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Send queues the event to be written. It never blocks: events are
+// dropped when the queue is full.
+func (s *Sink) Send(e Event) {
+	select {
+	case s.queue <- e:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of events dropped because the queue was
+// full
+func (s *Sink) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close writes the queued events and closes the writer
+func (s *Sink) Close() error {
+	s.once.Do(func() { close(s.queue) })
+	<-s.done
+	return s.writer.Close()
+}
+
+// run writes the queued events
+func (s *Sink) run() {
+	defer close(s.done)
+	for e := range s.queue {
+		msg := e.CEF(s.product)
+		if s.format == FormatLEEF {
+			msg = e.LEEF(s.product)
+		}
+		if err := s.writer.Write(e.Time, msg); err != nil {
+			lg.Get().Printf(lg.WARN, "audit | could not write the event of transaction %s: %v", e.TransactionID, err)
+		}
+	}
+}
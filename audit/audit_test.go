@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testEvent = Event{
+	TransactionID: "tx-1",
+	Time:          time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	Decision:      "combiner",
+	Score:         0.93,
+	Severity:      9,
+	Categories:    map[string]float64{"sqli": 0.93, "xss": 0.2},
+	Tags:          []string{"category:sqli"},
+	ClientIP:      "203.0.113.7",
+	Method:        "GET",
+	URI:           "/search?q=1=1",
+}
+
+func TestCEF(t *testing.T) {
+	want := `CEF:0|Tilsor|WACE|1.0|block|Blocked transaction|9|rt=1772366400000 act=block src=203.0.113.7 requestMethod=GET request=/search?q\=1\=1 cat=sqli,xss cs1Label=transactionId cs1=tx-1 cs2Label=decision cs2=combiner cs3Label=tags cs3=category:sqli cfp1Label=score cfp1=0.9300`
+	if got := testEvent.CEF(DefaultProduct); got != want {
+		t.Errorf("CEF event is\n%s\nexpected\n%s", got, want)
+	}
+	if got := (Event{Severity: 5}).CEF(Product{Vendor: "A|B", Name: `C\D`, Version: "1"}); !strings.HasPrefix(got, `CEF:0|A\|B|C\\D|1|`) {
+		t.Errorf("CEF header not escaped: %s", got)
+	}
+}
+
+func TestPriority(t *testing.T) {
+	for severity, want := range map[int]string{1: PriorityLow, 4: PriorityMedium, 7: PriorityHigh, 8: PriorityHigh, 10: PriorityCritical} {
+		if got := Priority(severity); got != want {
+			t.Errorf("priority of severity %d is %s, want %s", severity, got, want)
+		}
+	}
+	e := testEvent
+	e.Priority = PriorityCritical
+	if got := e.CEF(DefaultProduct); !strings.HasSuffix(got, " cs4Label=priority cs4=critical") {
+		t.Errorf("CEF event %q has no priority", got)
+	}
+	if got := e.LEEF(DefaultProduct); !strings.Contains(got, "\tpriority=critical") {
+		t.Errorf("LEEF event %q has no priority", got)
+	}
+}
+
+func TestLEEF(t *testing.T) {
+	got := testEvent.LEEF(DefaultProduct)
+	if !strings.HasPrefix(got, "LEEF:1.0|Tilsor|WACE|1.0|block|devTime=Mar 01 2026 12:00:00.000 UTC\t") {
+		t.Errorf("LEEF header is %s", got)
+	}
+	for _, attr := range []string{"sev=9", "src=203.0.113.7", "url=/search?q=1=1", "transactionId=tx-1", "cat=sqli,xss"} {
+		if !strings.Contains(got, "\t"+attr) {
+			t.Errorf("LEEF event %q does not contain %s", got, attr)
+		}
+	}
+}
+
+func TestSinkUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	w, err := Dial(NetworkUDP, conn.LocalAddr().String(), nil, 13)
+	if err != nil {
+		t.Fatalf("Dial returned error: %v", err)
+	}
+	s, err := NewSink(w, FormatCEF, DefaultProduct, 0)
+	if err != nil {
+		t.Fatalf("NewSink returned error: %v", err)
+	}
+	s.Send(testEvent)
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no syslog message received: %v", err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<108>1 2026-03-01T12:00:00Z ") || !strings.Contains(msg, " wace ") || !strings.HasSuffix(msg, testEvent.CEF(DefaultProduct)) {
+		t.Errorf("unexpected syslog message %q", msg)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Close returned error: %v", err)
+	}
+}
+
+func TestWriterTCP(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	received := make(chan string, 2)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			length, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(length))
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				return
+			}
+			received <- string(msg)
+		}
+	}()
+
+	w, err := Dial(NetworkTCP, lis.Addr().String(), nil, 10)
+	if err != nil {
+		t.Fatalf("Dial returned error: %v", err)
+	}
+	defer w.Close()
+	for _, msg := range []string{"first", "second"} {
+		if err := w.Write(time.Now(), msg); err != nil {
+			t.Fatalf("Write returned error: %v", err)
+		}
+	}
+	for _, want := range []string{"first", "second"} {
+		select {
+		case msg := <-received:
+			if !strings.HasPrefix(msg, "<84>1 ") || !strings.HasSuffix(msg, " - - "+want) {
+				t.Errorf("unexpected framed message %q", msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("message %s not received", want)
+		}
+	}
+}
+
+func TestDialErrors(t *testing.T) {
+	if _, err := Dial("http", "127.0.0.1:514", nil, 13); err == nil {
+		t.Errorf("unknown network does not return error")
+	}
+	if _, err := Dial(NetworkUDP, "127.0.0.1:514", nil, 24); err == nil {
+		t.Errorf("invalid facility does not return error")
+	}
+}
@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Syslog transports
+const (
+	NetworkUDP = "udp"
+	NetworkTCP = "tcp"
+	NetworkTLS = "tls"
+)
+
+// syslogWarning is the syslog severity of the events
+const syslogWarning = 4
+
+// dialTimeout bounds the time to connect to the syslog server
+const dialTimeout = 10 * time.Second
+
+// Writer writes RFC 5424 syslog messages to a server. Over TCP and TLS
+// the messages are framed by octet counting (RFC 6587 and RFC 5425),
+// and the connection is reopened when a write fails.
+type Writer struct {
+	network   string
+	address   string
+	tlsConfig *tls.Config
+	facility  int
+	hostname  string
+	appName   string
+
+	mutex sync.Mutex
+	conn  net.Conn
+}
+
+// Dial connects to the syslog server at address over network
+// (NetworkUDP, NetworkTCP or NetworkTLS, with tlsConfig) and returns a
+// writer of messages of the given facility (0 to 23)
+func Dial(network, address string, tlsConfig *tls.Config, facility int) (*Writer, error) {
+	switch network {
+	case NetworkUDP, NetworkTCP, NetworkTLS:
+	default:
+		return nil, fmt.Errorf("unknown syslog network %s", network)
+	}
+	if facility < 0 || facility > 23 {
+		return nil, fmt.Errorf("syslog facility %d is not between 0 and 23", facility)
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	w := &Writer{network: network, address: address, tlsConfig: tlsConfig, facility: facility, hostname: hostname, appName: "wace"}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// connect opens the connection to the server
+func (w *Writer) connect() error {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if w.network == NetworkTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", w.address, w.tlsConfig)
+	} else {
+		conn, err = dialer.Dial(w.network, w.address)
+	}
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// format returns the syslog message of msg
+func (w *Writer) format(t time.Time, msg string) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %d - - %s", w.facility*8+syslogWarning, t.UTC().Format(time.RFC3339Nano),
+		w.hostname, w.appName, os.Getpid(), msg)
+}
+
+// Write sends msg, which happened at t, to the server
+func (w *Writer) Write(t time.Time, msg string) error {
+	line := w.format(t, msg)
+	if w.network != NetworkUDP {
+		line = fmt.Sprintf("%d %s", len(line), line)
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return err
+		}
+	}
+	_, err := w.conn.Write([]byte(line))
+	if err != nil && w.network != NetworkUDP {
+		// the server may have closed the connection: retry once
+		w.conn.Close()
+		w.conn = nil
+		if err = w.connect(); err != nil {
+			return err
+		}
+		_, err = w.conn.Write([]byte(line))
+	}
+	return err
+}
+
+// Close closes the connection to the server
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
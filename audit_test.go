@@ -0,0 +1,72 @@
+package wace
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tiroa-tilsor/wacelib/audit"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+)
+
+func TestAuditVerdict(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cf.Update(func(cs *cf.ConfigStore) error {
+		cs.Audit = cf.AuditConfig{Format: audit.FormatLEEF, Network: audit.NetworkUDP, Address: conn.LocalAddr().String(), Facility: 13}
+		return nil
+	})
+	defer cf.Update(func(cs *cf.ConfigStore) error {
+		cs.Audit = cf.AuditConfig{}
+		return nil
+	})
+	defaultCore.startAudit()
+
+	defaultCore.auditVerdict("tx-allowed", "combiner", Verdict{}, map[string]pm.ModelResults{"m1": {ProbAttack: 0.1}})
+	verdict := Verdict{Block: true, Categories: map[pm.AttackCategory]float64{pm.CategorySQLi: 0.74}}
+	defaultCore.auditVerdict("tx-blocked", "combiner", verdict, map[string]pm.ModelResults{"m1": {ProbAttack: 0.6}})
+	if err := StopAudit(); err != nil {
+		t.Fatalf("StopAudit returned error: %v", err)
+	}
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no audit event received: %v", err)
+	}
+	msg := string(buf[:n])
+	for _, attr := range []string{"transactionId=tx-blocked", "sev=7", "priority=high", "cat=sqli", "decision=combiner"} {
+		if !strings.Contains(msg, attr) {
+			t.Errorf("audit event %q does not contain %s", msg, attr)
+		}
+	}
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if n, _, err := conn.ReadFrom(buf); err == nil {
+		t.Errorf("unexpected audit event %q", buf[:n])
+	}
+}
+
+func TestAuditSeverity(t *testing.T) {
+	severities := map[string]int{"bot": 2, "sqli": 10}
+	probe := Verdict{Block: true, Categories: map[pm.AttackCategory]float64{pm.CategoryBot: 1}}
+	if s := auditSeverity(severities, probe, 1); s != 2 {
+		t.Errorf("severity of a scanner probe is %d, want 2", s)
+	}
+	injection := Verdict{Block: true, Categories: map[pm.AttackCategory]float64{pm.CategoryBot: 1, pm.CategorySQLi: 0.8}}
+	if s := auditSeverity(severities, injection, 1); s != 8 {
+		t.Errorf("severity of an injection is %d, want 8", s)
+	}
+	unmapped := Verdict{Block: true, Categories: map[pm.AttackCategory]float64{pm.CategoryXSS: 0.3}}
+	if s := auditSeverity(severities, unmapped, 0.55); s != 6 {
+		t.Errorf("severity of an unmapped category is %d, want 6", s)
+	}
+	if s := auditSeverity(nil, Verdict{Block: true}, 0); s != 1 {
+		t.Errorf("severity of a block without score is %d, want 1", s)
+	}
+}
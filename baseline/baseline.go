@@ -0,0 +1,206 @@
+/*
+Package baseline learns per-endpoint baselines of the traffic (payload
+sizes, parameter sets and content types) and persists them in the
+state store, so models and decisions can detect requests departing from
+the positive model of each endpoint.
+*/
+package baseline
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tiroa-tilsor/wacelib/statestore"
+)
+
+// KeyPrefix prefixes the state store keys of the baselines
+const KeyPrefix = "baseline/"
+
+// maxSizeDeviation is the number of standard deviations from the mean
+// payload size beyond which a payload size is anomalous
+const maxSizeDeviation = 3
+
+// Observation is what is learned from a single request
+type Observation struct {
+	Endpoint    string
+	PayloadSize int
+	ParamNames  []string
+	ContentType string
+}
+
+// Baseline is the learned profile of an endpoint
+type Baseline struct {
+	Endpoint     string
+	Samples      int
+	MinSize      int
+	MaxSize      int
+	MeanSize     float64
+	SizeM2       float64
+	Params       map[string]int
+	ContentTypes map[string]int
+	FirstSeen    time.Time
+	LastSeen     time.Time
+}
+
+// SizeStdDev returns the standard deviation of the payload sizes
+func (b Baseline) SizeStdDev() float64 {
+	if b.Samples < 2 {
+		return 0
+	}
+	return math.Sqrt(b.SizeM2 / float64(b.Samples-1))
+}
+
+// add updates the baseline with an observation
+func (b *Baseline) add(obs Observation, now time.Time) {
+	if b.Samples == 0 {
+		b.Endpoint = obs.Endpoint
+		b.MinSize, b.MaxSize = obs.PayloadSize, obs.PayloadSize
+		b.Params = make(map[string]int)
+		b.ContentTypes = make(map[string]int)
+		b.FirstSeen = now
+	}
+	b.Samples++
+	if obs.PayloadSize < b.MinSize {
+		b.MinSize = obs.PayloadSize
+	}
+	if obs.PayloadSize > b.MaxSize {
+		b.MaxSize = obs.PayloadSize
+	}
+	// Welford's online algorithm for mean and variance
+	delta := float64(obs.PayloadSize) - b.MeanSize
+	b.MeanSize += delta / float64(b.Samples)
+	b.SizeM2 += delta * (float64(obs.PayloadSize) - b.MeanSize)
+	for _, name := range obs.ParamNames {
+		b.Params[name]++
+	}
+	if obs.ContentType != "" {
+		b.ContentTypes[obs.ContentType]++
+	}
+	b.LastSeen = now
+}
+
+// Anomalies returns the ways in which the observation departs from the
+// baseline: payload size far from the mean, parameters never seen and
+// content types never seen
+func (b Baseline) Anomalies(obs Observation) []string {
+	var anomalies []string
+	if b.Samples == 0 {
+		return []string{"unknown endpoint"}
+	}
+	stddev := b.SizeStdDev()
+	if stddev > 0 && math.Abs(float64(obs.PayloadSize)-b.MeanSize) > maxSizeDeviation*stddev {
+		anomalies = append(anomalies, fmt.Sprintf("payload size %d", obs.PayloadSize))
+	} else if stddev == 0 && (obs.PayloadSize < b.MinSize || obs.PayloadSize > b.MaxSize) {
+		anomalies = append(anomalies, fmt.Sprintf("payload size %d", obs.PayloadSize))
+	}
+	for _, name := range obs.ParamNames {
+		if _, ok := b.Params[name]; !ok {
+			anomalies = append(anomalies, "param "+name)
+		}
+	}
+	if obs.ContentType != "" {
+		if _, ok := b.ContentTypes[obs.ContentType]; !ok {
+			anomalies = append(anomalies, "content type "+obs.ContentType)
+		}
+	}
+	sort.Strings(anomalies)
+	return anomalies
+}
+
+// Learner builds baselines in the state store during a learning period
+type Learner struct {
+	store   statestore.Store
+	started time.Time
+	period  time.Duration
+	mutex   sync.Mutex
+	now     func() time.Time
+}
+
+// NewLearner creates a learner that observes traffic for the given
+// period from now. A zero period learns forever.
+func NewLearner(store statestore.Store, period time.Duration) *Learner {
+	return &Learner{store: store, started: time.Now(), period: period, now: time.Now}
+}
+
+// Learning returns true while the learning period lasts
+func (l *Learner) Learning() bool {
+	return l.period == 0 || l.now().Before(l.started.Add(l.period))
+}
+
+// Observe adds the observation to the baseline of its endpoint. It
+// does nothing once the learning period is over.
+func (l *Learner) Observe(obs Observation) error {
+	if !l.Learning() {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	b, _, err := l.Get(obs.Endpoint)
+	if err != nil {
+		return err
+	}
+	b.add(obs, l.now())
+	value, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	return l.store.Set(KeyPrefix+obs.Endpoint, value, 0)
+}
+
+// Get returns the baseline of the endpoint, and false if none was learned
+func (l *Learner) Get(endpoint string) (Baseline, bool, error) {
+	var b Baseline
+	value, found, err := l.store.Get(KeyPrefix + endpoint)
+	if err != nil || !found {
+		return b, false, err
+	}
+	if err := json.Unmarshal(value, &b); err != nil {
+		return b, false, fmt.Errorf("invalid baseline of %s: %v", endpoint, err)
+	}
+	return b, true, nil
+}
+
+// ContentType returns the media type of the Content-Type header of a
+// raw request, without parameters
+func ContentType(payload string) string {
+	for _, line := range strings.Split(payload, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			break
+		}
+		name, value, found := strings.Cut(line, ":")
+		if found && strings.EqualFold(strings.TrimSpace(name), "content-type") {
+			mediaType, _, _ := strings.Cut(value, ";")
+			return strings.ToLower(strings.TrimSpace(mediaType))
+		}
+	}
+	return ""
+}
+
+// PayloadSize returns the size of the body of a raw request: the value
+// of its Content-Length header, or else the length of what follows the
+// headers
+func PayloadSize(payload string) int {
+	lines := strings.SplitAfter(payload, "\n")
+	offset := 0
+	for i, line := range lines {
+		offset += len(line)
+		trimmed := strings.TrimRight(line, "\r\n")
+		if i > 0 && trimmed == "" {
+			return len(payload) - offset
+		}
+		name, value, found := strings.Cut(trimmed, ":")
+		if found && strings.EqualFold(strings.TrimSpace(name), "content-length") {
+			if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+				return n
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,64 @@
+package baseline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tiroa-tilsor/wacelib/statestore"
+)
+
+func TestLearner(t *testing.T) {
+	learner := NewLearner(statestore.NewMemory(), time.Hour)
+
+	for _, size := range []int{100, 110, 90, 105, 95} {
+		err := learner.Observe(Observation{Endpoint: "POST /login", PayloadSize: size, ParamNames: []string{"user", "password"}, ContentType: "application/x-www-form-urlencoded"})
+		if err != nil {
+			t.Fatalf("Observe returned error: %v", err)
+		}
+	}
+
+	b, found, err := learner.Get("POST /login")
+	if err != nil || !found {
+		t.Fatalf("baseline not found: %v", err)
+	}
+	if b.Samples != 5 || b.MinSize != 90 || b.MaxSize != 110 || b.MeanSize != 100 {
+		t.Errorf("unexpected baseline %+v", b)
+	}
+
+	if anomalies := b.Anomalies(Observation{PayloadSize: 102, ParamNames: []string{"user"}, ContentType: "application/x-www-form-urlencoded"}); len(anomalies) != 0 {
+		t.Errorf("normal request has anomalies %v", anomalies)
+	}
+	anomalies := b.Anomalies(Observation{PayloadSize: 5000, ParamNames: []string{"user", "cmd"}, ContentType: "application/json"})
+	if len(anomalies) != 3 {
+		t.Errorf("anomalous request has anomalies %v", anomalies)
+	}
+}
+
+func TestLearningPeriod(t *testing.T) {
+	learner := NewLearner(statestore.NewMemory(), time.Hour)
+	learner.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	if learner.Learning() {
+		t.Errorf("learner still learning after its period")
+	}
+	learner.Observe(Observation{Endpoint: "GET /"})
+	if _, found, _ := learner.Get("GET /"); found {
+		t.Errorf("baseline updated after the learning period")
+	}
+}
+
+func TestContentType(t *testing.T) {
+	payload := "POST / HTTP/1.1\nContent-Type: Application/JSON; charset=utf-8\n\n{}"
+	if ct := ContentType(payload); ct != "application/json" {
+		t.Errorf("content type is %q", ct)
+	}
+}
+
+func TestPayloadSize(t *testing.T) {
+	if size := PayloadSize("POST / HTTP/1.1\nContent-Length: 42\n"); size != 42 {
+		t.Errorf("size with content length is %d", size)
+	}
+	if size := PayloadSize("POST / HTTP/1.1\nHost: a\n\nuser=bob"); size != 8 {
+		t.Errorf("size of the body is %d", size)
+	}
+}
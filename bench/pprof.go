@@ -0,0 +1,69 @@
+package bench
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+)
+
+// Names of the profiles written by Profile
+const (
+	CPUProfile  = "cpu.pprof"
+	HeapProfile = "heap.pprof"
+)
+
+// StartCPUProfile starts writing a CPU profile to the file at path, and
+// returns the function that stops it
+func StartCPUProfile(path string) (func() error, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() error {
+		pprof.StopCPUProfile()
+		return f.Close()
+	}, nil
+}
+
+// WriteHeapProfile writes a profile of the live heap to the file at
+// path, after a garbage collection
+func WriteHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Profile runs fn while capturing a CPU profile, and then a heap
+// profile, in the CPUProfile and HeapProfile files of dir. The CPU
+// profile of a representative run can be copied as default.pgo to the
+// main package of the connector to build it with profile-guided
+// optimization.
+func Profile(dir string, fn func() error) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	stop, err := StartCPUProfile(filepath.Join(dir, CPUProfile))
+	if err != nil {
+		return err
+	}
+	fnErr := fn()
+	if err := stop(); err != nil {
+		return err
+	}
+	if fnErr != nil {
+		return fnErr
+	}
+	return WriteHeapProfile(filepath.Join(dir, HeapProfile))
+}
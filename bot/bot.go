@@ -0,0 +1,153 @@
+/*
+Package bot scores how likely a client is to be an automated agent from
+the signals given by the connector (the JA3/JA4 fingerprints of its TLS
+handshake and the order of its request headers) and the headers of the
+request.
+*/
+package bot
+
+import (
+	"sort"
+	"strings"
+)
+
+// Signals are the client signals known for a transaction
+type Signals struct {
+	// JA3 is the JA3 fingerprint of the TLS client hello
+	JA3 string `json:"ja3,omitempty"`
+	// JA4 is the JA4 fingerprint of the TLS client hello
+	JA4 string `json:"ja4,omitempty"`
+	// HeaderOrder lists the lower-cased request header names in the
+	// order they were received
+	HeaderOrder []string `json:"headerOrder,omitempty"`
+	// UserAgent is the User-Agent request header
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+// Empty returns true if no signal is known
+func (s Signals) Empty() bool {
+	return s.JA3 == "" && s.JA4 == "" && len(s.HeaderOrder) == 0 && s.UserAgent == ""
+}
+
+// Names of the reasons reported by Score
+const (
+	ReasonNoUserAgent    = "no-user-agent"
+	ReasonAutomationUA   = "automation-user-agent"
+	ReasonKnownTLS       = "known-bot-tls"
+	ReasonHeaderOrder    = "header-order"
+	ReasonMissingHeaders = "missing-browser-headers"
+)
+
+// Config lists the TLS fingerprints of known automated clients
+type Config struct {
+	JA3 []string
+	JA4 []string
+}
+
+// automationAgents are substrings of the user agents of automation
+// tools and crawlers
+var automationAgents = []string{
+	"curl", "wget", "python-requests", "python-urllib", "go-http-client",
+	"java/", "okhttp", "libwww-perl", "headlesschrome", "phantomjs",
+	"selenium", "scrapy", "httpclient", "bot", "spider", "crawler",
+}
+
+// browserHeaders are sent by every mainstream browser
+var browserHeaders = []string{"accept", "accept-language", "accept-encoding"}
+
+// severities of each reason
+var severities = map[string]float64{
+	ReasonNoUserAgent:    0.6,
+	ReasonAutomationUA:   0.7,
+	ReasonKnownTLS:       0.9,
+	ReasonHeaderOrder:    0.4,
+	ReasonMissingHeaders: 0.5,
+}
+
+// Score returns the likelihood that the client is a bot, combining the
+// severity of every reason found as independent evidence, and the
+// sorted reasons
+func Score(s Signals, c Config) (float64, []string) {
+	var reasons []string
+	ua := strings.ToLower(s.UserAgent)
+	switch {
+	case ua == "":
+		reasons = append(reasons, ReasonNoUserAgent)
+	case containsAny(ua, automationAgents):
+		reasons = append(reasons, ReasonAutomationUA)
+	}
+	if (s.JA3 != "" && contains(c.JA3, s.JA3)) || (s.JA4 != "" && contains(c.JA4, s.JA4)) {
+		reasons = append(reasons, ReasonKnownTLS)
+	}
+	if strings.HasPrefix(ua, "mozilla/") && len(s.HeaderOrder) > 0 {
+		// Browsers always send these headers, and send Host first
+		for _, name := range browserHeaders {
+			if !contains(s.HeaderOrder, name) {
+				reasons = append(reasons, ReasonMissingHeaders)
+				break
+			}
+		}
+		if s.HeaderOrder[0] != "host" {
+			reasons = append(reasons, ReasonHeaderOrder)
+		}
+	}
+
+	benign := 1.0
+	for _, reason := range reasons {
+		benign *= 1 - severities[reason]
+	}
+	sort.Strings(reasons)
+	return 1 - benign, reasons
+}
+
+// HeaderOrder returns the lower-cased header names of a raw request in
+// order
+func HeaderOrder(payload string) []string {
+	var names []string
+	for i, line := range strings.Split(payload, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if i == 0 && !strings.Contains(line, ":") {
+			continue
+		}
+		if line == "" {
+			break
+		}
+		if name, _, found := strings.Cut(line, ":"); found {
+			names = append(names, strings.ToLower(strings.TrimSpace(name)))
+		}
+	}
+	return names
+}
+
+// UserAgent returns the User-Agent header of a raw request
+func UserAgent(payload string) string {
+	for i, line := range strings.Split(payload, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" && i > 0 {
+			break
+		}
+		name, value, found := strings.Cut(line, ":")
+		if found && strings.EqualFold(strings.TrimSpace(name), "user-agent") {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	config := Config{JA3: []string{"e7d705a3286e19ea42f587b344ee6865"}}
+	browser := []string{"host", "user-agent", "accept", "accept-language", "accept-encoding"}
+
+	tests := []struct {
+		name    string
+		signals Signals
+		reasons []string
+	}{
+		{"browser", Signals{UserAgent: "Mozilla/5.0 (X11; Linux x86_64)", HeaderOrder: browser}, nil},
+		{"no user agent", Signals{HeaderOrder: []string{"host"}}, []string{ReasonNoUserAgent}},
+		{"curl", Signals{UserAgent: "curl/8.5.0"}, []string{ReasonAutomationUA}},
+		{"known tls", Signals{UserAgent: "Mozilla/5.0", JA3: "e7d705a3286e19ea42f587b344ee6865", HeaderOrder: browser}, []string{ReasonKnownTLS}},
+		{"fake browser", Signals{UserAgent: "Mozilla/5.0", HeaderOrder: []string{"user-agent", "host"}}, []string{ReasonHeaderOrder, ReasonMissingHeaders}},
+	}
+	for _, test := range tests {
+		score, reasons := Score(test.signals, config)
+		if strings.Join(reasons, ",") != strings.Join(test.reasons, ",") {
+			t.Errorf("%s: reasons %v, expected %v", test.name, reasons, test.reasons)
+		}
+		if (score > 0) != (len(test.reasons) > 0) {
+			t.Errorf("%s: score %v with reasons %v", test.name, score, reasons)
+		}
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	payload := "GET / HTTP/1.1\r\nHost: example.com\r\nUser-Agent: curl/8.5.0\r\nAccept: */*\r\n\r\nignored: body"
+	if order := strings.Join(HeaderOrder(payload), ","); order != "host,user-agent,accept" {
+		t.Errorf("header order is %s", order)
+	}
+	if ua := UserAgent(payload); ua != "curl/8.5.0" {
+		t.Errorf("user agent is %q", ua)
+	}
+}
@@ -0,0 +1,145 @@
+package wace
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// BudgetExceededTag tags the transactions of tenants over their daily
+// budget
+const BudgetExceededTag = "budget:exceeded"
+
+// MetaBudgetExceeded is set to "true" in the metadata of the
+// transactions of tenants over their daily budget
+const MetaBudgetExceeded = "budget.exceeded"
+
+// budgetKeyPrefix prefixes the state store keys of the daily spend of
+// each tenant
+const budgetKeyPrefix = "budget/"
+
+// transactionCost is the estimated compute cost of the analyses of a
+// transaction
+type transactionCost struct {
+	mutex sync.Mutex
+	cost  float64
+}
+
+// budgetMutex serializes the updates of the spend of the tenants
+var budgetMutex sync.Mutex
+
+// TransactionCost returns the estimated compute cost of the analyses
+// made so far on the transaction, the sum of the costs of the models
+// called
+func TransactionCost(transactionID string) float64 {
+	return coreOf(transactionID).TransactionCost(transactionID)
+}
+
+// TransactionCost is like the TransactionCost function
+func (c *Core) TransactionCost(transactionID string) float64 {
+	value, ok := c.transactionCosts.Load(transactionID)
+	if !ok {
+		return 0
+	}
+	tc := value.(*transactionCost)
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	return tc.cost
+}
+
+// TenantSpend returns the estimated compute cost of the analyses of the
+// transactions of the tenant today, in UTC
+func TenantSpend(tenant string) float64 {
+	return tenantSpend(tenant, time.Now())
+}
+
+// budgetKey returns the state store key of the spend of the tenant on
+// the day of now
+func budgetKey(tenant string, now time.Time) string {
+	return budgetKeyPrefix + now.UTC().Format("2006-01-02") + "/" + tenant
+}
+
+// tenantSpend returns the spend of the tenant on the day of now
+func tenantSpend(tenant string, now time.Time) float64 {
+	value, found, err := StateStore().Get(budgetKey(tenant, now))
+	if err != nil || !found {
+		return 0
+	}
+	spend, _ := strconv.ParseFloat(string(value), 64)
+	return spend
+}
+
+// chargeModels returns the models to call on the transaction, adding
+// their cost to the transaction and to the spend of its tenant. Once
+// the tenant is over its daily budget, the models are degraded as
+// configured and the transaction is tagged.
+func (c *Core) chargeModels(transactionID string, models []string) []string {
+	conf := c.config()
+	tenant := c.transactionContext(transactionID).Tenant
+	budget, capped := conf.Budget.TenantBudget(tenant)
+	now := time.Now()
+
+	if capped && tenantSpend(tenant, now) >= budget {
+		c.setMetadata(transactionID, map[string]string{MetaBudgetExceeded: "true"})
+		var kept []string
+		for _, id := range models {
+			switch {
+			case conf.Budget.Degradation == cf.BudgetReport,
+				conf.Budget.Degradation == cf.BudgetFree && conf.ModelPlugins[id].Cost == 0:
+				kept = append(kept, id)
+			default:
+				c.tprintf(lg.DEBUG, transactionID, "core | %s skipped, tenant %s over its budget", id, tenant)
+				c.recordSkippedModel(transactionID, id, "budget_exceeded")
+			}
+		}
+		models = kept
+	}
+
+	var cost float64
+	for _, id := range models {
+		cost += conf.ModelPlugins[id].Cost
+	}
+	if cost == 0 {
+		return models
+	}
+	value, _ := c.transactionCosts.LoadOrStore(transactionID, &transactionCost{})
+	tc := value.(*transactionCost)
+	tc.mutex.Lock()
+	tc.cost += cost
+	tc.mutex.Unlock()
+	c.recordCost(transactionID, cost)
+
+	if tenant != "" {
+		budgetMutex.Lock()
+		spend := tenantSpend(tenant, now) + cost
+		err := StateStore().Set(budgetKey(tenant, now), []byte(strconv.FormatFloat(spend, 'g', -1, 64)), 48*time.Hour)
+		budgetMutex.Unlock()
+		if err != nil {
+			c.tprintf(lg.WARN, transactionID, "core | could not store spend of tenant %s in state store: %v", tenant, err)
+		}
+	}
+	return models
+}
+
+// recordCost records the estimated cost of the models called on the
+// transaction
+func (c *Core) recordCost(transactionID string, cost float64) {
+	inst, attributes := c.transactionMetrics(transactionID)
+	counter, err := inst.Float64Counter("wace.transaction.cost", metric.WithDescription("Estimated compute cost of the analyses"))
+	if err != nil {
+		c.tprintf(lg.WARN, transactionID, "core | failed to record cost metric: %v", err.Error())
+		return
+	}
+	counter.Add(ctx, cost, metric.WithAttributes(attributes...))
+}
+
+// transactionBudgetExceeded returns true if the tenant of the
+// transaction was over its budget when it was analyzed
+func (c *Core) transactionBudgetExceeded(transactionID string) bool {
+	return c.TransactionMetadata(transactionID)[MetaBudgetExceeded] == "true"
+}
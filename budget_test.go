@@ -0,0 +1,90 @@
+package wace
+
+import (
+	"sync/atomic"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestBudget(t *testing.T) {
+	var calls atomic.Int64
+	err := pm.RegisterModel("budgetcounter", nil, func(input pm.ModelInput) (pm.ModelResults, error) {
+		calls.Add(1)
+		return pm.ModelResults{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inConf cf.ConfigFileData
+	err = yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: expensive
+    kind: builtin
+    builtin: budgetcounter
+    plugintype: RequestHeaders
+    cost: 5
+  - id: free
+    kind: builtin
+    builtin: budgetcounter
+    plugintype: RequestHeaders
+decisionplugins:
+  - id: combiner
+    kind: builtin
+budget:
+  tenants:
+    budgettest: 8
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("budget", conf, testMeter)
+
+	// the second transaction starts under the budget and goes over it,
+	// the third only calls the free model
+	for i, want := range []struct {
+		calls    int64
+		cost     float64
+		exceeded bool
+	}{{2, 5, false}, {2, 5, false}, {1, 0, true}} {
+		calls.Store(0)
+		id := generateRandomID()
+		engine.InitTransactionWithOptions(id, TransactionOptions{Tenant: "budgettest"})
+		if err := Analyze("RequestHeaders", id, "GET / HTTP/1.1\n", []string{"expensive", "free"}); err != nil {
+			t.Fatalf("Analyze returned error: %v", err)
+		}
+		verdict, err := CheckTransactionVerdict(id, "combiner", nil)
+		CloseTransaction(id)
+		if err != nil {
+			t.Fatalf("CheckTransactionVerdict returned error: %v", err)
+		}
+		if calls.Load() != want.calls || verdict.Cost != want.cost {
+			t.Errorf("transaction %d called %d models with cost %v, want %d with cost %v", i, calls.Load(), verdict.Cost, want.calls, want.cost)
+		}
+		exceeded := len(verdict.Tags) > 0 && verdict.Tags[len(verdict.Tags)-1] == BudgetExceededTag
+		if exceeded != want.exceeded {
+			t.Errorf("transaction %d tags are %v", i, verdict.Tags)
+		}
+	}
+	if spend := TenantSpend("budgettest"); spend != 10 {
+		t.Errorf("tenant spend is %v, want 10", spend)
+	}
+
+	// transactions without a tenant are not capped
+	id := generateRandomID()
+	engine.InitTransaction(id)
+	defer CloseTransaction(id)
+	Analyze("RequestHeaders", id, "GET / HTTP/1.1\n", []string{"expensive"})
+	if verdict, _ := CheckTransactionVerdict(id, "combiner", nil); verdict.Cost != 5 {
+		t.Errorf("transaction without tenant cost is %v, want 5", verdict.Cost)
+	}
+}
@@ -0,0 +1,128 @@
+package wace
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sort"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+)
+
+// modulePath is the path of the WACE module
+const modulePath = "github.com/tiroa-tilsor/wacelib"
+
+// Build information of the binary, set at link time with
+//
+//	go build -ldflags "-X github.com/tiroa-tilsor/wacelib.buildVersion=v1.2.0 -X github.com/tiroa-tilsor/wacelib.buildCommit=$(git rev-parse HEAD) -X github.com/tiroa-tilsor/wacelib.buildDate=$(date -u +%FT%TZ)"
+//
+// They default to those read from the module information of the binary.
+var buildVersion, buildCommit, buildDate string
+
+// BuildInfo describes the WACE build of the running instance, for
+// fleet inventory and debugging
+type BuildInfo struct {
+	// Version is the version of the WACE module, "(devel)" when built
+	// from its own source tree
+	Version string
+	// Commit and BuildDate are those of the binary, if known
+	Commit    string
+	BuildDate string
+	GoVersion string
+	// PluginAPIVersion and MinPluginAPIVersion are the range of plugin
+	// API versions supported
+	PluginAPIVersion    int
+	MinPluginAPIVersion int
+	// Transports are the plugin kinds of the configured plugins, and
+	// nats if NATS is used
+	Transports []string
+	// Features are the optional subsystems enabled in the configuration
+	Features []string
+}
+
+// Version returns the build information of WACE, with the transports
+// and features of the configuration in use
+func Version() BuildInfo {
+	info := BuildInfo{
+		Version:             "unknown",
+		GoVersion:           runtime.Version(),
+		PluginAPIVersion:    pm.PluginAPIVersion,
+		MinPluginAPIVersion: pm.MinPluginAPIVersion,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if bi.Main.Path == modulePath {
+			info.Version = bi.Main.Version
+			// the version control settings are those of the main module
+			for _, setting := range bi.Settings {
+				switch setting.Key {
+				case "vcs.revision":
+					info.Commit = setting.Value
+				case "vcs.time":
+					info.BuildDate = setting.Value
+				}
+			}
+		}
+		for _, dep := range bi.Deps {
+			if dep.Path == modulePath {
+				info.Version = dep.Version
+				if dep.Replace != nil && dep.Replace.Version != "" {
+					info.Version = dep.Replace.Version
+				}
+			}
+		}
+	}
+	if buildVersion != "" {
+		info.Version = buildVersion
+	}
+	if buildCommit != "" {
+		info.Commit = buildCommit
+	}
+	if buildDate != "" {
+		info.BuildDate = buildDate
+	}
+	info.Transports, info.Features = configFeatures(cf.Snapshot())
+	return info
+}
+
+// configFeatures returns the sorted transports of the plugins of conf
+// and the optional subsystems it enables
+func configFeatures(conf *cf.ConfigStore) ([]string, []string) {
+	kinds := make(map[string]bool)
+	for _, modelConfig := range conf.ModelPlugins {
+		kinds[string(modelConfig.Kind)] = true
+	}
+	for _, decisionConfig := range conf.DecisionPlugins {
+		kinds[string(decisionConfig.Kind)] = true
+	}
+	if conf.UsesNATS() {
+		kinds["nats"] = true
+	}
+	transports := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		transports = append(transports, kind)
+	}
+	sort.Strings(transports)
+
+	enabled := map[string]bool{
+		"export":         conf.Export.Sink != "",
+		"webhooks":       len(conf.Webhooks) > 0,
+		"audit":          conf.Audit.Format != "",
+		"geoip":          conf.GeoIP.Database != "",
+		"challenge":      len(conf.Challenge.Secret) > 0,
+		"fingerprinting": conf.Fingerprinting,
+		"learning":       conf.Learning,
+		"reanalysis":     conf.Reanalysis.SampleRate > 0,
+		"campaigns":      conf.Campaigns.Interval > 0,
+		"resultstore":    conf.ResultStore.Redis != "",
+		"healthchecks":   conf.HealthCheckInterval > 0,
+		"anonymization":  len(conf.Anonymization.Secret) > 0,
+	}
+	var features []string
+	for feature, on := range enabled {
+		if on {
+			features = append(features, feature)
+		}
+	}
+	sort.Strings(features)
+	return transports, features
+}
@@ -0,0 +1,57 @@
+package wace
+
+import (
+	"reflect"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestVersion(t *testing.T) {
+	info := Version()
+	if info.Version == "" || info.GoVersion == "" || info.PluginAPIVersion != pm.PluginAPIVersion || info.MinPluginAPIVersion != pm.MinPluginAPIVersion {
+		t.Errorf("build info is %+v", info)
+	}
+
+	buildVersion, buildCommit = "v1.2.3", "abc123"
+	defer func() { buildVersion, buildCommit = "", "" }()
+	if info := Version(); info.Version != "v1.2.3" || info.Commit != "abc123" {
+		t.Errorf("build info set at link time is %+v", info)
+	}
+}
+
+func TestConfigFeatures(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+natsmode: enabled
+learning: true
+healthcheckinterval: 0s
+modelplugins:
+  - id: remote
+    kind: http
+    url: http://localhost:8080/predict
+    plugintype: RequestHeaders
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	transports, features := configFeatures(conf)
+	if !reflect.DeepEqual(transports, []string{"builtin", "http", "nats"}) {
+		t.Errorf("transports are %v", transports)
+	}
+	if !reflect.DeepEqual(features, []string{"learning"}) {
+		t.Errorf("features are %v", features)
+	}
+}
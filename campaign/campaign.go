@@ -0,0 +1,192 @@
+/*
+Package campaign clusters the high-score transactions into attack
+campaigns by the similarity of their requests: the endpoint, the
+n-grams of the payload and the autonomous system of the client. The
+detections of a campaign run from many addresses or spread over time
+are thus reported together, instead of request by request.
+*/
+package campaign
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+// NGramSize is the length in bytes of the n-grams of the payloads
+const NGramSize = 3
+
+// maxNGrams bounds the distinct n-grams kept for a payload
+const maxNGrams = 512
+
+// Weights of the features in the similarity of two samples. The ASN
+// only counts when both samples have one.
+const (
+	endpointWeight = 0.3
+	ngramsWeight   = 0.5
+	asnWeight      = 0.2
+)
+
+// Sample is a high-score transaction to cluster
+type Sample struct {
+	TransactionID string
+	Time          time.Time
+	// Score is the highest model or category score of the transaction
+	Score float64
+	// Endpoint is the method and path template of the request
+	Endpoint string
+	// NGrams are the sorted hashes of the distinct n-grams of the
+	// payload, as returned by NGrams
+	NGrams []uint32
+	// ASN is the autonomous system number of the client, if known
+	ASN string
+}
+
+// Campaign is a cluster of similar high-score transactions
+type Campaign struct {
+	// ID identifies the campaign by its first transaction
+	ID        string
+	Size      int
+	FirstSeen time.Time
+	LastSeen  time.Time
+	MaxScore  float64
+	// Endpoints and ASNs are the distinct values of the transactions
+	Endpoints []string
+	ASNs      []string
+	// Transactions are the IDs of the transactions, oldest first
+	Transactions []string
+}
+
+// NGrams returns the sorted hashes of the distinct n-grams of the
+// payload, at most maxNGrams of them
+func NGrams(payload string) []uint32 {
+	seen := make(map[uint32]bool)
+	for i := 0; i+NGramSize <= len(payload) && len(seen) < maxNGrams; i++ {
+		h := fnv.New32a()
+		h.Write([]byte(payload[i : i+NGramSize]))
+		seen[h.Sum32()] = true
+	}
+	ngrams := make([]uint32, 0, len(seen))
+	for ngram := range seen {
+		ngrams = append(ngrams, ngram)
+	}
+	sort.Slice(ngrams, func(i, j int) bool { return ngrams[i] < ngrams[j] })
+	return ngrams
+}
+
+// jaccard returns the Jaccard index of two sorted sets
+func jaccard(a, b []uint32) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	common := 0
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			common++
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+// Similarity returns the similarity of two samples, between 0 and 1
+func Similarity(a, b Sample) float64 {
+	score, total := 0.0, endpointWeight+ngramsWeight
+	if a.Endpoint == b.Endpoint {
+		score += endpointWeight
+	}
+	score += ngramsWeight * jaccard(a.NGrams, b.NGrams)
+	if a.ASN != "" && b.ASN != "" {
+		total += asnWeight
+		if a.ASN == b.ASN {
+			score += asnWeight
+		}
+	}
+	return score / total
+}
+
+// Cluster groups the samples whose similarity reaches minSimilarity,
+// transitively, and returns the groups of at least minSize samples as
+// campaigns, the largest first
+func Cluster(samples []Sample, minSimilarity float64, minSize int) []Campaign {
+	parents := make([]int, len(samples))
+	for i := range parents {
+		parents[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if parents[i] != i {
+			parents[i] = root(parents[i])
+		}
+		return parents[i]
+	}
+	for i := range samples {
+		for j := i + 1; j < len(samples); j++ {
+			if root(i) != root(j) && Similarity(samples[i], samples[j]) >= minSimilarity {
+				parents[root(j)] = root(i)
+			}
+		}
+	}
+
+	groups := make(map[int][]Sample)
+	for i, sample := range samples {
+		groups[root(i)] = append(groups[root(i)], sample)
+	}
+	var campaigns []Campaign
+	for _, group := range groups {
+		if len(group) >= minSize {
+			campaigns = append(campaigns, newCampaign(group))
+		}
+	}
+	sort.Slice(campaigns, func(i, j int) bool {
+		if campaigns[i].Size != campaigns[j].Size {
+			return campaigns[i].Size > campaigns[j].Size
+		}
+		return campaigns[i].ID < campaigns[j].ID
+	})
+	return campaigns
+}
+
+// newCampaign returns the campaign of a group of samples
+func newCampaign(group []Sample) Campaign {
+	sort.Slice(group, func(i, j int) bool {
+		if !group[i].Time.Equal(group[j].Time) {
+			return group[i].Time.Before(group[j].Time)
+		}
+		return group[i].TransactionID < group[j].TransactionID
+	})
+	h := fnv.New64a()
+	h.Write([]byte(group[0].TransactionID))
+	c := Campaign{
+		ID:        fmt.Sprintf("%016x", h.Sum64()),
+		Size:      len(group),
+		FirstSeen: group[0].Time,
+		LastSeen:  group[len(group)-1].Time,
+	}
+	endpoints := make(map[string]bool)
+	asns := make(map[string]bool)
+	for _, sample := range group {
+		c.Transactions = append(c.Transactions, sample.TransactionID)
+		if sample.Score > c.MaxScore {
+			c.MaxScore = sample.Score
+		}
+		if sample.Endpoint != "" && !endpoints[sample.Endpoint] {
+			endpoints[sample.Endpoint] = true
+			c.Endpoints = append(c.Endpoints, sample.Endpoint)
+		}
+		if sample.ASN != "" && !asns[sample.ASN] {
+			asns[sample.ASN] = true
+			c.ASNs = append(c.ASNs, sample.ASN)
+		}
+	}
+	sort.Strings(c.Endpoints)
+	sort.Strings(c.ASNs)
+	return c
+}
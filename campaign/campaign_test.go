@@ -0,0 +1,74 @@
+package campaign
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSimilarity(t *testing.T) {
+	a := Sample{Endpoint: "GET /search", NGrams: NGrams("q=' union select password from users--"), ASN: "64500"}
+	b := Sample{Endpoint: "GET /search", NGrams: NGrams("q=' union select password from admins--"), ASN: "64500"}
+	c := Sample{Endpoint: "POST /login", NGrams: NGrams("user=admin&pass=<script>alert(1)</script>"), ASN: "64501"}
+
+	if s := Similarity(a, a); s != 1 {
+		t.Errorf("similarity of a sample with itself is %v", s)
+	}
+	if s := Similarity(a, b); s < 0.8 {
+		t.Errorf("similarity of close samples is %v", s)
+	}
+	if s := Similarity(a, c); s > 0.2 {
+		t.Errorf("similarity of different samples is %v", s)
+	}
+	noASN := b
+	noASN.ASN = ""
+	if Similarity(a, noASN) >= Similarity(a, b) || Similarity(a, noASN) < 0.7 {
+		t.Errorf("similarity without ASN is %v, with it %v", Similarity(a, noASN), Similarity(a, b))
+	}
+}
+
+func TestCluster(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	var samples []Sample
+	for i := 0; i < 4; i++ {
+		samples = append(samples, Sample{
+			TransactionID: fmt.Sprintf("sqli-%d", i),
+			Time:          start.Add(time.Duration(3-i) * time.Minute),
+			Score:         0.9 + float64(i)/100,
+			Endpoint:      "GET /search",
+			NGrams:        NGrams(fmt.Sprintf("q=' union select password from users where id=%d--", i)),
+			ASN:           fmt.Sprintf("6450%d", i%2),
+		})
+	}
+	for i := 0; i < 2; i++ {
+		samples = append(samples, Sample{
+			TransactionID: fmt.Sprintf("xss-%d", i),
+			Time:          start,
+			Score:         0.95,
+			Endpoint:      "POST /comments",
+			NGrams:        NGrams(fmt.Sprintf("body=<script>document.location='http://evil/%d'</script>", i)),
+		})
+	}
+	samples = append(samples, Sample{TransactionID: "alone", Time: start, Score: 0.99, Endpoint: "GET /", NGrams: NGrams("../../etc/passwd")})
+
+	campaigns := Cluster(samples, 0.6, 2)
+	if len(campaigns) != 2 {
+		t.Fatalf("campaigns are %+v", campaigns)
+	}
+	sqli := campaigns[0]
+	if sqli.Size != 4 || sqli.Transactions[0] != "sqli-3" || sqli.MaxScore != 0.93 || len(sqli.ASNs) != 2 || len(sqli.Endpoints) != 1 {
+		t.Errorf("first campaign is %+v", sqli)
+	}
+	if !sqli.FirstSeen.Equal(start) || !sqli.LastSeen.Equal(start.Add(3*time.Minute)) {
+		t.Errorf("first campaign seen from %v to %v", sqli.FirstSeen, sqli.LastSeen)
+	}
+	if campaigns[1].Size != 2 || campaigns[1].Endpoints[0] != "POST /comments" {
+		t.Errorf("second campaign is %+v", campaigns[1])
+	}
+	if again := Cluster(samples[0:3], 0.6, 2); again[0].ID == sqli.ID {
+		t.Errorf("campaign without its first transaction keeps its ID")
+	}
+	if campaigns := Cluster(samples, 0.6, 3); len(campaigns) != 1 {
+		t.Errorf("campaigns of at least 3 transactions are %+v", campaigns)
+	}
+}
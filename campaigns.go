@@ -0,0 +1,229 @@
+package wace
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tiroa-tilsor/wacelib/campaign"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"github.com/tiroa-tilsor/wacelib/fingerprint"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+	"go.opentelemetry.io/otel/metric"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// campaignKeyPrefix prefixes the state store keys of the high-score
+// transactions kept to be clustered into campaigns
+const campaignKeyPrefix = "campaign/"
+
+// maxCampaignPayload bounds the request bytes kept for the n-grams of
+// a transaction
+const maxCampaignPayload = 8192
+
+// campaignFeatures guards the request features of a transaction, until
+// it is checked
+type campaignFeatures struct {
+	mutex    sync.Mutex
+	endpoint string
+	payload  strings.Builder
+}
+
+// collectCampaignFeatures keeps the request line and body of the
+// transaction, to cluster it if it gets a high score
+func (c *Core) collectCampaignFeatures(transactionID string, modelsType cf.ModelPluginType, payload string) {
+	if c.config().Campaigns.Interval <= 0 {
+		return
+	}
+	var requestLine, body string
+	switch modelsType {
+	case cf.RequestHeaders:
+		requestLine, _, _ = strings.Cut(payload, "\n")
+	case cf.RequestBody:
+		body = payload
+	case cf.AllRequest, cf.Everything:
+		requestLine, _, _ = strings.Cut(payload, "\n")
+		body = payload
+		if _, after, found := strings.Cut(payload, "\n\n"); found {
+			body = after
+		} else if _, after, found := strings.Cut(payload, "\r\n\r\n"); found {
+			body = after
+		}
+	default:
+		return
+	}
+	value, _ := c.campaignFeaturesMap.LoadOrStore(transactionID, &campaignFeatures{})
+	features := value.(*campaignFeatures)
+	features.mutex.Lock()
+	defer features.mutex.Unlock()
+	if requestLine != "" {
+		features.endpoint = fingerprint.Compute(payload).Endpoint()
+		features.payload.WriteString(strings.TrimRight(requestLine, "\r"))
+		features.payload.WriteByte('\n')
+	}
+	features.payload.WriteString(body)
+	if features.payload.Len() > maxCampaignPayload {
+		kept := features.payload.String()[:maxCampaignPayload]
+		features.payload.Reset()
+		features.payload.WriteString(kept)
+	}
+}
+
+// recordCampaignSample stores the checked transaction in the state
+// store to be clustered by the background job, if it has a high score
+func (c *Core) recordCampaignSample(transactionID string, verdict Verdict, results map[string]pm.ModelResults) {
+	value, ok := c.campaignFeaturesMap.Load(transactionID)
+	if !ok {
+		return
+	}
+	conf := c.config().Campaigns
+	score := 0.0
+	for _, res := range results {
+		score = math.Max(score, res.ProbAttack)
+	}
+	for _, categoryScore := range verdict.Categories {
+		score = math.Max(score, categoryScore)
+	}
+	if score < conf.MinScore {
+		return
+	}
+	features := value.(*campaignFeatures)
+	features.mutex.Lock()
+	sample := campaign.Sample{
+		TransactionID: c.scope(transactionID),
+		Time:          time.Now(),
+		Score:         score,
+		Endpoint:      features.endpoint,
+		NGrams:        campaign.NGrams(features.payload.String()),
+		ASN:           verdict.Metadata[MetaGeoASN],
+	}
+	features.mutex.Unlock()
+	data, err := json.Marshal(sample)
+	if err == nil {
+		err = c.stateStore().Set(campaignKeyPrefix+transactionID, data, conf.Window)
+	}
+	if err != nil {
+		c.tprintf(lg.WARN, transactionID, "core | could not keep transaction for campaign detection: %v", err)
+	}
+}
+
+// startCampaigns starts the background campaign detection job if
+// enabled, stopping the previous one
+func (c *Core) startCampaigns() {
+	if c.campaignsStop != nil {
+		close(c.campaignsStop)
+		c.campaignsStop = nil
+	}
+	conf := c.config().Campaigns
+	if conf.Interval <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	c.campaignsStop = stop
+	go func() {
+		ticker := time.NewTicker(conf.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				c.RunCampaignDetection()
+			}
+		}
+	}()
+	lg.Get().Printf(lg.INFO, "Clustering the transactions scoring %v or more into campaigns every %v", conf.MinScore, conf.Interval)
+}
+
+// RunCampaignDetection clusters the high-score transactions of the
+// campaign window kept in the state store, and publishes the campaigns
+// not detected before. It returns all the campaigns found, which are
+// also returned by Campaigns until the next run. It is run
+// periodically by the background job.
+func RunCampaignDetection() []campaign.Campaign {
+	return defaultCore.RunCampaignDetection()
+}
+
+// RunCampaignDetection is like the RunCampaignDetection function
+func (c *Core) RunCampaignDetection() []campaign.Campaign {
+	logger := lg.Get()
+	conf := c.config().Campaigns
+	s := c.stateStore()
+	keys, err := s.Keys(campaignKeyPrefix)
+	if err != nil {
+		logger.Printf(lg.WARN, "core | could not list transactions to cluster: %v", err)
+		return nil
+	}
+	since := time.Now().Add(-conf.Window)
+	var samples []campaign.Sample
+	for _, key := range keys {
+		data, found, err := s.Get(key)
+		if err != nil || !found {
+			continue
+		}
+		var sample campaign.Sample
+		if err := json.Unmarshal(data, &sample); err != nil {
+			logger.Printf(lg.WARN, "core | invalid campaign sample %s: %v", key, err)
+			continue
+		}
+		if sample.Time.After(since) {
+			samples = append(samples, sample)
+		}
+	}
+	campaigns := campaign.Cluster(samples, conf.Similarity, conf.MinSize)
+
+	c.campaignsMutex.Lock()
+	previous := c.notifiedCampaigns
+	c.detectedCampaigns = campaigns
+	c.notifiedCampaigns = make(map[string]bool, len(campaigns))
+	var detected []campaign.Campaign
+	for _, found := range campaigns {
+		c.notifiedCampaigns[found.ID] = true
+		if !previous[found.ID] {
+			detected = append(detected, found)
+		}
+	}
+	c.campaignsMutex.Unlock()
+	for _, found := range detected {
+		c.publishCampaign(conf, found)
+	}
+	return campaigns
+}
+
+// Campaigns returns the campaigns found by the last campaign detection,
+// the largest first
+func Campaigns() []campaign.Campaign {
+	return defaultCore.Campaigns()
+}
+
+// Campaigns is like the Campaigns function
+func (c *Core) Campaigns() []campaign.Campaign {
+	c.campaignsMutex.RLock()
+	defer c.campaignsMutex.RUnlock()
+	campaigns := make([]campaign.Campaign, len(c.detectedCampaigns))
+	copy(campaigns, c.detectedCampaigns)
+	return campaigns
+}
+
+// publishCampaign logs and counts a new campaign, and sends it to the
+// configured webhook
+func (c *Core) publishCampaign(conf cf.CampaignsConfig, found campaign.Campaign) {
+	logger := lg.Get()
+	logger.Printf(lg.WARN, "core | campaign %s detected: %d transactions on %v since %v", found.ID, found.Size, found.Endpoints, found.FirstSeen)
+	if counter, err := c.plugins.Load().instruments.Int64Counter("wace.campaigns.detected.total", metric.WithDescription("Number of attack campaigns detected")); err == nil {
+		counter.Add(ctx, 1, metric.WithAttributes(c.attributes...))
+	}
+	if conf.Webhook == "" {
+		return
+	}
+	data, err := json.Marshal(found)
+	if err != nil {
+		return
+	}
+	if err := postJSON(conf.Webhook, data); err != nil {
+		logger.Printf(lg.WARN, "core | could not post campaign %s: %v", found.ID, err)
+	}
+}
@@ -0,0 +1,78 @@
+package wace
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/tiroa-tilsor/wacelib/campaign"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+	"github.com/tiroa-tilsor/wacelib/statestore"
+)
+
+func TestCampaignDetection(t *testing.T) {
+	var mutex sync.Mutex
+	var posted []campaign.Campaign
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var c campaign.Campaign
+		json.NewDecoder(r.Body).Decode(&c)
+		mutex.Lock()
+		posted = append(posted, c)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+	SetStateStore(statestore.NewMemory())
+	err := initilize([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+campaigns:
+  interval: 1h
+  minsize: 3
+  webhook: ` + server.URL + `
+`))
+	if err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+	defer func() {
+		cf.Update(func(conf *cf.ConfigStore) error {
+			conf.Campaigns = cf.CampaignsConfig{}
+			return nil
+		})
+		defaultCore.startCampaigns()
+	}()
+
+	check := func(path string, score float64, asn string) {
+		id := generateRandomID()
+		defer defaultCore.campaignFeaturesMap.Delete(id)
+		defaultCore.collectCampaignFeatures(id, cf.RequestHeaders, "GET "+path+" HTTP/1.1\nHost: example.com\n")
+		defaultCore.collectCampaignFeatures(id, cf.RequestBody, "comment=<script>alert(document.cookie)</script>")
+		results := map[string]pm.ModelResults{"xss": {ProbAttack: score}}
+		defaultCore.recordCampaignSample(id, Verdict{Block: true, Metadata: map[string]string{MetaGeoASN: asn}}, results)
+	}
+	for i := 0; i < 4; i++ {
+		check(fmt.Sprintf("/posts/%d/comments", i), 0.9, "64500")
+	}
+	check("/posts/9/comments", 0.5, "64500")
+
+	campaigns := RunCampaignDetection()
+	if len(campaigns) != 1 || campaigns[0].Size != 4 || campaigns[0].Endpoints[0] != "GET /posts/{int}/comments" || campaigns[0].ASNs[0] != "64500" {
+		t.Fatalf("campaigns are %+v", campaigns)
+	}
+	if listed := Campaigns(); len(listed) != 1 || listed[0].ID != campaigns[0].ID {
+		t.Errorf("listed campaigns are %+v", listed)
+	}
+
+	check("/posts/5/comments", 0.95, "64501")
+	if again := RunCampaignDetection(); len(again) != 1 || again[0].Size != 5 || again[0].ID != campaigns[0].ID {
+		t.Errorf("campaigns after another transaction are %+v", again)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(posted) != 1 || posted[0].ID != campaigns[0].ID || posted[0].Size != 4 {
+		t.Errorf("posted campaigns are %+v", posted)
+	}
+}
@@ -0,0 +1,129 @@
+package wace
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tiroa-tilsor/wacelib/challenge"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// Metadata keys of the challenge workflow. The connector can give the
+// token presented by the client in MetaChallengeToken; otherwise it is
+// read from the configured cookie or header of the request.
+const (
+	MetaChallengeToken  = "challenge.token"
+	MetaChallengePassed = "challenge.passed"
+)
+
+// ChallengePassedTag tags the transactions of clients presenting a
+// valid challenge token
+const ChallengePassedTag = "challenge:passed"
+
+// IssueChallengeToken returns a token for the client of the transaction
+// to present on its next requests, once it solved the challenge. The
+// token is bound to the metadata values listed in the challenge bind
+// setting, so the connector must set them (e.g. client.ip) before,
+// with InitTransactionWithOptions, SetTransactionMetadata or
+// AnalyzeWithMeta. No token is issued while one of them is missing.
+func IssueChallengeToken(transactionID string) (string, error) {
+	return coreOf(transactionID).IssueChallengeToken(transactionID)
+}
+
+// IssueChallengeToken is like the IssueChallengeToken function
+func (c *Core) IssueChallengeToken(transactionID string) (string, error) {
+	conf := c.config().Challenge
+	if len(conf.Secret) == 0 {
+		return "", errors.New("challenge tokens are disabled, no secret configured")
+	}
+	subject, err := challengeSubject(conf, c.TransactionMetadata(transactionID))
+	if err != nil {
+		return "", err
+	}
+	return challenge.Issue(conf.Secret, subject, time.Now().Add(conf.TTL))
+}
+
+// challengeSubject returns the subject a token of the client of the
+// transaction is bound to, from the transaction metadata. It fails if
+// a bound value is missing, as the token would not be bound to it.
+func challengeSubject(conf cf.ChallengeConfig, meta map[string]string) (string, error) {
+	values := make([]string, len(conf.Bind))
+	for i, key := range conf.Bind {
+		if meta[key] == "" {
+			return "", fmt.Errorf("challenge token not bound, missing metadata %s", key)
+		}
+		values[i] = meta[key]
+	}
+	return strings.Join(values, "\x00"), nil
+}
+
+// challengePassed returns true if the client of the transaction
+// presented a valid challenge token, looking for it in the request
+// headers of the payload. The result is kept in the metadata.
+func (c *Core) challengePassed(transactionID string, modelsType cf.ModelPluginType, payload string) bool {
+	conf := c.config().Challenge
+	if len(conf.Secret) == 0 {
+		return false
+	}
+	meta := c.TransactionMetadata(transactionID)
+	if passed, ok := meta[MetaChallengePassed]; ok {
+		return passed == "true"
+	}
+	token := meta[MetaChallengeToken]
+	if token == "" && (modelsType == cf.RequestHeaders || modelsType == cf.AllRequest || modelsType == cf.Everything) {
+		token = challengeToken(conf, payload)
+	}
+	if token == "" {
+		return false
+	}
+	subject, err := challengeSubject(conf, meta)
+	if err == nil {
+		err = challenge.Validate(conf.Secret, token, subject, time.Now())
+	}
+	if err != nil {
+		c.tprintf(lg.DEBUG, transactionID, "core | challenge token rejected: %v", err)
+	}
+	passed := "false"
+	if err == nil {
+		passed = "true"
+	}
+	c.setMetadata(transactionID, map[string]string{MetaChallengePassed: passed})
+	return err == nil
+}
+
+// challengeToken returns the token in the configured header or cookie
+// of the request headers of the payload
+func challengeToken(conf cf.ChallengeConfig, payload string) string {
+	for i, line := range strings.Split(payload, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if i > 0 && line == "" {
+			break
+		}
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if strings.EqualFold(name, conf.Header) {
+			return value
+		}
+		if strings.EqualFold(name, "cookie") {
+			for _, cookie := range strings.Split(value, ";") {
+				if k, v, ok := strings.Cut(strings.TrimSpace(cookie), "="); ok && k == conf.Cookie {
+					return strings.Trim(v, `"`)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// transactionChallengePassed returns true if a valid challenge token
+// was found for the transaction
+func (c *Core) transactionChallengePassed(transactionID string) bool {
+	return c.TransactionMetadata(transactionID)[MetaChallengePassed] == "true"
+}
@@ -0,0 +1,73 @@
+/*
+Package challenge issues and validates the signed tokens given to the
+clients that solved a challenge (a CAPTCHA or a JavaScript challenge),
+so their retries can be recognized and skip the heavy analysis. A token
+is bound to a subject, such as the client address, expires, and is
+signed with HMAC-SHA256.
+*/
+package challenge
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version prefixes the tokens, so the format can change
+const version = "v1"
+
+var (
+	// ErrMalformed is returned for tokens that were not issued by Issue
+	ErrMalformed = errors.New("malformed challenge token")
+	// ErrSignature is returned for tokens signed with another secret,
+	// for another subject or modified
+	ErrSignature = errors.New("invalid challenge token signature")
+	// ErrExpired is returned for tokens past their expiry
+	ErrExpired = errors.New("expired challenge token")
+)
+
+// Issue returns a token for the subject, valid until the expiry
+func Issue(secret []byte, subject string, expiry time.Time) (string, error) {
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	payload := version + "." + strconv.FormatInt(expiry.Unix(), 10) + "." + hex.EncodeToString(nonce)
+	return payload + "." + sign(secret, payload, subject), nil
+}
+
+// Validate returns nil if the token was issued with the secret for the
+// subject and has not expired at now
+func Validate(secret []byte, token, subject string, now time.Time) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 || parts[0] != version {
+		return ErrMalformed
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return ErrMalformed
+	}
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(sign(secret, payload, subject))) {
+		return ErrSignature
+	}
+	if !now.Before(time.Unix(expiry, 0)) {
+		return ErrExpired
+	}
+	return nil
+}
+
+// sign returns the signature of the payload of a token for the subject
+func sign(secret []byte, payload, subject string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	mac.Write([]byte{0})
+	mac.Write([]byte(subject))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,36 @@
+package challenge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	now := time.Now()
+	token, err := Issue(secret, "203.0.113.7", now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Issue returned error: %v", err)
+	}
+
+	if err := Validate(secret, token, "203.0.113.7", now); err != nil {
+		t.Errorf("valid token returns %v", err)
+	}
+	if err := Validate(secret, token, "203.0.113.8", now); err != ErrSignature {
+		t.Errorf("token of another subject returns %v", err)
+	}
+	if err := Validate([]byte("another secret"), token, "203.0.113.7", now); err != ErrSignature {
+		t.Errorf("token of another secret returns %v", err)
+	}
+	if err := Validate(secret, token, "203.0.113.7", now.Add(time.Hour)); err != ErrExpired {
+		t.Errorf("expired token returns %v", err)
+	}
+	modified := []byte(token)
+	modified[len(modified)-1] ^= 1
+	if err := Validate(secret, string(modified), "203.0.113.7", now); err != ErrSignature {
+		t.Errorf("modified token returns %v", err)
+	}
+	if err := Validate(secret, "garbage", "203.0.113.7", now); err != ErrMalformed {
+		t.Errorf("malformed token returns %v", err)
+	}
+}
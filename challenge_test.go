@@ -0,0 +1,106 @@
+package wace
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestChallenge(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: bot
+    kind: builtin
+    plugintype: RequestHeaders
+    weight: 1
+decisionplugins:
+  - id: bots
+    kind: builtin
+    builtin: categories
+    categories:
+      bot:
+        threshold: 0.5
+        action: challenge
+challenge:
+  secret: 0123456789abcdef0123
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("challenge", conf, testMeter)
+	check := func(headers string) Verdict {
+		id := generateRandomID()
+		engine.InitTransactionWithOptions(id, TransactionOptions{Metadata: map[string]string{MetaClientIP: "203.0.113.7"}})
+		defer CloseTransaction(id)
+		Analyze("RequestHeaders", id, "GET / HTTP/1.1\nHost: example.com\nUser-Agent: curl/8.0\n"+headers, []string{"bot"})
+		verdict, err := CheckTransactionVerdict(id, "bots", nil)
+		if err != nil {
+			t.Fatalf("CheckTransactionVerdict returned error: %v", err)
+		}
+		return verdict
+	}
+
+	if verdict := check(""); !verdict.Challenge || verdict.Block {
+		t.Fatalf("bot not challenged: %+v", verdict)
+	}
+
+	id := generateRandomID()
+	engine.InitTransactionWithOptions(id, TransactionOptions{Metadata: map[string]string{MetaClientIP: "203.0.113.7"}})
+	token, err := IssueChallengeToken(id)
+	CloseTransaction(id)
+	if err != nil {
+		t.Fatalf("IssueChallengeToken returned error: %v", err)
+	}
+
+	verdict := check("Cookie: session=1; wace_challenge=" + token + "\n")
+	if verdict.Challenge || verdict.Metadata[MetaChallengePassed] != "true" {
+		t.Errorf("client with a valid token challenged: %+v", verdict)
+	}
+	if len(verdict.Tags) == 0 || verdict.Tags[len(verdict.Tags)-1] != ChallengePassedTag {
+		t.Errorf("client with a valid token not tagged: %v", verdict.Tags)
+	}
+	if verdict := check("X-Wace-Challenge: " + token + "x\n"); !verdict.Challenge {
+		t.Errorf("client with an invalid token not challenged: %+v", verdict)
+	}
+
+	id = generateRandomID()
+	engine.InitTransaction(id)
+	_, err = IssueChallengeToken(id)
+	CloseTransaction(id)
+	if err == nil {
+		t.Error("IssueChallengeToken issued an unbound token without client address")
+	}
+
+	id = generateRandomID()
+	engine.InitTransaction(id)
+	AnalyzeWithMeta("RequestHeaders", id, "GET / HTTP/1.1\nHost: example.com\n", nil, map[string]string{MetaClientIP: "203.0.113.7"})
+	token, err = IssueChallengeToken(id)
+	CloseTransaction(id)
+	if err != nil {
+		t.Fatalf("IssueChallengeToken returned error with the client address given to AnalyzeWithMeta: %v", err)
+	}
+	if verdict := check("X-Wace-Challenge: " + token + "\n"); verdict.Challenge {
+		t.Errorf("client with a token issued after AnalyzeWithMeta challenged: %+v", verdict)
+	}
+
+	id = generateRandomID()
+	engine.InitTransaction(id)
+	Analyze("RequestHeaders", id, "GET / HTTP/1.1\nHost: example.com\nUser-Agent: curl/8.0\nX-Wace-Challenge: "+token+"\n", []string{"bot"})
+	verdict, err = CheckTransactionVerdict(id, "bots", nil)
+	CloseTransaction(id)
+	if err != nil {
+		t.Fatalf("CheckTransactionVerdict returned error: %v", err)
+	}
+	if !verdict.Challenge || verdict.Metadata[MetaChallengePassed] == "true" {
+		t.Errorf("token accepted without client address: %+v", verdict)
+	}
+}
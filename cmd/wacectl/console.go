@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/tiroa-tilsor/wacelib/admin"
+)
+
+const consoleHelp = `Paste a raw HTTP request and end it with a line containing a single ".".
+Commands:
+  :models m1,m2     set the model plugins
+  :decision id      set the decision plugin
+  :type t           set the part of the transaction (default AllRequest)
+  :waf k=v,...      set the WAF parameters
+  :log on|off       show the transaction log of every analysis
+  :show             show the current settings
+  :help             show this help
+  :quit             exit the console
+`
+
+// console is an interactive session analyzing pasted requests
+type console struct {
+	client  *client
+	out     io.Writer
+	request admin.ReplayRequest
+	showLog bool
+}
+
+// runConsole reads requests and commands from in until EOF or :quit
+func runConsole(c *client, in io.Reader, out io.Writer) error {
+	con := &console{
+		client:  c,
+		out:     out,
+		request: admin.ReplayRequest{Type: "AllRequest", WAFParams: make(map[string]string)},
+	}
+	fmt.Fprint(out, consoleHelp)
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 10<<20)
+	var payload strings.Builder
+	fmt.Fprint(out, "wace> ")
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case payload.Len() == 0 && strings.HasPrefix(line, ":"):
+			if quit := con.command(line); quit {
+				return nil
+			}
+		case line == ".":
+			con.analyze(payload.String())
+			payload.Reset()
+		default:
+			payload.WriteString(line + "\n")
+			continue
+		}
+		fmt.Fprint(out, "wace> ")
+	}
+	if payload.Len() > 0 {
+		con.analyze(payload.String())
+	}
+	return scanner.Err()
+}
+
+// command executes a console command. It returns true on :quit.
+func (con *console) command(line string) bool {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(line, ":"), " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "models":
+		con.request.Models = splitList(arg)
+	case "decision":
+		con.request.Decision = arg
+	case "type":
+		con.request.Type = arg
+	case "waf":
+		con.request.WAFParams = make(map[string]string)
+		for _, kv := range splitList(arg) {
+			k, v, _ := strings.Cut(kv, "=")
+			con.request.WAFParams[k] = v
+		}
+	case "log":
+		con.showLog = arg == "on"
+	case "show":
+		fmt.Fprintf(con.out, "models: %s\ndecision: %s\ntype: %s\nwaf: %v\n",
+			strings.Join(con.request.Models, ","), con.request.Decision, con.request.Type, con.request.WAFParams)
+	case "help":
+		fmt.Fprint(con.out, consoleHelp)
+	case "quit", "exit":
+		return true
+	default:
+		fmt.Fprintf(con.out, "unknown command :%s, type :help\n", name)
+	}
+	return false
+}
+
+// analyze replays the payload and prints the explained result
+func (con *console) analyze(payload string) {
+	req := con.request
+	req.Payload = payload
+	body, err := json.Marshal(req)
+	if err != nil {
+		fmt.Fprintf(con.out, "error: %v\n", err)
+		return
+	}
+	var res admin.ReplayResult
+	if err := con.client.call(http.MethodPost, "/v1/replay", bytes.NewReader(body), &res); err != nil {
+		fmt.Fprintf(con.out, "error: %v\n", err)
+	}
+	explain(con.out, res, con.showLog)
+}
+
+// explain prints the scores of every model, their share of the
+// weighted score and the final verdict
+func explain(out io.Writer, res admin.ReplayResult, showLog bool) {
+	models := make([]string, 0, len(res.Results))
+	totalWeight := 0.0
+	for id := range res.Results {
+		models = append(models, id)
+		totalWeight += res.Weights[id]
+	}
+	sort.Strings(models)
+
+	fmt.Fprintf(out, "transaction %s\n", res.TransactionID)
+	for _, id := range models {
+		score := res.Results[id].ProbAttack
+		share := 0.0
+		if totalWeight > 0 {
+			share = res.Weights[id] * score / totalWeight
+		}
+		fmt.Fprintf(out, "  %-24s score %.4f  weight %.2f  weighted contribution %.4f\n", id, score, res.Weights[id], share)
+		for category, cs := range res.Results[id].Categories {
+			fmt.Fprintf(out, "  %-24s   %s %.4f\n", "", category, cs)
+		}
+	}
+	for category, score := range res.Verdict.Categories {
+		fmt.Fprintf(out, "  category %-15s %.4f\n", category, score)
+	}
+	if len(res.Verdict.Tags) > 0 {
+		fmt.Fprintf(out, "  tags: %s\n", strings.Join(res.Verdict.Tags, ", "))
+	}
+	for id, evidence := range res.Verdict.Evidence {
+		fmt.Fprintf(out, "  evidence %s: %v\n", id, evidence)
+	}
+	if res.Error != "" {
+		fmt.Fprintf(out, "  error: %s\n", res.Error)
+	}
+	verdict := "ALLOW"
+	if res.Verdict.Block {
+		verdict = "BLOCK"
+	}
+	fmt.Fprintf(out, "verdict: %s\n", verdict)
+	if showLog {
+		for _, entry := range res.Log {
+			fmt.Fprintf(out, "  %s %-5s %s\n", entry.Time.Format("15:04:05.000000"), entry.Level, entry.Message)
+		}
+	}
+}
+
+// call sends a request to the admin API and decodes the JSON response
+// into v
+func (c *client) call(method, path string, body io.Reader, v interface{}) error {
+	req, err := http.NewRequest(method, c.addr+path, body)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s %s: %s: %v", method, path, resp.Status, err)
+	}
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusUnprocessableEntity {
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	wace "github.com/tiroa-tilsor/wacelib"
+	"github.com/tiroa-tilsor/wacelib/admin"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+)
+
+func TestConsole(t *testing.T) {
+	var received admin.ReplayRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		json.NewEncoder(w).Encode(admin.ReplayResult{
+			TransactionID: "replay-1",
+			Verdict:       wace.Verdict{Block: true},
+			Results:       map[string]pm.ModelResults{"roberta": {ProbAttack: 0.8}},
+			Weights:       map[string]float64{"roberta": 1},
+		})
+	}))
+	defer server.Close()
+
+	in := strings.NewReader(":models roberta,trivial\n:decision simple\nGET /?q=1 HTTP/1.1\nHost: example.com\n.\n:quit\n")
+	var out bytes.Buffer
+	c := &client{addr: server.URL, http: server.Client()}
+	if err := runConsole(c, in, &out); err != nil {
+		t.Fatalf("console returned error: %v", err)
+	}
+
+	if received.Decision != "simple" || len(received.Models) != 2 {
+		t.Errorf("console sent decision %q and models %v", received.Decision, received.Models)
+	}
+	if received.Payload != "GET /?q=1 HTTP/1.1\nHost: example.com\n" {
+		t.Errorf("console sent payload %q", received.Payload)
+	}
+	for _, expected := range []string{"roberta", "score 0.8000", "verdict: BLOCK"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("console output does not contain %q:\n%s", expected, out.String())
+		}
+	}
+}
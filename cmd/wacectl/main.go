@@ -0,0 +1,217 @@
+/*
+Wacectl operates a running WACE instance through its admin API.
+
+Usage:
+
+	wacectl [-addr url] [-token token] <command> [arguments]
+
+The commands are:
+
+	ls-plugins                     list the configured plugins
+	set-weight <model> <weight>    change the weight of a model plugin
+	reload                         reload the configuration file
+	rollback                       revert to the previous configuration
+	status                         show the status of the instance
+	version                        show the build information of the instance
+	campaigns                      list the attack campaigns detected
+	dump                           dump the configuration and status
+	replay [flags] <file>          analyze the payload stored in file
+	validate-config <file>         validate a configuration file
+	schema                         show the JSON Schema of the configuration file
+	console                        analyze pasted requests interactively
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tiroa-tilsor/wacelib/admin"
+)
+
+// client sends requests to the admin API
+type client struct {
+	addr  string
+	token string
+	http  *http.Client
+}
+
+func main() {
+	addr := flag.String("addr", envOr("WACE_ADMIN_ADDR", "http://localhost:9090"), "admin API address")
+	token := flag.String("token", os.Getenv("WACE_ADMIN_TOKEN"), "admin API bearer token")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+	c := &client{addr: strings.TrimRight(*addr, "/"), token: *token, http: &http.Client{Timeout: 60 * time.Second}}
+
+	if err := run(c, flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "wacectl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage: wacectl [-addr url] [-token token] <command> [arguments]
+
+commands:
+  ls-plugins                     list the configured plugins
+  set-weight <model> <weight>    change the weight of a model plugin
+  reload                         reload the configuration file
+  rollback                       revert to the previous configuration
+  status                         show the status of the instance
+  version                        show the build information of the instance
+  campaigns                      list the attack campaigns detected
+  dump                           dump the configuration and status
+  replay [flags] <file>          analyze the payload stored in file ("-" for stdin)
+  validate-config <file>         validate a configuration file
+  schema                         show the JSON Schema of the configuration file
+  console                        analyze pasted requests interactively
+
+flags:
+`)
+	flag.PrintDefaults()
+}
+
+// run executes the given command
+func run(c *client, command string, args []string) error {
+	switch command {
+	case "ls-plugins":
+		return c.do(http.MethodGet, "/v1/plugins", nil)
+	case "set-weight":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: set-weight <model> <weight>")
+		}
+		weight, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid weight %s: %v", args[1], err)
+		}
+		return c.doJSON(http.MethodPut, "/v1/plugins/"+args[0]+"/weight", admin.WeightRequest{Weight: weight})
+	case "reload":
+		return c.do(http.MethodPost, "/v1/reload", nil)
+	case "rollback":
+		return c.do(http.MethodPost, "/v1/rollback", nil)
+	case "status":
+		return c.do(http.MethodGet, "/v1/status", nil)
+	case "version":
+		return c.do(http.MethodGet, "/v1/version", nil)
+	case "campaigns":
+		return c.do(http.MethodGet, "/v1/campaigns", nil)
+	case "dump":
+		return c.do(http.MethodGet, "/v1/dump", nil)
+	case "replay":
+		return replay(c, args)
+	case "validate-config":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: validate-config <file>")
+		}
+		content, err := readInput(args[0])
+		if err != nil {
+			return err
+		}
+		return c.do(http.MethodPost, "/v1/validate-config", bytes.NewReader(content))
+	case "schema":
+		return c.do(http.MethodGet, "/v1/schema", nil)
+	case "console":
+		return runConsole(c, os.Stdin, os.Stdout)
+	}
+	return fmt.Errorf("unknown command %s", command)
+}
+
+// replay sends the payload stored in a file to the replay endpoint
+func replay(c *client, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	models := fs.String("models", "", "comma separated list of model plugins")
+	decision := fs.String("decision", "", "decision plugin")
+	partType := fs.String("type", "AllRequest", "part of the transaction contained in the payload")
+	waf := fs.String("waf", "", "comma separated list of key=value WAF parameters")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: replay [-models m1,m2] [-decision d] [-type t] [-waf k=v,...] <file>")
+	}
+	payload, err := readInput(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	req := admin.ReplayRequest{
+		Type:      *partType,
+		Payload:   string(payload),
+		Models:    splitList(*models),
+		Decision:  *decision,
+		WAFParams: make(map[string]string),
+	}
+	for _, kv := range splitList(*waf) {
+		k, v, _ := strings.Cut(kv, "=")
+		req.WAFParams[k] = v
+	}
+	return c.doJSON(http.MethodPost, "/v1/replay", req)
+}
+
+// doJSON sends v encoded as JSON
+func (c *client) doJSON(method, path string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.do(method, path, bytes.NewReader(body))
+}
+
+// do sends a request to the admin API and prints the response
+func (c *client) do(method, path string, body io.Reader) error {
+	req, err := http.NewRequest(method, c.addr+path, body)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	return nil
+}
+
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func envOr(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
@@ -0,0 +1,145 @@
+package wace
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// Policies combining the decisions of several decision plugins
+const (
+	// CombineAnyBlock blocks if any decision plugin blocks
+	CombineAnyBlock = "any-block"
+	// CombineAllBlock blocks if every decision plugin blocks
+	CombineAllBlock = "all-block"
+	// CombineWeighted blocks if the weighted share of the decision
+	// plugins that block reaches the threshold
+	CombineWeighted = "weighted"
+)
+
+// Combination is how CheckTransactionCombined combines the decisions of
+// several decision plugins
+type Combination struct {
+	Policy string
+	// Weights are the weights of the decision plugins with the weighted
+	// policy, 1 for those not listed
+	Weights map[string]float64
+	// Threshold is the weighted share of blocking decision plugins that
+	// blocks with the weighted policy, 0.5 by default
+	Threshold float64
+}
+
+// CombinedVerdict is the verdict of a transaction checked with several
+// decision plugins
+type CombinedVerdict struct {
+	Verdict
+	// Decisions maps the decision plugins that decided to their outcome
+	Decisions map[string]pm.DecisionResult
+	// Errors maps the decision plugins that failed to their error. They
+	// are left out of the combination.
+	Errors map[string]error
+}
+
+// CheckTransactionCombined is like CheckTransactionVerdict, but checks
+// the transaction with each of the given decision plugins and combines
+// their decisions with the policy of comb. The transaction is
+// challenged if any decision plugin challenges it and it is not
+// blocked, and tagged with the tags of all of them. It only fails if
+// every decision plugin fails.
+func CheckTransactionCombined(transactionID string, decisionPlugins []string, comb Combination, wafParams map[string]string) (CombinedVerdict, error) {
+	return coreOf(transactionID).CheckTransactionCombined(transactionID, decisionPlugins, comb, wafParams)
+}
+
+// CheckTransactionCombined is like the CheckTransactionCombined function
+func (c *Core) CheckTransactionCombined(transactionID string, decisionPlugins []string, comb Combination, wafParams map[string]string) (CombinedVerdict, error) {
+	if len(decisionPlugins) == 0 {
+		return CombinedVerdict{}, fmt.Errorf("no decision plugins given")
+	}
+	switch comb.Policy {
+	case CombineAnyBlock, CombineAllBlock, CombineWeighted:
+	default:
+		return CombinedVerdict{}, fmt.Errorf("invalid combination policy %q", comb.Policy)
+	}
+	if err := c.checkOpen("CheckTransactionCombined", transactionID); err != nil {
+		return CombinedVerdict{}, err
+	}
+	c.tprintf(lg.DEBUG, transactionID, "core | checking transaction with %v", decisionPlugins)
+
+	analyzed, missing, err := c.waitModels(transactionID, 0)
+	if err != nil {
+		return CombinedVerdict{}, err
+	}
+	if wafOnly := c.config().WAFOnlyDecision; !analyzed && wafOnly != "" {
+		c.tprintf(lg.DEBUG, transactionID, "core | no model analyzed the transaction, checking it with %s", wafOnly)
+		decisionPlugins = []string{wafOnly}
+	}
+
+	defer func() { c.recordPhaseLatency(transactionID, time.Now()) }()
+
+	res := CombinedVerdict{Decisions: make(map[string]pm.DecisionResult), Errors: make(map[string]error)}
+	plugins := c.pluginsOf(transactionID).manager
+	tc := c.transactionContext(transactionID)
+	for _, id := range decisionPlugins {
+		decision, err := plugins.CheckResultWithContext(c.scope(transactionID), id, wafParams, missing, tc)
+		if err != nil {
+			c.tprintf(lg.WARN, transactionID, "core | decision plugin %s failed: %v", id, err)
+			res.Errors[id] = err
+			continue
+		}
+		res.Decisions[id] = decision
+	}
+	var decision pm.DecisionResult
+	if len(res.Decisions) == 0 {
+		err = fmt.Errorf("every decision plugin failed")
+	} else {
+		decision = combineDecisions(decisionPlugins, res.Decisions, comb)
+	}
+	res.Verdict, err = c.finishCheck(transactionID, strings.Join(decisionPlugins, "+"), decision, err, missing)
+	return res, err
+}
+
+// combineDecisions combines the decisions of the decision plugins, in
+// the given order, by the policy of comb
+func combineDecisions(ids []string, decisions map[string]pm.DecisionResult, comb Combination) pm.DecisionResult {
+	var combined pm.DecisionResult
+	blocking, total := 0.0, 0.0
+	all := true
+	for _, id := range ids {
+		decision, ok := decisions[id]
+		if !ok {
+			continue
+		}
+		w, ok := comb.Weights[id]
+		if !ok {
+			w = 1
+		}
+		total += w
+		if decision.Block {
+			blocking += w
+			combined.Block = true
+		} else {
+			all = false
+		}
+		combined.Challenge = combined.Challenge || decision.Challenge
+		for _, tag := range decision.Tags {
+			if !containsString(combined.Tags, tag) {
+				combined.Tags = append(combined.Tags, tag)
+			}
+		}
+	}
+	switch comb.Policy {
+	case CombineAllBlock:
+		combined.Block = all
+	case CombineWeighted:
+		threshold := comb.Threshold
+		if threshold == 0 {
+			threshold = 0.5
+		}
+		combined.Block = total > 0 && blocking/total >= threshold
+	}
+	return combined
+}
@@ -0,0 +1,96 @@
+package wace
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestCombineDecisions(t *testing.T) {
+	ids := []string{"a", "b", "c"}
+	decisions := map[string]pm.DecisionResult{
+		"a": {Block: true, Tags: []string{"x"}},
+		"b": {Challenge: true, Tags: []string{"x", "y"}},
+		"c": {},
+	}
+	for _, tc := range []struct {
+		comb Combination
+		want bool
+	}{
+		{Combination{Policy: CombineAnyBlock}, true},
+		{Combination{Policy: CombineAllBlock}, false},
+		{Combination{Policy: CombineWeighted}, false},
+		{Combination{Policy: CombineWeighted, Weights: map[string]float64{"a": 2}}, true},
+		{Combination{Policy: CombineWeighted, Threshold: 0.3}, true},
+	} {
+		combined := combineDecisions(ids, decisions, tc.comb)
+		if combined.Block != tc.want {
+			t.Errorf("%+v blocked: %t", tc.comb, combined.Block)
+		}
+		if !combined.Challenge || len(combined.Tags) != 2 || combined.Tags[0] != "x" || combined.Tags[1] != "y" {
+			t.Errorf("%+v combined to %+v", tc.comb, combined)
+		}
+	}
+}
+
+func TestCheckTransactionCombined(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: protocol
+    kind: builtin
+    plugintype: RequestHeaders
+decisionplugins:
+  - id: strict
+    kind: builtin
+    builtin: waf
+    params:
+      threshold: "3"
+  - id: lenient
+    kind: builtin
+    builtin: waf
+    params:
+      threshold: "10"
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("combined", conf, testMeter)
+	wafParams := map[string]string{"inbound_detection": "5"}
+
+	for policy, want := range map[string]bool{CombineAnyBlock: true, CombineAllBlock: false} {
+		id := generateRandomID()
+		engine.InitTransaction(id)
+		Analyze("RequestHeaders", id, "GET / HTTP/1.1\nHost: example.com\n", []string{"protocol"})
+		verdict, err := CheckTransactionCombined(id, []string{"strict", "lenient", "missing"}, Combination{Policy: policy}, wafParams)
+		if err != nil {
+			t.Fatalf("%s CheckTransactionCombined returned error: %v", policy, err)
+		}
+		if verdict.Block != want {
+			t.Errorf("%s blocked: %t", policy, verdict.Block)
+		}
+		if !verdict.Decisions["strict"].Block || verdict.Decisions["lenient"].Block || verdict.Errors["missing"] == nil {
+			t.Errorf("%s per-plugin results are %v, %v", policy, verdict.Decisions, verdict.Errors)
+		}
+		CloseTransaction(id)
+	}
+
+	id := generateRandomID()
+	engine.InitTransaction(id)
+	defer CloseTransaction(id)
+	if _, err := CheckTransactionCombined(id, []string{"missing"}, Combination{Policy: CombineAnyBlock}, wafParams); err == nil {
+		t.Errorf("check where every decision plugin fails does not return error")
+	}
+	if _, err := CheckTransactionCombined(id, []string{"strict"}, Combination{Policy: "majority"}, wafParams); err == nil {
+		t.Errorf("invalid combination policy does not return error")
+	}
+}
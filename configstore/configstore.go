@@ -6,9 +6,25 @@ memory
 package configstore
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/tiroa-tilsor/wacelib/audit"
+	"github.com/tiroa-tilsor/wacelib/export"
+	"github.com/tiroa-tilsor/wacelib/webhook"
+	"gopkg.in/yaml.v3"
 
 	lg "github.com/tilsor/ModSecIntl_logging/logging"
 )
@@ -25,6 +41,10 @@ const (
 	ResponseBody
 	AllResponse
 	Everything
+	// RequestTrailers and ResponseTrailers are the trailers that follow
+	// the body, such as the grpc-status of a gRPC response
+	RequestTrailers
+	ResponseTrailers
 )
 
 // String returns the string representation of a model plugin type
@@ -42,6 +62,10 @@ func (t ModelPluginType) String() string {
 		return "ResponseBody"
 	case AllResponse:
 		return "AllResponse"
+	case RequestTrailers:
+		return "RequestTrailers"
+	case ResponseTrailers:
+		return "ResponseTrailers"
 	default:
 		return "Everything"
 	}
@@ -64,185 +88,2672 @@ func StringToPluginType(textType string) (ModelPluginType, error) {
 		return AllResponse, nil
 	case "Everything":
 		return Everything, nil
+	case "RequestTrailers":
+		return RequestTrailers, nil
+	case "ResponseTrailers":
+		return ResponseTrailers, nil
 	}
 	return -1, fmt.Errorf("invalid plugin type %s", textType)
 }
 
 // ModelPluginConfig stores the configuration of a model plugin
 type modelPluginConfig struct {
-	ID         string
-	Path       string
-	Weight     float64
-	Threshold  float64
-	Params     map[string]string
-	PluginType ModelPluginType
-	Mode 	   string
-	Remote	   bool
+	ID        string
+	Path      string
+	Weight    float64
+	Threshold float64
+	Params    map[string]string
+	// SecretParams maps the params read from secrets to their
+	// references
+	SecretParams  map[string]string
+	PluginType    ModelPluginType
+	Mode          string
+	Remote        bool
+	ExposeData    []string
+	WAFConditions []WAFCondition
+	// Artifacts maps param names to the URL of a file fetched at
+	// startup, whose local path is given to the plugin in the param
+	Artifacts map[string]string
+	// ArtifactChecksums maps param names of Artifacts to the SHA-256,
+	// in hex, their file must have
+	ArtifactChecksums map[string]string
+	Kind              PluginKind
+	// Builtin is the name of the built-in model of a builtin plugin,
+	// which defaults to its ID
+	Builtin string
+	// DependsOn lists the sync model plugins whose results and shared
+	// features this model consumes. It is only called once they have
+	// succeeded.
+	DependsOn []string
+	// Manifest is the path of the manifest file of the model, whose
+	// Version, unless configured, and TrainedAt are read at load
+	Manifest  string
+	Version   string
+	TrainedAt time.Time
+	// Model is the logical name of the model, which defaults to its ID.
+	// The versions of a model share its name, and Traffic is the
+	// relative share of the transactions analyzed by each of them.
+	Model   string
+	Traffic float64
+	// Timeout bounds the time a sync model can take to answer, zero
+	// waits forever. With retries, it bounds every attempt.
+	Timeout time.Duration
+	// Retries is the number of times a call of the model that fails,
+	// or a remote model that does not answer within its timeout, is
+	// retried
+	Retries int
+	// RetryBackoff is the delay before the first retry, doubled before
+	// every next one
+	RetryBackoff time.Duration
+	// Address is the host:port of the model service of a grpc plugin
+	Address string
+	// URL is the endpoint of an http plugin, and Headers are added to
+	// its requests
+	URL     string
+	Headers map[string]string
+	// SecretHeaders maps the headers read from secrets to their
+	// references
+	SecretHeaders map[string]string
+	// Services are the external services the plugin depends on, from
+	// the config and the manifest, checked when it is loaded: URLs,
+	// host:port addresses or host names
+	Services []string
+	// LogFile is the file the log lines of the plugin are also written
+	// to, none if empty
+	LogFile string
+	// Cost is the estimated compute cost of an analysis by the model,
+	// in the units of the tenant budgets
+	Cost float64
+	// RequestReply makes a remote sync model be called with a NATS
+	// request, whose reply carries its results, instead of through its
+	// results subject
+	RequestReply bool
+	// MaxSteps bounds the Starlark steps of each call of a script
+	// plugin, a default limit if zero
+	MaxSteps uint64
+	// ShadowOf is the model plugin this one is dark launched along: it
+	// is called whenever that model is, and its results are compared to
+	// those of the model without affecting the verdicts
+	ShadowOf string
+	// Requires lists the model plugins initialized before this one,
+	// which is not loaded if any of them is not
+	Requires []string
+	// Affinity is the worker pool the calls of the model run in, such
+	// as CPUBound, and empty to run them outside of any pool
+	Affinity string
 }
 
-// DecisionPluginConfig stores the configuration of a decision plugin
-type decisionPluginConfig struct {
-	ID              string
-	Path            string
-	WAFweight       float64
-	DecisionBalance float64
-	Params          map[string]string
+// PluginKind identifies how a plugin is provided to WACE
+type PluginKind string
+
+const (
+	// SharedObjectPlugin plugins are loaded from a Go plugin file
+	SharedObjectPlugin PluginKind = "plugin"
+	// BuiltinPlugin plugins are provided by WACE itself
+	BuiltinPlugin PluginKind = "builtin"
+	// GRPCPlugin model plugins run in a process of their own, reached
+	// at their address through the grpcmodel service
+	GRPCPlugin PluginKind = "grpc"
+	// HTTPPlugin model plugins are REST services receiving the model
+	// input as JSON and answering with the model results
+	HTTPPlugin PluginKind = "http"
+	// SubprocessPlugin model plugins are executables run by WACE as
+	// supervised subprocesses, serving the grpcmodel service over
+	// hashicorp/go-plugin
+	SubprocessPlugin PluginKind = "subprocess"
+	// WorkerPlugin model plugins are remote workers subscribed to the
+	// model subject of the NATS server, speaking the remoteworker
+	// protocol
+	WorkerPlugin PluginKind = "worker"
+	// ONNXPlugin model plugins are ONNX model files run by WACE itself
+	ONNXPlugin PluginKind = "onnx"
+	// ScriptPlugin model and decision plugins are Starlark scripts run
+	// by WACE itself, within limits of steps and time per call
+	ScriptPlugin PluginKind = "script"
+)
+
+// Fallback verdicts of a decision plugin that times out
+const (
+	FallbackAllow = "allow"
+	FallbackBlock = "block"
+)
+
+// Actions that a category rule can take when its threshold is reached
+const (
+	ActionBlock     = "block"
+	ActionTag       = "tag"
+	ActionChallenge = "challenge"
+)
+
+// WAFCondition is a range that a numeric WAF parameter (e.g. the CRS
+// inbound anomaly score) must fall in for the models to be run. Min and
+// Max are inclusive, and an unset bound is open.
+type WAFCondition struct {
+	Param string
+	Min   *float64
+	Max   *float64
 }
 
-// ConfigStore stores all wacecore configuration from the config file.
-type ConfigStore struct {
-	ModelPlugins    map[string]modelPluginConfig
-	DecisionPlugins map[string]decisionPluginConfig
-	LogPath         string
-	LogLevel        lg.LogLevel
-	NatsURL		 	string
-	ApplicationId	string
+// Matches returns true if the WAF parameter is present, numeric and
+// within the range of the condition
+func (c WAFCondition) Matches(wafParams map[string]string) bool {
+	value, ok := wafParams[c.Param]
+	if !ok {
+		return false
+	}
+	score, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return false
+	}
+	return (c.Min == nil || score >= *c.Min) && (c.Max == nil || score <= *c.Max)
 }
 
-var config *ConfigStore
+// MatchesAll returns true if every condition matches the WAF parameters
+func MatchesAll(conditions []WAFCondition, wafParams map[string]string) bool {
+	for _, c := range conditions {
+		if !c.Matches(wafParams) {
+			return false
+		}
+	}
+	return true
+}
 
-// Get returns or creates the unique instance of configstore
-func Get() *ConfigStore {
-	if config == nil {
-		config = new(ConfigStore)
+// checkWAFConditions verifies that the conditions name a parameter and
+// have a valid range
+func checkWAFConditions(owner string, conditions []WAFCondition) error {
+	for _, c := range conditions {
+		if c.Param == "" {
+			return fmt.Errorf("%s waf condition without param", owner)
+		}
+		if c.Min != nil && c.Max != nil && *c.Min > *c.Max {
+			return fmt.Errorf("%s waf condition on %s has min %v greater than max %v", owner, c.Param, *c.Min, *c.Max)
+		}
 	}
-	return config
+	return nil
 }
 
-type configFileModelPlugin struct {
-	ID         string
-	Path       string
-	Weight     float64
-	Threshold  float64
-	Params     map[string]string
-	PluginType string `yaml:"plugintype"`
-	Mode 	   string
-	Remote	   bool
+// ReanalysisConfig configures the background re-analysis of a sample
+// of the allowed transactions with heavyweight models
+type ReanalysisConfig struct {
+	// SampleRate is the fraction of allowed transactions kept for
+	// re-analysis. Zero disables the re-analysis.
+	SampleRate  float64
+	Interval    time.Duration
+	TTL         time.Duration
+	Models      []string
+	Threshold   float64
+	NatsSubject string
+	Webhook     string
+	// Redact lists the header and parameter names whose values are
+	// redacted from the transactions before they are kept
+	Redact []string
 }
 
-type configFileDecisionPlugin struct {
-	ID              string
-	Path            string
-	wafweight       float64
-	decisionbalance float64
-	Params          map[string]string
+type configFileReanalysis struct {
+	Samplerate  float64
+	Interval    string
+	TTL         string
+	Models      []string
+	Threshold   float64
+	Natssubject string
+	Webhook     string
+	Redact      []string
 }
 
-type ConfigFileData struct {
-	Logpath         string
-	Loglevel        string
-	Modelplugins    []configFileModelPlugin
-	Decisionplugins []configFileDecisionPlugin
-	NatsURL			string
+// setReanalysis checks and sets the re-analysis configuration
+func (cs *ConfigStore) setReanalysis(inConf configFileReanalysis) error {
+	if inConf.Samplerate < 0 || inConf.Samplerate > 1 {
+		return fmt.Errorf("reanalysis sample rate %v is not between 0 and 1", inConf.Samplerate)
+	}
+	re := ReanalysisConfig{
+		SampleRate:  inConf.Samplerate,
+		Interval:    5 * time.Minute,
+		TTL:         24 * time.Hour,
+		Models:      inConf.Models,
+		Threshold:   inConf.Threshold,
+		NatsSubject: inConf.Natssubject,
+		Webhook:     inConf.Webhook,
+		Redact:      inConf.Redact,
+	}
+	if len(re.Redact) == 0 {
+		re.Redact = defaultDebugRedact
+	}
+	var err error
+	if inConf.Interval != "" {
+		if re.Interval, err = time.ParseDuration(inConf.Interval); err != nil || re.Interval <= 0 {
+			return fmt.Errorf("invalid reanalysis interval %s", inConf.Interval)
+		}
+	}
+	if inConf.TTL != "" {
+		if re.TTL, err = time.ParseDuration(inConf.TTL); err != nil {
+			return fmt.Errorf("invalid reanalysis ttl %s: %v", inConf.TTL, err)
+		}
+	}
+	if re.SampleRate > 0 {
+		if len(re.Models) == 0 {
+			return fmt.Errorf("reanalysis enabled without models")
+		}
+		for _, id := range re.Models {
+			if _, ok := cs.ModelPlugins[id]; !ok {
+				return fmt.Errorf("reanalysis model plugin %s not found", id)
+			}
+		}
+		if re.Threshold == 0 {
+			re.Threshold = 0.5
+		}
+	}
+	cs.Reanalysis = re
+	return nil
 }
 
-// IsAsync returns true if the model plugin is async
-func (c *ConfigStore) IsAsync(modelID string) bool {
-	return c.ModelPlugins[modelID].Mode == "async"
+// CampaignsConfig configures the background clustering of the
+// high-score transactions into attack campaigns
+type CampaignsConfig struct {
+	// Interval is the time between the clusterings. Zero disables the
+	// campaign detection.
+	Interval time.Duration
+	// Window is the time the transactions are kept to be clustered
+	Window time.Duration
+	// MinScore is the highest model or category score from which a
+	// transaction is clustered
+	MinScore float64
+	// Similarity is the similarity from which two transactions belong
+	// to the same campaign
+	Similarity float64
+	// MinSize is the number of transactions of the smallest campaign
+	MinSize int
+	// Webhook receives the campaigns when they are detected
+	Webhook string
 }
 
-// CheckLogging verifies if the log path is valid
-func checkLogging(inConf ConfigFileData) error {
-	// check logpath
-	if inConf.Logpath == "" {
-		return fmt.Errorf("log path empty")
+type configFileCampaigns struct {
+	Interval   string
+	Window     string
+	Minscore   float64
+	Similarity float64
+	Minsize    int
+	Webhook    string
+}
+
+// setCampaigns checks and sets the campaign detection configuration
+func (cs *ConfigStore) setCampaigns(inConf configFileCampaigns) error {
+	ca := CampaignsConfig{
+		Window:     time.Hour,
+		MinScore:   0.8,
+		Similarity: 0.6,
+		MinSize:    5,
+		Webhook:    inConf.Webhook,
 	}
-	_, err := os.Stat(inConf.Logpath)
-	if err != nil { // check if log file does not exists already
-		// Attempt to create dummy file
-		var d []byte
-		err = ioutil.WriteFile(inConf.Logpath, d, 0644)
-		if err == nil {
-			err = os.Remove(inConf.Logpath) // delete it
+	var err error
+	if inConf.Interval != "" {
+		if ca.Interval, err = time.ParseDuration(inConf.Interval); err != nil || ca.Interval < 0 {
+			return fmt.Errorf("invalid campaigns interval %s", inConf.Interval)
 		}
 	}
-	return err
+	if inConf.Window != "" {
+		if ca.Window, err = time.ParseDuration(inConf.Window); err != nil || ca.Window <= 0 {
+			return fmt.Errorf("invalid campaigns window %s", inConf.Window)
+		}
+	}
+	if inConf.Minscore != 0 {
+		if inConf.Minscore < 0 || inConf.Minscore > 1 {
+			return fmt.Errorf("campaigns min score %v is not between 0 and 1", inConf.Minscore)
+		}
+		ca.MinScore = inConf.Minscore
+	}
+	if inConf.Similarity != 0 {
+		if inConf.Similarity < 0 || inConf.Similarity > 1 {
+			return fmt.Errorf("campaigns similarity %v is not between 0 and 1", inConf.Similarity)
+		}
+		ca.Similarity = inConf.Similarity
+	}
+	if inConf.Minsize != 0 {
+		if inConf.Minsize < 2 {
+			return fmt.Errorf("campaigns min size %d is less than 2", inConf.Minsize)
+		}
+		ca.MinSize = inConf.Minsize
+	}
+	cs.Campaigns = ca
+	return nil
 }
 
-// CheckConfig verifies if the configuration read from the config file
-// is correct.
-func checkConfig(inConf ConfigFileData) error {
-	err := checkLogging(inConf)
-	if err != nil {
-		return fmt.Errorf("invalid log path %s: %v", inConf.Logpath, err)
+// Affinities of the model plugins, whose calls run in the worker pool
+// of their affinity, so that the models keeping the CPU busy do not
+// starve those awaiting remote services
+const (
+	// CPUBound models run in process, such as the shared object, ONNX
+	// or script models
+	CPUBound = "cpu-bound"
+	// IOBound models await remote services, such as the grpc and http
+	// models
+	IOBound = "io-bound"
+	// GPURemote models await accelerators of limited capacity
+	GPURemote = "gpu-remote"
+)
+
+// defaultWorkerPools returns the default size of the worker pool of
+// each affinity
+func defaultWorkerPools() map[string]int {
+	return map[string]int{
+		CPUBound:  runtime.GOMAXPROCS(0),
+		IOBound:   256,
+		GPURemote: 16,
 	}
+}
 
-	// check modelplugins
-	for _, modelP := range inConf.Modelplugins {
+// validAffinity returns true if affinity is a model affinity
+func validAffinity(affinity string) bool {
+	return affinity == CPUBound || affinity == IOBound || affinity == GPURemote
+}
 
-		if modelP.Path != "" {
-			if _, err := os.Stat(modelP.Path); err != nil {
-				return fmt.Errorf("%s plugin path %s: %v", modelP.ID, modelP.Path, err)
-			}
-		} else {
-			return fmt.Errorf("%s plugin path is empty, please provide a valid path", modelP.ID)
+// setWorkerPools checks and sets the sizes of the worker pools
+func (cs *ConfigStore) setWorkerPools(sizes map[string]int) error {
+	pools := defaultWorkerPools()
+	for affinity, size := range sizes {
+		if !validAffinity(affinity) {
+			return fmt.Errorf("invalid worker pool %s, use %s, %s or %s", affinity, CPUBound, IOBound, GPURemote)
 		}
-		if modelP.PluginType == "" {
-			return fmt.Errorf("%s plugin type cannot be empty, please provide a valid type", modelP.ID)
+		if size < 1 {
+			return fmt.Errorf("worker pool %s size %d is less than 1", affinity, size)
 		}
-		// fmt.Printf("modelP.Type: %s\n", modelP.Type)
+		pools[affinity] = size
 	}
-	// check decisionplugins
-	for _, decisionP := range inConf.Decisionplugins {
+	cs.WorkerPools = pools
+	return nil
+}
 
-		if decisionP.Path != "" {
-			if _, err := os.Stat(decisionP.Path); err != nil {
-				return fmt.Errorf("%s plugin path %s cannot be opened: %v", decisionP.ID, decisionP.Path, err)
+// Export sinks
+const (
+	ExportClickHouse = "clickhouse"
+	ExportJSONL      = "jsonl"
+	ExportParquet    = "parquet"
+)
+
+// ExportConfig configures the export of the transaction outcomes to an
+// analytics store
+type ExportConfig struct {
+	// Sink is ExportClickHouse, ExportJSONL or ExportParquet. Empty
+	// disables the export.
+	Sink string
+	// URL and Table are the ClickHouse HTTP interface and table
+	URL   string
+	Table string
+	// Dir and Prefix name the rotating files, which are rotated after
+	// MaxSize bytes or Rotate time
+	Dir        string
+	Prefix     string
+	MaxSize    int64
+	Rotate     time.Duration
+	SampleRate float64
+	// Fields are the exported fields, all of them if empty
+	Fields        []string
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+type configFileExport struct {
+	Sink          string
+	URL           string
+	Table         string
+	Dir           string
+	Prefix        string
+	Maxsize       int64
+	Rotate        string
+	Samplerate    *float64
+	Fields        []string
+	Batchsize     int
+	Flushinterval string
+}
+
+// setExport checks and sets the export configuration
+func (cs *ConfigStore) setExport(inConf configFileExport) error {
+	ex := ExportConfig{
+		Sink:          inConf.Sink,
+		URL:           inConf.URL,
+		Table:         inConf.Table,
+		Dir:           inConf.Dir,
+		Prefix:        inConf.Prefix,
+		MaxSize:       inConf.Maxsize,
+		Rotate:        time.Hour,
+		SampleRate:    1,
+		Fields:        inConf.Fields,
+		BatchSize:     inConf.Batchsize,
+		FlushInterval: 10 * time.Second,
+	}
+	switch ex.Sink {
+	case "":
+		cs.Export = ex
+		return nil
+	case ExportClickHouse:
+		if !strings.HasPrefix(ex.URL, "http://") && !strings.HasPrefix(ex.URL, "https://") {
+			return fmt.Errorf("invalid export clickhouse url %q", ex.URL)
+		}
+		if ex.Table == "" {
+			ex.Table = "wace_transactions"
+		}
+	case ExportJSONL, ExportParquet:
+		if ex.Dir == "" {
+			return fmt.Errorf("export to files without dir")
+		}
+		if ex.Prefix == "" {
+			ex.Prefix = "wace"
+		}
+	default:
+		return fmt.Errorf("unknown export sink %s", ex.Sink)
+	}
+	if inConf.Samplerate != nil {
+		ex.SampleRate = *inConf.Samplerate
+		if ex.SampleRate < 0 || ex.SampleRate > 1 {
+			return fmt.Errorf("export sample rate %v is not between 0 and 1", ex.SampleRate)
+		}
+	}
+	for _, field := range ex.Fields {
+		if !export.IsField(field) {
+			return fmt.Errorf("unknown export field %s", field)
+		}
+	}
+	if ex.BatchSize < 0 || ex.MaxSize < 0 {
+		return fmt.Errorf("export batch size and max size must not be negative")
+	}
+	var err error
+	if inConf.Rotate != "" {
+		if ex.Rotate, err = time.ParseDuration(inConf.Rotate); err != nil || ex.Rotate < 0 {
+			return fmt.Errorf("invalid export rotate %s", inConf.Rotate)
+		}
+	}
+	if inConf.Flushinterval != "" {
+		if ex.FlushInterval, err = time.ParseDuration(inConf.Flushinterval); err != nil || ex.FlushInterval <= 0 {
+			return fmt.Errorf("invalid export flush interval %s", inConf.Flushinterval)
+		}
+	}
+	cs.Export = ex
+	return nil
+}
+
+// AuditConfig configures the blocked-transaction events sent to a SIEM
+type AuditConfig struct {
+	// Format is audit.FormatCEF or audit.FormatLEEF. Empty disables the
+	// events.
+	Format string
+	// Network is audit.NetworkUDP, audit.NetworkTCP or audit.NetworkTLS,
+	// and Address the host:port of the syslog server
+	Network string
+	Address string
+	// CAFile is the PEM file of the certificates authenticating the
+	// server over TLS, the system ones if empty
+	CAFile string
+	// Facility is the syslog facility of the events
+	Facility int
+	// Severities maps attack categories to the severity, from 1 to 10,
+	// of the transactions blocked with full confidence in them. The
+	// severity of an event is the highest one of its mapped categories,
+	// scaled by their scores, or else derived from its highest score.
+	Severities map[string]int
+	// MinSeverity drops the events of lower severity
+	MinSeverity int
+}
+
+type configFileAudit struct {
+	Format      string
+	Network     string
+	Address     string
+	Cafile      string
+	Facility    *int
+	Severities  map[string]int
+	Minseverity int
+}
+
+// setAudit checks and sets the audit configuration. The network
+// defaults to UDP and the facility to 13 (log audit).
+func (cs *ConfigStore) setAudit(inConf configFileAudit) error {
+	au := AuditConfig{
+		Format:      inConf.Format,
+		Network:     inConf.Network,
+		Address:     inConf.Address,
+		CAFile:      inConf.Cafile,
+		Facility:    13,
+		Severities:  inConf.Severities,
+		MinSeverity: inConf.Minseverity,
+	}
+	switch au.Format {
+	case "":
+		cs.Audit = au
+		return nil
+	case audit.FormatCEF, audit.FormatLEEF:
+	default:
+		return fmt.Errorf("unknown audit format %s", au.Format)
+	}
+	switch au.Network {
+	case "":
+		au.Network = audit.NetworkUDP
+	case audit.NetworkUDP, audit.NetworkTCP, audit.NetworkTLS:
+	default:
+		return fmt.Errorf("unknown audit network %s", au.Network)
+	}
+	if au.Address == "" {
+		return fmt.Errorf("audit events without address")
+	}
+	if au.CAFile != "" {
+		if au.Network != audit.NetworkTLS {
+			return fmt.Errorf("audit cafile is only used over tls")
+		}
+		if _, err := os.Stat(au.CAFile); err != nil {
+			return fmt.Errorf("audit cafile: %v", err)
+		}
+	}
+	if inConf.Facility != nil {
+		au.Facility = *inConf.Facility
+		if au.Facility < 0 || au.Facility > 23 {
+			return fmt.Errorf("audit facility %d is not between 0 and 23", au.Facility)
+		}
+	}
+	for category, severity := range au.Severities {
+		if severity < 1 || severity > 10 {
+			return fmt.Errorf("audit severity %d of category %s is not between 1 and 10", severity, category)
+		}
+	}
+	if au.MinSeverity < 0 || au.MinSeverity > 10 {
+		return fmt.Errorf("audit minimum severity %d is not between 0 and 10", au.MinSeverity)
+	}
+	cs.Audit = au
+	return nil
+}
+
+// WebhookConfig configures a webhook receiving the analysis of the
+// transactions whose verdicts have at least MinSeverity
+type WebhookConfig struct {
+	// Name identifies the webhook in the logs, and defaults to its URL
+	Name        string
+	URL         string
+	MinSeverity webhook.Severity
+	// Template is the text/template of the request body, which is the
+	// analysis bundle as JSON if empty
+	Template    string
+	ContentType string
+	Headers     map[string]string
+	// SecretHeaders maps the headers read from secrets to their
+	// references
+	SecretHeaders map[string]string
+	// Timeout bounds every request to the webhook
+	Timeout time.Duration
+}
+
+type configFileWebhook struct {
+	Name        string
+	URL         string
+	Minseverity string
+	Template    string
+	Contenttype string
+	Headers     map[string]string
+	Timeout     string
+}
+
+// setWebhooks checks and sets the webhooks configuration. The minimum
+// severity defaults to high.
+func (cs *ConfigStore) setWebhooks(inConf []configFileWebhook) error {
+	var hooks []WebhookConfig
+	for _, in := range inConf {
+		hook := WebhookConfig{
+			Name:        in.Name,
+			URL:         in.URL,
+			MinSeverity: webhook.SeverityHigh,
+			Template:    in.Template,
+			ContentType: in.Contenttype,
+			Timeout:     10 * time.Second,
+		}
+		if !strings.HasPrefix(hook.URL, "http://") && !strings.HasPrefix(hook.URL, "https://") {
+			return fmt.Errorf("invalid webhook url %q", hook.URL)
+		}
+		if hook.Name == "" {
+			hook.Name = hook.URL
+		}
+		var err error
+		if hook.Headers, hook.SecretHeaders, err = resolveSecrets("header", in.Headers); err != nil {
+			return fmt.Errorf("webhook %s %v", hook.Name, err)
+		}
+		if in.Minseverity != "" {
+			if hook.MinSeverity, err = webhook.ParseSeverity(in.Minseverity); err != nil {
+				return fmt.Errorf("webhook %s: %v", hook.Name, err)
+			}
+		}
+		if hook.Template != "" {
+			if _, err := webhook.ParseTemplate(hook.Name, hook.Template); err != nil {
+				return fmt.Errorf("webhook %s template: %v", hook.Name, err)
+			}
+		}
+		if in.Timeout != "" {
+			if hook.Timeout, err = time.ParseDuration(in.Timeout); err != nil || hook.Timeout <= 0 {
+				return fmt.Errorf("invalid webhook %s timeout %s", hook.Name, in.Timeout)
 			}
-		} else {
-			return fmt.Errorf("%s plugin path is empty, please provide a valid path", decisionP.ID)
 		}
+		hooks = append(hooks, hook)
 	}
+	cs.Webhooks = hooks
+	return nil
+}
+
+// GeoIPConfig configures the geolocation of the client addresses
+type GeoIPConfig struct {
+	// Database is the path of a MaxMind DB file. Empty disables the
+	// geolocation.
+	Database string
+	// Reload is how often the file is checked for changes, zero never
+	Reload time.Duration
+}
 
+type configFileGeoIP struct {
+	Database string
+	Reload   *string
+}
+
+// setGeoIP checks and sets the geolocation configuration
+func (cs *ConfigStore) setGeoIP(inConf configFileGeoIP) error {
+	geo := GeoIPConfig{Database: inConf.Database, Reload: time.Hour}
+	if geo.Database != "" {
+		if _, err := os.Stat(geo.Database); err != nil {
+			return fmt.Errorf("geoip database %s: %v", geo.Database, err)
+		}
+	}
+	if inConf.Reload != nil {
+		var err error
+		if geo.Reload, err = time.ParseDuration(*inConf.Reload); err != nil || geo.Reload < 0 {
+			return fmt.Errorf("invalid geoip reload %s", *inConf.Reload)
+		}
+	}
+	cs.GeoIP = geo
 	return nil
 }
 
-// SetConfig sets the configuration of WACE from the configuration file
-func (cs *ConfigStore) SetConfig(inConf ConfigFileData) error {
-	err := checkConfig(inConf)
-	if err != nil {
-		return err
+// StalenessConfig discounts the weights of the models trained too long
+// ago, according to their manifest
+type StalenessConfig struct {
+	// MaxAge is the age past which a model is stale. Zero disables the
+	// discount.
+	MaxAge time.Duration
+	// Discount multiplies the weight of the stale models
+	Discount float64
+}
+
+type configFileStaleness struct {
+	Maxage   string
+	Discount *float64
+}
+
+// setStaleness checks and sets the staleness configuration
+func (cs *ConfigStore) setStaleness(inConf configFileStaleness) error {
+	st := StalenessConfig{Discount: 0.5}
+	if inConf.Maxage != "" {
+		var err error
+		if st.MaxAge, err = time.ParseDuration(inConf.Maxage); err != nil || st.MaxAge < 0 {
+			return fmt.Errorf("invalid staleness max age %s", inConf.Maxage)
+		}
+	}
+	if inConf.Discount != nil {
+		st.Discount = *inConf.Discount
+		if st.Discount < 0 || st.Discount > 1 {
+			return fmt.Errorf("staleness discount %v is not between 0 and 1", st.Discount)
+		}
 	}
+	cs.Staleness = st
+	return nil
+}
 
-	cs.LogPath = inConf.Logpath
-	cs.LogLevel, err = lg.StringToLogLevel(inConf.Loglevel)
+// modelManifest is the manifest file of a model, in YAML or JSON
+type modelManifest struct {
+	Version string
+	// Trained is when the model was trained, as an RFC 3339 time or a
+	// date
+	Trained string
+	// Services are the external services the model depends on
+	Services []string
+}
+
+// readManifest reads the version, the training time and the services
+// of the manifest file at path
+func readManifest(path string) (string, time.Time, []string, error) {
+	content, err := os.ReadFile(path)
 	if err != nil {
-		return err
+		return "", time.Time{}, nil, err
+	}
+	var manifest modelManifest
+	if err := yaml.Unmarshal(content, &manifest); err != nil {
+		return "", time.Time{}, nil, err
 	}
+	if manifest.Trained == "" {
+		return manifest.Version, time.Time{}, manifest.Services, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if trained, err := time.Parse(layout, manifest.Trained); err == nil {
+			return manifest.Version, trained, manifest.Services, nil
+		}
+	}
+	return "", time.Time{}, nil, fmt.Errorf("invalid trained time %s", manifest.Trained)
+}
 
-	cs.ModelPlugins = make(map[string]modelPluginConfig)
-	for _, modelP := range inConf.Modelplugins {
-		var modelConfig modelPluginConfig
-		modelConfig.ID = modelP.ID
-		modelConfig.Path = modelP.Path
-		modelConfig.Weight = modelP.Weight
-		modelConfig.Threshold = modelP.Threshold
-		modelConfig.Params = modelP.Params
-		modelConfig.PluginType, err = StringToPluginType(modelP.PluginType)
-		modelConfig.Mode = modelP.Mode
-		modelConfig.Remote = modelP.Remote
-		if err != nil {
-			return err
+// checkServices returns an error if a service a plugin depends on is
+// not a URL with a host, a host:port address or a host name
+func checkServices(id string, services []string) error {
+	for _, service := range services {
+		if strings.Contains(service, "://") {
+			u, err := url.Parse(service)
+			if err != nil || u.Hostname() == "" {
+				return fmt.Errorf("%s plugin service %s is not a valid URL", id, service)
+			}
+			continue
+		}
+		if strings.Contains(service, ":") {
+			if _, _, err := net.SplitHostPort(service); err != nil {
+				return fmt.Errorf("%s plugin service %s is not a valid address: %v", id, service, err)
+			}
+			continue
+		}
+		if service == "" || strings.ContainsAny(service, "/ ") {
+			return fmt.Errorf("%s plugin service %q is not a valid host name", id, service)
 		}
-		cs.ModelPlugins[modelConfig.ID] = modelConfig
 	}
+	return nil
+}
 
-	cs.DecisionPlugins = make(map[string]decisionPluginConfig)
-	for _, decisionP := range inConf.Decisionplugins {
-		var decisionConfig decisionPluginConfig
-		decisionConfig.ID = decisionP.ID
-		decisionConfig.Path = decisionP.Path
-		decisionConfig.WAFweight = decisionP.wafweight
-		decisionConfig.DecisionBalance = decisionP.decisionbalance
-		decisionConfig.Params = decisionP.Params
-		cs.DecisionPlugins[decisionConfig.ID] = decisionConfig
+// ModelAge returns how long ago the model was trained, if its manifest
+// tells
+func (c *ConfigStore) ModelAge(modelID string, now time.Time) (time.Duration, bool) {
+	trained := c.ModelPlugins[modelID].TrainedAt
+	if trained.IsZero() {
+		return 0, false
 	}
+	return now.Sub(trained), true
+}
 
-	if inConf.NatsURL != "" {
-		cs.NatsURL = inConf.NatsURL
-	} else {
-		cs.NatsURL = "localhost:4222"
+// IsStale returns true if the model is older than the staleness max age
+func (c *ConfigStore) IsStale(modelID string, now time.Time) bool {
+	age, ok := c.ModelAge(modelID, now)
+	return ok && c.Staleness.MaxAge > 0 && age > c.Staleness.MaxAge
+}
+
+// ModelWeight returns the weight of the model plugin, discounted if the
+// model is stale
+func (c *ConfigStore) ModelWeight(modelID string, now time.Time) float64 {
+	weight := c.ModelPlugins[modelID].Weight
+	if c.IsStale(modelID, now) {
+		weight *= c.Staleness.Discount
+	}
+	return weight
+}
+
+// LatencySLOConfig is the latency budget of each phase of a transaction,
+// measured from InitTransaction for the request and from the first
+// analysis of a response part for the response, until the end of its
+// check. Zero disables the budget of the phase.
+type LatencySLOConfig struct {
+	Request  time.Duration
+	Response time.Duration
+}
+
+type configFileLatencySLO struct {
+	Request  string
+	Response string
+}
+
+// setLatencySLO checks and sets the latency budgets
+func (cs *ConfigStore) setLatencySLO(inConf configFileLatencySLO) error {
+	var slo LatencySLOConfig
+	var err error
+	if inConf.Request != "" {
+		if slo.Request, err = time.ParseDuration(inConf.Request); err != nil || slo.Request < 0 {
+			return fmt.Errorf("invalid request latency slo %s", inConf.Request)
+		}
+	}
+	if inConf.Response != "" {
+		if slo.Response, err = time.ParseDuration(inConf.Response); err != nil || slo.Response < 0 {
+			return fmt.Errorf("invalid response latency slo %s", inConf.Response)
+		}
+	}
+	cs.LatencySLO = slo
+	return nil
+}
+
+// Actions on the model results whose Data exceeds the size limit
+const (
+	// ResultDataTruncate drops keys of the Data until it fits
+	ResultDataTruncate = "truncate"
+	// ResultDataReject fails the analysis of the model
+	ResultDataReject = "reject"
+)
+
+// defaultResultDataMaxBytes is the default size limit of the Data of
+// the model results
+const defaultResultDataMaxBytes = 1 << 20
+
+// defaultHealthCheckInterval is the default time between the health
+// checks of the plugins
+const defaultHealthCheckInterval = 30 * time.Second
+
+// defaultFingerprintTTL is how long the request shapes seen on an
+// endpoint are remembered by default
+const defaultFingerprintTTL = 7 * 24 * time.Hour
+
+// Modes of the connection to the NATS server
+const (
+	// NATSAuto connects only when a model plugin is async or remote, or
+	// the retro-detections are published to a NATS subject
+	NATSAuto = "auto"
+	// NATSEnabled always connects
+	NATSEnabled = "enabled"
+	// NATSDisabled never connects, for local-only deployments. The
+	// configurations that need NATS are rejected.
+	NATSDisabled = "disabled"
+)
+
+// setNatsMode checks and sets the mode of the connection to the NATS
+// server, once the plugins and the re-analysis are set
+func (cs *ConfigStore) setNatsMode(mode string) error {
+	switch mode {
+	case "":
+		mode = NATSAuto
+	case NATSAuto, NATSEnabled:
+	case NATSDisabled:
+		for id, modelConfig := range cs.ModelPlugins {
+			if modelConfig.Mode == "async" || modelConfig.Remote {
+				return fmt.Errorf("%s plugin needs NATS, which is disabled", id)
+			}
+		}
+		if cs.Reanalysis.NatsSubject != "" {
+			return fmt.Errorf("reanalysis nats subject %s needs NATS, which is disabled", cs.Reanalysis.NatsSubject)
+		}
+	default:
+		return fmt.Errorf("invalid nats mode %s", mode)
 	}
-	
+	cs.NatsMode = mode
 	return nil
-}
\ No newline at end of file
+}
+
+// UsesNATS returns true if WACE must connect to the NATS server
+func (c *ConfigStore) UsesNATS() bool {
+	switch c.NatsMode {
+	case NATSEnabled:
+		return true
+	case NATSDisabled:
+		return false
+	}
+	for _, modelConfig := range c.ModelPlugins {
+		if modelConfig.Mode == "async" || modelConfig.Remote {
+			return true
+		}
+	}
+	return c.Reanalysis.NatsSubject != ""
+}
+
+// PluginLogFiles maps the IDs of the plugins with a log file of their
+// own to its path
+func (c *ConfigStore) PluginLogFiles() map[string]string {
+	files := make(map[string]string)
+	for id, modelConfig := range c.ModelPlugins {
+		if modelConfig.LogFile != "" {
+			files[id] = modelConfig.LogFile
+		}
+	}
+	for id, decisionConfig := range c.DecisionPlugins {
+		if decisionConfig.LogFile != "" {
+			files[id] = decisionConfig.LogFile
+		}
+	}
+	return files
+}
+
+// NATSReconnectConfig configures how the connections to the NATS server
+// are re-established after they are lost
+type NATSReconnectConfig struct {
+	// Wait is the delay before the first reconnect attempt, doubled
+	// after each failed attempt up to MaxWait
+	Wait    time.Duration
+	MaxWait time.Duration
+	// MaxAttempts is the number of failed reconnect attempts after which
+	// the connection is closed, zero retries forever
+	MaxAttempts int
+	// BufferSize is the bytes of the messages published while
+	// disconnected that are kept to be sent on reconnect. Publishing
+	// fails once it is full. A negative size disables the buffer.
+	BufferSize int
+}
+
+type configFileNATSReconnect struct {
+	Wait        string
+	Maxwait     string
+	Maxattempts int
+	Buffersize  int
+}
+
+// setNATSReconnect checks and sets the reconnection to the NATS server
+func (cs *ConfigStore) setNATSReconnect(inConf configFileNATSReconnect) error {
+	rc := NATSReconnectConfig{
+		Wait:        100 * time.Millisecond,
+		MaxWait:     10 * time.Second,
+		MaxAttempts: inConf.Maxattempts,
+		BufferSize:  8 * 1024 * 1024,
+	}
+	var err error
+	if inConf.Wait != "" {
+		if rc.Wait, err = time.ParseDuration(inConf.Wait); err != nil || rc.Wait <= 0 {
+			return fmt.Errorf("invalid nats reconnect wait %s", inConf.Wait)
+		}
+	}
+	if inConf.Maxwait != "" {
+		if rc.MaxWait, err = time.ParseDuration(inConf.Maxwait); err != nil || rc.MaxWait <= 0 {
+			return fmt.Errorf("invalid nats reconnect max wait %s", inConf.Maxwait)
+		}
+	}
+	if rc.MaxWait < rc.Wait {
+		return fmt.Errorf("nats reconnect max wait %v is less than the wait %v", rc.MaxWait, rc.Wait)
+	}
+	if rc.MaxAttempts < 0 {
+		return fmt.Errorf("nats reconnect max attempts %d is negative", rc.MaxAttempts)
+	}
+	if inConf.Buffersize != 0 {
+		rc.BufferSize = inConf.Buffersize
+	}
+	cs.NATSReconnect = rc
+	return nil
+}
+
+// NATSTLSConfig secures the connections to the NATS server with TLS. A
+// tls:// natsurl uses TLS with the authorities of the system too.
+type NATSTLSConfig struct {
+	// Cert and Key are the PEM files of the client certificate, for
+	// the servers verifying the clients
+	Cert string
+	Key  string
+	// CA is the PEM file of the authorities trusted to sign the server
+	// certificate, instead of those of the system
+	CA string
+}
+
+type configFileNATSTLS struct {
+	Cert string
+	Key  string
+	Ca   string
+}
+
+// NATSAuthConfig authenticates the connections to the NATS server, with
+// either a credentials file, a token or a user and password
+type NATSAuthConfig struct {
+	// Creds is the credentials file of the user, with its JWT and seed
+	Creds    string
+	Token    string
+	User     string
+	Password string
+	// Secrets maps token and password, if read from secrets, to their
+	// references
+	Secrets map[string]string
+}
+
+// checkNATSSecurity verifies the TLS files and the authentication of the
+// connections to the NATS server
+func checkNATSSecurity(inConf ConfigFileData, p *problems) {
+	tlsFiles := []struct{ field, path string }{
+		{"natstls.cert", inConf.Natstls.Cert},
+		{"natstls.key", inConf.Natstls.Key},
+		{"natstls.ca", inConf.Natstls.Ca},
+		{"natscreds", inConf.Natscreds},
+	}
+	for _, file := range tlsFiles {
+		if file.path == "" {
+			continue
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			p.add(file.field, "%s cannot be opened: %v", file.path, err)
+		}
+	}
+	if (inConf.Natstls.Cert == "") != (inConf.Natstls.Key == "") {
+		p.add("natstls", "cert and key must be given together")
+	}
+	methods := 0
+	for _, value := range []string{inConf.Natscreds, inConf.Natstoken, inConf.Natsuser} {
+		if value != "" {
+			methods++
+		}
+	}
+	if methods > 1 {
+		p.add("natscreds", "use only one of natscreds, natstoken and natsuser")
+	}
+	if inConf.Natspassword != "" && inConf.Natsuser == "" {
+		p.add("natspassword", "natspassword without natsuser")
+	}
+}
+
+// setNATSSecurity sets the TLS and the authentication of the connections
+// to the NATS server, reading the token and password from their secret
+// references
+func (cs *ConfigStore) setNATSSecurity(inConf ConfigFileData) error {
+	cs.NATSTLS = NATSTLSConfig{Cert: inConf.Natstls.Cert, Key: inConf.Natstls.Key, CA: inConf.Natstls.Ca}
+	secrets := map[string]string{"token": inConf.Natstoken, "password": inConf.Natspassword}
+	resolved, references, err := resolveParams(secrets)
+	if err != nil {
+		return fmt.Errorf("nats %v", err)
+	}
+	cs.NATSAuth = NATSAuthConfig{
+		Creds:    inConf.Natscreds,
+		Token:    resolved["token"],
+		User:     inConf.Natsuser,
+		Password: resolved["password"],
+		Secrets:  references,
+	}
+	return nil
+}
+
+// ResultDataConfig limits the size of the Data of the model results,
+// measured in bytes of its JSON encoding
+type ResultDataConfig struct {
+	MaxBytes int
+	// Action is ResultDataTruncate or ResultDataReject
+	Action string
+}
+
+type configFileResultData struct {
+	Maxbytes *int
+	Action   string
+}
+
+// setResultData checks and sets the size limit of the model results
+func (cs *ConfigStore) setResultData(inConf configFileResultData) error {
+	rd := ResultDataConfig{MaxBytes: defaultResultDataMaxBytes, Action: inConf.Action}
+	if inConf.Maxbytes != nil {
+		if *inConf.Maxbytes < 0 {
+			return fmt.Errorf("invalid result data max bytes %d", *inConf.Maxbytes)
+		}
+		rd.MaxBytes = *inConf.Maxbytes
+	}
+	switch rd.Action {
+	case "":
+		rd.Action = ResultDataTruncate
+	case ResultDataTruncate, ResultDataReject:
+	default:
+		return fmt.Errorf("invalid result data action %s", inConf.Action)
+	}
+	cs.ResultData = rd
+	return nil
+}
+
+// ChallengeConfig configures the tokens given to the clients that
+// solved a challenge
+type ChallengeConfig struct {
+	// Secret signs the tokens. Empty disables the tokens. It is left
+	// out of the JSON dumps of the configuration.
+	Secret []byte `json:"-"`
+	TTL    time.Duration
+	// Cookie and Header name where the clients present the token
+	Cookie string
+	Header string
+	// Bind lists the metadata keys whose values the token is bound to
+	Bind []string
+}
+
+type configFileChallenge struct {
+	Secret string
+	TTL    string
+	Cookie string
+	Header string
+	Bind   []string
+}
+
+// minChallengeSecret is the shortest secret accepted to sign tokens
+const minChallengeSecret = 16
+
+// setChallenge checks and sets the challenge configuration
+func (cs *ConfigStore) setChallenge(inConf configFileChallenge) error {
+	ch := ChallengeConfig{
+		TTL:    30 * time.Minute,
+		Cookie: inConf.Cookie,
+		Header: inConf.Header,
+		Bind:   inConf.Bind,
+	}
+	if inConf.Secret != "" {
+		if len(inConf.Secret) < minChallengeSecret {
+			return fmt.Errorf("challenge secret is shorter than %d bytes", minChallengeSecret)
+		}
+		ch.Secret = []byte(inConf.Secret)
+	}
+	if inConf.TTL != "" {
+		var err error
+		if ch.TTL, err = time.ParseDuration(inConf.TTL); err != nil || ch.TTL <= 0 {
+			return fmt.Errorf("invalid challenge ttl %s", inConf.TTL)
+		}
+	}
+	if ch.Cookie == "" {
+		ch.Cookie = "wace_challenge"
+	}
+	if ch.Header == "" {
+		ch.Header = "X-Wace-Challenge"
+	}
+	if len(ch.Bind) == 0 {
+		ch.Bind = []string{"client.ip"}
+	}
+	cs.Challenge = ch
+	return nil
+}
+
+// Policies for the unknown model IDs given to Analyze
+const (
+	// UnknownModelsContinue analyzes with the known models only
+	UnknownModelsContinue = "continue"
+	// UnknownModelsFail fails the Analyze call without calling any model
+	UnknownModelsFail = "fail"
+	// UnknownModelsSubstitute replaces the unknown models by the
+	// default model of the analyzed part
+	UnknownModelsSubstitute = "substitute"
+)
+
+// UnknownModelsConfig is how Analyze handles the model IDs that are not
+// configured
+type UnknownModelsConfig struct {
+	Policy string
+	// Defaults maps the parts of the transaction to the model that
+	// replaces the unknown models with the substitute policy
+	Defaults map[ModelPluginType]string
+}
+
+type configFileUnknownModels struct {
+	Policy   string
+	Defaults map[string]string
+}
+
+// setUnknownModels checks and sets the unknown models configuration
+func (cs *ConfigStore) setUnknownModels(inConf configFileUnknownModels) error {
+	um := UnknownModelsConfig{Policy: inConf.Policy, Defaults: make(map[ModelPluginType]string)}
+	switch um.Policy {
+	case "":
+		um.Policy = UnknownModelsContinue
+	case UnknownModelsContinue, UnknownModelsFail, UnknownModelsSubstitute:
+	default:
+		return fmt.Errorf("invalid unknown models policy %s", inConf.Policy)
+	}
+	for part, id := range inConf.Defaults {
+		t, err := StringToPluginType(part)
+		if err != nil {
+			return err
+		}
+		modelConfig, ok := cs.ModelPlugins[id]
+		if !ok {
+			return fmt.Errorf("default model plugin %s not found", id)
+		}
+		if modelConfig.PluginType != t {
+			return fmt.Errorf("default model plugin %s is not of type %s", id, t)
+		}
+		um.Defaults[t] = id
+	}
+	cs.UnknownModels = um
+	return nil
+}
+
+// FastPathConfig lists the requests allowed at once, without calling
+// any model, such as CORS preflights and static assets
+type FastPathConfig struct {
+	// Methods are the request methods skipped, upper case
+	Methods []string
+	// Suffixes are the endings of the request paths skipped, lower
+	// case, e.g. .css
+	Suffixes []string
+}
+
+type configFileFastPath struct {
+	Methods  []string
+	Suffixes []string
+}
+
+// setFastPath checks and sets the fast path configuration
+func (cs *ConfigStore) setFastPath(inConf configFileFastPath) error {
+	var fp FastPathConfig
+	for _, method := range inConf.Methods {
+		if method == "" || strings.ContainsAny(method, " \t/") {
+			return fmt.Errorf("invalid fast path method %q", method)
+		}
+		fp.Methods = append(fp.Methods, strings.ToUpper(method))
+	}
+	for _, suffix := range inConf.Suffixes {
+		if suffix == "" || strings.ContainsAny(suffix, "?# ") {
+			return fmt.Errorf("invalid fast path suffix %q", suffix)
+		}
+		fp.Suffixes = append(fp.Suffixes, strings.ToLower(suffix))
+	}
+	cs.FastPath = fp
+	return nil
+}
+
+// Skips returns true if the request with the given method and path
+// takes the fast path. The suffixes only apply to the GET and HEAD
+// requests, and are matched on the percent-decoded path without its
+// ";" parameters, so "/admin.php;.js" does not match ".js".
+func (fp FastPathConfig) Skips(method, path string) bool {
+	for _, m := range fp.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	if len(fp.Suffixes) == 0 || (!strings.EqualFold(method, "GET") && !strings.EqualFold(method, "HEAD")) {
+		return false
+	}
+	decoded, err := url.PathUnescape(path)
+	if err != nil {
+		return false
+	}
+	segments := strings.Split(decoded, "/")
+	for i, segment := range segments {
+		segments[i], _, _ = strings.Cut(segment, ";")
+	}
+	path = strings.ToLower(strings.Join(segments, "/"))
+	for _, suffix := range fp.Suffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Degradations of the analysis of the tenants over their budget
+const (
+	// BudgetReport only tags the transactions over budget
+	BudgetReport = "report"
+	// BudgetFree only calls the models without a cost
+	BudgetFree = "free"
+	// BudgetSkip calls no model, leaving the decision to the WAF data
+	BudgetSkip = "skip"
+)
+
+// BudgetConfig caps the daily estimated compute cost of the analyses of
+// each tenant
+type BudgetConfig struct {
+	// Tenants maps tenants to their daily budget
+	Tenants map[string]float64
+	// Default is the daily budget of the other tenants, zero is
+	// unlimited. Transactions without a tenant are never capped.
+	Default float64
+	// Degradation is BudgetReport, BudgetFree or BudgetSkip
+	Degradation string
+}
+
+type configFileBudget struct {
+	Tenants     map[string]float64
+	Default     float64
+	Degradation string
+}
+
+// setBudget checks and sets the tenant budgets
+func (cs *ConfigStore) setBudget(inConf configFileBudget) error {
+	b := BudgetConfig{Tenants: make(map[string]float64, len(inConf.Tenants)), Default: inConf.Default, Degradation: inConf.Degradation}
+	for tenant, budget := range inConf.Tenants {
+		if budget <= 0 {
+			return fmt.Errorf("invalid budget %v of tenant %s", budget, tenant)
+		}
+		b.Tenants[tenant] = budget
+	}
+	if b.Default < 0 {
+		return fmt.Errorf("invalid default budget %v", b.Default)
+	}
+	switch b.Degradation {
+	case "":
+		b.Degradation = BudgetFree
+	case BudgetReport, BudgetFree, BudgetSkip:
+	default:
+		return fmt.Errorf("invalid budget degradation %s", inConf.Degradation)
+	}
+	cs.Budget = b
+	return nil
+}
+
+// TenantBudget returns the daily budget of the tenant, and false if it
+// is unlimited
+func (b BudgetConfig) TenantBudget(tenant string) (float64, bool) {
+	if tenant == "" {
+		return 0, false
+	}
+	if budget, ok := b.Tenants[tenant]; ok {
+		return budget, true
+	}
+	return b.Default, b.Default > 0
+}
+
+// ResultStoreConfig keeps the model results of the transactions in a
+// store shared by the WACE instances, so that a transaction analyzed
+// on one instance can be checked on another
+type ResultStoreConfig struct {
+	// Redis is the URL of the Redis server, empty keeps the results in
+	// the instance only
+	Redis string `json:"-"`
+	// TTL is how long the results are kept
+	TTL time.Duration
+}
+
+type configFileResultStore struct {
+	Redis string
+	TTL   string
+}
+
+// setResultStore checks and sets the shared result store configuration
+func (cs *ConfigStore) setResultStore(inConf configFileResultStore) error {
+	rs := ResultStoreConfig{Redis: inConf.Redis, TTL: 10 * time.Minute}
+	if rs.Redis != "" {
+		u, err := url.Parse(rs.Redis)
+		if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+			return fmt.Errorf("invalid result store redis url")
+		}
+	}
+	if inConf.TTL != "" {
+		var err error
+		if rs.TTL, err = time.ParseDuration(inConf.TTL); err != nil || rs.TTL <= 0 {
+			return fmt.Errorf("invalid result store ttl %s", inConf.TTL)
+		}
+	}
+	cs.ResultStore = rs
+	return nil
+}
+
+// AnonymizationConfig configures the pseudonymization of the client
+// identifiers of the transaction metadata
+type AnonymizationConfig struct {
+	// Secret keys the HMAC of the identifiers. Empty disables the
+	// pseudonymization. It is left out of the JSON dumps of the
+	// configuration.
+	Secret []byte `json:"-"`
+	// Rotation is the period of the key, zero never rotates it
+	Rotation time.Duration
+	// Keys lists the metadata keys of the identifiers
+	Keys []string
+}
+
+type configFileAnonymization struct {
+	Secret   string
+	Rotation string
+	Keys     []string
+}
+
+// minAnonymizationSecret is the shortest secret accepted to key the
+// pseudonyms
+const minAnonymizationSecret = 16
+
+// setAnonymization checks and sets the anonymization configuration
+func (cs *ConfigStore) setAnonymization(inConf configFileAnonymization) error {
+	an := AnonymizationConfig{Rotation: 24 * time.Hour, Keys: inConf.Keys}
+	if inConf.Secret != "" {
+		if len(inConf.Secret) < minAnonymizationSecret {
+			return fmt.Errorf("anonymization secret is shorter than %d bytes", minAnonymizationSecret)
+		}
+		an.Secret = []byte(inConf.Secret)
+	}
+	if inConf.Rotation != "" {
+		var err error
+		if an.Rotation, err = time.ParseDuration(inConf.Rotation); err != nil || an.Rotation < 0 {
+			return fmt.Errorf("invalid anonymization rotation %s", inConf.Rotation)
+		}
+	}
+	if len(an.Keys) == 0 {
+		an.Keys = []string{"client.ip"}
+	}
+	cs.Anonymization = an
+	return nil
+}
+
+// DefaultProfile is the profile of the transactions whose profile is
+// not configured
+const DefaultProfile = "default"
+
+// ProfileConfig holds the check defaults of the transactions of a
+// connector profile, so connectors can check them without giving the
+// decision plugin and the wafParams on every call
+type ProfileConfig struct {
+	// Decision is the decision plugin of the checks that name none
+	Decision string
+	// WAFParams are the wafParams of the checks that do not give them
+	WAFParams map[string]string
+	// MetaParams maps wafParams keys to the transaction metadata keys
+	// they are taken from when the checks do not give them
+	MetaParams map[string]string
+}
+
+type configFileProfile struct {
+	Decision   string
+	Wafparams  map[string]string
+	Metaparams map[string]string
+}
+
+// setProfiles checks and sets the profile defaults, once the decision
+// plugins are set
+func (cs *ConfigStore) setProfiles(inConf map[string]configFileProfile) error {
+	cs.Profiles = make(map[string]ProfileConfig, len(inConf))
+	for name, profile := range inConf {
+		if profile.Decision != "" {
+			if _, ok := cs.DecisionPlugins[profile.Decision]; !ok {
+				return fmt.Errorf("profile %s decision plugin %s not found", name, profile.Decision)
+			}
+		}
+		for key, meta := range profile.Metaparams {
+			if meta == "" {
+				return fmt.Errorf("profile %s wafParams key %s has no metadata key", name, key)
+			}
+		}
+		cs.Profiles[name] = ProfileConfig{Decision: profile.Decision, WAFParams: profile.Wafparams, MetaParams: profile.Metaparams}
+	}
+	return nil
+}
+
+// Profile returns the defaults of the given profile, or of
+// DefaultProfile if it is not configured
+func (c *ConfigStore) Profile(name string) ProfileConfig {
+	if profile, ok := c.Profiles[name]; ok {
+		return profile
+	}
+	return c.Profiles[DefaultProfile]
+}
+
+// CategoryRule is the threshold and action applied by the built-in
+// categories decision engine to an attack category
+type CategoryRule struct {
+	Threshold float64
+	Action    string
+}
+
+// DecisionPluginConfig stores the configuration of a decision plugin
+type decisionPluginConfig struct {
+	ID     string
+	Path   string
+	Params map[string]string
+	// SecretParams maps the params read from secrets to their
+	// references
+	SecretParams map[string]string
+	Kind         PluginKind
+	Builtin      string
+	Categories   map[string]CategoryRule
+	// WAFweight is the weight of a point of the WAF inbound anomaly
+	// score, making it a score between 0 and 1 once capped,
+	// DecisionBalance the share of the WAF score in the decision, from
+	// 0 (the models only) to 1 (the WAF only), and Threshold the score
+	// from which the plugin blocks, zero if unset
+	WAFweight       float64
+	DecisionBalance float64
+	Threshold       float64
+	// WAFRequirements lists the wafParams keys that the plugin needs
+	WAFRequirements []string
+	// Timeout bounds the time the plugin can take to decide, zero
+	// waits forever
+	Timeout time.Duration
+	// Fallback is the verdict when the plugin times out: FallbackAllow,
+	// FallbackBlock or the ID of another decision plugin to check with
+	Fallback string
+	// Services are the external services the plugin depends on, checked
+	// when it is loaded
+	Services []string
+	// LogFile is the file the log lines of the plugin are also written
+	// to, none if empty
+	LogFile string
+	// MaxSteps bounds the Starlark steps of each call of a script
+	// plugin, a default limit if zero
+	MaxSteps uint64
+	// Requires lists the model and decision plugins initialized before
+	// this one, which is not loaded if any of them is not
+	Requires []string
+}
+
+// ConfigStore stores all wacecore configuration from the config file.
+// The configuration in use is an immutable snapshot that is replaced
+// as a whole by SetConfig and Update, so it must not be modified once
+// returned by Snapshot.
+type ConfigStore struct {
+	ModelPlugins    map[string]modelPluginConfig
+	DecisionPlugins map[string]decisionPluginConfig
+	LogPath         string
+	LogLevel        lg.LogLevel
+	NatsURL         string
+	// NatsMode is NATSAuto, NATSEnabled or NATSDisabled
+	NatsMode string
+	// Environment is the environment of the configuration file merged
+	// into it, if any
+	Environment    string
+	ApplicationId  string
+	DebugHeader    string
+	DebugToken     string
+	DebugRedact    []string
+	WAFConditions  []WAFCondition
+	Fingerprinting bool
+	FingerprintTTL time.Duration
+	Learning       bool
+	LearningPeriod time.Duration
+	Reanalysis     ReanalysisConfig
+	// WAFOnlyDecision is the decision plugin that checks the
+	// transactions that no model analyzed, instead of the one given
+	WAFOnlyDecision string
+	// ArtifactCache is the directory where model artifacts are cached
+	ArtifactCache string
+	// Warmup is the time after Init during which transactions are
+	// tagged instead of blocked
+	Warmup time.Duration
+	// Export streams the transaction outcomes to analytics
+	Export ExportConfig
+	// Webhooks receive the analysis of the transactions with verdicts
+	// of high severity
+	Webhooks []WebhookConfig
+	// Audit sends the blocked-transaction events to a SIEM over syslog
+	Audit AuditConfig
+	// GeoIP locates the client addresses given by the connector
+	GeoIP GeoIPConfig
+	// Challenge validates the tokens of the clients that solved a
+	// challenge
+	Challenge ChallengeConfig
+	// IncludeAsyncResults stores the results of the async models as
+	// they arrive, so the checks of the transaction made after that
+	// give them to the decision plugin
+	IncludeAsyncResults bool
+	// UnknownModels is how Analyze handles the unknown model IDs
+	UnknownModels UnknownModelsConfig
+	// StrictPlugins makes Init fail if any configured plugin cannot be
+	// loaded, instead of running without it
+	StrictPlugins bool
+	// LatencySLO is the latency budget of the transaction phases, whose
+	// checks exceeding it are counted
+	LatencySLO LatencySLOConfig
+	// Staleness discounts the weights of the stale models
+	Staleness StalenessConfig
+	// PinnedVersions maps logical model names to the version analyzing
+	// all their transactions, regardless of the traffic split
+	PinnedVersions map[string]string
+	// ResultData limits the size of the Data of the model results
+	ResultData ResultDataConfig
+	// FastPath lists the requests allowed without analysis
+	FastPath FastPathConfig
+	// Budget caps the daily cost of the analyses of the tenants
+	Budget BudgetConfig
+	// HealthCheckInterval is the time between the health checks of the
+	// plugins, zero disables them
+	HealthCheckInterval time.Duration
+	// ResultStore shares the model results with other instances
+	ResultStore ResultStoreConfig
+	// Profiles maps the connector profiles to their check defaults
+	Profiles map[string]ProfileConfig
+	// Anonymization pseudonymizes the client identifiers
+	Anonymization AnonymizationConfig
+	// Campaigns clusters the high-score transactions into campaigns
+	Campaigns CampaignsConfig
+	// WorkerPools maps each model affinity to the number of calls of
+	// its models that run at the same time
+	WorkerPools map[string]int
+	// NATSReconnect re-establishes the lost connections to the NATS
+	// server
+	NATSReconnect NATSReconnectConfig
+	// NATSTLS and NATSAuth secure and authenticate the connections to
+	// the NATS server
+	NATSTLS  NATSTLSConfig
+	NATSAuth NATSAuthConfig
+}
+
+// current is the configuration snapshot in use
+var current atomic.Pointer[ConfigStore]
+
+// Snapshot returns the configuration in use. The snapshot is never
+// modified, so callers reading several settings should take it once
+// and read them all from it to get a consistent view, even while the
+// configuration is reloaded.
+func Snapshot() *ConfigStore {
+	if cs := current.Load(); cs != nil {
+		return cs
+	}
+	current.CompareAndSwap(nil, new(ConfigStore))
+	return current.Load()
+}
+
+// Get returns the configuration in use.
+//
+// Deprecated: use Snapshot, and SetConfig or Update to change the
+// configuration.
+func Get() *ConfigStore {
+	return Snapshot()
+}
+
+// clone returns a copy of the configuration that can be modified
+// without affecting the original
+func (c *ConfigStore) clone() *ConfigStore {
+	cs := *c
+	cs.ModelPlugins = make(map[string]modelPluginConfig, len(c.ModelPlugins))
+	for id, modelConfig := range c.ModelPlugins {
+		cs.ModelPlugins[id] = modelConfig
+	}
+	cs.DecisionPlugins = make(map[string]decisionPluginConfig, len(c.DecisionPlugins))
+	for id, decisionConfig := range c.DecisionPlugins {
+		cs.DecisionPlugins[id] = decisionConfig
+	}
+	cs.PinnedVersions = make(map[string]string, len(c.PinnedVersions))
+	for name, version := range c.PinnedVersions {
+		cs.PinnedVersions[name] = version
+	}
+	return &cs
+}
+
+// Update applies fn to a copy of the configuration in use and makes the
+// copy the configuration in use. Concurrent updates are applied one
+// after the other.
+func Update(fn func(*ConfigStore) error) error {
+	_, err := update(fn)
+	return err
+}
+
+// update is Update, returning the configuration replaced
+func update(fn func(*ConfigStore) error) (*ConfigStore, error) {
+	for {
+		old := Snapshot()
+		cs := old.clone()
+		if err := fn(cs); err != nil {
+			return nil, err
+		}
+		if current.CompareAndSwap(old, cs) {
+			return old, nil
+		}
+	}
+}
+
+type configFileModelPlugin struct {
+	ID                string
+	Path              string
+	Weight            float64
+	Threshold         float64
+	Params            map[string]string
+	PluginType        string `yaml:"plugintype"`
+	Mode              string
+	Remote            bool
+	Exposedata        []string
+	Wafconditions     []WAFCondition
+	Artifacts         map[string]string
+	Artifactchecksums map[string]string
+	Kind              string
+	Builtin           string
+	Dependson         []string
+	Manifest          string
+	Timeout           string
+	Retries           int
+	Retrybackoff      string
+	Affinity          string
+	Model             string
+	Version           string
+	Traffic           *float64
+	Address           string
+	URL               string
+	Headers           map[string]string
+	Services          []string
+	Logfile           string
+	Cost              float64
+	Requestreply      bool
+	Shadowof          string
+	Maxsteps          uint64
+	Requires          []string
+}
+
+type configFileDecisionPlugin struct {
+	ID              string
+	Path            string
+	Wafweight       float64
+	Decisionbalance float64
+	Threshold       float64
+	Params          map[string]string
+	Kind            string
+	Builtin         string
+	Categories      map[string]CategoryRule
+	Wafrequirements []string
+	Timeout         string
+	Fallback        string
+	Services        []string
+	Logfile         string
+	Maxsteps        uint64
+	Requires        []string
+}
+
+type ConfigFileData struct {
+	Logpath             string
+	Loglevel            string
+	Modelplugins        []configFileModelPlugin
+	Decisionplugins     []configFileDecisionPlugin
+	NatsURL             string
+	Natsmode            string
+	Debugheader         string
+	Debugtoken          string
+	Debugredact         []string
+	Wafconditions       []WAFCondition
+	Fingerprinting      bool
+	Fingerprintttl      string
+	Learning            bool
+	Learningperiod      string
+	Reanalysis          configFileReanalysis
+	Wafonlydecision     string
+	Artifactcache       string
+	Warmup              string
+	Export              configFileExport
+	Webhooks            []configFileWebhook
+	Audit               configFileAudit
+	Geoip               configFileGeoIP
+	Challenge           configFileChallenge
+	Includeasyncresults bool
+	Unknownmodels       configFileUnknownModels
+	Strictplugins       bool
+	Latencyslo          configFileLatencySLO
+	Staleness           configFileStaleness
+	Pinnedversions      map[string]string
+	Resultdata          configFileResultData
+	Fastpath            configFileFastPath
+	Budget              configFileBudget
+	Healthcheckinterval string
+	Resultstore         configFileResultStore
+	Profiles            map[string]configFileProfile
+	Anonymization       configFileAnonymization
+	Campaigns           configFileCampaigns
+	Workerpools         map[string]int
+	Natsreconnect       configFileNATSReconnect
+	Natstls             configFileNATSTLS
+	Natscreds           string
+	Natstoken           string
+	Natsuser            string
+	Natspassword        string
+	// Environment selects the configuration of Environments merged
+	// into this one by ParseConfig, and Defaults are the keys of the
+	// plugins that do not set them
+	Environment  string
+	Environments map[string]ConfigFileData
+	Defaults     *configFileDefaults
+}
+
+// defaultDebugRedact lists the header and parameter names whose values
+// are redacted from the payloads captured for debug transactions when
+// no list is given in the config file.
+var defaultDebugRedact = []string{"authorization", "proxy-authorization", "cookie", "set-cookie", "password", "token"}
+
+// ExposesData returns true if the given key of the Data map returned by
+// the model plugin can be propagated to the connector. The special key
+// "*" exposes every key.
+func (c *ConfigStore) ExposesData(modelID, key string) bool {
+	for _, k := range c.ModelPlugins[modelID].ExposeData {
+		if k == key || k == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// PinVersion makes the given version of the model with the given
+// logical name analyze all its transactions in the configuration in
+// use. An empty version restores the traffic split.
+func PinVersion(name, version string) error {
+	return apply(func(c *ConfigStore) error {
+		if version == "" {
+			delete(c.PinnedVersions, name)
+			return nil
+		}
+		if _, ok := c.VersionID(name, version); !ok {
+			return fmt.Errorf("version %s of model %s not found", version, name)
+		}
+		c.PinnedVersions[name] = version
+		return nil
+	})
+}
+
+// SetModelWeight changes the weight of the given model plugin in the
+// configuration in use
+func SetModelWeight(modelID string, weight float64) error {
+	return apply(func(c *ConfigStore) error {
+		modelConfig, ok := c.ModelPlugins[modelID]
+		if !ok {
+			return fmt.Errorf("model plugin %s not found", modelID)
+		}
+		if weight < 0 {
+			return fmt.Errorf("model plugin %s weight %v cannot be negative", modelID, weight)
+		}
+		modelConfig.Weight = weight
+		c.ModelPlugins[modelID] = modelConfig
+		return nil
+	})
+}
+
+// IsAsync returns true if the model plugin is async
+func (c *ConfigStore) IsAsync(modelID string) bool {
+	return c.ModelPlugins[modelID].Mode == "async"
+}
+
+// ModelDeadline returns the time the core waits for a sync model to
+// answer: its timeout for every attempt, with the backoffs between its
+// retries. It is zero, waiting forever, if the model has no timeout.
+func (c *ConfigStore) ModelDeadline(modelID string) time.Duration {
+	modelConfig := c.ModelPlugins[modelID]
+	if modelConfig.Timeout <= 0 {
+		return 0
+	}
+	deadline := modelConfig.Timeout
+	for retry := 1; retry <= modelConfig.Retries; retry++ {
+		deadline += RetryDelay(modelConfig.RetryBackoff, retry) + modelConfig.Timeout
+	}
+	return deadline
+}
+
+// MaxModelRetries bounds the retries of a model plugin
+const MaxModelRetries = 10
+
+// RetryDelay returns the delay before the given retry, starting from 1,
+// of a model with the given backoff
+func RetryDelay(backoff time.Duration, retry int) time.Duration {
+	return backoff << (retry - 1)
+}
+
+// ShadowsOf returns the sorted IDs of the model plugins dark launched
+// along the given one
+func (c *ConfigStore) ShadowsOf(modelID string) []string {
+	var ids []string
+	for id, modelConfig := range c.ModelPlugins {
+		if modelConfig.ShadowOf == modelID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// checkShadows verifies that the shadow models are local sync models
+// of the type of the model they are dark launched along, which is not
+// a shadow itself
+func checkShadows(c *ConfigStore) error {
+	for id, modelConfig := range c.ModelPlugins {
+		if modelConfig.ShadowOf == "" {
+			continue
+		}
+		primary, ok := c.ModelPlugins[modelConfig.ShadowOf]
+		if !ok {
+			return fmt.Errorf("%s plugin shadows unknown model plugin %s", id, modelConfig.ShadowOf)
+		}
+		if primary.ShadowOf != "" {
+			return fmt.Errorf("%s plugin shadows %s, which is a shadow itself", id, modelConfig.ShadowOf)
+		}
+		if c.IsAsync(id) || modelConfig.Remote {
+			return fmt.Errorf("%s plugin shadow cannot be async or remote", id)
+		}
+		if primary.PluginType != modelConfig.PluginType {
+			return fmt.Errorf("%s plugin shadow is not of the type of %s", id, modelConfig.ShadowOf)
+		}
+	}
+	return nil
+}
+
+// ModelVersions returns the sorted IDs of the versions of the model with
+// the given logical name, when it is not the ID of a model plugin
+func (c *ConfigStore) ModelVersions(name string) []string {
+	if _, ok := c.ModelPlugins[name]; ok {
+		return nil
+	}
+	var ids []string
+	for id, modelConfig := range c.ModelPlugins {
+		if modelConfig.Model == name {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// VersionID returns the ID of the given version of the model with the
+// given logical name
+func (c *ConfigStore) VersionID(name, version string) (string, bool) {
+	for _, id := range c.ModelVersions(name) {
+		if c.ModelPlugins[id].Version == version {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// setPinnedVersions checks that the versions of each model are distinct
+// and that its logical name is not the ID of another plugin, and sets
+// the pinned versions
+func (cs *ConfigStore) setPinnedVersions(pinned map[string]string) error {
+	versions := make(map[string]string)
+	for id, modelConfig := range cs.ModelPlugins {
+		if modelConfig.Model == id {
+			continue
+		}
+		if _, ok := cs.ModelPlugins[modelConfig.Model]; ok {
+			return fmt.Errorf("%s plugin model name %s is the ID of another plugin", id, modelConfig.Model)
+		}
+		key := modelConfig.Model + "@" + modelConfig.Version
+		if other, ok := versions[key]; ok {
+			return fmt.Errorf("%s and %s plugins are both version %q of model %s", other, id, modelConfig.Version, modelConfig.Model)
+		}
+		versions[key] = id
+	}
+	for name, version := range pinned {
+		if _, ok := cs.VersionID(name, version); !ok {
+			return fmt.Errorf("pinned version %s of model %s not found", version, name)
+		}
+	}
+	cs.PinnedVersions = pinned
+	return nil
+}
+
+// checkDependencies verifies that the model plugin dependencies are
+// sync model plugins and do not form a cycle
+func checkDependencies(c *ConfigStore) error {
+	for id, modelConfig := range c.ModelPlugins {
+		for _, dep := range modelConfig.DependsOn {
+			if _, ok := c.ModelPlugins[dep]; !ok {
+				return fmt.Errorf("%s plugin depends on unknown model plugin %s", id, dep)
+			}
+			if c.IsAsync(id) || c.IsAsync(dep) {
+				return fmt.Errorf("%s plugin dependency on %s: only sync model plugins can have dependencies", id, dep)
+			}
+		}
+	}
+	// depth-first search, where visiting marks the models on the path
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(c.ModelPlugins))
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("%s plugin dependencies form a cycle", id)
+		case visited:
+			return nil
+		}
+		state[id] = visiting
+		for _, dep := range c.ModelPlugins[id].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[id] = visited
+		return nil
+	}
+	for id := range c.ModelPlugins {
+		if err := visit(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRequirements checks that the plugins required by the model
+// plugins are model plugins, that those required by the decision plugins
+// are either model or decision plugins, and that the requirements form
+// no cycle
+func checkRequirements(c *ConfigStore) error {
+	for id, modelConfig := range c.ModelPlugins {
+		for _, req := range modelConfig.Requires {
+			if _, ok := c.ModelPlugins[req]; !ok {
+				return fmt.Errorf("%s plugin requires unknown model plugin %s", id, req)
+			}
+		}
+	}
+	for id, decisionConfig := range c.DecisionPlugins {
+		for _, req := range decisionConfig.Requires {
+			_, model := c.ModelPlugins[req]
+			_, decision := c.DecisionPlugins[req]
+			switch {
+			case model && decision:
+				return fmt.Errorf("%s plugin requires %s, which is both a model and a decision plugin", id, req)
+			case !model && !decision:
+				return fmt.Errorf("%s plugin requires unknown plugin %s", id, req)
+			}
+		}
+	}
+	// the models are initialized before the decisions, so only the
+	// requirements among plugins of the same kind can form a cycle
+	if _, err := c.modelInitOrder(); err != nil {
+		return err
+	}
+	_, err := c.decisionInitOrder()
+	return err
+}
+
+// initOrder returns the plugin IDs sorted so that each one comes after
+// those it requires, and otherwise by ID, or an error if the
+// requirements form a cycle. The requirements that are not among the
+// IDs are ignored.
+func initOrder(ids []string, requires func(id string) []string) ([]string, error) {
+	ids = append([]string(nil), ids...)
+	sort.Strings(ids)
+	plugins := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		plugins[id] = true
+	}
+	// depth-first search, where visiting marks the plugins on the path
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(plugins))
+	order := make([]string, 0, len(plugins))
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("%s plugin requirements form a cycle", id)
+		case visited:
+			return nil
+		}
+		state[id] = visiting
+		for _, req := range requires(id) {
+			if !plugins[req] {
+				continue
+			}
+			if err := visit(req); err != nil {
+				return err
+			}
+		}
+		state[id] = visited
+		order = append(order, id)
+		return nil
+	}
+	for _, id := range ids {
+		if err := visit(id); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// InitOrder returns the IDs of the model plugins and of the decision
+// plugins in the order they are initialized: each plugin after those
+// it requires, and otherwise by ID
+func (c *ConfigStore) InitOrder() ([]string, []string) {
+	models, _ := c.modelInitOrder()
+	decisions, _ := c.decisionInitOrder()
+	return models, decisions
+}
+
+// modelInitOrder returns the IDs of the model plugins in their order of
+// initialization
+func (c *ConfigStore) modelInitOrder() ([]string, error) {
+	ids := make([]string, 0, len(c.ModelPlugins))
+	for id := range c.ModelPlugins {
+		ids = append(ids, id)
+	}
+	return initOrder(ids, func(id string) []string { return c.ModelPlugins[id].Requires })
+}
+
+// decisionInitOrder returns the IDs of the decision plugins in their
+// order of initialization
+func (c *ConfigStore) decisionInitOrder() ([]string, error) {
+	ids := make([]string, 0, len(c.DecisionPlugins))
+	for id := range c.DecisionPlugins {
+		ids = append(ids, id)
+	}
+	return initOrder(ids, func(id string) []string { return c.DecisionPlugins[id].Requires })
+}
+
+// CheckLogging verifies if the log path is valid
+func checkLogging(inConf ConfigFileData) error {
+	// check logpath
+	if inConf.Logpath == "" {
+		return fmt.Errorf("log path empty")
+	}
+	_, err := os.Stat(inConf.Logpath)
+	if err != nil { // check if log file does not exists already
+		// Attempt to create dummy file
+		var d []byte
+		err = ioutil.WriteFile(inConf.Logpath, d, 0644)
+		if err == nil {
+			err = os.Remove(inConf.Logpath) // delete it
+		}
+	}
+	return err
+}
+
+// checkConfig verifies the configuration read from the config file,
+// returning all its problems in a *ValidationError
+func checkConfig(inConf ConfigFileData) error {
+	var p problems
+	if err := checkLogging(inConf); err != nil {
+		p.add("logpath", "invalid log path %s: %v", inConf.Logpath, err)
+	}
+	if err := checkWAFConditions("global", inConf.Wafconditions); err != nil {
+		p.add("wafconditions", "%v", err)
+	}
+	// ParseConfig merges and removes them
+	if len(inConf.Environments) > 0 {
+		p.add("environments", "environments are only merged when the file is parsed with ParseConfig or LoadConfig")
+	}
+	if inConf.Defaults != nil {
+		p.add("defaults", "defaults are only merged when the file is parsed with ParseConfig or LoadConfig")
+	}
+
+	// check modelplugins
+	modelIndex := make(map[string]int)
+	needsNATS := ""
+	for i, modelP := range inConf.Modelplugins {
+		field := fmt.Sprintf("modelplugins[%d]", i)
+		if modelP.ID == "" {
+			p.add(field+".id", "model plugin id is empty")
+		} else if first, ok := modelIndex[modelP.ID]; ok {
+			p.add(field+".id", "duplicate model plugin id %s, also in modelplugins[%d]", modelP.ID, first)
+		} else {
+			modelIndex[modelP.ID] = i
+		}
+		if err := checkWAFConditions(modelP.ID+" plugin", modelP.Wafconditions); err != nil {
+			p.add(field+".wafconditions", "%v", err)
+		}
+		for name, url := range modelP.Artifacts {
+			if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+				p.add(field+".artifacts."+name, "%s plugin artifact %s url %s is not http(s)", modelP.ID, name, url)
+			}
+		}
+		for name, checksum := range modelP.Artifactchecksums {
+			if _, ok := modelP.Artifacts[name]; !ok {
+				p.add(field+".artifactchecksums."+name, "%s plugin artifact checksum %s has no artifact", modelP.ID, name)
+			} else if sum, err := hex.DecodeString(checksum); err != nil || len(sum) != sha256.Size {
+				p.add(field+".artifactchecksums."+name, "%s plugin artifact %s checksum %s is not a hex SHA-256", modelP.ID, name, checksum)
+			}
+		}
+
+		if modelP.PluginType == "" {
+			p.add(field+".plugintype", "%s plugin type cannot be empty, please provide a valid type", modelP.ID)
+		} else if _, err := StringToPluginType(modelP.PluginType); err != nil {
+			p.add(field+".plugintype", "%s plugin type %s is not valid", modelP.ID, modelP.PluginType)
+		}
+		if modelP.Weight < 0 {
+			p.add(field+".weight", "%s plugin weight %v cannot be negative", modelP.ID, modelP.Weight)
+		}
+		if modelP.Threshold < 0 || modelP.Threshold > 1 {
+			p.add(field+".threshold", "%s plugin threshold %v is not between 0 and 1", modelP.ID, modelP.Threshold)
+		}
+		if modelP.Retries < 0 || modelP.Retries > MaxModelRetries {
+			p.add(field+".retries", "%s plugin retries %d is not between 0 and %d", modelP.ID, modelP.Retries, MaxModelRetries)
+		}
+		if modelP.Affinity != "" && !validAffinity(modelP.Affinity) {
+			p.add(field+".affinity", "%s plugin affinity %s is not valid, use %s, %s or %s", modelP.ID, modelP.Affinity, CPUBound, IOBound, GPURemote)
+		}
+		if modelP.Mode != "" && modelP.Mode != "sync" && modelP.Mode != "async" {
+			p.add(field+".mode", "%s plugin mode %s is not valid, use sync or async", modelP.ID, modelP.Mode)
+		}
+		remote := modelP.Remote || PluginKind(modelP.Kind) == WorkerPlugin
+		if modelP.Requestreply && (!remote || modelP.Mode == "async") {
+			p.add(field+".requestreply", "%s plugin request reply needs a remote sync model", modelP.ID)
+		}
+		if (remote || modelP.Mode == "async") && needsNATS == "" {
+			needsNATS = field
+		}
+		needsPath := true
+		switch kind := PluginKind(modelP.Kind); kind {
+		case "", SharedObjectPlugin:
+		case BuiltinPlugin, SubprocessPlugin, ONNXPlugin, ScriptPlugin, HTTPPlugin, GRPCPlugin:
+			if modelP.Mode == "async" || modelP.Remote {
+				p.add(field+".kind", "%s %s plugin cannot be async or remote", modelP.ID, kind)
+			}
+			switch kind {
+			case BuiltinPlugin:
+				needsPath = false
+			case HTTPPlugin:
+				if !strings.HasPrefix(modelP.URL, "http://") && !strings.HasPrefix(modelP.URL, "https://") {
+					p.add(field+".url", "%s http plugin url %q is not http(s)", modelP.ID, modelP.URL)
+				}
+				needsPath = false
+			case GRPCPlugin:
+				if modelP.Address == "" {
+					p.add(field+".address", "%s grpc plugin address is empty, please provide a valid address", modelP.ID)
+				}
+				needsPath = false
+			}
+		case WorkerPlugin:
+			needsPath = false
+		default:
+			p.add(field+".kind", "%s plugin kind %s is not valid", modelP.ID, modelP.Kind)
+			needsPath = false
+		}
+
+		if !needsPath {
+			continue
+		}
+		if modelP.Path != "" {
+			if _, err := os.Stat(modelP.Path); err != nil {
+				p.add(field+".path", "%s plugin path %s: %v", modelP.ID, modelP.Path, err)
+			}
+		} else {
+			p.add(field+".path", "%s plugin path is empty, please provide a valid path", modelP.ID)
+		}
+	}
+	// check decisionplugins
+	decisionIndex := make(map[string]int)
+	for i, decisionP := range inConf.Decisionplugins {
+		field := fmt.Sprintf("decisionplugins[%d]", i)
+		if decisionP.ID == "" {
+			p.add(field+".id", "decision plugin id is empty")
+		} else if first, ok := decisionIndex[decisionP.ID]; ok {
+			p.add(field+".id", "duplicate decision plugin id %s, also in decisionplugins[%d]", decisionP.ID, first)
+		} else {
+			decisionIndex[decisionP.ID] = i
+		}
+		if decisionP.Wafweight < 0 {
+			p.add(field+".wafweight", "%s plugin waf weight %v cannot be negative", decisionP.ID, decisionP.Wafweight)
+		}
+		if decisionP.Decisionbalance < 0 || decisionP.Decisionbalance > 1 {
+			p.add(field+".decisionbalance", "%s plugin decision balance %v is not between 0 and 1", decisionP.ID, decisionP.Decisionbalance)
+		}
+		if decisionP.Threshold < 0 || decisionP.Threshold > 1 {
+			p.add(field+".threshold", "%s plugin threshold %v is not between 0 and 1", decisionP.ID, decisionP.Threshold)
+		}
+		switch PluginKind(decisionP.Kind) {
+		case "", SharedObjectPlugin:
+		case BuiltinPlugin:
+			if err := checkCategoryRules(decisionP.ID, decisionP.Categories); err != nil {
+				p.add(field+".categories", "%v", err)
+			}
+			continue
+		case ScriptPlugin:
+		default:
+			p.add(field+".kind", "%s plugin kind %s is not valid", decisionP.ID, decisionP.Kind)
+			continue
+		}
+
+		if decisionP.Path != "" {
+			if _, err := os.Stat(decisionP.Path); err != nil {
+				p.add(field+".path", "%s plugin path %s cannot be opened: %v", decisionP.ID, decisionP.Path, err)
+			}
+		} else {
+			p.add(field+".path", "%s plugin path is empty, please provide a valid path", decisionP.ID)
+		}
+	}
+
+	// check nats
+	if needsNATS != "" && inConf.Natsmode == NATSDisabled {
+		p.add(needsNATS, "remote and async model plugins need NATS, which is disabled")
+	}
+	if inConf.NatsURL != "" {
+		if err := checkNatsURL(inConf.NatsURL); err != nil {
+			p.add("natsurl", "%v", err)
+		}
+	}
+	checkNATSSecurity(inConf, &p)
+
+	return p.err()
+}
+
+// checkNatsURL verifies the address of the NATS server, a comma
+// separated list of URLs or host:port addresses
+func checkNatsURL(natsURL string) error {
+	for _, server := range strings.Split(natsURL, ",") {
+		server = strings.TrimSpace(server)
+		host := server
+		if strings.Contains(server, "://") {
+			u, err := url.Parse(server)
+			if err != nil {
+				return fmt.Errorf("invalid nats url %s: %v", server, err)
+			}
+			host = u.Host
+		}
+		if host == "" || strings.HasPrefix(host, ":") {
+			return fmt.Errorf("nats url %s has no host", server)
+		}
+	}
+	return nil
+}
+
+// checkCategoryRules verifies the thresholds and actions of the
+// category rules of a decision plugin
+func checkCategoryRules(pluginID string, rules map[string]CategoryRule) error {
+	for category, rule := range rules {
+		if rule.Threshold < 0 || rule.Threshold > 1 {
+			return fmt.Errorf("%s plugin category %s threshold %v is not between 0 and 1", pluginID, category, rule.Threshold)
+		}
+		if rule.Action != ActionBlock && rule.Action != ActionTag && rule.Action != ActionChallenge {
+			return fmt.Errorf("%s plugin category %s action %q is not valid, use %s, %s or %s", pluginID, category, rule.Action, ActionBlock, ActionTag, ActionChallenge)
+		}
+	}
+	return nil
+}
+
+// ValidateConfig verifies the configuration read from a config file
+// without applying it
+func ValidateConfig(inConf ConfigFileData) error {
+	return new(ConfigStore).load(inConf)
+}
+
+// Load loads and checks the configuration read from a config file
+// without applying it, for an engine of its own
+func Load(inConf ConfigFileData) (*ConfigStore, error) {
+	cs := new(ConfigStore)
+	if err := cs.load(inConf); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// SetConfig sets the configuration of WACE from the configuration file.
+// The new configuration replaces the one in use atomically, once it is
+// fully loaded and checked, and the one it replaces is kept for
+// Rollback.
+func SetConfig(inConf ConfigFileData) error {
+	cs := new(ConfigStore)
+	if err := cs.load(inConf); err != nil {
+		return err
+	}
+	rollbackMutex.Lock()
+	defer rollbackMutex.Unlock()
+	previous.Store(current.Swap(cs))
+	return nil
+}
+
+// SetConfig sets the configuration of WACE from the configuration file.
+//
+// Deprecated: the receiver is not modified, use the SetConfig function.
+func (cs *ConfigStore) SetConfig(inConf ConfigFileData) error {
+	return SetConfig(inConf)
+}
+
+// load fills the configuration from the configuration file
+func (cs *ConfigStore) load(inConf ConfigFileData) error {
+	err := checkConfig(inConf)
+	if err != nil {
+		return err
+	}
+
+	cs.LogPath = inConf.Logpath
+	cs.Environment = inConf.Environment
+	logLevel := inConf.Loglevel
+	if logLevel == "" {
+		logLevel = DefaultLogLevel
+	}
+	cs.LogLevel, err = lg.StringToLogLevel(logLevel)
+	if err != nil {
+		return err
+	}
+
+	cs.ModelPlugins = make(map[string]modelPluginConfig)
+	for _, modelP := range inConf.Modelplugins {
+		var modelConfig modelPluginConfig
+		modelConfig.ID = modelP.ID
+		modelConfig.Path = modelP.Path
+		modelConfig.Weight = modelP.Weight
+		modelConfig.Threshold = modelP.Threshold
+		modelConfig.Params, modelConfig.SecretParams, err = resolveParams(modelP.Params)
+		if err != nil {
+			return fmt.Errorf("%s plugin %v", modelP.ID, err)
+		}
+		modelConfig.PluginType, err = StringToPluginType(modelP.PluginType)
+		modelConfig.Mode = modelP.Mode
+		// the workers are remote by definition
+		modelConfig.Remote = modelP.Remote || PluginKind(modelP.Kind) == WorkerPlugin
+		modelConfig.RequestReply = modelP.Requestreply
+		modelConfig.ShadowOf = modelP.Shadowof
+		modelConfig.Requires = modelP.Requires
+		modelConfig.MaxSteps = modelP.Maxsteps
+		modelConfig.ExposeData = modelP.Exposedata
+		modelConfig.WAFConditions = modelP.Wafconditions
+		modelConfig.Artifacts = modelP.Artifacts
+		modelConfig.ArtifactChecksums = modelP.Artifactchecksums
+		modelConfig.Kind = PluginKind(modelP.Kind)
+		if modelConfig.Kind == "" {
+			modelConfig.Kind = SharedObjectPlugin
+		}
+		modelConfig.Builtin = modelP.Builtin
+		if modelConfig.Builtin == "" {
+			modelConfig.Builtin = modelP.ID
+		}
+		modelConfig.DependsOn = modelP.Dependson
+		modelConfig.Address = modelP.Address
+		modelConfig.URL = modelP.URL
+		if err != nil {
+			return err
+		}
+		modelConfig.Headers, modelConfig.SecretHeaders, err = resolveSecrets("header", modelP.Headers)
+		if err != nil {
+			return fmt.Errorf("%s plugin %v", modelP.ID, err)
+		}
+		if modelP.Timeout != "" {
+			modelConfig.Timeout, err = time.ParseDuration(modelP.Timeout)
+			if err != nil || modelConfig.Timeout < 0 {
+				return fmt.Errorf("%s plugin timeout %s is not valid", modelP.ID, modelP.Timeout)
+			}
+		}
+		modelConfig.Retries = modelP.Retries
+		modelConfig.Affinity = modelP.Affinity
+		if modelP.Retrybackoff != "" {
+			modelConfig.RetryBackoff, err = time.ParseDuration(modelP.Retrybackoff)
+			if err != nil || modelConfig.RetryBackoff < 0 {
+				return fmt.Errorf("%s plugin retry backoff %s is not valid", modelP.ID, modelP.Retrybackoff)
+			}
+		}
+		if modelP.Manifest != "" {
+			modelConfig.Manifest = modelP.Manifest
+			var services []string
+			modelConfig.Version, modelConfig.TrainedAt, services, err = readManifest(modelP.Manifest)
+			if err != nil {
+				return fmt.Errorf("%s plugin manifest %s: %v", modelP.ID, modelP.Manifest, err)
+			}
+			modelConfig.Services = append(modelConfig.Services, services...)
+		}
+		modelConfig.Services = append(modelConfig.Services, modelP.Services...)
+		if err := checkServices(modelP.ID, modelConfig.Services); err != nil {
+			return err
+		}
+		if modelP.Version != "" {
+			modelConfig.Version = modelP.Version
+		}
+		modelConfig.Model = modelP.Model
+		if modelConfig.Model == "" {
+			modelConfig.Model = modelP.ID
+		}
+		modelConfig.Traffic = 1
+		if modelP.Traffic != nil {
+			modelConfig.Traffic = *modelP.Traffic
+			if modelConfig.Traffic < 0 {
+				return fmt.Errorf("%s plugin traffic %v cannot be negative", modelP.ID, modelConfig.Traffic)
+			}
+		}
+		if modelP.Cost < 0 {
+			return fmt.Errorf("%s plugin cost %v cannot be negative", modelP.ID, modelP.Cost)
+		}
+		modelConfig.Cost = modelP.Cost
+		modelConfig.LogFile = modelP.Logfile
+		cs.ModelPlugins[modelConfig.ID] = modelConfig
+	}
+	if err := checkDependencies(cs); err != nil {
+		return err
+	}
+	if err := checkShadows(cs); err != nil {
+		return err
+	}
+	if err := cs.setPinnedVersions(inConf.Pinnedversions); err != nil {
+		return err
+	}
+
+	cs.DecisionPlugins = make(map[string]decisionPluginConfig)
+	for _, decisionP := range inConf.Decisionplugins {
+		var decisionConfig decisionPluginConfig
+		decisionConfig.ID = decisionP.ID
+		decisionConfig.Path = decisionP.Path
+		decisionConfig.WAFweight = decisionP.Wafweight
+		decisionConfig.DecisionBalance = decisionP.Decisionbalance
+		decisionConfig.Threshold = decisionP.Threshold
+		decisionConfig.Params, decisionConfig.SecretParams, err = resolveParams(decisionP.Params)
+		if err != nil {
+			return fmt.Errorf("%s plugin %v", decisionP.ID, err)
+		}
+		decisionConfig.Kind = PluginKind(decisionP.Kind)
+		if decisionConfig.Kind == "" {
+			decisionConfig.Kind = SharedObjectPlugin
+		}
+		decisionConfig.Builtin = decisionP.Builtin
+		if decisionConfig.Builtin == "" {
+			decisionConfig.Builtin = decisionP.ID
+		}
+		decisionConfig.Categories = decisionP.Categories
+		decisionConfig.WAFRequirements = decisionP.Wafrequirements
+		if err := checkServices(decisionP.ID, decisionP.Services); err != nil {
+			return err
+		}
+		decisionConfig.Services = decisionP.Services
+		decisionConfig.LogFile = decisionP.Logfile
+		decisionConfig.MaxSteps = decisionP.Maxsteps
+		decisionConfig.Requires = decisionP.Requires
+		if decisionP.Timeout != "" {
+			decisionConfig.Timeout, err = time.ParseDuration(decisionP.Timeout)
+			if err != nil || decisionConfig.Timeout < 0 {
+				return fmt.Errorf("%s plugin timeout %s is not valid", decisionP.ID, decisionP.Timeout)
+			}
+		}
+		decisionConfig.Fallback = decisionP.Fallback
+		if decisionConfig.Fallback == "" {
+			decisionConfig.Fallback = FallbackAllow
+		}
+		cs.DecisionPlugins[decisionConfig.ID] = decisionConfig
+	}
+	if err := checkRequirements(cs); err != nil {
+		return err
+	}
+	for id, decisionConfig := range cs.DecisionPlugins {
+		switch decisionConfig.Fallback {
+		case FallbackAllow, FallbackBlock:
+		case id:
+			return fmt.Errorf("%s plugin cannot be its own fallback", id)
+		default:
+			if _, ok := cs.DecisionPlugins[decisionConfig.Fallback]; !ok {
+				return fmt.Errorf("%s plugin fallback %s is not allow, block or a decision plugin", id, decisionConfig.Fallback)
+			}
+		}
+	}
+
+	if inConf.NatsURL != "" {
+		cs.NatsURL = inConf.NatsURL
+	} else {
+		cs.NatsURL = DefaultNatsURL
+	}
+
+	cs.WAFConditions = inConf.Wafconditions
+
+	cs.Fingerprinting = inConf.Fingerprinting
+	cs.FingerprintTTL = defaultFingerprintTTL
+	if inConf.Fingerprintttl != "" {
+		cs.FingerprintTTL, err = time.ParseDuration(inConf.Fingerprintttl)
+		if err != nil {
+			return fmt.Errorf("invalid fingerprint ttl %s: %v", inConf.Fingerprintttl, err)
+		}
+	}
+
+	if err := cs.setReanalysis(inConf.Reanalysis); err != nil {
+		return err
+	}
+
+	if err := cs.setCampaigns(inConf.Campaigns); err != nil {
+		return err
+	}
+
+	if err := cs.setWorkerPools(inConf.Workerpools); err != nil {
+		return err
+	}
+
+	if err := cs.setNatsMode(inConf.Natsmode); err != nil {
+		return err
+	}
+
+	if err := cs.setNATSReconnect(inConf.Natsreconnect); err != nil {
+		return err
+	}
+
+	if err := cs.setNATSSecurity(inConf); err != nil {
+		return err
+	}
+
+	if err := cs.setExport(inConf.Export); err != nil {
+		return err
+	}
+
+	if err := cs.setWebhooks(inConf.Webhooks); err != nil {
+		return err
+	}
+
+	if err := cs.setAudit(inConf.Audit); err != nil {
+		return err
+	}
+
+	if err := cs.setGeoIP(inConf.Geoip); err != nil {
+		return err
+	}
+
+	if err := cs.setChallenge(inConf.Challenge); err != nil {
+		return err
+	}
+
+	if err := cs.setUnknownModels(inConf.Unknownmodels); err != nil {
+		return err
+	}
+
+	if err := cs.setLatencySLO(inConf.Latencyslo); err != nil {
+		return err
+	}
+
+	if err := cs.setStaleness(inConf.Staleness); err != nil {
+		return err
+	}
+
+	if err := cs.setResultData(inConf.Resultdata); err != nil {
+		return err
+	}
+
+	if err := cs.setFastPath(inConf.Fastpath); err != nil {
+		return err
+	}
+
+	if err := cs.setBudget(inConf.Budget); err != nil {
+		return err
+	}
+
+	if err := cs.setResultStore(inConf.Resultstore); err != nil {
+		return err
+	}
+
+	if err := cs.setProfiles(inConf.Profiles); err != nil {
+		return err
+	}
+
+	if err := cs.setAnonymization(inConf.Anonymization); err != nil {
+		return err
+	}
+
+	if inConf.Wafonlydecision != "" {
+		if _, ok := cs.DecisionPlugins[inConf.Wafonlydecision]; !ok {
+			return fmt.Errorf("waf only decision plugin %s not found", inConf.Wafonlydecision)
+		}
+	}
+	cs.WAFOnlyDecision = inConf.Wafonlydecision
+
+	cs.Warmup = 0
+	if inConf.Warmup != "" {
+		cs.Warmup, err = time.ParseDuration(inConf.Warmup)
+		if err != nil || cs.Warmup < 0 {
+			return fmt.Errorf("invalid warmup %s", inConf.Warmup)
+		}
+	}
+
+	cs.HealthCheckInterval = defaultHealthCheckInterval
+	if inConf.Healthcheckinterval != "" {
+		cs.HealthCheckInterval, err = time.ParseDuration(inConf.Healthcheckinterval)
+		if err != nil || cs.HealthCheckInterval < 0 {
+			return fmt.Errorf("invalid health check interval %s", inConf.Healthcheckinterval)
+		}
+	}
+
+	cs.IncludeAsyncResults = inConf.Includeasyncresults
+	cs.StrictPlugins = inConf.Strictplugins
+
+	cs.ArtifactCache = inConf.Artifactcache
+	if cs.ArtifactCache == "" {
+		cs.ArtifactCache = filepath.Join(os.TempDir(), "wace-artifacts")
+	}
+
+	cs.Learning = inConf.Learning
+	cs.LearningPeriod = 0
+	if inConf.Learningperiod != "" {
+		cs.LearningPeriod, err = time.ParseDuration(inConf.Learningperiod)
+		if err != nil {
+			return fmt.Errorf("invalid learning period %s: %v", inConf.Learningperiod, err)
+		}
+	}
+
+	cs.DebugHeader = inConf.Debugheader
+	cs.DebugToken = inConf.Debugtoken
+	if len(inConf.Debugredact) > 0 {
+		cs.DebugRedact = inConf.Debugredact
+	} else {
+		cs.DebugRedact = defaultDebugRedact
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package configstore
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix marks the scalars whose whole value is read from the
+// environment variable named after it
+const envPrefix = "env:"
+
+// envReference matches ${VAR} and ${VAR:-default}
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// ParseConfig parses the content of a YAML configuration file. The
+// ${VAR} references in its values are replaced by the value of the
+// environment variable VAR, or by default for ${VAR:-default}, and the
+// values env:VAR are replaced by the value of VAR whatever their type,
+// so that e.g. a weight can be set from the environment. A reference
+// to a variable not set without a default is an error, and so is a key
+// unknown to the configuration file, so that a typo such as plugintipe
+// fails instead of being ignored. The environment named by the
+// environment key is then merged into the base configuration, and the
+// defaults into the plugins.
+func ParseConfig(content []byte) (ConfigFileData, error) {
+	var inConf ConfigFileData
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return inConf, err
+	}
+	if err := checkKnownFields(content); err != nil {
+		return inConf, err
+	}
+	if err := expandEnv(&doc); err != nil {
+		return inConf, err
+	}
+	if err := layerConfig(&doc); err != nil {
+		return inConf, err
+	}
+	if doc.Kind == 0 {
+		return inConf, nil
+	}
+	err := doc.Decode(&inConf)
+	return inConf, err
+}
+
+// expandEnv replaces the environment variable references in the scalar
+// values of the node, leaving the mapping keys as they are
+func expandEnv(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		value, err := expandValue(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", node.Line, err)
+		}
+		if value != node.Value {
+			node.Value = value
+			// the expanded plain scalars get the type of their value
+			node.Tag = ""
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := expandEnv(node.Content[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		for _, child := range node.Content {
+			if err := expandEnv(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expandValue returns the scalar value with its environment variable
+// references replaced
+func expandValue(value string) (string, error) {
+	if strings.HasPrefix(value, SecretEnv) {
+		// a secret reference, resolved when the configuration is loaded
+		return value, nil
+	}
+	if name, ok := strings.CutPrefix(value, envPrefix); ok {
+		env, found := os.LookupEnv(name)
+		if !found {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return env, nil
+	}
+	var err error
+	expanded := envReference.ReplaceAllStringFunc(value, func(reference string) string {
+		match := envReference.FindStringSubmatch(reference)
+		if env, found := os.LookupEnv(match[1]); found {
+			return env
+		}
+		if match[2] != "" {
+			return match[3]
+		}
+		if err == nil {
+			err = fmt.Errorf("environment variable %s is not set", match[1])
+		}
+		return reference
+	})
+	return expanded, err
+}
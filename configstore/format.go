@@ -0,0 +1,47 @@
+package configstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfig reads the configuration file at path, in YAML (.yaml or
+// .yml), JSON (.json) or TOML (.toml) by its extension. The JSON and
+// TOML files have the same keys as the YAML ones, and their environment
+// variable references are expanded like in ParseConfig.
+func LoadConfig(path string) (ConfigFileData, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ConfigFileData{}, err
+	}
+	var tree interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+	case ".json":
+		err = json.Unmarshal(content, &tree)
+	case ".toml":
+		var table map[string]interface{}
+		err = toml.Unmarshal(content, &table)
+		tree = table
+	default:
+		return ConfigFileData{}, fmt.Errorf("unknown format of configuration file %s", path)
+	}
+	if err == nil && tree != nil {
+		// the JSON and TOML documents are decoded as YAML
+		content, err = yaml.Marshal(tree)
+	}
+	var inConf ConfigFileData
+	if err == nil {
+		inConf, err = ParseConfig(content)
+	}
+	if err != nil {
+		return inConf, fmt.Errorf("invalid configuration file %s: %v", path, err)
+	}
+	return inConf, nil
+}
@@ -0,0 +1,145 @@
+package configstore
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultLogLevel is the log level of the configurations that set none
+const DefaultLogLevel = "INFO"
+
+// DefaultNatsURL is the address of the NATS server of the
+// configurations that set none
+const DefaultNatsURL = "localhost:4222"
+
+// configFileDefaults are the keys given to every model and decision
+// plugin that does not set them
+type configFileDefaults struct {
+	Modelplugins    configFileModelPlugin
+	Decisionplugins configFileDecisionPlugin
+}
+
+// layerConfig merges the environment selected by the environment key
+// of the configuration file into its base, and then the defaults of the
+// plugins into each of them. The environments and defaults keys are
+// removed once merged, so that they are not decoded.
+func layerConfig(doc *yaml.Node) error {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	root := doc.Content[0]
+	environments := removeKey(root, "environments")
+	if name := mappingValue(root, "environment"); name != nil && name.Value != "" {
+		var overlay *yaml.Node
+		if environments != nil {
+			overlay = mappingValue(environments, name.Value)
+		}
+		if overlay == nil {
+			return fmt.Errorf("line %d: environment %s not found in environments", name.Line, name.Value)
+		}
+		mergeNode(root, overlay)
+	}
+	if defaults := removeKey(root, "defaults"); defaults != nil {
+		for _, key := range []string{"modelplugins", "decisionplugins"} {
+			pluginDefaults, plugins := mappingValue(defaults, key), mappingValue(root, key)
+			if pluginDefaults == nil || plugins == nil || plugins.Kind != yaml.SequenceNode {
+				continue
+			}
+			for i, plugin := range plugins.Content {
+				layered := copyNode(pluginDefaults)
+				mergeNode(layered, plugin)
+				plugins.Content[i] = layered
+			}
+		}
+	}
+	return nil
+}
+
+// mergeNode merges overlay into base. The keys of the overlay mappings
+// replace those of base, but for the mappings, merged recursively, and
+// the sequences of mappings with an id, such as the plugins, whose
+// items are merged by id, the new ids being appended. An empty sequence
+// replaces the base one.
+func mergeNode(base, overlay *yaml.Node) {
+	switch {
+	case base.Kind == yaml.MappingNode && overlay.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(overlay.Content); i += 2 {
+			key, value := overlay.Content[i], overlay.Content[i+1]
+			if current := mappingValue(base, key.Value); current != nil {
+				mergeNode(current, value)
+			} else {
+				base.Content = append(base.Content, key, value)
+			}
+		}
+	case base.Kind == yaml.SequenceNode && overlay.Kind == yaml.SequenceNode && len(overlay.Content) > 0 && hasIDs(base) && hasIDs(overlay):
+		for _, item := range overlay.Content {
+			if current := itemByID(base, mappingValue(item, "id").Value); current != nil {
+				mergeNode(current, item)
+			} else {
+				base.Content = append(base.Content, item)
+			}
+		}
+	default:
+		*base = *overlay
+	}
+}
+
+// mappingValue returns the value of the key in the mapping node, or nil
+// if it has none
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// removeKey removes the key from the mapping node, returning its value
+// or nil if it has none
+func removeKey(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			value := mapping.Content[i+1]
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return value
+		}
+	}
+	return nil
+}
+
+// hasIDs returns true if every item of the sequence node is a mapping
+// with an id
+func hasIDs(sequence *yaml.Node) bool {
+	for _, item := range sequence.Content {
+		if mappingValue(item, "id") == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// itemByID returns the item of the sequence node with the given id, or
+// nil if it has none
+func itemByID(sequence *yaml.Node, id string) *yaml.Node {
+	for _, item := range sequence.Content {
+		if mappingValue(item, "id").Value == id {
+			return item
+		}
+	}
+	return nil
+}
+
+// copyNode returns a deep copy of the node
+func copyNode(node *yaml.Node) *yaml.Node {
+	copied := *node
+	copied.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		copied.Content[i] = copyNode(child)
+	}
+	return &copied
+}
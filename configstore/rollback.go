@@ -0,0 +1,52 @@
+package configstore
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// previous is the configuration replaced by the last reload or tuning
+// change, kept resident to roll back to
+var previous atomic.Pointer[ConfigStore]
+
+// rollbackMutex orders the reloads, the tuning changes and the
+// rollbacks, so that previous is the configuration each one replaced
+var rollbackMutex sync.Mutex
+
+// Previous returns the configuration replaced by the last SetConfig,
+// ApplyTuning, SetModelWeight or PinVersion, or nil if there is none
+func Previous() *ConfigStore {
+	return previous.Load()
+}
+
+// apply applies fn to a copy of the configuration in use like Update,
+// keeping the configuration it replaces as the previous one
+func apply(fn func(*ConfigStore) error) error {
+	rollbackMutex.Lock()
+	defer rollbackMutex.Unlock()
+	old, err := update(fn)
+	if err != nil {
+		return err
+	}
+	previous.Store(old)
+	return nil
+}
+
+// Rollback makes the previous configuration the one in use again,
+// without reading or checking it again, and keeps the one it replaces
+// as the previous one, so that a second Rollback undoes the first. It
+// returns true if the configurations differ by more than the weights
+// and thresholds of the models, so the plugins must be reloaded.
+func Rollback() (bool, error) {
+	rollbackMutex.Lock()
+	defer rollbackMutex.Unlock()
+	prev := previous.Load()
+	if prev == nil {
+		return false, fmt.Errorf("no previous configuration to roll back to")
+	}
+	old := current.Swap(prev)
+	previous.Store(old)
+	return old == nil || !reflect.DeepEqual(untuned(old), untuned(prev)), nil
+}
@@ -0,0 +1,109 @@
+package configstore
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// checkKnownFields returns an error listing the keys of the content
+// that are not fields of the configuration file, with their line. The
+// environment variable references are only expanded in the values, so
+// the keys are checked on the content as is, ignoring the type errors
+// of the values not expanded yet.
+func checkKnownFields(content []byte) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	var inConf ConfigFileData
+	var typeErr *yaml.TypeError
+	if err := decoder.Decode(&inConf); !errors.As(err, &typeErr) {
+		return nil
+	}
+	var unknown []string
+	for _, e := range typeErr.Errors {
+		if strings.Contains(e, " not found in type ") {
+			unknown = append(unknown, e)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	return &yaml.TypeError{Errors: unknown}
+}
+
+// Schema returns the JSON Schema of the configuration file, so that
+// external tools can validate the files before they are deployed. It
+// describes the keys and the types of their values, rejecting the
+// unknown keys like ParseConfig, while the other checks of
+// ValidateConfig, such as the plugin types or the ranges of the
+// weights, are left to it. The values referencing environment
+// variables must be expanded before the file is validated.
+func Schema() map[string]interface{} {
+	schema := structSchema(reflect.TypeOf(ConfigFileData{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "WACE configuration file"
+	return schema
+}
+
+// typeSchema returns the JSON Schema of the values decoded into the
+// given type
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		if t == reflect.TypeOf(ConfigFileData{}) {
+			// the environments are configuration files themselves
+			return map[string]interface{}{"$ref": "#"}
+		}
+		return structSchema(t)
+	}
+	// any value is accepted
+	return map[string]interface{}{}
+}
+
+// structSchema returns the JSON Schema of the objects decoded into the
+// given struct type, with no other keys than its fields
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if key := fieldKey(field); key != "" {
+			properties[key] = typeSchema(field.Type)
+		}
+	}
+	return map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+}
+
+// fieldKey returns the key of the struct field in the configuration
+// file, or an empty string if the field is not decoded
+func fieldKey(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
@@ -0,0 +1,220 @@
+package configstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schemes of the secret references in the plugin params
+const (
+	// SecretFile reads the secret from a file, as file:///run/secrets/key
+	SecretFile = "file://"
+	// SecretEnv reads the secret from an environment variable, as
+	// env://API_KEY
+	SecretEnv = "env://"
+	// SecretVault reads the secret from a key of a HashiCorp Vault
+	// secret, as vault://secret/data/wace#apikey, with the VAULT_ADDR
+	// and VAULT_TOKEN environment variables
+	SecretVault = "vault://"
+)
+
+// vaultTimeout bounds the time to read a secret from Vault
+const vaultTimeout = 10 * time.Second
+
+// isSecretReference returns true if the param value references a
+// secret
+func isSecretReference(value string) bool {
+	return strings.HasPrefix(value, SecretFile) || strings.HasPrefix(value, SecretEnv) || strings.HasPrefix(value, SecretVault)
+}
+
+// resolveParams returns the params with their secret references
+// replaced by the secrets, and the references of the params replaced
+func resolveParams(params map[string]string) (map[string]string, map[string]string, error) {
+	return resolveSecrets("param", params)
+}
+
+// resolveSecrets returns the values with their secret references
+// replaced by the secrets, and the references of the values replaced.
+// kind names the values in the errors.
+func resolveSecrets(kind string, params map[string]string) (map[string]string, map[string]string, error) {
+	var names []string
+	for name, value := range params {
+		if isSecretReference(value) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return params, nil, nil
+	}
+	// the errors are reported in the order of the names
+	sort.Strings(names)
+	resolved := make(map[string]string, len(params))
+	for name, value := range params {
+		resolved[name] = value
+	}
+	references := make(map[string]string, len(names))
+	for _, name := range names {
+		secret, err := resolveSecret(params[name])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s %s: %v", kind, name, err)
+		}
+		resolved[name] = secret
+		references[name] = params[name]
+	}
+	return resolved, references, nil
+}
+
+// resolveSecret returns the secret of the reference
+func resolveSecret(reference string) (string, error) {
+	switch {
+	case strings.HasPrefix(reference, SecretFile):
+		content, err := os.ReadFile(strings.TrimPrefix(reference, SecretFile))
+		if err != nil {
+			return "", err
+		}
+		// the files usually end with a new line
+		return strings.TrimRight(string(content), "\r\n"), nil
+	case strings.HasPrefix(reference, SecretEnv):
+		name := strings.TrimPrefix(reference, SecretEnv)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	}
+	path, key, ok := strings.Cut(strings.TrimPrefix(reference, SecretVault), "#")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("vault reference %s is not vault://path#key", reference)
+	}
+	return readVaultSecret(path, key)
+}
+
+// readVaultSecret reads the key of the secret at path from the Vault
+// server at VAULT_ADDR with the token VAULT_TOKEN. The secrets of the
+// version 2 of the key/value engine, whose keys are in a nested data
+// object, are read too.
+func readVaultSecret(path, key string) (string, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	resp, err := (&http.Client{Timeout: vaultTimeout}).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault secret %s returned %s", path, resp.Status)
+	}
+	var secret struct {
+		Data map[string]interface{}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("invalid vault secret %s: %v", path, err)
+	}
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	value, ok := data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no key %s", path, key)
+	}
+	return value, nil
+}
+
+// redactedSecret replaces the secrets given literally in a redacted
+// configuration
+const redactedSecret = "[REDACTED]"
+
+// Redacted returns a copy of the configuration whose plugin params and
+// NATS token and password read from secrets are their references
+// instead, to be shown, e.g. in a dump. A NATS token or password given
+// literally and the debug token are masked, as are the values of the
+// headers of the http plugins and the webhooks, which usually carry
+// credentials, but for their secret references, and the password in
+// the export URL.
+func (c *ConfigStore) Redacted() *ConfigStore {
+	cs := c.clone()
+	for id, modelConfig := range cs.ModelPlugins {
+		if len(modelConfig.SecretParams) > 0 {
+			modelConfig.Params = redactParams(modelConfig.Params, modelConfig.SecretParams)
+		}
+		modelConfig.Headers = redactHeaders(modelConfig.Headers, modelConfig.SecretHeaders)
+		cs.ModelPlugins[id] = modelConfig
+	}
+	for id, decisionConfig := range cs.DecisionPlugins {
+		if len(decisionConfig.SecretParams) > 0 {
+			decisionConfig.Params = redactParams(decisionConfig.Params, decisionConfig.SecretParams)
+			cs.DecisionPlugins[id] = decisionConfig
+		}
+	}
+	cs.Webhooks = append([]WebhookConfig(nil), cs.Webhooks...)
+	for i, hook := range cs.Webhooks {
+		cs.Webhooks[i].Headers = redactHeaders(hook.Headers, hook.SecretHeaders)
+	}
+	cs.NATSAuth.Token = redactSecret(cs.NATSAuth.Token, cs.NATSAuth.Secrets["token"])
+	cs.NATSAuth.Password = redactSecret(cs.NATSAuth.Password, cs.NATSAuth.Secrets["password"])
+	cs.DebugToken = redactSecret(cs.DebugToken, "")
+	cs.Export.URL = redactURL(cs.Export.URL)
+	return cs
+}
+
+// redactURL returns the address with the password of its user info
+// masked
+func redactURL(address string) string {
+	u, err := url.Parse(address)
+	if err != nil || u.User == nil {
+		return address
+	}
+	return u.Redacted()
+}
+
+// redactSecret returns the reference of a secret value, or the value
+// masked if it was given literally. An empty value is left as is.
+func redactSecret(value, reference string) string {
+	switch {
+	case reference != "":
+		return reference
+	case value != "":
+		return redactedSecret
+	}
+	return value
+}
+
+// redactHeaders returns a copy of the headers with their values masked,
+// or their references if read from secrets
+func redactHeaders(headers, references map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(headers))
+	for name, value := range headers {
+		redacted[name] = redactSecret(value, references[name])
+	}
+	return redacted
+}
+
+// redactParams returns a copy of the params with the given references
+// instead of their values
+func redactParams(params, references map[string]string) map[string]string {
+	redacted := make(map[string]string, len(params))
+	for name, value := range params {
+		redacted[name] = value
+	}
+	for name, reference := range references {
+		redacted[name] = reference
+	}
+	return redacted
+}
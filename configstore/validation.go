@@ -0,0 +1,59 @@
+package configstore
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError is a problem of a field of the configuration file
+type FieldError struct {
+	// Field is the path of the field in the file, such as
+	// modelplugins[2].weight
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error returns the path of the field and the problem
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError lists all the problems found in a configuration file
+type ValidationError struct {
+	Problems []FieldError
+}
+
+// Error returns the problems, separated by semicolons
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		problems[i] = problem.Error()
+	}
+	return fmt.Sprintf("invalid configuration (%d problems): %s", len(e.Problems), strings.Join(problems, "; "))
+}
+
+// Unwrap returns the problems, so errors.As finds a FieldError
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Problems))
+	for i, problem := range e.Problems {
+		errs[i] = problem
+	}
+	return errs
+}
+
+// problems collects the problems of a configuration file
+type problems []FieldError
+
+// add records a problem of the field
+func (p *problems) add(field, format string, args ...interface{}) {
+	*p = append(*p, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns the problems as a *ValidationError, or nil if there is
+// none
+func (p problems) err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: p}
+}
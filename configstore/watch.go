@@ -0,0 +1,169 @@
+package configstore
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// WatchDelay is the time a watched configuration file must stay
+// unchanged before it is read, so that the several writes of an editor
+// give a single change
+const WatchDelay = 100 * time.Millisecond
+
+// Change is a valid new configuration read from a watched file
+type Change struct {
+	// File is the content of the configuration file
+	File ConfigFileData
+	// Config is the configuration loaded from File
+	Config *ConfigStore
+	// Structural is true if the new configuration differs from the one
+	// in use by more than the weights and thresholds of the models, so
+	// the plugins must be reloaded to apply it
+	Structural bool
+}
+
+// Watcher watches a configuration file and sends its valid changes
+type Watcher struct {
+	path    string
+	watcher *fsnotify.Watcher
+	changes chan Change
+	done    chan struct{}
+	close   sync.Once
+}
+
+// Watch watches the configuration file at path, and sends on the
+// Changes channel each new valid content of the file that differs from
+// the configuration in use. The invalid contents are logged and
+// ignored. The directory of the file is watched, so that the file can
+// be replaced by a rename, as done by the editors and by the volumes
+// of Kubernetes configmaps.
+func Watch(path string) (*Watcher, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := fw.Add(filepath.Dir(path)); err != nil {
+		fw.Close()
+		return nil, err
+	}
+	w := &Watcher{path: path, watcher: fw, changes: make(chan Change, 1), done: make(chan struct{})}
+	go w.run()
+	return w, nil
+}
+
+// Changes returns the channel of the changes of the file, closed when
+// the watcher is closed
+func (w *Watcher) Changes() <-chan Change {
+	return w.changes
+}
+
+// Close stops watching the file
+func (w *Watcher) Close() error {
+	var err error
+	w.close.Do(func() {
+		close(w.done)
+		err = w.watcher.Close()
+	})
+	return err
+}
+
+// run reads the file once it stays unchanged for WatchDelay after an
+// event on it
+func (w *Watcher) run() {
+	defer close(w.changes)
+	logger := lg.Get()
+	timer := time.NewTimer(WatchDelay)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			// the files of the configmap volumes are changed by
+			// replacing their ..data symbolic link
+			if event.Name == w.path || strings.HasPrefix(filepath.Base(event.Name), "..") {
+				timer.Reset(WatchDelay)
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Printf(lg.WARN, "config | watching %s failed: %v", w.path, err)
+		case <-timer.C:
+			change, err := w.read()
+			if err != nil {
+				logger.Printf(lg.ERROR, "config | ignoring invalid change of %s: %v", w.path, err)
+				continue
+			}
+			if change == nil {
+				continue
+			}
+			select {
+			case w.changes <- *change:
+			case <-w.done:
+				return
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// read returns the change of the file, or nil if its configuration is
+// the one in use
+func (w *Watcher) read() (*Change, error) {
+	inConf, err := LoadConfig(w.path)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := Load(inConf)
+	if err != nil {
+		return nil, err
+	}
+	old := Snapshot()
+	if reflect.DeepEqual(old, cs) {
+		return nil, nil
+	}
+	return &Change{File: inConf, Config: cs, Structural: !reflect.DeepEqual(untuned(old), untuned(cs))}, nil
+}
+
+// untuned returns a copy of the configuration without the weights and
+// thresholds of the models
+func untuned(c *ConfigStore) *ConfigStore {
+	cs := c.clone()
+	for id, modelConfig := range cs.ModelPlugins {
+		modelConfig.Weight, modelConfig.Threshold = 0, 0
+		cs.ModelPlugins[id] = modelConfig
+	}
+	return cs
+}
+
+// ApplyTuning sets the weights and thresholds of the models of the
+// configuration in use to those of tuned, without reloading the
+// plugins. The configuration it replaces is kept for Rollback.
+func ApplyTuning(tuned *ConfigStore) error {
+	return apply(func(c *ConfigStore) error {
+		for id, tunedConfig := range tuned.ModelPlugins {
+			modelConfig, ok := c.ModelPlugins[id]
+			if !ok {
+				return fmt.Errorf("model plugin %s not found", id)
+			}
+			modelConfig.Weight, modelConfig.Threshold = tunedConfig.Weight, tunedConfig.Threshold
+			c.ModelPlugins[id] = modelConfig
+		}
+		return nil
+	})
+}
@@ -0,0 +1,97 @@
+package wace
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestTransactionContext(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("context", conf, testMeter)
+	id := generateRandomID()
+	engine.InitTransactionWithOptions(id, TransactionOptions{
+		Tenant:   "acme",
+		Profile:  "checkout",
+		Tags:     []string{"route:login"},
+		Metadata: map[string]string{"client": "mobile"},
+	})
+	tc := engine.transactionContext(id)
+	if tc.Tenant != "acme" || tc.Profile != "checkout" || len(tc.Tags) != 1 || tc.Tags[0] != "route:login" || tc.Metadata["client"] != "mobile" {
+		t.Errorf("transaction context is %+v", tc)
+	}
+
+	CloseTransaction(id)
+	if tc := engine.transactionContext(id); tc.Tenant != "" || tc.Tags != nil || len(tc.Metadata) != 0 {
+		t.Errorf("transaction context %+v kept after closing", tc)
+	}
+}
+
+func TestProfileDefaults(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+decisionplugins:
+  - id: combiner
+    kind: builtin
+  - id: strict
+    kind: builtin
+    builtin: combiner
+profiles:
+  default:
+    decision: combiner
+  checkout:
+    decision: strict
+    wafparams:
+      inbound_anomaly_score_threshold: "5"
+      paranoia_level: "1"
+    metaparams:
+      client: client_type
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("profiles", conf, testMeter)
+
+	id := generateRandomID()
+	engine.InitTransactionWithOptions(id, TransactionOptions{Profile: "checkout", Metadata: map[string]string{"client_type": "mobile"}})
+	defer CloseTransaction(id)
+	decision, params := engine.profileDefaults(id, "", map[string]string{"paranoia_level": "2"})
+	if decision != "strict" || len(params) != 3 || params["inbound_anomaly_score_threshold"] != "5" || params["paranoia_level"] != "2" || params["client"] != "mobile" {
+		t.Errorf("checkout defaults are %s, %v", decision, params)
+	}
+	if _, err := CheckTransactionVerdict(id, "", nil); err != nil {
+		t.Errorf("CheckTransactionVerdict without decision plugin returned error: %v", err)
+	}
+
+	other := generateRandomID()
+	engine.InitTransactionWithOptions(other, TransactionOptions{Profile: "search"})
+	defer CloseTransaction(other)
+	if decision, params := engine.profileDefaults(other, "", nil); decision != "combiner" || params != nil {
+		t.Errorf("default profile defaults are %s, %v", decision, params)
+	}
+	if decision, _ := engine.profileDefaults(other, "strict", nil); decision != "strict" {
+		t.Errorf("decision plugin given replaced by %s", decision)
+	}
+}
@@ -0,0 +1,214 @@
+package wace
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tiroa-tilsor/wacelib/audit"
+	"github.com/tiroa-tilsor/wacelib/baseline"
+	"github.com/tiroa-tilsor/wacelib/campaign"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"github.com/tiroa-tilsor/wacelib/export"
+	"github.com/tiroa-tilsor/wacelib/geoip"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+	"github.com/tiroa-tilsor/wacelib/webhook"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// Core is a WACE instance with its own configuration, plugins, metrics,
+// transactions and background jobs, whose methods mirror the functions
+// of the package, so that independent instances, e.g. with different
+// configurations for two listeners, can coexist in one process. The
+// package functions use the default instance set up by Init, or the
+// core the transaction was initialized with, found by its ID.
+//
+// The IDs of the transactions of a core created by NewCore are prefixed
+// by its name in the logs, the plugins and the exports, so several
+// cores can see the same IDs. The package functions can only tell the
+// cores of the transactions with distinct IDs apart, so the connectors
+// sharing IDs across cores must call the methods of the core instead.
+type Core struct {
+	name string
+	// prefix prefixes the IDs of the transactions of the core outside
+	// of it
+	prefix string
+	// conf is the configuration of the core, nil for the default core,
+	// which uses the one applied to the configstore
+	conf *cf.ConfigStore
+	// plugins is the plugin set the new transactions are pinned to, nil
+	// until the plugins are loaded
+	plugins atomic.Pointer[pluginSet]
+	// reloadMutex serializes the reloads of the plugins and the jobs
+	reloadMutex sync.Mutex
+	// attributes are recorded with every metric of the core
+	attributes []attribute.KeyValue
+
+	// Sync map witg channels to receive a notification when all plugins finish
+	// processing a transaction
+	analysisMap sync.Map
+	// Sync map with the metadata of each transaction
+	metadataMap sync.Map
+	// Sync map with the traces of the transactions marked as debug
+	debugMap sync.Map
+	// clientAddresses holds the client address of the transactions
+	// whose address is pseudonymized, for the geolocation only
+	clientAddresses sync.Map
+	// Sync map with the cost of each transaction
+	transactionCosts sync.Map
+	// shadowMap maps each transaction to a *sync.Map of the models with
+	// shadows running to the channels of the shadows awaiting them
+	shadowMap sync.Map
+	// Sync map with the parts of the transactions sampled for re-analysis
+	retainedMap sync.Map
+	// Sync map with the re-scored models of the transactions
+	rescoredMap sync.Map
+	// Sync map with the request features of the transactions
+	campaignFeaturesMap sync.Map
+	// Sync map with the tenant of each transaction
+	transactionTenants sync.Map
+	// Sync map with the profile of each transaction
+	transactionProfiles sync.Map
+	// Sync map with the tags of each transaction
+	transactionTags sync.Map
+	// Sync map with the start of the phases of each transaction
+	phaseMap sync.Map
+	// Sync map with the OnNeedParts callback of each transaction
+	needPartsCallbacks sync.Map
+	recentlyClosed     *closedTransactions
+
+	counters     coreCounters
+	shadowStats  map[[2]string]*shadowTotals
+	shadowsMutex sync.Mutex
+
+	// exporter streams the transaction outcomes to the analytics store,
+	// nil if the export is disabled
+	exporter      *export.Exporter
+	exporterMutex sync.RWMutex
+
+	// dispatcher posts the analysis of the high-severity transactions
+	// to the webhooks, nil if none is configured
+	dispatcher      *webhook.Dispatcher
+	dispatcherMutex sync.RWMutex
+
+	// auditSink sends the blocked-transaction events to the SIEM, nil
+	// if disabled
+	auditSink      *audit.Sink
+	auditSinkMutex sync.RWMutex
+
+	// geoDB is the geoip database, nil if geolocation is disabled
+	geoDB      *geoip.DB
+	geoDBMutex sync.RWMutex
+	// geoStop stops the running geoip reload job
+	geoStop chan struct{}
+
+	// reanalysisStop stops the running re-analysis job
+	reanalysisStop chan struct{}
+
+	// detectedCampaigns are the campaigns found by the last clustering,
+	// and notifiedCampaigns the IDs of those already published
+	detectedCampaigns []campaign.Campaign
+	notifiedCampaigns map[string]bool
+	campaignsMutex    sync.RWMutex
+	// campaignsStop stops the running campaign detection job
+	campaignsStop chan struct{}
+
+	// learner builds the endpoint baselines, nil if learning is disabled
+	learner atomic.Pointer[baseline.Learner]
+}
+
+// defaultCore is the instance set up by Init
+var defaultCore = newCore("", "", nil)
+
+// Sync map with the core of each open or recently closed transaction not
+// using the default one
+var transactionCores sync.Map
+
+// coreOf returns the core the transaction was initialized with
+func coreOf(transactionID string) *Core {
+	if value, ok := transactionCores.Load(transactionID); ok {
+		return value.(*Core)
+	}
+	return defaultCore
+}
+
+// newCore creates a core without plugins, named name and using conf,
+// or the configuration of the configstore if nil
+func newCore(name, prefix string, conf *cf.ConfigStore) *Core {
+	c := &Core{
+		name:           name,
+		prefix:         prefix,
+		conf:           conf,
+		recentlyClosed: &closedTransactions{ids: make(map[string]struct{})},
+		shadowStats:    make(map[[2]string]*shadowTotals),
+	}
+	if name != "" {
+		c.attributes = []attribute.KeyValue{attribute.String("engine", name)}
+	}
+	c.counters.since = time.Now()
+	return c
+}
+
+// NewCore creates a WACE instance named name, loading the plugins of
+// conf, recording its metrics with met and an engine attribute, and
+// starting the background jobs of conf. The names of the cores of a
+// process must be distinct, as they keep their state store keys under
+// their name. Async and
+// remote models are reached through the NATS subjects named after their
+// IDs, so they need distinct IDs across cores.
+func NewCore(name string, conf *cf.ConfigStore, met metric.Meter) *Core {
+	return newCore(name, name+"/", conf).load(met)
+}
+
+// load loads the plugins of the core, recording their metrics with
+// met, and starts its background jobs
+func (c *Core) load(met metric.Meter) *Core {
+	c.swap(newPluginSet(pm.NewWithConfig(met, c.conf), met))
+	c.startJobs()
+	return c
+}
+
+// startJobs starts the baseline learning and the background jobs of the
+// configuration of the core, stopping the previous ones
+func (c *Core) startJobs() {
+	conf := c.config()
+	var learner *baseline.Learner
+	if conf.Learning {
+		learner = baseline.NewLearner(c.stateStore(), conf.LearningPeriod)
+		lg.Get().Printf(lg.INFO, "Learning endpoint baselines for %v", conf.LearningPeriod)
+	}
+	c.learner.Store(learner)
+	c.startReanalysis()
+	c.startCampaigns()
+	c.startExport()
+	c.startWebhooks()
+	c.startAudit()
+	c.startGeoIP()
+}
+
+// scope returns the ID of the transaction outside of the core, in the
+// logs, the plugins and the exports
+func (c *Core) scope(transactionID string) string {
+	return c.prefix + transactionID
+}
+
+// config returns the configuration of the core
+func (c *Core) config() *cf.ConfigStore {
+	if c.conf == nil {
+		return cf.Snapshot()
+	}
+	return c.conf
+}
+
+// Name returns the name of the core, empty for the default one
+func (c *Core) Name() string {
+	return c.name
+}
+
+// Config returns the configuration of the core
+func (c *Core) Config() *cf.ConfigStore {
+	return c.config()
+}
@@ -0,0 +1,91 @@
+package wace
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	"gopkg.in/yaml.v3"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// newTestCore creates a core whose waf decision blocks above threshold
+func newTestCore(t *testing.T, name, threshold string) *Core {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: protocol
+    kind: builtin
+    plugintype: RequestHeaders
+decisionplugins:
+  - id: waf
+    kind: builtin
+    params:
+      threshold: "`+threshold+`"
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	return NewCore(name, conf, testMeter)
+}
+
+func TestCores(t *testing.T) {
+	strict, lenient := newTestCore(t, "strict", "3"), newTestCore(t, "lenient", "10")
+	wafParams := map[string]string{"inbound_detection": "5"}
+
+	// both cores see the same transaction ID
+	id := generateRandomID()
+	for _, c := range []*Core{strict, lenient} {
+		c.InitTransaction(id)
+		defer c.CloseTransaction(id)
+		if err := c.Analyze("RequestHeaders", id, "GET / HTTP/1.1\nHost: example.com\n", []string{"protocol"}); err != nil {
+			t.Fatalf("%s Analyze returned error: %v", c.Name(), err)
+		}
+	}
+	for c, want := range map[*Core]bool{strict: true, lenient: false} {
+		verdict, err := c.CheckTransactionVerdict(id, "waf", wafParams)
+		if err != nil {
+			t.Fatalf("%s CheckTransactionVerdict returned error: %v", c.Name(), err)
+		}
+		if verdict.Block != want {
+			t.Errorf("%s core blocked: %t", c.Name(), verdict.Block)
+		}
+		if status := c.Status(); status.ActiveTransactions != 1 || len(status.ModelPlugins) != 1 {
+			t.Errorf("%s core status is %+v", c.Name(), status)
+		}
+	}
+
+	// the state of the transactions is kept per core
+	strict.SetTransactionMetadata(id, map[string]string{"route": "login"})
+	if meta := lenient.TransactionMetadata(id); meta["route"] != "" {
+		t.Errorf("metadata of the strict core seen by the lenient one: %v", meta)
+	}
+	if n := lenient.MetricsSnapshot().Transactions; n != 1 {
+		t.Errorf("%d transactions counted by the lenient core, want 1", n)
+	}
+
+	// the log lines carry the ID of the transaction outside of the core
+	var buf bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&buf)
+	strict.tprintf(lg.ERROR, id, "core | scoped line")
+	log.SetOutput(previous)
+	if line := buf.String(); !strings.Contains(line, "| strict/"+id+" | core | scoped line") || strings.Contains(line, "Cannot find transaction") {
+		t.Errorf("strict core logged %q", line)
+	}
+
+	results, err := strict.AnalyzeSync("RequestHeaders", "GET / HTTP/1.1\n", []string{"protocol"})
+	if err != nil || len(results) != 1 {
+		t.Errorf("AnalyzeSync returned %v, %v", results, err)
+	}
+}
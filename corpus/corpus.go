@@ -0,0 +1,147 @@
+/*
+Package corpus is a curated corpus of benign and attack HTTP requests,
+with helpers to run it through a configured WACE pipeline in tests and
+to seed fuzz tests with it, so that plugin authors and changes of the
+core get detection regression feedback in CI.
+
+The requests are the files of testdata/attack and testdata/benign, one
+request line and headers, an empty line and a body per file. The name
+of an attack file starts with its category, as in sqli-union-query.http.
+A test of a model plugin typically runs:
+
+	core := wace.NewCore("corpus", conf, meter)
+	report := corpus.Run(core, "combiner", corpus.Samples())
+	corpus.Check(t, report, corpus.Expectation{MinDetectionRate: 0.9})
+*/
+package corpus
+
+import (
+	"embed"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+//go:embed testdata
+var files embed.FS
+
+// Sample is a request of the corpus
+type Sample struct {
+	// Name is the path of the file of the sample in testdata, without
+	// its extension, such as attack/sqli-union-query
+	Name string
+	// Attack is true if the request carries an attack payload
+	Attack bool
+	// Category is the category of the attack, such as sqli or xss, and
+	// is empty for the benign requests
+	Category string
+	// Headers are the request line and headers, as given to the
+	// RequestHeaders models
+	Headers string
+	// Body is the request body, as given to the RequestBody models
+	Body string
+}
+
+// Payload returns the payload of the sample for the models of the
+// given part, and false if the corpus has none for the part
+func (s Sample) Payload(part cf.ModelPluginType) (string, bool) {
+	switch part {
+	case cf.RequestHeaders:
+		return s.Headers, true
+	case cf.RequestBody:
+		return s.Body, s.Body != ""
+	case cf.AllRequest:
+		return s.Headers + "\n" + s.Body, true
+	}
+	return "", false
+}
+
+// samples is the corpus, read once from the embedded files
+var samples = readSamples()
+
+// readSamples reads the samples of the embedded files, sorted by name
+func readSamples() []Sample {
+	var all []Sample
+	err := fs.WalkDir(files, "testdata", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(name) != ".http" {
+			return err
+		}
+		content, err := files.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		all = append(all, parseSample(strings.TrimSuffix(strings.TrimPrefix(name, "testdata/"), ".http"), string(content)))
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// parseSample returns the sample of the given name and file content
+func parseSample(name, content string) Sample {
+	s := Sample{Name: name, Attack: strings.HasPrefix(name, "attack/")}
+	if s.Attack {
+		s.Category, _, _ = strings.Cut(path.Base(name), "-")
+	}
+	// the files may have been checked out with CRLF line endings
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	headers, body, _ := strings.Cut(content, "\n\n")
+	s.Headers, s.Body = headers+"\n", body
+	return s
+}
+
+// Samples returns all the samples of the corpus, sorted by name
+func Samples() []Sample {
+	return append([]Sample(nil), samples...)
+}
+
+// Attacks returns the attack samples of the corpus of the given
+// categories, or of all categories if none is given
+func Attacks(categories ...string) []Sample {
+	var attacks []Sample
+	for _, s := range samples {
+		if s.Attack && (len(categories) == 0 || containsString(categories, s.Category)) {
+			attacks = append(attacks, s)
+		}
+	}
+	return attacks
+}
+
+// Benign returns the benign samples of the corpus
+func Benign() []Sample {
+	var benign []Sample
+	for _, s := range samples {
+		if !s.Attack {
+			benign = append(benign, s)
+		}
+	}
+	return benign
+}
+
+// Categories returns the sorted attack categories of the corpus
+func Categories() []string {
+	var categories []string
+	for _, s := range samples {
+		if s.Attack && !containsString(categories, s.Category) {
+			categories = append(categories, s.Category)
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// containsString returns true if the slice contains the value
+func containsString(slice []string, value string) bool {
+	for _, s := range slice {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
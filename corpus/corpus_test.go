@@ -0,0 +1,118 @@
+package corpus
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	wace "github.com/tiroa-tilsor/wacelib"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+	"github.com/tiroa-tilsor/wacelib/protocol"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func TestMain(m *testing.M) {
+	lg.Get().LoadLoggerWriter(io.Discard, lg.ERROR)
+	os.Exit(m.Run())
+}
+
+func TestSamples(t *testing.T) {
+	all := Samples()
+	if len(all) != len(Attacks())+len(Benign()) || len(Attacks()) == 0 || len(Benign()) == 0 {
+		t.Fatalf("%d samples, %d attacks and %d benign", len(all), len(Attacks()), len(Benign()))
+	}
+	for _, s := range all {
+		if !strings.HasPrefix(s.Headers, "GET ") && !strings.HasPrefix(s.Headers, "POST ") || !strings.HasSuffix(s.Headers, "\n") {
+			t.Errorf("sample %s has headers %q", s.Name, s.Headers)
+		}
+		if s.Attack == (s.Category == "") {
+			t.Errorf("sample %s is an attack %v of category %q", s.Name, s.Attack, s.Category)
+		}
+		if whole, _ := s.Payload(cf.AllRequest); !strings.HasSuffix(whole, "\n\n"+s.Body) {
+			t.Errorf("sample %s has request %q", s.Name, whole)
+		}
+	}
+	if sqli := Attacks("sqli"); len(sqli) != 3 || sqli[0].Name != "attack/sqli-tautology-body" || sqli[0].Body == "" {
+		t.Errorf("sqli attacks are %+v", sqli)
+	}
+	if categories := Categories(); len(categories) < 5 || categories[0] != "crlf" {
+		t.Errorf("categories are %v", categories)
+	}
+}
+
+// signatures is the pattern of the signature model of the tests
+var signatures = regexp.MustCompile(`(?i)union\s*select|'\s*or\s*'|sleep\(|<script|onerror=|\.\./|;\s*cat\s|\$\{jndi:|169\.254\.169\.254|<!entity|php://|"\$ne"|\r\n[\w-]+:`)
+
+func TestRun(t *testing.T) {
+	err := pm.RegisterModel("corpussignatures", nil, func(input pm.ModelInput) (pm.ModelResults, error) {
+		payload, err := url.QueryUnescape(input.Payload)
+		if err != nil {
+			payload = input.Payload
+		}
+		if signatures.MatchString(payload) {
+			return pm.ModelResults{ProbAttack: 1}, nil
+		}
+		return pm.ModelResults{}, nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterModel returned error: %v", err)
+	}
+	inConf, err := cf.ParseConfig([]byte(`---
+logpath: /dev/null
+loglevel: ERROR
+modelplugins:
+  - id: headers
+    kind: builtin
+    builtin: corpussignatures
+    plugintype: RequestHeaders
+    weight: 1
+  - id: body
+    kind: builtin
+    builtin: corpussignatures
+    plugintype: RequestBody
+    weight: 1
+decisionplugins:
+  - id: combiner
+    kind: builtin
+    params:
+      threshold: "0.4"
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig returned error: %v", err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	core := wace.NewCore("corpus", conf, noop.NewMeterProvider().Meter("corpus"))
+
+	report := Run(core, "combiner", Samples())
+	if len(report.Results) != len(Samples()) || report.DetectionRate() != 1 || report.FalsePositiveRate() != 0 {
+		t.Errorf("report is %v, missed %s, false positives %s", report, names(report.Missed()), names(report.FalsePositives()))
+	}
+	if rates := report.CategoryRates(); len(rates) != len(Categories()) || rates["xss"] != 1 {
+		t.Errorf("category rates are %v", rates)
+	}
+	Check(t, report, Expectation{MinDetectionRate: 1})
+
+	report = Run(core, "unknown", Attacks("xss"))
+	if len(report.Errors()) != 2 || report.DetectionRate() != 0 {
+		t.Errorf("report with an unknown decision plugin is %v", report)
+	}
+}
+
+func FuzzProtocolCheck(f *testing.F) {
+	Seed(f)
+	f.Fuzz(func(t *testing.T, headers, body string) {
+		score := protocol.Score(protocol.Check(headers, protocol.DefaultLimits))
+		if score < 0 || score > 1 {
+			t.Errorf("score %v of %q", score, headers)
+		}
+	})
+}
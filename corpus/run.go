@@ -0,0 +1,210 @@
+package corpus
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	wace "github.com/tiroa-tilsor/wacelib"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+// parts are the parts of a transaction the samples are analyzed as
+var parts = []cf.ModelPluginType{cf.RequestHeaders, cf.RequestBody, cf.AllRequest}
+
+// Result is the outcome of the pipeline on a sample
+type Result struct {
+	Sample  Sample
+	Verdict wace.Verdict
+	// Err is the error of the analysis or the check of the sample
+	Err error
+}
+
+// Detected returns true if the pipeline blocked or challenged the
+// sample
+func (r Result) Detected() bool {
+	return r.Err == nil && (r.Verdict.Block || r.Verdict.Challenge)
+}
+
+// Report is the outcome of the pipeline on samples of the corpus
+type Report struct {
+	Results []Result
+}
+
+// Missed returns the results of the attack samples not detected
+func (r Report) Missed() []Result {
+	var missed []Result
+	for _, res := range r.Results {
+		if res.Err == nil && res.Sample.Attack && !res.Detected() {
+			missed = append(missed, res)
+		}
+	}
+	return missed
+}
+
+// FalsePositives returns the results of the benign samples detected
+func (r Report) FalsePositives() []Result {
+	var falsePositives []Result
+	for _, res := range r.Results {
+		if !res.Sample.Attack && res.Detected() {
+			falsePositives = append(falsePositives, res)
+		}
+	}
+	return falsePositives
+}
+
+// Errors returns the results of the samples the pipeline failed on
+func (r Report) Errors() []Result {
+	var errors []Result
+	for _, res := range r.Results {
+		if res.Err != nil {
+			errors = append(errors, res)
+		}
+	}
+	return errors
+}
+
+// DetectionRate returns the fraction of the attack samples detected,
+// and 1 if there is none
+func (r Report) DetectionRate() float64 {
+	attacks, detected := 0, 0
+	for _, res := range r.Results {
+		if res.Sample.Attack {
+			attacks++
+			if res.Detected() {
+				detected++
+			}
+		}
+	}
+	if attacks == 0 {
+		return 1
+	}
+	return float64(detected) / float64(attacks)
+}
+
+// FalsePositiveRate returns the fraction of the benign samples
+// detected, and 0 if there is none
+func (r Report) FalsePositiveRate() float64 {
+	benign := 0
+	for _, res := range r.Results {
+		if !res.Sample.Attack {
+			benign++
+		}
+	}
+	if benign == 0 {
+		return 0
+	}
+	return float64(len(r.FalsePositives())) / float64(benign)
+}
+
+// CategoryRates returns the detection rate of each attack category
+func (r Report) CategoryRates() map[string]float64 {
+	byCategory := make(map[string]Report)
+	for _, res := range r.Results {
+		if res.Sample.Attack {
+			report := byCategory[res.Sample.Category]
+			report.Results = append(report.Results, res)
+			byCategory[res.Sample.Category] = report
+		}
+	}
+	rates := make(map[string]float64, len(byCategory))
+	for category, report := range byCategory {
+		rates[category] = report.DetectionRate()
+	}
+	return rates
+}
+
+// String returns a one line summary of the report
+func (r Report) String() string {
+	return fmt.Sprintf("%d samples, detection rate %.2f, false positive rate %.2f, %d errors",
+		len(r.Results), r.DetectionRate(), r.FalsePositiveRate(), len(r.Errors()))
+}
+
+// runs numbers the transactions of the runs, so that their IDs are
+// unique
+var runs atomic.Int64
+
+// Run analyzes every sample in a transaction of the core with the sync
+// model plugins of the request parts it has, and checks the
+// transaction with the decision plugin. The WAF params are not given,
+// so the decision plugin must not require them.
+func Run(core *wace.Core, decision string, samples []Sample) Report {
+	conf := core.Config()
+	models := make(map[cf.ModelPluginType][]string)
+	for id, modelConfig := range conf.ModelPlugins {
+		if !conf.IsAsync(id) {
+			models[modelConfig.PluginType] = append(models[modelConfig.PluginType], id)
+		}
+	}
+	for _, ids := range models {
+		sort.Strings(ids)
+	}
+
+	report := Report{Results: make([]Result, len(samples))}
+	for i, sample := range samples {
+		id := fmt.Sprintf("corpus-%d", runs.Add(1))
+		res := Result{Sample: sample}
+		core.InitTransaction(id)
+		for _, part := range parts {
+			payload, ok := sample.Payload(part)
+			if !ok || len(models[part]) == 0 {
+				continue
+			}
+			if res.Err = core.Analyze(part.String(), id, payload, models[part]); res.Err != nil {
+				break
+			}
+		}
+		if res.Err == nil {
+			res.Verdict, res.Err = core.CheckTransactionVerdict(id, decision, nil)
+		}
+		core.CloseTransaction(id)
+		report.Results[i] = res
+	}
+	return report
+}
+
+// Expectation are the detection performances required by Check
+type Expectation struct {
+	// MinDetectionRate is the lowest fraction of attack samples to
+	// detect
+	MinDetectionRate float64
+	// MaxFalsePositiveRate is the highest fraction of benign samples
+	// allowed to be detected
+	MaxFalsePositiveRate float64
+}
+
+// Check fails the test if the pipeline failed on a sample of the
+// report, or if it did not meet the expectation, naming the samples
+// missed and the false positives
+func Check(t testing.TB, report Report, expect Expectation) {
+	t.Helper()
+	for _, res := range report.Errors() {
+		t.Errorf("sample %s: %v", res.Sample.Name, res.Err)
+	}
+	if rate := report.DetectionRate(); rate < expect.MinDetectionRate {
+		t.Errorf("detection rate %.2f under %.2f, missed %s", rate, expect.MinDetectionRate, names(report.Missed()))
+	}
+	if rate := report.FalsePositiveRate(); rate > expect.MaxFalsePositiveRate {
+		t.Errorf("false positive rate %.2f over %.2f, detected %s", rate, expect.MaxFalsePositiveRate, names(report.FalsePositives()))
+	}
+}
+
+// names returns the comma separated names of the samples of the results
+func names(results []Result) string {
+	names := make([]string, len(results))
+	for i, res := range results {
+		names[i] = res.Sample.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// Seed adds the headers and the body of every sample of the corpus to
+// the seed corpus of a fuzz test, whose fuzz function takes them as two
+// string arguments
+func Seed(f *testing.F) {
+	for _, s := range samples {
+		f.Add(s.Headers, s.Body)
+	}
+}
@@ -0,0 +1,246 @@
+package wace
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// redactedValue replaces the values of sensitive headers and
+// parameters in captured payloads
+const redactedValue = "[REDACTED]"
+
+// DebugEntry is a single log line recorded for a debug transaction
+type DebugEntry struct {
+	Time    time.Time
+	Level   string
+	Message string
+}
+
+// DebugPayload is a (redacted) payload received by Analyze for a debug
+// transaction
+type DebugPayload struct {
+	Time    time.Time
+	Type    string
+	Models  []string
+	Payload string
+}
+
+// DebugBundle contains everything recorded for a debug transaction:
+// the log lines at every level, the redacted payloads, the model
+// results and the verdicts returned by CheckTransaction.
+type DebugBundle struct {
+	TransactionID string
+	Started       time.Time
+	Entries       []DebugEntry
+	Payloads      []DebugPayload
+	Results       map[string]pm.ModelResults
+	Verdicts      []bool
+}
+
+// debugTrace guards the bundle of a debug transaction
+type debugTrace struct {
+	mutex  sync.Mutex
+	bundle DebugBundle
+}
+
+// enableDebug marks the transaction as debug. It does nothing if the
+// transaction is already marked.
+func (c *Core) enableDebug(transactionID string) {
+	trace := &debugTrace{bundle: DebugBundle{TransactionID: transactionID, Started: time.Now()}}
+	if _, loaded := c.debugMap.LoadOrStore(transactionID, trace); !loaded {
+		c.tprintf(lg.INFO, transactionID, "core | debug tracing enabled for transaction")
+	}
+}
+
+// getTrace returns the debug trace of the transaction, or nil if the
+// transaction is not marked as debug
+func (c *Core) getTrace(transactionID string) *debugTrace {
+	value, ok := c.debugMap.Load(transactionID)
+	if !ok {
+		return nil
+	}
+	return value.(*debugTrace)
+}
+
+// IsDebugTransaction returns true if the transaction is marked as debug
+func IsDebugTransaction(transactionID string) bool {
+	return coreOf(transactionID).IsDebugTransaction(transactionID)
+}
+
+// IsDebugTransaction is like the IsDebugTransaction function
+func (c *Core) IsDebugTransaction(transactionID string) bool {
+	return c.getTrace(transactionID) != nil
+}
+
+// GetDebugBundle returns a copy of the debug bundle of the given
+// transaction. It must be called before CloseTransaction, which
+// discards the bundle.
+func GetDebugBundle(transactionID string) (DebugBundle, error) {
+	return coreOf(transactionID).GetDebugBundle(transactionID)
+}
+
+// GetDebugBundle is like the GetDebugBundle function
+func (c *Core) GetDebugBundle(transactionID string) (DebugBundle, error) {
+	trace := c.getTrace(transactionID)
+	if trace == nil {
+		return DebugBundle{}, fmt.Errorf("transaction %s is not a debug transaction", transactionID)
+	}
+	trace.mutex.Lock()
+	defer trace.mutex.Unlock()
+	bundle := trace.bundle
+	bundle.Entries = append([]DebugEntry(nil), trace.bundle.Entries...)
+	bundle.Payloads = append([]DebugPayload(nil), trace.bundle.Payloads...)
+	bundle.Verdicts = append([]bool(nil), trace.bundle.Verdicts...)
+	bundle.Results = make(map[string]pm.ModelResults, len(trace.bundle.Results))
+	for k, v := range trace.bundle.Results {
+		bundle.Results[k] = v
+	}
+	return bundle, nil
+}
+
+// tprintf logs a transaction message. For debug transactions the
+// message, redacted like the payloads as it can quote them, is also
+// recorded in the debug bundle, and written to the log even if its
+// level is above the configured log level. The lines carry the ID of
+// the transaction outside of the core.
+func (c *Core) tprintf(level lg.LogLevel, transactionID, format string, v ...interface{}) {
+	logger := lg.Get()
+	trace := c.getTrace(transactionID)
+	if trace == nil {
+		logger.TPrintf(level, c.scope(transactionID), format, v...)
+		return
+	}
+	conf := c.config()
+	msg := redactPayload(fmt.Sprintf(format, v...), conf.DebugRedact)
+	trace.mutex.Lock()
+	trace.bundle.Entries = append(trace.bundle.Entries, DebugEntry{Time: time.Now(), Level: level.String(), Message: msg})
+	trace.mutex.Unlock()
+
+	if level > conf.LogLevel {
+		// ERROR is never filtered out by the logger
+		logger.Printf(lg.ERROR, "| %s | [debug transaction] %s", c.scope(transactionID), msg)
+	}
+	logger.TPrintf(level, c.scope(transactionID), "%s", msg)
+}
+
+// debugCapturePayload stores the redacted payload in the debug bundle
+func (c *Core) debugCapturePayload(transactionID, modelsType, payload string, models []string) {
+	trace := c.getTrace(transactionID)
+	if trace == nil {
+		return
+	}
+	redacted := redactPayload(payload, c.config().DebugRedact)
+	trace.mutex.Lock()
+	trace.bundle.Payloads = append(trace.bundle.Payloads, DebugPayload{
+		Time:    time.Now(),
+		Type:    modelsType,
+		Models:  append([]string(nil), models...),
+		Payload: redacted,
+	})
+	trace.mutex.Unlock()
+}
+
+// debugRecordVerdict stores the model results and the verdict of a
+// CheckTransaction call in the debug bundle
+func (c *Core) debugRecordVerdict(transactionID string, results map[string]pm.ModelResults, block bool) {
+	trace := c.getTrace(transactionID)
+	if trace == nil {
+		return
+	}
+	trace.mutex.Lock()
+	if trace.bundle.Results == nil {
+		trace.bundle.Results = make(map[string]pm.ModelResults)
+	}
+	for k, v := range results {
+		trace.bundle.Results[k] = v
+	}
+	trace.bundle.Verdicts = append(trace.bundle.Verdicts, block)
+	trace.mutex.Unlock()
+}
+
+// debugRequested returns true if the payload carries the configured
+// debug header (with the configured token, if any)
+func (c *Core) debugRequested(modelsType cf.ModelPluginType, payload string) bool {
+	conf := c.config()
+	if conf.DebugHeader == "" {
+		return false
+	}
+	if modelsType != cf.RequestHeaders && modelsType != cf.AllRequest && modelsType != cf.Everything {
+		return false
+	}
+	for _, line := range strings.Split(payload, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			// end of the headers section
+			break
+		}
+		name, value, found := strings.Cut(line, ":")
+		if !found || !strings.EqualFold(strings.TrimSpace(name), conf.DebugHeader) {
+			continue
+		}
+		return conf.DebugToken == "" || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(value)), []byte(conf.DebugToken)) == 1
+	}
+	return false
+}
+
+// redactPayload replaces the values of the headers and the
+// (query or url-encoded body) parameters whose names appear in keys
+func redactPayload(payload string, keys []string) string {
+	if len(keys) == 0 {
+		return payload
+	}
+	sensitive := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		sensitive[strings.ToLower(k)] = true
+	}
+
+	lines := strings.Split(payload, "\n")
+	for i, line := range lines {
+		if name, _, found := strings.Cut(line, ":"); found && !strings.ContainsAny(name, " =&?") {
+			if sensitive[strings.ToLower(strings.TrimSpace(name))] {
+				lines[i] = name + ": " + redactedValue
+				continue
+			}
+		}
+		lines[i] = redactParams(line, sensitive)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// redactParams redacts the values of the sensitive name=value pairs
+// found in the line
+func redactParams(line string, sensitive map[string]bool) string {
+	if !strings.Contains(line, "=") {
+		return line
+	}
+	var b strings.Builder
+	start := 0
+	for i := 0; i <= len(line); i++ {
+		if i < len(line) && !strings.ContainsRune("&? ;", rune(line[i])) {
+			continue
+		}
+		b.WriteString(redactPair(line[start:i], sensitive))
+		if i < len(line) {
+			b.WriteByte(line[i])
+		}
+		start = i + 1
+	}
+	return b.String()
+}
+
+// redactPair redacts a single name=value pair if name is sensitive
+func redactPair(pair string, sensitive map[string]bool) string {
+	name, _, found := strings.Cut(pair, "=")
+	if found && sensitive[strings.ToLower(strings.TrimSpace(name))] {
+		return name + "=" + redactedValue
+	}
+	return pair
+}
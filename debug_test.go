@@ -0,0 +1,90 @@
+package wace
+
+import (
+	"strings"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+func TestRedactPayload(t *testing.T) {
+	payload := "POST /login?user=bob&token=s3cr3t HTTP/1.1\n" +
+		"Host: example.com\n" +
+		"Authorization: Bearer abcdef\n" +
+		"Cookie: session=xyz\n" +
+		"\n" +
+		"user=bob&password=hunter2\n"
+
+	redacted := redactPayload(payload, []string{"authorization", "cookie", "password", "token"})
+
+	for _, secret := range []string{"s3cr3t", "abcdef", "xyz", "hunter2"} {
+		if strings.Contains(redacted, secret) {
+			t.Errorf("redacted payload still contains %q:\n%s", secret, redacted)
+		}
+	}
+	for _, kept := range []string{"user=bob", "Host: example.com", "POST /login?"} {
+		if !strings.Contains(redacted, kept) {
+			t.Errorf("redacted payload should contain %q:\n%s", kept, redacted)
+		}
+	}
+}
+
+func TestDebugRequested(t *testing.T) {
+	cf.Update(func(conf *cf.ConfigStore) error {
+		conf.DebugHeader = "X-Wace-Debug"
+		conf.DebugToken = "letmein"
+		return nil
+	})
+	defer cf.Update(func(conf *cf.ConfigStore) error {
+		conf.DebugHeader = ""
+		conf.DebugToken = ""
+		return nil
+	})
+
+	headers := "GET / HTTP/1.1\nHost: example.com\nx-wace-debug: letmein\n"
+	if !defaultCore.debugRequested(cf.RequestHeaders, headers) {
+		t.Errorf("debug header with valid token not detected")
+	}
+	if defaultCore.debugRequested(cf.RequestHeaders, "GET / HTTP/1.1\nX-Wace-Debug: wrong\n") {
+		t.Errorf("debug header with invalid token enables debug")
+	}
+	if defaultCore.debugRequested(cf.ResponseHeaders, headers) {
+		t.Errorf("debug header detected in a response")
+	}
+}
+
+func TestDebugBundle(t *testing.T) {
+	transactionID := generateRandomID()
+	cf.Update(func(conf *cf.ConfigStore) error {
+		conf.DebugRedact = []string{"cookie", "token"}
+		return nil
+	})
+	defaultCore.enableDebug(transactionID)
+	defer defaultCore.debugMap.Delete(transactionID)
+
+	defaultCore.debugCapturePayload(transactionID, "RequestHeaders", "Cookie: a=b\n", []string{"trivial"})
+	defaultCore.tprintf(lg.DEBUG, transactionID, "core | analyzing %s: [%s...]", "RequestHeaders", "GET /?token=s3cret HTTP/1.1")
+	defaultCore.debugRecordVerdict(transactionID, nil, true)
+
+	bundle, err := GetDebugBundle(transactionID)
+	if err != nil {
+		t.Fatalf("GetDebugBundle returned error: %v", err)
+	}
+	if len(bundle.Payloads) != 1 || strings.Contains(bundle.Payloads[0].Payload, "a=b") {
+		t.Errorf("unexpected captured payloads: %+v", bundle.Payloads)
+	}
+	for _, entry := range bundle.Entries {
+		if strings.Contains(entry.Message, "s3cret") {
+			t.Errorf("debug entry not redacted: %s", entry.Message)
+		}
+	}
+	if len(bundle.Verdicts) != 1 || !bundle.Verdicts[0] {
+		t.Errorf("unexpected verdicts: %v", bundle.Verdicts)
+	}
+
+	if _, err := GetDebugBundle(generateRandomID()); err == nil {
+		t.Errorf("GetDebugBundle of a non debug transaction does not return an error")
+	}
+}
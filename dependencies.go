@@ -0,0 +1,115 @@
+package wace
+
+import (
+	"fmt"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+)
+
+// dependencyScheduler orders the sync model plugins of an Analyze call
+// by their dependencies. A model is started once all its dependencies
+// called with it have succeeded, and fails without being called if any
+// of them fails. Dependencies not called with it must have succeeded
+// earlier in the transaction.
+type dependencyScheduler struct {
+	conf *cf.ConfigStore
+	// waiting maps the models not started yet to their dependencies
+	// not finished yet
+	waiting map[string][]string
+	// dependents maps each model to the models waiting for it
+	dependents map[string][]string
+}
+
+// newDependencyScheduler schedules the sync models of a call of the
+// transaction. It returns the models to start right away, and the failures
+// of the models whose dependencies were not analyzed.
+func newDependencyScheduler(conf *cf.ConfigStore, plugins *pm.PluginManager, transactionId string, models []string) (*dependencyScheduler, []string, []pm.ModelStatus) {
+	s := &dependencyScheduler{
+		conf:       conf,
+		waiting:    make(map[string][]string),
+		dependents: make(map[string][]string),
+	}
+	called := make(map[string]bool, len(models))
+	for _, id := range models {
+		called[id] = true
+	}
+	var analyzed map[string]pm.ModelResults
+	var ready []string
+	var failed []pm.ModelStatus
+	for _, id := range models {
+		var pending []string
+		var missing string
+		for _, dep := range conf.ModelPlugins[id].DependsOn {
+			if called[dep] {
+				pending = append(pending, dep)
+				continue
+			}
+			if analyzed == nil {
+				analyzed, _ = plugins.TransactionResults(transactionId)
+			}
+			if _, ok := analyzed[dep]; !ok {
+				missing = dep
+				break
+			}
+		}
+		switch {
+		case missing != "":
+			failed = append(failed, pm.ModelStatus{ModelID: id, Err: fmt.Errorf("dependency %s not analyzed", missing)})
+		case len(pending) == 0:
+			ready = append(ready, id)
+		default:
+			s.waiting[id] = pending
+			for _, dep := range pending {
+				s.dependents[dep] = append(s.dependents[dep], id)
+			}
+		}
+	}
+	for _, status := range failed {
+		_, more := s.finish(status.ModelID, false)
+		failed = append(failed, more...)
+	}
+	return s, ready, failed
+}
+
+// finish records the end of a model. It returns the models that can
+// be started, and the failures of the models depending on it when it
+// failed, transitively.
+func (s *dependencyScheduler) finish(id string, succeeded bool) ([]string, []pm.ModelStatus) {
+	var ready []string
+	var failed []pm.ModelStatus
+	for _, dependent := range s.dependents[id] {
+		pending, ok := s.waiting[dependent]
+		if !ok {
+			continue
+		}
+		if !succeeded {
+			delete(s.waiting, dependent)
+			failed = append(failed, pm.ModelStatus{ModelID: dependent, Err: fmt.Errorf("dependency %s failed", id)})
+			more, moreFailed := s.finish(dependent, false)
+			ready = append(ready, more...)
+			failed = append(failed, moreFailed...)
+			continue
+		}
+		pending = removeString(pending, id)
+		if len(pending) == 0 {
+			delete(s.waiting, dependent)
+			ready = append(ready, dependent)
+		} else {
+			s.waiting[dependent] = pending
+		}
+	}
+	delete(s.dependents, id)
+	return ready, failed
+}
+
+// removeString returns values without the occurrences of value
+func removeString(values []string, value string) []string {
+	var kept []string
+	for _, v := range values {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,159 @@
+package wace
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestDependencyScheduler(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: tokens
+    kind: builtin
+    builtin: protocol
+    plugintype: RequestHeaders
+  - id: classifier
+    kind: builtin
+    builtin: protocol
+    plugintype: RequestHeaders
+    dependson: [tokens]
+  - id: ensemble
+    kind: builtin
+    builtin: protocol
+    plugintype: RequestHeaders
+    dependson: [classifier, tokens]
+  - id: bodytokens
+    kind: builtin
+    builtin: protocol
+    plugintype: RequestBody
+  - id: crosspart
+    kind: builtin
+    builtin: protocol
+    plugintype: RequestHeaders
+    dependson: [bodytokens]
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	plugins := pm.NewWithConfig(testMeter, conf)
+	plugins.InitTransaction("tx")
+	defer plugins.CloseTransaction("tx")
+
+	s, ready, failed := newDependencyScheduler(conf, plugins, "tx", []string{"tokens", "classifier", "ensemble", "crosspart"})
+	if len(ready) != 1 || ready[0] != "tokens" {
+		t.Errorf("models started first are %v", ready)
+	}
+	if len(failed) != 1 || failed[0].ModelID != "crosspart" {
+		t.Errorf("models failed first are %+v", failed)
+	}
+
+	ready, failed = s.finish("tokens", true)
+	if len(ready) != 1 || ready[0] != "classifier" || len(failed) != 0 {
+		t.Errorf("after tokens, %v are started and %+v failed", ready, failed)
+	}
+	ready, failed = s.finish("classifier", false)
+	if len(ready) != 0 || len(failed) != 1 || failed[0].ModelID != "ensemble" {
+		t.Errorf("after classifier failed, %v are started and %+v failed", ready, failed)
+	}
+}
+
+func TestAnalyzeDependencies(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: tokens
+    kind: builtin
+    builtin: protocol
+    plugintype: RequestHeaders
+  - id: classifier
+    kind: builtin
+    builtin: protocol
+    plugintype: RequestHeaders
+    dependson: [tokens]
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("dependencies", conf, testMeter)
+	id := generateRandomID()
+	engine.InitTransaction(id)
+	defer CloseTransaction(id)
+
+	Analyze("RequestHeaders", id, "GET / HTTP/1.1\nHost: example.com\n", []string{"classifier", "tokens"})
+	if err := engine.waitAnalysis(id); err != nil {
+		t.Fatalf("waitAnalysis returned error: %v", err)
+	}
+	results, _ := engine.plugins.Load().manager.TransactionResults(engine.scope(id))
+	if _, ok := results["classifier"]; !ok || len(results) != 2 {
+		t.Errorf("results of the analysis are %v", results)
+	}
+}
+
+func TestRequiredPlugins(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: ensemble
+    kind: builtin
+    builtin: protocol
+    plugintype: RequestHeaders
+    requires: [tokens]
+  - id: tokens
+    kind: builtin
+    builtin: protocol
+    plugintype: RequestHeaders
+  - id: broken
+    kind: builtin
+    builtin: nosuchmodel
+    plugintype: RequestHeaders
+  - id: classifier
+    kind: builtin
+    builtin: protocol
+    plugintype: RequestHeaders
+    requires: [broken]
+decisionplugins:
+  - id: combiner
+    kind: builtin
+    requires: [ensemble]
+  - id: strict
+    kind: builtin
+    builtin: combiner
+    requires: [classifier]
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	plugins := pm.NewWithConfig(testMeter, conf)
+	if ids := plugins.ModelPluginIDs(); len(ids) != 2 || ids[0] != "ensemble" || ids[1] != "tokens" {
+		t.Errorf("loaded models are %v", ids)
+	}
+	if ids := plugins.DecisionPluginIDs(); len(ids) != 1 || ids[0] != "combiner" {
+		t.Errorf("loaded decisions are %v", ids)
+	}
+	if e := plugins.LoadError(); e == nil || e.Plugins["classifier"] != "required plugin broken not loaded" || e.Plugins["strict"] != "required plugin classifier not loaded" {
+		t.Errorf("load error is %v", e)
+	}
+}
@@ -0,0 +1,78 @@
+package wace
+
+import (
+	"net"
+	"strings"
+	"sync"
+)
+
+// Router maps Host header values to cores, so a single connector
+// process can serve several independent WACE configurations
+type Router struct {
+	mutex    sync.RWMutex
+	cores    map[string]*Core
+	fallback *Core
+}
+
+// NewRouter creates a router sending the hosts without a core of their
+// own to fallback. A nil fallback is the default core.
+func NewRouter(fallback *Core) *Router {
+	return &Router{cores: make(map[string]*Core), fallback: fallback}
+}
+
+// Handle routes the given hosts to the core. A host starting with "*."
+// matches its subdomains.
+func (r *Router) Handle(c *Core, hosts ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, host := range hosts {
+		r.cores[strings.ToLower(host)] = c
+	}
+}
+
+// Remove stops routing the given hosts
+func (r *Router) Remove(hosts ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, host := range hosts {
+		delete(r.cores, strings.ToLower(host))
+	}
+}
+
+// Route returns the core of the Host header value, ignoring its port
+// and case: the core of the host, else of the closest wildcard domain,
+// else the fallback. A nil core is the default one.
+func (r *Router) Route(host string) *Core {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if c, ok := r.cores[host]; ok {
+		return c
+	}
+	for domain := host; ; {
+		_, parent, found := strings.Cut(domain, ".")
+		if !found {
+			break
+		}
+		if c, ok := r.cores["*."+parent]; ok {
+			return c
+		}
+		domain = parent
+	}
+	return r.fallback
+}
+
+// InitTransaction initializes the transaction with the core of the Host
+// header value and returns the core, nil for the default one
+func (r *Router) InitTransaction(transactionId, host string, opts TransactionOptions) *Core {
+	c := r.Route(host)
+	if c == nil {
+		defaultCore.InitTransactionWithOptions(transactionId, opts)
+	} else {
+		c.InitTransactionWithOptions(transactionId, opts)
+	}
+	return c
+}
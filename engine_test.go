@@ -0,0 +1,118 @@
+package wace
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRouterRoute(t *testing.T) {
+	shop, blog := &Core{name: "shop"}, &Core{name: "blog"}
+	router := NewRouter(nil)
+	router.Handle(shop, "shop.example.com", "*.shop.example.com")
+	router.Handle(blog, "Blog.example.com")
+
+	for host, want := range map[string]*Core{
+		"shop.example.com":         shop,
+		"SHOP.example.com:8443":    shop,
+		"eu.cdn.shop.example.com":  shop,
+		"blog.example.com.":        blog,
+		"example.com":              nil,
+		"[::1]:8080":               nil,
+		"other.shop.example.com.x": nil,
+	} {
+		if got := router.Route(host); got != want {
+			t.Errorf("host %s routed to %v, expected %v", host, got, want)
+		}
+	}
+
+	router.Remove("blog.example.com")
+	if router.Route("blog.example.com") != nil {
+		t.Errorf("removed host still routed")
+	}
+}
+
+func TestRouterCore(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: protocol
+    kind: builtin
+    plugintype: RequestHeaders
+decisionplugins:
+  - id: strict
+    kind: builtin
+    builtin: waf
+    params:
+      threshold: "3"
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if _, ok := cf.Snapshot().DecisionPlugins["strict"]; ok {
+		t.Fatalf("Load applied the configuration")
+	}
+
+	engine := NewCore("strict", conf, testMeter)
+	router := NewRouter(nil)
+	router.Handle(engine, "strict.example.com")
+	id := generateRandomID()
+	if router.InitTransaction(id, "strict.example.com", TransactionOptions{}) != engine {
+		t.Fatalf("transaction not initialized with the engine")
+	}
+	defer CloseTransaction(id)
+
+	Analyze("RequestHeaders", id, "GET / HTTP/1.1\nHost: strict.example.com\n", []string{"protocol"})
+	verdict, err := CheckTransactionVerdict(id, "strict", map[string]string{"inbound_detection": "4"})
+	if err != nil {
+		t.Fatalf("CheckTransactionVerdict returned error: %v", err)
+	}
+	if !verdict.Block {
+		t.Errorf("transaction above the threshold of the engine not blocked")
+	}
+	results, _ := engine.plugins.Load().manager.TransactionResults(engine.scope(id))
+	if _, ok := results["protocol"]; !ok {
+		t.Errorf("model of the engine not called: %v", results)
+	}
+}
+
+func TestCoreDisablePlugin(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: protocol
+    kind: builtin
+    plugintype: RequestHeaders
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("disable", conf, testMeter)
+	if err := engine.DisablePlugin(pm.ModelPluginKind, "protocol", "incident"); err != nil {
+		t.Fatalf("DisablePlugin returned error: %v", err)
+	}
+	id := generateRandomID()
+	engine.InitTransaction(id)
+	defer CloseTransaction(id)
+
+	Analyze("RequestHeaders", id, "GET / HTTP/1.1\nHost: example.com\n", []string{"protocol"})
+	engine.waitAnalysis(id)
+	if results, _ := engine.plugins.Load().manager.TransactionResults(engine.scope(id)); len(results) != 0 {
+		t.Errorf("disabled model plugin returned %v", results)
+	}
+}
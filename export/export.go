@@ -0,0 +1,211 @@
+/*
+Package export streams the outcome of the transactions to analytics
+stores for offline analysis. Records are sampled, reduced to the
+selected fields and written in batches to a Sink, such as ClickHouse or
+rotating JSON lines or Parquet files, from a background goroutine so the request path never
+waits for the store.
+*/
+package export
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// Field names of the exported rows
+const (
+	FieldTransactionID = "transaction_id"
+	FieldTime          = "time"
+	FieldBlock         = "block"
+	FieldDecision      = "decision"
+	FieldScores        = "scores"
+	FieldCategories    = "categories"
+	FieldTags          = "tags"
+	FieldMetadata      = "metadata"
+)
+
+// Fields lists every field of the exported rows
+var Fields = []string{FieldTransactionID, FieldTime, FieldBlock, FieldDecision, FieldScores, FieldCategories, FieldTags, FieldMetadata}
+
+// Record is the outcome of a transaction
+type Record struct {
+	TransactionID string
+	Time          time.Time
+	Block         bool
+	Decision      string
+	Scores        map[string]float64
+	Categories    map[string]float64
+	Tags          []string
+	Metadata      map[string]string
+}
+
+// Row is a record reduced to the selected fields
+type Row map[string]interface{}
+
+// Sink writes batches of rows to a store
+type Sink interface {
+	Write(rows []Row) error
+	Close() error
+}
+
+// Config configures an Exporter
+type Config struct {
+	// SampleRate is the fraction of the transactions exported
+	SampleRate float64
+	// Fields are the exported fields, all of them if empty
+	Fields []string
+	// BatchSize is the number of rows written at once
+	BatchSize int
+	// FlushInterval is the longest time a row waits to be written
+	FlushInterval time.Duration
+	// QueueSize is the number of rows waiting to be written beyond
+	// which new records are dropped
+	QueueSize int
+}
+
+// Exporter batches records and writes them to a sink in the background
+type Exporter struct {
+	sink    Sink
+	conf    Config
+	queue   chan Row
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Int64
+}
+
+// New creates an exporter writing to the sink and starts it
+func New(sink Sink, conf Config) *Exporter {
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 1000
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = 10 * time.Second
+	}
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = 10 * conf.BatchSize
+	}
+	if len(conf.Fields) == 0 {
+		conf.Fields = Fields
+	}
+	e := &Exporter{
+		sink:  sink,
+		conf:  conf,
+		queue: make(chan Row, conf.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// Export queues the record to be written if its transaction is
+// sampled. It never blocks: records are dropped when the queue is full.
+func (e *Exporter) Export(r Record) {
+	if !Sampled(r.TransactionID, e.conf.SampleRate) {
+		return
+	}
+	select {
+	case e.queue <- r.Row(e.conf.Fields):
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of records dropped because the queue was
+// full
+func (e *Exporter) Dropped() int64 {
+	return e.dropped.Load()
+}
+
+// Close writes the queued rows and closes the sink
+func (e *Exporter) Close() error {
+	e.once.Do(func() { close(e.queue) })
+	<-e.done
+	return e.sink.Close()
+}
+
+// run writes the queued rows in batches, when a batch is full or the
+// flush interval elapses
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.conf.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]Row, 0, e.conf.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.sink.Write(batch); err != nil {
+			lg.Get().Printf(lg.WARN, "export | could not write %d rows: %v", len(batch), err)
+		}
+		batch = make([]Row, 0, e.conf.BatchSize)
+	}
+	for {
+		select {
+		case row, ok := <-e.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, row)
+			if len(batch) >= e.conf.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Row returns the selected fields of the record
+func (r Record) Row(fields []string) Row {
+	row := make(Row, len(fields))
+	for _, field := range fields {
+		switch field {
+		case FieldTransactionID:
+			row[field] = r.TransactionID
+		case FieldTime:
+			row[field] = r.Time.UTC().Format(time.RFC3339Nano)
+		case FieldBlock:
+			row[field] = r.Block
+		case FieldDecision:
+			row[field] = r.Decision
+		case FieldScores:
+			row[field] = r.Scores
+		case FieldCategories:
+			row[field] = r.Categories
+		case FieldTags:
+			row[field] = r.Tags
+		case FieldMetadata:
+			row[field] = r.Metadata
+		}
+	}
+	return row
+}
+
+// Sampled deterministically samples transactions by the hash of their
+// ID
+func Sampled(transactionID string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(transactionID))
+	return float64(h.Sum32())/float64(^uint32(0)) < rate
+}
+
+// IsField returns true if name is an exported field
+func IsField(name string) bool {
+	for _, field := range Fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package export
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClickHouseSink(t *testing.T) {
+	var mutex sync.Mutex
+	var query string
+	var rows []Row
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		query = r.URL.Query().Get("query")
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var row Row
+			json.Unmarshal(scanner.Bytes(), &row)
+			rows = append(rows, row)
+		}
+	}))
+	defer server.Close()
+
+	e := New(NewClickHouseSink(server.URL, "outcomes"), Config{SampleRate: 1, Fields: []string{FieldTransactionID, FieldBlock}, BatchSize: 2})
+	for _, id := range []string{"a", "b", "c"} {
+		e.Export(Record{TransactionID: id, Block: id == "b", Scores: map[string]float64{"m": 0.5}})
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if query != "INSERT INTO outcomes FORMAT JSONEachRow" {
+		t.Errorf("query is %q", query)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("inserted rows are %v", rows)
+	}
+	if rows[1][FieldBlock] != true || len(rows[1]) != 2 {
+		t.Errorf("second row is %v", rows[1])
+	}
+}
+
+func TestClickHouseSinkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		http.Error(w, "Table default.outcomes doesn't exist", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	err := NewClickHouseSink(server.URL, "outcomes").Write([]Row{{FieldTransactionID: "a"}})
+	if err == nil || !strings.Contains(err.Error(), "doesn't exist") {
+		t.Errorf("insert into missing table returns %v", err)
+	}
+}
+
+func TestJSONLSinkRotation(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewJSONLSink(dir, "wace", 1, 0)
+	if err != nil {
+		t.Fatalf("NewJSONLSink returned error: %v", err)
+	}
+	sink.Write([]Row{{FieldTransactionID: "a"}})
+	sink.Write([]Row{{FieldTransactionID: "b"}})
+	sink.now = func() time.Time { return time.Now().Add(time.Hour) }
+	sink.MaxSize, sink.MaxAge = 0, time.Minute
+	sink.Write([]Row{{FieldTransactionID: "c"}})
+	sink.Write([]Row{{FieldTransactionID: "d"}})
+	sink.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "wace-*.jsonl"))
+	if len(files) != 3 {
+		t.Fatalf("files are %v", files)
+	}
+	data, _ := os.ReadFile(files[2])
+	if strings.Count(string(data), "\n") != 2 {
+		t.Errorf("last file is %q", data)
+	}
+}
+
+func TestSampled(t *testing.T) {
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		id := strings.Repeat("x", i%7) + string(rune('a'+i%26)) + time.Duration(i).String()
+		if Sampled(id, 0.25) {
+			sampled++
+		}
+		if Sampled(id, 0.25) != Sampled(id, 0.25) {
+			t.Fatalf("sampling of %s is not deterministic", id)
+		}
+	}
+	if sampled < 150 || sampled > 350 {
+		t.Errorf("sampled %d of 1000 transactions at 25%%", sampled)
+	}
+	if !Sampled("a", 1) || Sampled("a", 0) {
+		t.Errorf("sampling at 1 and 0 is wrong")
+	}
+}
+
+func TestParquetSink(t *testing.T) {
+	dir := t.TempDir()
+	fields := []string{FieldTransactionID, FieldTime, FieldBlock, FieldScores}
+	sink, err := NewParquetSink(dir, "wace", fields, 0, time.Minute)
+	if err != nil {
+		t.Fatalf("NewParquetSink returned error: %v", err)
+	}
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	row := func(id string, block bool) Row {
+		return Record{TransactionID: id, Time: at, Block: block, Scores: map[string]float64{"m": 0.5}}.Row(fields)
+	}
+	sink.Write([]Row{row("a", false), row("b", true)})
+	sink.Write([]Row{row("c", true)})
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.parquet")); len(files) != 0 {
+		t.Errorf("incomplete files are visible: %v", files)
+	}
+	sink.now = func() time.Time { return time.Now().Add(time.Hour) }
+	sink.Write([]Row{row("d", false)})
+	sink.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "wace-*"))
+	if len(files) != 2 || filepath.Ext(files[0]) != ".parquet" {
+		t.Fatalf("files are %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatalf("file is not Parquet")
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	meta, _ := readCompact(data[len(data)-8-size : len(data)-8])
+	if meta[3] != int64(3) {
+		t.Errorf("file has %v rows", meta[3])
+	}
+	schema := meta[2].([]interface{})
+	if len(schema) != 5 || schema[1].(map[int16]interface{})[4] != FieldTransactionID {
+		t.Errorf("schema is %v", schema)
+	}
+	groups := meta[4].([]interface{})
+	if len(groups) != 2 {
+		t.Fatalf("row groups are %v", groups)
+	}
+
+	column := func(group, column int) []byte {
+		chunk := groups[group].(map[int16]interface{})[1].([]interface{})[column].(map[int16]interface{})
+		offset := chunk[3].(map[int16]interface{})[9].(int64)
+		header, values := readCompact(data[offset:])
+		return values[:header[3].(int64)]
+	}
+	ids := column(0, 0)
+	if string(ids) != "\x01\x00\x00\x00a\x01\x00\x00\x00b" {
+		t.Errorf("transaction IDs are %q", ids)
+	}
+	if micros := binary.LittleEndian.Uint64(column(0, 1)); int64(micros) != at.UnixMicro() {
+		t.Errorf("time is %d", micros)
+	}
+	if blocks := column(0, 2); len(blocks) != 1 || blocks[0] != 2 {
+		t.Errorf("blocks are %v", blocks)
+	}
+	if scores := column(1, 3); string(scores[4:]) != `{"m":0.5}` {
+		t.Errorf("scores are %q", scores)
+	}
+}
+
+// readCompact decodes a Thrift compact struct into its fields by ID,
+// and returns the data after it
+func readCompact(data []byte) (map[int16]interface{}, []byte) {
+	fields := make(map[int16]interface{})
+	var id int16
+	for {
+		header := data[0]
+		data = data[1:]
+		if header == 0 {
+			return fields, data
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			v, n := binary.Varint(data)
+			id, data = int16(v), data[n:]
+		}
+		fields[id], data = readCompactValue(header&0x0f, data)
+	}
+}
+
+func readCompactValue(typ byte, data []byte) (interface{}, []byte) {
+	switch typ {
+	case 1, 2:
+		return typ == 1, data
+	case 5, 6:
+		v, n := binary.Varint(data)
+		return v, data[n:]
+	case 8:
+		size, n := binary.Uvarint(data)
+		return string(data[n : n+int(size)]), data[n+int(size):]
+	case 9:
+		size, elem := int(data[0]>>4), data[0]&0x0f
+		data = data[1:]
+		if size == 15 {
+			v, n := binary.Uvarint(data)
+			size, data = int(v), data[n:]
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i], data = readCompactValue(elem, data)
+		}
+		return list, data
+	case 12:
+		return readCompact(data)
+	}
+	panic(fmt.Sprintf("unexpected compact type %d", typ))
+}
@@ -0,0 +1,374 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Parquet physical types, converted types and encodings of the columns
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetNone            = -1
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+	parquetJSON            = 19
+
+	parquetPlain = 0
+	parquetRLE   = 3
+)
+
+// parquetMagic starts and ends every Parquet file
+const parquetMagic = "PAR1"
+
+// ParquetSink writes the rows to Parquet files in a directory, a row
+// group for each batch, starting a new file when the current one
+// reaches MaxSize bytes or is older than MaxAge. The metadata of a
+// Parquet file is written at its end, so the file being written is
+// named with a .tmp suffix, removed once it is complete. The time is a
+// timestamp column and the scores, categories, tags and metadata are
+// JSON columns.
+type ParquetSink struct {
+	Dir     string
+	Prefix  string
+	Fields  []string
+	MaxSize int64
+	MaxAge  time.Duration
+
+	mutex     sync.Mutex
+	file      *os.File
+	size      int64
+	opened    time.Time
+	rowGroups []parquetRowGroup
+	now       func() time.Time
+	counter   int
+}
+
+// parquetRowGroup locates a row group written to the current file
+type parquetRowGroup struct {
+	rows   int
+	size   int64
+	chunks []parquetChunk
+}
+
+// parquetChunk locates the single data page of a column in a row group
+type parquetChunk struct {
+	offset int64
+	size   int64
+}
+
+// NewParquetSink creates a sink writing rotating files in dir with the
+// fields as columns, all of them if empty
+func NewParquetSink(dir, prefix string, fields []string, maxSize int64, maxAge time.Duration) (*ParquetSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		fields = Fields
+	}
+	return &ParquetSink{Dir: dir, Prefix: prefix, Fields: fields, MaxSize: maxSize, MaxAge: maxAge, now: time.Now}, nil
+}
+
+// Write appends the rows to the current file as a row group
+func (s *ParquetSink) Write(rows []Row) error {
+	pages := make([][]byte, len(s.Fields))
+	for i, field := range s.Fields {
+		values, err := parquetValues(field, rows)
+		if err != nil {
+			return err
+		}
+		pages[i] = append(parquetPageHeader(len(values), len(rows)), values...)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.rotate(); err != nil {
+		return err
+	}
+	group := parquetRowGroup{rows: len(rows)}
+	for _, page := range pages {
+		if _, err := s.file.Write(page); err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, parquetChunk{offset: s.size, size: int64(len(page))})
+		group.size += int64(len(page))
+		s.size += int64(len(page))
+	}
+	s.rowGroups = append(s.rowGroups, group)
+	return nil
+}
+
+// rotate completes the current file and opens a new one if there is
+// none or the current one is full or too old
+func (s *ParquetSink) rotate() error {
+	now := s.now()
+	if s.file != nil && (s.MaxSize <= 0 || s.size < s.MaxSize) && (s.MaxAge <= 0 || now.Sub(s.opened) < s.MaxAge) {
+		return nil
+	}
+	if s.file != nil {
+		if err := s.complete(); err != nil {
+			return err
+		}
+	}
+	s.counter++
+	name := fmt.Sprintf("%s-%s-%d.parquet.tmp", s.Prefix, now.UTC().Format("20060102T150405"), s.counter)
+	f, err := os.OpenFile(filepath.Join(s.Dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(parquetMagic); err != nil {
+		f.Close()
+		return err
+	}
+	s.file, s.size, s.opened, s.rowGroups = f, int64(len(parquetMagic)), now, nil
+	return nil
+}
+
+// complete writes the metadata at the end of the current file, closes
+// it and removes its .tmp suffix
+func (s *ParquetSink) complete() error {
+	f := s.file
+	s.file = nil
+	footer := s.footer()
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	footer = append(footer, parquetMagic...)
+	if _, err := f.Write(footer); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	name := f.Name()
+	return os.Rename(name, name[:len(name)-len(".tmp")])
+}
+
+// footer returns the file metadata of the current file
+func (s *ParquetSink) footer() []byte {
+	rows := 0
+	for _, group := range s.rowGroups {
+		rows += group.rows
+	}
+	var w compactWriter
+	w.begin()
+	w.i32(1, 1)
+	w.list(2, compactStruct, len(s.Fields)+1)
+	w.begin()
+	w.binary(4, "schema")
+	w.i32(5, int32(len(s.Fields)))
+	w.end()
+	for _, field := range s.Fields {
+		physical, converted := parquetColumn(field)
+		w.begin()
+		w.i32(1, physical)
+		w.i32(3, 0) // required
+		w.binary(4, field)
+		if converted != parquetNone {
+			w.i32(6, converted)
+		}
+		w.end()
+	}
+	w.i64(3, int64(rows))
+	w.list(4, compactStruct, len(s.rowGroups))
+	for _, group := range s.rowGroups {
+		w.begin()
+		w.list(1, compactStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			physical, _ := parquetColumn(s.Fields[i])
+			w.begin()
+			w.i64(2, chunk.offset)
+			w.beginField(3)
+			w.i32(1, physical)
+			w.list(2, compactI32, 1)
+			w.zigzag(parquetPlain)
+			w.list(3, compactBinary, 1)
+			w.str(s.Fields[i])
+			w.i32(4, 0) // uncompressed
+			w.i64(5, int64(group.rows))
+			w.i64(6, chunk.size)
+			w.i64(7, chunk.size)
+			w.i64(9, chunk.offset)
+			w.end()
+			w.end()
+		}
+		w.i64(2, group.size)
+		w.i64(3, int64(group.rows))
+		w.end()
+	}
+	w.binary(6, "wacelib")
+	w.end()
+	return w.buf.Bytes()
+}
+
+// Close completes the current file
+func (s *ParquetSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	return s.complete()
+}
+
+// parquetColumn returns the physical and converted types of the column
+// of a field
+func parquetColumn(field string) (int32, int32) {
+	switch field {
+	case FieldTime:
+		return parquetInt64, parquetTimestampMicros
+	case FieldBlock:
+		return parquetBoolean, parquetNone
+	case FieldTransactionID, FieldDecision:
+		return parquetByteArray, parquetUTF8
+	}
+	return parquetByteArray, parquetJSON
+}
+
+// parquetValues returns the values of the field in the rows, PLAIN
+// encoded
+func parquetValues(field string, rows []Row) ([]byte, error) {
+	var data []byte
+	switch physical, converted := parquetColumn(field); {
+	case physical == parquetBoolean:
+		data = make([]byte, (len(rows)+7)/8)
+		for i, row := range rows {
+			if block, _ := row[field].(bool); block {
+				data[i/8] |= 1 << (i % 8)
+			}
+		}
+	case physical == parquetInt64:
+		for _, row := range rows {
+			value, _ := row[field].(string)
+			t, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q", field, value)
+			}
+			data = binary.LittleEndian.AppendUint64(data, uint64(t.UnixMicro()))
+		}
+	case converted == parquetUTF8:
+		for _, row := range rows {
+			value, _ := row[field].(string)
+			data = binary.LittleEndian.AppendUint32(data, uint32(len(value)))
+			data = append(data, value...)
+		}
+	default:
+		for _, row := range rows {
+			value, err := json.Marshal(row[field])
+			if err != nil {
+				return nil, err
+			}
+			data = binary.LittleEndian.AppendUint32(data, uint32(len(value)))
+			data = append(data, value...)
+		}
+	}
+	return data, nil
+}
+
+// parquetPageHeader returns the header of a data page of size bytes
+// holding the values of the rows
+func parquetPageHeader(size, rows int) []byte {
+	var w compactWriter
+	w.begin()
+	w.i32(1, 0) // data page
+	w.i32(2, int32(size))
+	w.i32(3, int32(size))
+	w.beginField(5)
+	w.i32(1, int32(rows))
+	w.i32(2, parquetPlain)
+	w.i32(3, parquetRLE)
+	w.i32(4, parquetRLE)
+	w.end()
+	w.end()
+	return w.buf.Bytes()
+}
+
+// Thrift compact protocol types
+const (
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// compactWriter encodes the Parquet metadata with the Thrift compact
+// protocol. It keeps the last field ID of each struct being written,
+// as field IDs are encoded as deltas.
+type compactWriter struct {
+	buf  bytes.Buffer
+	last []int16
+}
+
+// begin starts a struct value, e.g. a list element
+func (w *compactWriter) begin() {
+	w.last = append(w.last, 0)
+}
+
+// beginField starts a struct field
+func (w *compactWriter) beginField(id int16) {
+	w.field(compactStruct, id)
+	w.begin()
+}
+
+// end ends the current struct
+func (w *compactWriter) end() {
+	w.buf.WriteByte(0)
+	w.last = w.last[:len(w.last)-1]
+}
+
+func (w *compactWriter) field(typ byte, id int16) {
+	last := &w.last[len(w.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.zigzag(int64(id))
+	}
+	*last = id
+}
+
+func (w *compactWriter) i32(id int16, v int32) {
+	w.field(compactI32, id)
+	w.zigzag(int64(v))
+}
+
+func (w *compactWriter) i64(id int16, v int64) {
+	w.field(compactI64, id)
+	w.zigzag(v)
+}
+
+func (w *compactWriter) binary(id int16, v string) {
+	w.field(compactBinary, id)
+	w.str(v)
+}
+
+// list starts a list field of n elements, which are written next
+func (w *compactWriter) list(id int16, elem byte, n int) {
+	w.field(compactList, id)
+	if n < 15 {
+		w.buf.WriteByte(byte(n)<<4 | elem)
+	} else {
+		w.buf.WriteByte(0xf0 | elem)
+		w.varint(uint64(n))
+	}
+}
+
+func (w *compactWriter) str(v string) {
+	w.varint(uint64(len(v)))
+	w.buf.WriteString(v)
+}
+
+func (w *compactWriter) zigzag(v int64) {
+	w.varint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (w *compactWriter) varint(v uint64) {
+	w.buf.Write(binary.AppendUvarint(nil, v))
+}
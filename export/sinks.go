@@ -0,0 +1,141 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ClickHouseSink inserts the rows into a ClickHouse table through its
+// HTTP interface, in the JSONEachRow format
+type ClickHouseSink struct {
+	// URL is the address of the HTTP interface, e.g.
+	// http://clickhouse:8123, optionally with user and password
+	URL    string
+	Table  string
+	Client *http.Client
+}
+
+// NewClickHouseSink creates a sink inserting into the table
+func NewClickHouseSink(address, table string) *ClickHouseSink {
+	return &ClickHouseSink{URL: address, Table: table, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Write inserts the rows
+func (s *ClickHouseSink) Write(rows []Row) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("query", fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", s.Table))
+	u.RawQuery = q.Encode()
+	resp, err := s.Client.Post(u.String(), "application/json", &body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("clickhouse returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// Close does nothing
+func (s *ClickHouseSink) Close() error {
+	return nil
+}
+
+// JSONLSink writes the rows as JSON lines to files in a directory,
+// starting a new file when the current one reaches MaxSize bytes or
+// is older than MaxAge. The files load as they are into ClickHouse,
+// DuckDB or Spark.
+type JSONLSink struct {
+	Dir     string
+	Prefix  string
+	MaxSize int64
+	MaxAge  time.Duration
+
+	mutex   sync.Mutex
+	file    *os.File
+	size    int64
+	opened  time.Time
+	now     func() time.Time
+	counter int
+}
+
+// NewJSONLSink creates a sink writing rotating files in dir
+func NewJSONLSink(dir, prefix string, maxSize int64, maxAge time.Duration) (*JSONLSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &JSONLSink{Dir: dir, Prefix: prefix, MaxSize: maxSize, MaxAge: maxAge, now: time.Now}, nil
+}
+
+// Write appends the rows to the current file
+func (s *JSONLSink) Write(rows []Row) error {
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.rotate(); err != nil {
+		return err
+	}
+	n, err := s.file.Write(data.Bytes())
+	s.size += int64(n)
+	return err
+}
+
+// rotate opens a new file if there is none or the current one is full
+// or too old
+func (s *JSONLSink) rotate() error {
+	now := s.now()
+	if s.file != nil && (s.MaxSize <= 0 || s.size < s.MaxSize) && (s.MaxAge <= 0 || now.Sub(s.opened) < s.MaxAge) {
+		return nil
+	}
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return err
+		}
+	}
+	s.counter++
+	name := fmt.Sprintf("%s-%s-%d.jsonl", s.Prefix, now.UTC().Format("20060102T150405"), s.counter)
+	f, err := os.OpenFile(filepath.Join(s.Dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.file, s.size, s.opened = f, 0, now
+	return nil
+}
+
+// Close closes the current file
+func (s *JSONLSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
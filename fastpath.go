@@ -0,0 +1,60 @@
+package wace
+
+import (
+	"strings"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// MetaFastPath is set to "true" in the metadata of the transactions
+// taking the fast path, and to "false" in the others once their request
+// line is known
+const MetaFastPath = "fastpath"
+
+// FastPathTag tags the transactions whose models were skipped by the
+// fast path
+const FastPathTag = "fastpath:skip"
+
+// fastPath returns true if the transaction takes the fast path, with
+// its method and path read from the request metadata given by the
+// connector or else from the request line of the payload. The result is
+// kept in the metadata, so the later parts of the transaction are not
+// analyzed either.
+func (c *Core) fastPath(transactionID string, modelsType cf.ModelPluginType, payload string) bool {
+	conf := c.config().FastPath
+	if len(conf.Methods) == 0 && len(conf.Suffixes) == 0 {
+		return false
+	}
+	if skip, ok := c.TransactionMetadata(transactionID)[MetaFastPath]; ok {
+		return skip == "true"
+	}
+	meta := c.pluginsOf(transactionID).manager.TransactionMeta(c.scope(transactionID))
+	method, uri := meta[pm.MetaMethod], meta[pm.MetaURI]
+	if method == "" && (modelsType == cf.RequestHeaders || modelsType == cf.AllRequest || modelsType == cf.Everything) {
+		line, _, _ := strings.Cut(payload, "\n")
+		if fields := strings.Fields(line); len(fields) >= 2 {
+			method, uri = fields[0], fields[1]
+		}
+	}
+	if method == "" {
+		return false
+	}
+	path, _, _ := strings.Cut(uri, "?")
+	path, _, _ = strings.Cut(path, "#")
+	skip := conf.Skips(method, path)
+	value := "false"
+	if skip {
+		value = "true"
+		c.tprintf(lg.DEBUG, transactionID, "core | %s %s takes the fast path", method, path)
+	}
+	c.setMetadata(transactionID, map[string]string{MetaFastPath: value})
+	return skip
+}
+
+// transactionFastPath returns true if the transaction took the fast path
+func (c *Core) transactionFastPath(transactionID string) bool {
+	return c.TransactionMetadata(transactionID)[MetaFastPath] == "true"
+}
@@ -0,0 +1,105 @@
+package wace
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestFastPath(t *testing.T) {
+	err := pm.RegisterModel("fastpathattack", nil, func(input pm.ModelInput) (pm.ModelResults, error) {
+		return pm.ModelResults{ProbAttack: 0.9}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inConf cf.ConfigFileData
+	err = yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: attack
+    kind: builtin
+    builtin: fastpathattack
+    plugintype: RequestHeaders
+  - id: bodyattack
+    kind: builtin
+    builtin: fastpathattack
+    plugintype: RequestBody
+decisionplugins:
+  - id: combiner
+    kind: builtin
+  - id: waf
+    kind: builtin
+fastpath:
+  methods: [options, HEAD]
+  suffixes: [.CSS, .js]
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("fastpath", conf, testMeter)
+
+	for payload, allowed := range map[string]bool{
+		"OPTIONS /api HTTP/1.1\nOrigin: https://example.com\n": true,
+		"GET /static/site.css?v=2 HTTP/1.1\n":                  true,
+		"GET /app.js HTTP/1.1\n":                               true,
+		"HEAD /fonts/a%2Ejs HTTP/1.1\n":                        true,
+		"GET /api HTTP/1.1\n":                                  false,
+		"GET /vuln.php;.js?id=1 HTTP/1.1\n":                    false,
+		"GET /vuln.php%3B.js HTTP/1.1\n":                       false,
+		"POST /login.css HTTP/1.1\n":                           false,
+	} {
+		id := generateRandomID()
+		engine.InitTransaction(id)
+		if err := Analyze("RequestHeaders", id, payload, []string{"attack"}); err != nil {
+			t.Fatalf("Analyze returned error: %v", err)
+		}
+		if err := Analyze("RequestBody", id, "q=1", []string{"bodyattack"}); err != nil {
+			t.Fatalf("Analyze returned error: %v", err)
+		}
+		verdict, err := CheckTransactionVerdict(id, "combiner", nil)
+		if err != nil {
+			t.Fatalf("CheckTransactionVerdict returned error: %v", err)
+		}
+		if verdict.Block == allowed {
+			t.Errorf("%q blocked: %v", payload, verdict.Block)
+		}
+		if tagged := len(verdict.Tags) > 0 && verdict.Tags[0] == FastPathTag; tagged != allowed {
+			t.Errorf("%q tags are %v", payload, verdict.Tags)
+		}
+		CloseTransaction(id)
+	}
+
+	// the decision plugin still checks the WAF data of the fast path
+	// transactions
+	id := generateRandomID()
+	engine.InitTransaction(id)
+	if err := Analyze("RequestHeaders", id, "GET /app.js HTTP/1.1\n", []string{"attack"}); err != nil {
+		t.Fatalf("Analyze returned error: %v", err)
+	}
+	verdict, err := CheckTransactionVerdict(id, "waf", map[string]string{pm.InboundAnomalyParam: "10"})
+	if err != nil || !verdict.Block {
+		t.Errorf("fast path transaction with a WAF anomaly score allowed: %v", err)
+	}
+	CloseTransaction(id)
+
+	// the method given in the metadata takes precedence
+	id = generateRandomID()
+	engine.InitTransaction(id)
+	defer CloseTransaction(id)
+	err = AnalyzeWithMeta("RequestBody", id, "q=1", []string{"bodyattack"}, map[string]string{pm.MetaMethod: "HEAD", pm.MetaURI: "/"})
+	if err != nil {
+		t.Fatalf("AnalyzeWithMeta returned error: %v", err)
+	}
+	if block, err := CheckTransaction(id, "combiner", nil); err != nil || block {
+		t.Errorf("HEAD request blocked: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Package fingerprint computes structural fingerprints of HTTP requests:
+the path template, the set of parameter names and the shape of the
+headers. Requests with the same structure get the same fingerprint
+regardless of the values they carry.
+*/
+package fingerprint
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Fingerprint is the structure of a request
+type Fingerprint struct {
+	// Method is the request method
+	Method string
+	// PathTemplate is the path with variable segments replaced by
+	// placeholders, e.g. /users/{int}/orders/{uuid}
+	PathTemplate string
+	// ParamNames is the sorted set of query parameter names
+	ParamNames []string
+	// HeaderNames lists the lower-cased header names in order
+	HeaderNames []string
+	// ParamHash is the hash of the parameter name set
+	ParamHash string
+	// HeaderShapeHash is the hash of the ordered header names
+	HeaderShapeHash string
+	// Hash identifies the whole structure of the request
+	Hash string
+}
+
+var (
+	intSegment   = regexp.MustCompile(`^[0-9]+$`)
+	uuidSegment  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexSegment   = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+	tokenSegment = regexp.MustCompile(`^[A-Za-z0-9_\-]{24,}$`)
+)
+
+// Endpoint returns the method and path template identifying the
+// endpoint of the request
+func (f Fingerprint) Endpoint() string {
+	return f.Method + " " + f.PathTemplate
+}
+
+// Compute returns the fingerprint of a raw request, made of the request
+// line followed by the headers
+func Compute(payload string) Fingerprint {
+	lines := strings.Split(payload, "\n")
+	var fp Fingerprint
+
+	requestLine := strings.Fields(strings.TrimRight(lines[0], "\r"))
+	target := ""
+	if len(requestLine) >= 2 {
+		fp.Method = strings.ToUpper(requestLine[0])
+		target = requestLine[1]
+	}
+	path, query, _ := strings.Cut(target, "?")
+	if u, err := url.Parse(path); err == nil && u.Path != "" {
+		path = u.Path
+	}
+	fp.PathTemplate = PathTemplate(path)
+	fp.ParamNames = paramNames(query)
+
+	for _, line := range lines[1:] {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			break
+		}
+		if name, _, found := strings.Cut(line, ":"); found {
+			fp.HeaderNames = append(fp.HeaderNames, strings.ToLower(strings.TrimSpace(name)))
+		}
+	}
+
+	fp.ParamHash = hash(strings.Join(fp.ParamNames, "&"))
+	fp.HeaderShapeHash = hash(strings.Join(fp.HeaderNames, ","))
+	fp.Hash = hash(fp.Endpoint() + "|" + fp.ParamHash + "|" + fp.HeaderShapeHash)
+	return fp
+}
+
+// PathTemplate replaces the variable segments of a path (numbers,
+// UUIDs, long hex strings and opaque tokens) with placeholders
+func PathTemplate(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "":
+		case intSegment.MatchString(segment):
+			segments[i] = "{int}"
+		case uuidSegment.MatchString(segment):
+			segments[i] = "{uuid}"
+		case hexSegment.MatchString(segment):
+			segments[i] = "{hex}"
+		case tokenSegment.MatchString(segment):
+			segments[i] = "{token}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// paramNames returns the sorted set of parameter names of a query string
+func paramNames(query string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, pair := range strings.Split(query, "&") {
+		name, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hash returns the hex FNV-1a hash of s
+func hash(s string) string {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
@@ -0,0 +1,41 @@
+package fingerprint
+
+import (
+	"testing"
+)
+
+func TestPathTemplate(t *testing.T) {
+	cases := map[string]string{
+		"":                 "/",
+		"/":                "/",
+		"/users/42/orders": "/users/{int}/orders",
+		"/items/3f2504e0-4f89-11d3-9a0c-0305e82c3301":     "/items/{uuid}",
+		"/blobs/a94a8fe5ccb19ba61c4c0873d391e987982fbbd3": "/blobs/{hex}",
+		"/reset/eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9":     "/reset/{token}",
+		"/static/app.js": "/static/app.js",
+	}
+	for path, expected := range cases {
+		if template := PathTemplate(path); template != expected {
+			t.Errorf("template of %q is %q, expected %q", path, template, expected)
+		}
+	}
+}
+
+func TestCompute(t *testing.T) {
+	a := Compute("GET /users/1?b=2&a=1 HTTP/1.1\nHost: example.com\nAccept: */*\n\nbody")
+	b := Compute("GET /users/2?a=x&b=y&a=z HTTP/1.1\nHost: other.com\nAccept: text/html\n")
+	c := Compute("GET /users/2?a=x HTTP/1.1\nAccept: text/html\nHost: other.com\n")
+
+	if a.Endpoint() != "GET /users/{int}" {
+		t.Errorf("endpoint is %q", a.Endpoint())
+	}
+	if len(a.ParamNames) != 2 || a.ParamNames[0] != "a" || a.ParamNames[1] != "b" {
+		t.Errorf("param names are %v", a.ParamNames)
+	}
+	if a.Hash != b.Hash {
+		t.Errorf("requests with the same structure have different fingerprints")
+	}
+	if a.ParamHash == c.ParamHash || a.HeaderShapeHash == c.HeaderShapeHash || a.Hash == c.Hash {
+		t.Errorf("requests with different structure share fingerprints")
+	}
+}
@@ -0,0 +1,46 @@
+package wace
+
+import (
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// recordModelFreshness records the age of the models with results whose
+// manifest tells it, and counts the results of the stale models, whose
+// weight was discounted
+func (c *Core) recordModelFreshness(transactionID string, conf *cf.ConfigStore, results map[string]pm.ModelResults) {
+	now := time.Now()
+	inst, attributes := c.transactionMetrics(transactionID)
+	for modelID := range results {
+		age, ok := conf.ModelAge(modelID, now)
+		if !ok {
+			continue
+		}
+		modelAttributes := metric.WithAttributes(append(attributes,
+			attribute.String("model_id", modelID),
+			attribute.String("model_version", conf.ModelPlugins[modelID].Version))...)
+		gauge, err := inst.Float64Gauge("wace.model.age.seconds", metric.WithDescription("Time since the model was trained"))
+		if err != nil {
+			c.tprintf(lg.WARN, transactionID, "core | failed to record model age metric: %v", err.Error())
+		} else {
+			gauge.Record(ctx, age.Seconds(), modelAttributes)
+		}
+		if !conf.IsStale(modelID, now) {
+			continue
+		}
+		c.tprintf(lg.DEBUG, transactionID, "%s | stale model trained %v ago, weight discounted", modelID, age)
+		counter, err := inst.Int64Counter("wace.model.stale.total", metric.WithDescription("Number of stale model results whose weight was discounted"))
+		if err != nil {
+			c.tprintf(lg.WARN, transactionID, "core | failed to record stale model metric: %v", err.Error())
+			continue
+		}
+		counter.Add(ctx, 1, modelAttributes)
+	}
+}
@@ -0,0 +1,68 @@
+package wace
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestStaleModelWeight(t *testing.T) {
+	manifest := t.TempDir() + "/manifest.json"
+	if err := os.WriteFile(manifest, []byte(`{"version": "1.0", "trained": "2021-06-01T00:00:00Z"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: protocol
+    kind: builtin
+    plugintype: RequestHeaders
+    weight: 1
+    manifest: `+manifest+`
+decisionplugins:
+  - id: combiner
+    kind: builtin
+staleness:
+  maxage: 24h
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	reader := metric.NewManualReader()
+	engine := NewCore("freshness", conf, metric.NewMeterProvider(metric.WithReader(reader)).Meter("freshness"))
+	id := generateRandomID()
+	engine.InitTransaction(id)
+	defer CloseTransaction(id)
+
+	Analyze("RequestHeaders", id, "GET / HTTP/1.1\nHost: example.com\n", []string{"protocol"})
+	if _, err := CheckTransaction(id, "combiner", nil); err != nil {
+		t.Fatalf("CheckTransaction returned error: %v", err)
+	}
+	if res, _ := GetTransactionResults(id); res.Weights["protocol"] != 0.5 {
+		t.Errorf("stale model weight is %v, expected 0.5", res.Weights["protocol"])
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect returned error: %v", err)
+	}
+	found := map[string]bool{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		found[m.Name] = true
+	}
+	if !found["wace.model.age.seconds"] || !found["wace.model.stale.total"] {
+		t.Errorf("freshness metrics not recorded: %v", found)
+	}
+}
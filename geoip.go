@@ -0,0 +1,139 @@
+package wace
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/tiroa-tilsor/wacelib/geoip"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// MetaClientIP is the metadata key of the client address given by the
+// connector, located in the geoip database when one is configured
+const MetaClientIP = "client.ip"
+
+// Metadata keys set by the core from the location of the client address
+const (
+	MetaGeoCountry     = "geo.country"
+	MetaGeoContinent   = "geo.continent"
+	MetaGeoSubdivision = "geo.subdivision"
+	MetaGeoCity        = "geo.city"
+	MetaGeoLatitude    = "geo.latitude"
+	MetaGeoLongitude   = "geo.longitude"
+	MetaGeoASN         = "geo.asn"
+	MetaGeoASOrg       = "geo.as_org"
+)
+
+// startGeoIP opens the geoip database if configured and starts
+// checking it for changes, stopping the previous reload job
+func (c *Core) startGeoIP() {
+	logger := lg.Get()
+	if c.geoStop != nil {
+		close(c.geoStop)
+		c.geoStop = nil
+	}
+	conf := c.config().GeoIP
+	var db *geoip.DB
+	if conf.Database != "" {
+		var err error
+		if db, err = geoip.OpenDB(conf.Database); err != nil {
+			logger.Printf(lg.ERROR, "core | could not open geoip database: %v", err)
+		}
+	}
+	c.geoDBMutex.Lock()
+	c.geoDB = db
+	c.geoDBMutex.Unlock()
+	if db == nil {
+		return
+	}
+	c.recordGeoIPAge(db)
+	logger.Printf(lg.INFO, "Locating clients with %s database %s built %v", db.Metadata().DatabaseType, conf.Database, db.Metadata().BuildEpoch)
+	if conf.Reload <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	c.geoStop = stop
+	go func() {
+		ticker := time.NewTicker(conf.Reload)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				reloaded, err := db.Reload()
+				if err != nil {
+					logger.Printf(lg.WARN, "core | could not reload geoip database, keeping the previous one: %v", err)
+				} else if reloaded {
+					logger.Printf(lg.INFO, "Reloaded geoip database built %v", db.Metadata().BuildEpoch)
+				}
+				c.recordGeoIPAge(db)
+			}
+		}
+	}()
+}
+
+// recordGeoIPAge records the time elapsed since the geoip database in
+// use was built
+func (c *Core) recordGeoIPAge(db *geoip.DB) {
+	gauge, err := c.plugins.Load().instruments.Float64Gauge("wace.geoip.database.age.seconds", metric.WithDescription("Time elapsed since the geoip database was built"))
+	if err != nil {
+		lg.Get().Printf(lg.WARN, "core | failed to record geoip database age metric: %v", err)
+		return
+	}
+	gauge.Record(ctx, db.Age(time.Now()).Seconds(), metric.WithAttributes(append([]attribute.KeyValue{attribute.String("database_type", db.Metadata().DatabaseType)}, c.attributes...)...))
+}
+
+// locateTransaction sets the location of the client address of the
+// transaction in its metadata, and hands it to the plugins
+func (c *Core) locateTransaction(transactionID string) {
+	c.geoDBMutex.RLock()
+	db := c.geoDB
+	c.geoDBMutex.RUnlock()
+	if db == nil {
+		return
+	}
+	meta := c.TransactionMetadata(transactionID)
+	// the address is logged pseudonymized
+	address := c.clientAddress(transactionID, meta)
+	if address == "" {
+		return
+	}
+	if _, located := meta[MetaGeoCountry]; located {
+		return
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		c.tprintf(lg.DEBUG, transactionID, "core | invalid client address %q", meta[MetaClientIP])
+		return
+	}
+	loc, found, err := db.Location(ip)
+	if err != nil {
+		c.tprintf(lg.WARN, transactionID, "core | could not locate client address %s: %v", meta[MetaClientIP], err)
+		return
+	}
+	if !found {
+		return
+	}
+	values := map[string]string{
+		MetaGeoCountry:     loc.Country,
+		MetaGeoContinent:   loc.Continent,
+		MetaGeoSubdivision: loc.Subdivision,
+		MetaGeoCity:        loc.City,
+		MetaGeoASOrg:       loc.ASOrg,
+	}
+	if loc.Latitude != 0 || loc.Longitude != 0 {
+		values[MetaGeoLatitude] = strconv.FormatFloat(loc.Latitude, 'f', -1, 64)
+		values[MetaGeoLongitude] = strconv.FormatFloat(loc.Longitude, 'f', -1, 64)
+	}
+	if loc.ASN != 0 {
+		values[MetaGeoASN] = strconv.FormatUint(loc.ASN, 10)
+	}
+	c.setMetadata(transactionID, values)
+	c.pluginsOf(transactionID).manager.SetTransactionGeo(c.scope(transactionID), loc)
+	c.tprintf(lg.DEBUG, transactionID, "core | client %s located in %s", meta[MetaClientIP], loc.Country)
+}
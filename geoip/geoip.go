@@ -0,0 +1,129 @@
+/*
+Package geoip looks up the location and network of IP addresses in
+MaxMind DB files, such as the GeoLite2 City, Country and ASN databases,
+without depending on an external service. A DB reloads its file when it
+changes, so the database can be updated while WACE runs.
+*/
+package geoip
+
+import (
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Location is what a database knows about an IP address. The fields
+// missing from the database are empty.
+type Location struct {
+	// Country is the ISO 3166-1 code of the country, or of the
+	// registered country of the network if unknown
+	Country string
+	// Continent is the two letter code of the continent
+	Continent string
+	// Subdivision is the ISO 3166-2 code of the largest subdivision
+	Subdivision string
+	// City is the English name of the city
+	City      string
+	Latitude  float64
+	Longitude float64
+	// ASN and ASOrg are the autonomous system of the network
+	ASN   uint64
+	ASOrg string
+}
+
+// Location returns the location of the address, and false if the
+// database has no record of it
+func (r *Reader) Location(ip net.IP) (Location, bool, error) {
+	value, found, err := r.Lookup(ip)
+	if err != nil || !found {
+		return Location{}, false, err
+	}
+	record, _ := value.(map[string]interface{})
+	loc := Location{
+		Country:   stringValue(path(record, "country", "iso_code")),
+		Continent: stringValue(path(record, "continent", "code")),
+		City:      stringValue(path(record, "city", "names", "en")),
+		ASN:       uintValue(record["autonomous_system_number"]),
+		ASOrg:     stringValue(record["autonomous_system_organization"]),
+	}
+	if loc.Country == "" {
+		loc.Country = stringValue(path(record, "registered_country", "iso_code"))
+	}
+	if subdivisions, ok := record["subdivisions"].([]interface{}); ok && len(subdivisions) > 0 {
+		subdivision, _ := subdivisions[0].(map[string]interface{})
+		loc.Subdivision = stringValue(subdivision["iso_code"])
+	}
+	loc.Latitude, _ = path(record, "location", "latitude").(float64)
+	loc.Longitude, _ = path(record, "location", "longitude").(float64)
+	return loc, true, nil
+}
+
+// path returns the value at the keys of the nested maps
+func path(record map[string]interface{}, keys ...string) interface{} {
+	var value interface{} = record
+	for _, key := range keys {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+// DB is a database file that can be reloaded while in use
+type DB struct {
+	path    string
+	reader  atomic.Pointer[Reader]
+	mutex   sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// OpenDB opens the database file
+func OpenDB(path string) (*DB, error) {
+	db := &DB{path: path}
+	if _, err := db.Reload(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Reload reads the database file again if it changed since it was
+// last read, and returns true if it did. Lookups keep using the
+// previous database until the new one is read, and if it is invalid.
+func (db *DB) Reload() (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return false, err
+	}
+	if db.reader.Load() != nil && info.ModTime().Equal(db.modTime) && info.Size() == db.size {
+		return false, nil
+	}
+	r, err := Open(db.path)
+	if err != nil {
+		return false, err
+	}
+	db.reader.Store(r)
+	db.modTime, db.size = info.ModTime(), info.Size()
+	return true, nil
+}
+
+// Location returns the location of the address in the current database
+func (db *DB) Location(ip net.IP) (Location, bool, error) {
+	return db.reader.Load().Location(ip)
+}
+
+// Metadata returns the metadata of the current database
+func (db *DB) Metadata() Metadata {
+	return db.reader.Load().Metadata()
+}
+
+// Age returns the time elapsed since the current database was built
+func (db *DB) Age(now time.Time) time.Duration {
+	return now.Sub(db.Metadata().BuildEpoch)
+}
@@ -0,0 +1,231 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// pointer is encoded as a pointer to the data at the offset
+type pointer uint
+
+// encode appends the value in the MaxMind DB format
+func encode(buf []byte, v interface{}) []byte {
+	ctrl := func(kind, size int) []byte {
+		var extra []byte
+		if size >= 29 {
+			size, extra = 29, []byte{byte(size - 29)}
+		}
+		if kind <= 7 {
+			buf = append(buf, byte(kind<<5|size))
+		} else {
+			buf = append(buf, byte(size), byte(kind-7))
+		}
+		return append(buf, extra...)
+	}
+	switch v := v.(type) {
+	case string:
+		buf = ctrl(typeString, len(v))
+		return append(buf, v...)
+	case uint64:
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], v)
+		trimmed := bytes.TrimLeft(b[:], "\x00")
+		buf = ctrl(typeUint32, len(trimmed))
+		return append(buf, trimmed...)
+	case float64:
+		buf = ctrl(typeDouble, 8)
+		return binary.BigEndian.AppendUint64(buf, math.Float64bits(v))
+	case pointer:
+		return append(buf, byte(typePointer<<5|int(v>>8)), byte(v))
+	case []interface{}:
+		buf = ctrl(typeArray, len(v))
+		for _, e := range v {
+			buf = encode(buf, e)
+		}
+		return buf
+	case map[string]interface{}:
+		buf = ctrl(typeMap, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			buf = encode(encode(buf, k), v[k])
+		}
+		return buf
+	}
+	panic("cannot encode value")
+}
+
+// network is a record of the database to build
+type network struct {
+	cidr string
+	data interface{}
+}
+
+// build returns an IPv6 database with 24 bit records holding the
+// networks, with IPv4 addresses in ::/96 like in the MaxMind databases
+func build(t *testing.T, networks []network) []byte {
+	const empty = -1
+	nodes := [][2]int{{empty, empty}}
+	var data []byte
+	var offsets []int
+	for i, n := range networks {
+		_, ipnet, err := net.ParseCIDR(n.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, bits := ipnet.Mask.Size()
+		ip := ipnet.IP.To16()
+		if bits == 32 {
+			ip = append(make(net.IP, 12), ipnet.IP.To4()...)
+			ones += 96
+		}
+		offsets = append(offsets, len(data))
+		data = encode(data, n.data)
+		node := 0
+		for b := 0; b < ones; b++ {
+			bit := (ip[b/8] >> (7 - uint(b%8))) & 1
+			if b == ones-1 {
+				nodes[node][bit] = -2 - i
+				break
+			}
+			if nodes[node][bit] < 0 {
+				nodes = append(nodes, [2]int{empty, empty})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	nodeCount := len(nodes)
+	var file []byte
+	for _, node := range nodes {
+		for _, record := range node {
+			value := uint64(record)
+			if record == empty {
+				value = uint64(nodeCount)
+			} else if record < 0 {
+				value = uint64(nodeCount + dataSectionSeparator + offsets[-2-record])
+			}
+			file = append(file, byte(value>>16), byte(value>>8), byte(value))
+		}
+	}
+	file = append(file, make([]byte, dataSectionSeparator)...)
+	file = append(file, data...)
+	file = append(file, metadataMarker...)
+	return encode(file, map[string]interface{}{
+		"database_type": "Test-City",
+		"ip_version":    uint64(6),
+		"node_count":    uint64(nodeCount),
+		"record_size":   uint64(24),
+		"build_epoch":   uint64(1700000000),
+		"languages":     []interface{}{"en"},
+	})
+}
+
+// london is the record of the first network of the test database
+var london = map[string]interface{}{
+	"country":   map[string]interface{}{"iso_code": "GB"},
+	"continent": map[string]interface{}{"code": "EU"},
+	"city":      map[string]interface{}{"names": map[string]interface{}{"en": "London"}},
+	"location":  map[string]interface{}{"latitude": 51.5142, "longitude": -0.0931},
+	"subdivisions": []interface{}{
+		map[string]interface{}{"iso_code": "ENG"},
+	},
+}
+
+// testNetworks are the networks of the test database. The second one
+// refers to the country of the first one with a pointer.
+var testNetworks = []network{
+	{"81.2.69.0/24", london},
+	{"2001:db8::/32", map[string]interface{}{
+		"registered_country":             pointer(bytes.Index(encode(nil, london), encode(nil, london["country"]))),
+		"autonomous_system_number":       uint64(64512),
+		"autonomous_system_organization": "Example Networks",
+	}},
+}
+
+func TestLookup(t *testing.T) {
+	r, err := FromBytes(build(t, testNetworks))
+	if err != nil {
+		t.Fatalf("FromBytes returned error: %v", err)
+	}
+	if meta := r.Metadata(); meta.DatabaseType != "Test-City" || meta.BuildEpoch.Unix() != 1700000000 || meta.Languages[0] != "en" {
+		t.Errorf("metadata is %+v", meta)
+	}
+
+	loc, found, err := r.Location(net.ParseIP("81.2.69.160"))
+	if err != nil || !found {
+		t.Fatalf("ipv4 address not found: %v", err)
+	}
+	want := Location{Country: "GB", Continent: "EU", Subdivision: "ENG", City: "London", Latitude: 51.5142, Longitude: -0.0931}
+	if loc != want {
+		t.Errorf("ipv4 location is %+v", loc)
+	}
+
+	loc, found, err = r.Location(net.ParseIP("2001:db8::1"))
+	if err != nil || !found {
+		t.Fatalf("ipv6 address not found: %v", err)
+	}
+	if loc.Country != "GB" || loc.ASN != 64512 || loc.ASOrg != "Example Networks" {
+		t.Errorf("ipv6 location is %+v", loc)
+	}
+
+	if _, found, err := r.Location(net.ParseIP("10.0.0.1")); found || err != nil {
+		t.Errorf("unknown address found: %v", err)
+	}
+}
+
+func TestInvalidDatabase(t *testing.T) {
+	if _, err := FromBytes([]byte("not a database")); err == nil {
+		t.Errorf("invalid database does not return error")
+	}
+	db := build(t, testNetworks)
+	if _, err := FromBytes(db[len(db)/2:]); err == nil {
+		t.Errorf("truncated database does not return error")
+	}
+}
+
+func TestReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.mmdb")
+	os.WriteFile(file, build(t, testNetworks[:1]), 0644)
+	db, err := OpenDB(file)
+	if err != nil {
+		t.Fatalf("OpenDB returned error: %v", err)
+	}
+	if reloaded, _ := db.Reload(); reloaded {
+		t.Errorf("unchanged database reloaded")
+	}
+	if _, found, _ := db.Location(net.ParseIP("2001:db8::1")); found {
+		t.Errorf("address found before being added")
+	}
+
+	os.WriteFile(file, build(t, testNetworks), 0644)
+	os.Chtimes(file, time.Now(), time.Now().Add(time.Minute))
+	if reloaded, err := db.Reload(); !reloaded || err != nil {
+		t.Fatalf("changed database not reloaded: %v", err)
+	}
+	if _, found, _ := db.Location(net.ParseIP("2001:db8::1")); !found {
+		t.Errorf("address not found after reload")
+	}
+
+	os.WriteFile(file, []byte("corrupt"), 0644)
+	if _, err := db.Reload(); err == nil {
+		t.Errorf("corrupt database reloaded")
+	}
+	if _, found, _ := db.Location(net.ParseIP("81.2.69.1")); !found {
+		t.Errorf("previous database not kept after a failed reload")
+	}
+	if age := db.Age(time.Unix(1700000060, 0)); age != time.Minute {
+		t.Errorf("database age is %v", age)
+	}
+}
@@ -0,0 +1,338 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// metadataMarker precedes the metadata section at the end of the file
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSectionSeparator is the size of the zeros between the search tree
+// and the data section
+const dataSectionSeparator = 16
+
+// Data types of the MaxMind DB format
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// Metadata describes a database
+type Metadata struct {
+	DatabaseType string
+	IPVersion    int
+	NodeCount    uint64
+	RecordSize   int
+	BuildEpoch   time.Time
+	Languages    []string
+}
+
+// Reader looks up IP addresses in a MaxMind DB (mmdb) file, the format
+// of the GeoIP2 and GeoLite2 databases
+type Reader struct {
+	metadata  Metadata
+	tree      []byte
+	data      []byte
+	ipv4Start uint64
+}
+
+// Open reads the database file
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := FromBytes(buf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid geoip database %s: %v", path, err)
+	}
+	return r, nil
+}
+
+// FromBytes parses a database held in memory
+func FromBytes(buf []byte) (*Reader, error) {
+	start := bytes.LastIndex(buf, metadataMarker)
+	if start < 0 {
+		return nil, errors.New("metadata not found")
+	}
+	value, _, err := decode(buf[start+len(metadataMarker):], 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %v", err)
+	}
+	meta, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("metadata is not a map")
+	}
+	r := &Reader{metadata: Metadata{
+		DatabaseType: stringValue(meta["database_type"]),
+		IPVersion:    int(uintValue(meta["ip_version"])),
+		NodeCount:    uintValue(meta["node_count"]),
+		RecordSize:   int(uintValue(meta["record_size"])),
+		BuildEpoch:   time.Unix(int64(uintValue(meta["build_epoch"])), 0),
+	}}
+	if languages, ok := meta["languages"].([]interface{}); ok {
+		for _, language := range languages {
+			r.metadata.Languages = append(r.metadata.Languages, stringValue(language))
+		}
+	}
+	switch r.metadata.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", r.metadata.RecordSize)
+	}
+	if r.metadata.IPVersion != 4 && r.metadata.IPVersion != 6 {
+		return nil, fmt.Errorf("unsupported ip version %d", r.metadata.IPVersion)
+	}
+	treeSize := r.metadata.NodeCount * uint64(r.metadata.RecordSize) / 4
+	if treeSize+dataSectionSeparator > uint64(start) {
+		return nil, errors.New("search tree larger than the file")
+	}
+	r.tree = buf[:treeSize]
+	r.data = buf[treeSize+dataSectionSeparator : start]
+	if r.metadata.IPVersion == 6 {
+		node := uint64(0)
+		for i := 0; i < 96 && node < r.metadata.NodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// Metadata returns the metadata of the database
+func (r *Reader) Metadata() Metadata {
+	return r.metadata
+}
+
+// Lookup returns the record of the network containing the address, and
+// false if there is none. Maps are decoded as map[string]interface{},
+// arrays as []interface{} and unsigned integers as uint64.
+func (r *Reader) Lookup(ip net.IP) (interface{}, bool, error) {
+	node, bits := uint64(0), ip.To4()
+	if bits != nil {
+		node = r.ipv4Start
+	} else if bits = ip.To16(); bits == nil {
+		return nil, false, fmt.Errorf("invalid ip address %v", ip)
+	} else if r.metadata.IPVersion == 4 {
+		return nil, false, fmt.Errorf("ipv6 address %v in an ipv4 database", ip)
+	}
+	nodeCount := r.metadata.NodeCount
+	for i := 0; i < len(bits)*8 && node < nodeCount; i++ {
+		bit := (bits[i/8] >> (7 - uint(i%8))) & 1
+		node = r.record(node, bit)
+	}
+	switch {
+	case node == nodeCount:
+		return nil, false, nil
+	case node < nodeCount:
+		return nil, false, errors.New("invalid search tree")
+	}
+	offset := node - nodeCount - dataSectionSeparator
+	if offset >= uint64(len(r.data)) {
+		return nil, false, errors.New("invalid data pointer in search tree")
+	}
+	value, _, err := decode(r.data, uint(offset), 0)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of the node
+func (r *Reader) record(node uint64, bit byte) uint64 {
+	switch r.metadata.RecordSize {
+	case 24:
+		b := r.tree[node*6+uint64(bit)*3:]
+		return uint64(b[0])<<16 | uint64(b[1])<<8 | uint64(b[2])
+	case 28:
+		b := r.tree[node*7:]
+		if bit == 0 {
+			return uint64(b[3]&0xf0)<<20 | uint64(b[0])<<16 | uint64(b[1])<<8 | uint64(b[2])
+		}
+		return uint64(b[3]&0x0f)<<24 | uint64(b[4])<<16 | uint64(b[5])<<8 | uint64(b[6])
+	default:
+		return uint64(binary.BigEndian.Uint32(r.tree[node*8+uint64(bit)*4:]))
+	}
+}
+
+// maxDepth bounds the nesting of the decoded values, so a corrupt file
+// cannot loop on pointers
+const maxDepth = 32
+
+// decode decodes the value at offset of the section and returns it
+// with the offset that follows it
+func decode(section []byte, offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, errors.New("data nested too deep")
+	}
+	read := func(n uint) ([]byte, error) {
+		if offset+n > uint(len(section)) {
+			return nil, errors.New("unexpected end of data")
+		}
+		b := section[offset : offset+n]
+		offset += n
+		return b, nil
+	}
+	b, err := read(1)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrl := b[0]
+	kind := int(ctrl >> 5)
+	if kind == typePointer {
+		return decodePointer(section, ctrl, offset, depth)
+	}
+	if kind == typeExtended {
+		if b, err = read(1); err != nil {
+			return nil, 0, err
+		}
+		kind = 7 + int(b[0])
+	}
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		if b, err = read(size - 28); err != nil {
+			return nil, 0, err
+		}
+		switch size {
+		case 29:
+			size = 29 + uint(b[0])
+		case 30:
+			size = 285 + uint(b[0])<<8 | uint(b[1])
+		default:
+			size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+		}
+	}
+
+	switch kind {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := decode(section, offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			value, next, err := decode(section, next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[stringValue(key)] = value
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := decode(section, offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEndMarker:
+		return nil, offset, nil
+	}
+
+	if b, err = read(size); err != nil {
+		return nil, 0, err
+	}
+	switch kind {
+	case typeString:
+		return string(b), offset, nil
+	case typeBytes:
+		return append([]byte(nil), b...), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("invalid integer size %d", size)
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, offset, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid integer size %d", size)
+		}
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int32(v), offset, nil
+	case typeUint128:
+		return new(big.Int).SetBytes(b), offset, nil
+	}
+	return nil, 0, fmt.Errorf("unknown data type %d", kind)
+}
+
+// decodePointer decodes the value pointed to by the pointer whose
+// control byte is ctrl
+func decodePointer(section []byte, ctrl byte, offset uint, depth int) (interface{}, uint, error) {
+	n := uint(ctrl>>3&0x3) + 1
+	if offset+n > uint(len(section)) {
+		return nil, 0, errors.New("unexpected end of data")
+	}
+	b := section[offset : offset+n]
+	var target uint
+	if n < 4 {
+		target = uint(ctrl & 0x7)
+	}
+	for _, c := range b {
+		target = target<<8 | uint(c)
+	}
+	switch n {
+	case 2:
+		target += 2048
+	case 3:
+		target += 526336
+	}
+	value, _, err := decode(section, target, depth+1)
+	return value, offset + n, err
+}
+
+// stringValue returns v if it is a string
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// uintValue returns v if it is an unsigned integer
+func uintValue(v interface{}) uint64 {
+	u, _ := v.(uint64)
+	return u
+}
@@ -0,0 +1,10 @@
+/*
+Package grpcmodel defines the gRPC service of the out-of-process model
+plugins of kind grpc, so models written in any language, such as
+Python or Rust, can be used without loading them in the WACE process.
+The service is defined in model.proto, from which the clients and
+servers of other languages are generated.
+*/
+package grpcmodel
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative model.proto
@@ -0,0 +1,52 @@
+package grpcmodel
+
+import (
+	"context"
+
+	"github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+)
+
+// Handshake is the go-plugin handshake between WACE and the model
+// plugins of kind subprocess. The protocol version changes when the
+// Model service changes incompatibly.
+var Handshake = plugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "WACE_MODEL_PLUGIN",
+	MagicCookieValue: "6f1c2a9e-wace-model",
+}
+
+// PluginName is the name of the Model service in the go-plugin plugin
+// maps
+const PluginName = "model"
+
+// Plugin serves and dispenses the Model service over go-plugin
+type Plugin struct {
+	plugin.NetRPCUnsupportedPlugin
+	// Impl is the model served by the plugin executable
+	Impl ModelServer
+}
+
+// GRPCServer registers the model in the plugin gRPC server
+func (p *Plugin) GRPCServer(_ *plugin.GRPCBroker, s *grpc.Server) error {
+	RegisterModelServer(s, p.Impl)
+	return nil
+}
+
+// GRPCClient returns the client of the model served by the plugin
+func (p *Plugin) GRPCClient(_ context.Context, _ *plugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
+	return NewModelClient(c), nil
+}
+
+// PluginMap is the plugin map of WACE, dispensing PluginName
+var PluginMap = map[string]plugin.Plugin{PluginName: &Plugin{}}
+
+// Serve serves the model from the main function of a plugin executable
+// run by WACE as a subprocess. It does not return.
+func Serve(impl ModelServer) {
+	plugin.Serve(&plugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         map[string]plugin.Plugin{PluginName: &Plugin{Impl: impl}},
+		GRPCServer:      plugin.DefaultGRPCServer,
+	})
+}
@@ -0,0 +1,23 @@
+package wace
+
+import (
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+)
+
+// modelHints returns the hints of the model results with an action,
+// by model plugin ID
+func modelHints(results map[string]pm.ModelResults) map[string][]pm.Hint {
+	var hints map[string][]pm.Hint
+	for modelID, res := range results {
+		for _, hint := range res.Hints {
+			if hint.Action == "" {
+				continue
+			}
+			if hints == nil {
+				hints = make(map[string][]pm.Hint)
+			}
+			hints[modelID] = append(hints[modelID], hint)
+		}
+	}
+	return hints
+}
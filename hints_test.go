@@ -0,0 +1,58 @@
+package wace
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestVerdictHints(t *testing.T) {
+	err := pm.RegisterModel("hintsbot", nil, func(input pm.ModelInput) (pm.ModelResults, error) {
+		return pm.ModelResults{ProbAttack: 0.3, Hints: []pm.Hint{
+			{Action: pm.HintAddHeader, Target: "X-Captcha", Value: "required"},
+			{Target: "ignored"},
+		}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inConf cf.ConfigFileData
+	err = yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: bot
+    kind: builtin
+    builtin: hintsbot
+    plugintype: RequestHeaders
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("hints", conf, testMeter)
+
+	id := generateRandomID()
+	engine.InitTransaction(id)
+	defer CloseTransaction(id)
+	if err := Analyze("RequestHeaders", id, "GET / HTTP/1.1\n", []string{"bot"}); err != nil {
+		t.Fatalf("Analyze returned error: %v", err)
+	}
+	verdict, err := CheckTransactionVerdict(id, "combiner", nil)
+	if err != nil {
+		t.Fatalf("CheckTransactionVerdict returned error: %v", err)
+	}
+	hints := verdict.Hints["bot"]
+	if len(verdict.Hints) != 1 || len(hints) != 1 || hints[0] != (pm.Hint{Action: pm.HintAddHeader, Target: "X-Captcha", Value: "required"}) {
+		t.Errorf("verdict hints are %+v", verdict.Hints)
+	}
+}
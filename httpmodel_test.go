@@ -0,0 +1,54 @@
+package wace
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestHTTPModel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(pm.ModelResults{ProbAttack: 0.9})
+	}))
+	defer server.Close()
+
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(fmt.Sprintf(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: rest
+    kind: http
+    url: %s
+    plugintype: RequestBody
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`, server.URL)), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("httpmodel", conf, testMeter)
+	id := generateRandomID()
+	engine.InitTransaction(id)
+	defer CloseTransaction(id)
+
+	if err := Analyze("RequestBody", id, "q=1' OR '1'='1", []string{"rest"}); err != nil {
+		t.Fatalf("Analyze returned error: %v", err)
+	}
+	block, err := CheckTransaction(id, "combiner", nil)
+	if err != nil || !block {
+		t.Errorf("transaction scored by the http model not blocked: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Package httpmsg represents an HTTP request or response with its parts
+kept apart: the HTTP/2 pseudo-headers, the headers, the body and the
+trailers. It lets connectors of HTTP/2 and gRPC traffic give the models
+structured input, and still provides the HTTP/1 style text that the
+models reading raw payloads expect.
+*/
+package httpmsg
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Field is a header, trailer or pseudo-header
+type Field struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Message is an HTTP request or response
+type Message struct {
+	// Proto is the protocol version, e.g. HTTP/2
+	Proto string `json:"proto,omitempty"`
+	// Pseudo holds the pseudo-headers, with their leading colon:
+	// :method, :scheme, :authority and :path of a request, or :status
+	// of a response
+	Pseudo   []Field `json:"pseudo,omitempty"`
+	Headers  []Field `json:"headers,omitempty"`
+	Body     string  `json:"body,omitempty"`
+	Trailers []Field `json:"trailers,omitempty"`
+}
+
+// get returns the value of the first field with the given name,
+// ignoring case
+func get(fields []Field, name string) string {
+	for _, f := range fields {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// PseudoHeader returns the value of the pseudo-header, e.g. ":path"
+func (m Message) PseudoHeader(name string) string {
+	return get(m.Pseudo, name)
+}
+
+// Header returns the value of the first header with the given name
+func (m Message) Header(name string) string {
+	return get(m.Headers, name)
+}
+
+// Trailer returns the value of the first trailer with the given name
+func (m Message) Trailer(name string) string {
+	return get(m.Trailers, name)
+}
+
+// IsResponse returns true if the message has a :status pseudo-header
+func (m Message) IsResponse() bool {
+	return m.PseudoHeader(":status") != ""
+}
+
+// IsGRPC returns true if the message has a gRPC content type
+func (m Message) IsGRPC() bool {
+	return strings.HasPrefix(strings.ToLower(m.Header("content-type")), "application/grpc")
+}
+
+// GRPCStatus returns the grpc-status code and grpc-message of a gRPC
+// response, read from its trailers or, for a trailers-only response,
+// from its headers. It returns false if there is no status.
+func (m Message) GRPCStatus() (int, string, bool) {
+	fields := m.Trailers
+	if get(fields, "grpc-status") == "" {
+		fields = m.Headers
+	}
+	code, err := strconv.Atoi(get(fields, "grpc-status"))
+	if err != nil {
+		return 0, "", false
+	}
+	return code, get(fields, "grpc-message"), true
+}
+
+// StartLine returns the HTTP/1 style request or status line built from
+// the pseudo-headers
+func (m Message) StartLine() string {
+	proto := m.Proto
+	if proto == "" {
+		proto = "HTTP/2"
+	}
+	if m.IsResponse() {
+		return proto + " " + m.PseudoHeader(":status")
+	}
+	return m.PseudoHeader(":method") + " " + m.PseudoHeader(":path") + " " + proto
+}
+
+// HeaderBlock returns the start line and the headers, one per line.
+// The :authority pseudo-header is given as a Host header if there is
+// none.
+func (m Message) HeaderBlock() string {
+	var b strings.Builder
+	b.WriteString(m.StartLine() + "\n")
+	if authority := m.PseudoHeader(":authority"); authority != "" && m.Header("host") == "" {
+		b.WriteString("host: " + authority + "\n")
+	}
+	writeFields(&b, m.Headers)
+	return b.String()
+}
+
+// TrailerBlock returns the trailers, one per line
+func (m Message) TrailerBlock() string {
+	var b strings.Builder
+	writeFields(&b, m.Trailers)
+	return b.String()
+}
+
+// String returns the whole message in HTTP/1 style: the header block,
+// an empty line, the body and the trailers, if any
+func (m Message) String() string {
+	s := m.HeaderBlock() + "\n" + m.Body
+	if len(m.Trailers) > 0 {
+		if !strings.HasSuffix(s, "\n") {
+			s += "\n"
+		}
+		s += m.TrailerBlock()
+	}
+	return s
+}
+
+// writeFields writes the fields, one per line
+func writeFields(b *strings.Builder, fields []Field) {
+	for _, f := range fields {
+		b.WriteString(f.Name + ": " + f.Value + "\n")
+	}
+}
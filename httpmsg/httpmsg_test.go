@@ -0,0 +1,42 @@
+package httpmsg
+
+import "testing"
+
+var grpcResponse = Message{
+	Pseudo:   []Field{{":status", "200"}},
+	Headers:  []Field{{"content-type", "application/grpc+proto"}},
+	Body:     "\x00\x00\x00\x00\x02\x08\x01",
+	Trailers: []Field{{"grpc-status", "7"}, {"grpc-message", "permission denied"}},
+}
+
+func TestHeaderBlock(t *testing.T) {
+	request := Message{
+		Pseudo:  []Field{{":method", "POST"}, {":scheme", "https"}, {":authority", "api.example.com"}, {":path", "/pkg.Service/Call"}},
+		Headers: []Field{{"content-type", "application/grpc"}, {"te", "trailers"}},
+	}
+	want := "POST /pkg.Service/Call HTTP/2\nhost: api.example.com\ncontent-type: application/grpc\nte: trailers\n"
+	if block := request.HeaderBlock(); block != want {
+		t.Errorf("request header block is %q", block)
+	}
+	if request.IsResponse() || !request.IsGRPC() {
+		t.Errorf("request not recognized as a gRPC request")
+	}
+	if block := grpcResponse.TrailerBlock(); block != "grpc-status: 7\ngrpc-message: permission denied\n" {
+		t.Errorf("trailer block is %q", block)
+	}
+}
+
+func TestGRPCStatus(t *testing.T) {
+	code, msg, ok := grpcResponse.GRPCStatus()
+	if !ok || code != 7 || msg != "permission denied" {
+		t.Errorf("grpc status is %d %q %t", code, msg, ok)
+	}
+
+	trailersOnly := Message{Pseudo: []Field{{":status", "200"}}, Headers: []Field{{"Grpc-Status", "0"}}}
+	if code, _, ok := trailersOnly.GRPCStatus(); !ok || code != 0 {
+		t.Errorf("trailers-only grpc status is %d %t", code, ok)
+	}
+	if _, _, ok := (Message{}).GRPCStatus(); ok {
+		t.Errorf("message without status has a grpc status")
+	}
+}
@@ -0,0 +1,157 @@
+package wace
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Misuses of the transaction lifecycle by the connector
+const (
+	// MisuseNotInitialized is a call on a transaction before
+	// InitTransaction
+	MisuseNotInitialized = "not_initialized"
+	// MisuseClosed is a call on a transaction after CloseTransaction
+	MisuseClosed = "closed"
+	// MisuseDoubleInit is an InitTransaction of an open transaction
+	MisuseDoubleInit = "double_init"
+	// MisuseDoubleClose is a CloseTransaction of a closed transaction
+	MisuseDoubleClose = "double_close"
+	// MisuseNoEngine is an InitTransaction before Init, or with an
+	// engine without plugins
+	MisuseNoEngine = "no_engine"
+)
+
+// LifecycleError reports a call of the connector that does not follow
+// the InitTransaction, Analyze, CheckTransaction and CloseTransaction
+// lifecycle of a transaction
+type LifecycleError struct {
+	// Op is the function called, e.g. Analyze
+	Op            string
+	TransactionID string
+	// Misuse is one of the Misuse constants
+	Misuse string
+}
+
+func (e *LifecycleError) Error() string {
+	switch e.Misuse {
+	case MisuseNotInitialized:
+		return fmt.Sprintf("%s: transaction %s was not initialized", e.Op, e.TransactionID)
+	case MisuseClosed:
+		return fmt.Sprintf("%s: transaction %s is closed", e.Op, e.TransactionID)
+	case MisuseDoubleInit:
+		return fmt.Sprintf("%s: transaction %s is already initialized", e.Op, e.TransactionID)
+	case MisuseDoubleClose:
+		return fmt.Sprintf("%s: transaction %s is already closed", e.Op, e.TransactionID)
+	case MisuseNoEngine:
+		return fmt.Sprintf("%s: transaction %s has no engine, wace is not initialized", e.Op, e.TransactionID)
+	}
+	return fmt.Sprintf("%s: transaction %s misused: %s", e.Op, e.TransactionID, e.Misuse)
+}
+
+// misuseHandler is the function given to SetMisuseHandler
+var misuseHandler atomic.Pointer[func(*LifecycleError)]
+
+// SetMisuseHandler sets a function called with every misuse of the
+// transaction lifecycle detected, including those of the functions
+// that return no error such as CloseTransaction, so connector bugs can
+// be caught in tests and staging, e.g. by panicking. A nil function
+// removes the handler. The misuses are also logged and counted in
+// wace.transaction.misuse.total.
+func SetMisuseHandler(fn func(*LifecycleError)) {
+	if fn == nil {
+		misuseHandler.Store(nil)
+		return
+	}
+	misuseHandler.Store(&fn)
+}
+
+// closedTransactionsKept is the number of recently closed transaction
+// IDs remembered to tell the calls after CloseTransaction from those
+// before InitTransaction
+const closedTransactionsKept = 4096
+
+// closedTransactions are the IDs of the recently closed transactions,
+// the oldest forgotten first
+type closedTransactions struct {
+	mutex sync.Mutex
+	ids   map[string]struct{}
+	ring  []string
+	next  int
+}
+
+// add remembers that the transaction was closed, and returns the
+// transaction forgotten to make room for it, if any
+func (c *closedTransactions) add(transactionID string) (forgotten string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.ring) < closedTransactionsKept {
+		c.ring = append(c.ring, transactionID)
+	} else {
+		forgotten = c.ring[c.next]
+		delete(c.ids, forgotten)
+		c.ring[c.next] = transactionID
+		c.next = (c.next + 1) % closedTransactionsKept
+	}
+	c.ids[transactionID] = struct{}{}
+	return forgotten
+}
+
+// remove forgets that the transaction was closed, when its ID is
+// reused. Its slot in the ring is freed when overwritten.
+func (c *closedTransactions) remove(transactionID string) {
+	c.mutex.Lock()
+	delete(c.ids, transactionID)
+	c.mutex.Unlock()
+}
+
+// contains returns true if the transaction was closed recently
+func (c *closedTransactions) contains(transactionID string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_, ok := c.ids[transactionID]
+	return ok
+}
+
+// transactionOpen returns true if the transaction was initialized and
+// not closed yet
+func (c *Core) transactionOpen(transactionID string) bool {
+	_, ok := c.analysisMap.Load(transactionID)
+	return ok
+}
+
+// checkOpen returns a *LifecycleError, reporting it, if the
+// transaction is not open for op
+func (c *Core) checkOpen(op, transactionID string) error {
+	if c.transactionOpen(transactionID) {
+		return nil
+	}
+	if c.recentlyClosed.contains(transactionID) {
+		return c.reportMisuse(op, transactionID, MisuseClosed)
+	}
+	return c.reportMisuse(op, transactionID, MisuseNotInitialized)
+}
+
+// reportMisuse logs and counts the misuse, passes it to the misuse
+// handler and returns it
+func (c *Core) reportMisuse(op, transactionID, misuse string) *LifecycleError {
+	err := &LifecycleError{Op: op, TransactionID: transactionID, Misuse: misuse}
+	lg.Get().Printf(lg.WARN, "| %s | core | %v", c.scope(transactionID), err)
+	if inst, attributes := c.transactionMetrics(transactionID); inst != nil {
+		counter, cErr := inst.Int64Counter("wace.transaction.misuse.total", metric.WithDescription("Number of calls misusing the transaction lifecycle"))
+		if cErr == nil {
+			counter.Add(ctx, 1, metric.WithAttributes(append(attributes,
+				attribute.String("op", op),
+				attribute.String("misuse", misuse))...))
+		}
+	}
+	if handler := misuseHandler.Load(); handler != nil {
+		(*handler)(err)
+	}
+	return err
+}
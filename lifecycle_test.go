@@ -0,0 +1,100 @@
+package wace
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLifecycleMisuse(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: protocol
+    kind: builtin
+    plugintype: RequestHeaders
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("lifecycle", conf, testMeter)
+
+	var reported []*LifecycleError
+	SetMisuseHandler(func(err *LifecycleError) { reported = append(reported, err) })
+	defer SetMisuseHandler(nil)
+
+	misuse := func(err error, op, kind string) {
+		t.Helper()
+		var lifecycleErr *LifecycleError
+		if !errors.As(err, &lifecycleErr) || lifecycleErr.Op != op || lifecycleErr.Misuse != kind {
+			t.Errorf("%s returned %v, want %s misuse", op, err, kind)
+		}
+	}
+
+	id := generateRandomID()
+	_, err = CheckTransaction(id, "combiner", nil)
+	misuse(err, "CheckTransaction", MisuseNotInitialized)
+	misuse(Analyze("RequestHeaders", id, "GET / HTTP/1.1\n", []string{"protocol"}), "Analyze", MisuseNotInitialized)
+
+	engine.InitTransaction(id)
+	engine.InitTransaction(id)
+	if err := Analyze("RequestHeaders", id, "GET / HTTP/1.1\n", []string{"protocol"}); err != nil {
+		t.Errorf("Analyze of an open transaction returned error: %v", err)
+	}
+	CloseTransaction(id)
+	CloseTransaction(id)
+
+	misuse(Analyze("RequestHeaders", id, "GET / HTTP/1.1\n", []string{"protocol"}), "Analyze", MisuseClosed)
+	misuse(AnalyzeWithMeta("RequestHeaders", id, "GET / HTTP/1.1\n", []string{"protocol"}, nil), "AnalyzeWithMeta", MisuseClosed)
+	_, err = CheckTransactionCombined(id, []string{"combiner"}, Combination{Policy: CombineAnyBlock}, nil)
+	misuse(err, "CheckTransactionCombined", MisuseClosed)
+	if engine.transactionOpen(id) {
+		t.Errorf("Analyze after CloseTransaction reopened the transaction")
+	}
+
+	var kinds []string
+	for _, err := range reported {
+		kinds = append(kinds, err.Op+"/"+err.Misuse)
+	}
+	want := []string{
+		"CheckTransaction/not_initialized", "Analyze/not_initialized",
+		"InitTransaction/double_init", "CloseTransaction/double_close",
+		"Analyze/closed", "AnalyzeWithMeta/closed", "CheckTransactionCombined/closed",
+	}
+	if len(kinds) != len(want) {
+		t.Fatalf("reported misuses %v, want %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Errorf("reported misuses %v, want %v", kinds, want)
+			break
+		}
+	}
+}
+
+func TestClosedTransactions(t *testing.T) {
+	c := &closedTransactions{ids: make(map[string]struct{})}
+	for i := 0; i <= closedTransactionsKept; i++ {
+		c.add(strconv.Itoa(i))
+	}
+	if c.contains("0") || !c.contains("1") || len(c.ids) != closedTransactionsKept {
+		t.Errorf("oldest closed transaction not forgotten")
+	}
+	c.remove("1")
+	if c.contains("1") {
+		t.Errorf("reused transaction ID still closed")
+	}
+}
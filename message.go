@@ -0,0 +1,52 @@
+package wace
+
+import (
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"github.com/tiroa-tilsor/wacelib/httpmsg"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// AnalyzeMessage is like AnalyzeWithReceipt, for connectors that keep
+// the parts of a message apart, such as HTTP/2 and gRPC connectors.
+// The models get the part of msg of the given type in HTTP/1 style as
+// their payload, and msg itself in the Message field of their input,
+// with the pseudo-headers and the trailers apart.
+func AnalyzeMessage(modelsTypeAsString, transactionId string, msg httpmsg.Message, models []string) (*Receipt, error) {
+	return coreOf(transactionId).AnalyzeMessage(modelsTypeAsString, transactionId, msg, models)
+}
+
+// AnalyzeMessage is like the AnalyzeMessage function
+func (c *Core) AnalyzeMessage(modelsTypeAsString, transactionId string, msg httpmsg.Message, models []string) (*Receipt, error) {
+	if err := c.checkOpen("AnalyzeMessage", transactionId); err != nil {
+		return doneReceipt(), err
+	}
+	modelsType, err := cf.StringToPluginType(modelsTypeAsString)
+	if err != nil {
+		c.tprintf(lg.ERROR, transactionId, "core | %s is not a valid type", modelsTypeAsString)
+		return doneReceipt(), err
+	}
+	return c.analyzeMessage(modelsType, transactionId, msg, models)
+}
+
+// analyzeMessage analyzes the part of the message of the given type in
+// the open transaction
+func (c *Core) analyzeMessage(modelsType cf.ModelPluginType, transactionId string, msg httpmsg.Message, models []string) (*Receipt, error) {
+	c.pluginsOf(transactionId).manager.SetTransactionMessage(c.scope(transactionId), modelsType, msg)
+	return c.AnalyzeWithReceipt(modelsType.String(), transactionId, messagePayload(modelsType, msg), models)
+}
+
+// messagePayload returns the part of the message of the given type in
+// HTTP/1 style
+func messagePayload(t cf.ModelPluginType, msg httpmsg.Message) string {
+	switch t {
+	case cf.RequestHeaders, cf.ResponseHeaders:
+		return msg.HeaderBlock()
+	case cf.RequestBody, cf.ResponseBody:
+		return msg.Body
+	case cf.RequestTrailers, cf.ResponseTrailers:
+		return msg.TrailerBlock()
+	default:
+		return msg.String()
+	}
+}
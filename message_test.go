@@ -0,0 +1,27 @@
+package wace
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"github.com/tiroa-tilsor/wacelib/httpmsg"
+)
+
+func TestMessagePayload(t *testing.T) {
+	msg := httpmsg.Message{
+		Pseudo:   []httpmsg.Field{{Name: ":status", Value: "200"}},
+		Headers:  []httpmsg.Field{{Name: "content-type", Value: "application/grpc"}},
+		Body:     "payload",
+		Trailers: []httpmsg.Field{{Name: "grpc-status", Value: "0"}},
+	}
+	for tp, want := range map[cf.ModelPluginType]string{
+		cf.ResponseHeaders:  "HTTP/2 200\ncontent-type: application/grpc\n",
+		cf.ResponseBody:     "payload",
+		cf.ResponseTrailers: "grpc-status: 0\n",
+		cf.AllResponse:      "HTTP/2 200\ncontent-type: application/grpc\n\npayload\ngrpc-status: 0\n",
+	} {
+		if payload := messagePayload(tp, msg); payload != want {
+			t.Errorf("%s payload is %q", tp, payload)
+		}
+	}
+}
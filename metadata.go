@@ -0,0 +1,205 @@
+package wace
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tiroa-tilsor/wacelib/baseline"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"github.com/tiroa-tilsor/wacelib/fingerprint"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+	"github.com/tiroa-tilsor/wacelib/statestore"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// Metadata keys set by the core when fingerprinting is enabled
+const (
+	MetaFingerprint         = "fingerprint"
+	MetaFingerprintEndpoint = "fingerprint.endpoint"
+	MetaFingerprintParams   = "fingerprint.params"
+	MetaFingerprintHeaders  = "fingerprint.headers"
+	MetaFingerprintNovel    = "fingerprint.novel"
+	MetaBaselineAnomalies   = "baseline.anomalies"
+)
+
+// fingerprintKeyPrefix prefixes the state store keys of the known
+// request shapes of each endpoint
+const fingerprintKeyPrefix = "fingerprint/"
+
+// transactionMetadata guards the metadata of a transaction
+type transactionMetadata struct {
+	mutex  sync.RWMutex
+	values map[string]string
+}
+
+// fingerprintRecord is stored for every request shape seen on an endpoint
+type fingerprintRecord struct {
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Count     int
+}
+
+var (
+	store      statestore.Store = statestore.NewMemory()
+	storeMutex sync.RWMutex
+)
+
+// SetStateStore replaces the state store used by the core. The default
+// is an in-process memory store. It must be called before Init.
+func SetStateStore(s statestore.Store) {
+	storeMutex.Lock()
+	store = s
+	storeMutex.Unlock()
+}
+
+// StateStore returns the state store used by the core
+func StateStore() statestore.Store {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+	return store
+}
+
+// stateStore returns the state store of the core: the named cores keep
+// their keys under their name, apart from those of the other cores
+func (c *Core) stateStore() statestore.Store {
+	if c.name == "" {
+		return StateStore()
+	}
+	return statestore.WithPrefix(StateStore(), "cores/"+c.name+"/")
+}
+
+// setMetadata sets metadata values of the transaction, pseudonymizing
+// the client identifiers
+func (c *Core) setMetadata(transactionID string, values map[string]string) {
+	c.storeMetadata(transactionID, c.pseudonymize(transactionID, values))
+}
+
+// storeMetadata adds the already pseudonymized values to the metadata
+// of the transaction
+func (c *Core) storeMetadata(transactionID string, values map[string]string) {
+	value, _ := c.metadataMap.LoadOrStore(transactionID, &transactionMetadata{values: make(map[string]string)})
+	meta := value.(*transactionMetadata)
+	meta.mutex.Lock()
+	for k, v := range values {
+		meta.values[k] = v
+	}
+	meta.mutex.Unlock()
+}
+
+// TransactionMetadata returns a copy of the metadata of the transaction
+func TransactionMetadata(transactionID string) map[string]string {
+	return coreOf(transactionID).TransactionMetadata(transactionID)
+}
+
+// TransactionMetadata is like the TransactionMetadata function
+func (c *Core) TransactionMetadata(transactionID string) map[string]string {
+	value, ok := c.metadataMap.Load(transactionID)
+	if !ok {
+		return map[string]string{}
+	}
+	meta := value.(*transactionMetadata)
+	meta.mutex.RLock()
+	defer meta.mutex.RUnlock()
+	values := make(map[string]string, len(meta.values))
+	for k, v := range meta.values {
+		values[k] = v
+	}
+	return values
+}
+
+// TransactionScratch returns the scratch space where the plugins
+// analyzing the transaction share intermediate features. Connectors can
+// also publish the features they already computed in it.
+func TransactionScratch(transactionID string) *pm.Scratch {
+	return coreOf(transactionID).TransactionScratch(transactionID)
+}
+
+// TransactionScratch is like the TransactionScratch function
+func (c *Core) TransactionScratch(transactionID string) *pm.Scratch {
+	return c.pluginsOf(transactionID).manager.TransactionScratch(c.scope(transactionID))
+}
+
+// fingerprintTransaction computes the fingerprint of the request part
+// of the payload, stores it in the transaction metadata and records the
+// request shape of the endpoint in the state store
+func (c *Core) fingerprintTransaction(transactionID string, modelsType cf.ModelPluginType, payload string) {
+	conf := c.config()
+	if !conf.Fingerprinting {
+		return
+	}
+	if modelsType != cf.RequestHeaders && modelsType != cf.AllRequest && modelsType != cf.Everything {
+		return
+	}
+	fp := fingerprint.Compute(payload)
+	novel := c.recordFingerprint(transactionID, fp, conf.FingerprintTTL)
+	c.setMetadata(transactionID, map[string]string{
+		MetaFingerprint:         fp.Hash,
+		MetaFingerprintEndpoint: fp.Endpoint(),
+		MetaFingerprintParams:   strings.Join(fp.ParamNames, ","),
+		MetaFingerprintHeaders:  fp.HeaderShapeHash,
+		MetaFingerprintNovel:    strconv.FormatBool(novel),
+	})
+	c.tprintf(lg.DEBUG, transactionID, "core | fingerprint %s of %s (novel: %t)", fp.Hash, fp.Endpoint(), novel)
+}
+
+// recordFingerprint stores the request shape of the endpoint and
+// returns true if it had not been seen before
+func (c *Core) recordFingerprint(transactionID string, fp fingerprint.Fingerprint, ttl time.Duration) bool {
+	s := c.stateStore()
+	key := fingerprintKeyPrefix + fp.Endpoint() + "/" + fp.Hash
+	now := time.Now()
+	record := fingerprintRecord{FirstSeen: now}
+	value, found, err := s.Get(key)
+	if err != nil {
+		c.tprintf(lg.WARN, transactionID, "core | could not read fingerprint from state store: %v", err)
+	} else if found {
+		json.Unmarshal(value, &record)
+	}
+	record.LastSeen = now
+	record.Count++
+	value, _ = json.Marshal(record)
+	if err := s.Set(key, value, ttl); err != nil {
+		c.tprintf(lg.WARN, transactionID, "core | could not store fingerprint in state store: %v", err)
+	}
+	return !found
+}
+
+// learnTransaction adds the request to the baseline of its endpoint
+// while learning, and once the learning period is over reports in the
+// transaction metadata how the request departs from the baseline.
+// Learning never changes the verdicts.
+func (c *Core) learnTransaction(transactionID string, modelsType cf.ModelPluginType, payload string) {
+	learner := c.learner.Load()
+	if learner == nil {
+		return
+	}
+	if modelsType != cf.RequestHeaders && modelsType != cf.AllRequest && modelsType != cf.Everything {
+		return
+	}
+	fp := fingerprint.Compute(payload)
+	obs := baseline.Observation{
+		Endpoint:    fp.Endpoint(),
+		PayloadSize: baseline.PayloadSize(payload),
+		ParamNames:  fp.ParamNames,
+		ContentType: baseline.ContentType(payload),
+	}
+	if learner.Learning() {
+		if err := learner.Observe(obs); err != nil {
+			c.tprintf(lg.WARN, transactionID, "core | could not update baseline of %s: %v", obs.Endpoint, err)
+		}
+		return
+	}
+	b, found, err := learner.Get(obs.Endpoint)
+	if err != nil {
+		c.tprintf(lg.WARN, transactionID, "core | could not read baseline of %s: %v", obs.Endpoint, err)
+		return
+	}
+	if !found {
+		b = baseline.Baseline{}
+	}
+	c.setMetadata(transactionID, map[string]string{MetaBaselineAnomalies: strings.Join(b.Anomalies(obs), ",")})
+}
@@ -0,0 +1,53 @@
+package wace
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"github.com/tiroa-tilsor/wacelib/statestore"
+)
+
+func TestFingerprintTransaction(t *testing.T) {
+	setFingerprinting := func(enabled bool) {
+		cf.Update(func(conf *cf.ConfigStore) error {
+			conf.Fingerprinting = enabled
+			return nil
+		})
+	}
+	setFingerprinting(true)
+	defer setFingerprinting(false)
+	SetStateStore(statestore.NewMemory())
+
+	first, second := generateRandomID(), generateRandomID()
+	defer defaultCore.metadataMap.Delete(first)
+	defer defaultCore.metadataMap.Delete(second)
+
+	defaultCore.fingerprintTransaction(first, cf.RequestHeaders, "GET /users/1?id=1 HTTP/1.1\nHost: example.com\n")
+	defaultCore.fingerprintTransaction(second, cf.RequestHeaders, "GET /users/2?id=7 HTTP/1.1\nHost: example.org\n")
+
+	meta := TransactionMetadata(first)
+	if meta[MetaFingerprintEndpoint] != "GET /users/{int}" || meta[MetaFingerprintParams] != "id" {
+		t.Errorf("unexpected fingerprint metadata %v", meta)
+	}
+	if meta[MetaFingerprintNovel] != "true" {
+		t.Errorf("first request shape not reported as novel")
+	}
+	if TransactionMetadata(second)[MetaFingerprintNovel] != "false" {
+		t.Errorf("known request shape reported as novel")
+	}
+
+	keys, _ := StateStore().Keys(fingerprintKeyPrefix)
+	if len(keys) != 1 {
+		t.Errorf("state store has %d fingerprints, expected 1", len(keys))
+	}
+
+	// a named core keeps the request shapes it saw apart
+	named := newCore("named", "named/", nil)
+	named.fingerprintTransaction(first, cf.RequestHeaders, "GET /users/3?id=2 HTTP/1.1\nHost: example.com\n")
+	if named.TransactionMetadata(first)[MetaFingerprintNovel] != "true" {
+		t.Errorf("request shape seen by the default core not novel to a named core")
+	}
+	if keys, _ := StateStore().Keys("cores/named/" + fingerprintKeyPrefix); len(keys) != 1 {
+		t.Errorf("state store has %d fingerprints of the named core, expected 1", len(keys))
+	}
+}
@@ -0,0 +1,158 @@
+package wace
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestModelTimeout(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: fast
+    kind: builtin
+    builtin: simulated
+    plugintype: RequestHeaders
+    timeout: 1s
+  - id: slow
+    kind: builtin
+    builtin: simulated
+    plugintype: RequestHeaders
+    params:
+      latency: 300ms
+    timeout: 20ms
+  - id: dependent
+    kind: builtin
+    builtin: simulated
+    plugintype: RequestHeaders
+    dependson: [slow]
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	reader := metric.NewManualReader()
+	engine := NewCore("modeltimeout", conf, metric.NewMeterProvider(metric.WithReader(reader)).Meter("modeltimeout"))
+	id := generateRandomID()
+	engine.InitTransaction(id)
+	defer CloseTransaction(id)
+
+	start := time.Now()
+	Analyze("RequestHeaders", id, "GET / HTTP/1.1\n", []string{"fast", "slow", "dependent"})
+	if _, err := CheckTransaction(id, "combiner", nil); err != nil {
+		t.Fatalf("CheckTransaction returned error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("check waited %v for the model that timed out", elapsed)
+	}
+	res, _ := GetTransactionResults(id)
+	if _, ok := res.Results["fast"]; !ok || len(res.Results) != 1 {
+		t.Errorf("results are %v, expected only the fast model", res.Results)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect returned error: %v", err)
+	}
+	timeouts := int64(0)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		if m.Name == "wace.model.timeout.total" {
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				timeouts += dp.Value
+			}
+		}
+	}
+	if timeouts != 1 {
+		t.Errorf("%d model timeouts counted, expected 1", timeouts)
+	}
+}
+
+func TestModelRetries(t *testing.T) {
+	var calls atomic.Int32
+	err := pm.RegisterModel("flaky", nil, func(input pm.ModelInput) (pm.ModelResults, error) {
+		switch calls.Add(1) {
+		case 1:
+			return pm.ModelResults{}, fmt.Errorf("model overloaded")
+		case 2:
+			time.Sleep(300 * time.Millisecond)
+		}
+		return pm.ModelResults{ProbAttack: 0.9}, nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterModel returned error: %v", err)
+	}
+	var inConf cf.ConfigFileData
+	err = yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: flaky
+    kind: builtin
+    plugintype: RequestHeaders
+    timeout: 50ms
+    retries: 2
+    retrybackoff: 10ms
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if deadline := conf.ModelDeadline("flaky"); deadline != 180*time.Millisecond {
+		t.Errorf("model deadline is %v", deadline)
+	}
+	reader := metric.NewManualReader()
+	engine := NewCore("modelretries", conf, metric.NewMeterProvider(metric.WithReader(reader)).Meter("modelretries"))
+	id := generateRandomID()
+	engine.InitTransaction(id)
+	defer CloseTransaction(id)
+
+	// the call failing and the call timing out are retried
+	Analyze("RequestHeaders", id, "GET / HTTP/1.1\n", []string{"flaky"})
+	if _, err := CheckTransaction(id, "combiner", nil); err != nil {
+		t.Fatalf("CheckTransaction returned error: %v", err)
+	}
+	res, _ := GetTransactionResults(id)
+	if r, ok := res.Results["flaky"]; !ok || r.ProbAttack != 0.9 || calls.Load() != 3 {
+		t.Errorf("results are %v after %d calls", res.Results, calls.Load())
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect returned error: %v", err)
+	}
+	retries := int64(0)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		if m.Name == "wace.model.retry.total" {
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				retries += dp.Value
+			}
+		}
+	}
+	if retries != 2 {
+		t.Errorf("%d model retries counted, expected 2", retries)
+	}
+}
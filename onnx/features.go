@@ -0,0 +1,160 @@
+package onnx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Tokenizers of a Preprocessor
+const (
+	// TokenizerChars hashes the character n-grams of the payload, as
+	// the char analyzer of scikit-learn
+	TokenizerChars = "chars"
+	// TokenizerWords hashes the words of two or more characters of the
+	// payload, as the word analyzer of scikit-learn
+	TokenizerWords = "words"
+	// TokenizerBytes gives the bytes of the payload, scaled to [0, 1]
+	// and zero padded, to the models of byte sequences
+	TokenizerBytes = "bytes"
+)
+
+// Preprocessor turns a payload into the features given to a model
+type Preprocessor struct {
+	// Tokenizer is TokenizerChars, TokenizerWords or TokenizerBytes
+	Tokenizer string
+	// NGram is the length of the character n-grams of TokenizerChars
+	NGram int
+	// Features is the number of features
+	Features int
+	// Lowercase lowercases the payload before tokenizing it
+	Lowercase bool
+	// URLDecode decodes the percent-encoded characters of the payload
+	// before tokenizing it
+	URLDecode bool
+}
+
+// wordPattern matches the words of the word analyzer of scikit-learn
+var wordPattern = regexp.MustCompile(`\b\w\w+\b`)
+
+// whitespace matches the runs of whitespace collapsed by the char
+// analyzer of scikit-learn
+var whitespace = regexp.MustCompile(`\s\s+`)
+
+// Check returns an error if the preprocessor is not valid
+func (p Preprocessor) Check() error {
+	switch p.Tokenizer {
+	case TokenizerChars:
+		if p.NGram < 1 {
+			return fmt.Errorf("invalid n-gram length %d", p.NGram)
+		}
+	case TokenizerWords, TokenizerBytes:
+	default:
+		return fmt.Errorf("invalid tokenizer %s", p.Tokenizer)
+	}
+	if p.Features < 1 {
+		return fmt.Errorf("invalid number of features %d", p.Features)
+	}
+	return nil
+}
+
+// Transform returns the features of the payload. The hashing tokenizers
+// give the features of scikit-learn's HashingVectorizer with the same
+// analyzer, n_features and lowercase options, and its default
+// alternate_sign and l2 norm.
+func (p Preprocessor) Transform(payload string) []float32 {
+	if p.URLDecode {
+		if decoded, err := url.QueryUnescape(payload); err == nil {
+			payload = decoded
+		}
+	}
+	if p.Lowercase {
+		payload = strings.ToLower(payload)
+	}
+	features := make([]float32, p.Features)
+	if p.Tokenizer == TokenizerBytes {
+		for i := 0; i < len(payload) && i < p.Features; i++ {
+			features[i] = float32(payload[i]) / 255
+		}
+		return features
+	}
+
+	var tokens []string
+	if p.Tokenizer == TokenizerWords {
+		tokens = wordPattern.FindAllString(payload, -1)
+	} else {
+		runes := []rune(whitespace.ReplaceAllString(payload, " "))
+		for i := 0; i+p.NGram <= len(runes); i++ {
+			tokens = append(tokens, string(runes[i:i+p.NGram]))
+		}
+	}
+	for _, token := range tokens {
+		h := int32(murmur3([]byte(token), 0))
+		index := int(h) % p.Features
+		if index < 0 {
+			index = -index
+		}
+		if h == math.MinInt32 {
+			index = (math.MaxInt32 - (p.Features - 1)) % p.Features
+		}
+		if h >= 0 {
+			features[index]++
+		} else {
+			features[index]--
+		}
+	}
+	var norm float64
+	for _, f := range features {
+		norm += float64(f) * float64(f)
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range features {
+			features[i] = float32(float64(features[i]) / norm)
+		}
+	}
+	return features
+}
+
+// murmur3 returns the 32-bit MurmurHash3 of data, as used by
+// scikit-learn for feature hashing
+func murmur3(data []byte, seed uint32) uint32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+	h := seed
+	n := len(data) / 4 * 4
+	for i := 0; i < n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+	var k uint32
+	switch len(data) - n {
+	case 3:
+		k ^= uint32(data[n+2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(data[n+1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(data[n])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
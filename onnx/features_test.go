@@ -0,0 +1,62 @@
+package onnx
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMurmur3(t *testing.T) {
+	// reference values of the mmh3 python package used by scikit-learn
+	for s, want := range map[string]int32{"": 0, "foo": -156908512, "hello": 613153351} {
+		if h := int32(murmur3([]byte(s), 0)); h != want {
+			t.Errorf("murmur3 of %q is %d, want %d", s, h, want)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	words := Preprocessor{Tokenizer: TokenizerWords, Features: 8, Lowercase: true}
+	// foo hashes to -156908512, which is 0 modulo 8
+	features := words.Transform("FOO a")
+	if features[0] != -1 {
+		t.Errorf("features are %v, want -1 at 0", features)
+	}
+
+	chars := Preprocessor{Tokenizer: TokenizerChars, NGram: 3, Features: 1 << 10, URLDecode: true}
+	features = chars.Transform("union%20select%201")
+	var norm float64
+	for _, f := range features {
+		norm += float64(f) * float64(f)
+	}
+	if math.Abs(norm-1) > 1e-6 {
+		t.Errorf("features norm is %v, want 1", norm)
+	}
+	if decoded := chars.Transform("union select 1"); !equal(decoded, features) {
+		t.Errorf("url decoded payload has other features")
+	}
+
+	bytes := Preprocessor{Tokenizer: TokenizerBytes, Features: 4}
+	features = bytes.Transform("\xff\x00")
+	if !equal(features, []float32{1, 0, 0, 0}) {
+		t.Errorf("byte features are %v", features)
+	}
+
+	if err := (Preprocessor{Tokenizer: "sentences", Features: 4}).Check(); err == nil {
+		t.Errorf("invalid tokenizer does not return error")
+	}
+	if err := (Preprocessor{Tokenizer: TokenizerChars, Features: 4}).Check(); err == nil {
+		t.Errorf("char tokenizer without n-gram length does not return error")
+	}
+}
+
+func equal(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
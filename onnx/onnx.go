@@ -0,0 +1,502 @@
+/*
+Package onnx runs simple ONNX classifiers in pure Go, so that they can be
+used as model plugins without an external inference server or a custom
+plugin. It decodes the ONNX model file itself and evaluates its graph
+with the operators of small neural networks and linear models: Gemm,
+MatMul, Add, Sub, Mul, Div, Relu, LeakyRelu, Sigmoid, Tanh, Softmax,
+Flatten, Reshape, Identity, Dropout and Constant, on float tensors.
+Models using other operators are rejected when loaded.
+
+The payloads are turned into the input tensor of the model by a
+Preprocessor, whose hashing tokenizers match the HashingVectorizer of
+scikit-learn.
+*/
+package onnx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Tensor is a dense float tensor in row-major order
+type Tensor struct {
+	Shape []int
+	Data  []float32
+}
+
+// size returns the number of elements of a tensor of the given shape
+func size(shape []int) int {
+	n := 1
+	for _, d := range shape {
+		n *= d
+	}
+	return n
+}
+
+// ValueInfo describes an input or output of the graph. The dimensions
+// that are not fixed, such as the batch size, are -1.
+type ValueInfo struct {
+	Name  string
+	Shape []int
+}
+
+// attribute is an attribute of a node
+type attribute struct {
+	f      float32
+	i      int64
+	t      *Tensor
+	floats []float32
+	ints   []int64
+}
+
+// node is an operator of the graph
+type node struct {
+	op      string
+	domain  string
+	inputs  []string
+	outputs []string
+	attrs   map[string]attribute
+}
+
+// Model is a loaded ONNX model. It is safe for concurrent use.
+type Model struct {
+	Inputs  []ValueInfo
+	Outputs []ValueInfo
+	// Opset is the version of the default operator set of the model
+	Opset        int64
+	nodes        []node
+	initializers map[string]Tensor
+}
+
+// ONNX tensor data types
+const (
+	typeFloat  = 1
+	typeInt32  = 6
+	typeInt64  = 7
+	typeDouble = 11
+)
+
+// Load loads the ONNX model file at path
+func Load(path string) (*Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes an ONNX model and checks that it can be run
+func Parse(data []byte) (*Model, error) {
+	m := &Model{initializers: make(map[string]Tensor)}
+	var graph []byte
+	err := fields(data, func(num protowire.Number, v []byte, x uint64) error {
+		switch num {
+		case 7:
+			graph = v
+		case 8:
+			var domain string
+			var version int64
+			if err := fields(v, func(num protowire.Number, v []byte, x uint64) error {
+				switch num {
+				case 1:
+					domain = string(v)
+				case 2:
+					version = int64(x)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			if domain == "" || domain == "ai.onnx" {
+				m.Opset = version
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid model: %v", err)
+	}
+	if graph == nil {
+		return nil, fmt.Errorf("invalid model: no graph")
+	}
+	if err := m.parseGraph(graph); err != nil {
+		return nil, fmt.Errorf("invalid graph: %v", err)
+	}
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseGraph decodes the graph of the model
+func (m *Model) parseGraph(data []byte) error {
+	var inputs []ValueInfo
+	err := fields(data, func(num protowire.Number, v []byte, x uint64) error {
+		switch num {
+		case 1:
+			n, err := parseNode(v)
+			if err != nil {
+				return err
+			}
+			m.nodes = append(m.nodes, n)
+		case 5:
+			name, t, err := parseTensor(v)
+			if err != nil {
+				return err
+			}
+			m.initializers[name] = t
+		case 11, 12:
+			info, err := parseValueInfo(v)
+			if err != nil {
+				return err
+			}
+			if num == 11 {
+				inputs = append(inputs, info)
+			} else {
+				m.Outputs = append(m.Outputs, info)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// the initializers may also be listed as inputs
+	for _, info := range inputs {
+		if _, ok := m.initializers[info.Name]; !ok {
+			m.Inputs = append(m.Inputs, info)
+		}
+	}
+	return nil
+}
+
+// check returns an error if the model uses unsupported operators, or
+// values that are never produced
+func (m *Model) check() error {
+	if len(m.Inputs) == 0 || len(m.Outputs) == 0 {
+		return fmt.Errorf("model without inputs or outputs")
+	}
+	defined := make(map[string]bool)
+	for name := range m.initializers {
+		defined[name] = true
+	}
+	for _, info := range m.Inputs {
+		defined[info.Name] = true
+	}
+	for _, n := range m.nodes {
+		if n.domain != "" && n.domain != "ai.onnx" {
+			return fmt.Errorf("operator %s of domain %s is not supported", n.op, n.domain)
+		}
+		if _, ok := operators[n.op]; !ok {
+			return fmt.Errorf("operator %s is not supported", n.op)
+		}
+		for _, input := range n.inputs {
+			if input != "" && !defined[input] {
+				return fmt.Errorf("%s operator input %s is not defined", n.op, input)
+			}
+		}
+		for _, output := range n.outputs {
+			defined[output] = true
+		}
+	}
+	for _, info := range m.Outputs {
+		if !defined[info.Name] {
+			return fmt.Errorf("output %s is not produced", info.Name)
+		}
+	}
+	return nil
+}
+
+// Run evaluates the graph with the given inputs, by name, and returns
+// its outputs by name
+func (m *Model) Run(inputs map[string]Tensor) (map[string]Tensor, error) {
+	values := make(map[string]Tensor, len(m.initializers)+len(inputs)+len(m.nodes))
+	for name, t := range m.initializers {
+		values[name] = t
+	}
+	for _, info := range m.Inputs {
+		t, ok := inputs[info.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing input %s", info.Name)
+		}
+		if len(t.Data) != size(t.Shape) {
+			return nil, fmt.Errorf("input %s has %d values for shape %v", info.Name, len(t.Data), t.Shape)
+		}
+		values[info.Name] = t
+	}
+	for _, n := range m.nodes {
+		args := make([]*Tensor, len(n.inputs))
+		for i, name := range n.inputs {
+			if name != "" {
+				t := values[name]
+				args[i] = &t
+			}
+		}
+		results, err := operators[n.op](m, n, args)
+		if err != nil {
+			return nil, fmt.Errorf("%s operator: %v", n.op, err)
+		}
+		for i, name := range n.outputs {
+			if i < len(results) && name != "" {
+				values[name] = results[i]
+			}
+		}
+	}
+	outputs := make(map[string]Tensor, len(m.Outputs))
+	for _, info := range m.Outputs {
+		outputs[info.Name] = values[info.Name]
+	}
+	return outputs, nil
+}
+
+// fields calls fn with the number and value of every field of the
+// protobuf message: v for the length delimited fields, x for the others
+func fields(data []byte, fn func(num protowire.Number, v []byte, x uint64) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		var v []byte
+		var x uint64
+		switch typ {
+		case protowire.VarintType:
+			x, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed32Type:
+			var x32 uint32
+			x32, n = protowire.ConsumeFixed32(data)
+			x = uint64(x32)
+		case protowire.Fixed64Type:
+			x, n = protowire.ConsumeFixed64(data)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := fn(num, v, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// varints decodes a packed repeated varint field, or appends the value
+// of an unpacked one
+func varints(list []int64, v []byte, x uint64) ([]int64, error) {
+	if v == nil {
+		return append(list, int64(x)), nil
+	}
+	for len(v) > 0 {
+		x, n := protowire.ConsumeVarint(v)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		list = append(list, int64(x))
+		v = v[n:]
+	}
+	return list, nil
+}
+
+// floats decodes a packed repeated float field, or appends the value
+// of an unpacked one
+func floats(list []float32, v []byte, x uint64) ([]float32, error) {
+	if v == nil {
+		return append(list, math.Float32frombits(uint32(x))), nil
+	}
+	if len(v)%4 != 0 {
+		return nil, fmt.Errorf("invalid packed floats")
+	}
+	for i := 0; i < len(v); i += 4 {
+		list = append(list, math.Float32frombits(binary.LittleEndian.Uint32(v[i:])))
+	}
+	return list, nil
+}
+
+// parseNode decodes a NodeProto
+func parseNode(data []byte) (node, error) {
+	n := node{attrs: make(map[string]attribute)}
+	err := fields(data, func(num protowire.Number, v []byte, x uint64) error {
+		switch num {
+		case 1:
+			n.inputs = append(n.inputs, string(v))
+		case 2:
+			n.outputs = append(n.outputs, string(v))
+		case 4:
+			n.op = string(v)
+		case 5:
+			name, attr, err := parseAttribute(v)
+			if err != nil {
+				return err
+			}
+			n.attrs[name] = attr
+		case 7:
+			n.domain = string(v)
+		}
+		return nil
+	})
+	return n, err
+}
+
+// parseAttribute decodes an AttributeProto
+func parseAttribute(data []byte) (string, attribute, error) {
+	var name string
+	var attr attribute
+	err := fields(data, func(num protowire.Number, v []byte, x uint64) error {
+		var err error
+		switch num {
+		case 1:
+			name = string(v)
+		case 2:
+			attr.f = math.Float32frombits(uint32(x))
+		case 3:
+			attr.i = int64(x)
+		case 5:
+			var t Tensor
+			_, t, err = parseTensor(v)
+			attr.t = &t
+		case 7:
+			attr.floats, err = floats(attr.floats, v, x)
+		case 8:
+			attr.ints, err = varints(attr.ints, v, x)
+		}
+		return err
+	})
+	return name, attr, err
+}
+
+// parseTensor decodes a TensorProto, converting its values to floats
+func parseTensor(data []byte) (string, Tensor, error) {
+	var name string
+	var dims, ints []int64
+	var values []float32
+	var doubles []float64
+	var raw []byte
+	dataType := int64(typeFloat)
+	err := fields(data, func(num protowire.Number, v []byte, x uint64) error {
+		var err error
+		switch num {
+		case 1:
+			dims, err = varints(dims, v, x)
+		case 2:
+			dataType = int64(x)
+		case 4:
+			values, err = floats(values, v, x)
+		case 5, 7:
+			ints, err = varints(ints, v, x)
+		case 8:
+			name = string(v)
+		case 9:
+			raw = v
+		case 10:
+			if v == nil {
+				doubles = append(doubles, math.Float64frombits(x))
+				break
+			}
+			if len(v)%8 != 0 {
+				return fmt.Errorf("invalid packed doubles")
+			}
+			for i := 0; i < len(v); i += 8 {
+				doubles = append(doubles, math.Float64frombits(binary.LittleEndian.Uint64(v[i:])))
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return "", Tensor{}, err
+	}
+
+	t := Tensor{Shape: make([]int, len(dims))}
+	for i, d := range dims {
+		t.Shape[i] = int(d)
+	}
+	switch dataType {
+	case typeFloat:
+		if raw != nil {
+			values, err = floats(nil, raw, 0)
+			if err != nil {
+				return "", Tensor{}, err
+			}
+		}
+		t.Data = values
+	case typeDouble:
+		if raw != nil {
+			for i := 0; i+8 <= len(raw); i += 8 {
+				doubles = append(doubles, math.Float64frombits(binary.LittleEndian.Uint64(raw[i:])))
+			}
+		}
+		for _, d := range doubles {
+			t.Data = append(t.Data, float32(d))
+		}
+	case typeInt32, typeInt64:
+		if raw != nil {
+			width := 8
+			if dataType == typeInt32 {
+				width = 4
+			}
+			for i := 0; i+width <= len(raw); i += width {
+				if width == 4 {
+					ints = append(ints, int64(int32(binary.LittleEndian.Uint32(raw[i:]))))
+				} else {
+					ints = append(ints, int64(binary.LittleEndian.Uint64(raw[i:])))
+				}
+			}
+		}
+		for _, i := range ints {
+			t.Data = append(t.Data, float32(i))
+		}
+	default:
+		return "", Tensor{}, fmt.Errorf("tensor %s of data type %d is not supported", name, dataType)
+	}
+	if len(t.Data) != size(t.Shape) {
+		return "", Tensor{}, fmt.Errorf("tensor %s has %d values for shape %v", name, len(t.Data), t.Shape)
+	}
+	return name, t, nil
+}
+
+// parseValueInfo decodes a ValueInfoProto with a tensor type
+func parseValueInfo(data []byte) (ValueInfo, error) {
+	var info ValueInfo
+	err := fields(data, func(num protowire.Number, v []byte, x uint64) error {
+		switch num {
+		case 1:
+			info.Name = string(v)
+		case 2:
+			// TypeProto.tensor_type.shape.dim
+			return fields(v, func(num protowire.Number, v []byte, x uint64) error {
+				if num != 1 {
+					return nil
+				}
+				return fields(v, func(num protowire.Number, v []byte, x uint64) error {
+					if num != 2 {
+						return nil
+					}
+					return fields(v, func(num protowire.Number, v []byte, x uint64) error {
+						if num != 1 {
+							return nil
+						}
+						dim := -1
+						fields(v, func(num protowire.Number, v []byte, x uint64) error {
+							if num == 1 && int64(x) > 0 {
+								dim = int(x)
+							}
+							return nil
+						})
+						info.Shape = append(info.Shape, dim)
+						return nil
+					})
+				})
+			})
+		}
+		return nil
+	})
+	return info, err
+}
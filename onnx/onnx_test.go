@@ -0,0 +1,236 @@
+package onnx
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// message encodes the fields of a protobuf message, appended by fns
+func message(fns ...func([]byte) []byte) []byte {
+	var b []byte
+	for _, fn := range fns {
+		b = fn(b)
+	}
+	return b
+}
+
+func bytesField(num protowire.Number, v []byte) func([]byte) []byte {
+	return func(b []byte) []byte {
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, v)
+	}
+}
+
+func stringField(num protowire.Number, s string) func([]byte) []byte {
+	return bytesField(num, []byte(s))
+}
+
+func varintField(num protowire.Number, x int64) func([]byte) []byte {
+	return func(b []byte) []byte {
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(x))
+	}
+}
+
+func floatField(num protowire.Number, f float32) func([]byte) []byte {
+	return func(b []byte) []byte {
+		b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+		return protowire.AppendFixed32(b, math.Float32bits(f))
+	}
+}
+
+// tensor encodes a float TensorProto, with its values as raw data
+func tensor(name string, dims []int64, values ...float32) []byte {
+	fns := []func([]byte) []byte{stringField(8, name), varintField(2, typeFloat)}
+	for _, d := range dims {
+		fns = append(fns, varintField(1, d))
+	}
+	raw := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(raw[4*i:], math.Float32bits(v))
+	}
+	return message(append(fns, bytesField(9, raw))...)
+}
+
+// valueInfo encodes a ValueInfoProto of a float tensor, with dims of -1
+// as a named dimension
+func valueInfo(name string, dims ...int64) []byte {
+	var shape []func([]byte) []byte
+	for _, d := range dims {
+		if d < 0 {
+			shape = append(shape, bytesField(1, message(stringField(2, "N"))))
+		} else {
+			shape = append(shape, bytesField(1, message(varintField(1, d))))
+		}
+	}
+	tensorType := message(varintField(1, typeFloat), bytesField(2, message(shape...)))
+	return message(stringField(1, name), bytesField(2, message(bytesField(1, tensorType))))
+}
+
+// nodeProto encodes a NodeProto
+func nodeProto(op string, inputs, outputs []string, attrs ...[]byte) []byte {
+	var fns []func([]byte) []byte
+	for _, input := range inputs {
+		fns = append(fns, stringField(1, input))
+	}
+	for _, output := range outputs {
+		fns = append(fns, stringField(2, output))
+	}
+	fns = append(fns, stringField(4, op))
+	for _, attr := range attrs {
+		fns = append(fns, bytesField(5, attr))
+	}
+	return message(fns...)
+}
+
+// model encodes a ModelProto of the given opset with a graph of the
+// given fields
+func model(opset int64, graph ...func([]byte) []byte) []byte {
+	return message(
+		varintField(1, 8),
+		bytesField(7, message(graph...)),
+		bytesField(8, message(varintField(2, opset))),
+	)
+}
+
+func TestLogisticRegression(t *testing.T) {
+	data := model(13,
+		bytesField(1, nodeProto("MatMul", []string{"x", "w"}, []string{"z"})),
+		bytesField(1, nodeProto("Add", []string{"z", "b"}, []string{"logit"})),
+		bytesField(1, nodeProto("Sigmoid", []string{"logit"}, []string{"p"})),
+		bytesField(5, tensor("w", []int64{3, 1}, 1, -2, 0.5)),
+		bytesField(5, message(stringField(8, "b"), varintField(2, typeFloat), varintField(1, 1), floatField(4, -0.5))),
+		bytesField(11, valueInfo("x", -1, 3)),
+		bytesField(11, valueInfo("w", 3, 1)),
+		bytesField(12, valueInfo("p", -1, 1)),
+	)
+	m, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if len(m.Inputs) != 1 || m.Inputs[0].Name != "x" || m.Inputs[0].Shape[0] != -1 || m.Inputs[0].Shape[1] != 3 {
+		t.Errorf("inputs decoded as %+v", m.Inputs)
+	}
+	if m.Opset != 13 {
+		t.Errorf("opset decoded as %d", m.Opset)
+	}
+
+	outputs, err := m.Run(map[string]Tensor{"x": {Shape: []int{2, 3}, Data: []float32{1, 0, 1, 0, 1, 0}}})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	p := outputs["p"]
+	// logits 1 + 0.5 - 0.5 = 1 and -2 - 0.5 = -2.5
+	want := []float64{1 / (1 + math.Exp(-1)), 1 / (1 + math.Exp(2.5))}
+	if len(p.Data) != 2 || p.Shape[0] != 2 || p.Shape[1] != 1 {
+		t.Fatalf("output is %+v", p)
+	}
+	for i := range want {
+		if math.Abs(float64(p.Data[i])-want[i]) > 1e-6 {
+			t.Errorf("probability %d is %v, want %v", i, p.Data[i], want[i])
+		}
+	}
+
+	if _, err := m.Run(map[string]Tensor{"x": {Shape: []int{1, 4}, Data: []float32{1, 2, 3, 4}}}); err == nil {
+		t.Errorf("input of the wrong shape does not return error")
+	}
+	if _, err := m.Run(nil); err == nil {
+		t.Errorf("missing input does not return error")
+	}
+}
+
+func TestMLP(t *testing.T) {
+	transB := message(stringField(1, "transB"), varintField(3, 1))
+	data := model(13,
+		bytesField(1, nodeProto("Flatten", []string{"x"}, []string{"flat"})),
+		bytesField(1, nodeProto("Gemm", []string{"flat", "w1", "b1"}, []string{"h"}, transB)),
+		bytesField(1, nodeProto("Relu", []string{"h"}, []string{"r"})),
+		bytesField(1, nodeProto("Gemm", []string{"r", "w2"}, []string{"logits"})),
+		bytesField(1, nodeProto("Softmax", []string{"logits"}, []string{"probs"})),
+		bytesField(5, tensor("w1", []int64{2, 2}, 1, 0, 0, -1)),
+		bytesField(5, tensor("b1", []int64{2}, 0, 1)),
+		bytesField(5, tensor("w2", []int64{2, 2}, 0, 1, 1, 0)),
+		bytesField(11, valueInfo("x", 1, 2)),
+		bytesField(12, valueInfo("probs", 1, 2)),
+	)
+	m, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	outputs, err := m.Run(map[string]Tensor{"x": {Shape: []int{1, 2}, Data: []float32{2, 3}}})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	// h = [2, -3 + 1], r = [2, 0], logits = [0, 2]
+	probs := outputs["probs"].Data
+	want := 1 / (1 + math.Exp(-2))
+	if len(probs) != 2 || math.Abs(float64(probs[1])-want) > 1e-6 || math.Abs(float64(probs[0]+probs[1])-1) > 1e-6 {
+		t.Errorf("probabilities are %v, want [%v %v]", probs, 1-want, want)
+	}
+}
+
+func TestReshape(t *testing.T) {
+	shape := message(stringField(8, "shape"), varintField(2, typeInt64), varintField(1, 2), varintField(7, 0), varintField(7, -1))
+	data := model(13,
+		bytesField(1, nodeProto("Reshape", []string{"x", "shape"}, []string{"y"})),
+		bytesField(5, shape),
+		bytesField(11, valueInfo("x", 2, 3)),
+		bytesField(12, valueInfo("y", 2, 3)),
+	)
+	m, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	outputs, err := m.Run(map[string]Tensor{"x": {Shape: []int{2, 3}, Data: make([]float32, 6)}})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if y := outputs["y"]; len(y.Shape) != 2 || y.Shape[0] != 2 || y.Shape[1] != 3 {
+		t.Errorf("reshaped to %v", y.Shape)
+	}
+}
+
+func TestUnsupportedModel(t *testing.T) {
+	data := model(13,
+		bytesField(1, nodeProto("LSTM", []string{"x"}, []string{"y"})),
+		bytesField(11, valueInfo("x", 1, 2)),
+		bytesField(12, valueInfo("y", 1, 2)),
+	)
+	if _, err := Parse(data); err == nil {
+		t.Errorf("model with an unsupported operator does not return error")
+	}
+
+	data = model(13,
+		bytesField(1, nodeProto("Relu", []string{"missing"}, []string{"y"})),
+		bytesField(11, valueInfo("x", 1, 2)),
+		bytesField(12, valueInfo("y", 1, 2)),
+	)
+	if _, err := Parse(data); err == nil {
+		t.Errorf("model with an undefined input does not return error")
+	}
+
+	if _, err := Parse([]byte("not a model")); err == nil {
+		t.Errorf("invalid model does not return error")
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	a := Tensor{Shape: []int{2, 3}, Data: []float32{1, 2, 3, 4, 5, 6}}
+	b := Tensor{Shape: []int{3}, Data: []float32{10, 20, 30}}
+	out, err := broadcast(a, b, func(x, y float32) float32 { return x + y })
+	if err != nil {
+		t.Fatalf("broadcast returned error: %v", err)
+	}
+	want := []float32{11, 22, 33, 14, 25, 36}
+	for i := range want {
+		if out.Data[i] != want[i] {
+			t.Fatalf("broadcast sum is %v, want %v", out.Data, want)
+		}
+	}
+	if _, err := broadcast(a, Tensor{Shape: []int{2}, Data: []float32{1, 2}}, nil); err == nil {
+		t.Errorf("incompatible shapes do not return error")
+	}
+}
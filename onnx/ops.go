@@ -0,0 +1,371 @@
+package onnx
+
+import (
+	"fmt"
+	"math"
+)
+
+// operator evaluates a node with its input tensors, nil for the
+// optional inputs not given, and returns its outputs
+type operator func(m *Model, n node, args []*Tensor) ([]Tensor, error)
+
+// operators are the supported operators, by type
+var operators = map[string]operator{
+	"Gemm":      gemm,
+	"MatMul":    matMul,
+	"Add":       elementwise(func(x, y float32) float32 { return x + y }),
+	"Sub":       elementwise(func(x, y float32) float32 { return x - y }),
+	"Mul":       elementwise(func(x, y float32) float32 { return x * y }),
+	"Div":       elementwise(func(x, y float32) float32 { return x / y }),
+	"Relu":      unary(func(x float32, _ node) float32 { return float32(math.Max(float64(x), 0)) }),
+	"LeakyRelu": unary(leakyRelu),
+	"Sigmoid":   unary(func(x float32, _ node) float32 { return float32(1 / (1 + math.Exp(-float64(x)))) }),
+	"Tanh":      unary(func(x float32, _ node) float32 { return float32(math.Tanh(float64(x))) }),
+	"Identity":  identity,
+	"Dropout":   identity,
+	"Softmax":   softmax,
+	"Flatten":   flatten,
+	"Reshape":   reshape,
+	"Constant":  constant,
+}
+
+// arg returns the i-th input of the node, or an error if not given
+func arg(args []*Tensor, i int) (*Tensor, error) {
+	if i >= len(args) || args[i] == nil {
+		return nil, fmt.Errorf("missing input %d", i)
+	}
+	return args[i], nil
+}
+
+// intAttr returns the int attribute of the node, or def if not set
+func intAttr(n node, name string, def int64) int64 {
+	if attr, ok := n.attrs[name]; ok {
+		return attr.i
+	}
+	return def
+}
+
+// floatAttr returns the float attribute of the node, or def if not set
+func floatAttr(n node, name string, def float32) float32 {
+	if attr, ok := n.attrs[name]; ok {
+		return attr.f
+	}
+	return def
+}
+
+// unary returns the operator applying fn to every element of its input
+func unary(fn func(float32, node) float32) operator {
+	return func(m *Model, n node, args []*Tensor) ([]Tensor, error) {
+		x, err := arg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		out := Tensor{Shape: x.Shape, Data: make([]float32, len(x.Data))}
+		for i, v := range x.Data {
+			out.Data[i] = fn(v, n)
+		}
+		return []Tensor{out}, nil
+	}
+}
+
+func leakyRelu(x float32, n node) float32 {
+	if x < 0 {
+		return x * floatAttr(n, "alpha", 0.01)
+	}
+	return x
+}
+
+func identity(m *Model, n node, args []*Tensor) ([]Tensor, error) {
+	x, err := arg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return []Tensor{*x}, nil
+}
+
+// elementwise returns the operator applying fn element-wise to its two
+// inputs, broadcast as in numpy
+func elementwise(fn func(x, y float32) float32) operator {
+	return func(m *Model, n node, args []*Tensor) ([]Tensor, error) {
+		a, err := arg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		b, err := arg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		out, err := broadcast(*a, *b, fn)
+		if err != nil {
+			return nil, err
+		}
+		return []Tensor{out}, nil
+	}
+}
+
+// broadcast applies fn element-wise to a and b, broadcast as in numpy
+func broadcast(a, b Tensor, fn func(x, y float32) float32) (Tensor, error) {
+	rank := len(a.Shape)
+	if len(b.Shape) > rank {
+		rank = len(b.Shape)
+	}
+	shape := make([]int, rank)
+	aStrides, bStrides := make([]int, rank), make([]int, rank)
+	aStride, bStride := 1, 1
+	for i := rank - 1; i >= 0; i-- {
+		aDim, bDim := 1, 1
+		if j := i - rank + len(a.Shape); j >= 0 {
+			aDim = a.Shape[j]
+		}
+		if j := i - rank + len(b.Shape); j >= 0 {
+			bDim = b.Shape[j]
+		}
+		switch {
+		case aDim == bDim, bDim == 1:
+			shape[i] = aDim
+		case aDim == 1:
+			shape[i] = bDim
+		default:
+			return Tensor{}, fmt.Errorf("shapes %v and %v cannot be broadcast", a.Shape, b.Shape)
+		}
+		if aDim != 1 {
+			aStrides[i] = aStride
+		}
+		if bDim != 1 {
+			bStrides[i] = bStride
+		}
+		aStride *= aDim
+		bStride *= bDim
+	}
+
+	out := Tensor{Shape: shape, Data: make([]float32, size(shape))}
+	for i := range out.Data {
+		aOffset, bOffset := 0, 0
+		rest := i
+		for d := rank - 1; d >= 0; d-- {
+			index := rest % shape[d]
+			rest /= shape[d]
+			aOffset += index * aStrides[d]
+			bOffset += index * bStrides[d]
+		}
+		out.Data[i] = fn(a.Data[aOffset], b.Data[bOffset])
+	}
+	return out, nil
+}
+
+// matrix returns the rows and columns of a tensor of rank 1 or 2, a
+// tensor of rank 1 being a row if row is true, and a column otherwise
+func matrix(t *Tensor, row bool) (int, int, error) {
+	switch len(t.Shape) {
+	case 1:
+		if row {
+			return 1, t.Shape[0], nil
+		}
+		return t.Shape[0], 1, nil
+	case 2:
+		return t.Shape[0], t.Shape[1], nil
+	}
+	return 0, 0, fmt.Errorf("tensor of rank %d is not a matrix", len(t.Shape))
+}
+
+// multiply returns the product of the matrices a and b, transposed if
+// transA or transB
+func multiply(a *Tensor, transA bool, b *Tensor, transB bool) (Tensor, error) {
+	aRows, aCols, err := matrix(a, true)
+	if err != nil {
+		return Tensor{}, err
+	}
+	bRows, bCols, err := matrix(b, false)
+	if err != nil {
+		return Tensor{}, err
+	}
+	// element (i, k) of a is at i*aRowStride + k*aColStride
+	rows, inner, aRowStride, aColStride := aRows, aCols, aCols, 1
+	if transA {
+		rows, inner, aRowStride, aColStride = aCols, aRows, 1, aCols
+	}
+	cols, bInner, bRowStride, bColStride := bCols, bRows, bCols, 1
+	if transB {
+		cols, bInner, bRowStride, bColStride = bRows, bCols, 1, bCols
+	}
+	if inner != bInner {
+		return Tensor{}, fmt.Errorf("shapes %v and %v cannot be multiplied", a.Shape, b.Shape)
+	}
+	out := Tensor{Shape: []int{rows, cols}, Data: make([]float32, rows*cols)}
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			var sum float32
+			for k := 0; k < inner; k++ {
+				sum += a.Data[i*aRowStride+k*aColStride] * b.Data[k*bRowStride+j*bColStride]
+			}
+			out.Data[i*cols+j] = sum
+		}
+	}
+	return out, nil
+}
+
+func matMul(m *Model, n node, args []*Tensor) ([]Tensor, error) {
+	a, err := arg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	b, err := arg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	out, err := multiply(a, false, b, false)
+	if err != nil {
+		return nil, err
+	}
+	// the dimensions added to the vectors are removed
+	switch {
+	case len(a.Shape) == 1 && len(b.Shape) == 1:
+		out.Shape = []int{}
+	case len(a.Shape) == 1:
+		out.Shape = out.Shape[1:]
+	case len(b.Shape) == 1:
+		out.Shape = out.Shape[:1]
+	}
+	return []Tensor{out}, nil
+}
+
+// gemm computes alpha * A' * B' + beta * C
+func gemm(m *Model, n node, args []*Tensor) ([]Tensor, error) {
+	a, err := arg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	b, err := arg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	out, err := multiply(a, intAttr(n, "transA", 0) != 0, b, intAttr(n, "transB", 0) != 0)
+	if err != nil {
+		return nil, err
+	}
+	alpha := floatAttr(n, "alpha", 1)
+	for i := range out.Data {
+		out.Data[i] *= alpha
+	}
+	if len(args) > 2 && args[2] != nil {
+		beta := floatAttr(n, "beta", 1)
+		out, err = broadcast(out, *args[2], func(x, y float32) float32 { return x + beta*y })
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []Tensor{out}, nil
+}
+
+// axis returns the axis attribute of the node for a tensor of the
+// given rank, negative values counting from the last dimension
+func axis(n node, rank int, def int64) (int, error) {
+	a := intAttr(n, "axis", def)
+	if a < 0 {
+		a += int64(rank)
+	}
+	if a < 0 || a >= int64(rank) {
+		return 0, fmt.Errorf("axis %d out of rank %d", intAttr(n, "axis", def), rank)
+	}
+	return int(a), nil
+}
+
+// softmax normalizes the input along an axis, the last one by default
+// since opset 13 and the second one before
+func softmax(m *Model, n node, args []*Tensor) ([]Tensor, error) {
+	x, err := arg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	def := int64(-1)
+	if m.Opset > 0 && m.Opset < 13 {
+		def = 1
+	}
+	a, err := axis(n, len(x.Shape), def)
+	if err != nil {
+		return nil, err
+	}
+	length := x.Shape[a]
+	inner := size(x.Shape[a+1:])
+	outer := size(x.Shape[:a])
+	out := Tensor{Shape: x.Shape, Data: make([]float32, len(x.Data))}
+	for o := 0; o < outer; o++ {
+		for i := 0; i < inner; i++ {
+			base := o*length*inner + i
+			max := math.Inf(-1)
+			for k := 0; k < length; k++ {
+				max = math.Max(max, float64(x.Data[base+k*inner]))
+			}
+			var sum float64
+			for k := 0; k < length; k++ {
+				e := math.Exp(float64(x.Data[base+k*inner]) - max)
+				out.Data[base+k*inner] = float32(e)
+				sum += e
+			}
+			for k := 0; k < length; k++ {
+				out.Data[base+k*inner] = float32(float64(out.Data[base+k*inner]) / sum)
+			}
+		}
+	}
+	return []Tensor{out}, nil
+}
+
+func flatten(m *Model, n node, args []*Tensor) ([]Tensor, error) {
+	x, err := arg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	a := int(intAttr(n, "axis", 1))
+	if a < 0 {
+		a += len(x.Shape)
+	}
+	if a < 0 || a > len(x.Shape) {
+		return nil, fmt.Errorf("axis %d out of rank %d", a, len(x.Shape))
+	}
+	return []Tensor{{Shape: []int{size(x.Shape[:a]), size(x.Shape[a:])}, Data: x.Data}}, nil
+}
+
+// reshape gives the input the shape of its second input, where 0
+// copies the input dimension and -1 is inferred
+func reshape(m *Model, n node, args []*Tensor) ([]Tensor, error) {
+	x, err := arg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	s, err := arg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	shape := make([]int, len(s.Data))
+	inferred := -1
+	known := 1
+	for i, v := range s.Data {
+		switch d := int(v); {
+		case d == 0 && i < len(x.Shape):
+			shape[i] = x.Shape[i]
+		case d == -1 && inferred < 0:
+			inferred = i
+			continue
+		case d > 0:
+			shape[i] = d
+		default:
+			return nil, fmt.Errorf("invalid shape %v", s.Data)
+		}
+		known *= shape[i]
+	}
+	if inferred >= 0 && known > 0 {
+		shape[inferred] = len(x.Data) / known
+	}
+	if size(shape) != len(x.Data) {
+		return nil, fmt.Errorf("cannot reshape %v to %v", x.Shape, s.Data)
+	}
+	return []Tensor{{Shape: shape, Data: x.Data}}, nil
+}
+
+func constant(m *Model, n node, args []*Tensor) ([]Tensor, error) {
+	attr, ok := n.attrs["value"]
+	if !ok || attr.t == nil {
+		return nil, fmt.Errorf("only tensor values are supported")
+	}
+	return []Tensor{*attr.t}, nil
+}
@@ -0,0 +1,98 @@
+package wace
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"github.com/tiroa-tilsor/wacelib/httpmsg"
+)
+
+// AnalyzeRequestHeaders analyzes the request line and headers of the
+// open transaction with the models of the RequestHeaders type. It is
+// like AnalyzeMessage with the "RequestHeaders" type, but takes the
+// parts of the request as they are found in a net/http request, so that
+// connectors do not build the payload or name the type themselves.
+func AnalyzeRequestHeaders(transactionId, method, uri, proto string, headers http.Header, models []string) (*Receipt, error) {
+	return coreOf(transactionId).AnalyzeRequestHeaders(transactionId, method, uri, proto, headers, models)
+}
+
+// AnalyzeRequestHeaders is like the AnalyzeRequestHeaders function
+func (c *Core) AnalyzeRequestHeaders(transactionId, method, uri, proto string, headers http.Header, models []string) (*Receipt, error) {
+	if err := c.checkOpen("AnalyzeRequestHeaders", transactionId); err != nil {
+		return doneReceipt(), err
+	}
+	msg := httpmsg.Message{
+		Proto:   proto,
+		Pseudo:  []httpmsg.Field{{Name: ":method", Value: method}, {Name: ":path", Value: uri}},
+		Headers: headerFields(headers),
+	}
+	return c.analyzeMessage(cf.RequestHeaders, transactionId, msg, models)
+}
+
+// AnalyzeRequestBody analyzes the request body of the open transaction
+// with the models of the RequestBody type
+func AnalyzeRequestBody(transactionId string, body []byte, models []string) (*Receipt, error) {
+	return coreOf(transactionId).AnalyzeRequestBody(transactionId, body, models)
+}
+
+// AnalyzeRequestBody is like the AnalyzeRequestBody function
+func (c *Core) AnalyzeRequestBody(transactionId string, body []byte, models []string) (*Receipt, error) {
+	if err := c.checkOpen("AnalyzeRequestBody", transactionId); err != nil {
+		return doneReceipt(), err
+	}
+	return c.analyzeMessage(cf.RequestBody, transactionId, httpmsg.Message{Body: string(body)}, models)
+}
+
+// AnalyzeResponseHeaders analyzes the status line and headers of the
+// response of the open transaction with the models of the
+// ResponseHeaders type
+func AnalyzeResponseHeaders(transactionId, proto string, status int, headers http.Header, models []string) (*Receipt, error) {
+	return coreOf(transactionId).AnalyzeResponseHeaders(transactionId, proto, status, headers, models)
+}
+
+// AnalyzeResponseHeaders is like the AnalyzeResponseHeaders function
+func (c *Core) AnalyzeResponseHeaders(transactionId, proto string, status int, headers http.Header, models []string) (*Receipt, error) {
+	if err := c.checkOpen("AnalyzeResponseHeaders", transactionId); err != nil {
+		return doneReceipt(), err
+	}
+	msg := httpmsg.Message{
+		Proto:   proto,
+		Pseudo:  []httpmsg.Field{{Name: ":status", Value: strconv.Itoa(status)}},
+		Headers: headerFields(headers),
+	}
+	return c.analyzeMessage(cf.ResponseHeaders, transactionId, msg, models)
+}
+
+// AnalyzeResponseBody analyzes the response body of the open
+// transaction with the models of the ResponseBody type
+func AnalyzeResponseBody(transactionId string, body []byte, models []string) (*Receipt, error) {
+	return coreOf(transactionId).AnalyzeResponseBody(transactionId, body, models)
+}
+
+// AnalyzeResponseBody is like the AnalyzeResponseBody function
+func (c *Core) AnalyzeResponseBody(transactionId string, body []byte, models []string) (*Receipt, error) {
+	if err := c.checkOpen("AnalyzeResponseBody", transactionId); err != nil {
+		return doneReceipt(), err
+	}
+	return c.analyzeMessage(cf.ResponseBody, transactionId, httpmsg.Message{Body: string(body)}, models)
+}
+
+// headerFields returns the headers as fields sorted by name, so that
+// the same headers always give the same payload. The values of a
+// repeated header keep their order.
+func headerFields(headers http.Header) []httpmsg.Field {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var fields []httpmsg.Field
+	for _, name := range names {
+		for _, value := range headers[name] {
+			fields = append(fields, httpmsg.Field{Name: name, Value: value})
+		}
+	}
+	return fields
+}
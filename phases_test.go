@@ -0,0 +1,107 @@
+package wace
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestPhases(t *testing.T) {
+	var mutex sync.Mutex
+	inputs := map[string]pm.ModelInput{}
+	record := func(input pm.ModelInput) (pm.ModelResults, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		inputs[input.Payload] = input
+		return pm.ModelResults{}, nil
+	}
+	if err := pm.RegisterModel("phasesrecorder", nil, record); err != nil {
+		t.Fatal(err)
+	}
+
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: reqheaders
+    kind: builtin
+    builtin: phasesrecorder
+    plugintype: RequestHeaders
+  - id: reqbody
+    kind: builtin
+    builtin: phasesrecorder
+    plugintype: RequestBody
+  - id: respheaders
+    kind: builtin
+    builtin: phasesrecorder
+    plugintype: ResponseHeaders
+  - id: respbody
+    kind: builtin
+    builtin: phasesrecorder
+    plugintype: ResponseBody
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("phases", conf, testMeter)
+	id := generateRandomID()
+	engine.InitTransaction(id)
+	defer CloseTransaction(id)
+
+	headers := http.Header{"User-Agent": {"curl"}, "Accept": {"text/html", "*/*"}}
+	receipts := []func() (*Receipt, error){
+		func() (*Receipt, error) {
+			return AnalyzeRequestHeaders(id, "GET", "/?q=1", "HTTP/1.1", headers, []string{"reqheaders"})
+		},
+		func() (*Receipt, error) { return AnalyzeRequestBody(id, []byte("q=1"), []string{"reqbody"}) },
+		func() (*Receipt, error) {
+			return AnalyzeResponseHeaders(id, "HTTP/1.1", 404, http.Header{"Server": {"nginx"}}, []string{"respheaders"})
+		},
+		func() (*Receipt, error) { return AnalyzeResponseBody(id, []byte("not found"), []string{"respbody"}) },
+	}
+	for i, analyze := range receipts {
+		receipt, err := analyze()
+		if err != nil {
+			t.Fatalf("phase %d returned error: %v", i, err)
+		}
+		receipt.Wait()
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, payload := range []string{
+		"GET /?q=1 HTTP/1.1\nAccept: text/html\nAccept: */*\nUser-Agent: curl\n",
+		"q=1",
+		"HTTP/1.1 404\nServer: nginx\n",
+		"not found",
+	} {
+		input, ok := inputs[payload]
+		if !ok {
+			t.Errorf("no model received payload %q, got %v", payload, inputs)
+			continue
+		}
+		if input.Message == nil {
+			t.Errorf("model of payload %q received no message", payload)
+		}
+	}
+	if msg := inputs["q=1"].Message; msg == nil || msg.Body != "q=1" {
+		t.Errorf("request body message is %+v", msg)
+	}
+
+	if _, err := AnalyzeRequestBody(generateRandomID(), nil, nil); err == nil {
+		t.Errorf("analysis of a transaction not open does not return error")
+	}
+}
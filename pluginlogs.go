@@ -0,0 +1,116 @@
+package wace
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// logRouter is the output of the WACE log. It writes every line to the
+// log file, and the lines about a plugin, starting with its ID, also to
+// the log file of the plugin, if it has one.
+type logRouter struct {
+	mutex   sync.RWMutex
+	out     *os.File
+	plugins map[string]*pluginLogFile
+}
+
+// pluginLogFile is the log file of a plugin
+type pluginLogFile struct {
+	path string
+	file *os.File
+}
+
+// logOutput is the output of the WACE log opened by Init, guarded by
+// the reloadMutex of the default core
+var logOutput = &logRouter{plugins: make(map[string]*pluginLogFile)}
+
+// openLogFile opens a log file for appending
+func openLogFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_APPEND|os.O_RDWR|os.O_CREATE, 0644)
+}
+
+// setOutput makes f the WACE log file, closing the previous one
+func (r *logRouter) setOutput(f *os.File) {
+	r.mutex.Lock()
+	previous := r.out
+	r.out = f
+	r.mutex.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+}
+
+// setPluginFiles opens the log files of the plugins, mapped by their
+// IDs, and closes those no longer used. A file that cannot be opened is
+// logged, and the lines of its plugin only go to the WACE log.
+func (r *logRouter) setPluginFiles(paths map[string]string) {
+	r.mutex.RLock()
+	current := r.plugins
+	r.mutex.RUnlock()
+	plugins := make(map[string]*pluginLogFile, len(paths))
+	kept := make(map[*os.File]bool)
+	opened := make(map[string]*os.File)
+	for id, path := range paths {
+		if plf, ok := current[id]; ok && plf.path == path {
+			plugins[id] = plf
+			kept[plf.file] = true
+			continue
+		}
+		f, ok := opened[path]
+		if !ok {
+			var err error
+			if f, err = openLogFile(path); err != nil {
+				lg.Get().Printf(lg.ERROR, "| %s | could not open plugin log file: %v", id, err)
+				continue
+			}
+			opened[path] = f
+		}
+		plugins[id] = &pluginLogFile{path: path, file: f}
+	}
+	r.mutex.Lock()
+	r.plugins = plugins
+	r.mutex.Unlock()
+	for _, plf := range current {
+		if !kept[plf.file] {
+			plf.file.Close()
+		}
+	}
+}
+
+// Write writes a line of the log. The logger writes a whole line at a
+// time, starting with its date and time.
+func (r *logRouter) Write(p []byte) (int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	var out io.Writer = io.Discard
+	if r.out != nil {
+		out = r.out
+	}
+	n, err := out.Write(p)
+	if plf, ok := r.plugins[linePluginID(p)]; ok {
+		plf.file.Write(p)
+	}
+	return n, err
+}
+
+// logTimeLayout is the layout of the date and time starting the lines
+// of the log
+const logTimeLayout = "2006/01/02 15:04:05.000000"
+
+// linePluginID returns the ID the line starts with, after its date and
+// time, as in "2006/01/02 15:04:05.000000 | id | message"
+func linePluginID(line []byte) string {
+	prefix, rest, found := bytes.Cut(line, []byte(" | "))
+	if !found || len(prefix) != len(logTimeLayout) {
+		return ""
+	}
+	id, _, found := bytes.Cut(rest, []byte(" | "))
+	if !found {
+		return ""
+	}
+	return string(id)
+}
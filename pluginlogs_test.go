@@ -0,0 +1,57 @@
+package wace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPluginLogFiles(t *testing.T) {
+	dir := t.TempDir()
+	config := `---
+loglevel: DEBUG
+logpath: ` + filepath.Join(dir, "wace.log") + `
+modelplugins:
+  - id: protocol
+    kind: builtin
+    weight: 1
+    plugintype: RequestHeaders
+    logfile: ` + filepath.Join(dir, "protocol.log") + `
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`
+	if err := initilize([]byte(config)); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+	defer initilize([]byte("---\nloglevel: ERROR\nlogpath: /dev/null\n"))
+
+	pluginLog, _ := os.ReadFile(filepath.Join(dir, "protocol.log"))
+	if !strings.Contains(string(pluginLog), "| protocol | builtin protocol model loaded") || strings.Contains(string(pluginLog), "| combiner |") {
+		t.Errorf("plugin log is %q", pluginLog)
+	}
+	wacelog, _ := os.ReadFile(filepath.Join(dir, "wace.log"))
+	if !strings.Contains(string(wacelog), "| protocol | builtin protocol model loaded") || !strings.Contains(string(wacelog), "| combiner |") {
+		t.Errorf("wace log is %q", wacelog)
+	}
+
+	if err := initilize([]byte(strings.Replace(config, "    logfile: "+filepath.Join(dir, "protocol.log")+"\n", "", 1))); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+	if len(logOutput.plugins) != 0 {
+		t.Errorf("plugin log files kept open: %v", logOutput.plugins)
+	}
+}
+
+func TestLinePluginID(t *testing.T) {
+	for line, want := range map[string]string{
+		"2024/05/01 12:00:00.000000 | protocol | plugin loaded\n":            "protocol",
+		"2024/05/01 12:00:00.000000 Model: protocol | Failed to parse | x\n": "",
+		"2024/05/01 12:00:00.000000 -----WACE started-----\n":                "",
+	} {
+		if id := linePluginID([]byte(line)); id != want {
+			t.Errorf("plugin ID of %q is %q, expected %q", line, id, want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package pluginmanager
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// PluginAPIVersion is the version of the interface between WACE and the
+// shared object plugins, which is checked when they are loaded. Plugins
+// declare the version they are built against with an exported
+// PluginAPIVersion int variable or function:
+//
+//	var PluginAPIVersion = pluginmanager.PluginAPIVersion
+//
+// The plugins that do not declare it are of version 1. The versions
+// are:
+//
+//  1. Model plugins export InitPlugin and Process, or InitPluginAsync,
+//     and decision plugins export InitPlugin and a CheckResults
+//     function returning whether to block the transaction.
+//  2. The CheckResults function of decision plugins returns a
+//     DecisionResult, so they can also challenge and tag the
+//     transactions.
+const PluginAPIVersion = 2
+
+// MinPluginAPIVersion is the oldest plugin API version that WACE still
+// loads, adapting the plugins to the current interface
+const MinPluginAPIVersion = 1
+
+// pluginAPIVersion returns the API version declared by the plugin whose
+// symbols are looked up with lookup, or an error if it is not supported
+func pluginAPIVersion(lookup func(string) (plugin.Symbol, error)) (int, error) {
+	sym, err := lookup("PluginAPIVersion")
+	if err != nil {
+		return 1, nil
+	}
+	var version int
+	switch v := sym.(type) {
+	case *int:
+		version = *v
+	case func() int:
+		version = v()
+	default:
+		return 0, fmt.Errorf("invalid PluginAPIVersion type %T, expected int", sym)
+	}
+	if version < MinPluginAPIVersion || version > PluginAPIVersion {
+		return version, fmt.Errorf("plugin API version %d is not supported, expected %d to %d", version, MinPluginAPIVersion, PluginAPIVersion)
+	}
+	return version, nil
+}
+
+// decisionCheckResults returns the CheckResults function of a decision
+// plugin of the API version, adapted to the current interface
+func decisionCheckResults(version int, sym plugin.Symbol) (func(DecisionInput) (DecisionResult, error), error) {
+	if version >= 2 {
+		checkResults, ok := sym.(func(DecisionInput) (DecisionResult, error))
+		if !ok {
+			return nil, fmt.Errorf("invalid CheckResults function type %T for plugin API version %d, expected func(DecisionInput) (DecisionResult, error)", sym, version)
+		}
+		return checkResults, nil
+	}
+	checkResults, ok := sym.(func(DecisionInput) (bool, error))
+	if !ok {
+		return nil, fmt.Errorf("invalid CheckResults function type %T for plugin API version %d, expected func(DecisionInput) (bool, error)", sym, version)
+	}
+	return func(input DecisionInput) (DecisionResult, error) {
+		block, err := checkResults(input)
+		return DecisionResult{Block: block}, err
+	}, nil
+}
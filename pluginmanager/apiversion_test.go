@@ -0,0 +1,63 @@
+package pluginmanager
+
+import (
+	"errors"
+	"plugin"
+	"testing"
+)
+
+func TestPluginAPIVersion(t *testing.T) {
+	lookup := func(sym plugin.Symbol) func(string) (plugin.Symbol, error) {
+		return func(name string) (plugin.Symbol, error) {
+			if sym == nil || name != "PluginAPIVersion" {
+				return nil, errors.New("symbol not found")
+			}
+			return sym, nil
+		}
+	}
+	current, old, future := PluginAPIVersion, 1, PluginAPIVersion+1
+
+	if version, err := pluginAPIVersion(lookup(nil)); err != nil || version != 1 {
+		t.Errorf("plugin without version is of version %d, %v", version, err)
+	}
+	if version, err := pluginAPIVersion(lookup(&current)); err != nil || version != PluginAPIVersion {
+		t.Errorf("plugin of the current version is of version %d, %v", version, err)
+	}
+	if version, err := pluginAPIVersion(lookup(func() int { return old })); err != nil || version != 1 {
+		t.Errorf("plugin of version 1 is of version %d, %v", version, err)
+	}
+	if _, err := pluginAPIVersion(lookup(&future)); err == nil {
+		t.Errorf("plugin of a future version does not return error")
+	}
+	if _, err := pluginAPIVersion(lookup(new(string))); err == nil {
+		t.Errorf("plugin version of invalid type does not return error")
+	}
+}
+
+func TestDecisionCheckResults(t *testing.T) {
+	v1 := func(DecisionInput) (bool, error) { return true, nil }
+	v2 := func(DecisionInput) (DecisionResult, error) {
+		return DecisionResult{Challenge: true, Tags: []string{"v2"}}, nil
+	}
+
+	checkResults, err := decisionCheckResults(1, v1)
+	if err != nil {
+		t.Fatalf("version 1 check returned error: %v", err)
+	}
+	if res, _ := checkResults(DecisionInput{}); !res.Block {
+		t.Errorf("version 1 check adapted as %+v", res)
+	}
+	checkResults, err = decisionCheckResults(2, v2)
+	if err != nil {
+		t.Fatalf("version 2 check returned error: %v", err)
+	}
+	if res, _ := checkResults(DecisionInput{}); !res.Challenge || len(res.Tags) != 1 {
+		t.Errorf("version 2 check returned %+v", res)
+	}
+	if _, err := decisionCheckResults(2, v1); err == nil {
+		t.Errorf("version 1 check declared as version 2 does not return error")
+	}
+	if _, err := decisionCheckResults(1, v2); err == nil {
+		t.Errorf("version 2 check declared as version 1 does not return error")
+	}
+}
@@ -0,0 +1,145 @@
+package pluginmanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// artifactTimeout bounds the download of a model artifact
+const artifactTimeout = time.Minute
+
+// fetchArtifacts downloads the artifacts of a model plugin into the
+// cache dir and returns a copy of params with each artifact param set
+// to the path of its local copy. Cached artifacts are revalidated with
+// their ETag, and used as they are if the endpoint cannot be reached.
+// The artifacts with a checksum are only used if their copy has it.
+func fetchArtifacts(modelID string, params, artifacts, checksums map[string]string, cacheDir string) (map[string]string, error) {
+	if len(artifacts) == 0 {
+		return params, nil
+	}
+	merged := make(map[string]string, len(params)+len(artifacts))
+	for name, value := range params {
+		merged[name] = value
+	}
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return nil, fmt.Errorf("cannot create artifact cache %s: %v", cacheDir, err)
+	}
+	if err := checkCacheDir(cacheDir); err != nil {
+		return nil, err
+	}
+	for name, url := range artifacts {
+		path, err := fetchArtifact(modelID, url, checksums[name], cacheDir)
+		if err != nil {
+			return nil, fmt.Errorf("artifact %s: %v", name, err)
+		}
+		merged[name] = path
+	}
+	return merged, nil
+}
+
+// checkCacheDir returns an error if the artifact cache dir could be
+// written by other users, who could replace the artifacts
+func checkCacheDir(cacheDir string) error {
+	info, err := os.Lstat(cacheDir)
+	if err != nil {
+		return fmt.Errorf("cannot check artifact cache %s: %v", cacheDir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("artifact cache %s is not a directory", cacheDir)
+	}
+	if !ownedByProcess(info) {
+		return fmt.Errorf("artifact cache %s is not owned by the user of the process", cacheDir)
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("artifact cache %s is writable by other users (%v)", cacheDir, info.Mode().Perm())
+	}
+	return nil
+}
+
+// fetchArtifact downloads the artifact at url into the cache dir,
+// unless the cached copy is still valid, and returns its path. With a
+// checksum, a cached copy or download without it is not used.
+func fetchArtifact(modelID, url, checksum, cacheDir string) (string, error) {
+	logger := lg.Get()
+	sum := sha256.Sum256([]byte(url))
+	path := filepath.Join(cacheDir, hex.EncodeToString(sum[:]))
+	etagPath := path + ".etag"
+	checksum = strings.ToLower(checksum)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	_, cacheErr := os.Stat(path)
+	cached := cacheErr == nil
+	if cached && checksum != "" {
+		if fileChecksum(path) != checksum {
+			logger.Printf(lg.WARN, "| %s | cached copy of %s does not have the pinned checksum, fetching it again", modelID, url)
+			cached = false
+		}
+	}
+	if etag, err := os.ReadFile(etagPath); err == nil && cached {
+		req.Header.Set("If-None-Match", strings.TrimSpace(string(etag)))
+	}
+
+	client := http.Client{Timeout: artifactTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		if cached {
+			logger.Printf(lg.WARN, "| %s | cannot fetch %s, using cached copy: %v", modelID, url, err)
+			return path, nil
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached:
+		logger.Printf(lg.DEBUG, "| %s | cached copy of %s is up to date", modelID, url)
+		return path, nil
+	case resp.StatusCode != http.StatusOK:
+		if cached {
+			logger.Printf(lg.WARN, "| %s | fetching %s returned %s, using cached copy", modelID, url, resp.Status)
+			return path, nil
+		}
+		return "", fmt.Errorf("fetching %s returned %s", url, resp.Status)
+	}
+
+	// Write to a temporary file first so a failed download never
+	// replaces a valid cached copy
+	tmp, err := os.CreateTemp(cacheDir, "download-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %v", url, err)
+	}
+	if downloaded := hex.EncodeToString(hash.Sum(nil)); checksum != "" && downloaded != checksum {
+		return "", fmt.Errorf("%s has checksum %s, expected %s", url, downloaded, checksum)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		os.WriteFile(etagPath, []byte(etag), 0600)
+	} else {
+		os.Remove(etagPath)
+	}
+	logger.Printf(lg.INFO, "| %s | fetched %s", modelID, url)
+	return path, nil
+}
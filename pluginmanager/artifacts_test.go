@@ -0,0 +1,110 @@
+package pluginmanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFetchArtifacts(t *testing.T) {
+	requests, revalidated := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidated++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("vocabulary"))
+	}))
+	cacheDir := t.TempDir()
+	artifacts := map[string]string{"vocab": server.URL + "/vocab.txt"}
+
+	params, err := fetchArtifacts("model", map[string]string{"threshold": "0.5"}, artifacts, nil, cacheDir)
+	if err != nil {
+		t.Fatalf("fetchArtifacts returned error: %v", err)
+	}
+	if params["threshold"] != "0.5" {
+		t.Errorf("plugin params not kept: %v", params)
+	}
+	if data, err := os.ReadFile(params["vocab"]); err != nil || string(data) != "vocabulary" {
+		t.Errorf("artifact file contains %q: %v", data, err)
+	}
+
+	again, err := fetchArtifacts("model", nil, artifacts, nil, cacheDir)
+	if err != nil || again["vocab"] != params["vocab"] || revalidated != 1 {
+		t.Errorf("cached artifact not revalidated: %v, %d revalidations", err, revalidated)
+	}
+
+	server.Close()
+	if _, err := fetchArtifacts("model", nil, artifacts, nil, cacheDir); err != nil {
+		t.Errorf("cached artifact not used when the endpoint is down: %v", err)
+	}
+	if _, err := fetchArtifacts("model", nil, map[string]string{"other": server.URL + "/other"}, nil, cacheDir); err == nil {
+		t.Errorf("unreachable artifact without cache does not return error")
+	}
+	if requests != 2 {
+		t.Errorf("endpoint received %d requests, expected 2", requests)
+	}
+}
+
+func TestFetchArtifactsChecksum(t *testing.T) {
+	content := "vocabulary"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+	cacheDir := t.TempDir()
+	artifacts := map[string]string{"vocab": server.URL + "/vocab.txt"}
+	sum := sha256.Sum256([]byte("vocabulary"))
+	checksums := map[string]string{"vocab": hex.EncodeToString(sum[:])}
+
+	params, err := fetchArtifacts("model", nil, artifacts, checksums, cacheDir)
+	if err != nil {
+		t.Fatalf("fetchArtifacts returned error: %v", err)
+	}
+	// a tampered copy is fetched again
+	if err := os.WriteFile(params["vocab"], []byte("tampered"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetchArtifacts("model", nil, artifacts, checksums, cacheDir); err != nil {
+		t.Errorf("fetchArtifacts of a tampered copy returned error: %v", err)
+	}
+	if data, _ := os.ReadFile(params["vocab"]); string(data) != "vocabulary" {
+		t.Errorf("tampered copy replaced by %q", data)
+	}
+
+	content = "changed"
+	if _, err := fetchArtifacts("model", nil, artifacts, checksums, cacheDir); err == nil {
+		t.Errorf("artifact without its checksum does not return error")
+	}
+	if data, _ := os.ReadFile(params["vocab"]); string(data) != "vocabulary" {
+		t.Errorf("cached copy replaced by %q", data)
+	}
+}
+
+func TestFetchArtifactsCacheDir(t *testing.T) {
+	cacheDir := t.TempDir()
+	artifacts := map[string]string{"vocab": "http://127.0.0.1:1/vocab.txt"}
+	if err := os.Chmod(cacheDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	_, err := fetchArtifacts("model", nil, artifacts, nil, cacheDir)
+	if err == nil || !strings.Contains(err.Error(), "writable by other users") {
+		t.Errorf("cache dir writable by other users returns %v", err)
+	}
+
+	created := filepath.Join(cacheDir, "artifacts")
+	fetchArtifacts("model", nil, artifacts, nil, created)
+	if info, err := os.Stat(created); err != nil {
+		t.Errorf("cache dir not created: %v", err)
+	} else if info.Mode().Perm() != 0700 {
+		t.Errorf("cache dir created with %v", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,38 @@
+package pluginmanager
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestReceiveAsyncResults(t *testing.T) {
+	setInclude := func(include bool) {
+		cf.Update(func(cs *cf.ConfigStore) error {
+			model := cs.ModelPlugins["slow"]
+			model.ID, model.Mode, model.PluginType = "slow", "async", cf.RequestBody
+			cs.ModelPlugins["slow"] = model
+			cs.IncludeAsyncResults = include
+			return nil
+		})
+	}
+	p := &PluginManager{}
+	for _, include := range []bool{false, true} {
+		setInclude(include)
+		p.InitTransaction("tx")
+		status := make(chan ModelStatus, 1)
+		p.AddModelChannel("tx", cf.RequestBody, status, "async")
+
+		p.receiveModelResults("slow", &nats.Msg{Data: []byte(`{"transactionId":"tx","probattack":0.9,"error":null}`)})
+		if s := <-status; s.Err != nil || s.ProbAttack != 0.9 || s.Transport != TransportNATS {
+			t.Errorf("status of the async model is %+v", s)
+		}
+		results, _ := p.TransactionResults("tx")
+		if _, stored := results["slow"]; stored != include {
+			t.Errorf("async results stored: %t, with includeasyncresults %t", stored, include)
+		}
+		p.CloseTransaction("tx")
+	}
+}
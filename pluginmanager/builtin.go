@@ -0,0 +1,220 @@
+package pluginmanager
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+// DecisionResult is the detailed outcome of a decision plugin
+type DecisionResult struct {
+	Block bool
+	// Challenge asks the connector to have the client solve a
+	// challenge, such as a CAPTCHA, instead of blocking it. Block takes
+	// precedence.
+	Challenge bool
+	// Tags are labels attached to the transaction by the decision, for
+	// instance the categories that reached a tag threshold
+	Tags []string
+}
+
+// builtinDecisionFactory creates the check function of a built-in
+// decision plugin from its configuration
+type builtinDecisionFactory func(params map[string]string, rules map[string]cf.CategoryRule) (func(DecisionInput) (DecisionResult, error), error)
+
+// builtinDecisions maps the name of every built-in decision engine to
+// its factory
+var builtinDecisions = map[string]builtinDecisionFactory{
+	"categories": newCategoriesDecision,
+	"combiner":   newCombinerDecision,
+	"waf":        newWAFDecision,
+}
+
+// Fusion modes of the built-in combiner
+const (
+	// FusionWeighted averages the model scores by their weights
+	FusionWeighted = "weighted"
+	// FusionUncertainty additionally divides each weight by the
+	// variance reported by the model, so confident models get more
+	// influence than those effectively guessing
+	FusionUncertainty = "uncertainty"
+)
+
+// defaultVariance is the variance assumed for models that do not
+// report uncertainty, and minVariance bounds the influence of
+// models claiming to be certain
+const (
+	defaultVariance = 0.05
+	minVariance     = 0.001
+)
+
+// newCategoriesDecision creates the built-in categories decision
+// engine. For every configured category whose aggregated model score
+// reaches the threshold, the transaction is tagged with
+// "category:<name>", and blocked if the rule action is block.
+func newCategoriesDecision(params map[string]string, rules map[string]cf.CategoryRule) (func(DecisionInput) (DecisionResult, error), error) {
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no category rules configured")
+	}
+	for category := range rules {
+		if !IsKnownCategory(AttackCategory(category)) {
+			return nil, fmt.Errorf("category %s is not part of the taxonomy", category)
+		}
+	}
+	categories := make([]string, 0, len(rules))
+	for category := range rules {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	return func(input DecisionInput) (DecisionResult, error) {
+		var res DecisionResult
+		for _, category := range categories {
+			score, ok := input.CategoryScores[AttackCategory(category)]
+			rule := rules[category]
+			if !ok || score < rule.Threshold {
+				continue
+			}
+			res.Tags = append(res.Tags, "category:"+category)
+			switch rule.Action {
+			case cf.ActionBlock:
+				res.Block = true
+			case cf.ActionChallenge:
+				res.Challenge = true
+			}
+		}
+		return res, nil
+	}, nil
+}
+
+// FuseScores combines the attack probabilities of the models into a
+// single score, averaging them by weight and, with FusionUncertainty,
+// by the inverse of the variance of each result. Models with no weight
+// are ignored unless no model has weight.
+func FuseScores(results map[string]ModelResults, weights map[string]float64, fusion string, defaultVar float64) float64 {
+	totalWeight, score := 0.0, 0.0
+	for modelID, res := range results {
+		w := weights[modelID]
+		if fusion == FusionUncertainty {
+			variance := defaultVar
+			if res.Uncertainty != nil {
+				variance = *res.Uncertainty
+			}
+			if variance < minVariance {
+				variance = minVariance
+			}
+			w /= variance
+		}
+		totalWeight += w
+		score += w * res.ProbAttack
+	}
+	if totalWeight == 0 {
+		if len(results) == 0 {
+			return 0
+		}
+		for _, res := range results {
+			score += res.ProbAttack
+		}
+		return score / float64(len(results))
+	}
+	return score / totalWeight
+}
+
+// InboundAnomalyParam is the WAF parameter of the CRS inbound anomaly
+// score
+const InboundAnomalyParam = "inbound_detection"
+
+// BalancedScore balances the score of the models with the WAF inbound
+// anomaly score by the DecisionBalance of the input. The anomaly score
+// times WAFWeight, capped at 1, weighs DecisionBalance and the model
+// score the rest. The model score is returned as is without balance
+// or anomaly score.
+func BalancedScore(input DecisionInput, modelScore float64) float64 {
+	if input.DecisionBalance <= 0 {
+		return modelScore
+	}
+	anomaly, err := strconv.ParseFloat(input.WAFdata[InboundAnomalyParam], 64)
+	if err != nil {
+		return modelScore
+	}
+	wafScore := math.Min(math.Max(anomaly*input.WAFWeight, 0), 1)
+	return (1-input.DecisionBalance)*modelScore + input.DecisionBalance*wafScore
+}
+
+// newCombinerDecision creates the built-in combiner, which blocks the
+// transaction when the fused model score, balanced with the WAF score
+// by BalancedScore, reaches the threshold of the plugin or else its
+// threshold param (0.5 by default). The fusion param selects the
+// fusion mode, and defaultvariance the variance of models not
+// reporting uncertainty.
+func newCombinerDecision(params map[string]string, rules map[string]cf.CategoryRule) (func(DecisionInput) (DecisionResult, error), error) {
+	threshold, err := floatParam(params, "threshold", 0.5)
+	if err != nil {
+		return nil, err
+	}
+	defaultVar, err := floatParam(params, "defaultvariance", defaultVariance)
+	if err != nil {
+		return nil, err
+	}
+	fusion := params["fusion"]
+	switch fusion {
+	case "":
+		fusion = FusionWeighted
+	case FusionWeighted, FusionUncertainty:
+	default:
+		return nil, fmt.Errorf("invalid fusion mode %s", fusion)
+	}
+
+	return func(input DecisionInput) (DecisionResult, error) {
+		score := BalancedScore(input, FuseScores(input.Results, input.ModelWeight, fusion, defaultVar))
+		scored := len(input.Results) > 0 || input.DecisionBalance > 0 && input.WAFdata[InboundAnomalyParam] != ""
+		if input.Threshold > 0 {
+			return DecisionResult{Block: scored && score >= input.Threshold}, nil
+		}
+		return DecisionResult{Block: scored && score >= threshold}, nil
+	}, nil
+}
+
+// newWAFDecision creates the built-in WAF decision engine, which
+// ignores the models and blocks when the WAF parameter named by the
+// param param (the inbound anomaly score by default) reaches the
+// threshold param (5 by default, the CRS default inbound threshold).
+// It suits transactions that were not analyzed by any model.
+func newWAFDecision(params map[string]string, rules map[string]cf.CategoryRule) (func(DecisionInput) (DecisionResult, error), error) {
+	threshold, err := floatParam(params, "threshold", 5)
+	if err != nil {
+		return nil, err
+	}
+	param := params["param"]
+	if param == "" {
+		param = InboundAnomalyParam
+	}
+
+	return func(input DecisionInput) (DecisionResult, error) {
+		value, ok := input.WAFdata[param]
+		if !ok {
+			return DecisionResult{}, nil
+		}
+		score, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return DecisionResult{}, fmt.Errorf("waf param %s is not numeric: %s", param, value)
+		}
+		return DecisionResult{Block: score >= threshold}, nil
+	}, nil
+}
+
+// floatParam parses a float plugin param, returning def if it is unset
+func floatParam(params map[string]string, name string, def float64) (float64, error) {
+	value, ok := params[name]
+	if !ok || value == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s param %s: %v", name, value, err)
+	}
+	return f, nil
+}
@@ -0,0 +1,150 @@
+package pluginmanager
+
+import (
+	"testing"
+
+	"github.com/tiroa-tilsor/wacelib/bot"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+func TestCategoriesDecision(t *testing.T) {
+	check, err := newCategoriesDecision(nil, map[string]cf.CategoryRule{
+		"rce":      {Threshold: 0.5, Action: cf.ActionBlock},
+		"scraping": {Threshold: 0.9, Action: cf.ActionTag},
+	})
+	if err != nil {
+		t.Fatalf("categories decision returned error: %v", err)
+	}
+
+	res, _ := check(DecisionInput{CategoryScores: map[AttackCategory]float64{CategoryScraping: 0.95, CategoryRCE: 0.2}})
+	if res.Block {
+		t.Errorf("transaction blocked by a tag rule")
+	}
+	if len(res.Tags) != 1 || res.Tags[0] != "category:scraping" {
+		t.Errorf("unexpected tags %v", res.Tags)
+	}
+
+	res, _ = check(DecisionInput{CategoryScores: map[AttackCategory]float64{CategoryRCE: 0.5}})
+	if !res.Block {
+		t.Errorf("transaction reaching the rce threshold not blocked")
+	}
+
+	if _, err := newCategoriesDecision(nil, map[string]cf.CategoryRule{"unknown": {Threshold: 0.5, Action: cf.ActionBlock}}); err == nil {
+		t.Errorf("unknown category does not return error")
+	}
+}
+
+func TestFuseScores(t *testing.T) {
+	confident, guessing := 0.01, 0.25
+	results := map[string]ModelResults{
+		"confident": {ProbAttack: 0.9, Uncertainty: &confident},
+		"guessing":  {ProbAttack: 0.1, Uncertainty: &guessing},
+	}
+	weights := map[string]float64{"confident": 1, "guessing": 1}
+
+	if score := FuseScores(results, weights, FusionWeighted, defaultVariance); score != 0.5 {
+		t.Errorf("weighted fusion score is %v, expected 0.5", score)
+	}
+	if score := FuseScores(results, weights, FusionUncertainty, defaultVariance); score < 0.85 {
+		t.Errorf("uncertainty fusion score is %v, the confident model should dominate", score)
+	}
+
+	check, err := newCombinerDecision(map[string]string{"fusion": FusionUncertainty, "threshold": "0.8"}, nil)
+	if err != nil {
+		t.Fatalf("combiner returned error: %v", err)
+	}
+	res, _ := check(DecisionInput{Results: results, ModelWeight: weights})
+	if !res.Block {
+		t.Errorf("uncertainty weighted combiner does not block")
+	}
+
+	if _, err := newCombinerDecision(map[string]string{"fusion": "invalid"}, nil); err == nil {
+		t.Errorf("invalid fusion mode does not return error")
+	}
+}
+
+func TestBalancedScore(t *testing.T) {
+	input := DecisionInput{WAFdata: map[string]string{InboundAnomalyParam: "10"}, WAFWeight: 0.05, DecisionBalance: 0.4}
+	if score := BalancedScore(input, 0.5); score != 0.5 {
+		t.Errorf("balanced score is %v, expected 0.5", score)
+	}
+	input.WAFWeight = 0.2
+	if score := BalancedScore(input, 0); score != 0.4 {
+		t.Errorf("balanced score with a capped waf score is %v, expected 0.4", score)
+	}
+	if score := BalancedScore(DecisionInput{WAFWeight: 0.2, DecisionBalance: 0.4}, 0.3); score != 0.3 {
+		t.Errorf("balanced score without waf score is %v, expected 0.3", score)
+	}
+
+	check, err := newCombinerDecision(map[string]string{"threshold": "0.9"}, nil)
+	if err != nil {
+		t.Fatalf("combiner returned error: %v", err)
+	}
+	results := map[string]ModelResults{"roberta": {ProbAttack: 0.6}}
+	weights := map[string]float64{"roberta": 1}
+	if res, _ := check(DecisionInput{Results: results, ModelWeight: weights}); res.Block {
+		t.Errorf("combiner blocks under its threshold param")
+	}
+	if res, _ := check(DecisionInput{Results: results, ModelWeight: weights, Threshold: 0.6}); !res.Block {
+		t.Errorf("combiner does not block at the threshold of the plugin")
+	}
+	if res, _ := check(DecisionInput{WAFdata: map[string]string{InboundAnomalyParam: "25"}, WAFWeight: 0.1, DecisionBalance: 1}); !res.Block {
+		t.Errorf("combiner does not block on the waf score alone")
+	}
+}
+
+func TestWAFDecision(t *testing.T) {
+	check, err := newWAFDecision(map[string]string{"threshold": "10"}, nil)
+	if err != nil {
+		t.Fatalf("waf decision returned error: %v", err)
+	}
+
+	if res, _ := check(DecisionInput{WAFdata: map[string]string{"inbound_detection": "12"}}); !res.Block {
+		t.Errorf("transaction above the waf threshold not blocked")
+	}
+	if res, _ := check(DecisionInput{WAFdata: map[string]string{"inbound_detection": "5"}}); res.Block {
+		t.Errorf("transaction below the waf threshold blocked")
+	}
+	if res, err := check(DecisionInput{}); res.Block || err != nil {
+		t.Errorf("transaction without waf score blocked: %v", err)
+	}
+	if _, err := check(DecisionInput{WAFdata: map[string]string{"inbound_detection": "high"}}); err == nil {
+		t.Errorf("non numeric waf score does not return error")
+	}
+}
+
+func TestProtocolModel(t *testing.T) {
+	process, err := newProtocolModel(map[string]string{"maxheaders": "10"})
+	if err != nil {
+		t.Fatalf("protocol model returned error: %v", err)
+	}
+	res, err := process(ModelInput{Payload: "POST / HTTP/1.1\nContent-Length: 4\nTransfer-Encoding: chunked\n"})
+	if err != nil || res.ProbAttack < 0.9 {
+		t.Errorf("smuggling attempt scored %v: %v", res.ProbAttack, err)
+	}
+	res, _ = process(ModelInput{Payload: "GET / HTTP/1.1\nHost: example.com\n"})
+	if res.ProbAttack != 0 {
+		t.Errorf("valid request scored %v with anomalies %v", res.ProbAttack, res.Data["anomalies"])
+	}
+	if _, err := newProtocolModel(map[string]string{"maxheaders": "many"}); err == nil {
+		t.Errorf("invalid maxheaders param does not return error")
+	}
+}
+
+func TestBotModel(t *testing.T) {
+	process, err := newBotModel(map[string]string{"ja4": "t13d1516h2_8daaf6152771_02713d6af862, other"})
+	if err != nil {
+		t.Fatalf("bot model returned error: %v", err)
+	}
+	res, _ := process(ModelInput{
+		Payload: "GET / HTTP/1.1\nHost: example.com\nUser-Agent: Mozilla/5.0\nAccept: */*\nAccept-Language: en\nAccept-Encoding: gzip\n",
+		Signals: &bot.Signals{JA4: "t13d1516h2_8daaf6152771_02713d6af862"},
+	})
+	if res.ProbAttack < 0.9 || res.Categories[CategoryBot] != res.ProbAttack {
+		t.Errorf("client with a known bot fingerprint scored %v", res.ProbAttack)
+	}
+	res, _ = process(ModelInput{Payload: "GET / HTTP/1.1\nHost: example.com\nUser-Agent: Mozilla/5.0\nAccept: */*\nAccept-Language: en\nAccept-Encoding: gzip\n"})
+	if res.ProbAttack != 0 {
+		t.Errorf("browser scored %v with reasons %v", res.ProbAttack, res.Data["reasons"])
+	}
+}
@@ -0,0 +1,138 @@
+package pluginmanager
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/tiroa-tilsor/wacelib/bot"
+	"github.com/tiroa-tilsor/wacelib/protocol"
+)
+
+// builtinModelFactory creates the process function of a built-in model
+// plugin from its params
+type builtinModelFactory func(params map[string]string) (func(ModelInput) (ModelResults, error), error)
+
+// builtinModels maps the name of every built-in model to its factory
+var builtinModels = map[string]builtinModelFactory{
+	"protocol":  newProtocolModel,
+	"bot":       newBotModel,
+	"simulated": newSimulatedModel,
+}
+
+// newProtocolModel creates the built-in protocol sanity model. It
+// scores the request line and headers by the protocol anomalies found,
+// within the maxheaders and maxheadersize params, and reports the
+// checks that failed in the "anomalies" data key.
+func newProtocolModel(params map[string]string) (func(ModelInput) (ModelResults, error), error) {
+	limits := protocol.DefaultLimits
+	maxHeaders, err := floatParam(params, "maxheaders", float64(limits.MaxHeaders))
+	if err != nil {
+		return nil, err
+	}
+	maxHeaderSize, err := floatParam(params, "maxheadersize", float64(limits.MaxHeaderSize))
+	if err != nil {
+		return nil, err
+	}
+	limits.MaxHeaders, limits.MaxHeaderSize = int(maxHeaders), int(maxHeaderSize)
+
+	return func(input ModelInput) (ModelResults, error) {
+		anomalies := protocol.Check(input.Payload, limits)
+		details := make([]string, len(anomalies))
+		for i, a := range anomalies {
+			details[i] = a.Detail
+		}
+		return ModelResults{
+			ProbAttack: protocol.Score(anomalies),
+			Data: map[string]interface{}{
+				"anomalies": protocol.Checks(anomalies),
+				"details":   details,
+			},
+		}, nil
+	}, nil
+}
+
+// newBotModel creates the built-in bot likelihood model. It scores the
+// client signals of the transaction, completed with the User-Agent and
+// header order of the payload when the connector did not give them,
+// against the comma separated JA3 and JA4 fingerprints of known bots in
+// the ja3 and ja4 params. The score is also reported in the bot
+// category, and the reasons in the "reasons" data key.
+func newBotModel(params map[string]string) (func(ModelInput) (ModelResults, error), error) {
+	config := bot.Config{JA3: listParam(params, "ja3"), JA4: listParam(params, "ja4")}
+
+	return func(input ModelInput) (ModelResults, error) {
+		var signals bot.Signals
+		if input.Signals != nil {
+			signals = *input.Signals
+		}
+		if signals.UserAgent == "" {
+			signals.UserAgent = bot.UserAgent(input.Payload)
+		}
+		if len(signals.HeaderOrder) == 0 {
+			signals.HeaderOrder = bot.HeaderOrder(input.Payload)
+		}
+		score, reasons := bot.Score(signals, config)
+		return ModelResults{
+			ProbAttack: score,
+			Data:       map[string]interface{}{"reasons": reasons},
+			Categories: map[AttackCategory]float64{CategoryBot: score},
+		}, nil
+	}, nil
+}
+
+// listParam parses a comma separated plugin param
+func listParam(params map[string]string, name string) []string {
+	var list []string
+	for _, item := range strings.Split(params[name], ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// newSimulatedModel creates the built-in simulated model, used by the
+// load benchmarks to stand in for a real model. It answers with the
+// probattack param (0 by default) after the latency param, plus a
+// uniformly random extra delay of up to the jitter param.
+func newSimulatedModel(params map[string]string) (func(ModelInput) (ModelResults, error), error) {
+	probAttack, err := floatParam(params, "probattack", 0)
+	if err != nil {
+		return nil, err
+	}
+	latency, err := durationParam(params, "latency", 0)
+	if err != nil {
+		return nil, err
+	}
+	jitter, err := durationParam(params, "jitter", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(input ModelInput) (ModelResults, error) {
+		delay := latency
+		if jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(jitter)))
+		}
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+		return ModelResults{ProbAttack: probAttack}, nil
+	}, nil
+}
+
+// durationParam parses a duration plugin param, returning def if it is
+// unset
+func durationParam(params map[string]string, name string, def time.Duration) (time.Duration, error) {
+	value, ok := params[name]
+	if !ok || value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s param %s", name, value)
+	}
+	return d, nil
+}
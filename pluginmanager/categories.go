@@ -0,0 +1,102 @@
+package pluginmanager
+
+import (
+	"strconv"
+)
+
+// AttackCategory is a standard attack category that model plugins can
+// tag their scores with
+type AttackCategory string
+
+const (
+	CategorySQLi         AttackCategory = "sqli"
+	CategoryXSS          AttackCategory = "xss"
+	CategoryRCE          AttackCategory = "rce"
+	CategoryLFI          AttackCategory = "lfi"
+	CategoryBot          AttackCategory = "bot"
+	CategoryScraping     AttackCategory = "scraping"
+	CategoryExfiltration AttackCategory = "exfiltration"
+)
+
+// Categories lists every category of the taxonomy
+var Categories = []AttackCategory{
+	CategorySQLi,
+	CategoryXSS,
+	CategoryRCE,
+	CategoryLFI,
+	CategoryBot,
+	CategoryScraping,
+	CategoryExfiltration,
+}
+
+// crsCategories maps the CRS anomaly score names received in wafParams
+// to the taxonomy. PHP injection is a form of remote code execution and
+// remote file inclusion is reported along with local file inclusion.
+var crsCategories = map[string]AttackCategory{
+	"SQLI": CategorySQLi,
+	"XSS":  CategoryXSS,
+	"RCE":  CategoryRCE,
+	"PHPI": CategoryRCE,
+	"LFI":  CategoryLFI,
+	"RFI":  CategoryLFI,
+}
+
+// IsKnownCategory returns true if c belongs to the taxonomy
+func IsKnownCategory(c AttackCategory) bool {
+	for _, known := range Categories {
+		if c == known {
+			return true
+		}
+	}
+	return false
+}
+
+// AggregateCategories computes the per-category score of a transaction
+// as the average of the category scores reported by the models,
+// weighted by the model weights. If the models reporting a category
+// have no weight, their plain average is used.
+func AggregateCategories(results map[string]ModelResults, weights map[string]float64) map[AttackCategory]float64 {
+	weighted := make(map[AttackCategory]float64)
+	totalWeight := make(map[AttackCategory]float64)
+	plain := make(map[AttackCategory]float64)
+	count := make(map[AttackCategory]int)
+	for modelID, res := range results {
+		for category, score := range res.Categories {
+			weighted[category] += weights[modelID] * score
+			totalWeight[category] += weights[modelID]
+			plain[category] += score
+			count[category]++
+		}
+	}
+
+	aggregated := make(map[AttackCategory]float64, len(count))
+	for category, n := range count {
+		if totalWeight[category] > 0 {
+			aggregated[category] = weighted[category] / totalWeight[category]
+		} else {
+			aggregated[category] = plain[category] / float64(n)
+		}
+	}
+	return aggregated
+}
+
+// WAFCategories extracts the per-category CRS anomaly scores from the
+// WAF parameters. Categories mapped from several CRS scores get the
+// highest of them.
+func WAFCategories(wafParams map[string]string) map[AttackCategory]float64 {
+	scores := make(map[AttackCategory]float64)
+	for name, category := range crsCategories {
+		value, ok := wafParams[name]
+		if !ok {
+			continue
+		}
+		score, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		if current, exists := scores[category]; !exists || score > current {
+			scores[category] = score
+		}
+	}
+	return scores
+}
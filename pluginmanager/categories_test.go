@@ -0,0 +1,45 @@
+package pluginmanager
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAggregateCategories(t *testing.T) {
+	results := map[string]ModelResults{
+		"a": {ProbAttack: 0.9, Categories: map[AttackCategory]float64{CategorySQLi: 0.9, CategoryXSS: 0.2}},
+		"b": {ProbAttack: 0.3, Categories: map[AttackCategory]float64{CategorySQLi: 0.3}},
+		"c": {ProbAttack: 0.1},
+	}
+	weights := map[string]float64{"a": 2, "b": 1, "c": 1}
+
+	scores := AggregateCategories(results, weights)
+	if math.Abs(scores[CategorySQLi]-0.7) > 1e-9 {
+		t.Errorf("sqli score is %v, expected 0.7", scores[CategorySQLi])
+	}
+	if math.Abs(scores[CategoryXSS]-0.2) > 1e-9 {
+		t.Errorf("xss score is %v, expected 0.2", scores[CategoryXSS])
+	}
+	if _, exists := scores[CategoryRCE]; exists {
+		t.Errorf("rce score present without any model reporting it")
+	}
+
+	scores = AggregateCategories(results, map[string]float64{})
+	if math.Abs(scores[CategorySQLi]-0.6) > 1e-9 {
+		t.Errorf("unweighted sqli score is %v, expected 0.6", scores[CategorySQLi])
+	}
+}
+
+func TestWAFCategories(t *testing.T) {
+	scores := WAFCategories(map[string]string{"SQLI": "5", "RCE": "3", "PHPI": "10", "XSS": "invalid", "phase": "2"})
+
+	if scores[CategorySQLi] != 5 {
+		t.Errorf("sqli score is %v, expected 5", scores[CategorySQLi])
+	}
+	if scores[CategoryRCE] != 10 {
+		t.Errorf("rce score is %v, expected the highest of RCE and PHPI", scores[CategoryRCE])
+	}
+	if _, exists := scores[CategoryXSS]; exists {
+		t.Errorf("invalid xss score should be ignored")
+	}
+}
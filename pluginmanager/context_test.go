@@ -0,0 +1,36 @@
+package pluginmanager
+
+import (
+	"testing"
+)
+
+func TestCheckResultWithContext(t *testing.T) {
+	var input DecisionInput
+	p := &PluginManager{
+		decisionCheckFunc: map[string]func(DecisionInput) (DecisionResult, error){
+			"policy": func(in DecisionInput) (DecisionResult, error) {
+				input = in
+				return DecisionResult{Block: in.Profile == "strict"}, nil
+			},
+		},
+	}
+	p.InitTransaction("transaction")
+	defer p.CloseTransaction("transaction")
+
+	res, err := p.CheckResultWithContext("transaction", "policy", nil, nil, TransactionContext{
+		Tenant:   "acme",
+		Profile:  "strict",
+		Tags:     []string{"route:login"},
+		Metadata: map[string]string{"fingerprint": "f00"},
+	})
+	if err != nil || !res.Block {
+		t.Fatalf("check returned %+v, %v", res, err)
+	}
+	if input.Tenant != "acme" || len(input.Tags) != 1 || input.Tags[0] != "route:login" || input.Metadata["fingerprint"] != "f00" {
+		t.Errorf("decision input is %+v", input)
+	}
+
+	if res, _ := p.CheckResultWithMissing("transaction", "policy", nil, nil); res.Block || input.Profile != "" {
+		t.Errorf("check without context returned %+v with profile %q", res, input.Profile)
+	}
+}
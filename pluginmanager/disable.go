@@ -0,0 +1,82 @@
+package pluginmanager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// DisabledTag tags the transactions checked while their decision plugin
+// was disabled
+const DisabledTag = "decision:disabled"
+
+// DisabledPlugin describes a plugin disabled at runtime
+type DisabledPlugin struct {
+	ID     string    `json:"id"`
+	Kind   string    `json:"kind"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// hasPlugin returns true if a plugin of the given kind and ID is loaded
+func (p *PluginManager) hasPlugin(kind, id string) bool {
+	p.plugins.RLock()
+	defer p.plugins.RUnlock()
+	switch kind {
+	case ModelPluginKind:
+		_, ok := p.modelPlugins[id]
+		return ok
+	case DecisionPluginKind:
+		_, ok := p.decisionCheckFunc[id]
+		return ok
+	}
+	return false
+}
+
+// DisablePlugin disables a loaded plugin without unloading it, until it
+// is enabled again. A disabled model plugin is skipped, and a disabled
+// decision plugin is replaced by its fallback.
+func (p *PluginManager) DisablePlugin(kind, id, reason string) error {
+	if !p.hasPlugin(kind, id) {
+		return fmt.Errorf("%s plugin %s not found", kind, id)
+	}
+	p.disabled.Store(kind+"/"+id, DisabledPlugin{ID: id, Kind: kind, Reason: reason, Since: time.Now()})
+	lg.Get().Printf(lg.WARN, "%s | %s plugin disabled: %s", id, kind, reason)
+	return nil
+}
+
+// EnablePlugin enables a plugin disabled with DisablePlugin
+func (p *PluginManager) EnablePlugin(kind, id string) error {
+	if !p.hasPlugin(kind, id) {
+		return fmt.Errorf("%s plugin %s not found", kind, id)
+	}
+	if _, ok := p.disabled.LoadAndDelete(kind + "/" + id); ok {
+		lg.Get().Printf(lg.WARN, "%s | %s plugin enabled", id, kind)
+	}
+	return nil
+}
+
+// Disabled returns true if the plugin of the given kind and ID is
+// disabled
+func (p *PluginManager) Disabled(kind, id string) bool {
+	_, ok := p.disabled.Load(kind + "/" + id)
+	return ok
+}
+
+// DisabledPlugins returns the disabled plugins, sorted by kind and ID
+func (p *PluginManager) DisabledPlugins() []DisabledPlugin {
+	var plugins []DisabledPlugin
+	p.disabled.Range(func(key, value interface{}) bool {
+		plugins = append(plugins, value.(DisabledPlugin))
+		return true
+	})
+	sort.Slice(plugins, func(i, j int) bool {
+		if plugins[i].Kind != plugins[j].Kind {
+			return plugins[i].Kind > plugins[j].Kind
+		}
+		return plugins[i].ID < plugins[j].ID
+	})
+	return plugins
+}
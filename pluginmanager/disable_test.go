@@ -0,0 +1,49 @@
+package pluginmanager
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+func TestDisablePlugin(t *testing.T) {
+	cf.Update(func(cs *cf.ConfigStore) error {
+		decision := cs.DecisionPlugins["strict"]
+		decision.ID, decision.Fallback = "strict", cf.FallbackBlock
+		cs.DecisionPlugins["strict"] = decision
+		return nil
+	})
+	called := false
+	strict := func(DecisionInput) (DecisionResult, error) {
+		called = true
+		return DecisionResult{}, nil
+	}
+	p := &PluginManager{
+		modelPlugins:      map[string]modelPlugin{"headers": {pluginType: cf.RequestHeaders}},
+		decisionCheckFunc: map[string]func(DecisionInput) (DecisionResult, error){"strict": strict},
+	}
+
+	if err := p.DisablePlugin(ModelPluginKind, "strict", "incident"); err == nil {
+		t.Errorf("disabling a decision plugin as a model plugin does not return error")
+	}
+	if err := p.DisablePlugin(ModelPluginKind, "headers", "incident"); err != nil {
+		t.Fatalf("DisablePlugin returned error: %v", err)
+	}
+	if err := p.DisablePlugin(DecisionPluginKind, "strict", "incident"); err != nil {
+		t.Fatalf("DisablePlugin returned error: %v", err)
+	}
+	if disabled := p.DisabledPlugins(); len(disabled) != 2 || disabled[0].ID != "headers" || disabled[1].Reason != "incident" {
+		t.Errorf("disabled plugins are %+v", disabled)
+	}
+
+	res, err := p.decide("strict", strict, DecisionInput{})
+	if called || err != nil || !res.Block || len(res.Tags) != 1 || res.Tags[0] != DisabledTag {
+		t.Errorf("disabled decision plugin returned %+v, %v", res, err)
+	}
+
+	p.EnablePlugin(DecisionPluginKind, "strict")
+	p.decide("strict", strict, DecisionInput{})
+	if !called || p.Disabled(DecisionPluginKind, "strict") || !p.Disabled(ModelPluginKind, "headers") {
+		t.Errorf("enabled decision plugin not called")
+	}
+}
@@ -0,0 +1,108 @@
+package pluginmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"github.com/tiroa-tilsor/wacelib/grpcmodel"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// grpcInitTimeout bounds the time a grpc model can take to initialize
+// and report its health at load
+const grpcInitTimeout = 30 * time.Second
+
+// grpcModel is a model plugin running in a process of its own, reached
+// through the grpcmodel service
+type grpcModel struct {
+	// conn is the connection to the service, nil if owned by go-plugin
+	conn       *grpc.ClientConn
+	client     grpcmodel.ModelClient
+	pluginType cf.ModelPluginType
+	// timeout bounds every Process call, zero waits forever
+	timeout time.Duration
+}
+
+// dialGRPCModel connects to the model service at address, initializes
+// it with the plugin params and checks that it is serving
+func dialGRPCModel(id, address string, t cf.ModelPluginType, params map[string]string, timeout time.Duration) (*grpcModel, error) {
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	m := &grpcModel{conn: conn, client: grpcmodel.NewModelClient(conn), pluginType: t, timeout: timeout}
+	if err := m.init(id, params); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// init initializes the model service with the plugin params and checks
+// that it is serving
+func (m *grpcModel) init(id string, params map[string]string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), grpcInitTimeout)
+	defer cancel()
+	if _, err := m.client.Init(ctx, &grpcmodel.InitRequest{Id: id, Params: params}); err != nil {
+		return fmt.Errorf("grpc model init failed: %v", err)
+	}
+	return m.health(ctx)
+}
+
+// health returns an error if the model service is not serving
+func (m *grpcModel) health(ctx context.Context) error {
+	res, err := m.client.Health(ctx, &grpcmodel.HealthRequest{})
+	if err != nil {
+		return fmt.Errorf("grpc model health check failed: %v", err)
+	}
+	if !res.Serving {
+		return fmt.Errorf("grpc model not serving: %s", res.Message)
+	}
+	return nil
+}
+
+// process calls the Process method of the model service with the input
+func (m *grpcModel) process(input ModelInput) (ModelResults, error) {
+	jsonInput, err := json.Marshal(input)
+	if err != nil {
+		return ModelResults{}, err
+	}
+	ctx := context.Background()
+	if m.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+	res, err := m.client.Process(ctx, &grpcmodel.ProcessRequest{
+		TransactionId: input.TransactionId,
+		PluginType:    m.pluginType.String(),
+		Payload:       input.Payload,
+		Metadata:      input.Metadata,
+		Input:         jsonInput,
+	})
+	if err != nil {
+		return ModelResults{}, err
+	}
+
+	results := ModelResults{
+		ProbAttack:  res.ProbAttack,
+		Data:        res.Data.AsMap(),
+		Uncertainty: res.Uncertainty,
+		NeedParts:   res.NeedParts,
+	}
+	if res.Shared != nil {
+		results.Shared = res.Shared.AsMap()
+	}
+	if len(res.Categories) > 0 {
+		results.Categories = make(map[AttackCategory]float64, len(res.Categories))
+		for category, score := range res.Categories {
+			results.Categories[AttackCategory(category)] = score
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,69 @@
+package pluginmanager
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"github.com/tiroa-tilsor/wacelib/grpcmodel"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type testModelServer struct {
+	grpcmodel.UnimplementedModelServer
+	serving bool
+	params  map[string]string
+}
+
+func (s *testModelServer) Init(_ context.Context, req *grpcmodel.InitRequest) (*grpcmodel.InitResponse, error) {
+	s.params = req.Params
+	return &grpcmodel.InitResponse{}, nil
+}
+
+func (s *testModelServer) Health(context.Context, *grpcmodel.HealthRequest) (*grpcmodel.HealthResponse, error) {
+	return &grpcmodel.HealthResponse{Serving: s.serving, Message: "loading"}, nil
+}
+
+func (s *testModelServer) Process(_ context.Context, req *grpcmodel.ProcessRequest) (*grpcmodel.ProcessResponse, error) {
+	data, _ := structpb.NewStruct(map[string]interface{}{"type": req.PluginType, "client": req.Metadata["client"]})
+	return &grpcmodel.ProcessResponse{ProbAttack: 0.8, Data: data, Categories: map[string]float64{"sqli": 0.9}}, nil
+}
+
+func serveTestModel(t *testing.T, s *testModelServer) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	grpcmodel.RegisterModelServer(server, s)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return lis.Addr().String()
+}
+
+func TestGRPCModel(t *testing.T) {
+	s := &testModelServer{serving: true}
+	model, err := dialGRPCModel("remote", serveTestModel(t, s), cf.RequestHeaders, map[string]string{"threshold": "0.5"}, 0)
+	if err != nil {
+		t.Fatalf("dialGRPCModel returned error: %v", err)
+	}
+	defer model.conn.Close()
+	if s.params["threshold"] != "0.5" {
+		t.Errorf("model initialized with params %v", s.params)
+	}
+
+	res, err := model.process(ModelInput{TransactionId: "transaction", Payload: "GET / HTTP/1.1\n", Metadata: map[string]string{"client": "10.0.0.1"}})
+	if err != nil {
+		t.Fatalf("process returned error: %v", err)
+	}
+	if res.ProbAttack != 0.8 || res.Data["type"] != "RequestHeaders" || res.Data["client"] != "10.0.0.1" || res.Categories[CategorySQLi] != 0.9 {
+		t.Errorf("unexpected results %+v", res)
+	}
+
+	if _, err := dialGRPCModel("loading", serveTestModel(t, &testModelServer{}), cf.RequestHeaders, nil, 0); err == nil {
+		t.Errorf("model not serving does not return error")
+	}
+}
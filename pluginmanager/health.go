@@ -0,0 +1,194 @@
+package pluginmanager
+
+import (
+	"context"
+	"errors"
+	"plugin"
+	"sort"
+	"sync"
+	"time"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// HealthCheckTimeout bounds the time the health check of a plugin can
+// take, after which the plugin is unhealthy
+const HealthCheckTimeout = 5 * time.Second
+
+// PluginHealth is the outcome of the last health check of a plugin
+type PluginHealth struct {
+	PluginID string `json:"pluginId"`
+	// Kind is ModelPluginKind or DecisionPluginKind
+	Kind    string    `json:"kind"`
+	Healthy bool      `json:"healthy"`
+	Checked time.Time `json:"checked"`
+	// Err tells why the plugin is unhealthy
+	Err string `json:"error,omitempty"`
+}
+
+// healthProbe checks the health of a plugin
+type healthProbe struct {
+	kind  string
+	id    string
+	check func(context.Context) error
+}
+
+// healthChecks are the probes of the plugins and their last outcomes
+type healthChecks struct {
+	mutex  sync.RWMutex
+	probes []healthProbe
+	health map[string]PluginHealth
+	stop   chan struct{}
+}
+
+// healthFunc returns the HealthCheck function exported by the plugin,
+// or nil if it exports none
+func healthFunc(tp *plugin.Plugin) func(context.Context) error {
+	if tp == nil {
+		return nil
+	}
+	sym, err := tp.Lookup("HealthCheck")
+	if err != nil {
+		return nil
+	}
+	fn, ok := sym.(func() error)
+	if !ok {
+		lg.Get().Printf(lg.WARN, "invalid HealthCheck function type %T, not called", sym)
+		return nil
+	}
+	return func(context.Context) error { return fn() }
+}
+
+// startHealthChecks probes every interval the plugins exporting a
+// HealthCheck function and the grpc models, if any
+func (p *PluginManager) startHealthChecks(interval time.Duration) {
+	var probes []healthProbe
+	for _, id := range p.ModelPluginIDs() {
+		if model, ok := p.grpcModels[id]; ok {
+			probes = append(probes, healthProbe{ModelPluginKind, id, model.health})
+		} else if check := healthFunc(p.modelPlugins[id].p); check != nil {
+			probes = append(probes, healthProbe{ModelPluginKind, id, check})
+		}
+	}
+	for _, id := range p.DecisionPluginIDs() {
+		if check := healthFunc(p.decisionPlugins[id].p); check != nil {
+			probes = append(probes, healthProbe{DecisionPluginKind, id, check})
+		}
+	}
+	if interval <= 0 || len(probes) == 0 {
+		return
+	}
+	p.health.probes = probes
+	p.health.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.checkHealth()
+			case <-p.health.stop:
+				return
+			}
+		}
+	}()
+}
+
+// checkHealth probes concurrently the health of the plugins, recording
+// the outcomes and the health gauge
+func (p *PluginManager) checkHealth() {
+	results := make([]PluginHealth, len(p.health.probes))
+	var wg sync.WaitGroup
+	for i, probe := range p.health.probes {
+		wg.Add(1)
+		go func(i int, probe healthProbe) {
+			defer wg.Done()
+			results[i] = PluginHealth{PluginID: probe.id, Kind: probe.kind, Healthy: true, Checked: time.Now()}
+			if err := runHealthCheck(probe.check, HealthCheckTimeout); err != nil {
+				results[i].Healthy, results[i].Err = false, err.Error()
+			}
+		}(i, probe)
+	}
+	wg.Wait()
+
+	gauge, err := p.instruments.Float64Gauge("wace.plugin.health", metric.WithDescription("Health of the plugins, 1 if healthy and 0 if not"))
+	if err != nil {
+		lg.Get().Printf(lg.WARN, "failed to record plugin health metric: %v", err)
+	}
+	p.health.mutex.Lock()
+	defer p.health.mutex.Unlock()
+	if p.health.health == nil {
+		p.health.health = make(map[string]PluginHealth)
+	}
+	for _, h := range results {
+		key := h.Kind + "/" + h.PluginID
+		previous, checked := p.health.health[key]
+		if !h.Healthy && (!checked || previous.Healthy) {
+			lg.Get().Printf(lg.WARN, "| %s | %s plugin unhealthy: %s", h.PluginID, h.Kind, h.Err)
+		} else if h.Healthy && checked && !previous.Healthy {
+			lg.Get().Printf(lg.WARN, "| %s | %s plugin healthy again", h.PluginID, h.Kind)
+		}
+		p.health.health[key] = h
+		if gauge != nil {
+			value := 0.0
+			if h.Healthy {
+				value = 1
+			}
+			gauge.Record(context.Background(), value, metric.WithAttributes(
+				attribute.String("plugin_id", h.PluginID),
+				attribute.String("plugin_kind", h.Kind)))
+		}
+	}
+}
+
+// runHealthCheck calls check, failing if it does not return within
+// timeout. A check that does not return is left running.
+func runHealthCheck(check func(context.Context) error, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errors.New("health check timed out")
+	}
+}
+
+// stopHealthChecks stops probing the plugins
+func (p *PluginManager) stopHealthChecks() {
+	if p.health.stop != nil {
+		close(p.health.stop)
+	}
+}
+
+// Healthy returns false if the last health check of the plugin of the
+// given kind and ID failed. Plugins not checked yet and plugins without
+// health checks are healthy.
+func (p *PluginManager) Healthy(kind, id string) bool {
+	p.health.mutex.RLock()
+	defer p.health.mutex.RUnlock()
+	h, ok := p.health.health[kind+"/"+id]
+	return !ok || h.Healthy
+}
+
+// PluginHealth returns the last health checks of the plugins, sorted
+// by kind and ID
+func (p *PluginManager) PluginHealth() []PluginHealth {
+	p.health.mutex.RLock()
+	defer p.health.mutex.RUnlock()
+	health := make([]PluginHealth, 0, len(p.health.health))
+	for _, h := range p.health.health {
+		health = append(health, h)
+	}
+	sort.Slice(health, func(i, j int) bool {
+		if health[i].Kind != health[j].Kind {
+			return health[i].Kind > health[j].Kind
+		}
+		return health[i].PluginID < health[j].PluginID
+	})
+	return health
+}
@@ -0,0 +1,51 @@
+package pluginmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+func TestHealthChecks(t *testing.T) {
+	server := &testModelServer{serving: true}
+	address := serveTestModel(t, server)
+	model, err := dialGRPCModel("remote", address, cf.RequestHeaders, nil, 0)
+	if err != nil {
+		t.Fatalf("dialGRPCModel returned error: %v", err)
+	}
+	p := &PluginManager{
+		modelPlugins: map[string]modelPlugin{"remote": {pluginType: cf.RequestHeaders, transport: TransportGRPC}},
+		grpcModels:   map[string]*grpcModel{"remote": model},
+		instruments:  NewInstruments(testMeter),
+	}
+	defer p.Shutdown()
+	p.startHealthChecks(time.Hour)
+
+	if !p.Healthy(ModelPluginKind, "remote") {
+		t.Errorf("plugin not checked yet is unhealthy")
+	}
+	server.serving = false
+	p.checkHealth()
+	if p.Healthy(ModelPluginKind, "remote") {
+		t.Errorf("plugin not serving is healthy")
+	}
+	health := p.PluginHealth()
+	if len(health) != 1 || health[0].Healthy || health[0].Err == "" {
+		t.Errorf("plugin health is %+v", health)
+	}
+	server.serving = true
+	p.checkHealth()
+	if !p.Healthy(ModelPluginKind, "remote") {
+		t.Errorf("plugin serving again is unhealthy")
+	}
+
+	hung := func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}
+	if err := runHealthCheck(hung, 10*time.Millisecond); err == nil {
+		t.Errorf("hung health check does not return error")
+	}
+}
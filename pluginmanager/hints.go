@@ -0,0 +1,23 @@
+package pluginmanager
+
+// Hint is a reaction to the transaction suggested by a model plugin to
+// the connector, beyond blocking it
+type Hint struct {
+	// Action is what the connector is asked to do, such as HintSanitize
+	// or HintAddHeader, or an action agreed with the connector
+	Action string `json:"action"`
+	// Target is what the action applies to, such as a parameter or a
+	// header name
+	Target string `json:"target,omitempty"`
+	// Value is the argument of the action, such as a header value
+	Value string `json:"value,omitempty"`
+}
+
+// Actions of the hints understood by the connectors
+const (
+	// HintSanitize asks to sanitize the parameter named by the Target
+	HintSanitize = "sanitize"
+	// HintAddHeader asks to add the header named by the Target with the
+	// Value, e.g. to have a downstream service show a captcha
+	HintAddHeader = "add_header"
+)
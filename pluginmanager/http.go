@@ -0,0 +1,53 @@
+package pluginmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// httpModelTimeout bounds the requests to the http models without a
+// timeout
+const httpModelTimeout = 30 * time.Second
+
+// newHTTPModel creates the process function of an http model plugin,
+// which posts the model input as JSON to url with the given headers,
+// and parses the model results from the JSON answer
+func newHTTPModel(url string, headers map[string]string, timeout time.Duration) func(ModelInput) (ModelResults, error) {
+	if timeout <= 0 {
+		timeout = httpModelTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	return func(input ModelInput) (ModelResults, error) {
+		body, err := json.Marshal(input)
+		if err != nil {
+			return ModelResults{}, err
+		}
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return ModelResults{}, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return ModelResults{}, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return ModelResults{}, fmt.Errorf("http model returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+		}
+		var res ModelResults
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			return ModelResults{}, fmt.Errorf("invalid http model results: %v", err)
+		}
+		return res, nil
+	}
+}
@@ -0,0 +1,40 @@
+package pluginmanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPModel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			http.Error(w, "invalid key", http.StatusUnauthorized)
+			return
+		}
+		var input ModelInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if input.Payload == "slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		json.NewEncoder(w).Encode(ModelResults{ProbAttack: 0.75, Data: map[string]interface{}{"transaction": input.TransactionId}})
+	}))
+	defer server.Close()
+
+	process := newHTTPModel(server.URL, map[string]string{"X-Api-Key": "secret"}, 50*time.Millisecond)
+	res, err := process(ModelInput{TransactionId: "tx-1", Payload: "GET / HTTP/1.1\n"})
+	if err != nil || res.ProbAttack != 0.75 || res.Data["transaction"] != "tx-1" {
+		t.Errorf("http model returned %+v, %v", res, err)
+	}
+	if _, err := process(ModelInput{Payload: "slow"}); err == nil {
+		t.Errorf("http model over its timeout does not return error")
+	}
+	if _, err := newHTTPModel(server.URL, nil, 0)(ModelInput{}); err == nil {
+		t.Errorf("http model error status does not return error")
+	}
+}
@@ -0,0 +1,110 @@
+package pluginmanager
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Instruments is a registry of metric instruments created once from a
+// meter and shared by the core and the plugins, so that instruments
+// are not re-created on every request.
+type Instruments struct {
+	meter             metric.Meter
+	mutex             sync.RWMutex
+	int64Counters     map[string]metric.Int64Counter
+	float64Counters   map[string]metric.Float64Counter
+	int64Histograms   map[string]metric.Int64Histogram
+	float64Histograms map[string]metric.Float64Histogram
+	float64Gauges     map[string]metric.Float64Gauge
+}
+
+// instruments is the registry of the plugin manager created last by New
+var instruments atomic.Pointer[Instruments]
+
+// NewInstruments creates an instrument registry for the given meter
+func NewInstruments(meter metric.Meter) *Instruments {
+	return &Instruments{
+		meter:             meter,
+		int64Counters:     make(map[string]metric.Int64Counter),
+		float64Counters:   make(map[string]metric.Float64Counter),
+		int64Histograms:   make(map[string]metric.Int64Histogram),
+		float64Histograms: make(map[string]metric.Float64Histogram),
+		float64Gauges:     make(map[string]metric.Float64Gauge),
+	}
+}
+
+// GetInstruments returns the instrument registry of the running plugin
+// manager. Plugins can use it to share instruments with the core.
+func GetInstruments() *Instruments {
+	return instruments.Load()
+}
+
+// Meter returns the meter the instruments are created from
+func (i *Instruments) Meter() metric.Meter {
+	return i.meter
+}
+
+// Int64Counter returns the counter with the given name, creating it
+// with the given options on first use
+func (i *Instruments) Int64Counter(name string, options ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return cached(i, i.int64Counters, name, func() (metric.Int64Counter, error) {
+		return i.meter.Int64Counter(name, options...)
+	})
+}
+
+// Float64Counter returns the counter with the given name, creating it
+// with the given options on first use
+func (i *Instruments) Float64Counter(name string, options ...metric.Float64CounterOption) (metric.Float64Counter, error) {
+	return cached(i, i.float64Counters, name, func() (metric.Float64Counter, error) {
+		return i.meter.Float64Counter(name, options...)
+	})
+}
+
+// Int64Histogram returns the histogram with the given name, creating
+// it with the given options on first use
+func (i *Instruments) Int64Histogram(name string, options ...metric.Int64HistogramOption) (metric.Int64Histogram, error) {
+	return cached(i, i.int64Histograms, name, func() (metric.Int64Histogram, error) {
+		return i.meter.Int64Histogram(name, options...)
+	})
+}
+
+// Float64Histogram returns the histogram with the given name, creating
+// it with the given options on first use
+func (i *Instruments) Float64Histogram(name string, options ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	return cached(i, i.float64Histograms, name, func() (metric.Float64Histogram, error) {
+		return i.meter.Float64Histogram(name, options...)
+	})
+}
+
+// Float64Gauge returns the gauge with the given name, creating it with
+// the given options on first use
+func (i *Instruments) Float64Gauge(name string, options ...metric.Float64GaugeOption) (metric.Float64Gauge, error) {
+	return cached(i, i.float64Gauges, name, func() (metric.Float64Gauge, error) {
+		return i.meter.Float64Gauge(name, options...)
+	})
+}
+
+// cached returns the instrument with the given name from the cache of
+// the registry, one of its maps, creating it on first use
+func cached[T any](i *Instruments, cache map[string]T, name string, create func() (T, error)) (T, error) {
+	i.mutex.RLock()
+	inst, ok := cache[name]
+	i.mutex.RUnlock()
+	if ok {
+		return inst, nil
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if inst, ok := cache[name]; ok {
+		return inst, nil
+	}
+	inst, err := create()
+	if err != nil {
+		return inst, err
+	}
+	cache[name] = inst
+	return inst, nil
+}
@@ -0,0 +1,35 @@
+package pluginmanager
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestInstrumentsCache(t *testing.T) {
+	inst := NewInstruments(testMeter)
+
+	first, err := inst.Int64Counter("wace.test.counter")
+	if err != nil {
+		t.Fatalf("Int64Counter returned error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			counter, err := inst.Int64Counter("wace.test.counter")
+			if err != nil || counter != first {
+				t.Errorf("Int64Counter did not return the cached instrument")
+			}
+			if _, err := inst.Int64Histogram("wace.test.histogram"); err != nil {
+				t.Errorf("Int64Histogram returned error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(inst.int64Counters) != 1 || len(inst.int64Histograms) != 1 {
+		t.Errorf("instruments created more than once: %d counters, %d histograms", len(inst.int64Counters), len(inst.int64Histograms))
+	}
+}
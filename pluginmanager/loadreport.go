@@ -0,0 +1,168 @@
+package pluginmanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"plugin"
+	"sort"
+	"strings"
+	"time"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// PluginLoadStatus is the outcome of loading a plugin
+type PluginLoadStatus string
+
+const (
+	PluginLoaded  PluginLoadStatus = "loaded"
+	PluginSkipped PluginLoadStatus = "skipped"
+)
+
+// Kinds of plugins in the load report
+const (
+	ModelPluginKind    = "model"
+	DecisionPluginKind = "decision"
+)
+
+// PluginLoadEvent records the loading of a configured plugin
+type PluginLoadEvent struct {
+	ID     string           `json:"id"`
+	Kind   string           `json:"kind"`
+	Path   string           `json:"path,omitempty"`
+	Status PluginLoadStatus `json:"status"`
+	// Reason is why the plugin was skipped
+	Reason string `json:"reason,omitempty"`
+	// Version is the value of the Version variable or function exported
+	// by the plugin, if any
+	Version string `json:"version,omitempty"`
+	// APIVersion is the plugin API version declared by the plugin
+	APIVersion int `json:"apiVersion,omitempty"`
+	// Checksum is the SHA-256 of the plugin file
+	Checksum string    `json:"checksum,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// LoadReport returns the load events of the configured plugins, sorted
+// by kind and ID
+func (p *PluginManager) LoadReport() []PluginLoadEvent {
+	p.plugins.RLock()
+	report := append([]PluginLoadEvent(nil), p.loadReport...)
+	p.plugins.RUnlock()
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Kind != report[j].Kind {
+			return report[i].Kind > report[j].Kind
+		}
+		return report[i].ID < report[j].ID
+	})
+	return report
+}
+
+// PluginLoadError aggregates the configured plugins that could not be
+// loaded
+type PluginLoadError struct {
+	// Plugins maps the ID of each plugin to why it was skipped
+	Plugins map[string]string `json:"plugins"`
+}
+
+func (e *PluginLoadError) Error() string {
+	ids := make([]string, 0, len(e.Plugins))
+	for id := range e.Plugins {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	failures := make([]string, len(ids))
+	for i, id := range ids {
+		failures[i] = id + ": " + e.Plugins[id]
+	}
+	return "plugins not loaded: " + strings.Join(failures, "; ")
+}
+
+// LoadError returns the plugins that could not be loaded, or nil if
+// they all were. A plugin loaded after retrying its initialization is
+// not reported.
+func (p *PluginManager) LoadError() *PluginLoadError {
+	p.plugins.RLock()
+	defer p.plugins.RUnlock()
+	skipped := make(map[string]string)
+	for _, event := range p.loadReport {
+		if event.Status == PluginSkipped {
+			skipped[event.ID] = event.Reason
+		} else {
+			delete(skipped, event.ID)
+		}
+	}
+	if len(skipped) == 0 {
+		return nil
+	}
+	return &PluginLoadError{Plugins: skipped}
+}
+
+// recordLoad adds the event to the load report and emits it as an
+// audit event in the log
+func (p *PluginManager) recordLoad(event PluginLoadEvent) {
+	logger := lg.Get()
+	event.Time = time.Now()
+	if event.Checksum == "" && event.Path != "" {
+		event.Checksum = fileChecksum(event.Path)
+	}
+	p.plugins.Lock()
+	p.loadReport = append(p.loadReport, event)
+	p.plugins.Unlock()
+	if event.Status == PluginSkipped {
+		logger.Printf(lg.WARN, "| %s | cannot load plugin: %s", event.ID, event.Reason)
+	}
+	data, err := json.Marshal(event)
+	if err == nil {
+		logger.Printf(lg.INFO, "| %s | audit | plugin load %s", event.ID, data)
+	}
+}
+
+// loaded records a plugin loaded from the given path
+func (p *PluginManager) loaded(kind, id, path string, tp *plugin.Plugin) {
+	p.hold(tp)
+	apiVersion, _ := pluginAPIVersion(tp.Lookup)
+	p.recordLoad(PluginLoadEvent{ID: id, Kind: kind, Path: path, Status: PluginLoaded, Version: pluginVersion(tp), APIVersion: apiVersion})
+}
+
+// skipped records a plugin that could not be loaded
+func (p *PluginManager) skipped(kind, id, path, reason string) {
+	p.recordLoad(PluginLoadEvent{ID: id, Kind: kind, Path: path, Status: PluginSkipped, Reason: reason})
+}
+
+// pluginVersion returns the version exported by the plugin as a
+// Version string variable or function
+func pluginVersion(tp *plugin.Plugin) string {
+	if tp == nil {
+		return ""
+	}
+	sym, err := tp.Lookup("Version")
+	if err != nil {
+		return ""
+	}
+	switch v := sym.(type) {
+	case *string:
+		return *v
+	case func() string:
+		return v()
+	}
+	return ""
+}
+
+// fileChecksum returns the hex SHA-256 of the file, or an empty string
+// if it cannot be read
+func fileChecksum(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
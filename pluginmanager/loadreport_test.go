@@ -0,0 +1,42 @@
+package pluginmanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plugin.so")
+	if err := os.WriteFile(path, []byte("not a plugin"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := new(PluginManager)
+	p.skipped(ModelPluginKind, "broken", path, "invalid plugin")
+	p.recordLoad(PluginLoadEvent{ID: "rules", Kind: DecisionPluginKind, Status: PluginLoaded})
+	p.skipped(ModelPluginKind, "missing", "/nonexistent/plugin.so", "not found")
+
+	report := p.LoadReport()
+	if len(report) != 3 || report[0].ID != "broken" || report[1].ID != "missing" || report[2].ID != "rules" {
+		t.Fatalf("unexpected load report %+v", report)
+	}
+	// sha256 of "not a plugin"
+	if report[0].Checksum != "c6c74590250e3d5d3e3ea67cd2074d7e4689b25a30b8dd137999c3ed6e00858e" {
+		t.Errorf("checksum of broken plugin is %q", report[0].Checksum)
+	}
+	if report[1].Checksum != "" || report[1].Status != PluginSkipped || report[1].Reason != "not found" {
+		t.Errorf("unexpected event of missing plugin %+v", report[1])
+	}
+
+	loadErr := p.LoadError()
+	if loadErr == nil || len(loadErr.Plugins) != 2 || loadErr.Plugins["missing"] != "not found" {
+		t.Errorf("unexpected load error %+v", loadErr)
+	}
+	if msg := loadErr.Error(); msg != "plugins not loaded: broken: invalid plugin; missing: not found" {
+		t.Errorf("load error message is %q", msg)
+	}
+	if new(PluginManager).LoadError() != nil {
+		t.Errorf("load error without skipped plugins")
+	}
+}
@@ -0,0 +1,30 @@
+package pluginmanager
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+func TestTransactionMeta(t *testing.T) {
+	var got map[string]string
+	p := &PluginManager{
+		modelPlugins: map[string]modelPlugin{"headers": {pluginType: cf.RequestHeaders}},
+		modelProcessFunc: map[string]func(ModelInput) (ModelResults, error){"headers": func(input ModelInput) (ModelResults, error) {
+			got = input.Metadata
+			return ModelResults{}, nil
+		}},
+	}
+	p.InitTransaction("tx")
+	defer p.CloseTransaction("tx")
+
+	p.SetTransactionMeta("tx", map[string]string{MetaClientIP: "192.0.2.1", MetaMethod: "GET"})
+	p.SetTransactionMeta("tx", map[string]string{MetaMethod: "POST", MetaURI: "/login"})
+	status := make(chan ModelStatus, 1)
+	p.Process("headers", "tx", "POST /login HTTP/1.1\n", cf.RequestHeaders, status)
+	<-status
+
+	if len(got) != 3 || got[MetaClientIP] != "192.0.2.1" || got[MetaMethod] != "POST" || got[MetaURI] != "/login" {
+		t.Errorf("metadata given to the model is %v", got)
+	}
+}
@@ -0,0 +1,111 @@
+package pluginmanager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// modelOutcome is the result of a model plugin call run in the
+// background
+type modelOutcome struct {
+	res ModelResults
+	err error
+}
+
+// processWithRetries calls the model plugin with the input, retrying
+// the calls that fail or time out as configured. Without retries, the
+// call is left unbounded and the core enforces the timeout.
+func (p *PluginManager) processWithRetries(modelID string, process func(ModelInput) (ModelResults, error), input ModelInput) (ModelResults, error) {
+	conf := p.config().ModelPlugins[modelID]
+	if conf.Retries == 0 {
+		return process(input)
+	}
+	for retry := 1; ; retry++ {
+		res, err := runModelBounded(process, input, conf.Timeout)
+		if err == nil || retry > conf.Retries {
+			return res, err
+		}
+		if _, ok := p.transaction(input.TransactionId); !ok {
+			return res, err
+		}
+		delay := cf.RetryDelay(conf.RetryBackoff, retry)
+		lg.Get().TPrintf(lg.WARN, input.TransactionId, "%s | %v, retry %d in %v", modelID, err, retry, delay)
+		p.recordModelRetry(modelID)
+		time.Sleep(delay)
+	}
+}
+
+// runModelBounded calls the model plugin, giving up after the timeout
+// if positive. The call keeps running in the background until it
+// returns, and its results are then dropped.
+func runModelBounded(process func(ModelInput) (ModelResults, error), input ModelInput, timeout time.Duration) (ModelResults, error) {
+	if timeout <= 0 {
+		return process(input)
+	}
+	outcome := make(chan modelOutcome, 1)
+	go func() {
+		res, err := process(input)
+		outcome <- modelOutcome{res, err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case o := <-outcome:
+		return o.res, o.err
+	case <-timer.C:
+		return ModelResults{}, fmt.Errorf("timed out after %v", timeout)
+	}
+}
+
+// resendUnanswered publishes the input of the remote model again if it
+// has not answered within its timeout, after the backoff of the retry,
+// until its retries are exhausted
+func (p *PluginManager) resendUnanswered(modelId, transactionId string, data []byte, retry int) {
+	conf := p.config().ModelPlugins[modelId]
+	if retry > conf.Retries || conf.Timeout <= 0 {
+		return
+	}
+	time.AfterFunc(conf.Timeout+cf.RetryDelay(conf.RetryBackoff, retry), func() {
+		if !p.awaiting(transactionId, modelId) {
+			return
+		}
+		lg.Get().TPrintf(lg.WARN, transactionId, "%s | no answer within %v, retry %d", modelId, conf.Timeout, retry)
+		p.recordModelRetry(modelId)
+		if err := p.natConn.PublishMsg(NewWorkerMsg(ModelSubject(modelId), data)); err != nil {
+			lg.Get().TPrintf(lg.ERROR, transactionId, "%s | retry %d not queued: %v", modelId, retry, err)
+			return
+		}
+		p.resendUnanswered(modelId, transactionId, data, retry+1)
+	})
+}
+
+// awaiting returns true if the remote model was queued for the
+// transaction and has not answered yet
+func (p *PluginManager) awaiting(transactionId, modelId string) bool {
+	queued, ok := p.queued.Load(transactionId)
+	if !ok {
+		return false
+	}
+	_, ok = queued.(*sync.Map).Load(modelId)
+	return ok
+}
+
+// recordModelRetry counts the retries of a model plugin
+func (p *PluginManager) recordModelRetry(modelId string) {
+	if p.instruments == nil {
+		return
+	}
+	counter, err := p.instruments.Int64Counter("wace.model.retry.total", metric.WithDescription("Number of model plugin calls retried"))
+	if err != nil {
+		return
+	}
+	counter.Add(context.Background(), 1, metric.WithAttributes(attribute.String("model_id", modelId)))
+}
@@ -0,0 +1,163 @@
+package pluginmanager
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// States of a connection to the NATS server reported to the NATS state
+// handler
+const (
+	NATSDisconnected = "disconnected"
+	NATSReconnected  = "reconnected"
+	// NATSClosed is a connection closed for good, either on shutdown or
+	// once the reconnect attempts are exhausted
+	NATSClosed = "closed"
+)
+
+// NATSStateEvent is a change of state of a connection to the NATS
+// server
+type NATSStateEvent struct {
+	// Name is the name of the connection, wace for the connection of the
+	// plugin manager or wace-<id> for that of a local async model
+	Name string
+	// State is one of the NATS state constants
+	State string
+	// URL is the server reconnected to, for NATSReconnected
+	URL string
+	// Err is the error the connection was lost with, if any
+	Err error
+}
+
+// natsStateHandler is the function given to SetNATSStateHandler
+var natsStateHandler atomic.Pointer[func(NATSStateEvent)]
+
+// SetNATSStateHandler sets a function called with every change of state
+// of the connections to the NATS server, e.g. to report the readiness
+// of the instance. A nil function removes the handler. The changes are
+// also logged and counted in wace.nats.state.total.
+func SetNATSStateHandler(fn func(NATSStateEvent)) {
+	if fn == nil {
+		natsStateHandler.Store(nil)
+		return
+	}
+	natsStateHandler.Store(&fn)
+}
+
+// reconnectDelay returns the delay before the given reconnect attempt,
+// doubled after each attempt from wait up to maxWait
+func reconnectDelay(attempts int, wait, maxWait time.Duration) time.Duration {
+	delay := wait
+	for i := 1; i < attempts && delay < maxWait; i++ {
+		delay *= 2
+	}
+	if delay > maxWait {
+		delay = maxWait
+	}
+	return delay
+}
+
+// connectNATS connects to the NATS server of the configuration with the
+// given connection name, over TLS and authenticated as configured. The
+// connection is re-established with backoff when lost, resending its
+// subscriptions, and the messages published meanwhile are buffered. The
+// changes of state are counted in the instruments, if any.
+func connectNATS(conf *cf.ConfigStore, name string, instruments *Instruments) (*nats.Conn, error) {
+	rc := conf.NATSReconnect
+	maxReconnects := rc.MaxAttempts
+	if maxReconnects == 0 {
+		maxReconnects = -1
+	}
+	stateChanged := func(nc *nats.Conn, state string, err error) {
+		event := NATSStateEvent{Name: name, State: state, Err: err}
+		if state == NATSReconnected {
+			event.URL = nc.ConnectedUrlRedacted()
+		}
+		notifyNATSState(event, instruments)
+	}
+	options := []nats.Option{
+		nats.Name(name),
+		nats.MaxReconnects(maxReconnects),
+		nats.CustomReconnectDelay(func(attempts int) time.Duration {
+			return reconnectDelay(attempts, rc.Wait, rc.MaxWait)
+		}),
+		nats.ReconnectBufSize(rc.BufferSize),
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			// closing disconnects too, reported by the closed handler
+			if !nc.IsClosed() {
+				stateChanged(nc, NATSDisconnected, err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			stateChanged(nc, NATSReconnected, nil)
+		}),
+		nats.ClosedHandler(func(nc *nats.Conn) {
+			stateChanged(nc, NATSClosed, nc.LastError())
+		}),
+	}
+	return nats.Connect(conf.NatsURL, append(options, natsSecurityOptions(conf)...)...)
+}
+
+// natsSecurityOptions returns the options of the TLS and the
+// authentication of the connections to the NATS server
+func natsSecurityOptions(conf *cf.ConfigStore) []nats.Option {
+	var options []nats.Option
+	if conf.NATSTLS.CA != "" {
+		options = append(options, nats.RootCAs(conf.NATSTLS.CA))
+	}
+	if conf.NATSTLS.Cert != "" {
+		options = append(options, nats.ClientCert(conf.NATSTLS.Cert, conf.NATSTLS.Key))
+	}
+	auth := conf.NATSAuth
+	switch {
+	case auth.Creds != "":
+		options = append(options, nats.UserCredentials(auth.Creds))
+	case auth.Token != "":
+		options = append(options, nats.Token(auth.Token))
+	case auth.User != "":
+		options = append(options, nats.UserInfo(auth.User, auth.Password))
+	}
+	return options
+}
+
+// notifyNATSState logs and counts a change of state of a connection to
+// the NATS server, and calls the NATS state handler with it
+func notifyNATSState(event NATSStateEvent, instruments *Instruments) {
+	logger := lg.Get()
+	switch {
+	case event.State == NATSReconnected:
+		logger.Printf(lg.INFO, "NATS connection %s reconnected to %s", event.Name, event.URL)
+	case event.Err != nil:
+		logger.Printf(lg.WARN, "NATS connection %s %s: %v", event.Name, event.State, event.Err)
+	default:
+		logger.Printf(lg.INFO, "NATS connection %s %s", event.Name, event.State)
+	}
+	if instruments != nil {
+		counter, err := instruments.Int64Counter("wace.nats.state.total", metric.WithDescription("Number of changes of state of the NATS connections"))
+		if err == nil {
+			counter.Add(context.Background(), 1, metric.WithAttributes(attribute.String("state", event.State)))
+		}
+	}
+	if fn := natsStateHandler.Load(); fn != nil {
+		(*fn)(event)
+	}
+}
+
+// NATSState returns the state of the connection of the plugin manager
+// to the NATS server, such as connected or reconnecting, or an empty
+// string if it has none
+func (p *PluginManager) NATSState() string {
+	if p.natConn == nil {
+		return ""
+	}
+	return strings.ToLower(p.natConn.Status().String())
+}
@@ -0,0 +1,206 @@
+package pluginmanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+func TestReconnectDelay(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: 10 * time.Millisecond, 2: 20 * time.Millisecond, 3: 40 * time.Millisecond, 10: 50 * time.Millisecond} {
+		if delay := reconnectDelay(attempts, 10*time.Millisecond, 50*time.Millisecond); delay != want {
+			t.Errorf("delay of attempt %d is %v, want %v", attempts, delay, want)
+		}
+	}
+}
+
+// startNATSServer starts a NATS server in the process on the loopback
+// interface with the given options
+func startNATSServer(t *testing.T, opts server.Options) *server.Server {
+	t.Helper()
+	opts.Host, opts.NoLog, opts.NoSigs = "127.0.0.1", true, true
+	s, err := server.NewServer(&opts)
+	if err != nil {
+		t.Fatalf("cannot create the NATS server: %v", err)
+	}
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatalf("NATS server not ready")
+	}
+	return s
+}
+
+func TestConnectNATSReconnect(t *testing.T) {
+	s := startNATSServer(t, server.Options{Port: server.RANDOM_PORT})
+	states := make(chan NATSStateEvent, 10)
+	SetNATSStateHandler(func(event NATSStateEvent) { states <- event })
+	defer SetNATSStateHandler(nil)
+
+	conf := &cf.ConfigStore{NatsURL: s.ClientURL(), NATSReconnect: cf.NATSReconnectConfig{Wait: 10 * time.Millisecond, MaxWait: 50 * time.Millisecond, BufferSize: 1024}}
+	nc, err := connectNATS(conf, "wace", nil)
+	if err != nil {
+		t.Fatalf("connectNATS returned error: %v", err)
+	}
+	defer nc.Close()
+	p := &PluginManager{natConn: nc}
+	sub, err := nc.SubscribeSync("wace.test")
+	if err != nil {
+		t.Fatalf("Subscribe returned error: %v", err)
+	}
+	if state := p.NATSState(); state != "connected" {
+		t.Errorf("state is %s, want connected", state)
+	}
+
+	port := s.Addr().(*net.TCPAddr).Port
+	s.Shutdown()
+	if event := <-states; event.Name != "wace" || event.State != NATSDisconnected {
+		t.Errorf("event on shutdown is %+v", event)
+	}
+	if err := nc.Publish("wace.test", []byte("buffered")); err != nil {
+		t.Fatalf("Publish while disconnected returned error: %v", err)
+	}
+	if state := p.NATSState(); state != "reconnecting" {
+		t.Errorf("state while disconnected is %s, want reconnecting", state)
+	}
+
+	startNATSServer(t, server.Options{Port: port})
+	select {
+	case event := <-states:
+		if event.State != NATSReconnected || event.URL == "" {
+			t.Errorf("event on restart is %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("not reconnected")
+	}
+	msg, err := sub.NextMsg(5 * time.Second)
+	if err != nil || string(msg.Data) != "buffered" {
+		t.Errorf("message received after reconnecting is %v, %v", msg, err)
+	}
+
+	nc.Close()
+	if event := <-states; event.State != NATSClosed {
+		t.Errorf("event on close is %+v", event)
+	}
+	if state := p.NATSState(); state != "closed" {
+		t.Errorf("state once closed is %s", state)
+	}
+}
+
+func TestConnectNATSAuth(t *testing.T) {
+	servers := map[string]server.Options{
+		"token":    {Port: server.RANDOM_PORT, Authorization: "s3cret"},
+		"password": {Port: server.RANDOM_PORT, Username: "wace", Password: "s3cret"},
+	}
+	auths := map[string]cf.NATSAuthConfig{
+		"token":    {Token: "s3cret"},
+		"password": {User: "wace", Password: "s3cret"},
+	}
+	for name, opts := range servers {
+		s := startNATSServer(t, opts)
+		conf := &cf.ConfigStore{NatsURL: s.ClientURL(), NATSReconnect: cf.NATSReconnectConfig{MaxAttempts: 1}}
+		if nc, err := connectNATS(conf, "wace", nil); err == nil {
+			nc.Close()
+			t.Errorf("%s server accepted a connection without authentication", name)
+		}
+		conf.NATSAuth = auths[name]
+		nc, err := connectNATS(conf, "wace", nil)
+		if err != nil {
+			t.Errorf("%s connection returned error: %v", name, err)
+			continue
+		}
+		nc.Close()
+	}
+}
+
+// writeCertificate writes a self-signed certificate of the loopback
+// address and its key to PEM files of dir
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey returned error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "wace test"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate returned error: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey returned error: %v", err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestConnectNATSTLS(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, t.TempDir())
+	tlsConfig, err := server.GenTLSConfig(&server.TLSConfigOpts{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("GenTLSConfig returned error: %v", err)
+	}
+	s := startNATSServer(t, server.Options{Port: server.RANDOM_PORT, TLS: true, TLSConfig: tlsConfig})
+	url := "nats://" + s.Addr().String()
+
+	conf := &cf.ConfigStore{NatsURL: url, NATSReconnect: cf.NATSReconnectConfig{MaxAttempts: 1}}
+	if nc, err := connectNATS(conf, "wace", nil); err == nil {
+		nc.Close()
+		t.Errorf("connected without trusting the server certificate")
+	}
+	conf.NATSTLS = cf.NATSTLSConfig{CA: certFile}
+	nc, err := connectNATS(conf, "wace", nil)
+	if err != nil {
+		t.Fatalf("TLS connection returned error: %v", err)
+	}
+	defer nc.Close()
+	if _, err := nc.TLSConnectionState(); err != nil {
+		t.Errorf("connection is not over TLS: %v", err)
+	}
+
+	// the server verifying the clients requires the client certificate
+	tlsConfig, err = server.GenTLSConfig(&server.TLSConfigOpts{CertFile: certFile, KeyFile: keyFile, CaFile: certFile, Verify: true})
+	if err != nil {
+		t.Fatalf("GenTLSConfig returned error: %v", err)
+	}
+	s = startNATSServer(t, server.Options{Port: server.RANDOM_PORT, TLS: true, TLSVerify: true, TLSConfig: tlsConfig})
+	conf.NatsURL = "nats://" + s.Addr().String()
+	if nc, err := connectNATS(conf, "wace", nil); err == nil {
+		nc.Close()
+		t.Errorf("connected without a client certificate")
+	}
+	conf.NATSTLS = cf.NATSTLSConfig{Cert: certFile, Key: keyFile, CA: certFile}
+	nc, err = connectNATS(conf, "wace", nil)
+	if err != nil {
+		t.Fatalf("mutual TLS connection returned error: %v", err)
+	}
+	nc.Close()
+}
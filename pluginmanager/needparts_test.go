@@ -0,0 +1,51 @@
+package pluginmanager
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+func TestProcessNeedParts(t *testing.T) {
+	headers := func(input ModelInput) (ModelResults, error) {
+		return ModelResults{ProbAttack: 0.4, NeedParts: []string{"RequestBody"}}, nil
+	}
+	p := &PluginManager{
+		modelPlugins:     map[string]modelPlugin{"headers": {pluginType: cf.RequestHeaders}},
+		modelProcessFunc: map[string]func(ModelInput) (ModelResults, error){"headers": headers},
+	}
+	p.InitTransaction("tx")
+	defer p.CloseTransaction("tx")
+
+	status := make(chan ModelStatus, 1)
+	p.Process("headers", "tx", "GET / HTTP/1.1\n", cf.RequestHeaders, status)
+	if s := <-status; s.Err != nil || len(s.NeedParts) != 1 || s.NeedParts[0] != "RequestBody" {
+		t.Errorf("status of a model needing the body is %+v", s)
+	}
+	results, _ := p.TransactionResults("tx")
+	if len(results["headers"].NeedParts) != 1 {
+		t.Errorf("stored results are %+v", results)
+	}
+}
+
+func TestProcessStatus(t *testing.T) {
+	model := func(input ModelInput) (ModelResults, error) {
+		return ModelResults{ProbAttack: 0.7, Data: map[string]interface{}{"tokens": 3}}, nil
+	}
+	p := &PluginManager{
+		modelPlugins:     map[string]modelPlugin{"model": {pluginType: cf.RequestBody}},
+		modelProcessFunc: map[string]func(ModelInput) (ModelResults, error){"model": model},
+	}
+	p.InitTransaction("tx")
+	defer p.CloseTransaction("tx")
+
+	status := make(chan ModelStatus, 1)
+	p.Process("model", "tx", "a=1", cf.RequestBody, status)
+	s := <-status
+	if s.Err != nil || s.Data["tokens"] != 3 || s.Transport != TransportLocal {
+		t.Errorf("status of the model is %+v", s)
+	}
+	if s.Start.IsZero() || s.End.Before(s.Start) {
+		t.Errorf("model called at %v and returned at %v", s.Start, s.End)
+	}
+}
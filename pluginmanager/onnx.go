@@ -0,0 +1,114 @@
+package pluginmanager
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/tiroa-tilsor/wacelib/onnx"
+)
+
+// newONNXModel loads the ONNX model file at path and returns its
+// process function. The payload is turned into the input of the model
+// by the tokenizer param (chars, words or bytes, chars by default) with
+// the ngram (3), features (the size of the last dimension of the input
+// by default), lowercase (true) and urldecode (false) params. The
+// attack probability is the attackindex value (the last one by
+// default) of the output, which defaults to the first one, and the
+// values of the output are reported in the "scores" data key.
+func newONNXModel(path string, params map[string]string) (func(ModelInput) (ModelResults, error), error) {
+	model, err := onnx.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(model.Inputs) > 1 {
+		return nil, fmt.Errorf("models with %d inputs are not supported", len(model.Inputs))
+	}
+	input := model.Inputs[0]
+	output := model.Outputs[0]
+	if name := params["output"]; name != "" {
+		if output, err = valueInfo(model.Outputs, name); err != nil {
+			return nil, err
+		}
+	}
+
+	pre := onnx.Preprocessor{Tokenizer: params["tokenizer"], Lowercase: true}
+	if pre.Tokenizer == "" {
+		pre.Tokenizer = onnx.TokenizerChars
+	}
+	ngram, err := floatParam(params, "ngram", 3)
+	if err != nil {
+		return nil, err
+	}
+	pre.NGram = int(ngram)
+	if len(input.Shape) > 0 {
+		pre.Features = input.Shape[len(input.Shape)-1]
+	}
+	features, err := floatParam(params, "features", float64(pre.Features))
+	if err != nil {
+		return nil, err
+	}
+	pre.Features = int(features)
+	if pre.Lowercase, err = boolParam(params, "lowercase", true); err != nil {
+		return nil, err
+	}
+	if pre.URLDecode, err = boolParam(params, "urldecode", false); err != nil {
+		return nil, err
+	}
+	if err := pre.Check(); err != nil {
+		return nil, err
+	}
+	attackIndex, err := floatParam(params, "attackindex", -1)
+	if err != nil {
+		return nil, err
+	}
+
+	// the features are given as a batch of one, unless the model takes
+	// a single vector
+	shape := []int{1, pre.Features}
+	if len(input.Shape) == 1 {
+		shape = shape[1:]
+	}
+	return func(in ModelInput) (ModelResults, error) {
+		outputs, err := model.Run(map[string]onnx.Tensor{input.Name: {Shape: shape, Data: pre.Transform(in.Payload)}})
+		if err != nil {
+			return ModelResults{}, err
+		}
+		scores := outputs[output.Name].Data
+		index := int(attackIndex)
+		if index < 0 {
+			index = len(scores) - 1
+		}
+		if index < 0 || index >= len(scores) {
+			return ModelResults{}, fmt.Errorf("attack index %d out of the %d output values", index, len(scores))
+		}
+		prob := float64(scores[index])
+		if prob < 0 || prob > 1 {
+			return ModelResults{}, fmt.Errorf("output %s value %v is not a probability", output.Name, prob)
+		}
+		return ModelResults{ProbAttack: prob, Data: map[string]interface{}{"scores": scores}}, nil
+	}, nil
+}
+
+// valueInfo returns the output of the given name
+func valueInfo(infos []onnx.ValueInfo, name string) (onnx.ValueInfo, error) {
+	for _, info := range infos {
+		if info.Name == name {
+			return info, nil
+		}
+	}
+	return onnx.ValueInfo{}, fmt.Errorf("model has no %s output", name)
+}
+
+// boolParam returns the value of a boolean param, or def if not set
+func boolParam(params map[string]string, name string, def bool) (bool, error) {
+	value, ok := params[name]
+	if !ok || value == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s param %s: %v", name, value, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,86 @@
+package pluginmanager
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// writeONNXModel writes an ONNX model computing the sigmoid of the sum
+// of its 4 input features
+func writeONNXModel(t *testing.T) string {
+	field := func(b []byte, num protowire.Number, v []byte) []byte {
+		return protowire.AppendBytes(protowire.AppendTag(b, num, protowire.BytesType), v)
+	}
+	varint := func(b []byte, num protowire.Number, x uint64) []byte {
+		return protowire.AppendVarint(protowire.AppendTag(b, num, protowire.VarintType), x)
+	}
+	node := func(op string, inputs ...string) []byte {
+		var b []byte
+		for _, input := range inputs[:len(inputs)-1] {
+			b = field(b, 1, []byte(input))
+		}
+		b = field(b, 2, []byte(inputs[len(inputs)-1]))
+		return field(b, 4, []byte(op))
+	}
+	valueInfo := func(name string, dims ...uint64) []byte {
+		var shape []byte
+		for _, d := range dims {
+			shape = field(shape, 1, varint(nil, 1, d))
+		}
+		tensorType := field(varint(nil, 1, 1), 2, shape)
+		return field(field(nil, 1, []byte(name)), 2, field(nil, 1, tensorType))
+	}
+	weights := varint(varint(varint(field(nil, 8, []byte("w")), 2, 1), 1, 4), 1, 1)
+	for i := 0; i < 4; i++ {
+		weights = protowire.AppendFixed32(protowire.AppendTag(weights, 4, protowire.Fixed32Type), math.Float32bits(1))
+	}
+
+	var graph []byte
+	graph = field(graph, 1, node("MatMul", "x", "w", "z"))
+	graph = field(graph, 1, node("Sigmoid", "z", "p"))
+	graph = field(graph, 5, weights)
+	graph = field(graph, 11, valueInfo("x", 1, 4))
+	graph = field(graph, 12, valueInfo("p", 1, 1))
+	model := field(varint(nil, 1, 8), 7, graph)
+	model = field(model, 8, varint(nil, 2, 13))
+
+	path := filepath.Join(t.TempDir(), "model.onnx")
+	if err := os.WriteFile(path, model, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestONNXModel(t *testing.T) {
+	path := writeONNXModel(t)
+	process, err := newONNXModel(path, map[string]string{"tokenizer": "bytes", "lowercase": "false"})
+	if err != nil {
+		t.Fatalf("newONNXModel returned error: %v", err)
+	}
+	res, err := process(ModelInput{Payload: ""})
+	if err != nil || res.ProbAttack != 0.5 {
+		t.Errorf("empty payload scored %v, %v, want 0.5", res.ProbAttack, err)
+	}
+	res, err = process(ModelInput{Payload: "\xff\xff\xff\xff"})
+	if want := 1 / (1 + math.Exp(-4)); err != nil || math.Abs(res.ProbAttack-want) > 1e-6 {
+		t.Errorf("payload scored %v, %v, want %v", res.ProbAttack, err, want)
+	}
+
+	if _, err := newONNXModel(path, map[string]string{"tokenizer": "sentences"}); err == nil {
+		t.Errorf("invalid tokenizer does not return error")
+	}
+	if _, err := newONNXModel(path, map[string]string{"output": "z"}); err == nil {
+		t.Errorf("unknown output does not return error")
+	}
+	if _, err := newONNXModel(filepath.Join(t.TempDir(), "missing.onnx"), nil); err == nil {
+		t.Errorf("missing model file does not return error")
+	}
+	process, _ = newONNXModel(path, map[string]string{"attackindex": "1"})
+	if _, err := process(ModelInput{Payload: "GET / HTTP/1.1"}); err == nil {
+		t.Errorf("attack index out of the output does not return error")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package pluginmanager
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownedByProcess tells whether the file is owned by the user of the
+// process
+func ownedByProcess(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) == os.Getuid()
+}
@@ -0,0 +1,59 @@
+package pluginmanager
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// recovered turns a panic of the function of a plugin into an error
+// returned in err, logging its stack and counting it. It must be
+// deferred by the function calling the plugin.
+func (p *PluginManager) recovered(kind, id, function string, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	*err = fmt.Errorf("%s panicked: %v", function, r)
+	lg.Get().Printf(lg.ERROR, "| %s | %s plugin %s panicked: %v\n%s", id, kind, function, r, debug.Stack())
+	if p.instruments == nil {
+		return
+	}
+	counter, cerr := p.instruments.Int64Counter("wace.plugin.panics.total", metric.WithDescription("Number of panics of the plugins recovered"))
+	if cerr != nil {
+		return
+	}
+	counter.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("plugin_id", id),
+		attribute.String("plugin_kind", kind),
+		attribute.String("function", function)))
+}
+
+// guardProcess returns the Process function of a model plugin, turning
+// its panics into errors
+func (p *PluginManager) guardProcess(id string, process func(ModelInput) (ModelResults, error)) func(ModelInput) (ModelResults, error) {
+	return func(input ModelInput) (res ModelResults, err error) {
+		defer p.recovered(ModelPluginKind, id, "Process", &err)
+		return process(input)
+	}
+}
+
+// guardCheck returns the CheckResults function of a decision plugin,
+// turning its panics into errors
+func (p *PluginManager) guardCheck(id string, checkResults func(DecisionInput) (DecisionResult, error)) func(DecisionInput) (DecisionResult, error) {
+	return func(input DecisionInput) (res DecisionResult, err error) {
+		defer p.recovered(DecisionPluginKind, id, "CheckResults", &err)
+		return checkResults(input)
+	}
+}
+
+// safeCall calls an initialization or shutdown function of a plugin,
+// turning its panics into errors
+func (p *PluginManager) safeCall(kind, id, function string, init func() error) (err error) {
+	defer p.recovered(kind, id, function, &err)
+	return init()
+}
@@ -0,0 +1,46 @@
+package pluginmanager
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+func TestPanicIsolation(t *testing.T) {
+	p := &PluginManager{
+		modelPlugins: map[string]modelPlugin{"buggy": {pluginType: cf.RequestHeaders}},
+		modelProcessFunc: map[string]func(ModelInput) (ModelResults, error){"buggy": func(input ModelInput) (ModelResults, error) {
+			var m map[string]int
+			m["crash"]++
+			return ModelResults{ProbAttack: 1}, nil
+		}},
+	}
+	p.InitTransaction("tx")
+	defer p.CloseTransaction("tx")
+
+	status := make(chan ModelStatus, 1)
+	p.Process("buggy", "tx", "GET / HTTP/1.1\n", cf.RequestHeaders, status)
+	if s := <-status; s.Err == nil || !strings.Contains(s.Err.Error(), "Process panicked") || s.ProbAttack != 0 {
+		t.Errorf("panicking model returned status %+v", s)
+	}
+
+	check := p.guardCheck("buggy", func(DecisionInput) (DecisionResult, error) {
+		panic("index out of range")
+	})
+	if res, err := check(DecisionInput{}); err == nil || err.Error() != "CheckResults panicked: index out of range" || res.Block {
+		t.Errorf("panicking decision returned %+v, %v", res, err)
+	}
+
+	if err := p.safeCall(DecisionPluginKind, "buggy", "InitPlugin", func() error { panic("no model file") }); err == nil {
+		t.Errorf("panicking initialization returned no error")
+	}
+	initErr := errors.New("no model file")
+	if err := p.safeCall(DecisionPluginKind, "buggy", "InitPlugin", func() error { return initErr }); err != initErr {
+		t.Errorf("failing initialization returned %v", err)
+	}
+	if err := p.safeCall(ModelPluginKind, "buggy", "ShutdownPlugin", func() error { panic("session already closed") }); err == nil || err.Error() != "ShutdownPlugin panicked: session already closed" {
+		t.Errorf("panicking shutdown returned %v", err)
+	}
+}
@@ -8,9 +8,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"plugin"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/tiroa-tilsor/wacelib/bot"
 	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"github.com/tiroa-tilsor/wacelib/geoip"
+	"github.com/tiroa-tilsor/wacelib/httpmsg"
 	"go.opentelemetry.io/otel/metric"
 
 	"github.com/nats-io/nats.go"
@@ -21,20 +26,100 @@ import (
 type ModelResults struct {
 	ProbAttack float64                `json:"probattack"`
 	Data       map[string]interface{} `json:"data"`
+	// Categories optionally tags the result with per-category scores
+	// using the standard taxonomy
+	Categories map[AttackCategory]float64 `json:"categories,omitempty"`
+	// Uncertainty is the optional variance of ProbAttack estimated by
+	// the model, between 0 (certain) and 0.25 (guessing)
+	Uncertainty *float64 `json:"uncertainty,omitempty"`
+	// NeedParts optionally asks the connector for more parts of the
+	// transaction to analyze, by plugin type name (e.g. a headers model
+	// asking for the RequestBody)
+	NeedParts []string `json:"needparts,omitempty"`
+	// Shared optionally publishes intermediate features in the scratch
+	// space of the transaction, for models running in other processes
+	Shared map[string]interface{} `json:"shared,omitempty"`
+	// Hints optionally suggest reactions to the connector, given in the
+	// verdict of the transaction
+	Hints []Hint `json:"hints,omitempty"`
 }
 
 // ModelInput is the struct that contains the input data for the model plugin
 type ModelInput struct {
 	TransactionId string `json:"transactionId"`
 	Payload       string `json:"payload"`
+	// Signals are the client signals of the transaction, if any
+	Signals *bot.Signals `json:"signals,omitempty"`
+	// Geo is the location of the client address, if known
+	Geo *geoip.Location `json:"geo,omitempty"`
+	// Message is the structured form of the analyzed part, with the
+	// HTTP/2 pseudo-headers and the trailers apart, when the connector
+	// gave one
+	Message *httpmsg.Message `json:"message,omitempty"`
+	// Scratch holds the intermediate features published so far by the
+	// plugins analyzing the transaction
+	Scratch *Scratch `json:"scratch,omitempty"`
+	// Metadata holds the request metadata given by the connector, such
+	// as the client address and the method, keyed by the Meta constants
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
+// Keys of the request metadata given to the model plugins
+const (
+	MetaClientIP    = "client.ip"
+	MetaURI         = "request.uri"
+	MetaMethod      = "request.method"
+	MetaContentType = "request.content_type"
+)
+
 // DecisionInput is the struct that contains the input data for the decision plugin
 type DecisionInput struct {
 	TransactionId string
 	Results       map[string]ModelResults
 	ModelWeight   map[string]float64
 	WAFdata       map[string]string
+	// CategoryScores holds the weighted per-category scores of the models
+	CategoryScores map[AttackCategory]float64
+	// WAFCategoryScores holds the per-category CRS anomaly scores
+	WAFCategoryScores map[AttackCategory]float64
+	// Signals are the client signals of the transaction, if any
+	Signals *bot.Signals
+	// Geo is the location of the client address, if known
+	Geo *geoip.Location
+	// Scratch holds the intermediate features published by the models
+	Scratch *Scratch
+	// Missing lists the sync models still running when the check timed
+	// out. Their results are not in Results.
+	Missing []string
+	// Tenant, Profile, Tags and Metadata describe the transaction, as
+	// given in its TransactionContext
+	Tenant   string
+	Profile  string
+	Tags     []string
+	Metadata map[string]string
+	// WAFWeight, DecisionBalance and Threshold are the tuning of the
+	// decision plugin in its configuration: the weight of a point of
+	// the WAF inbound anomaly score, the share of the WAF score in the
+	// decision, from 0 (the models only) to 1 (the WAF only), and the
+	// score from which to block, zero if unset. BalancedScore applies
+	// the first two.
+	WAFWeight       float64
+	DecisionBalance float64
+	Threshold       float64
+}
+
+// TransactionContext describes the transaction to the decision plugins,
+// so they can apply context-sensitive policies
+type TransactionContext struct {
+	// Tenant and Profile are those given by the connector when it
+	// initialized the transaction
+	Tenant  string
+	Profile string
+	// Tags are the labels given by the connector to the transaction
+	Tags []string
+	// Metadata holds the transaction metadata, such as its fingerprint
+	// or the values set by the connector
+	Metadata map[string]string
 }
 
 // ModelTransmitionResults is the struct that contains the results of the model plugin
@@ -48,6 +133,8 @@ type ModelTransmitionResults struct {
 type modelPlugin struct {
 	p          *plugin.Plugin
 	pluginType cf.ModelPluginType
+	// transport is how the model is reached, TransportLocal if empty
+	transport string
 }
 
 // decisionPlugin is the struct that stores the decision plugin
@@ -61,201 +148,591 @@ type ModelStatus struct {
 	ModelID    string
 	ProbAttack float64
 	Err        error
+	// NeedParts are the parts of the transaction requested by the model
+	NeedParts []string
+	// Data is the Data of the results of the model
+	Data map[string]interface{}
+	// Start and End are when the model was called and when it
+	// returned, if it was called
+	Start time.Time
+	End   time.Time
+	// Transport is how the model was reached (TransportLocal,
+	// TransportNATS, TransportGRPC, TransportSubprocess or
+	// TransportHTTP), if it was called
+	Transport string
 }
 
+// Transports of the model plugins in ModelStatus
+const (
+	TransportLocal      = "local"
+	TransportNATS       = "nats"
+	TransportGRPC       = "grpc"
+	TransportSubprocess = "subprocess"
+	TransportHTTP       = "http"
+)
+
 // PluginManager is the main plugin struct storing information of
 // every plugin execution.
 type PluginManager struct {
-	modelPlugins        map[string]modelPlugin
-	modelProcessFunc    map[string]func(ModelInput) (ModelResults, error)
-	decisionCheckFunc   map[string]func(DecisionInput) (bool, error)
-	decisionPlugins     map[string]decisionPlugin
-	results             sync.Map
-	channelsMutex       sync.Mutex
-	syncModelsChannels  sync.Map
-	asyncModelsChannels sync.Map
-	natConn             *nats.Conn
+	modelPlugins      map[string]modelPlugin
+	modelProcessFunc  map[string]func(ModelInput) (ModelResults, error)
+	decisionCheckFunc map[string]func(DecisionInput) (DecisionResult, error)
+	decisionPlugins   map[string]decisionPlugin
+	grpcModels        map[string]*grpcModel
+	subprocessModels  map[string]*subprocessModel
+	transactions      sync.Map
+	natConn           *nats.Conn
+	instruments       *Instruments
+	loadReport        []PluginLoadEvent
+	signals           sync.Map
+	geo               sync.Map
+	messages          sync.Map
+	meta              sync.Map
+	scratch           sync.Map
+	queued            sync.Map
+	disabled          sync.Map
+	wafRequirements   map[string][]string
+	services          serviceChecks
+	health            healthChecks
+	results           sharedResults
+	retries           initRetries
+	warmup            warmups
+	pools             workerPools
+	// plugins guards the loaded plugins and the load report against the
+	// plugins promoted by the retries of their initialization
+	plugins  sync.RWMutex
+	shutdown sync.Once
+	conf     *cf.ConfigStore
+	// held are the shared object plugins loaded, guarded by
+	// sharedObjectsMutex
+	held map[*plugin.Plugin]bool
 }
 
 // New creates a new PluginManager instance.
 func New(meter metric.Meter) *PluginManager {
+	pm := newPluginManager(meter, nil)
+	instruments.Store(pm.instruments)
+	return pm
+}
+
+// NewWithConfig creates a PluginManager instance loading the plugins of
+// the given configuration instead of the one in use, with instruments
+// of its own. It lets several independent configurations run in the
+// same process.
+func NewWithConfig(meter metric.Meter, conf *cf.ConfigStore) *PluginManager {
+	return newPluginManager(meter, conf)
+}
+
+// newPluginManager loads the plugins of conf, or of the configuration
+// in use if nil
+func newPluginManager(meter metric.Meter, configStore *cf.ConfigStore) *PluginManager {
 	pm := new(PluginManager)
-	conf := cf.Get()
+	pm.instruments = NewInstruments(meter)
+	pm.conf = configStore
+	conf := pm.config()
+	pm.pools = newWorkerPools(conf.WorkerPools)
 	logger := lg.Get()
-	logger.Printf(lg.DEBUG, "Connecting to NATS server at %s", conf.NatsURL)
+	if conf.UsesNATS() {
+		logger.Printf(lg.DEBUG, "Connecting to NATS server at %s", conf.NatsURL)
 
-	nc, err := nats.Connect(conf.NatsURL)
+		nc, err := connectNATS(conf, "wace", pm.instruments)
 
-	if err != nil {
-		logger.Printf(lg.ERROR, "Failed to connect to NATS server")
+		if err != nil {
+			logger.Printf(lg.ERROR, "Failed to connect to NATS server")
+		}
+
+		pm.natConn = nc
+	} else {
+		logger.Printf(lg.DEBUG, "No plugin needs NATS, not connecting to it")
 	}
 
-	pm.natConn = nc
+	pm.openResultStore()
 
 	// Loading of model plugins
 	pm.modelPlugins = make(map[string]modelPlugin)
 	pm.modelProcessFunc = make(map[string]func(ModelInput) (ModelResults, error))
-	for _, data := range conf.ModelPlugins {
+	pm.grpcModels = make(map[string]*grpcModel)
+	pm.subprocessModels = make(map[string]*subprocessModel)
+	// the plugins are initialized after those they require
+	modelOrder, decisionOrder := conf.InitOrder()
+	for _, id := range modelOrder {
+		data := conf.ModelPlugins[id]
+		if req := pm.missingRequirement(data.Requires); req != "" {
+			pm.skipped(ModelPluginKind, data.ID, data.Path, "required plugin "+req+" not loaded")
+			continue
+		}
+		if data.Kind == cf.BuiltinPlugin {
+			factory, ok := builtinModel(data.Builtin, meter)
+			if !ok {
+				pm.skipped(ModelPluginKind, data.ID, "", "unknown builtin model "+data.Builtin)
+				continue
+			}
+			process, err := factory(data.Params)
+			if err != nil {
+				pm.skipped(ModelPluginKind, data.ID, "", err.Error())
+				continue
+			}
+			pm.modelProcessFunc[data.ID] = process
+			pm.modelPlugins[data.ID] = modelPlugin{pluginType: data.PluginType}
+			pm.recordLoad(PluginLoadEvent{ID: data.ID, Kind: ModelPluginKind, Status: PluginLoaded, Version: "builtin:" + data.Builtin})
+			logger.Printf(lg.INFO, "| %s | builtin %s model loaded", data.ID, data.Builtin)
+			continue
+		}
+		if data.Kind == cf.GRPCPlugin {
+			params, err := fetchArtifacts(data.ID, data.Params, data.Artifacts, data.ArtifactChecksums, conf.ArtifactCache)
+			if err != nil {
+				pm.skipped(ModelPluginKind, data.ID, data.Address, err.Error())
+				continue
+			}
+			promote := func(model *grpcModel) func() {
+				return func() {
+					pm.grpcModels[data.ID] = model
+					pm.modelProcessFunc[data.ID] = model.process
+					pm.modelPlugins[data.ID] = modelPlugin{pluginType: data.PluginType, transport: TransportGRPC}
+				}
+			}
+			model, err := dialGRPCModel(data.ID, data.Address, data.PluginType, params, data.Timeout)
+			if err != nil {
+				pm.retryInit(initRetry{kind: ModelPluginKind, id: data.ID, path: data.Address, version: "grpc", init: func() (func(), error) {
+					model, err := dialGRPCModel(data.ID, data.Address, data.PluginType, params, data.Timeout)
+					if err != nil {
+						return nil, err
+					}
+					return promote(model), nil
+				}}, err)
+				continue
+			}
+			promote(model)()
+			pm.recordLoad(PluginLoadEvent{ID: data.ID, Kind: ModelPluginKind, Status: PluginLoaded, Path: data.Address, Version: "grpc"})
+			logger.Printf(lg.INFO, "| %s | grpc model at %s loaded", data.ID, data.Address)
+			continue
+		}
+		if data.Kind == cf.HTTPPlugin {
+			pm.modelProcessFunc[data.ID] = newHTTPModel(data.URL, data.Headers, data.Timeout)
+			pm.modelPlugins[data.ID] = modelPlugin{pluginType: data.PluginType, transport: TransportHTTP}
+			pm.recordLoad(PluginLoadEvent{ID: data.ID, Kind: ModelPluginKind, Status: PluginLoaded, Path: data.URL, Version: "http"})
+			logger.Printf(lg.INFO, "| %s | http model at %s loaded", data.ID, data.URL)
+			continue
+		}
+		if data.Kind == cf.WorkerPlugin {
+			if pm.natConn == nil {
+				pm.skipped(ModelPluginKind, data.ID, ModelSubject(data.ID), "not connected to NATS")
+				continue
+			}
+			pm.modelPlugins[data.ID] = modelPlugin{pluginType: data.PluginType, transport: TransportNATS}
+			pm.recordLoad(PluginLoadEvent{ID: data.ID, Kind: ModelPluginKind, Status: PluginLoaded, Path: ModelSubject(data.ID), Version: "worker"})
+			if !data.RequestReply {
+				go pm.ModelResultsHandler(data.ID)
+			}
+			logger.Printf(lg.INFO, "| %s | worker model on subject %s loaded", data.ID, ModelSubject(data.ID))
+			continue
+		}
+		if data.Kind == cf.ONNXPlugin {
+			params, err := fetchArtifacts(data.ID, data.Params, data.Artifacts, data.ArtifactChecksums, conf.ArtifactCache)
+			if err != nil {
+				pm.skipped(ModelPluginKind, data.ID, data.Path, err.Error())
+				continue
+			}
+			process, err := newONNXModel(data.Path, params)
+			if err != nil {
+				pm.skipped(ModelPluginKind, data.ID, data.Path, err.Error())
+				continue
+			}
+			pm.modelProcessFunc[data.ID] = process
+			pm.modelPlugins[data.ID] = modelPlugin{pluginType: data.PluginType}
+			pm.recordLoad(PluginLoadEvent{ID: data.ID, Kind: ModelPluginKind, Status: PluginLoaded, Path: data.Path, Version: "onnx"})
+			logger.Printf(lg.INFO, "| %s | onnx model %s loaded", data.ID, data.Path)
+			continue
+		}
+		if data.Kind == cf.ScriptPlugin {
+			params, err := fetchArtifacts(data.ID, data.Params, data.Artifacts, data.ArtifactChecksums, conf.ArtifactCache)
+			if err != nil {
+				pm.skipped(ModelPluginKind, data.ID, data.Path, err.Error())
+				continue
+			}
+			process, err := newScriptModel(data.ID, data.Path, params, data.MaxSteps, data.Timeout)
+			if err != nil {
+				pm.skipped(ModelPluginKind, data.ID, data.Path, err.Error())
+				continue
+			}
+			pm.modelProcessFunc[data.ID] = process
+			pm.modelPlugins[data.ID] = modelPlugin{pluginType: data.PluginType}
+			pm.recordLoad(PluginLoadEvent{ID: data.ID, Kind: ModelPluginKind, Status: PluginLoaded, Path: data.Path, Version: "script"})
+			logger.Printf(lg.INFO, "| %s | script model %s loaded", data.ID, data.Path)
+			continue
+		}
+		if data.Kind == cf.SubprocessPlugin {
+			params, err := fetchArtifacts(data.ID, data.Params, data.Artifacts, data.ArtifactChecksums, conf.ArtifactCache)
+			if err != nil {
+				pm.skipped(ModelPluginKind, data.ID, data.Path, err.Error())
+				continue
+			}
+			model, err := startSubprocessModel(data.ID, data.Path, data.PluginType, params, data.Timeout)
+			if err != nil {
+				pm.skipped(ModelPluginKind, data.ID, data.Path, err.Error())
+				continue
+			}
+			pm.subprocessModels[data.ID] = model
+			pm.modelProcessFunc[data.ID] = model.process
+			pm.modelPlugins[data.ID] = modelPlugin{pluginType: data.PluginType, transport: TransportSubprocess}
+			pm.recordLoad(PluginLoadEvent{ID: data.ID, Kind: ModelPluginKind, Status: PluginLoaded, Path: data.Path, Version: "subprocess"})
+			logger.Printf(lg.INFO, "| %s | subprocess model %s started", data.ID, data.Path)
+			continue
+		}
 		tp, err := plugin.Open(data.Path)
 		if err != nil {
-			logger.Printf(lg.WARN, "| %s | cannot load plugin: %v", data.ID, err)
+			pm.skipped(ModelPluginKind, data.ID, data.Path, err.Error())
+			continue
+		}
+		if _, err := pluginAPIVersion(tp.Lookup); err != nil {
+			pm.skipped(ModelPluginKind, data.ID, data.Path, err.Error())
+			continue
+		}
+		params, err := fetchArtifacts(data.ID, data.Params, data.Artifacts, data.ArtifactChecksums, conf.ArtifactCache)
+		if err != nil {
+			pm.skipped(ModelPluginKind, data.ID, data.Path, err.Error())
 			continue
 		}
 		if data.Mode == "async" || conf.ModelPlugins[data.ID].Remote {
+			if pm.natConn == nil {
+				pm.skipped(ModelPluginKind, data.ID, data.Path, "not connected to NATS")
+				continue
+			}
 			f, err := tp.Lookup("InitPluginAsync")
 			if err != nil {
-				logger.Printf(lg.WARN, "| %s | cannot load plugin: %v", data.ID, err)
+				pm.skipped(ModelPluginKind, data.ID, data.Path, err.Error())
 				continue
 			}
 			initPlugin, ok := f.(func(map[string]string, metric.Meter, func(func(ModelInput) (ModelResults, error))) error)
 			if !ok {
-				logger.Printf(lg.WARN, "| %s | cannot load plugin: invalid InitPluginAsync function type", data.ID)
+				pm.skipped(ModelPluginKind, data.ID, data.Path, "invalid InitPluginAsync function type")
 				continue
 			}
-			err = initPlugin(data.Params, meter, func(modelProcess func(ModelInput) (ModelResults, error)) {
-				ModelProcessHandler(data.ID, modelProcess)
-			})
-			if err != nil {
-				logger.Printf(lg.WARN, "| %s | cannot load plugin: %v", data.ID, err)
+			initAsync := func() (func(), error) {
+				err := pm.safeCall(ModelPluginKind, data.ID, "InitPluginAsync", func() error {
+					return initPlugin(params, meter, func(modelProcess func(ModelInput) (ModelResults, error)) {
+						modelProcessHandler(conf, data.ID, pm.guardProcess(data.ID, modelProcess))
+					})
+				})
+				if err != nil {
+					return nil, err
+				}
+				if !data.RequestReply {
+					go pm.ModelResultsHandler(data.ID)
+				}
+				return func() { pm.modelPlugins[data.ID] = modelPlugin{p: tp, pluginType: data.PluginType} }, nil
+			}
+			if _, err := initAsync(); err != nil {
+				pm.retryInit(initRetry{kind: ModelPluginKind, id: data.ID, path: data.Path, tp: tp, init: initAsync}, err)
 				continue
 			}
-			go pm.ModelResultsHandler(data.ID)
 		} else {
 			f, err := tp.Lookup("InitPlugin")
 			if err != nil {
-				logger.Printf(lg.WARN, "| %s | cannot load plugin: %v", data.ID, err)
+				pm.skipped(ModelPluginKind, data.ID, data.Path, err.Error())
 				continue
 			}
 			initPlugin, ok := f.(func(map[string]string, metric.Meter) error)
 			if !ok {
-				logger.Printf(lg.WARN, "| %s | cannot load plugin: invalid InitPlugin function type", data.ID)
+				pm.skipped(ModelPluginKind, data.ID, data.Path, "invalid InitPlugin function type")
 				continue
 			}
-			err = initPlugin(data.Params, meter)
 			procFunc, err := tp.Lookup("Process")
 			if err != nil {
-				logger.Printf(lg.WARN, "| %s | cannot load plugin: cannot load Process function", data.ID)
+				pm.skipped(ModelPluginKind, data.ID, data.Path, "cannot load Process function")
 				continue
 			}
 			process, ok := procFunc.(func(ModelInput) (ModelResults, error))
 			if !ok {
-				logger.Printf(lg.WARN, "| %s | cannot load plugin: invalid Process function type", data.ID)
+				pm.skipped(ModelPluginKind, data.ID, data.Path, "invalid Process function type")
+				continue
+			}
+			init := func() error { return initPlugin(params, meter) }
+			if err := pm.safeCall(ModelPluginKind, data.ID, "InitPlugin", init); err != nil {
+				pm.retryInit(initRetry{kind: ModelPluginKind, id: data.ID, path: data.Path, tp: tp, init: func() (func(), error) {
+					if err := pm.safeCall(ModelPluginKind, data.ID, "InitPlugin", init); err != nil {
+						return nil, err
+					}
+					return func() {
+						pm.modelProcessFunc[data.ID] = process
+						pm.modelPlugins[data.ID] = modelPlugin{p: tp, pluginType: data.PluginType}
+					}, nil
+				}}, err)
 				continue
 			}
 			pm.modelProcessFunc[data.ID] = process
 		}
-		modelPluginLoaded := modelPlugin{tp, data.PluginType}
+		modelPluginLoaded := modelPlugin{p: tp, pluginType: data.PluginType}
 		pm.modelPlugins[data.ID] = modelPluginLoaded
+		pm.loaded(ModelPluginKind, data.ID, data.Path, tp)
 		logger.Printf(lg.INFO, "| %s | plugin loaded", data.ID)
 	}
 
 	pm.decisionPlugins = make(map[string]decisionPlugin)
-	pm.decisionCheckFunc = make(map[string]func(DecisionInput) (bool, error))
+	pm.decisionCheckFunc = make(map[string]func(DecisionInput) (DecisionResult, error))
+	pm.wafRequirements = make(map[string][]string)
 	// Loading of decision plugins
-	for _, data := range conf.DecisionPlugins {
+	for _, id := range decisionOrder {
+		data := conf.DecisionPlugins[id]
+		if req := pm.missingRequirement(data.Requires); req != "" {
+			pm.skipped(DecisionPluginKind, data.ID, data.Path, "required plugin "+req+" not loaded")
+			continue
+		}
+		if data.Kind == cf.BuiltinPlugin {
+			factory, ok := builtinDecision(data.Builtin, meter)
+			if !ok {
+				pm.skipped(DecisionPluginKind, data.ID, "", "unknown builtin decision "+data.Builtin)
+				continue
+			}
+			checkResults, err := factory(data.Params, data.Categories)
+			if err != nil {
+				pm.skipped(DecisionPluginKind, data.ID, "", err.Error())
+				continue
+			}
+			pm.decisionCheckFunc[data.ID] = checkResults
+			pm.decisionPlugins[data.ID] = decisionPlugin{}
+			pm.wafRequirements[data.ID] = wafRequirements(data.WAFRequirements, nil)
+			pm.recordLoad(PluginLoadEvent{ID: data.ID, Kind: DecisionPluginKind, Status: PluginLoaded, Version: "builtin:" + data.Builtin})
+			logger.Printf(lg.INFO, "| %s | builtin %s decision loaded", data.ID, data.Builtin)
+			continue
+		}
+		if data.Kind == cf.ScriptPlugin {
+			checkResults, err := newScriptDecision(data.ID, data.Path, data.Params, data.MaxSteps, data.Timeout)
+			if err != nil {
+				pm.skipped(DecisionPluginKind, data.ID, data.Path, err.Error())
+				continue
+			}
+			pm.decisionCheckFunc[data.ID] = checkResults
+			pm.decisionPlugins[data.ID] = decisionPlugin{}
+			pm.wafRequirements[data.ID] = wafRequirements(data.WAFRequirements, nil)
+			pm.recordLoad(PluginLoadEvent{ID: data.ID, Kind: DecisionPluginKind, Status: PluginLoaded, Path: data.Path, Version: "script"})
+			logger.Printf(lg.INFO, "| %s | script decision %s loaded", data.ID, data.Path)
+			continue
+		}
 		tp, err := plugin.Open(data.Path)
 		if err != nil {
-			logger.Printf(lg.WARN, "| %s | cannot load plugin: %v", data.ID, err)
+			pm.skipped(DecisionPluginKind, data.ID, data.Path, err.Error())
+			continue
+		}
+		apiVersion, err := pluginAPIVersion(tp.Lookup)
+		if err != nil {
+			pm.skipped(DecisionPluginKind, data.ID, data.Path, err.Error())
 			continue
 		}
 		f, err := tp.Lookup("InitPlugin")
 		if err != nil {
-			logger.Printf(lg.WARN, "| %s | cannot load plugin: %v", data.ID, err)
+			pm.skipped(DecisionPluginKind, data.ID, data.Path, err.Error())
 			continue
 		}
 		initPlugin, ok := f.(func(map[string]string, metric.Meter) error)
 		if !ok {
-			logger.Printf(lg.WARN, "| %s | cannot load plugin: invalid InitPlugin function type", data.ID)
+			pm.skipped(DecisionPluginKind, data.ID, data.Path, "invalid InitPlugin function type")
 			continue
 		}
-		err = initPlugin(data.Params, meter)
+		cR, err := tp.Lookup("CheckResults")
 		if err != nil {
-			logger.Printf(lg.WARN, "| %s | cannot load plugin: %v", data.ID, err)
+			pm.skipped(DecisionPluginKind, data.ID, data.Path, "cannot load CheckResults function: "+err.Error())
 			continue
 		}
-		cR, err := tp.Lookup("CheckResults")
+		checkResults, err := decisionCheckResults(apiVersion, cR)
 		if err != nil {
-			logger.Printf(lg.ERROR, "| %s | cannot load plugin check results function: %v", data.ID, err)
+			pm.skipped(DecisionPluginKind, data.ID, data.Path, err.Error())
 			continue
 		}
-		checkResults, ok := cR.(func(DecisionInput) (bool, error))
-		if !ok {
-			logger.Printf(lg.ERROR, "| %s | CheckResults lookup failed for plugin: invalid function type", data.ID)
+		promote := func() {
+			pm.decisionCheckFunc[data.ID] = checkResults
+			pm.decisionPlugins[data.ID] = decisionPlugin{tp}
+			pm.wafRequirements[data.ID] = wafRequirements(data.WAFRequirements, tp)
+		}
+		init := func() error { return initPlugin(data.Params, meter) }
+		if err := pm.safeCall(DecisionPluginKind, data.ID, "InitPlugin", init); err != nil {
+			pm.retryInit(initRetry{kind: DecisionPluginKind, id: data.ID, path: data.Path, tp: tp, init: func() (func(), error) {
+				return promote, pm.safeCall(DecisionPluginKind, data.ID, "InitPlugin", init)
+			}}, err)
 			continue
 		}
-		pm.decisionCheckFunc[data.ID] = checkResults
-		decisionPluginLoaded := decisionPlugin{tp}
-		pm.decisionPlugins[data.ID] = decisionPluginLoaded
+		promote()
+		pm.loaded(DecisionPluginKind, data.ID, data.Path, tp)
 	}
+	pm.startWarmups()
+	pm.checkServices()
+	pm.startHealthChecks(conf.HealthCheckInterval)
+	pm.startInitRetries()
 	return pm
 }
 
+// missingRequirement returns the first of the required plugins that is
+// not loaded, or "" if all are
+func (p *PluginManager) missingRequirement(requires []string) string {
+	for _, req := range requires {
+		_, model := p.modelPlugins[req]
+		_, decision := p.decisionCheckFunc[req]
+		if !model && !decision {
+			return req
+		}
+	}
+	return ""
+}
+
+// config returns the configuration of the plugin manager
+func (p *PluginManager) config() *cf.ConfigStore {
+	if p.conf != nil {
+		return p.conf
+	}
+	return cf.Snapshot()
+}
+
+// Instruments returns the metric instrument registry shared with the
+// plugins
+func (p *PluginManager) Instruments() *Instruments {
+	return p.instruments
+}
+
+// ModelPluginIDs returns the sorted IDs of the loaded model plugins
+func (p *PluginManager) ModelPluginIDs() []string {
+	p.plugins.RLock()
+	defer p.plugins.RUnlock()
+	ids := make([]string, 0, len(p.modelPlugins))
+	for id := range p.modelPlugins {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// DecisionPluginIDs returns the sorted IDs of the loaded decision plugins
+func (p *PluginManager) DecisionPluginIDs() []string {
+	p.plugins.RLock()
+	defer p.plugins.RUnlock()
+	ids := make([]string, 0, len(p.decisionCheckFunc))
+	for id := range p.decisionCheckFunc {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
 // InitTransaction initializes the transaction with the given ID
 func (p *PluginManager) InitTransaction(transactionId string) {
-	p.results.Store(transactionId, new(sync.Map))
+	p.transactions.Store(transactionId, newTransactionState(transactionId))
 }
 
 // CloseTransaction closes the transaction with the given ID
 // removing all sync model data
 func (p *PluginManager) CloseTransaction(transactionId string) {
 	logger := lg.Get()
-	transactionMap, ok := p.syncModelsChannels.Load(transactionId)
+	// the channels are not closed: the models still running on the
+	// transaction may report to them
+	value, ok := p.transactions.LoadAndDelete(transactionId)
 	if !ok {
 		logger.TPrintf(lg.ERROR, transactionId, "Transaction %s not found", transactionId)
 	} else {
-		transactionMap.(*sync.Map).Range(func(key, value interface{}) bool {
-			ch := value.(chan ModelStatus)
-            close(ch)
-            for range ch {}
-			transactionMap.(*sync.Map).Delete(key)
-			return true
-		})
-		p.syncModelsChannels.Delete(transactionId)
-		resultsMap, ok := p.results.Load(transactionId)
-		if !ok {
-			logger.TPrintf(lg.ERROR, transactionId, "Results for transaction %s not found", transactionId)
-		} else {
-			resultsMap.(*sync.Map).Range(func(key, value interface{}) bool {
-				resultsMap.(*sync.Map).Delete(key)
-				return true
-			})
-		}
-		p.results.Delete(transactionId)
+		value.(*transactionState).release()
+	}
+	p.signals.Delete(transactionId)
+	p.geo.Delete(transactionId)
+	p.messages.Delete(transactionId)
+	p.meta.Delete(transactionId)
+	p.scratch.Delete(transactionId)
+	p.queued.Delete(transactionId)
+}
+
+// SetTransactionSignals sets the client signals given to the plugins
+// for the transaction with the given ID
+func (p *PluginManager) SetTransactionSignals(transactionId string, signals bot.Signals) {
+	p.signals.Store(transactionId, &signals)
+}
+
+// transactionSignals returns the client signals of the transaction, or
+// nil if none were set
+func (p *PluginManager) transactionSignals(transactionId string) *bot.Signals {
+	value, ok := p.signals.Load(transactionId)
+	if !ok {
+		return nil
 	}
+	signals := *value.(*bot.Signals)
+	return &signals
+}
+
+// SetTransactionGeo sets the location of the client address given to
+// the plugins for the transaction with the given ID
+func (p *PluginManager) SetTransactionGeo(transactionId string, loc geoip.Location) {
+	p.geo.Store(transactionId, &loc)
+}
+
+// transactionGeo returns the location of the client address of the
+// transaction, or nil if none was set
+func (p *PluginManager) transactionGeo(transactionId string) *geoip.Location {
+	value, ok := p.geo.Load(transactionId)
+	if !ok {
+		return nil
+	}
+	loc := *value.(*geoip.Location)
+	return &loc
+}
+
+// SetTransactionMessage sets the structured message given to the
+// plugins analyzing the part of type t of the transaction
+func (p *PluginManager) SetTransactionMessage(transactionId string, t cf.ModelPluginType, msg httpmsg.Message) {
+	value, _ := p.messages.LoadOrStore(transactionId, &sync.Map{})
+	value.(*sync.Map).Store(t, &msg)
+}
+
+// transactionMessage returns the structured message of the part of
+// type t of the transaction, or nil if none was set
+func (p *PluginManager) transactionMessage(transactionId string, t cf.ModelPluginType) *httpmsg.Message {
+	value, ok := p.messages.Load(transactionId)
+	if !ok {
+		return nil
+	}
+	msg, ok := value.(*sync.Map).Load(t)
+	if !ok {
+		return nil
+	}
+	return msg.(*httpmsg.Message)
+}
+
+// SetTransactionMeta adds the request metadata given to the plugins
+// for the transaction with the given ID to the metadata set before
+func (p *PluginManager) SetTransactionMeta(transactionId string, meta map[string]string) {
+	value, _ := p.meta.LoadOrStore(transactionId, &sync.Map{})
+	for key, v := range meta {
+		value.(*sync.Map).Store(key, v)
+	}
+}
+
+// TransactionMeta returns a copy of the request metadata of the
+// transaction, or nil if none was set
+func (p *PluginManager) TransactionMeta(transactionId string) map[string]string {
+	value, ok := p.meta.Load(transactionId)
+	if !ok {
+		return nil
+	}
+	meta := make(map[string]string)
+	value.(*sync.Map).Range(func(key, v interface{}) bool {
+		meta[key.(string)] = v.(string)
+		return true
+	})
+	return meta
 }
 
 // AddModelChannel adds a channel to result channel map
 func (p *PluginManager) AddModelChannel(transactionId string, t cf.ModelPluginType, modelPlugStatus chan ModelStatus, modelType string) {
-	typeModel := new(sync.Map)
-	var value interface{}
-	if modelType == "sync" {
-		value, _ = p.syncModelsChannels.LoadOrStore(transactionId, typeModel)
-	} else {
-		value, _ = p.asyncModelsChannels.LoadOrStore(transactionId, typeModel)
+	s, ok := p.transaction(transactionId)
+	if !ok || !s.setChannel(transactionId, t.String(), modelType, modelPlugStatus) {
+		logger := lg.Get()
+		logger.TPrintf(lg.ERROR, transactionId, "Transaction %s not found when trying to add model channel", transactionId)
 	}
-	value.(*sync.Map).Store(t.String(), modelPlugStatus)
 }
 
 // RemoveModelChannel removes a channel from the result channel map
 func (p *PluginManager) RemoveAsyncModelChannel(transactionId string, t cf.ModelPluginType) {
-	typeModel, ok := p.asyncModelsChannels.Load(transactionId)
+	s, ok := p.transaction(transactionId)
 	if ok {
-		channelMap := typeModel.(*sync.Map)
-        ch, channelOk := channelMap.Load(t.String())
-
-        if channelOk {
-			close(ch.(chan ModelStatus))
-			for range ch.(chan ModelStatus) {}
-            channelMap.Delete(t.String())
-        }
-
-		remainChannels := 0
-		typeModel.(*sync.Map).Range(func(key, value interface{}) bool {
-			remainChannels++
-			return true
-		})
-		if remainChannels == 0 {
-			p.asyncModelsChannels.Delete(transactionId)
+		if ch, channelOk := s.removeChannel(transactionId, t.String(), "async"); channelOk {
+			close(ch)
+			for range ch {
+			}
 		}
 	} else {
 		logger := lg.Get()
@@ -263,27 +740,61 @@ func (p *PluginManager) RemoveAsyncModelChannel(transactionId string, t cf.Model
 	}
 }
 
-// AddToQueue adds a payload to the model queue
-func (p *PluginManager) AddToQueue(modelId, transactionId, payload string) error {
-	payloadToSend := &ModelInput{
-		TransactionId: transactionId,
-		Payload:       payload,
+// Publish sends data to the given NATS subject
+func (p *PluginManager) Publish(subject string, data []byte) error {
+	if p.natConn == nil {
+		return fmt.Errorf("not connected to NATS")
 	}
+	return p.natConn.Publish(subject, data)
+}
 
-	jsonPayload, err := json.Marshal(payloadToSend)
+// AddToQueue adds a payload to the model queue. The models configured
+// with request reply are sent a request instead, and AddToQueue returns
+// once their reply is handled. The payload of a model with retries is
+// queued again when it does not answer within its timeout.
+func (p *PluginManager) AddToQueue(modelId, transactionId, payload string) error {
+	if p.natConn == nil {
+		return fmt.Errorf("model %s not queued, not connected to NATS", modelId)
+	}
+	if p.config().ModelPlugins[modelId].RequestReply {
+		return p.request(modelId, transactionId, payload)
+	}
 
+	jsonPayload, err := p.remoteInput(modelId, transactionId, payload)
 	if err != nil {
 		return err
 	}
 
-	return p.natConn.Publish(modelId, jsonPayload)
+	queued, _ := p.queued.LoadOrStore(transactionId, new(sync.Map))
+	queued.(*sync.Map).Store(modelId, time.Now())
+	if err := p.natConn.PublishMsg(NewWorkerMsg(ModelSubject(modelId), jsonPayload)); err != nil {
+		return err
+	}
+	p.resendUnanswered(modelId, transactionId, jsonPayload, 1)
+	return nil
+}
+
+// remoteInput returns the JSON encoding of the input of the remote model
+func (p *PluginManager) remoteInput(modelId, transactionId, payload string) ([]byte, error) {
+	return json.Marshal(&ModelInput{
+		TransactionId: transactionId,
+		Payload:       payload,
+		Signals:       p.transactionSignals(transactionId),
+		Geo:           p.transactionGeo(transactionId),
+		Message:       p.transactionMessage(transactionId, p.config().ModelPlugins[modelId].PluginType),
+		Scratch:       p.TransactionScratch(transactionId),
+		Metadata:      p.TransactionMeta(transactionId),
+	})
 }
 
 // Process is in charge of calling the model plugin with id modelID
 func (p *PluginManager) Process(modelID, transactionId, payload string, t cf.ModelPluginType, modelPlugStatus chan ModelStatus) {
-	conf := cf.Get()
+	conf := p.config()
 
+	p.plugins.RLock()
 	mp, exists := p.modelPlugins[modelID]
+	process := p.modelProcessFunc[modelID]
+	p.plugins.RUnlock()
 	if !exists {
 		modelPlugStatus <- ModelStatus{ModelID: modelID, Err: fmt.Errorf("model plugin not found")}
 		return
@@ -296,106 +807,224 @@ func (p *PluginManager) Process(modelID, transactionId, payload string, t cf.Mod
 		return
 	}
 
-	process := p.modelProcessFunc[modelID]
+	transport := mp.transport
+	if transport == "" {
+		transport = TransportLocal
+	}
 
 	if conf.ModelPlugins[modelID].Mode == "async" {
 		modelPlugStatus <- ModelStatus{ModelID: modelID, Err: fmt.Errorf("model plugin is async")}
 		return
 	} else {
-		res, err := process(ModelInput{TransactionId: transactionId, Payload: payload})
+		release := p.pools.acquire(conf.ModelPlugins[modelID].Affinity)
+		start := time.Now()
+		res, err := p.processWithRetries(modelID, p.guardProcess(modelID, process), ModelInput{
+			TransactionId: transactionId,
+			Payload:       payload,
+			Signals:       p.transactionSignals(transactionId),
+			Geo:           p.transactionGeo(transactionId),
+			Message:       p.transactionMessage(transactionId, t),
+			Scratch:       p.TransactionScratch(transactionId),
+			Metadata:      p.TransactionMeta(transactionId),
+		})
 		// res, err := process(transactionId, payload)
+		end := time.Now()
+		release()
 
+		if err == nil {
+			res, err = p.limitResultData(transactionId, modelID, res)
+		}
 		if err != nil {
-			modelPlugStatus <- ModelStatus{ModelID: modelID, Err: err}
+			modelPlugStatus <- ModelStatus{ModelID: modelID, Err: err, Start: start, End: end, Transport: transport}
 			return
 		}
 		// store the results
-		resultSyncMap, ok := p.results.Load(transactionId)
-		if !ok {
-			modelPlugStatus <- ModelStatus{ModelID: modelID, Err: fmt.Errorf("transaction results not found")}
+		s, ok := p.transaction(transactionId)
+		if !ok || !s.setResults(transactionId, modelID, res) {
+			modelPlugStatus <- ModelStatus{ModelID: modelID, Err: fmt.Errorf("transaction results not found"), Start: start, End: end, Transport: transport}
 			return
 		}
-		resultSyncMap.(*sync.Map).Store(modelID, res)
-		modelPlugStatus <- ModelStatus{ModelID: modelID, ProbAttack: res.ProbAttack, Err: nil}
+		p.shareResults(transactionId, modelID, res)
+		p.TransactionScratch(transactionId).merge(res.Shared)
+		modelPlugStatus <- ModelStatus{ModelID: modelID, ProbAttack: res.ProbAttack, Err: nil, NeedParts: res.NeedParts,
+			Data: res.Data, Start: start, End: end, Transport: transport}
 	}
 }
 
+// TransactionResults returns a copy of the model results stored so far
+// for the transaction with the given ID, including those shared by the
+// other instances through the result store
+func (p *PluginManager) TransactionResults(transactionId string) (map[string]ModelResults, error) {
+	s, ok := p.transaction(transactionId)
+	if !ok {
+		return nil, fmt.Errorf("transaction results not found")
+	}
+	modelResultMap, ok := s.copyResults(transactionId)
+	if !ok {
+		return nil, fmt.Errorf("transaction results not found")
+	}
+	p.addSharedResults(transactionId, modelResultMap)
+	return modelResultMap, nil
+}
+
 // CheckResult is in charge of calling the decision plugin with id decisionID over the
 // transaction with id transactID
 func (p *PluginManager) CheckResult(transactionId, decisionId string, wafParams map[string]string) (bool, error) {
+	res, err := p.CheckResultDetailed(transactionId, decisionId, wafParams)
+	return res.Block, err
+}
+
+// CheckResultDetailed is like CheckResult, but returns the whole outcome
+// of the decision plugin
+func (p *PluginManager) CheckResultDetailed(transactionId, decisionId string, wafParams map[string]string) (DecisionResult, error) {
+	return p.CheckResultWithMissing(transactionId, decisionId, wafParams, nil)
+}
+
+// CheckResultWithMissing is like CheckResultDetailed, for a check that
+// timed out before the missing models finished. They are given to the
+// decision plugin in DecisionInput.Missing.
+func (p *PluginManager) CheckResultWithMissing(transactionId, decisionId string, wafParams map[string]string, missing []string) (DecisionResult, error) {
+	return p.CheckResultWithContext(transactionId, decisionId, wafParams, missing, TransactionContext{})
+}
+
+// CheckResultWithContext is like CheckResultWithMissing, and also gives
+// the context of the transaction to the decision plugin
+func (p *PluginManager) CheckResultWithContext(transactionId, decisionId string, wafParams map[string]string, missing []string, tc TransactionContext) (DecisionResult, error) {
 	logger := lg.Get()
 
+	p.plugins.RLock()
 	checkResults, ok := p.decisionCheckFunc[decisionId]
+	p.plugins.RUnlock()
 	if !ok {
-		return false, fmt.Errorf("decision plugin not found")
+		return DecisionResult{}, fmt.Errorf("decision plugin not found")
 	}
 
-	transactionResults, ok := p.results.Load(transactionId)
-	if !ok {
-		return false, fmt.Errorf("transaction results not found")
+	if missing := missingWAFParams(p.WAFRequirements(decisionId), wafParams); len(missing) > 0 {
+		return DecisionResult{}, &MissingWAFParamsError{DecisionPlugin: decisionId, Missing: missing}
 	}
 
-	configStore := cf.Get()
+	modelResultMap, err := p.TransactionResults(transactionId)
+	if err != nil {
+		return DecisionResult{}, err
+	}
 
-	modelResultMap := make(map[string]ModelResults)
-	modelWeightMap := make(map[string]float64)
-	transactionResults.(*sync.Map).Range(func(key, value interface{}) bool {
-		modelResultMap[key.(string)] = value.(ModelResults)
-		modelWeightMap[key.(string)] = configStore.ModelPlugins[key.(string)].Weight
-		return true
-	})
+	configStore := p.config()
+
+	now := time.Now()
+	modelWeightMap := make(map[string]float64, len(modelResultMap))
+	for modelId := range modelResultMap {
+		modelWeightMap[modelId] = configStore.ModelWeight(modelId, now)
+	}
 
-	res, err := checkResults(DecisionInput{TransactionId: transactionId, Results: modelResultMap, ModelWeight: modelWeightMap, WAFdata: wafParams})
-	logger.TPrintf(lg.INFO, transactionId, "%s | transaction checked. Block: %t ", decisionId, res)
+	decisionConfig := configStore.DecisionPlugins[decisionId]
+	res, err := p.decide(decisionId, checkResults, DecisionInput{
+		TransactionId:     transactionId,
+		Results:           modelResultMap,
+		ModelWeight:       modelWeightMap,
+		WAFdata:           wafParams,
+		CategoryScores:    AggregateCategories(modelResultMap, modelWeightMap),
+		WAFCategoryScores: WAFCategories(wafParams),
+		Signals:           p.transactionSignals(transactionId),
+		Geo:               p.transactionGeo(transactionId),
+		Scratch:           p.TransactionScratch(transactionId),
+		Missing:           missing,
+		Tenant:            tc.Tenant,
+		Profile:           tc.Profile,
+		Tags:              tc.Tags,
+		Metadata:          tc.Metadata,
+		WAFWeight:         decisionConfig.WAFweight,
+		DecisionBalance:   decisionConfig.DecisionBalance,
+		Threshold:         decisionConfig.Threshold,
+	})
+	logger.TPrintf(lg.INFO, transactionId, "%s | transaction checked. Block: %t ", decisionId, res.Block)
 
 	return res, err
 }
 
-// ModelResultsHandler listens for messages on the model results queue
-func (p *PluginManager) ModelResultsHandler(modelId string) {
+// queuedTime returns when the part of the transaction was queued for
+// the remote model, and forgets it
+func (p *PluginManager) queuedTime(transactionId, modelId string) time.Time {
+	queued, ok := p.queued.Load(transactionId)
+	if !ok {
+		return time.Time{}
+	}
+	value, ok := queued.(*sync.Map).LoadAndDelete(modelId)
+	if !ok {
+		return time.Time{}
+	}
+	return value.(time.Time)
+}
+
+// receiveModelResults handles a message of the results queue of the
+// model, storing its results and reporting its status to the core
+func (p *PluginManager) receiveModelResults(modelId string, msg *nats.Msg) {
 	logger := lg.Get()
-	conf := cf.Get()
+	conf := p.config()
 
-	sub, err := p.natConn.Subscribe(modelId+"/results", func(msg *nats.Msg) {
-		go func(msg nats.Msg) {
-			data := &ModelTransmitionResults{}
-			err := json.Unmarshal(msg.Data, data)
-			if err != nil {
-				logger.Printf(lg.ERROR, "Model: %s | Failed to parse JSON payload", modelId)
+	data := &ModelTransmitionResults{}
+	err := json.Unmarshal(msg.Data, data)
+	if err == nil && data.Error == nil {
+		data.Error = CheckWorkerProtocol(msg)
+	}
+	var start time.Time
+	if err == nil {
+		start = p.queuedTime(data.TransactionId, modelId)
+	}
+	if err != nil {
+		logger.Printf(lg.ERROR, "Model: %s | Failed to parse JSON payload", modelId)
+	} else if start.IsZero() && conf.ModelPlugins[modelId].Retries > 0 {
+		// the answer to a retried input the model already answered
+		logger.TPrintf(lg.DEBUG, data.TransactionId, "%s | ignoring a duplicate answer", modelId)
+	} else {
+		modelType := "sync"
+		if conf.ModelPlugins[modelId].Mode == "async" {
+			modelType = "async"
+		}
+		s, ok := p.transaction(data.TransactionId)
+		if !ok {
+			logger.TPrintf(lg.ERROR, data.TransactionId, " Model %s | Transaction not found", modelId)
+		} else {
+			modelChannel, ok := s.channel(data.TransactionId, conf.ModelPlugins[modelId].PluginType.String(), modelType)
+			if !ok {
+				logger.Printf(lg.ERROR, "Model %s not found", modelId)
 			} else {
-				var channel interface{}
-				var ok bool
-				if conf.ModelPlugins[modelId].Mode == "async" {
-					channel, ok = p.asyncModelsChannels.Load(data.TransactionId)
-				} else {
-					channel, ok = p.syncModelsChannels.Load(data.TransactionId)
+				end := time.Now()
+				if data.Error == nil {
+					data.ModelResults, data.Error = p.limitResultData(data.TransactionId, modelId, data.ModelResults)
 				}
-				if !ok {
-					logger.TPrintf(lg.ERROR, data.TransactionId, " Model %s | Transaction not found", modelId)
+				if data.Error != nil {
+					modelChannel <- ModelStatus{ModelID: modelId, Err: data.Error, Start: start, End: end, Transport: TransportNATS}
 				} else {
-					modelChannel, ok := channel.(*sync.Map).Load(conf.ModelPlugins[modelId].PluginType.String())
-					if !ok {
-						logger.Printf(lg.ERROR, "Model %s not found", modelId)
-					} else {
-						if data.Error != nil {
-							modelChannel.(chan ModelStatus) <- ModelStatus{ModelID: modelId, Err: data.Error}
-						} else {
-							if conf.ModelPlugins[modelId].Mode != "async" {
-								// store the results
-								resultSyncMap, ok := p.results.Load(data.TransactionId)
-								if !ok {
-									modelChannel.(chan ModelStatus) <- ModelStatus{ModelID: modelId, Err: fmt.Errorf("transaction results not found")}
-									return
-								}
-								modelResult := ModelResults{ProbAttack: data.ProbAttack, Data: data.Data}
-								resultSyncMap.(*sync.Map).Store(modelId, modelResult)
-							}
-							modelChannel.(chan ModelStatus) <- ModelStatus{ModelID: modelId, ProbAttack: data.ProbAttack, Err: nil}
+					// the results of the async models are only stored
+					// to be given to the later checks if configured
+					if conf.ModelPlugins[modelId].Mode != "async" || conf.IncludeAsyncResults {
+						// store the results
+						modelResult := ModelResults{ProbAttack: data.ProbAttack, Data: data.Data, Categories: data.Categories, Uncertainty: data.Uncertainty, NeedParts: data.NeedParts, Shared: data.Shared, Hints: data.Hints}
+						if !s.setResults(data.TransactionId, modelId, modelResult) {
+							modelChannel <- ModelStatus{ModelID: modelId, Err: fmt.Errorf("transaction results not found"), Start: start, End: end, Transport: TransportNATS}
+							return
 						}
+						p.shareResults(data.TransactionId, modelId, modelResult)
+						p.TransactionScratch(data.TransactionId).merge(data.Shared)
 					}
+					modelChannel <- ModelStatus{ModelID: modelId, ProbAttack: data.ProbAttack, Err: nil, NeedParts: data.NeedParts,
+						Data: data.Data, Start: start, End: end, Transport: TransportNATS}
 				}
 			}
-		}(*msg)
+		}
+	}
+}
+
+// ModelResultsHandler listens for messages on the model results queue
+func (p *PluginManager) ModelResultsHandler(modelId string) {
+	logger := lg.Get()
+	if p.natConn == nil {
+		logger.Printf(lg.ERROR, "Model: %s | Not listening on model results queue, not connected to NATS", modelId)
+		return
+	}
+
+	sub, err := p.natConn.Subscribe(ModelResultsSubject(modelId), func(msg *nats.Msg) {
+		go p.receiveModelResults(modelId, msg)
 	})
 
 	if err != nil {
@@ -413,18 +1042,23 @@ func (p *PluginManager) ModelResultsHandler(modelId string) {
 
 // ModelProcessHandler listens for messages on the model queue
 func ModelProcessHandler(modelId string, modelProcess func(ModelInput) (ModelResults, error)) {
+	modelProcessHandler(cf.Snapshot(), modelId, modelProcess)
+}
+
+// modelProcessHandler listens for messages on the model queue of the
+// NATS server of conf
+func modelProcessHandler(conf *cf.ConfigStore, modelId string, modelProcess func(ModelInput) (ModelResults, error)) {
 	logger := lg.Get()
 	logger.Printf(lg.INFO, "Model: %s | Starting model process handler", modelId)
-	conf := cf.Get()
 
-	nc, err := nats.Connect(conf.NatsURL)
+	nc, err := connectNATS(conf, "wace-"+modelId, nil)
 
 	if err != nil {
 		logger.Printf(lg.ERROR, "Model: %s | Failed to connect to NATS server", modelId)
 		return
 	}
 
-	_, err = nc.Subscribe(modelId, func(msg *nats.Msg) {
+	_, err = nc.Subscribe(ModelSubject(modelId), func(msg *nats.Msg) {
 		go func(msg nats.Msg) {
 			data := &ModelInput{}
 			err := json.Unmarshal(msg.Data, data)
@@ -432,7 +1066,7 @@ func ModelProcessHandler(modelId string, modelProcess func(ModelInput) (ModelRes
 				logger.Printf(lg.ERROR, "Model: %s | Failed to parse JSON payload", modelId)
 			} else {
 				res, err := modelProcess(*data)
-				modelResult := ModelResults{ProbAttack: res.ProbAttack, Data: res.Data}
+				modelResult := ModelResults{ProbAttack: res.ProbAttack, Data: res.Data, Categories: res.Categories, Uncertainty: res.Uncertainty, NeedParts: res.NeedParts, Shared: res.Shared, Hints: res.Hints}
 				payloadToSend := &ModelTransmitionResults{
 					TransactionId: data.TransactionId,
 					ModelResults:  modelResult,
@@ -445,7 +1079,12 @@ func ModelProcessHandler(modelId string, modelProcess func(ModelInput) (ModelRes
 					logger.Printf(lg.ERROR, "Model: %s | Failed to parse JSON payload", modelId)
 				}
 
-				nc.Publish(modelId+"/results", jsonPayload)
+				// the requests are answered on their reply subject
+				subject := ModelResultsSubject(modelId)
+				if msg.Reply != "" {
+					subject = msg.Reply
+				}
+				nc.PublishMsg(NewWorkerMsg(subject, jsonPayload))
 			}
 		}(*msg)
 	})
@@ -0,0 +1,67 @@
+package pluginmanager
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// WorkerPoolUsage is the use of the worker pool of a model affinity
+type WorkerPoolUsage struct {
+	Affinity string
+	Size     int
+	// Busy is the number of calls running in the pool, and Waiting the
+	// number of calls waiting for one of them to finish
+	Busy    int
+	Waiting int
+}
+
+// workerPool bounds the concurrent calls of the models of an affinity
+type workerPool struct {
+	slots   chan struct{}
+	waiting atomic.Int64
+}
+
+// workerPools are the worker pools of the model affinities
+type workerPools map[string]*workerPool
+
+// newWorkerPools creates the worker pools of the given sizes
+func newWorkerPools(sizes map[string]int) workerPools {
+	pools := make(workerPools, len(sizes))
+	for affinity, size := range sizes {
+		pools[affinity] = &workerPool{slots: make(chan struct{}, size)}
+	}
+	return pools
+}
+
+// acquire waits for a free slot of the worker pool of the affinity, and
+// returns the function releasing it. The calls of the models without
+// affinity, or of an affinity without pool, are not bounded.
+func (w workerPools) acquire(affinity string) func() {
+	pool, ok := w[affinity]
+	if !ok {
+		return func() {}
+	}
+	select {
+	case pool.slots <- struct{}{}:
+	default:
+		pool.waiting.Add(1)
+		pool.slots <- struct{}{}
+		pool.waiting.Add(-1)
+	}
+	return func() { <-pool.slots }
+}
+
+// WorkerPools returns the use of the worker pools, by affinity
+func (p *PluginManager) WorkerPools() []WorkerPoolUsage {
+	usage := make([]WorkerPoolUsage, 0, len(p.pools))
+	for affinity, pool := range p.pools {
+		usage = append(usage, WorkerPoolUsage{
+			Affinity: affinity,
+			Size:     cap(pool.slots),
+			Busy:     len(pool.slots),
+			Waiting:  int(pool.waiting.Load()),
+		})
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Affinity < usage[j].Affinity })
+	return usage
+}
@@ -0,0 +1,40 @@
+package pluginmanager
+
+import (
+	"testing"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+func TestWorkerPools(t *testing.T) {
+	p := &PluginManager{pools: newWorkerPools(map[string]int{cf.CPUBound: 1, cf.IOBound: 4})}
+	release := p.pools.acquire(cf.CPUBound)
+
+	acquired := make(chan func())
+	go func() { acquired <- p.pools.acquire(cf.CPUBound) }()
+	select {
+	case <-acquired:
+		t.Fatalf("second call acquired the only slot of the pool")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// the other pools and the models without affinity are not blocked
+	p.pools.acquire(cf.IOBound)()
+	p.pools.acquire("")()
+
+	usage := p.WorkerPools()
+	if len(usage) != 2 || usage[0] != (WorkerPoolUsage{Affinity: cf.CPUBound, Size: 1, Busy: 1, Waiting: 1}) || usage[1].Busy != 0 {
+		t.Errorf("worker pools are %+v", usage)
+	}
+
+	release()
+	select {
+	case release := <-acquired:
+		release()
+	case <-time.After(time.Second):
+		t.Fatalf("waiting call not run once the slot was released")
+	}
+	if usage := p.WorkerPools(); usage[0].Busy != 0 || usage[0].Waiting != 0 {
+		t.Errorf("worker pools after the calls are %+v", usage)
+	}
+}
@@ -0,0 +1,121 @@
+package pluginmanager
+
+import (
+	"fmt"
+	"sync"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// registry holds the plugins compiled into the binary, registered by
+// name with RegisterModel and RegisterDecision
+var registry = struct {
+	mutex     sync.RWMutex
+	models    map[string]registeredModel
+	decisions map[string]registeredDecision
+}{
+	models:    make(map[string]registeredModel),
+	decisions: make(map[string]registeredDecision),
+}
+
+// registeredModel is a model plugin compiled into the binary
+type registeredModel struct {
+	init    func(map[string]string, metric.Meter) error
+	process func(ModelInput) (ModelResults, error)
+}
+
+// registeredDecision is a decision plugin compiled into the binary
+type registeredDecision struct {
+	init         func(map[string]string, metric.Meter) error
+	checkResults func(DecisionInput) (DecisionResult, error)
+}
+
+// RegisterModel registers a model plugin compiled into the binary,
+// used by the model plugins of kind builtin with its name. init, which
+// can be nil, is called with the params of every such plugin when it is
+// loaded, as the InitPlugin function of a shared object plugin. It
+// returns an error if the name is already used by a built-in or
+// registered model. It is usually called through the pluginregistry
+// package.
+func RegisterModel(name string, init func(map[string]string, metric.Meter) error, process func(ModelInput) (ModelResults, error)) error {
+	if process == nil {
+		return fmt.Errorf("model %s registered without a process function", name)
+	}
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if _, ok := builtinModels[name]; ok {
+		return fmt.Errorf("model %s is a builtin model", name)
+	}
+	if _, ok := registry.models[name]; ok {
+		return fmt.Errorf("model %s is already registered", name)
+	}
+	registry.models[name] = registeredModel{init: init, process: process}
+	return nil
+}
+
+// RegisterDecision registers a decision plugin compiled into the
+// binary, used by the decision plugins of kind builtin with its name,
+// as RegisterModel does for model plugins
+func RegisterDecision(name string, init func(map[string]string, metric.Meter) error, checkResults func(DecisionInput) (DecisionResult, error)) error {
+	if checkResults == nil {
+		return fmt.Errorf("decision %s registered without a check function", name)
+	}
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if _, ok := builtinDecisions[name]; ok {
+		return fmt.Errorf("decision %s is a builtin decision", name)
+	}
+	if _, ok := registry.decisions[name]; ok {
+		return fmt.Errorf("decision %s is already registered", name)
+	}
+	registry.decisions[name] = registeredDecision{init: init, checkResults: checkResults}
+	return nil
+}
+
+// builtinModel returns the factory of the built-in or registered model
+// of the given name, and false if there is none. The registered models
+// are initialized with meter.
+func builtinModel(name string, meter metric.Meter) (builtinModelFactory, bool) {
+	if factory, ok := builtinModels[name]; ok {
+		return factory, true
+	}
+	registry.mutex.RLock()
+	model, ok := registry.models[name]
+	registry.mutex.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return func(params map[string]string) (func(ModelInput) (ModelResults, error), error) {
+		if model.init != nil {
+			if err := model.init(params, meter); err != nil {
+				return nil, err
+			}
+		}
+		return model.process, nil
+	}, true
+}
+
+// builtinDecision returns the factory of the built-in or registered
+// decision of the given name, and false if there is none. The
+// registered decisions are initialized with meter.
+func builtinDecision(name string, meter metric.Meter) (builtinDecisionFactory, bool) {
+	if factory, ok := builtinDecisions[name]; ok {
+		return factory, true
+	}
+	registry.mutex.RLock()
+	decision, ok := registry.decisions[name]
+	registry.mutex.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return func(params map[string]string, rules map[string]cf.CategoryRule) (func(DecisionInput) (DecisionResult, error), error) {
+		if decision.init != nil {
+			if err := decision.init(params, meter); err != nil {
+				return nil, err
+			}
+		}
+		return decision.checkResults, nil
+	}, true
+}
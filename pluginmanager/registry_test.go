@@ -0,0 +1,78 @@
+package pluginmanager
+
+import (
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+func TestRegisterModel(t *testing.T) {
+	var initParams map[string]string
+	init := func(params map[string]string, meter metric.Meter) error {
+		if params["fail"] != "" {
+			return errors.New(params["fail"])
+		}
+		initParams = params
+		return nil
+	}
+	process := func(input ModelInput) (ModelResults, error) {
+		return ModelResults{ProbAttack: 0.25}, nil
+	}
+	if err := RegisterModel("registrytest", init, process); err != nil {
+		t.Fatalf("RegisterModel returned error: %v", err)
+	}
+	if err := RegisterModel("registrytest", nil, process); err == nil {
+		t.Errorf("registering a model twice does not return error")
+	}
+	if err := RegisterModel("protocol", nil, process); err == nil {
+		t.Errorf("registering a builtin model name does not return error")
+	}
+	if err := RegisterModel("registrynil", nil, nil); err == nil {
+		t.Errorf("registering a model without process does not return error")
+	}
+
+	factory, ok := builtinModel("registrytest", nil)
+	if !ok {
+		t.Fatalf("registered model not found")
+	}
+	registered, err := factory(map[string]string{"key": "value"})
+	if err != nil {
+		t.Fatalf("registered model factory returned error: %v", err)
+	}
+	if initParams["key"] != "value" {
+		t.Errorf("registered model initialized with %v", initParams)
+	}
+	if res, _ := registered(ModelInput{}); res.ProbAttack != 0.25 {
+		t.Errorf("registered model returned %v", res.ProbAttack)
+	}
+	if _, err := factory(map[string]string{"fail": "bad params"}); err == nil {
+		t.Errorf("registered model init error not returned")
+	}
+	if _, ok := builtinModel("unregistered", nil); ok {
+		t.Errorf("unregistered model found")
+	}
+}
+
+func TestRegisterDecision(t *testing.T) {
+	check := func(input DecisionInput) (DecisionResult, error) {
+		return DecisionResult{Block: true}, nil
+	}
+	if err := RegisterDecision("registrytest", nil, check); err != nil {
+		t.Fatalf("RegisterDecision returned error: %v", err)
+	}
+	if err := RegisterDecision("combiner", nil, check); err == nil {
+		t.Errorf("registering a builtin decision name does not return error")
+	}
+	factory, ok := builtinDecision("registrytest", nil)
+	if !ok {
+		t.Fatalf("registered decision not found")
+	}
+	registered, err := factory(nil, nil)
+	if err != nil {
+		t.Fatalf("registered decision factory returned error: %v", err)
+	}
+	if res, _ := registered(DecisionInput{}); !res.Block {
+		t.Errorf("registered decision does not block")
+	}
+}
@@ -0,0 +1,53 @@
+package pluginmanager
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// DefaultRequestTimeout bounds the requests to the remote models
+// configured with request reply and without a timeout
+const DefaultRequestTimeout = 30 * time.Second
+
+// request sends the payload to the remote model as a NATS request, and
+// handles its reply like the messages of its results subject. The
+// request is bounded by the timeout of the model, and retried as
+// configured when it fails.
+func (p *PluginManager) request(modelId, transactionId, payload string) error {
+	data, err := p.remoteInput(modelId, transactionId, payload)
+	if err != nil {
+		return err
+	}
+	conf := p.config().ModelPlugins[modelId]
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout
+	}
+
+	queued, _ := p.queued.LoadOrStore(transactionId, new(sync.Map))
+	queued.(*sync.Map).Store(modelId, time.Now())
+	reply, err := p.natConn.RequestMsg(NewWorkerMsg(ModelSubject(modelId), data), timeout)
+	for retry := 1; err != nil && retry <= conf.Retries; retry++ {
+		delay := cf.RetryDelay(conf.RetryBackoff, retry)
+		lg.Get().TPrintf(lg.WARN, transactionId, "%s | request failed: %v, retry %d in %v", modelId, err, retry, delay)
+		p.recordModelRetry(modelId)
+		time.Sleep(delay)
+		reply, err = p.natConn.RequestMsg(NewWorkerMsg(ModelSubject(modelId), data), timeout)
+	}
+	if err != nil {
+		p.queuedTime(transactionId, modelId)
+		if errors.Is(err, nats.ErrNoResponders) {
+			return fmt.Errorf("no worker of model %s is serving", modelId)
+		}
+		return fmt.Errorf("request to model %s failed: %v", modelId, err)
+	}
+	p.receiveModelResults(modelId, reply)
+	return nil
+}
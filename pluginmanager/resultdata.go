@@ -0,0 +1,91 @@
+package pluginmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// OversizedResultError is the analysis error of a model whose results
+// Data exceeds the configured size limit, with the reject action
+type OversizedResultError struct {
+	ModelID string
+	// Size and Limit are in bytes of the JSON encoding of the Data
+	Size  int
+	Limit int
+}
+
+func (e *OversizedResultError) Error() string {
+	return fmt.Sprintf("model plugin %s returned %d bytes of result data, over the limit of %d", e.ModelID, e.Size, e.Limit)
+}
+
+// limitResultData applies the configured size limit to the Data of
+// the results of the model, dropping keys until it fits with the
+// truncate action, or returning an *OversizedResultError with the
+// reject action
+func (p *PluginManager) limitResultData(transactionId, modelId string, res ModelResults) (ModelResults, error) {
+	limit := p.config().ResultData
+	if limit.MaxBytes == 0 || len(res.Data) == 0 {
+		return res, nil
+	}
+	encoded, err := json.Marshal(res.Data)
+	if err != nil || len(encoded) <= limit.MaxBytes {
+		return res, nil
+	}
+	p.recordOversizedResult(modelId, limit.Action)
+	if limit.Action == cf.ResultDataReject {
+		return res, &OversizedResultError{ModelID: modelId, Size: len(encoded), Limit: limit.MaxBytes}
+	}
+	lg.Get().TPrintf(lg.WARN, transactionId, "%s | %d bytes of result data over the limit of %d, truncated", modelId, len(encoded), limit.MaxBytes)
+	res.Data = truncateData(res.Data, limit.MaxBytes)
+	return res, nil
+}
+
+// truncateData returns the keys of data, in order, whose JSON encoding
+// fits in max bytes
+func truncateData(data map[string]interface{}, max int) map[string]interface{} {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	truncated := make(map[string]interface{})
+	// the opening brace, and a colon and a comma or the closing brace
+	// per key
+	size := 1
+	for _, key := range keys {
+		encodedKey, _ := json.Marshal(key)
+		encodedValue, err := json.Marshal(data[key])
+		if err != nil {
+			continue
+		}
+		if entry := len(encodedKey) + len(encodedValue) + 2; size+entry <= max {
+			truncated[key] = data[key]
+			size += entry
+		}
+	}
+	return truncated
+}
+
+// recordOversizedResult counts the model results whose Data exceeds
+// the size limit
+func (p *PluginManager) recordOversizedResult(modelId, action string) {
+	if p.instruments == nil {
+		return
+	}
+	counter, err := p.instruments.Int64Counter("wace.model.result.oversized.total", metric.WithDescription("Number of model results whose data exceeds the size limit"))
+	if err != nil {
+		return
+	}
+	counter.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("model_id", modelId),
+		attribute.String("action", action)))
+}
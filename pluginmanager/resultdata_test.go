@@ -0,0 +1,45 @@
+package pluginmanager
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+func TestLimitResultData(t *testing.T) {
+	res := ModelResults{ProbAttack: 0.5, Data: map[string]interface{}{
+		"a":     "short",
+		"b":     strings.Repeat("x", 100),
+		"c":     42,
+		"debug": strings.Repeat("y", 1000),
+	}}
+
+	p := &PluginManager{conf: &cf.ConfigStore{ResultData: cf.ResultDataConfig{MaxBytes: 200, Action: cf.ResultDataTruncate}}}
+	limited, err := p.limitResultData("tx", "model", res)
+	if err != nil {
+		t.Fatalf("truncating returned error: %v", err)
+	}
+	if encoded, _ := json.Marshal(limited.Data); len(encoded) > 200 {
+		t.Errorf("truncated data of %d bytes over the limit", len(encoded))
+	}
+	if _, ok := limited.Data["debug"]; ok || limited.Data["a"] != "short" || limited.Data["c"] != 42 || limited.ProbAttack != 0.5 {
+		t.Errorf("unexpected truncated results %+v", limited)
+	}
+	if len(res.Data) != 4 {
+		t.Errorf("truncating modified the original data")
+	}
+
+	p.conf.ResultData.Action = cf.ResultDataReject
+	var oversized *OversizedResultError
+	if _, err := p.limitResultData("tx", "model", res); !errors.As(err, &oversized) || oversized.ModelID != "model" || oversized.Limit != 200 {
+		t.Errorf("rejecting returned %v", err)
+	}
+
+	p.conf.ResultData.MaxBytes = 0
+	if limited, err := p.limitResultData("tx", "model", res); err != nil || len(limited.Data) != 4 {
+		t.Errorf("no limit returned %+v, %v", limited, err)
+	}
+}
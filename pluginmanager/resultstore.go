@@ -0,0 +1,101 @@
+package pluginmanager
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/tiroa-tilsor/wacelib/statestore"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// resultKeyPrefix prefixes the result store keys of the model results
+// of each transaction
+const resultKeyPrefix = "results/"
+
+// sharedResults keeps the model results in a store shared by the WACE
+// instances
+type sharedResults struct {
+	store statestore.Store
+	ttl   time.Duration
+}
+
+// openResultStore connects to the shared result store of the
+// configuration, if any. The results are only kept in the instance if
+// it cannot be reached.
+func (p *PluginManager) openResultStore() {
+	conf := p.config().ResultStore
+	if conf.Redis == "" {
+		return
+	}
+	store, err := statestore.NewRedis(conf.Redis)
+	if err != nil {
+		lg.Get().Printf(lg.ERROR, "Results kept in this instance only: %v", err)
+		return
+	}
+	p.results = sharedResults{store: store, ttl: conf.TTL}
+	lg.Get().Printf(lg.INFO, "Sharing the model results in redis for %v", conf.TTL)
+}
+
+// resultKey returns the result store key of the results of the model
+func resultKey(transactionId, modelId string) string {
+	return resultKeyPrefix + transactionId + "/" + modelId
+}
+
+// shareResults stores the results of the model in the shared result
+// store, if any
+func (p *PluginManager) shareResults(transactionId, modelId string, res ModelResults) {
+	if p.results.store == nil {
+		return
+	}
+	data, err := json.Marshal(res)
+	if err == nil {
+		err = p.results.store.Set(resultKey(transactionId, modelId), data, p.results.ttl)
+	}
+	if err != nil {
+		lg.Get().TPrintf(lg.WARN, transactionId, "%s | could not share results: %v", modelId, err)
+	}
+}
+
+// unshareResults removes the results of the model of the transaction
+// from the shared result store, if any
+func (p *PluginManager) unshareResults(transactionId, modelId string) {
+	if p.results.store == nil {
+		return
+	}
+	if err := p.results.store.Delete(resultKey(transactionId, modelId)); err != nil {
+		lg.Get().TPrintf(lg.WARN, transactionId, "%s | could not delete shared results: %v", modelId, err)
+	}
+}
+
+// addSharedResults adds to results those of the models of the
+// transaction found in the shared result store, if any, analyzed on
+// other instances. The results of this instance take precedence.
+func (p *PluginManager) addSharedResults(transactionId string, results map[string]ModelResults) {
+	if p.results.store == nil {
+		return
+	}
+	prefix := resultKeyPrefix + transactionId + "/"
+	keys, err := p.results.store.Keys(prefix)
+	if err != nil {
+		lg.Get().TPrintf(lg.WARN, transactionId, "could not read shared results: %v", err)
+		return
+	}
+	for _, key := range keys {
+		modelId := strings.TrimPrefix(key, prefix)
+		if _, ok := results[modelId]; ok {
+			continue
+		}
+		data, found, err := p.results.store.Get(key)
+		if err != nil || !found {
+			continue
+		}
+		var res ModelResults
+		if err := json.Unmarshal(data, &res); err != nil {
+			lg.Get().TPrintf(lg.WARN, transactionId, "%s | invalid shared results: %v", modelId, err)
+			continue
+		}
+		results[modelId] = res
+	}
+}
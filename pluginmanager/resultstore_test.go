@@ -0,0 +1,55 @@
+package pluginmanager
+
+import (
+	"testing"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"github.com/tiroa-tilsor/wacelib/statestore"
+)
+
+func TestSharedResults(t *testing.T) {
+	store := statestore.NewMemory()
+	model := func(prob float64) func(ModelInput) (ModelResults, error) {
+		return func(ModelInput) (ModelResults, error) {
+			return ModelResults{ProbAttack: prob, Data: map[string]interface{}{"rule": "x"}}, nil
+		}
+	}
+	// the request is analyzed on one instance and the response on the
+	// other
+	request := &PluginManager{
+		modelPlugins:     map[string]modelPlugin{"headers": {pluginType: cf.RequestHeaders}},
+		modelProcessFunc: map[string]func(ModelInput) (ModelResults, error){"headers": model(0.7)},
+		results:          sharedResults{store: store, ttl: time.Minute},
+	}
+	response := &PluginManager{
+		modelPlugins:     map[string]modelPlugin{"leak": {pluginType: cf.ResponseBody}},
+		modelProcessFunc: map[string]func(ModelInput) (ModelResults, error){"leak": model(0.2)},
+		results:          sharedResults{store: store, ttl: time.Minute},
+	}
+	request.InitTransaction("tx")
+	defer request.CloseTransaction("tx")
+	response.InitTransaction("tx")
+	defer response.CloseTransaction("tx")
+
+	status := make(chan ModelStatus, 1)
+	request.Process("headers", "tx", "GET / HTTP/1.1\n", cf.RequestHeaders, status)
+	<-status
+	response.Process("leak", "tx", "secret", cf.ResponseBody, status)
+	<-status
+
+	results, err := response.TransactionResults("tx")
+	if err != nil {
+		t.Fatalf("TransactionResults returned error: %v", err)
+	}
+	if len(results) != 2 || results["headers"].ProbAttack != 0.7 || results["headers"].Data["rule"] != "x" || results["leak"].ProbAttack != 0.2 {
+		t.Errorf("results are %+v", results)
+	}
+
+	local := &PluginManager{}
+	local.InitTransaction("tx")
+	defer local.CloseTransaction("tx")
+	if results, _ := local.TransactionResults("tx"); len(results) != 0 {
+		t.Errorf("instance without result store has results %v", results)
+	}
+}
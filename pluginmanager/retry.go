@@ -0,0 +1,104 @@
+package pluginmanager
+
+import (
+	"plugin"
+	"time"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// Bounds of the exponential backoff between the retries of a plugin
+// whose initialization failed at startup
+const (
+	InitRetryMin = time.Second
+	InitRetryMax = time.Minute
+)
+
+// initRetry is the initialization of a plugin retried in the
+// background. init returns the function promoting the plugin into the
+// loaded ones once it succeeds. tp is the shared object of the plugin,
+// if any, or else version is reported in its load event.
+type initRetry struct {
+	kind    string
+	id      string
+	path    string
+	tp      *plugin.Plugin
+	version string
+	init    func() (func(), error)
+}
+
+// initRetries are the plugins whose initialization is retried
+type initRetries struct {
+	pending []initRetry
+	stop    chan struct{}
+	// stopped is guarded by the plugins lock, so that no plugin is
+	// promoted after the plugin manager is shut down
+	stopped bool
+}
+
+// retryInit records the plugin of retry, whose initialization failed
+// with err, as skipped and retries it once the plugins are loaded
+func (p *PluginManager) retryInit(retry initRetry, err error) {
+	p.skipped(retry.kind, retry.id, retry.path, err.Error()+", retrying")
+	p.retries.pending = append(p.retries.pending, retry)
+}
+
+// startInitRetries retries the initialization of the pending plugins,
+// each in its own goroutine
+func (p *PluginManager) startInitRetries() {
+	if len(p.retries.pending) == 0 {
+		return
+	}
+	p.retries.stop = make(chan struct{})
+	for _, retry := range p.retries.pending {
+		go p.runInitRetry(retry, InitRetryMin, InitRetryMax)
+	}
+}
+
+// runInitRetry retries the initialization of a plugin, doubling the
+// delay between the attempts from min up to max, until it succeeds or
+// the retries are stopped
+func (p *PluginManager) runInitRetry(retry initRetry, min, max time.Duration) {
+	logger := lg.Get()
+	delay := min
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-time.After(delay):
+		case <-p.retries.stop:
+			return
+		}
+		promote, err := retry.init()
+		if err != nil {
+			logger.Printf(lg.DEBUG, "| %s | %s plugin initialization attempt %d failed: %v", retry.id, retry.kind, attempt, err)
+			if delay *= 2; delay > max {
+				delay = max
+			}
+			continue
+		}
+		p.plugins.Lock()
+		if p.retries.stopped {
+			p.plugins.Unlock()
+			return
+		}
+		promote()
+		p.plugins.Unlock()
+		if retry.tp != nil {
+			p.loaded(retry.kind, retry.id, retry.path, retry.tp)
+			p.warmUp(retry.kind, retry.id, warmupFunc(retry.tp))
+		} else {
+			p.recordLoad(PluginLoadEvent{ID: retry.id, Kind: retry.kind, Path: retry.path, Status: PluginLoaded, Version: retry.version})
+		}
+		logger.Printf(lg.INFO, "| %s | %s plugin loaded after %d retries", retry.id, retry.kind, attempt)
+		return
+	}
+}
+
+// stopInitRetries stops retrying the initialization of the plugins
+func (p *PluginManager) stopInitRetries() {
+	p.plugins.Lock()
+	p.retries.stopped = true
+	p.plugins.Unlock()
+	if p.retries.stop != nil {
+		close(p.retries.stop)
+	}
+}
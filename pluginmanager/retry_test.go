@@ -0,0 +1,54 @@
+package pluginmanager
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+func TestInitRetry(t *testing.T) {
+	p := &PluginManager{
+		modelPlugins:     make(map[string]modelPlugin),
+		modelProcessFunc: make(map[string]func(ModelInput) (ModelResults, error)),
+	}
+	attempts := 0
+	retry := initRetry{kind: ModelPluginKind, id: "flaky", version: "test", init: func() (func(), error) {
+		if attempts++; attempts < 3 {
+			return nil, errors.New("backend down")
+		}
+		return func() {
+			p.modelPlugins["flaky"] = modelPlugin{pluginType: cf.RequestHeaders}
+			p.modelProcessFunc["flaky"] = func(ModelInput) (ModelResults, error) { return ModelResults{}, nil }
+		}, nil
+	}}
+	p.retryInit(retry, errors.New("backend down"))
+	if e := p.LoadError(); e == nil || e.Plugins["flaky"] != "backend down, retrying" {
+		t.Errorf("load error of the failed plugin is %v", e)
+	}
+
+	p.runInitRetry(retry, time.Millisecond, 2*time.Millisecond)
+	if attempts != 3 {
+		t.Errorf("initialization attempted %d times, want 3", attempts)
+	}
+	if ids := p.ModelPluginIDs(); len(ids) != 1 || ids[0] != "flaky" {
+		t.Errorf("loaded models are %v", ids)
+	}
+	if e := p.LoadError(); e != nil {
+		t.Errorf("plugin loaded after retrying reported in %v", e)
+	}
+	if report := p.LoadReport(); len(report) != 2 || report[1].Status != PluginLoaded || report[1].Version != "test" {
+		t.Errorf("load report is %+v", report)
+	}
+
+	stopped := &PluginManager{}
+	stopped.stopInitRetries()
+	promoted := false
+	stopped.runInitRetry(initRetry{kind: DecisionPluginKind, id: "late", init: func() (func(), error) {
+		return func() { promoted = true }, nil
+	}}, time.Millisecond, time.Millisecond)
+	if promoted {
+		t.Errorf("plugin promoted after the shutdown")
+	}
+}
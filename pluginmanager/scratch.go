@@ -0,0 +1,123 @@
+package pluginmanager
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Scratch is the per-transaction space where plugins share intermediate
+// features, such as a tokenized body or the extracted URLs, so that the
+// models scheduled later and the decision plugins do not compute them
+// again. The models of a same Analyze call run concurrently, so only
+// Compute guarantees a feature is computed once among them.
+type Scratch struct {
+	mutex   sync.Mutex
+	entries map[string]*scratchEntry
+}
+
+// scratchEntry is a feature of a Scratch. done is closed once its
+// value is published.
+type scratchEntry struct {
+	done  chan struct{}
+	value interface{}
+}
+
+// NewScratch creates an empty scratch space
+func NewScratch() *Scratch {
+	return &Scratch{entries: make(map[string]*scratchEntry)}
+}
+
+// Set publishes the value of the feature key, replacing the previous one
+func (s *Scratch) Set(key string, value interface{}) {
+	e := &scratchEntry{done: make(chan struct{}), value: value}
+	close(e.done)
+	s.mutex.Lock()
+	s.entries[key] = e
+	s.mutex.Unlock()
+}
+
+// Get returns the value of the feature key, and false if it was not
+// published. A feature being computed by Compute is waited for.
+func (s *Scratch) Get(key string) (interface{}, bool) {
+	s.mutex.Lock()
+	e, ok := s.entries[key]
+	s.mutex.Unlock()
+	if !ok {
+		return nil, false
+	}
+	<-e.done
+	return e.value, true
+}
+
+// Compute returns the value of the feature key, calling compute to
+// publish it if it was not. Concurrent calls for the same key wait for
+// the first one instead of computing it again.
+func (s *Scratch) Compute(key string, compute func() interface{}) interface{} {
+	s.mutex.Lock()
+	e, ok := s.entries[key]
+	if !ok {
+		e = &scratchEntry{done: make(chan struct{})}
+		s.entries[key] = e
+	}
+	s.mutex.Unlock()
+	if ok {
+		<-e.done
+		return e.value
+	}
+	defer close(e.done)
+	e.value = compute()
+	return e.value
+}
+
+// Keys returns the published features
+func (s *Scratch) Keys() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	keys := make([]string, 0, len(s.entries))
+	for key := range s.entries {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// merge publishes the features returned by a model in its results
+func (s *Scratch) merge(features map[string]interface{}) {
+	for key, value := range features {
+		s.Set(key, value)
+	}
+}
+
+// MarshalJSON encodes the published features as an object, for the
+// models running in other processes. The features still being computed
+// are left out.
+func (s *Scratch) MarshalJSON() ([]byte, error) {
+	features := make(map[string]interface{})
+	s.mutex.Lock()
+	for key, e := range s.entries {
+		select {
+		case <-e.done:
+			features[key] = e.value
+		default:
+		}
+	}
+	s.mutex.Unlock()
+	return json.Marshal(features)
+}
+
+// UnmarshalJSON decodes the features encoded by MarshalJSON
+func (s *Scratch) UnmarshalJSON(data []byte) error {
+	var features map[string]interface{}
+	if err := json.Unmarshal(data, &features); err != nil {
+		return err
+	}
+	s.entries = make(map[string]*scratchEntry, len(features))
+	s.merge(features)
+	return nil
+}
+
+// TransactionScratch returns the scratch space shared by the plugins
+// analyzing the transaction, creating it if missing
+func (p *PluginManager) TransactionScratch(transactionId string) *Scratch {
+	value, _ := p.scratch.LoadOrStore(transactionId, NewScratch())
+	return value.(*Scratch)
+}
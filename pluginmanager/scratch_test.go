@@ -0,0 +1,80 @@
+package pluginmanager
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+func TestScratchCompute(t *testing.T) {
+	s := NewScratch()
+	var calls int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value := s.Compute("tokens", func() interface{} {
+				atomic.AddInt32(&calls, 1)
+				return []string{"select", "from"}
+			})
+			if len(value.([]string)) != 2 {
+				t.Errorf("computed value is %v", value)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("feature computed %d times", calls)
+	}
+	if _, ok := s.Get("urls"); ok {
+		t.Errorf("missing feature found")
+	}
+
+	s.Set("urls", []string{"http://a"})
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+	decoded := NewScratch()
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("Unmarshal returned error: %v", err)
+	}
+	if len(decoded.Keys()) != 2 {
+		t.Errorf("decoded features are %v", decoded.Keys())
+	}
+}
+
+func TestProcessScratch(t *testing.T) {
+	headers := func(input ModelInput) (ModelResults, error) {
+		input.Scratch.Set("path", "/login")
+		return ModelResults{Shared: map[string]interface{}{"method": "POST"}}, nil
+	}
+	body := func(input ModelInput) (ModelResults, error) {
+		if path, _ := input.Scratch.Get("path"); path != "/login" {
+			t.Errorf("path in the scratch space is %v", path)
+		}
+		if method, _ := input.Scratch.Get("method"); method != "POST" {
+			t.Errorf("method in the scratch space is %v", method)
+		}
+		return ModelResults{}, nil
+	}
+	p := &PluginManager{
+		modelPlugins: map[string]modelPlugin{
+			"headers": {pluginType: cf.RequestHeaders},
+			"body":    {pluginType: cf.RequestBody},
+		},
+		modelProcessFunc: map[string]func(ModelInput) (ModelResults, error){"headers": headers, "body": body},
+	}
+	p.InitTransaction("tx")
+	defer p.CloseTransaction("tx")
+
+	status := make(chan ModelStatus, 1)
+	p.Process("headers", "tx", "POST /login HTTP/1.1\n", cf.RequestHeaders, status)
+	<-status
+	p.Process("body", "tx", "user=bob", cf.RequestBody, status)
+	<-status
+}
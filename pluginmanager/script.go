@@ -0,0 +1,376 @@
+package pluginmanager
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Limits of the calls of the script plugins without their own
+const (
+	scriptMaxSteps = 1000000
+	scriptTimeout  = time.Second
+)
+
+// script is a Starlark script plugin, whose entry point is called with
+// the input as a dict within the limits of steps and time
+type script struct {
+	id       string
+	fn       starlark.Callable
+	maxSteps uint64
+	timeout  time.Duration
+}
+
+// loadScript runs the Starlark file at path, with its params as the
+// params dict and the re module predeclared, and returns the script
+// calling its entry function
+func loadScript(id, path, entry string, params map[string]string, maxSteps uint64, timeout time.Duration) (*script, error) {
+	if maxSteps == 0 {
+		maxSteps = scriptMaxSteps
+	}
+	if timeout <= 0 {
+		timeout = scriptTimeout
+	}
+	s := &script{id: id, maxSteps: maxSteps, timeout: timeout}
+	dict := starlark.NewDict(len(params))
+	for name, value := range params {
+		dict.SetKey(starlark.String(name), starlark.String(value))
+	}
+	predeclared := starlark.StringDict{"params": dict, "re": reModule}
+	predeclared.Freeze()
+	globals, err := s.run(func(thread *starlark.Thread) (starlark.Value, error) {
+		globals, err := starlark.ExecFile(thread, path, nil, predeclared)
+		if err != nil {
+			return nil, err
+		}
+		globals.Freeze()
+		return globals[entry], nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := globals.(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("script %s does not define a %s function", path, entry)
+	}
+	s.fn = fn
+	return s, nil
+}
+
+// run calls fn on a thread of the script, cancelled when it runs more
+// steps or longer than the limits
+func (s *script) run(fn func(thread *starlark.Thread) (starlark.Value, error)) (starlark.Value, error) {
+	thread := &starlark.Thread{Name: s.id}
+	thread.SetMaxExecutionSteps(s.maxSteps)
+	timer := time.AfterFunc(s.timeout, func() { thread.Cancel(fmt.Sprintf("timed out after %v", s.timeout)) })
+	defer timer.Stop()
+	return fn(thread)
+}
+
+// call calls the entry function of the script with input
+func (s *script) call(input *starlark.Dict) (starlark.Value, error) {
+	return s.run(func(thread *starlark.Thread) (starlark.Value, error) {
+		return starlark.Call(thread, s.fn, starlark.Tuple{input}, nil)
+	})
+}
+
+// newScriptModel loads the script model plugin at path, whose process
+// function receives the transaction_id, payload and metadata of the
+// input, and returns the attack probability or a dict of its
+// prob_attack, data, categories and hints
+func newScriptModel(id, path string, params map[string]string, maxSteps uint64, timeout time.Duration) (func(ModelInput) (ModelResults, error), error) {
+	s, err := loadScript(id, path, "process", params, maxSteps, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return func(in ModelInput) (ModelResults, error) {
+		input := starlark.NewDict(3)
+		input.SetKey(starlark.String("transaction_id"), starlark.String(in.TransactionId))
+		input.SetKey(starlark.String("payload"), starlark.String(in.Payload))
+		input.SetKey(starlark.String("metadata"), stringsDict(in.Metadata))
+		value, err := s.call(input)
+		if err != nil {
+			return ModelResults{}, err
+		}
+		return scriptModelResults(value)
+	}, nil
+}
+
+// scriptModelResults returns the model results of the value returned
+// by a script
+func scriptModelResults(value starlark.Value) (ModelResults, error) {
+	var res ModelResults
+	fields, ok := value.(*starlark.Dict)
+	if !ok {
+		prob, ok := starlark.AsFloat(value)
+		if !ok {
+			return ModelResults{}, fmt.Errorf("script returned %s instead of a number or a dict", value.Type())
+		}
+		res.ProbAttack = prob
+	} else {
+		for _, item := range fields.Items() {
+			key, _ := starlark.AsString(item[0])
+			switch key {
+			case "prob_attack":
+				prob, ok := starlark.AsFloat(item[1])
+				if !ok {
+					return ModelResults{}, fmt.Errorf("script prob_attack is %s instead of a number", item[1].Type())
+				}
+				res.ProbAttack = prob
+			case "data":
+				data, ok := fromStarlark(item[1]).(map[string]interface{})
+				if !ok {
+					return ModelResults{}, fmt.Errorf("script data is %s instead of a dict", item[1].Type())
+				}
+				res.Data = data
+			case "categories":
+				categories, ok := item[1].(*starlark.Dict)
+				if !ok {
+					return ModelResults{}, fmt.Errorf("script categories are %s instead of a dict", item[1].Type())
+				}
+				res.Categories = make(map[AttackCategory]float64, categories.Len())
+				for _, category := range categories.Items() {
+					name, _ := starlark.AsString(category[0])
+					score, ok := starlark.AsFloat(category[1])
+					if !ok {
+						return ModelResults{}, fmt.Errorf("script category %s score is %s instead of a number", name, category[1].Type())
+					}
+					res.Categories[AttackCategory(name)] = score
+				}
+			case "hints":
+				hints, ok := fromStarlark(item[1]).([]interface{})
+				if !ok {
+					return ModelResults{}, fmt.Errorf("script hints are %s instead of a list", item[1].Type())
+				}
+				for _, h := range hints {
+					fields, ok := h.(map[string]interface{})
+					if !ok {
+						return ModelResults{}, fmt.Errorf("script hint %v is not a dict", h)
+					}
+					hint := Hint{}
+					for key, value := range fields {
+						switch key {
+						case "action":
+							hint.Action = fmt.Sprint(value)
+						case "target":
+							hint.Target = fmt.Sprint(value)
+						case "value":
+							hint.Value = fmt.Sprint(value)
+						default:
+							return ModelResults{}, fmt.Errorf("script hint has unknown field %s", key)
+						}
+					}
+					res.Hints = append(res.Hints, hint)
+				}
+			default:
+				return ModelResults{}, fmt.Errorf("script returned unknown result %s", item[0])
+			}
+		}
+	}
+	if res.ProbAttack < 0 || res.ProbAttack > 1 {
+		return ModelResults{}, fmt.Errorf("script prob_attack %v is not a probability", res.ProbAttack)
+	}
+	return res, nil
+}
+
+// newScriptDecision loads the script decision plugin at path, whose
+// check function receives the transaction_id, the results (with the
+// prob_attack and categories of each model), weights, waf params,
+// categories, tenant, profile, tags, metadata, missing models, waf
+// weight, decision balance and threshold of the input, and returns
+// whether to block or a dict of its block, challenge and tags
+func newScriptDecision(id, path string, params map[string]string, maxSteps uint64, timeout time.Duration) (func(DecisionInput) (DecisionResult, error), error) {
+	s, err := loadScript(id, path, "check", params, maxSteps, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return func(in DecisionInput) (DecisionResult, error) {
+		results := starlark.NewDict(len(in.Results))
+		for model, res := range in.Results {
+			result := starlark.NewDict(2)
+			result.SetKey(starlark.String("prob_attack"), starlark.Float(res.ProbAttack))
+			result.SetKey(starlark.String("categories"), categoriesDict(res.Categories))
+			results.SetKey(starlark.String(model), result)
+		}
+		weights := starlark.NewDict(len(in.ModelWeight))
+		for model, weight := range in.ModelWeight {
+			weights.SetKey(starlark.String(model), starlark.Float(weight))
+		}
+		input := starlark.NewDict(13)
+		input.SetKey(starlark.String("transaction_id"), starlark.String(in.TransactionId))
+		input.SetKey(starlark.String("results"), results)
+		input.SetKey(starlark.String("weights"), weights)
+		input.SetKey(starlark.String("waf"), stringsDict(in.WAFdata))
+		input.SetKey(starlark.String("categories"), categoriesDict(in.CategoryScores))
+		input.SetKey(starlark.String("tenant"), starlark.String(in.Tenant))
+		input.SetKey(starlark.String("profile"), starlark.String(in.Profile))
+		input.SetKey(starlark.String("tags"), stringsList(in.Tags))
+		input.SetKey(starlark.String("metadata"), stringsDict(in.Metadata))
+		input.SetKey(starlark.String("missing"), stringsList(in.Missing))
+		input.SetKey(starlark.String("waf_weight"), starlark.Float(in.WAFWeight))
+		input.SetKey(starlark.String("decision_balance"), starlark.Float(in.DecisionBalance))
+		input.SetKey(starlark.String("threshold"), starlark.Float(in.Threshold))
+		value, err := s.call(input)
+		if err != nil {
+			return DecisionResult{}, err
+		}
+		return scriptDecisionResult(value)
+	}, nil
+}
+
+// scriptDecisionResult returns the decision of the value returned by a
+// script
+func scriptDecisionResult(value starlark.Value) (DecisionResult, error) {
+	var res DecisionResult
+	fields, ok := value.(*starlark.Dict)
+	if !ok {
+		block, ok := value.(starlark.Bool)
+		if !ok {
+			return DecisionResult{}, fmt.Errorf("script returned %s instead of a bool or a dict", value.Type())
+		}
+		res.Block = bool(block)
+		return res, nil
+	}
+	for _, item := range fields.Items() {
+		key, _ := starlark.AsString(item[0])
+		switch key {
+		case "block":
+			res.Block = bool(item[1].Truth())
+		case "challenge":
+			res.Challenge = bool(item[1].Truth())
+		case "tags":
+			tags, ok := fromStarlark(item[1]).([]interface{})
+			if !ok {
+				return DecisionResult{}, fmt.Errorf("script tags are %s instead of a list", item[1].Type())
+			}
+			for _, tag := range tags {
+				res.Tags = append(res.Tags, fmt.Sprint(tag))
+			}
+		default:
+			return DecisionResult{}, fmt.Errorf("script returned unknown decision %s", item[0])
+		}
+	}
+	return res, nil
+}
+
+// stringsDict returns the Starlark dict of m
+func stringsDict(m map[string]string) *starlark.Dict {
+	dict := starlark.NewDict(len(m))
+	for key, value := range m {
+		dict.SetKey(starlark.String(key), starlark.String(value))
+	}
+	return dict
+}
+
+// stringsList returns the Starlark list of s
+func stringsList(s []string) *starlark.List {
+	values := make([]starlark.Value, len(s))
+	for i, value := range s {
+		values[i] = starlark.String(value)
+	}
+	return starlark.NewList(values)
+}
+
+// categoriesDict returns the Starlark dict of the category scores
+func categoriesDict(categories map[AttackCategory]float64) *starlark.Dict {
+	dict := starlark.NewDict(len(categories))
+	for category, score := range categories {
+		dict.SetKey(starlark.String(category), starlark.Float(score))
+	}
+	return dict
+}
+
+// fromStarlark returns the Go value of a Starlark value: a string,
+// float64, int64, bool, nil, []interface{} or map[string]interface{}
+func fromStarlark(value starlark.Value) interface{} {
+	switch v := value.(type) {
+	case starlark.String:
+		return string(v)
+	case starlark.Bool:
+		return bool(v)
+	case starlark.Int:
+		if i, ok := v.Int64(); ok {
+			return i
+		}
+		return v.String()
+	case starlark.Float:
+		return float64(v)
+	case starlark.NoneType:
+		return nil
+	case *starlark.List:
+		values := make([]interface{}, v.Len())
+		for i := range values {
+			values[i] = fromStarlark(v.Index(i))
+		}
+		return values
+	case starlark.Tuple:
+		values := make([]interface{}, len(v))
+		for i := range v {
+			values[i] = fromStarlark(v[i])
+		}
+		return values
+	case *starlark.Dict:
+		m := make(map[string]interface{}, v.Len())
+		for _, item := range v.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				key = item[0].String()
+			}
+			m[key] = fromStarlark(item[1])
+		}
+		return m
+	}
+	return value.String()
+}
+
+// scriptRegexps caches the regular expressions compiled by the scripts
+var scriptRegexps sync.Map
+
+// scriptRegexp returns the compiled regular expression of pattern
+func scriptRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := scriptRegexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	scriptRegexps.Store(pattern, re)
+	return re, nil
+}
+
+// reModule is the re module of the scripts, matching Go regular
+// expressions: re.search(pattern, s) tells whether s matches,
+// re.findall(pattern, s) returns the matches and re.count(pattern, s)
+// their number
+var reModule = &starlarkstruct.Module{
+	Name: "re",
+	Members: starlark.StringDict{
+		"search":  starlark.NewBuiltin("re.search", reBuiltin),
+		"findall": starlark.NewBuiltin("re.findall", reBuiltin),
+		"count":   starlark.NewBuiltin("re.count", reBuiltin),
+	},
+}
+
+// reBuiltin implements the functions of the re module
+func reBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern, s string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &pattern, &s); err != nil {
+		return nil, err
+	}
+	re, err := scriptRegexp(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	switch fn.Name() {
+	case "re.search":
+		return starlark.Bool(re.MatchString(s)), nil
+	case "re.count":
+		return starlark.MakeInt(len(re.FindAllStringIndex(s, -1))), nil
+	}
+	return stringsList(re.FindAllString(s, -1)), nil
+}
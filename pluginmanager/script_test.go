@@ -0,0 +1,111 @@
+package pluginmanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeScript writes the script source to a file of the test
+func writeScript(t *testing.T, source string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "script.star")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestScriptModel(t *testing.T) {
+	path := writeScript(t, `
+weight = float(params["weight"])
+
+def process(input):
+    hits = re.count(r"(?i)union\s+select|or\s+1=1", input["payload"])
+    return {"prob_attack": min(1.0, hits * weight), "data": {"hits": hits}, "categories": {"sqli": min(1.0, hits * weight)}, "hints": [{"action": "sanitize", "target": "id"}]}
+`)
+	process, err := newScriptModel("regex", path, map[string]string{"weight": "0.4"}, 0, 0)
+	if err != nil {
+		t.Fatalf("newScriptModel returned error: %v", err)
+	}
+	res, err := process(ModelInput{TransactionId: "tx", Payload: "id=1 UNION SELECT pass or 1=1"})
+	if err != nil {
+		t.Fatalf("process returned error: %v", err)
+	}
+	if res.ProbAttack != 0.8 || res.Data["hits"] != int64(2) || res.Categories[CategorySQLi] != 0.8 || len(res.Hints) != 1 || res.Hints[0] != (Hint{Action: HintSanitize, Target: "id"}) {
+		t.Errorf("script results are %+v", res)
+	}
+
+	if _, err := newScriptModel("none", writeScript(t, "x = 1\n"), nil, 0, 0); err == nil {
+		t.Errorf("script without process function does not return error")
+	}
+	invalid, err := newScriptModel("invalid", writeScript(t, "def process(input):\n    return 2\n"), nil, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := invalid(ModelInput{}); err == nil {
+		t.Errorf("script returning an invalid probability does not return error")
+	}
+}
+
+func TestScriptLimits(t *testing.T) {
+	loop := writeScript(t, `
+def process(input):
+    n = 0
+    for i in range(100000000):
+        n += i
+    return 0
+`)
+	process, err := newScriptModel("loop", loop, nil, 10000, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := process(ModelInput{}); err == nil {
+		t.Errorf("script exceeding its steps does not return error")
+	}
+
+	process, err = newScriptModel("slow", loop, nil, 1<<62, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := process(ModelInput{}); err == nil || time.Since(start) > 5*time.Second {
+		t.Errorf("script exceeding its timeout returned %v after %v", err, time.Since(start))
+	}
+}
+
+func TestScriptDecision(t *testing.T) {
+	path := writeScript(t, `
+def check(input):
+    score = 0.0
+    for model, result in input["results"].items():
+        score += result["prob_attack"] * input["weights"][model]
+    if input["waf"].get("score") == "high":
+        return {"block": True, "tags": ["script:waf"]}
+    return {"block": score >= float(params["threshold"]), "challenge": score >= 0.3}
+`)
+	check, err := newScriptDecision("combiner", path, map[string]string{"threshold": "0.7"}, 0, 0)
+	if err != nil {
+		t.Fatalf("newScriptDecision returned error: %v", err)
+	}
+	input := DecisionInput{
+		Results:     map[string]ModelResults{"a": {ProbAttack: 0.5}, "b": {ProbAttack: 0.3}},
+		ModelWeight: map[string]float64{"a": 0.5, "b": 0.5},
+	}
+	if res, err := check(input); err != nil || res.Block || !res.Challenge {
+		t.Errorf("decision is %+v: %v", res, err)
+	}
+	input.WAFdata = map[string]string{"score": "high"}
+	if res, err := check(input); err != nil || !res.Block || len(res.Tags) != 1 || res.Tags[0] != "script:waf" {
+		t.Errorf("decision is %+v: %v", res, err)
+	}
+
+	bare, err := newScriptDecision("bare", writeScript(t, "def check(input):\n    return True\n"), nil, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := bare(DecisionInput{}); err != nil || !res.Block {
+		t.Errorf("decision of a bool is %+v: %v", res, err)
+	}
+}
@@ -0,0 +1,151 @@
+package pluginmanager
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// ServiceCheckTimeout bounds the reachability check of a service
+const ServiceCheckTimeout = 3 * time.Second
+
+// ServiceCheck is the outcome of the reachability check of an external
+// service a plugin depends on
+type ServiceCheck struct {
+	PluginID string `json:"pluginId"`
+	// Kind is ModelPluginKind or DecisionPluginKind
+	Kind    string    `json:"kind"`
+	Service string    `json:"service"`
+	Checked time.Time `json:"checked"`
+	// Err tells why the service is unreachable, and is empty if it is
+	// reachable
+	Err string `json:"error,omitempty"`
+}
+
+// serviceChecks are the last checks of the services of the plugins
+type serviceChecks struct {
+	mutex  sync.Mutex
+	checks []ServiceCheck
+}
+
+// checkService checks that the service is reachable: a TCP connection
+// to the host and port of a URL or a host:port address, or the
+// resolution of a host name
+func checkService(service string, timeout time.Duration) error {
+	address := service
+	if strings.Contains(service, "://") {
+		u, err := url.Parse(service)
+		if err != nil {
+			return err
+		}
+		port := u.Port()
+		if port == "" {
+			port = u.Scheme
+			if p, err := net.LookupPort("tcp", u.Scheme); err == nil {
+				port = fmt.Sprint(p)
+			}
+		}
+		address = net.JoinHostPort(u.Hostname(), port)
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_, err := net.DefaultResolver.LookupHost(ctx, address)
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// checkServices checks concurrently the services of the loaded plugins,
+// logging those unreachable
+func (p *PluginManager) checkServices() {
+	conf := p.config()
+	var checks []ServiceCheck
+	for _, id := range p.ModelPluginIDs() {
+		for _, service := range conf.ModelPlugins[id].Services {
+			checks = append(checks, ServiceCheck{PluginID: id, Kind: ModelPluginKind, Service: service})
+		}
+	}
+	for _, id := range p.DecisionPluginIDs() {
+		for _, service := range conf.DecisionPlugins[id].Services {
+			checks = append(checks, ServiceCheck{PluginID: id, Kind: DecisionPluginKind, Service: service})
+		}
+	}
+	runServiceChecks(checks)
+	p.services.mutex.Lock()
+	p.services.checks = checks
+	p.services.mutex.Unlock()
+}
+
+// runServiceChecks checks concurrently the services of checks
+func runServiceChecks(checks []ServiceCheck) {
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(check *ServiceCheck) {
+			defer wg.Done()
+			check.Checked, check.Err = time.Now(), ""
+			if err := checkService(check.Service, ServiceCheckTimeout); err != nil {
+				check.Err = err.Error()
+				lg.Get().Printf(lg.WARN, "| %s | service %s unreachable: %v", check.PluginID, check.Service, err)
+			}
+		}(&checks[i])
+	}
+	wg.Wait()
+}
+
+// ServiceChecks returns the last checks of the external services the
+// loaded plugins depend on
+func (p *PluginManager) ServiceChecks() []ServiceCheck {
+	p.services.mutex.Lock()
+	defer p.services.mutex.Unlock()
+	return append([]ServiceCheck(nil), p.services.checks...)
+}
+
+// Ready returns an error if a loaded plugin is still running its Warmup
+// function or an external service it depends on is unreachable, so
+// that the instance does not receive traffic before its models are
+// warm and its backends are up. The services found unreachable are
+// checked again.
+func (p *PluginManager) Ready() error {
+	if err := p.warmingUp(); err != nil {
+		return err
+	}
+	p.services.mutex.Lock()
+	defer p.services.mutex.Unlock()
+	var failed []ServiceCheck
+	var indexes []int
+	for i, check := range p.services.checks {
+		if check.Err != "" {
+			failed = append(failed, check)
+			indexes = append(indexes, i)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	runServiceChecks(failed)
+	var unreachable []string
+	for i, check := range failed {
+		p.services.checks[indexes[i]] = check
+		if check.Err != "" {
+			unreachable = append(unreachable, fmt.Sprintf("%s plugin %s service %s: %s", check.Kind, check.PluginID, check.Service, check.Err))
+		}
+	}
+	if len(unreachable) == 0 {
+		return nil
+	}
+	sort.Strings(unreachable)
+	return fmt.Errorf("unreachable services: %s", strings.Join(unreachable, "; "))
+}
@@ -0,0 +1,63 @@
+package pluginmanager
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCheckService(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	listener, err = net.Listen("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	for _, service := range []string{address, "http://" + address + "/predict", "localhost"} {
+		if err := checkService(service, time.Second); err != nil {
+			t.Errorf("service %s returned error: %v", service, err)
+		}
+	}
+	for _, service := range []string{"127.0.0.1:1", "tcp://127.0.0.1:1", "host.invalid"} {
+		if err := checkService(service, time.Second); err == nil {
+			t.Errorf("unreachable service %s does not return error", service)
+		}
+	}
+}
+
+func TestReady(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	p := &PluginManager{}
+	p.services.checks = []ServiceCheck{{PluginID: "model", Kind: ModelPluginKind, Service: address}}
+	runServiceChecks(p.services.checks)
+	if checks := p.ServiceChecks(); checks[0].Err == "" || checks[0].Checked.IsZero() {
+		t.Fatalf("closed service checked as %+v", checks[0])
+	}
+	if err := p.Ready(); err == nil {
+		t.Errorf("unreachable service does not make the plugin manager unready")
+	}
+
+	listener, err = net.Listen("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if err := p.Ready(); err != nil {
+		t.Errorf("Ready returned error once the service is up: %v", err)
+	}
+	if checks := p.ServiceChecks(); checks[0].Err != "" {
+		t.Errorf("service up checked as %+v", checks[0])
+	}
+}
@@ -0,0 +1,48 @@
+package pluginmanager
+
+import (
+	"fmt"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+// Shadow calls the model plugin with id modelID like Process, but
+// returns its status without storing its results, so that a model
+// dark launched along another one does not affect the verdicts
+func (p *PluginManager) Shadow(modelID, transactionId, payload string, t cf.ModelPluginType) ModelStatus {
+	p.plugins.RLock()
+	mp, exists := p.modelPlugins[modelID]
+	process := p.modelProcessFunc[modelID]
+	p.plugins.RUnlock()
+	if !exists || process == nil {
+		return ModelStatus{ModelID: modelID, Err: fmt.Errorf("model plugin not found")}
+	}
+	if mp.pluginType != t {
+		return ModelStatus{ModelID: modelID,
+			Err: fmt.Errorf("plugin type %v cannot process a request with incompatible type %v", mp.pluginType, t)}
+	}
+	transport := mp.transport
+	if transport == "" {
+		transport = TransportLocal
+	}
+
+	start := time.Now()
+	res, err := p.guardProcess(modelID, process)(ModelInput{
+		TransactionId: transactionId,
+		Payload:       payload,
+		Signals:       p.transactionSignals(transactionId),
+		Geo:           p.transactionGeo(transactionId),
+		Message:       p.transactionMessage(transactionId, t),
+		Scratch:       p.TransactionScratch(transactionId),
+		Metadata:      p.TransactionMeta(transactionId),
+	})
+	end := time.Now()
+	if err == nil {
+		res, err = p.limitResultData(transactionId, modelID, res)
+	}
+	if err != nil {
+		return ModelStatus{ModelID: modelID, Err: err, Start: start, End: end, Transport: transport}
+	}
+	return ModelStatus{ModelID: modelID, ProbAttack: res.ProbAttack, Data: res.Data, Start: start, End: end, Transport: transport}
+}
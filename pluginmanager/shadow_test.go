@@ -0,0 +1,32 @@
+package pluginmanager
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+func TestShadow(t *testing.T) {
+	model := func(input ModelInput) (ModelResults, error) {
+		return ModelResults{ProbAttack: 0.6}, nil
+	}
+	p := &PluginManager{
+		modelPlugins:     map[string]modelPlugin{"candidate": {pluginType: cf.RequestBody, transport: TransportGRPC}},
+		modelProcessFunc: map[string]func(ModelInput) (ModelResults, error){"candidate": model},
+	}
+	p.InitTransaction("tx")
+	defer p.CloseTransaction("tx")
+
+	if s := p.Shadow("candidate", "tx", "a=1", cf.RequestBody); s.Err != nil || s.ProbAttack != 0.6 || s.Transport != TransportGRPC {
+		t.Errorf("status of the shadow is %+v", s)
+	}
+	if results, _ := p.TransactionResults("tx"); len(results) != 0 {
+		t.Errorf("results of the shadow stored in %+v", results)
+	}
+	if s := p.Shadow("candidate", "tx", "a=1", cf.RequestHeaders); s.Err == nil {
+		t.Errorf("shadow of another type does not return error")
+	}
+	if s := p.Shadow("missing", "tx", "a=1", cf.RequestBody); s.Err == nil {
+		t.Errorf("unknown shadow does not return error")
+	}
+}
@@ -0,0 +1,136 @@
+package pluginmanager
+
+import (
+	"fmt"
+	"io"
+	"plugin"
+	"sort"
+	"strings"
+	"sync"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+var (
+	// sharedObjects counts the plugin managers holding each shared
+	// object plugin, as a shared object is opened once per process and
+	// shared by the plugin managers loading it, e.g. across a reload
+	sharedObjects      = make(map[*plugin.Plugin]int)
+	sharedObjectsMutex sync.Mutex
+)
+
+// hold records that the plugin manager loaded the shared object
+func (p *PluginManager) hold(tp *plugin.Plugin) {
+	sharedObjectsMutex.Lock()
+	defer sharedObjectsMutex.Unlock()
+	if p.held[tp] {
+		return
+	}
+	if p.held == nil {
+		p.held = make(map[*plugin.Plugin]bool)
+	}
+	p.held[tp] = true
+	sharedObjects[tp]++
+}
+
+// release forgets the shared objects held by the plugin manager, and
+// returns those no other plugin manager holds
+func (p *PluginManager) release() map[*plugin.Plugin]bool {
+	sharedObjectsMutex.Lock()
+	defer sharedObjectsMutex.Unlock()
+	last := make(map[*plugin.Plugin]bool)
+	for tp := range p.held {
+		if sharedObjects[tp]--; sharedObjects[tp] <= 0 {
+			delete(sharedObjects, tp)
+			last[tp] = true
+		}
+	}
+	p.held = nil
+	return last
+}
+
+// shutdownFunc returns the ShutdownPlugin function exported by the
+// plugin, a func() or a func() error, or nil if it exports none
+func shutdownFunc(tp *plugin.Plugin) func() error {
+	if tp == nil {
+		return nil
+	}
+	sym, err := tp.Lookup("ShutdownPlugin")
+	if err != nil {
+		return nil
+	}
+	switch fn := sym.(type) {
+	case func() error:
+		return fn
+	case func():
+		return func() error {
+			fn()
+			return nil
+		}
+	}
+	lg.Get().Printf(lg.WARN, "invalid ShutdownPlugin function type %T, not called", sym)
+	return nil
+}
+
+// Shutdown releases the plugins: it calls the ShutdownPlugin function
+// exported by the shared object plugins no other plugin manager holds,
+// so they can flush their buffers and close their sessions, closes the connections to the grpc
+// models, stops the subprocess models and the health checks, and
+// drains the connection to the NATS server. Only the first call has an
+// effect, and the plugin manager must not be used afterwards. It
+// returns an error listing the plugins whose ShutdownPlugin function
+// failed or panicked.
+func (p *PluginManager) Shutdown() error {
+	var failed []string
+	p.shutdown.Do(func() {
+		p.stopInitRetries()
+		p.stopHealthChecks()
+		// a shared object is opened once per process, so it is shut
+		// down once even if loaded with several IDs, and only with the
+		// last plugin manager holding it
+		last := p.release()
+		call := func(kind, id string, tp *plugin.Plugin) {
+			if !last[tp] {
+				return
+			}
+			delete(last, tp)
+			fn := shutdownFunc(tp)
+			if fn == nil {
+				return
+			}
+			if err := p.safeCall(kind, id, "ShutdownPlugin", fn); err != nil {
+				lg.Get().Printf(lg.ERROR, "| %s | %s plugin shutdown failed: %v", id, kind, err)
+				failed = append(failed, fmt.Sprintf("%s plugin %s: %v", kind, id, err))
+				return
+			}
+			lg.Get().Printf(lg.INFO, "| %s | %s plugin shut down", id, kind)
+		}
+		for _, id := range p.ModelPluginIDs() {
+			call(ModelPluginKind, id, p.modelPlugins[id].p)
+		}
+		for _, id := range p.DecisionPluginIDs() {
+			call(DecisionPluginKind, id, p.decisionPlugins[id].p)
+		}
+		for _, model := range p.grpcModels {
+			if model.conn != nil {
+				model.conn.Close()
+			}
+		}
+		for _, model := range p.subprocessModels {
+			model.kill()
+		}
+		if closer, ok := p.results.store.(io.Closer); ok {
+			closer.Close()
+		}
+		if p.natConn != nil {
+			if err := p.natConn.Drain(); err != nil {
+				p.natConn.Close()
+			}
+		}
+	})
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Strings(failed)
+	return fmt.Errorf("plugin shutdown failed: %s", strings.Join(failed, "; "))
+}
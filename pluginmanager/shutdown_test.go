@@ -0,0 +1,51 @@
+package pluginmanager
+
+import (
+	"plugin"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+func TestShutdown(t *testing.T) {
+	address := serveTestModel(t, &testModelServer{serving: true})
+	model, err := dialGRPCModel("remote", address, cf.RequestHeaders, nil, 0)
+	if err != nil {
+		t.Fatalf("dialGRPCModel returned error: %v", err)
+	}
+	p := &PluginManager{
+		modelPlugins: map[string]modelPlugin{"remote": {pluginType: cf.RequestHeaders, transport: TransportGRPC}},
+		grpcModels:   map[string]*grpcModel{"remote": model},
+	}
+	if err := p.Shutdown(); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+	if state := model.conn.GetState(); state != connectivity.Shutdown {
+		t.Errorf("grpc connection is %v after shutdown", state)
+	}
+	if err := p.Shutdown(); err != nil {
+		t.Errorf("second Shutdown returned error: %v", err)
+	}
+	if fn := shutdownFunc(nil); fn != nil {
+		t.Errorf("builtin plugin has a shutdown function")
+	}
+}
+
+func TestSharedObjects(t *testing.T) {
+	tp := new(plugin.Plugin)
+	first, second := &PluginManager{}, &PluginManager{}
+	first.hold(tp)
+	first.hold(tp)
+	second.hold(tp)
+	if last := first.release(); last[tp] {
+		t.Errorf("shared object released by the first plugin manager while held by the second")
+	}
+	if last := second.release(); !last[tp] {
+		t.Errorf("shared object not released by the last plugin manager")
+	}
+	if n := sharedObjects[tp]; n != 0 {
+		t.Errorf("shared object held %d times after the release", n)
+	}
+}
@@ -0,0 +1,112 @@
+package pluginmanager
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"github.com/tiroa-tilsor/wacelib/grpcmodel"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin"
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// subprocessModel is a model plugin running as a subprocess supervised
+// with go-plugin, which serves the grpcmodel service. A subprocess
+// that exits, e.g. because the model panicked, is restarted on the
+// next call without affecting WACE.
+type subprocessModel struct {
+	id         string
+	path       string
+	params     map[string]string
+	pluginType cf.ModelPluginType
+	timeout    time.Duration
+
+	mutex    sync.Mutex
+	client   *plugin.Client
+	model    *grpcModel
+	restarts int
+}
+
+// startSubprocessModel runs the plugin executable at path and
+// initializes its model with the plugin params
+func startSubprocessModel(id, path string, t cf.ModelPluginType, params map[string]string, timeout time.Duration) (*subprocessModel, error) {
+	m := &subprocessModel{id: id, path: path, params: params, pluginType: t, timeout: timeout}
+	if err := m.start(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// start runs the subprocess and initializes its model
+func (m *subprocessModel) start() error {
+	client := plugin.NewClient(&plugin.ClientConfig{
+		HandshakeConfig:  grpcmodel.Handshake,
+		Plugins:          grpcmodel.PluginMap,
+		Cmd:              exec.Command(m.path),
+		AllowedProtocols: []plugin.Protocol{plugin.ProtocolGRPC},
+		Logger: hclog.New(&hclog.LoggerOptions{
+			Name:   m.id,
+			Level:  hclog.Info,
+			Output: pluginLogWriter{id: m.id},
+		}),
+	})
+	rpcClient, err := client.Client()
+	if err != nil {
+		client.Kill()
+		return fmt.Errorf("subprocess start failed: %v", err)
+	}
+	raw, err := rpcClient.Dispense(grpcmodel.PluginName)
+	if err != nil {
+		client.Kill()
+		return fmt.Errorf("subprocess dispense failed: %v", err)
+	}
+	model := &grpcModel{client: raw.(grpcmodel.ModelClient), pluginType: m.pluginType, timeout: m.timeout}
+	if err := model.init(m.id, m.params); err != nil {
+		client.Kill()
+		return err
+	}
+	m.client, m.model = client, model
+	return nil
+}
+
+// process calls the model of the subprocess, restarting it first if it
+// exited
+func (m *subprocessModel) process(input ModelInput) (ModelResults, error) {
+	m.mutex.Lock()
+	if m.client.Exited() {
+		m.restarts++
+		lg.Get().Printf(lg.WARN, "| %s | subprocess exited, restarting it (restart %d)", m.id, m.restarts)
+		if err := m.start(); err != nil {
+			m.mutex.Unlock()
+			return ModelResults{}, err
+		}
+	}
+	model := m.model
+	m.mutex.Unlock()
+	return model.process(input)
+}
+
+// kill stops the subprocess
+func (m *subprocessModel) kill() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.client.Kill()
+}
+
+// pluginLogWriter writes the logs of a subprocess, including its
+// standard error, to the WACE log
+type pluginLogWriter struct {
+	id string
+}
+
+func (w pluginLogWriter) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(bytes.TrimRight(p, "\n"), []byte("\n")) {
+		lg.Get().Printf(lg.DEBUG, "| %s | %s", w.id, line)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,73 @@
+package pluginmanager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"github.com/tiroa-tilsor/wacelib/grpcmodel"
+)
+
+// subprocessEnv makes the test binary serve panickyModel instead of
+// running the tests, so it can be used as a subprocess plugin
+const subprocessEnv = "WACE_TEST_SUBPROCESS_MODEL"
+
+type panickyModel struct {
+	grpcmodel.UnimplementedModelServer
+}
+
+func (panickyModel) Init(context.Context, *grpcmodel.InitRequest) (*grpcmodel.InitResponse, error) {
+	return &grpcmodel.InitResponse{}, nil
+}
+
+func (panickyModel) Health(context.Context, *grpcmodel.HealthRequest) (*grpcmodel.HealthResponse, error) {
+	return &grpcmodel.HealthResponse{Serving: true}, nil
+}
+
+func (panickyModel) Process(_ context.Context, req *grpcmodel.ProcessRequest) (*grpcmodel.ProcessResponse, error) {
+	if req.Payload == "panic" {
+		panic("model bug")
+	}
+	return &grpcmodel.ProcessResponse{ProbAttack: 0.3}, nil
+}
+
+func TestMain(m *testing.M) {
+	if os.Getenv(subprocessEnv) == "1" {
+		grpcmodel.Serve(panickyModel{})
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func TestSubprocessModel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.sh")
+	script := fmt.Sprintf("#!/bin/sh\n%s=1 exec '%s'\n", subprocessEnv, os.Args[0])
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	m, err := startSubprocessModel("panicky", path, cf.RequestBody, nil, 0)
+	if err != nil {
+		t.Fatalf("startSubprocessModel returned error: %v", err)
+	}
+	defer m.kill()
+
+	if res, err := m.process(ModelInput{Payload: "id=1"}); err != nil || res.ProbAttack != 0.3 {
+		t.Fatalf("process returned %+v, %v", res, err)
+	}
+	if _, err := m.process(ModelInput{Payload: "panic"}); err == nil {
+		t.Errorf("panicking model does not return error")
+	}
+	for deadline := time.Now().Add(5 * time.Second); !m.client.Exited() && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if res, err := m.process(ModelInput{Payload: "id=2"}); err != nil || res.ProbAttack != 0.3 {
+		t.Errorf("process after the panic returned %+v, %v", res, err)
+	}
+	if m.restarts != 1 {
+		t.Errorf("subprocess restarted %d times, expected 1", m.restarts)
+	}
+}
@@ -0,0 +1,107 @@
+package pluginmanager
+
+import (
+	"context"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// TimeoutTag tags the transactions whose decision plugin timed out
+const TimeoutTag = "decision:timeout"
+
+// decisionOutcome is the result of a decision plugin run in the
+// background
+type decisionOutcome struct {
+	res DecisionResult
+	err error
+}
+
+// decide calls the decision plugin, bounded by its configured timeout.
+// If the plugin does not decide in time, the transaction is tagged and
+// the fallback verdict of the plugin is returned instead. The plugin
+// keeps running in the background until it returns. A disabled plugin
+// is not called, and its fallback verdict is returned right away.
+func (p *PluginManager) decide(decisionId string, checkResults func(DecisionInput) (DecisionResult, error), input DecisionInput) (DecisionResult, error) {
+	conf := p.config().DecisionPlugins[decisionId]
+	if p.Disabled(DecisionPluginKind, decisionId) {
+		lg.Get().TPrintf(lg.DEBUG, input.TransactionId, "%s | decision plugin disabled, falling back to %s", decisionId, conf.Fallback)
+		res, err := p.fallback(conf.Fallback, input)
+		res.Tags = append(res.Tags, DisabledTag)
+		return res, err
+	}
+	res, err, ok := runBounded(p.guardCheck(decisionId, checkResults), input, conf.Timeout)
+	if ok {
+		return res, err
+	}
+
+	lg.Get().TPrintf(lg.WARN, input.TransactionId, "%s | decision timed out after %v, falling back to %s", decisionId, conf.Timeout, conf.Fallback)
+	p.recordDecisionTimeout(decisionId, conf.Fallback)
+	res, err = p.fallback(conf.Fallback, input)
+	res.Tags = append(res.Tags, TimeoutTag)
+	return res, err
+}
+
+// fallback returns the fallback verdict of a decision plugin
+func (p *PluginManager) fallback(fallbackId string, input DecisionInput) (DecisionResult, error) {
+	res := DecisionResult{}
+	switch fallbackId {
+	case cf.FallbackAllow:
+	case cf.FallbackBlock:
+		res.Block = true
+	default:
+		// The fallback plugin is bounded by its own timeout, after
+		// which the transaction is allowed, so fallbacks never chain.
+		// A disabled fallback plugin allows the transaction.
+		p.plugins.RLock()
+		fallback, exists := p.decisionCheckFunc[fallbackId]
+		p.plugins.RUnlock()
+		if exists && !p.Disabled(DecisionPluginKind, fallbackId) {
+			res, err, ok := runBounded(p.guardCheck(fallbackId, fallback), input, p.config().DecisionPlugins[fallbackId].Timeout)
+			if ok {
+				return res, err
+			}
+		}
+	}
+	return res, nil
+}
+
+// runBounded calls checkResults and returns its result, or false if it
+// does not return within timeout. A zero timeout waits forever.
+func runBounded(checkResults func(DecisionInput) (DecisionResult, error), input DecisionInput, timeout time.Duration) (DecisionResult, error, bool) {
+	if timeout <= 0 {
+		res, err := checkResults(input)
+		return res, err, true
+	}
+	outcome := make(chan decisionOutcome, 1)
+	go func() {
+		res, err := checkResults(input)
+		outcome <- decisionOutcome{res, err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case o := <-outcome:
+		return o.res, o.err, true
+	case <-timer.C:
+		return DecisionResult{}, nil, false
+	}
+}
+
+// recordDecisionTimeout counts the timeouts of a decision plugin
+func (p *PluginManager) recordDecisionTimeout(decisionId, fallback string) {
+	if p.instruments == nil {
+		return
+	}
+	counter, err := p.instruments.Int64Counter("wace.decision.timeout.total", metric.WithDescription("Number of decision plugin timeouts"))
+	if err != nil {
+		return
+	}
+	counter.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("decision_plugin", decisionId),
+		attribute.String("fallback", fallback)))
+}
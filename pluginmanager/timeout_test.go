@@ -0,0 +1,48 @@
+package pluginmanager
+
+import (
+	"testing"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+func TestDecisionTimeout(t *testing.T) {
+	setDecision := func(id string, timeout time.Duration, fallback string) {
+		cf.Update(func(cs *cf.ConfigStore) error {
+			decision := cs.DecisionPlugins[id]
+			decision.ID, decision.Timeout, decision.Fallback = id, timeout, fallback
+			cs.DecisionPlugins[id] = decision
+			return nil
+		})
+	}
+	setDecision("slow", 10*time.Millisecond, cf.FallbackBlock)
+	setDecision("combiner", 0, cf.FallbackAllow)
+
+	hang := make(chan struct{})
+	defer close(hang)
+	slow := func(DecisionInput) (DecisionResult, error) {
+		<-hang
+		return DecisionResult{}, nil
+	}
+	combiner := func(DecisionInput) (DecisionResult, error) {
+		return DecisionResult{Block: false, Tags: []string{"combined"}}, nil
+	}
+	p := &PluginManager{decisionCheckFunc: map[string]func(DecisionInput) (DecisionResult, error){"slow": slow, "combiner": combiner}}
+
+	res, err := p.decide("slow", slow, DecisionInput{})
+	if err != nil || !res.Block || len(res.Tags) != 1 || res.Tags[0] != TimeoutTag {
+		t.Errorf("block fallback returned %+v, %v", res, err)
+	}
+
+	setDecision("slow", 10*time.Millisecond, "combiner")
+	res, _ = p.decide("slow", slow, DecisionInput{})
+	if res.Block || len(res.Tags) != 2 || res.Tags[0] != "combined" {
+		t.Errorf("combiner fallback returned %+v", res)
+	}
+
+	res, _ = p.decide("combiner", combiner, DecisionInput{})
+	if len(res.Tags) != 1 || res.Tags[0] != "combined" {
+		t.Errorf("decision in time returned %+v", res)
+	}
+}
@@ -0,0 +1,164 @@
+package pluginmanager
+
+import (
+	"sync"
+)
+
+// transactionState holds the model results and the status channels of
+// a transaction. The states are pooled and reused by the later
+// transactions once closed, so a state is only used while its id is
+// the transaction ID given.
+type transactionState struct {
+	mutex         sync.Mutex
+	id            string
+	results       map[string]ModelResults
+	syncChannels  map[string]chan ModelStatus
+	asyncChannels map[string]chan ModelStatus
+}
+
+// transactionStates is the pool of the states of the closed
+// transactions, shared by all the plugin managers
+var transactionStates = sync.Pool{
+	New: func() interface{} {
+		return &transactionState{
+			results:       make(map[string]ModelResults),
+			syncChannels:  make(map[string]chan ModelStatus),
+			asyncChannels: make(map[string]chan ModelStatus),
+		}
+	},
+}
+
+// newTransactionState gets a state for the transaction from the pool
+func newTransactionState(transactionId string) *transactionState {
+	s := transactionStates.Get().(*transactionState)
+	s.mutex.Lock()
+	s.id = transactionId
+	s.mutex.Unlock()
+	return s
+}
+
+// release empties the state and puts it back in the pool
+func (s *transactionState) release() {
+	s.mutex.Lock()
+	s.id = ""
+	clear(s.results)
+	clear(s.syncChannels)
+	clear(s.asyncChannels)
+	s.mutex.Unlock()
+	transactionStates.Put(s)
+}
+
+// channels returns the status channels of the sync or async models
+func (s *transactionState) channels(modelType string) map[string]chan ModelStatus {
+	if modelType == "async" {
+		return s.asyncChannels
+	}
+	return s.syncChannels
+}
+
+// setResults stores the results of the model, and returns false if the
+// state is no longer the one of the transaction
+func (s *transactionState) setResults(transactionId, modelId string, res ModelResults) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.id != transactionId {
+		return false
+	}
+	s.results[modelId] = res
+	return true
+}
+
+// deleteResults removes the results of the models, and returns the IDs
+// of those that had results
+func (s *transactionState) deleteResults(transactionId string, models []string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.id != transactionId {
+		return nil
+	}
+	var deleted []string
+	for _, id := range models {
+		if _, ok := s.results[id]; ok {
+			delete(s.results, id)
+			deleted = append(deleted, id)
+		}
+	}
+	return deleted
+}
+
+// copyResults returns a copy of the results stored so far, and false
+// if the state is no longer the one of the transaction
+func (s *transactionState) copyResults(transactionId string) (map[string]ModelResults, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.id != transactionId {
+		return nil, false
+	}
+	results := make(map[string]ModelResults, len(s.results))
+	for id, res := range s.results {
+		results[id] = res
+	}
+	return results, true
+}
+
+// setChannel registers the status channel of the models of a plugin
+// type
+func (s *transactionState) setChannel(transactionId, pluginType, modelType string, ch chan ModelStatus) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.id != transactionId {
+		return false
+	}
+	s.channels(modelType)[pluginType] = ch
+	return true
+}
+
+// channel returns the status channel of the models of a plugin type
+func (s *transactionState) channel(transactionId, pluginType, modelType string) (chan ModelStatus, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.id != transactionId {
+		return nil, false
+	}
+	ch, ok := s.channels(modelType)[pluginType]
+	return ch, ok
+}
+
+// removeChannel unregisters the status channel of the models of a
+// plugin type and returns it
+func (s *transactionState) removeChannel(transactionId, pluginType, modelType string) (chan ModelStatus, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.id != transactionId {
+		return nil, false
+	}
+	channels := s.channels(modelType)
+	ch, ok := channels[pluginType]
+	delete(channels, pluginType)
+	return ch, ok
+}
+
+// transaction returns the state of the transaction, and false if it was
+// not initialized or is closed
+func (p *PluginManager) transaction(transactionId string) (*transactionState, bool) {
+	value, ok := p.transactions.Load(transactionId)
+	if !ok {
+		return nil, false
+	}
+	return value.(*transactionState), true
+}
+
+// DeleteTransactionResults discards the results of the given models for
+// the transaction, also from the shared result store, so that they are
+// replaced by those of a new analysis instead of added to. It returns
+// the IDs of the models whose results were discarded.
+func (p *PluginManager) DeleteTransactionResults(transactionId string, models []string) []string {
+	s, ok := p.transaction(transactionId)
+	if !ok {
+		return nil
+	}
+	for _, id := range models {
+		p.unshareResults(transactionId, id)
+	}
+	return s.deleteResults(transactionId, models)
+}
@@ -0,0 +1,52 @@
+package pluginmanager
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+func TestTransactionState(t *testing.T) {
+	p := &PluginManager{}
+	p.InitTransaction("tx")
+	s, _ := p.transaction("tx")
+
+	status := make(chan ModelStatus, 1)
+	p.AddModelChannel("tx", cf.RequestBody, status, "sync")
+	if ch, ok := s.channel("tx", cf.RequestBody.String(), "sync"); !ok || ch != status {
+		t.Errorf("sync channel not registered")
+	}
+	if !s.setResults("tx", "model", ModelResults{ProbAttack: 0.5}) {
+		t.Fatalf("results not stored")
+	}
+	results, _ := p.TransactionResults("tx")
+	if results["model"].ProbAttack != 0.5 {
+		t.Errorf("stored results are %+v", results)
+	}
+
+	p.CloseTransaction("tx")
+	if _, err := p.TransactionResults("tx"); err == nil {
+		t.Errorf("results found after the transaction was closed")
+	}
+	// a model finishing after the close must not write into the state,
+	// which may be reused by another transaction
+	if s.setResults("tx", "late", ModelResults{}) {
+		t.Errorf("results stored after the transaction was closed")
+	}
+	if _, ok := s.channel("tx", cf.RequestBody.String(), "sync"); ok {
+		t.Errorf("channel found after the transaction was closed")
+	}
+}
+
+func BenchmarkTransactionState(b *testing.B) {
+	p := &PluginManager{}
+	status := make(chan ModelStatus, 1)
+	for i := 0; i < b.N; i++ {
+		p.InitTransaction("tx")
+		p.AddModelChannel("tx", cf.RequestBody, status, "sync")
+		s, _ := p.transaction("tx")
+		s.setResults("tx", "model", ModelResults{})
+		p.TransactionResults("tx")
+		p.CloseTransaction("tx")
+	}
+}
@@ -0,0 +1,64 @@
+package pluginmanager
+
+import (
+	"fmt"
+	"plugin"
+	"sort"
+	"strings"
+)
+
+// MissingWAFParamsError is returned when checking a transaction with a
+// decision plugin whose required wafParams keys were not supplied by
+// the connector
+type MissingWAFParamsError struct {
+	DecisionPlugin string
+	Missing        []string
+}
+
+func (e *MissingWAFParamsError) Error() string {
+	return fmt.Sprintf("decision plugin %s requires missing waf params: %s", e.DecisionPlugin, strings.Join(e.Missing, ", "))
+}
+
+// wafRequirements returns the sorted union of the wafParams keys
+// required in the configuration and declared by the plugin in its
+// exported WAFRequirements string slice variable or function
+func wafRequirements(configured []string, tp *plugin.Plugin) []string {
+	required := append([]string(nil), configured...)
+	if tp != nil {
+		if sym, err := tp.Lookup("WAFRequirements"); err == nil {
+			switch v := sym.(type) {
+			case *[]string:
+				required = append(required, *v...)
+			case func() []string:
+				required = append(required, v()...)
+			}
+		}
+	}
+	sort.Strings(required)
+	unique := required[:0]
+	for i, key := range required {
+		if i == 0 || key != required[i-1] {
+			unique = append(unique, key)
+		}
+	}
+	return unique
+}
+
+// missingWAFParams returns the required keys absent from wafParams
+func missingWAFParams(required []string, wafParams map[string]string) []string {
+	var missing []string
+	for _, key := range required {
+		if _, ok := wafParams[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// WAFRequirements returns the wafParams keys required by the decision
+// plugin
+func (p *PluginManager) WAFRequirements(decisionId string) []string {
+	p.plugins.RLock()
+	defer p.plugins.RUnlock()
+	return append([]string(nil), p.wafRequirements[decisionId]...)
+}
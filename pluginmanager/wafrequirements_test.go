@@ -0,0 +1,28 @@
+package pluginmanager
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWAFRequirements(t *testing.T) {
+	if required := wafRequirements([]string{"inbound_detection", "SQLI", "SQLI"}, nil); strings.Join(required, ",") != "SQLI,inbound_detection" {
+		t.Errorf("requirements are %v", required)
+	}
+
+	p := &PluginManager{
+		decisionCheckFunc: map[string]func(DecisionInput) (DecisionResult, error){
+			"simple": func(DecisionInput) (DecisionResult, error) { return DecisionResult{}, nil },
+		},
+		wafRequirements: map[string][]string{"simple": {"SQLI", "inbound_detection"}},
+	}
+	_, err := p.CheckResultDetailed("transaction", "simple", map[string]string{"SQLI": "0"})
+	var missingErr *MissingWAFParamsError
+	if !errors.As(err, &missingErr) {
+		t.Fatalf("missing waf params not reported: %v", err)
+	}
+	if missingErr.DecisionPlugin != "simple" || len(missingErr.Missing) != 1 || missingErr.Missing[0] != "inbound_detection" {
+		t.Errorf("unexpected error %+v", missingErr)
+	}
+}
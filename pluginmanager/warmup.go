@@ -0,0 +1,96 @@
+package pluginmanager
+
+import (
+	"fmt"
+	"plugin"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// warmups are the plugins still running their Warmup function
+type warmups struct {
+	mutex   sync.Mutex
+	pending map[string]bool
+}
+
+// warmupFunc returns the Warmup function exported by the plugin, a
+// func() or a func() error, or nil if it exports none
+func warmupFunc(tp *plugin.Plugin) func() error {
+	if tp == nil {
+		return nil
+	}
+	sym, err := tp.Lookup("Warmup")
+	if err != nil {
+		return nil
+	}
+	switch fn := sym.(type) {
+	case func() error:
+		return fn
+	case func():
+		return func() error {
+			fn()
+			return nil
+		}
+	}
+	lg.Get().Printf(lg.WARN, "invalid Warmup function type %T, not called", sym)
+	return nil
+}
+
+// startWarmups calls concurrently the Warmup function exported by the
+// loaded plugins, if any
+func (p *PluginManager) startWarmups() {
+	for _, id := range p.ModelPluginIDs() {
+		p.warmUp(ModelPluginKind, id, warmupFunc(p.modelPlugins[id].p))
+	}
+	for _, id := range p.DecisionPluginIDs() {
+		p.warmUp(DecisionPluginKind, id, warmupFunc(p.decisionPlugins[id].p))
+	}
+}
+
+// warmUp calls the Warmup function fn of a plugin in the background,
+// keeping the plugin manager unready until it returns. A plugin whose
+// warm-up fails is logged and still used.
+func (p *PluginManager) warmUp(kind, id string, fn func() error) {
+	if fn == nil {
+		return
+	}
+	key := kind + " plugin " + id
+	p.warmup.mutex.Lock()
+	if p.warmup.pending == nil {
+		p.warmup.pending = make(map[string]bool)
+	}
+	p.warmup.pending[key] = true
+	p.warmup.mutex.Unlock()
+	go func() {
+		start := time.Now()
+		err := fn()
+		p.warmup.mutex.Lock()
+		delete(p.warmup.pending, key)
+		p.warmup.mutex.Unlock()
+		if err != nil {
+			lg.Get().Printf(lg.WARN, "| %s | %s plugin warm-up failed: %v", id, kind, err)
+			return
+		}
+		lg.Get().Printf(lg.INFO, "| %s | %s plugin warmed up in %v", id, kind, time.Since(start))
+	}()
+}
+
+// warmingUp returns an error listing the plugins still warming up, if
+// any
+func (p *PluginManager) warmingUp() error {
+	p.warmup.mutex.Lock()
+	defer p.warmup.mutex.Unlock()
+	if len(p.warmup.pending) == 0 {
+		return nil
+	}
+	pending := make([]string, 0, len(p.warmup.pending))
+	for key := range p.warmup.pending {
+		pending = append(pending, key)
+	}
+	sort.Strings(pending)
+	return fmt.Errorf("plugins warming up: %s", strings.Join(pending, ", "))
+}
@@ -0,0 +1,33 @@
+package pluginmanager
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWarmup(t *testing.T) {
+	p := &PluginManager{}
+	release := make(chan struct{})
+	p.warmUp(ModelPluginKind, "embeddings", func() error {
+		<-release
+		return nil
+	})
+	p.warmUp(DecisionPluginKind, "broken", func() error { return errors.New("no GPU") })
+	p.warmUp(ModelPluginKind, "cold", nil)
+
+	err := p.Ready()
+	if err == nil || !strings.Contains(err.Error(), "model plugin embeddings") || strings.Contains(err.Error(), "cold") {
+		t.Errorf("Ready during the warm-up returned %v", err)
+	}
+	close(release)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if err = p.Ready(); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Errorf("Ready after the warm-up returned %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package pluginmanager
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// WorkerProtocolVersion is the version of the protocol between WACE and
+// the remote model workers over NATS. It is sent in the
+// WorkerProtocolHeader of every message, and bumped on incompatible
+// changes of the subjects or messages.
+const WorkerProtocolVersion = "1"
+
+// WorkerProtocolHeader is the NATS header carrying the protocol version.
+// The messages without it are taken as of the current version.
+const WorkerProtocolHeader = "Wace-Protocol-Version"
+
+// ModelSubject returns the NATS subject where WACE publishes the
+// ModelInput messages of the model
+func ModelSubject(modelId string) string {
+	return modelId
+}
+
+// ModelResultsSubject returns the NATS subject where the workers of the
+// model publish its ModelTransmitionResults messages
+func ModelResultsSubject(modelId string) string {
+	return modelId + "/results"
+}
+
+// WorkerError is the error reported by a remote model worker, which is
+// transmitted as its message
+type WorkerError struct {
+	Message string
+}
+
+func (e *WorkerError) Error() string {
+	return e.Message
+}
+
+// transmitionResults is the JSON encoding of ModelTransmitionResults,
+// with the error as its message
+type transmitionResults struct {
+	TransactionId string `json:"transactionId"`
+	ModelResults
+	Error json.RawMessage `json:"error"`
+}
+
+// MarshalJSON encodes the results with the error as its message, or
+// null if there is none
+func (r ModelTransmitionResults) MarshalJSON() ([]byte, error) {
+	wire := transmitionResults{TransactionId: r.TransactionId, ModelResults: r.ModelResults, Error: json.RawMessage("null")}
+	if r.Error != nil {
+		message, err := json.Marshal(r.Error.Error())
+		if err != nil {
+			return nil, err
+		}
+		wire.Error = message
+	}
+	return json.Marshal(wire)
+}
+
+// UnmarshalJSON decodes the results encoded by MarshalJSON, with the
+// error as a *WorkerError. The errors encoded as an object by the
+// workers built before the protocol was versioned, which lost their
+// message, are decoded too.
+func (r *ModelTransmitionResults) UnmarshalJSON(data []byte) error {
+	var wire transmitionResults
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	r.TransactionId, r.ModelResults, r.Error = wire.TransactionId, wire.ModelResults, nil
+	if len(wire.Error) == 0 || string(wire.Error) == "null" {
+		return nil
+	}
+	var message string
+	if err := json.Unmarshal(wire.Error, &message); err != nil {
+		message = "remote model error"
+	}
+	r.Error = &WorkerError{Message: message}
+	return nil
+}
+
+// NewWorkerMsg returns the NATS message with the data for the subject,
+// with the protocol version header
+func NewWorkerMsg(subject string, data []byte) *nats.Msg {
+	msg := nats.NewMsg(subject)
+	msg.Header.Set(WorkerProtocolHeader, WorkerProtocolVersion)
+	msg.Data = data
+	return msg
+}
+
+// CheckWorkerProtocol returns an error if the message is of another
+// version of the protocol
+func CheckWorkerProtocol(msg *nats.Msg) error {
+	if msg.Header == nil {
+		return nil
+	}
+	if version := msg.Header.Get(WorkerProtocolHeader); version != "" && version != WorkerProtocolVersion {
+		return fmt.Errorf("worker protocol version %s is not supported, expected %s", version, WorkerProtocolVersion)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package pluginmanager
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestTransmitionResultsJSON(t *testing.T) {
+	data, err := json.Marshal(ModelTransmitionResults{TransactionId: "tx", Error: errors.New("model failed")})
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+	var results ModelTransmitionResults
+	if err := json.Unmarshal(data, &results); err != nil {
+		t.Fatalf("Unmarshal returned error: %v", err)
+	}
+	var workerErr *WorkerError
+	if !errors.As(results.Error, &workerErr) || workerErr.Message != "model failed" || results.TransactionId != "tx" {
+		t.Errorf("results decoded as %+v", results)
+	}
+
+	data, _ = json.Marshal(&ModelTransmitionResults{TransactionId: "tx", ModelResults: ModelResults{ProbAttack: 0.5}})
+	results = ModelTransmitionResults{}
+	if err := json.Unmarshal(data, &results); err != nil || results.Error != nil || results.ProbAttack != 0.5 {
+		t.Errorf("results without error decoded as %+v, %v", results, err)
+	}
+
+	// the errors of the workers built before the protocol was
+	// versioned are encoded as empty objects
+	if err := json.Unmarshal([]byte(`{"transactionId":"tx","probattack":0,"error":{}}`), &results); err != nil || results.Error == nil {
+		t.Errorf("legacy error decoded as %+v, %v", results, err)
+	}
+}
+
+func TestCheckWorkerProtocol(t *testing.T) {
+	if err := CheckWorkerProtocol(&nats.Msg{}); err != nil {
+		t.Errorf("message without version returned error: %v", err)
+	}
+	if err := CheckWorkerProtocol(NewWorkerMsg("m", nil)); err != nil {
+		t.Errorf("message of the current version returned error: %v", err)
+	}
+	msg := NewWorkerMsg("m", nil)
+	msg.Header.Set(WorkerProtocolHeader, "0")
+	if err := CheckWorkerProtocol(msg); err == nil {
+		t.Errorf("message of another version does not return error")
+	}
+}
+
+func TestAddToQueueWithoutNATS(t *testing.T) {
+	p := &PluginManager{}
+	if err := p.AddToQueue("remote", "tx", "GET / HTTP/1.1\n"); err == nil {
+		t.Errorf("AddToQueue without NATS connection does not return error")
+	}
+}
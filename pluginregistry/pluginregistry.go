@@ -0,0 +1,59 @@
+/*
+Package pluginregistry compiles model and decision plugins into the
+binary, for the platforms where Go plugins cannot be loaded with
+plugin.Open, such as macOS and Windows, or for static builds.
+
+A plugin registers itself by name from the init function of its
+package:
+
+	func init() {
+		pluginregistry.RegisterModel("mymodel", InitPlugin, Process)
+	}
+
+and is selected in the configuration with kind builtin:
+
+	modelplugins:
+	  - id: mymodel
+	    kind: builtin
+	    builtin: mymodel
+	    plugintype: RequestHeaders
+
+The builtin name defaults to the plugin ID. The init function, if not
+nil, is called with the params of every plugin using the registered
+one, when it is loaded.
+*/
+package pluginregistry
+
+import (
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// InitFunc initializes a plugin with its params, as the InitPlugin
+// function of a shared object plugin
+type InitFunc func(params map[string]string, meter metric.Meter) error
+
+// ProcessFunc analyzes the input of a model plugin
+type ProcessFunc func(pm.ModelInput) (pm.ModelResults, error)
+
+// CheckFunc decides on a transaction from the results of the models
+type CheckFunc func(pm.DecisionInput) (pm.DecisionResult, error)
+
+// RegisterModel registers the model plugin of the given name. It
+// panics if process is nil or the name is already used by a built-in
+// or registered model.
+func RegisterModel(name string, init InitFunc, process ProcessFunc) {
+	if err := pm.RegisterModel(name, init, process); err != nil {
+		panic("pluginregistry: " + err.Error())
+	}
+}
+
+// RegisterDecision registers the decision plugin of the given name. It
+// panics if checkResults is nil or the name is already used by a
+// built-in or registered decision.
+func RegisterDecision(name string, init InitFunc, checkResults CheckFunc) {
+	if err := pm.RegisterDecision(name, init, checkResults); err != nil {
+		panic("pluginregistry: " + err.Error())
+	}
+}
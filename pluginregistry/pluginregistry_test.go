@@ -0,0 +1,73 @@
+package pluginregistry
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"go.opentelemetry.io/otel/metric/noop"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	RegisterModel("compiled", nil, func(input pm.ModelInput) (pm.ModelResults, error) {
+		return pm.ModelResults{ProbAttack: 0.9}, nil
+	})
+	RegisterDecision("compiledthreshold", nil, func(input pm.DecisionInput) (pm.DecisionResult, error) {
+		return pm.DecisionResult{Block: input.Results["compiled"].ProbAttack > 0.5}, nil
+	})
+}
+
+func TestRegisteredPlugins(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: compiled
+    kind: builtin
+    plugintype: RequestHeaders
+decisionplugins:
+  - id: decision
+    kind: builtin
+    builtin: compiledthreshold
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	p := pm.NewWithConfig(noop.NewMeterProvider().Meter("pluginregistry"), conf)
+	for _, event := range p.LoadReport() {
+		if event.Status != pm.PluginLoaded {
+			t.Fatalf("plugin %s not loaded: %s", event.ID, event.Reason)
+		}
+	}
+
+	p.InitTransaction("tx-1")
+	defer p.CloseTransaction("tx-1")
+	status := make(chan pm.ModelStatus, 1)
+	p.AddModelChannel("tx-1", cf.RequestHeaders, status, "sync")
+	p.Process("compiled", "tx-1", "GET / HTTP/1.1\n", cf.RequestHeaders, status)
+	if s := <-status; s.Err != nil || s.ProbAttack != 0.9 {
+		t.Errorf("registered model returned %v, %v", s.ProbAttack, s.Err)
+	}
+	block, err := p.CheckResult("tx-1", "decision", nil)
+	if err != nil || !block {
+		t.Errorf("registered decision returned %v, %v", block, err)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering a model twice does not panic")
+		}
+	}()
+	RegisterModel("compiled", nil, func(input pm.ModelInput) (pm.ModelResults, error) {
+		return pm.ModelResults{}, nil
+	})
+}
@@ -0,0 +1,114 @@
+package wace
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+	"go.opentelemetry.io/otel/metric"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// pluginSet is a plugin manager loaded by Init or NewCore, with the
+// transactions pinned to it, so that a reload does not change the
+// plugins of the transactions in progress. A set replaced by a reload
+// is shut down once its last transaction is closed.
+type pluginSet struct {
+	manager     *pm.PluginManager
+	instruments *pm.Instruments
+	// meter is the meter the plugins record their metrics with
+	meter metric.Meter
+	// started is the time the plugins were loaded
+	started time.Time
+	// open counts the transactions pinned to the set
+	open     atomic.Int64
+	retired  atomic.Bool
+	shutdown sync.Once
+}
+
+// newPluginSet creates the plugin set of the plugin manager loaded with
+// met
+func newPluginSet(manager *pm.PluginManager, met metric.Meter) *pluginSet {
+	return &pluginSet{manager: manager, instruments: manager.Instruments(), meter: met, started: time.Now()}
+}
+
+// pin pins a transaction to the current plugin set of the core, and
+// returns it, nil if the core has no plugins
+func (c *Core) pin() *pluginSet {
+	for {
+		set := c.plugins.Load()
+		if set == nil {
+			return nil
+		}
+		set.open.Add(1)
+		if !set.retired.Load() {
+			return set
+		}
+		// the set was replaced meanwhile
+		set.release()
+	}
+}
+
+// swap makes the new transactions of the core use the plugin set, and
+// retires the previous one
+func (c *Core) swap(set *pluginSet) {
+	if old := c.plugins.Swap(set); old != nil {
+		old.retire()
+	}
+}
+
+// pluginsOf returns the plugin set the transaction is pinned to, or the
+// current one of the core if the transaction is not open
+func (c *Core) pluginsOf(transactionID string) *pluginSet {
+	if value, ok := c.analysisMap.Load(transactionID); ok {
+		if set := value.(*transactionSync).plugins; set != nil {
+			return set
+		}
+	}
+	return c.plugins.Load()
+}
+
+// meter returns the meter the plugins of the core record their metrics
+// with, nil before they are loaded
+func (c *Core) meter() metric.Meter {
+	if set := c.plugins.Load(); set != nil {
+		return set.meter
+	}
+	return nil
+}
+
+// release unpins a transaction from the set, shutting the set down if
+// it was the last transaction of a retired set
+func (s *pluginSet) release() {
+	if s.open.Add(-1) == 0 && s.retired.Load() {
+		s.closeRetired()
+	}
+}
+
+// retire marks the set as replaced, shutting it down once its
+// transactions are closed
+func (s *pluginSet) retire() {
+	s.retired.Store(true)
+	if s.open.Load() == 0 {
+		s.closeRetired()
+	}
+}
+
+// closeRetired shuts down a retired set, logging the failures
+func (s *pluginSet) closeRetired() {
+	if err := s.close(); err != nil {
+		lg.Get().Printf(lg.WARN, "core | could not shut down the replaced plugins: %v", err)
+	}
+}
+
+// close shuts down the plugin manager of the set. Only the first call
+// has an effect.
+func (s *pluginSet) close() error {
+	var err error
+	s.shutdown.Do(func() {
+		err = s.manager.Shutdown()
+	})
+	return err
+}
@@ -0,0 +1,76 @@
+package wace
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestReloadPinsTransactions(t *testing.T) {
+	config := `---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: protocol
+    kind: builtin
+    plugintype: RequestHeaders
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`
+	if err := initilize([]byte(config)); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+	before := defaultCore.plugins.Load()
+	id := generateRandomID()
+	InitTransaction(id)
+
+	if err := Init(testMeter); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+	after := defaultCore.plugins.Load()
+	if after == before {
+		t.Fatalf("Init did not replace the plugins")
+	}
+	if defaultCore.pluginsOf(id) != before {
+		t.Errorf("transaction in progress moved to the new plugins")
+	}
+	if err := Analyze("RequestHeaders", id, "GET / HTTP/1.1\n", []string{"protocol"}); err != nil {
+		t.Errorf("Analyze returned error: %v", err)
+	}
+	if _, err := CheckTransactionVerdict(id, "combiner", nil); err != nil {
+		t.Errorf("CheckTransactionVerdict returned error: %v", err)
+	}
+	CloseTransaction(id)
+	before.shutdown.Do(func() {
+		t.Errorf("replaced plugins not shut down once their transactions closed")
+	})
+	if after.retired.Load() || after.open.Load() != 0 {
+		t.Errorf("current plugins retired %t with %d transactions", after.retired.Load(), after.open.Load())
+	}
+
+	// the transactions keep running across reloads
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				id := generateRandomID()
+				InitTransaction(id)
+				if err := Analyze("RequestHeaders", id, "GET / HTTP/1.1\n", []string{"protocol"}); err != nil {
+					t.Errorf("Analyze returned error: %v", err)
+				}
+				if _, err := CheckTransactionVerdict(id, "combiner", nil); err != nil {
+					t.Errorf("CheckTransactionVerdict returned error: %v", err)
+				}
+				CloseTransaction(id)
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		if err := Init(testMeter); err != nil {
+			t.Errorf("Init returned error: %v", err)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,177 @@
+/*
+Package protocol checks raw HTTP requests for protocol anomalies often
+used in request smuggling and evasion: conflicting Content-Length and
+Transfer-Encoding headers, invalid characters in the request line and
+extreme header counts or sizes. The checks are cheap and need no model.
+*/
+package protocol
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Names of the checks reported in anomalies
+const (
+	CheckRequestLine      = "request-line"
+	CheckLengthConflict   = "length-conflict"
+	CheckContentLength    = "content-length"
+	CheckTransferEncoding = "transfer-encoding"
+	CheckHeaderSyntax     = "header-syntax"
+	CheckHeaderCount      = "header-count"
+	CheckHeaderSize       = "header-size"
+)
+
+// Limits are the header extremes beyond which a request is anomalous
+type Limits struct {
+	MaxHeaders    int
+	MaxHeaderSize int
+}
+
+// DefaultLimits are the limits used when none are configured
+var DefaultLimits = Limits{MaxHeaders: 100, MaxHeaderSize: 8192}
+
+// Anomaly is a protocol violation found in a request
+type Anomaly struct {
+	// Check is the name of the check that found the anomaly
+	Check string
+	// Severity is the probability that a request with this anomaly is
+	// an attack
+	Severity float64
+	Detail   string
+}
+
+// Check returns the protocol anomalies of the request line and headers
+// of a raw request
+func Check(payload string, limits Limits) []Anomaly {
+	var anomalies []Anomaly
+	add := func(check string, severity float64, format string, args ...interface{}) {
+		anomalies = append(anomalies, Anomaly{Check: check, Severity: severity, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	lines := strings.Split(payload, "\n")
+	requestLine := strings.TrimSuffix(lines[0], "\r")
+	if detail := checkRequestLine(requestLine); detail != "" {
+		add(CheckRequestLine, 0.8, "%s", detail)
+	}
+
+	headers := 0
+	contentLengths := map[string]bool{}
+	transferEncoding := ""
+	for _, line := range lines[1:] {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			break
+		}
+		headers++
+		if limits.MaxHeaderSize > 0 && len(line) > limits.MaxHeaderSize {
+			add(CheckHeaderSize, 0.5, "header of %d bytes", len(line))
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			add(CheckHeaderSyntax, 0.6, "obsolete line folding")
+			continue
+		}
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			add(CheckHeaderSyntax, 0.6, "header without colon")
+			continue
+		}
+		if name != strings.TrimSpace(name) || !isToken(name) {
+			add(CheckHeaderSyntax, 0.8, "invalid header name %q", name)
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(name) {
+		case "content-length":
+			if _, err := strconv.ParseUint(value, 10, 63); err != nil {
+				add(CheckContentLength, 0.7, "invalid content length %q", value)
+			}
+			contentLengths[value] = true
+		case "transfer-encoding":
+			if transferEncoding != "" {
+				transferEncoding += ","
+			}
+			transferEncoding += value
+		}
+	}
+	if limits.MaxHeaders > 0 && headers > limits.MaxHeaders {
+		add(CheckHeaderCount, 0.5, "%d headers", headers)
+	}
+	if len(contentLengths) > 1 {
+		add(CheckLengthConflict, 0.9, "conflicting content lengths")
+	}
+	if transferEncoding != "" {
+		if len(contentLengths) > 0 {
+			add(CheckLengthConflict, 0.9, "both content length and transfer encoding")
+		}
+		if !strings.EqualFold(transferEncoding, "chunked") {
+			add(CheckTransferEncoding, 0.7, "transfer encoding %q", transferEncoding)
+		}
+	}
+	return anomalies
+}
+
+// checkRequestLine returns what is wrong with the request line, or an
+// empty string if it is valid
+func checkRequestLine(line string) string {
+	for i := 0; i < len(line); i++ {
+		if line[i] < 0x20 || line[i] > 0x7e {
+			return fmt.Sprintf("invalid character 0x%02x in request line", line[i])
+		}
+	}
+	parts := strings.Split(line, " ")
+	if len(parts) != 3 {
+		return "request line does not have three parts"
+	}
+	if !isToken(parts[0]) {
+		return fmt.Sprintf("invalid method %q", parts[0])
+	}
+	if parts[1] == "" {
+		return "empty request target"
+	}
+	if parts[2] != "HTTP/1.0" && parts[2] != "HTTP/1.1" && parts[2] != "HTTP/2" && parts[2] != "HTTP/2.0" {
+		return fmt.Sprintf("invalid version %q", parts[2])
+	}
+	return ""
+}
+
+// isToken returns true if s is a non-empty HTTP token
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= 0x20 || c >= 0x7f || strings.IndexByte(`"(),/:;<=>?@[\]{}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Score combines the severities of the anomalies into the probability
+// that the request is an attack, treating them as independent
+// evidence. A request without anomalies scores 0.
+func Score(anomalies []Anomaly) float64 {
+	benign := 1.0
+	for _, a := range anomalies {
+		benign *= 1 - a.Severity
+	}
+	return 1 - benign
+}
+
+// Checks returns the sorted names of the checks that found anomalies
+func Checks(anomalies []Anomaly) []string {
+	seen := make(map[string]bool)
+	var checks []string
+	for _, a := range anomalies {
+		if !seen[a.Check] {
+			seen[a.Check] = true
+			checks = append(checks, a.Check)
+		}
+	}
+	sort.Strings(checks)
+	return checks
+}
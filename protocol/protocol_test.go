@@ -0,0 +1,43 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		checks  []string
+	}{
+		{"valid", "POST /login HTTP/1.1\r\nHost: example.com\r\nContent-Length: 8\r\n\r\nuser=bob", nil},
+		{"chunked", "POST / HTTP/1.1\nTransfer-Encoding: chunked\n", nil},
+		{"cl.te", "POST / HTTP/1.1\nContent-Length: 4\nTransfer-Encoding: chunked\n", []string{CheckLengthConflict}},
+		{"cl.cl", "POST / HTTP/1.1\nContent-Length: 4\nContent-Length: 6\n", []string{CheckLengthConflict}},
+		{"obfuscated te", "POST / HTTP/1.1\nTransfer-Encoding: xchunked\n", []string{CheckTransferEncoding}},
+		{"space before colon", "POST / HTTP/1.1\nTransfer-Encoding : chunked\n", []string{CheckHeaderSyntax}},
+		{"invalid length", "POST / HTTP/1.1\nContent-Length: -1\n", []string{CheckContentLength}},
+		{"request line", "GET /a b HTTP/1.1\n", []string{CheckRequestLine}},
+		{"control character", "GET /\x00 HTTP/1.1\n", []string{CheckRequestLine}},
+		{"header count", "GET / HTTP/1.1\n" + strings.Repeat("X-A: 1\n", 4), []string{CheckHeaderCount}},
+		{"header size", "GET / HTTP/1.1\nX-A: " + strings.Repeat("a", 64) + "\n", []string{CheckHeaderSize}},
+	}
+	limits := Limits{MaxHeaders: 3, MaxHeaderSize: 32}
+	for _, test := range tests {
+		checks := Checks(Check(test.payload, limits))
+		if strings.Join(checks, ",") != strings.Join(test.checks, ",") {
+			t.Errorf("%s: checks %v, expected %v", test.name, checks, test.checks)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	if score := Score(nil); score != 0 {
+		t.Errorf("score without anomalies is %v", score)
+	}
+	score := Score([]Anomaly{{Severity: 0.5}, {Severity: 0.5}})
+	if score != 0.75 {
+		t.Errorf("score of two anomalies is %v, expected 0.75", score)
+	}
+}
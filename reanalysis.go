@@ -0,0 +1,266 @@
+package wace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"go.opentelemetry.io/otel/metric"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// reanalysisKeyPrefix prefixes the state store keys of the allowed
+// transactions kept for re-analysis
+const reanalysisKeyPrefix = "reanalysis/"
+
+// webhookTimeout bounds the delivery of a retro-detection to the webhook
+const webhookTimeout = 10 * time.Second
+
+// ReanalysisPart is a part of a transaction given to Analyze
+type ReanalysisPart struct {
+	Type    string
+	Payload string
+}
+
+// ReanalysisRecord is an allowed transaction kept for re-analysis
+type ReanalysisRecord struct {
+	TransactionID string
+	AllowedAt     time.Time
+	Parts         []ReanalysisPart
+	Metadata      map[string]string
+}
+
+// RetroDetection reports an allowed transaction found to be an attack
+// by the heavyweight models on re-analysis
+type RetroDetection struct {
+	TransactionID string
+	AllowedAt     time.Time
+	DetectedAt    time.Time
+	Scores        map[string]float64
+	Metadata      map[string]string
+}
+
+// retainedParts guards the parts of a sampled transaction
+type retainedParts struct {
+	mutex     sync.Mutex
+	parts     []ReanalysisPart
+	persisted bool
+}
+
+// sampledForReanalysis deterministically samples transactions by the
+// hash of their ID
+func sampledForReanalysis(transactionID string, rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(transactionID))
+	return float64(h.Sum32())/float64(^uint32(0)) < rate
+}
+
+// retainForReanalysis keeps the part of a sampled transaction until it
+// is checked
+func (c *Core) retainForReanalysis(transactionID, modelsType, payload string) {
+	if !sampledForReanalysis(transactionID, c.config().Reanalysis.SampleRate) {
+		return
+	}
+	value, _ := c.retainedMap.LoadOrStore(transactionID, &retainedParts{})
+	retained := value.(*retainedParts)
+	retained.mutex.Lock()
+	retained.parts = append(retained.parts, ReanalysisPart{Type: modelsType, Payload: payload})
+	retained.mutex.Unlock()
+}
+
+// persistForReanalysis stores an allowed sampled transaction in the
+// state store to be re-analyzed by the background job, with the values
+// of the sensitive headers and parameters redacted
+func (c *Core) persistForReanalysis(transactionID string) {
+	value, ok := c.retainedMap.Load(transactionID)
+	if !ok {
+		return
+	}
+	retained := value.(*retainedParts)
+	retained.mutex.Lock()
+	defer retained.mutex.Unlock()
+	if retained.persisted {
+		return
+	}
+	redact := c.config().Reanalysis.Redact
+	parts := make([]ReanalysisPart, len(retained.parts))
+	for i, part := range retained.parts {
+		parts[i] = ReanalysisPart{Type: part.Type, Payload: redactPayload(part.Payload, redact)}
+	}
+	record := ReanalysisRecord{
+		TransactionID: transactionID,
+		AllowedAt:     time.Now(),
+		Parts:         parts,
+		Metadata:      c.TransactionMetadata(transactionID),
+	}
+	data, err := json.Marshal(record)
+	if err == nil {
+		err = c.stateStore().Set(reanalysisKeyPrefix+transactionID, data, c.config().Reanalysis.TTL)
+	}
+	if err != nil {
+		c.tprintf(lg.WARN, transactionID, "core | could not keep transaction for re-analysis: %v", err)
+		return
+	}
+	retained.persisted = true
+	c.tprintf(lg.DEBUG, transactionID, "core | transaction kept for re-analysis")
+}
+
+// startReanalysis starts the background re-analysis job if enabled,
+// stopping the previous one
+func (c *Core) startReanalysis() {
+	if c.reanalysisStop != nil {
+		close(c.reanalysisStop)
+		c.reanalysisStop = nil
+	}
+	conf := c.config().Reanalysis
+	if conf.SampleRate <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	c.reanalysisStop = stop
+	go func() {
+		ticker := time.NewTicker(conf.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				c.RunReanalysis()
+			}
+		}
+	}()
+	lg.Get().Printf(lg.INFO, "Re-analysis of %.2f%% of the allowed transactions every %v", conf.SampleRate*100, conf.Interval)
+}
+
+// RunReanalysis re-analyzes the allowed transactions kept in the state
+// store with the re-analysis models, and publishes a retro-detection
+// for each of them scoring above the threshold. It returns the
+// detections. It is run periodically by the background job.
+func RunReanalysis() []RetroDetection {
+	return defaultCore.RunReanalysis()
+}
+
+// RunReanalysis is like the RunReanalysis function
+func (c *Core) RunReanalysis() []RetroDetection {
+	logger := lg.Get()
+	s := c.stateStore()
+	keys, err := s.Keys(reanalysisKeyPrefix)
+	if err != nil {
+		logger.Printf(lg.WARN, "core | could not list transactions to re-analyze: %v", err)
+		return nil
+	}
+	var detections []RetroDetection
+	for _, key := range keys {
+		data, found, err := s.Get(key)
+		s.Delete(key)
+		if err != nil || !found {
+			continue
+		}
+		var record ReanalysisRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			logger.Printf(lg.WARN, "core | invalid re-analysis record %s: %v", key, err)
+			continue
+		}
+		if detection, ok := c.reanalyze(record); ok {
+			c.publishRetroDetection(detection)
+			detections = append(detections, detection)
+		}
+	}
+	return detections
+}
+
+// reanalyze runs the record through the re-analysis models and returns
+// a detection if any of them scores above the threshold
+func (c *Core) reanalyze(record ReanalysisRecord) (RetroDetection, bool) {
+	conf := c.config()
+	transactionID := "reanalysis-" + record.TransactionID
+	c.InitTransaction(transactionID)
+	defer c.CloseTransaction(transactionID)
+
+	for _, part := range record.Parts {
+		partType, err := cf.StringToPluginType(part.Type)
+		if err != nil {
+			continue
+		}
+		var models []string
+		for _, id := range conf.Reanalysis.Models {
+			if conf.ModelPlugins[id].PluginType == partType {
+				models = append(models, id)
+			}
+		}
+		c.Analyze(part.Type, transactionID, part.Payload, models)
+	}
+	if err := c.waitAnalysis(transactionID); err != nil {
+		return RetroDetection{}, false
+	}
+	results, err := c.pluginsOf(transactionID).manager.TransactionResults(c.scope(transactionID))
+	if err != nil {
+		return RetroDetection{}, false
+	}
+
+	detection := RetroDetection{
+		TransactionID: c.scope(record.TransactionID),
+		AllowedAt:     record.AllowedAt,
+		DetectedAt:    time.Now(),
+		Scores:        make(map[string]float64, len(results)),
+		Metadata:      record.Metadata,
+	}
+	detected := false
+	for id, res := range results {
+		detection.Scores[id] = res.ProbAttack
+		if res.ProbAttack >= conf.Reanalysis.Threshold {
+			detected = true
+		}
+	}
+	return detection, detected
+}
+
+// publishRetroDetection sends the detection to the configured NATS
+// subject and webhook
+func (c *Core) publishRetroDetection(detection RetroDetection) {
+	logger := lg.Get()
+	conf := c.config().Reanalysis
+	data, err := json.Marshal(detection)
+	if err != nil {
+		return
+	}
+	logger.Printf(lg.WARN, "| %s | core | retro-detection of allowed transaction: %v", detection.TransactionID, detection.Scores)
+	if counter, err := c.plugins.Load().instruments.Int64Counter("wace.reanalysis.detected.total", metric.WithDescription("Number of allowed transactions detected on re-analysis")); err == nil {
+		counter.Add(ctx, 1, metric.WithAttributes(c.attributes...))
+	}
+	if conf.NatsSubject != "" {
+		if err := c.plugins.Load().manager.Publish(conf.NatsSubject, data); err != nil {
+			logger.Printf(lg.WARN, "core | could not publish retro-detection to %s: %v", conf.NatsSubject, err)
+		}
+	}
+	if conf.Webhook != "" {
+		if err := postJSON(conf.Webhook, data); err != nil {
+			logger.Printf(lg.WARN, "core | could not post retro-detection: %v", err)
+		}
+	}
+}
+
+// postJSON posts data to the url as JSON
+func postJSON(url string, data []byte) error {
+	client := http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", strings.SplitN(url, "?", 2)[0], resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package wace
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"github.com/tiroa-tilsor/wacelib/statestore"
+)
+
+func TestSampledForReanalysis(t *testing.T) {
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		id := generateRandomID()
+		if sampledForReanalysis(id, 0.1) {
+			sampled++
+		}
+		if sampledForReanalysis(id, 0) {
+			t.Fatalf("transaction sampled with rate 0")
+		}
+		if !sampledForReanalysis(id, 1) {
+			t.Fatalf("transaction not sampled with rate 1")
+		}
+	}
+	if sampled < 50 || sampled > 150 {
+		t.Errorf("%d of 1000 transactions sampled with rate 0.1", sampled)
+	}
+}
+
+func TestPersistForReanalysis(t *testing.T) {
+	setReanalysis := func(re cf.ReanalysisConfig) {
+		cf.Update(func(conf *cf.ConfigStore) error {
+			conf.Reanalysis = re
+			return nil
+		})
+	}
+	setReanalysis(cf.ReanalysisConfig{SampleRate: 1, TTL: time.Hour, Redact: []string{"cookie", "password"}})
+	defer setReanalysis(cf.ReanalysisConfig{})
+	SetStateStore(statestore.NewMemory())
+
+	id := generateRandomID()
+	defer defaultCore.retainedMap.Delete(id)
+	defaultCore.retainForReanalysis(id, "RequestHeaders", "GET / HTTP/1.1\nCookie: session=s3cret\n")
+	defaultCore.retainForReanalysis(id, "RequestBody", "a=1&password=s3cret")
+	defaultCore.persistForReanalysis(id)
+	defaultCore.persistForReanalysis(id)
+
+	keys, _ := StateStore().Keys(reanalysisKeyPrefix)
+	if len(keys) != 1 {
+		t.Fatalf("state store has %d records, expected 1", len(keys))
+	}
+	data, _, _ := StateStore().Get(keys[0])
+	var record ReanalysisRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatalf("invalid record: %v", err)
+	}
+	if record.TransactionID != id || len(record.Parts) != 2 || record.Parts[1].Payload != "a=1&password="+redactedValue {
+		t.Errorf("unexpected record %+v", record)
+	}
+	if strings.Contains(string(data), "s3cret") {
+		t.Errorf("record keeps sensitive values: %s", data)
+	}
+
+	unsampled := generateRandomID()
+	defaultCore.persistForReanalysis(unsampled)
+	if keys, _ := StateStore().Keys(reanalysisKeyPrefix); len(keys) != 1 {
+		t.Errorf("transaction not retained was persisted")
+	}
+}
@@ -0,0 +1,101 @@
+package wace
+
+import (
+	"sort"
+	"sync"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// Receipt tracks the analysis started by an Analyze call, and reports
+// the further parts of the transaction that the models requested to
+// decide, so connectors can send them only when needed
+type Receipt struct {
+	done    chan struct{}
+	mutex   sync.Mutex
+	needed  []string
+	unknown []string
+}
+
+// newReceipt creates a receipt for an analysis in progress
+func newReceipt() *Receipt {
+	return &Receipt{done: make(chan struct{})}
+}
+
+// doneReceipt returns the receipt of an Analyze call that called no
+// model
+func doneReceipt() *Receipt {
+	r := newReceipt()
+	close(r.done)
+	return r
+}
+
+// Done returns a channel closed once the sync models called finish
+func (r *Receipt) Done() <-chan struct{} {
+	return r.done
+}
+
+// Wait waits for the sync models called to finish and returns the
+// parts they requested
+func (r *Receipt) Wait() []string {
+	<-r.done
+	return r.NeededParts()
+}
+
+// NeededParts returns the sorted plugin type names of the parts of the
+// transaction requested so far by the models called
+func (r *Receipt) NeededParts() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.needed...)
+}
+
+// UnknownModels returns the model IDs given to the Analyze call that
+// are not configured, whatever the unknown models policy
+func (r *Receipt) UnknownModels() []string {
+	return append([]string(nil), r.unknown...)
+}
+
+// need adds the parts requested by a model to the receipt of a
+// transaction of c, ignoring those that are not plugin types
+func (r *Receipt) need(c *Core, transactionID, modelID string, parts []string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, part := range parts {
+		t, err := cf.StringToPluginType(part)
+		if err != nil {
+			c.tprintf(lg.WARN, transactionID, "%s | requested unknown part %s", modelID, part)
+			continue
+		}
+		if !containsString(r.needed, t.String()) {
+			r.needed = append(r.needed, t.String())
+			c.tprintf(lg.DEBUG, transactionID, "%s | requested part %s", modelID, t)
+		}
+	}
+	sort.Strings(r.needed)
+}
+
+// finish marks the analysis as done, and calls the OnNeedParts
+// callback of the transaction of c if parts were requested
+func (r *Receipt) finish(c *Core, transactionID string) {
+	close(r.done)
+	needed := r.NeededParts()
+	if len(needed) == 0 {
+		return
+	}
+	if value, ok := c.needPartsCallbacks.Load(transactionID); ok {
+		go value.(func(string, []string))(transactionID, needed)
+	}
+}
+
+// containsString returns true if s is in list
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
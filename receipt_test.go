@@ -0,0 +1,40 @@
+package wace
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReceipt(t *testing.T) {
+	id := generateRandomID()
+	requested := make(chan []string, 1)
+	defaultCore.needPartsCallbacks.Store(id, func(transactionID string, parts []string) { requested <- parts })
+	defer defaultCore.needPartsCallbacks.Delete(id)
+
+	r := newReceipt()
+	r.need(defaultCore, id, "headers", []string{"requestbody", "Unknown"})
+	r.need(defaultCore, id, "other", []string{"RequestBody", "RequestHeaders"})
+	select {
+	case <-r.Done():
+		t.Fatalf("receipt done before the models finish")
+	default:
+	}
+	r.finish(defaultCore, id)
+
+	if parts := strings.Join(r.Wait(), ","); parts != "RequestBody,RequestHeaders" {
+		t.Errorf("needed parts are %s", parts)
+	}
+	select {
+	case parts := <-requested:
+		if len(parts) != 2 {
+			t.Errorf("callback called with %v", parts)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("callback not called")
+	}
+
+	if parts := doneReceipt().Wait(); len(parts) != 0 {
+		t.Errorf("receipt without models needs %v", parts)
+	}
+}
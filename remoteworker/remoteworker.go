@@ -0,0 +1,116 @@
+/*
+Package remoteworker serves a model to WACE as a remote worker over
+NATS, for the model plugins of kind worker or configured as remote.
+
+The protocol, in its version pluginmanager.WorkerProtocolVersion, is:
+
+  - WACE publishes a ModelInput JSON message on the subject of the model,
+    its ID (pluginmanager.ModelSubject).
+  - A worker of the model analyzes it and publishes a
+    ModelTransmitionResults JSON message, with the transactionId of the
+    input, on the results subject of the model, its ID followed by
+    /results (pluginmanager.ModelResultsSubject).
+  - If WACE sends the input as a request, for the models configured
+    with requestreply, the results are published on the reply subject
+    of the request instead.
+  - The error of a failed analysis is its message, as a string in the
+    error field of the results, which is null otherwise.
+  - Every message carries the protocol version in its
+    Wace-Protocol-Version header (pluginmanager.WorkerProtocolHeader).
+    A message without it is taken as of the current version.
+
+The workers of a same model subscribe in the QueueGroup, so that each
+input is analyzed by only one of them. The JSON Schema of the messages,
+for workers written in other languages such as Python, is in
+schema.json, also available as Schema.
+*/
+package remoteworker
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"github.com/nats-io/nats.go"
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// QueueGroup is the NATS queue group of the workers of a model
+const QueueGroup = "wace-workers"
+
+// Schema is the JSON Schema of the messages of the protocol
+//
+//go:embed schema.json
+var Schema []byte
+
+// Serve subscribes process to the subject of the model on the NATS
+// connection, publishing its results. It returns the subscription,
+// which stops serving when drained or unsubscribed.
+func Serve(nc *nats.Conn, modelId string, process func(pm.ModelInput) (pm.ModelResults, error)) (*nats.Subscription, error) {
+	return nc.QueueSubscribe(pm.ModelSubject(modelId), QueueGroup, func(msg *nats.Msg) {
+		go func() {
+			results := respond(modelId, msg, process)
+			if results == nil {
+				return
+			}
+			if err := nc.PublishMsg(results); err != nil {
+				lg.Get().Printf(lg.ERROR, "Model: %s | Failed to publish results | %v", modelId, err)
+			}
+		}()
+	})
+}
+
+// Run connects to the NATS server at url and serves the model until
+// ctx is done
+func Run(ctx context.Context, url, modelId string, process func(pm.ModelInput) (pm.ModelResults, error)) error {
+	nc, err := nats.Connect(url)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+	if _, err := Serve(nc, modelId, process); err != nil {
+		return err
+	}
+	lg.Get().Printf(lg.INFO, "Model: %s | Serving on subject %s", modelId, pm.ModelSubject(modelId))
+	<-ctx.Done()
+	return nc.Drain()
+}
+
+// respond analyzes the input message with process and returns the
+// results message, on the reply subject of the message if it is a
+// request, or nil if the input cannot be decoded. The errors
+// and panics of process are reported in the results.
+func respond(modelId string, msg *nats.Msg, process func(pm.ModelInput) (pm.ModelResults, error)) *nats.Msg {
+	var input pm.ModelInput
+	if err := json.Unmarshal(msg.Data, &input); err != nil {
+		lg.Get().Printf(lg.ERROR, "Model: %s | Failed to parse JSON payload | %v", modelId, err)
+		return nil
+	}
+	results := pm.ModelTransmitionResults{TransactionId: input.TransactionId}
+	if results.Error = pm.CheckWorkerProtocol(msg); results.Error == nil {
+		results.ModelResults, results.Error = safeProcess(process, input)
+	}
+	data, err := json.Marshal(results)
+	if err != nil {
+		lg.Get().Printf(lg.ERROR, "Model: %s | Failed to encode results | %v", modelId, err)
+		data, _ = json.Marshal(pm.ModelTransmitionResults{TransactionId: input.TransactionId, Error: err})
+	}
+	subject := pm.ModelResultsSubject(modelId)
+	if msg.Reply != "" {
+		subject = msg.Reply
+	}
+	return pm.NewWorkerMsg(subject, data)
+}
+
+// safeProcess calls process, turning its panics into errors
+func safeProcess(process func(pm.ModelInput) (pm.ModelResults, error), input pm.ModelInput) (res pm.ModelResults, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			res, err = pm.ModelResults{}, fmt.Errorf("model panicked: %v", r)
+		}
+	}()
+	return process(input)
+}
@@ -0,0 +1,114 @@
+package remoteworker
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/tiroa-tilsor/wacelib/bot"
+	"github.com/tiroa-tilsor/wacelib/geoip"
+	"github.com/tiroa-tilsor/wacelib/httpmsg"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"github.com/nats-io/nats.go"
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+func TestMain(m *testing.M) {
+	lg.Get().LoadLoggerWriter(io.Discard, lg.ERROR)
+	os.Exit(m.Run())
+}
+
+func TestRespond(t *testing.T) {
+	process := func(input pm.ModelInput) (pm.ModelResults, error) {
+		switch input.Payload {
+		case "fail":
+			return pm.ModelResults{}, errors.New("model failed")
+		case "panic":
+			panic("model bug")
+		}
+		return pm.ModelResults{ProbAttack: 0.8, Data: map[string]interface{}{"payload": input.Payload}}, nil
+	}
+	call := func(payload, version string) pm.ModelTransmitionResults {
+		t.Helper()
+		data, _ := json.Marshal(pm.ModelInput{TransactionId: "tx-" + payload, Payload: payload})
+		msg := pm.NewWorkerMsg(pm.ModelSubject("roberta"), data)
+		if version != "" {
+			msg.Header.Set(pm.WorkerProtocolHeader, version)
+		}
+		reply := respond("roberta", msg, process)
+		if reply == nil || reply.Subject != "roberta/results" || reply.Header.Get(pm.WorkerProtocolHeader) != pm.WorkerProtocolVersion {
+			t.Fatalf("unexpected reply %+v", reply)
+		}
+		var results pm.ModelTransmitionResults
+		if err := json.Unmarshal(reply.Data, &results); err != nil {
+			t.Fatalf("could not decode the results: %v", err)
+		}
+		if results.TransactionId != "tx-"+payload {
+			t.Errorf("results of transaction %s, want tx-%s", results.TransactionId, payload)
+		}
+		return results
+	}
+
+	if results := call("ok", ""); results.Error != nil || results.ProbAttack != 0.8 || results.Data["payload"] != "ok" {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if results := call("fail", ""); results.Error == nil || results.Error.Error() != "model failed" {
+		t.Errorf("error of the model transmitted as %v", results.Error)
+	}
+	if results := call("panic", ""); results.Error == nil {
+		t.Errorf("panic of the model not reported")
+	}
+	if results := call("ok", "2"); results.Error == nil {
+		t.Errorf("unsupported protocol version not reported")
+	}
+	if reply := respond("roberta", &nats.Msg{Data: []byte("not json")}, process); reply != nil {
+		t.Errorf("invalid input answered with %+v", reply)
+	}
+
+	data, _ := json.Marshal(pm.ModelInput{TransactionId: "tx-request", Payload: "ok"})
+	msg := pm.NewWorkerMsg(pm.ModelSubject("roberta"), data)
+	msg.Reply = "_INBOX.request"
+	if reply := respond("roberta", msg, process); reply == nil || reply.Subject != "_INBOX.request" {
+		t.Errorf("request answered with %+v, want the reply subject", reply)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	var schema struct {
+		Defs map[string]struct {
+			Properties map[string]json.RawMessage
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(Schema, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	uncertainty := 0.1
+	messages := map[string]interface{}{
+		"ModelInput": pm.ModelInput{
+			Signals:  &bot.Signals{},
+			Geo:      &geoip.Location{},
+			Message:  &httpmsg.Message{},
+			Scratch:  pm.NewScratch(),
+			Metadata: map[string]string{"client.ip": "192.0.2.1"},
+		},
+		"ModelTransmitionResults": pm.ModelTransmitionResults{ModelResults: pm.ModelResults{
+			Categories:  map[pm.AttackCategory]float64{pm.CategorySQLi: 1},
+			Uncertainty: &uncertainty,
+			NeedParts:   []string{"RequestBody"},
+			Shared:      map[string]interface{}{"tokens": 3},
+		}},
+	}
+	for name, message := range messages {
+		data, _ := json.Marshal(message)
+		var fields map[string]json.RawMessage
+		json.Unmarshal(data, &fields)
+		for field := range fields {
+			if _, ok := schema.Defs[name].Properties[field]; !ok {
+				t.Errorf("field %s of %s missing from the schema", field, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package wace
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// rescoredModels guards the IDs of the re-scored models of a
+// transaction
+type rescoredModels struct {
+	mutex  sync.Mutex
+	models map[string]bool
+}
+
+// ReAnalyze analyzes again a part of the transaction with the given
+// models, once the connector transformed its payload, e.g. decoded or
+// rewrote the body. The previous results of the models are discarded
+// before they are called, so the checks get the results of the
+// transformed payload instead of both, and the models are reported as
+// re-scored in the results of the transaction and its audit event. The
+// part retained for re-analysis, if any, is replaced too. The previous
+// analysis by the models should be finished, as once the transaction is
+// checked, or its late results would replace the new ones.
+func ReAnalyze(transactionID, part, payload string, models []string) error {
+	return coreOf(transactionID).ReAnalyze(transactionID, part, payload, models)
+}
+
+// ReAnalyze is like the ReAnalyze function
+func (c *Core) ReAnalyze(transactionID, part, payload string, models []string) error {
+	if err := c.checkOpen("ReAnalyze", transactionID); err != nil {
+		return err
+	}
+	modelsType, err := cf.StringToPluginType(part)
+	if err != nil {
+		c.tprintf(lg.ERROR, transactionID, "core | %s is not a valid type", part)
+		return err
+	}
+	models = c.resolveVersions(c.config(), transactionID, modelsType, models)
+	discarded := c.pluginsOf(transactionID).manager.DeleteTransactionResults(c.scope(transactionID), models)
+	c.tprintf(lg.INFO, transactionID, "core | re-scoring %s with [%s], replacing the results of [%s]", part, strings.Join(models, ", "), strings.Join(discarded, ", "))
+	c.markRescored(transactionID, models)
+	c.dropRetainedPart(transactionID, part)
+	return c.Analyze(part, transactionID, payload, models)
+}
+
+// markRescored records the models as re-scored in the transaction
+func (c *Core) markRescored(transactionID string, models []string) {
+	value, _ := c.rescoredMap.LoadOrStore(transactionID, &rescoredModels{models: make(map[string]bool)})
+	rescored := value.(*rescoredModels)
+	rescored.mutex.Lock()
+	defer rescored.mutex.Unlock()
+	for _, id := range models {
+		rescored.models[id] = true
+	}
+}
+
+// rescored returns the sorted IDs of the re-scored models of the
+// transaction
+func (c *Core) rescored(transactionID string) []string {
+	value, ok := c.rescoredMap.Load(transactionID)
+	if !ok {
+		return nil
+	}
+	rescored := value.(*rescoredModels)
+	rescored.mutex.Lock()
+	defer rescored.mutex.Unlock()
+	ids := make([]string, 0, len(rescored.models))
+	for id := range rescored.models {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// dropRetainedPart discards the parts of the given type retained for
+// re-analysis, to be replaced by the re-analyzed one
+func (c *Core) dropRetainedPart(transactionID, part string) {
+	value, ok := c.retainedMap.Load(transactionID)
+	if !ok {
+		return
+	}
+	retained := value.(*retainedParts)
+	retained.mutex.Lock()
+	defer retained.mutex.Unlock()
+	kept := retained.parts[:0]
+	for _, p := range retained.parts {
+		if p.Type != part {
+			kept = append(kept, p)
+		}
+	}
+	retained.parts = kept
+}
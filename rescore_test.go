@@ -0,0 +1,71 @@
+package wace
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestReAnalyze(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: protocol
+    kind: builtin
+    plugintype: RequestHeaders
+    weight: 1
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("rescore", conf, testMeter)
+	id := generateRandomID()
+	engine.InitTransaction(id)
+	defer CloseTransaction(id)
+
+	if err := Analyze("RequestHeaders", id, "GET / HTTP/1.1\nContent-Length: 1\nTransfer-Encoding: chunked\n", []string{"protocol"}); err != nil {
+		t.Fatalf("Analyze returned error: %v", err)
+	}
+	if _, err := CheckTransaction(id, "combiner", nil); err != nil {
+		t.Fatalf("CheckTransaction returned error: %v", err)
+	}
+	res, err := GetTransactionResults(id)
+	if err != nil || res.Results["protocol"].ProbAttack == 0 || len(res.Rescored) != 0 {
+		t.Fatalf("results before ReAnalyze are %+v, %v", res, err)
+	}
+
+	if err := ReAnalyze(id, "RequestHeaders", "GET / HTTP/1.1\nHost: example.com\n", []string{"protocol"}); err != nil {
+		t.Fatalf("ReAnalyze returned error: %v", err)
+	}
+	if _, err := CheckTransaction(id, "combiner", nil); err != nil {
+		t.Fatalf("CheckTransaction returned error: %v", err)
+	}
+	res, err = GetTransactionResults(id)
+	if err != nil {
+		t.Fatalf("GetTransactionResults returned error: %v", err)
+	}
+	if res.Results["protocol"].ProbAttack != 0 {
+		t.Errorf("results of the transformed part are %+v", res.Results["protocol"])
+	}
+	if len(res.Rescored) != 1 || res.Rescored[0] != "protocol" {
+		t.Errorf("re-scored models are %v", res.Rescored)
+	}
+
+	if err := ReAnalyze(id, "NotAPart", "", []string{"protocol"}); err == nil {
+		t.Errorf("ReAnalyze of an invalid part does not return error")
+	}
+	if err := ReAnalyze(generateRandomID(), "RequestHeaders", "", []string{"protocol"}); err == nil {
+		t.Errorf("ReAnalyze of an unknown transaction does not return error")
+	}
+}
@@ -0,0 +1,68 @@
+package wace
+
+import (
+	"fmt"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+)
+
+// TransactionResults are the model results collected for a transaction
+type TransactionResults struct {
+	// Results maps the ID of each model plugin that analyzed the
+	// transaction to its results
+	Results map[string]pm.ModelResults
+	// Weights maps the ID of each model plugin with results to its
+	// configured weight
+	Weights map[string]float64
+	// Rescored are the IDs of the model plugins whose results were
+	// replaced by ReAnalyze
+	Rescored []string
+}
+
+// GetTransactionResults returns a copy of the model results collected
+// so far for the given transaction and their weights, e.g. for the
+// connector to log the per-model scores in the WAF audit log. It does
+// not wait for the models still running: called after CheckTransaction,
+// it returns the results the decision was taken on. The Data of the
+// results is reduced to the keys allowed by the exposedata setting of
+// the models, like the evidence of the verdicts. It must be called
+// before CloseTransaction, which discards the results.
+func GetTransactionResults(transactionID string) (TransactionResults, error) {
+	return coreOf(transactionID).GetTransactionResults(transactionID)
+}
+
+// GetTransactionResults is like the GetTransactionResults function
+func (c *Core) GetTransactionResults(transactionID string) (TransactionResults, error) {
+	set := c.pluginsOf(transactionID)
+	if set == nil {
+		return TransactionResults{}, fmt.Errorf("wace is not initialized")
+	}
+	results, err := set.manager.TransactionResults(c.scope(transactionID))
+	if err != nil {
+		return TransactionResults{}, fmt.Errorf("transaction %s: %v", transactionID, err)
+	}
+	conf := c.config()
+	return TransactionResults{Results: exposedResults(conf, results), Weights: modelWeights(conf, results), Rescored: c.rescored(transactionID)}, nil
+}
+
+// exposedResults returns the results with their Data reduced to the
+// keys allowed by the exposedata setting of their models
+func exposedResults(conf *cf.ConfigStore, results map[string]pm.ModelResults) map[string]pm.ModelResults {
+	exposed := make(map[string]pm.ModelResults, len(results))
+	for modelID, res := range results {
+		data := res.Data
+		res.Data = nil
+		for key, value := range data {
+			if !conf.ExposesData(modelID, key) {
+				continue
+			}
+			if res.Data == nil {
+				res.Data = make(map[string]interface{})
+			}
+			res.Data[key] = value
+		}
+		exposed[modelID] = res
+	}
+	return exposed
+}
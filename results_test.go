@@ -0,0 +1,73 @@
+package wace
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestGetTransactionResults(t *testing.T) {
+	err := pm.RegisterModel("resultsfeatures", nil, func(input pm.ModelInput) (pm.ModelResults, error) {
+		return pm.ModelResults{ProbAttack: 0.1, Data: map[string]interface{}{"rule": "942100", "embedding": []float64{0.1, 0.2}}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inConf cf.ConfigFileData
+	err = yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: protocol
+    kind: builtin
+    plugintype: RequestHeaders
+    weight: 0.7
+  - id: features
+    kind: builtin
+    builtin: resultsfeatures
+    plugintype: RequestHeaders
+    exposedata: [rule]
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("results", conf, testMeter)
+	id := generateRandomID()
+	engine.InitTransaction(id)
+
+	if res, err := GetTransactionResults(id); err != nil || len(res.Results) != 0 {
+		t.Errorf("results before Analyze are %v, %v", res, err)
+	}
+	if err := Analyze("RequestHeaders", id, "GET / HTTP/1.1\nContent-Length: 1\nTransfer-Encoding: chunked\n", []string{"protocol", "features"}); err != nil {
+		t.Fatalf("Analyze returned error: %v", err)
+	}
+	if _, err := CheckTransaction(id, "combiner", nil); err != nil {
+		t.Fatalf("CheckTransaction returned error: %v", err)
+	}
+	res, err := GetTransactionResults(id)
+	if err != nil {
+		t.Fatalf("GetTransactionResults returned error: %v", err)
+	}
+	if res.Results["protocol"].ProbAttack == 0 || res.Weights["protocol"] != 0.7 {
+		t.Errorf("unexpected results %+v", res)
+	}
+	// only the data allowed by exposedata is returned
+	if data := res.Results["features"].Data; len(data) != 1 || data["rule"] != "942100" {
+		t.Errorf("features data is %v", data)
+	}
+
+	CloseTransaction(id)
+	if _, err := GetTransactionResults(id); err == nil {
+		t.Errorf("closed transaction results do not return error")
+	}
+}
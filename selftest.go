@@ -0,0 +1,283 @@
+package wace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// SelfTestTimeout bounds the calls of the self test to the plugins
+// without a timeout of their own
+const SelfTestTimeout = 10 * time.Second
+
+// SelfTestCheck is the outcome of a call of the self test to a plugin
+type SelfTestCheck struct {
+	// Kind is pm.ModelPluginKind or pm.DecisionPluginKind
+	Kind string
+	ID   string
+	// Sample is the name of the corpus sample analyzed
+	Sample   string
+	Duration time.Duration
+	// Err tells why the check failed, and is empty if it passed
+	Err string
+}
+
+// SelfTestReport is the outcome of the self test of the plugins
+type SelfTestReport struct {
+	Checks []SelfTestCheck
+}
+
+// Failures returns the failed checks of the report
+func (r SelfTestReport) Failures() []SelfTestCheck {
+	var failures []SelfTestCheck
+	for _, check := range r.Checks {
+		if check.Err != "" {
+			failures = append(failures, check)
+		}
+	}
+	return failures
+}
+
+// selfTestSample is a transaction part of the self test corpus
+type selfTestSample struct {
+	name    string
+	part    cf.ModelPluginType
+	payload string
+}
+
+// selfTestCorpus is a benign and an attack sample of each part of a
+// transaction
+var selfTestCorpus = []selfTestSample{
+	{"benign request headers", cf.RequestHeaders, "GET /index.html HTTP/1.1\nHost: example.com\nUser-Agent: Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0\nAccept: text/html\n"},
+	{"attack request headers", cf.RequestHeaders, "GET /search?q=1'%20OR%20'1'='1 HTTP/1.1\nHost: example.com\nUser-Agent: sqlmap/1.8\n"},
+	{"benign request body", cf.RequestBody, "user=alice&remember=on"},
+	{"attack request body", cf.RequestBody, "user=admin'--&password=<script>alert(1)</script>"},
+	{"benign request", cf.AllRequest, "POST /login HTTP/1.1\nHost: example.com\nContent-Type: application/x-www-form-urlencoded\n\nuser=alice&remember=on"},
+	{"attack request", cf.AllRequest, "POST /login HTTP/1.1\nHost: example.com\nContent-Type: application/x-www-form-urlencoded\n\nuser=admin' OR '1'='1&password=x"},
+	{"benign request trailers", cf.RequestTrailers, "x-checksum: 5d41402abc4b2a76\n"},
+	{"benign response headers", cf.ResponseHeaders, "HTTP/1.1 200 OK\nContent-Type: text/html\nContent-Length: 42\n"},
+	{"attack response headers", cf.ResponseHeaders, "HTTP/1.1 500 Internal Server Error\nContent-Type: text/plain\nX-Debug: ORA-01756: quoted string not properly terminated\n"},
+	{"benign response body", cf.ResponseBody, "<html><body><h1>Welcome</h1></body></html>"},
+	{"attack response body", cf.ResponseBody, "root:x:0:0:root:/root:/bin/bash\ndaemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin\n"},
+	{"benign response", cf.AllResponse, "HTTP/1.1 200 OK\nContent-Type: text/html\n\n<html><body><h1>Welcome</h1></body></html>"},
+	{"attack response", cf.AllResponse, "HTTP/1.1 200 OK\nContent-Type: text/plain\n\nroot:x:0:0:root:/root:/bin/bash\n"},
+	{"benign response trailers", cf.ResponseTrailers, "grpc-status: 0\n"},
+	{"benign transaction", cf.Everything, "GET / HTTP/1.1\nHost: example.com\n\nHTTP/1.1 200 OK\nContent-Type: text/html\n\n<html></html>"},
+	{"attack transaction", cf.Everything, "GET /../../etc/passwd HTTP/1.1\nHost: example.com\n\nHTTP/1.1 200 OK\n\nroot:x:0:0:root:/root:/bin/bash\n"},
+}
+
+// SelfTest runs a small built-in corpus of benign and attack requests
+// and responses through every loaded sync model plugin, and the
+// decision plugins through their results, checking that they answer
+// sane values within their timeout (SelfTestTimeout if none). It is
+// meant to be run by deployment pipelines before the instance receives
+// traffic: the self test transactions are not recorded, exported or
+// counted. The disabled plugins and the async models are left out. It
+// returns an error describing the failed checks, if any.
+func SelfTest() (SelfTestReport, error) {
+	if defaultCore.plugins.Load() == nil {
+		return SelfTestReport{}, fmt.Errorf("wace is not initialized")
+	}
+	return defaultCore.SelfTest()
+}
+
+// SelfTest is like the SelfTest function
+func (c *Core) SelfTest() (SelfTestReport, error) {
+	return selfTest(c.plugins.Load().manager, c.config())
+}
+
+// selfTest runs the self test of the plugins of p, configured by conf
+func selfTest(p *pm.PluginManager, conf *cf.ConfigStore) (SelfTestReport, error) {
+	var report SelfTestReport
+	var models []string
+	for _, id := range p.ModelPluginIDs() {
+		if !conf.IsAsync(id) && !p.Disabled(pm.ModelPluginKind, id) {
+			models = append(models, id)
+		}
+	}
+	var decisions []string
+	for _, id := range p.DecisionPluginIDs() {
+		if !p.Disabled(pm.DecisionPluginKind, id) {
+			decisions = append(decisions, id)
+		}
+	}
+
+	// the decisions are also checked without any model result
+	samples := append([]selfTestSample{{name: "no results"}}, selfTestCorpus...)
+	for i, sample := range samples {
+		var sampleModels []string
+		for _, id := range models {
+			if i > 0 && conf.ModelPlugins[id].PluginType == sample.part {
+				sampleModels = append(sampleModels, id)
+			}
+		}
+		if i > 0 && len(sampleModels) == 0 {
+			continue
+		}
+
+		transactionId := selfTestTransactionID()
+		lg.Get().StartTransaction(transactionId)
+		p.InitTransaction(transactionId)
+		report.Checks = append(report.Checks, selfTestModels(p, conf, transactionId, sample, sampleModels)...)
+		for _, id := range decisions {
+			report.Checks = append(report.Checks, selfTestDecision(p, conf, transactionId, sample, id))
+		}
+		p.CloseTransaction(transactionId)
+		lg.Get().EndTransaction(transactionId)
+	}
+
+	failures := report.Failures()
+	if len(failures) == 0 {
+		return report, nil
+	}
+	messages := make([]string, len(failures))
+	for i, check := range failures {
+		messages[i] = fmt.Sprintf("%s plugin %s on %s: %s", check.Kind, check.ID, check.Sample, check.Err)
+	}
+	return report, fmt.Errorf("self test failed: %s", strings.Join(messages, "; "))
+}
+
+// selfTestTransactionID returns a random ID for a self test transaction
+func selfTestTransactionID() string {
+	random := make([]byte, 8)
+	rand.Read(random)
+	return "selftest-" + hex.EncodeToString(random)
+}
+
+// selfTestModels analyzes the sample with the models in the
+// transaction, and checks their results
+func selfTestModels(p *pm.PluginManager, conf *cf.ConfigStore, transactionId string, sample selfTestSample, models []string) []SelfTestCheck {
+	if len(models) == 0 {
+		return nil
+	}
+	status := make(chan pm.ModelStatus, len(models))
+	p.AddModelChannel(transactionId, sample.part, status, "sync")
+
+	start := time.Now()
+	wait := time.Duration(0)
+	timeouts := make(map[string]time.Duration, len(models))
+	for _, id := range models {
+		timeouts[id] = conf.ModelDeadline(id)
+		if timeouts[id] == 0 {
+			timeouts[id] = SelfTestTimeout
+		}
+		if timeouts[id] > wait {
+			wait = timeouts[id]
+		}
+		if conf.ModelPlugins[id].Remote {
+			go queueModel(p, id, transactionId, sample.payload, status)
+		} else {
+			go p.Process(id, transactionId, sample.payload, sample.part, status)
+		}
+	}
+
+	answers := make(map[string]pm.ModelStatus, len(models))
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+collect:
+	for len(answers) < len(models) {
+		select {
+		case s := <-status:
+			answers[s.ModelID] = s
+		case <-timer.C:
+			break collect
+		}
+	}
+
+	results, _ := p.TransactionResults(transactionId)
+	checks := make([]SelfTestCheck, len(models))
+	for i, id := range models {
+		check := SelfTestCheck{Kind: pm.ModelPluginKind, ID: id, Sample: sample.name}
+		s, answered := answers[id]
+		switch {
+		case !answered:
+			check.Duration = time.Since(start)
+			check.Err = fmt.Sprintf("no answer within %v", timeouts[id])
+		case s.Err != nil:
+			check.Duration = s.End.Sub(s.Start)
+			check.Err = s.Err.Error()
+		default:
+			check.Duration = s.End.Sub(s.Start)
+			if check.Duration > timeouts[id] {
+				check.Err = fmt.Sprintf("answered in %v, over %v", check.Duration, timeouts[id])
+			} else if err := checkModelResults(results[id]); err != nil {
+				check.Err = err.Error()
+			}
+		}
+		checks[i] = check
+	}
+	return checks
+}
+
+// checkModelResults returns an error if the model results are not sane
+func checkModelResults(res pm.ModelResults) error {
+	if math.IsNaN(res.ProbAttack) || res.ProbAttack < 0 || res.ProbAttack > 1 {
+		return fmt.Errorf("attack probability %v out of [0, 1]", res.ProbAttack)
+	}
+	if res.Uncertainty != nil && (math.IsNaN(*res.Uncertainty) || *res.Uncertainty < 0 || *res.Uncertainty > 0.25) {
+		return fmt.Errorf("uncertainty %v out of [0, 0.25]", *res.Uncertainty)
+	}
+	for category, score := range res.Categories {
+		if math.IsNaN(score) || score < 0 || score > 1 {
+			return fmt.Errorf("%s category score %v out of [0, 1]", category, score)
+		}
+	}
+	for _, part := range res.NeedParts {
+		if _, err := cf.StringToPluginType(part); err != nil {
+			return fmt.Errorf("needed part %s: %v", part, err)
+		}
+	}
+	return nil
+}
+
+// selfTestDecision checks the transaction with the decision plugin.
+// The WAF params it requires are given as zero.
+func selfTestDecision(p *pm.PluginManager, conf *cf.ConfigStore, transactionId string, sample selfTestSample, id string) SelfTestCheck {
+	check := SelfTestCheck{Kind: pm.DecisionPluginKind, ID: id, Sample: sample.name}
+	// a decision plugin with a timeout of its own gives its fallback
+	// verdict when it times out
+	timeout := conf.DecisionPlugins[id].Timeout + SelfTestTimeout
+
+	type outcome struct {
+		res pm.DecisionResult
+		err error
+	}
+	done := make(chan outcome, 1)
+	start := time.Now()
+	go func() {
+		wafParams := make(map[string]string)
+		res, err := p.CheckResultWithContext(transactionId, id, wafParams, nil, pm.TransactionContext{})
+		var missing *pm.MissingWAFParamsError
+		if errors.As(err, &missing) {
+			for _, key := range missing.Missing {
+				wafParams[key] = "0"
+			}
+			res, err = p.CheckResultWithContext(transactionId, id, wafParams, nil, pm.TransactionContext{})
+		}
+		done <- outcome{res, err}
+	}()
+
+	select {
+	case o := <-done:
+		check.Duration = time.Since(start)
+		switch {
+		case o.err != nil:
+			check.Err = o.err.Error()
+		case containsString(o.res.Tags, pm.TimeoutTag):
+			check.Err = fmt.Sprintf("timed out after %v", conf.DecisionPlugins[id].Timeout)
+		}
+	case <-time.After(timeout):
+		check.Duration = time.Since(start)
+		check.Err = fmt.Sprintf("no decision within %v", timeout)
+	}
+	return check
+}
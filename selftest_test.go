@@ -0,0 +1,97 @@
+package wace
+
+import (
+	"math"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSelfTest(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: protocol
+    kind: builtin
+    plugintype: RequestHeaders
+  - id: body
+    kind: builtin
+    builtin: simulated
+    plugintype: RequestBody
+    params:
+      probattack: "0.3"
+  - id: slow
+    kind: builtin
+    builtin: simulated
+    plugintype: ResponseBody
+    timeout: 5ms
+    params:
+      latency: 100ms
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	core := NewCore("selftest", conf, testMeter)
+	before := MetricsSnapshot()
+
+	report, err := core.SelfTest()
+	if err == nil {
+		t.Errorf("self test with a slow model does not return error")
+	}
+	failures := report.Failures()
+	if len(failures) != 2 {
+		t.Fatalf("unexpected failures %+v", failures)
+	}
+	for _, check := range failures {
+		if check.Kind != pm.ModelPluginKind || check.ID != "slow" {
+			t.Errorf("unexpected failure %+v", check)
+		}
+	}
+	checked := make(map[string]int)
+	for _, check := range report.Checks {
+		checked[check.Kind+"/"+check.ID]++
+	}
+	// the decision checks the samples of the three models and the
+	// transaction without results
+	if checked["model/protocol"] != 2 || checked["model/body"] != 2 || checked["decision/combiner"] != 7 {
+		t.Errorf("unexpected checks %v", checked)
+	}
+	if after := MetricsSnapshot(); after.Transactions != before.Transactions || after.Checked != before.Checked {
+		t.Errorf("self test transactions counted")
+	}
+
+	core.DisablePlugin(pm.ModelPluginKind, "slow", "too slow")
+	if report, err := core.SelfTest(); err != nil || len(report.Failures()) != 0 {
+		t.Errorf("self test without the slow model returned error: %v", err)
+	}
+}
+
+func TestCheckModelResults(t *testing.T) {
+	uncertainty := 0.5
+	for _, res := range []pm.ModelResults{
+		{ProbAttack: math.NaN()},
+		{ProbAttack: 1.5},
+		{Uncertainty: &uncertainty},
+		{Categories: map[pm.AttackCategory]float64{pm.CategorySQLi: -1}},
+		{NeedParts: []string{"RequestBodies"}},
+	} {
+		if err := checkModelResults(res); err == nil {
+			t.Errorf("results %+v are not sane", res)
+		}
+	}
+	if err := checkModelResults(pm.ModelResults{ProbAttack: 0.9, NeedParts: []string{"RequestBody"}}); err != nil {
+		t.Errorf("sane results returned error: %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package wace
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ShadowTolerance is the largest difference between the scores of a
+// model and of its shadow that is still a match
+const ShadowTolerance = 0.05
+
+// Outcomes of the comparison of a model with its shadow
+const (
+	ShadowMatch    = "match"
+	ShadowMismatch = "mismatch"
+	// ShadowFailed is the outcome when the shadow fails and the model
+	// does not
+	ShadowFailed = "shadow_failed"
+	// ShadowModelFailed is the outcome when the model fails
+	ShadowModelFailed = "model_failed"
+)
+
+// ShadowStats compares a model plugin with a model plugin dark launched
+// along it, such as the same model served over another transport, since
+// the process started
+type ShadowStats struct {
+	Model  string
+	Shadow string
+	// Comparisons is the number of analyses of the model with a shadow
+	// analysis, of which Mismatches differ by more than ShadowTolerance,
+	// ShadowFailures failed only on the shadow and ModelFailures failed
+	// on the model
+	Comparisons    int64
+	Mismatches     int64
+	ShadowFailures int64
+	ModelFailures  int64
+	// MeanScoreDifference is the mean absolute difference of the scores
+	// of the analyses where both answered, and MeanModelLatency and
+	// MeanShadowLatency their mean durations
+	MeanScoreDifference float64
+	MeanModelLatency    time.Duration
+	MeanShadowLatency   time.Duration
+}
+
+// shadowTotals are the live totals of a ShadowStats
+type shadowTotals struct {
+	stats         ShadowStats
+	answered      int64
+	scoreDiff     float64
+	modelLatency  time.Duration
+	shadowLatency time.Duration
+}
+
+// startShadows calls the shadows of the model in the background, each
+// comparing its results to those of the model once it finishes
+func (c *Core) startShadows(plugins *pm.PluginManager, conf *cf.ConfigStore, modelID, transactionId, input string, t cf.ModelPluginType) {
+	shadows := conf.ShadowsOf(modelID)
+	if len(shadows) == 0 {
+		return
+	}
+	value, ok := c.analysisMap.Load(transactionId)
+	if !ok {
+		return
+	}
+	closed := value.(*transactionSync).closed
+	running, _ := c.shadowMap.LoadOrStore(transactionId, new(sync.Map))
+	channels := make([]chan pm.ModelStatus, len(shadows))
+	for i := range channels {
+		channels[i] = make(chan pm.ModelStatus, 1)
+	}
+	if _, loaded := running.(*sync.Map).LoadOrStore(modelID, channels); loaded {
+		// the shadows of the model are still running for the
+		// transaction
+		return
+	}
+	for i, shadow := range shadows {
+		go c.runShadow(plugins, modelID, shadow, transactionId, input, t, channels[i], closed)
+	}
+}
+
+// shadowModelDone gives the status of the model to its shadows
+func (c *Core) shadowModelDone(transactionId string, status pm.ModelStatus) {
+	running, ok := c.shadowMap.Load(transactionId)
+	if !ok {
+		return
+	}
+	channels, ok := running.(*sync.Map).LoadAndDelete(status.ModelID)
+	if !ok {
+		return
+	}
+	for _, ch := range channels.([]chan pm.ModelStatus) {
+		ch <- status
+	}
+}
+
+// runShadow calls the shadow of the model and compares its status to
+// the one of the model, unless the transaction is closed first
+func (c *Core) runShadow(plugins *pm.PluginManager, modelID, shadowID, transactionId, input string, t cf.ModelPluginType, model <-chan pm.ModelStatus, closed <-chan struct{}) {
+	shadow := plugins.Shadow(shadowID, c.scope(transactionId), input, t)
+	select {
+	case status := <-model:
+		c.compareShadow(transactionId, status, shadow)
+	case <-closed:
+	}
+}
+
+// compareShadow records the comparison of the status of a model with
+// the one of its shadow
+func (c *Core) compareShadow(transactionId string, model, shadow pm.ModelStatus) {
+	outcome := ShadowMatch
+	diff := math.Abs(model.ProbAttack - shadow.ProbAttack)
+	switch {
+	case model.Err != nil:
+		outcome = ShadowModelFailed
+	case shadow.Err != nil:
+		outcome = ShadowFailed
+		c.tprintf(lg.DEBUG, transactionId, "%s | shadow of %s failed: %v", shadow.ModelID, model.ModelID, shadow.Err)
+	case diff > ShadowTolerance:
+		outcome = ShadowMismatch
+		c.tprintf(lg.DEBUG, transactionId, "%s | shadow of %s scored %.5f instead of %.5f", shadow.ModelID, model.ModelID, shadow.ProbAttack, model.ProbAttack)
+	}
+
+	c.shadowsMutex.Lock()
+	key := [2]string{model.ModelID, shadow.ModelID}
+	totals, ok := c.shadowStats[key]
+	if !ok {
+		totals = &shadowTotals{stats: ShadowStats{Model: model.ModelID, Shadow: shadow.ModelID}}
+		c.shadowStats[key] = totals
+	}
+	totals.stats.Comparisons++
+	switch outcome {
+	case ShadowMismatch:
+		totals.stats.Mismatches++
+	case ShadowFailed:
+		totals.stats.ShadowFailures++
+	case ShadowModelFailed:
+		totals.stats.ModelFailures++
+	}
+	if outcome == ShadowMatch || outcome == ShadowMismatch {
+		totals.answered++
+		totals.scoreDiff += diff
+		totals.modelLatency += model.End.Sub(model.Start)
+		totals.shadowLatency += shadow.End.Sub(shadow.Start)
+	}
+	c.shadowsMutex.Unlock()
+
+	inst, attributes := c.transactionMetrics(transactionId)
+	attributes = append(attributes, attribute.String("model_id", model.ModelID), attribute.String("shadow_id", shadow.ModelID))
+	counter, err := inst.Int64Counter("wace.shadow.comparisons.total", metric.WithDescription("Number of analyses of the models compared with their shadows"))
+	if err != nil {
+		c.tprintf(lg.WARN, transactionId, "core | failed to record shadow comparison metric: %v", err.Error())
+		return
+	}
+	counter.Add(ctx, 1, metric.WithAttributes(append(attributes, attribute.String("outcome", outcome))...))
+	if outcome != ShadowMatch && outcome != ShadowMismatch {
+		return
+	}
+	histogramMeter, err := inst.Float64Histogram("wace.shadow.score.difference", metric.WithDescription("Absolute difference between the scores of the models and of their shadows"))
+	if err != nil {
+		c.tprintf(lg.WARN, transactionId, "core | failed to record shadow score metric: %v", err.Error())
+		return
+	}
+	histogramMeter.Record(ctx, diff, metric.WithAttributes(attributes...))
+	latencyMeter, err := inst.Int64Histogram("wace.shadow.latency.difference.nanoseconds", metric.WithDescription("Duration of the shadow analyses minus the one of their models"))
+	if err != nil {
+		c.tprintf(lg.WARN, transactionId, "core | failed to record shadow latency metric: %v", err.Error())
+		return
+	}
+	latencyMeter.Record(ctx, (shadow.End.Sub(shadow.Start) - model.End.Sub(model.Start)).Nanoseconds(), metric.WithAttributes(attributes...))
+}
+
+// ShadowReport returns the comparisons of the model plugins with their
+// shadows, sorted by model and shadow
+func ShadowReport() []ShadowStats {
+	return defaultCore.ShadowReport()
+}
+
+// ShadowReport is like the ShadowReport function
+func (c *Core) ShadowReport() []ShadowStats {
+	c.shadowsMutex.Lock()
+	defer c.shadowsMutex.Unlock()
+	report := make([]ShadowStats, 0, len(c.shadowStats))
+	for _, totals := range c.shadowStats {
+		stats := totals.stats
+		if totals.answered > 0 {
+			stats.MeanScoreDifference = totals.scoreDiff / float64(totals.answered)
+			stats.MeanModelLatency = totals.modelLatency / time.Duration(totals.answered)
+			stats.MeanShadowLatency = totals.shadowLatency / time.Duration(totals.answered)
+		}
+		report = append(report, stats)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Model != report[j].Model {
+			return report[i].Model < report[j].Model
+		}
+		return report[i].Shadow < report[j].Shadow
+	})
+	return report
+}
@@ -0,0 +1,84 @@
+package wace
+
+import (
+	"testing"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestShadow(t *testing.T) {
+	scores := map[string]float64{"shadowprimary": 0.9, "shadowcandidate": 0.2}
+	for name, score := range scores {
+		score := score
+		err := pm.RegisterModel(name, nil, func(input pm.ModelInput) (pm.ModelResults, error) {
+			return pm.ModelResults{ProbAttack: score}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: shadowed
+    kind: builtin
+    builtin: shadowprimary
+    plugintype: RequestHeaders
+  - id: shadowed-grpc
+    kind: builtin
+    builtin: shadowcandidate
+    plugintype: RequestHeaders
+    shadowof: shadowed
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("shadow", conf, testMeter)
+
+	id := generateRandomID()
+	engine.InitTransaction(id)
+	defer CloseTransaction(id)
+	if err := Analyze("RequestHeaders", id, "GET / HTTP/1.1\n", []string{"shadowed", "shadowed-grpc"}); err != nil {
+		t.Fatalf("Analyze returned error: %v", err)
+	}
+	if _, err := CheckTransactionVerdict(id, "combiner", nil); err != nil {
+		t.Fatalf("CheckTransactionVerdict returned error: %v", err)
+	}
+	results, err := GetTransactionResults(id)
+	if err != nil {
+		t.Fatalf("GetTransactionResults returned error: %v", err)
+	}
+	if _, ok := results.Results["shadowed-grpc"]; ok || len(results.Results) != 1 {
+		t.Errorf("results of the shadow stored in %+v", results.Results)
+	}
+
+	var report []ShadowStats
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if report = engine.ShadowReport(); len(report) > 0 {
+			break
+		}
+	}
+	if len(report) != 1 {
+		t.Fatalf("shadow report is %+v", report)
+	}
+	stats := report[0]
+	if stats.Model != "shadowed" || stats.Shadow != "shadowed-grpc" || stats.Comparisons != 1 || stats.Mismatches != 1 {
+		t.Errorf("shadow stats are %+v", stats)
+	}
+	if stats.MeanScoreDifference < 0.69 || stats.MeanScoreDifference > 0.71 {
+		t.Errorf("mean score difference is %v, want 0.7", stats.MeanScoreDifference)
+	}
+}
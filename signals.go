@@ -0,0 +1,71 @@
+package wace
+
+import (
+	"strings"
+
+	"github.com/tiroa-tilsor/wacelib/bot"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+// Metadata keys of the client signals given by the connector. The
+// header order is a comma separated list of header names; the core
+// fills it, and the user agent, from the request headers if missing.
+const (
+	MetaTLSJA3      = "tls.ja3"
+	MetaTLSJA4      = "tls.ja4"
+	MetaHeaderOrder = "http.header_order"
+	MetaUserAgent   = "http.user_agent"
+)
+
+// SetTransactionMetadata sets metadata values of the transaction, such
+// as the client signals known by the connector. Metadata set before
+// Analyze is given to the plugins called by it.
+func SetTransactionMetadata(transactionID string, values map[string]string) {
+	coreOf(transactionID).SetTransactionMetadata(transactionID, values)
+}
+
+// SetTransactionMetadata is like the SetTransactionMetadata function
+func (c *Core) SetTransactionMetadata(transactionID string, values map[string]string) {
+	c.setMetadata(transactionID, values)
+}
+
+// TransactionSignals returns the client signals of the transaction
+// from its metadata
+func TransactionSignals(transactionID string) bot.Signals {
+	return coreOf(transactionID).TransactionSignals(transactionID)
+}
+
+// TransactionSignals is like the TransactionSignals function
+func (c *Core) TransactionSignals(transactionID string) bot.Signals {
+	meta := c.TransactionMetadata(transactionID)
+	signals := bot.Signals{
+		JA3:       meta[MetaTLSJA3],
+		JA4:       meta[MetaTLSJA4],
+		UserAgent: meta[MetaUserAgent],
+	}
+	if order := meta[MetaHeaderOrder]; order != "" {
+		for _, name := range strings.Split(order, ",") {
+			signals.HeaderOrder = append(signals.HeaderOrder, strings.ToLower(strings.TrimSpace(name)))
+		}
+	}
+	return signals
+}
+
+// collectSignals completes the client signals of the transaction with
+// the request headers of the payload and hands them to the plugins
+func (c *Core) collectSignals(transactionID string, modelsType cf.ModelPluginType, payload string) {
+	if modelsType == cf.RequestHeaders || modelsType == cf.AllRequest || modelsType == cf.Everything {
+		meta := c.TransactionMetadata(transactionID)
+		values := make(map[string]string)
+		if meta[MetaHeaderOrder] == "" {
+			values[MetaHeaderOrder] = strings.Join(bot.HeaderOrder(payload), ",")
+		}
+		if meta[MetaUserAgent] == "" {
+			values[MetaUserAgent] = bot.UserAgent(payload)
+		}
+		c.setMetadata(transactionID, values)
+	}
+	if signals := c.TransactionSignals(transactionID); !signals.Empty() {
+		c.pluginsOf(transactionID).manager.SetTransactionSignals(c.scope(transactionID), signals)
+	}
+}
@@ -0,0 +1,23 @@
+package wace
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransactionSignals(t *testing.T) {
+	id := generateRandomID()
+	defer defaultCore.metadataMap.Delete(id)
+	SetTransactionMetadata(id, map[string]string{
+		MetaTLSJA3:      "e7d705a3286e19ea42f587b344ee6865",
+		MetaHeaderOrder: "Host, User-Agent,accept",
+	})
+
+	signals := TransactionSignals(id)
+	if signals.JA3 != "e7d705a3286e19ea42f587b344ee6865" || signals.JA4 != "" {
+		t.Errorf("unexpected tls fingerprints %+v", signals)
+	}
+	if strings.Join(signals.HeaderOrder, ",") != "host,user-agent,accept" {
+		t.Errorf("header order is %v", signals.HeaderOrder)
+	}
+}
@@ -0,0 +1,116 @@
+package wace
+
+import (
+	"sync"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Phases of a transaction whose latency is measured
+const (
+	PhaseRequest  = "request"
+	PhaseResponse = "response"
+)
+
+// phaseTimes are when the phases of a transaction started
+type phaseTimes struct {
+	mutex    sync.Mutex
+	request  time.Time
+	response time.Time
+}
+
+// partPhase returns the phase of the transaction where the part of type
+// t is analyzed
+func partPhase(t cf.ModelPluginType) string {
+	switch t {
+	case cf.ResponseHeaders, cf.ResponseBody, cf.AllResponse, cf.ResponseTrailers:
+		return PhaseResponse
+	default:
+		return PhaseRequest
+	}
+}
+
+// startRequestPhase records the start of the request phase of the
+// transaction
+func (c *Core) startRequestPhase(transactionID string, now time.Time) {
+	c.phaseMap.Store(transactionID, &phaseTimes{request: now})
+}
+
+// startPartPhase records the start of the response phase of the
+// transaction, when the part of type t is the first response part
+// analyzed
+func (c *Core) startPartPhase(transactionID string, t cf.ModelPluginType, now time.Time) {
+	if partPhase(t) != PhaseResponse {
+		return
+	}
+	value, ok := c.phaseMap.Load(transactionID)
+	if !ok {
+		return
+	}
+	times := value.(*phaseTimes)
+	times.mutex.Lock()
+	defer times.mutex.Unlock()
+	if times.response.IsZero() {
+		times.response = now
+	}
+}
+
+// currentPhase returns the phase the transaction is in and when it
+// started
+func (c *Core) currentPhase(transactionID string) (string, time.Time, bool) {
+	value, ok := c.phaseMap.Load(transactionID)
+	if !ok {
+		return "", time.Time{}, false
+	}
+	times := value.(*phaseTimes)
+	times.mutex.Lock()
+	defer times.mutex.Unlock()
+	if !times.response.IsZero() {
+		return PhaseResponse, times.response, true
+	}
+	return PhaseRequest, times.request, true
+}
+
+// recordPhaseLatency records the latency of the current phase of the
+// transaction once checked, and counts it if it exceeds the latency
+// budget of the phase
+func (c *Core) recordPhaseLatency(transactionID string, now time.Time) {
+	phase, start, ok := c.currentPhase(transactionID)
+	if !ok {
+		return
+	}
+	elapsed := now.Sub(start)
+	inst, attributes := c.transactionMetrics(transactionID)
+	attributes = append(attributes, attribute.String("phase", phase))
+	if profile := c.transactionProfile(transactionID); profile != "" {
+		attributes = append(attributes, attribute.String("profile", profile))
+	}
+	histogramMeter, err := inst.Int64Histogram("wace.transaction.duration.nanoseconds", metric.WithDescription("End-to-end latency of the transaction phases, until checked"))
+	if err != nil {
+		c.tprintf(lg.WARN, transactionID, "core | failed to record transaction duration metric: %v", err.Error())
+	} else {
+		histogramMeter.Record(ctx, elapsed.Nanoseconds(), metric.WithAttributes(attributes...))
+	}
+
+	slo := c.config().LatencySLO
+	budget := slo.Request
+	if phase == PhaseResponse {
+		budget = slo.Response
+	}
+	if budget == 0 || elapsed <= budget {
+		return
+	}
+	c.tprintf(lg.DEBUG, transactionID, "core | %s phase took %v, over its %v budget", phase, elapsed, budget)
+	counter, err := inst.Int64Counter("wace.transaction.slo.exceeded.total", metric.WithDescription("Number of transaction phases exceeding their latency budget"))
+	if err != nil {
+		c.tprintf(lg.WARN, transactionID, "core | failed to record latency slo metric: %v", err.Error())
+		return
+	}
+	counter.Add(ctx, 1, metric.WithAttributes(attributes...))
+}
@@ -0,0 +1,85 @@
+package wace
+
+import (
+	"context"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLatencySLO(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: protocol
+    kind: builtin
+    plugintype: RequestHeaders
+  - id: slow
+    kind: builtin
+    builtin: simulated
+    plugintype: ResponseHeaders
+    params:
+      latency: 20ms
+decisionplugins:
+  - id: combiner
+    kind: builtin
+latencyslo:
+  request: 1h
+  response: 10ms
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	reader := metric.NewManualReader()
+	engine := NewCore("slo", conf, metric.NewMeterProvider(metric.WithReader(reader)).Meter("slo"))
+	id := generateRandomID()
+	engine.InitTransactionWithOptions(id, TransactionOptions{Profile: "shop"})
+	defer CloseTransaction(id)
+
+	Analyze("RequestHeaders", id, "GET / HTTP/1.1\nHost: example.com\n", []string{"protocol"})
+	if _, err := CheckTransaction(id, "combiner", nil); err != nil {
+		t.Fatalf("CheckTransaction returned error: %v", err)
+	}
+	Analyze("ResponseHeaders", id, "HTTP/1.1 200 OK\n", []string{"slow"})
+	if _, err := CheckTransaction(id, "combiner", nil); err != nil {
+		t.Fatalf("CheckTransaction returned error: %v", err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect returned error: %v", err)
+	}
+	durations, exceeded := 0, map[string]int64{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		switch m.Name {
+		case "wace.transaction.duration.nanoseconds":
+			for _, dp := range m.Data.(metricdata.Histogram[int64]).DataPoints {
+				durations += int(dp.Count)
+				if v, _ := dp.Attributes.Value("profile"); v.AsString() != "shop" {
+					t.Errorf("profile attribute is %q", v.AsString())
+				}
+			}
+		case "wace.transaction.slo.exceeded.total":
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				phase, _ := dp.Attributes.Value("phase")
+				exceeded[phase.AsString()] += dp.Value
+			}
+		}
+	}
+	if durations != 2 {
+		t.Errorf("%d phase durations recorded, expected 2", durations)
+	}
+	if len(exceeded) != 1 || exceeded[PhaseResponse] != 1 {
+		t.Errorf("phases exceeding their budget are %v, expected the response", exceeded)
+	}
+}
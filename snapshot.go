@@ -0,0 +1,115 @@
+package wace
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MetricsReport holds the current values of the main WACE counters and
+// gauges, for connectors to show in their own status pages without an
+// OpenTelemetry pipeline. The counters are cumulative since the process
+// started.
+type MetricsReport struct {
+	Since time.Time
+	// Transactions is the number of transactions initialized, and
+	// ActiveTransactions the number of those not yet closed
+	Transactions       int64
+	ActiveTransactions int
+	// Checked is the number of transactions checked by a decision
+	// plugin without error, of which Blocked were blocked and
+	// Challenged challenged
+	Checked    int64
+	Blocked    int64
+	Challenged int64
+	// BlockRate is Blocked over Checked (0 if none was checked)
+	BlockRate float64
+	// Models are the metrics of each model plugin called, by ID
+	Models map[string]ModelMetrics
+}
+
+// ModelMetrics holds the counters of a model plugin
+type ModelMetrics struct {
+	// Calls is the number of analyses finished by the model, of which
+	// Errors failed or timed out
+	Calls  int64
+	Errors int64
+	// ErrorRate is Errors over Calls
+	ErrorRate float64
+}
+
+// modelCounters are the live counters of a model plugin
+type modelCounters struct {
+	calls  atomic.Int64
+	errors atomic.Int64
+}
+
+// coreCounters are the live counters of the metrics snapshot of a core
+type coreCounters struct {
+	since        time.Time
+	transactions atomic.Int64
+	checked      atomic.Int64
+	blocked      atomic.Int64
+	challenged   atomic.Int64
+	// models maps each model ID to its *modelCounters
+	models sync.Map
+}
+
+// countModelStatus counts an analysis finished by the model, failed if
+// err is not nil
+func (c *Core) countModelStatus(modelID string, err error) {
+	value, ok := c.counters.models.Load(modelID)
+	if !ok {
+		value, _ = c.counters.models.LoadOrStore(modelID, &modelCounters{})
+	}
+	counters := value.(*modelCounters)
+	counters.calls.Add(1)
+	if err != nil {
+		counters.errors.Add(1)
+	}
+}
+
+// countVerdict counts a transaction checked without error
+func (c *Core) countVerdict(verdict Verdict) {
+	c.counters.checked.Add(1)
+	if verdict.Block {
+		c.counters.blocked.Add(1)
+	} else if verdict.Challenge {
+		c.counters.challenged.Add(1)
+	}
+}
+
+// MetricsSnapshot returns the current values of the WACE metrics. It
+// is cheap enough to be called on every request of a status page.
+func MetricsSnapshot() MetricsReport {
+	return defaultCore.MetricsSnapshot()
+}
+
+// MetricsSnapshot is like the MetricsSnapshot function
+func (c *Core) MetricsSnapshot() MetricsReport {
+	report := MetricsReport{
+		Since:        c.counters.since,
+		Transactions: c.counters.transactions.Load(),
+		Checked:      c.counters.checked.Load(),
+		Blocked:      c.counters.blocked.Load(),
+		Challenged:   c.counters.challenged.Load(),
+		Models:       make(map[string]ModelMetrics),
+	}
+	if report.Checked > 0 {
+		report.BlockRate = float64(report.Blocked) / float64(report.Checked)
+	}
+	c.analysisMap.Range(func(key, value interface{}) bool {
+		report.ActiveTransactions++
+		return true
+	})
+	c.counters.models.Range(func(key, value interface{}) bool {
+		counters := value.(*modelCounters)
+		m := ModelMetrics{Calls: counters.calls.Load(), Errors: counters.errors.Load()}
+		if m.Calls > 0 {
+			m.ErrorRate = float64(m.Errors) / float64(m.Calls)
+		}
+		report.Models[key.(string)] = m
+		return true
+	})
+	return report
+}
@@ -0,0 +1,74 @@
+package wace
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMetricsSnapshot(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: snapattack
+    kind: builtin
+    builtin: simulated
+    plugintype: RequestHeaders
+    params:
+      probattack: "0.9"
+  - id: snapslow
+    kind: builtin
+    builtin: simulated
+    plugintype: RequestHeaders
+    timeout: 5ms
+    params:
+      latency: 100ms
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("snapshot", conf, testMeter)
+	before := engine.MetricsSnapshot()
+
+	id := generateRandomID()
+	engine.InitTransaction(id)
+	if err := Analyze("RequestHeaders", id, "GET / HTTP/1.1\n", []string{"snapattack", "snapslow"}); err != nil {
+		t.Fatalf("Analyze returned error: %v", err)
+	}
+	if _, err := CheckTransaction(id, "combiner", nil); err != nil {
+		t.Fatalf("CheckTransaction returned error: %v", err)
+	}
+	during := engine.MetricsSnapshot()
+	CloseTransaction(id)
+	after := engine.MetricsSnapshot()
+
+	if got := after.Transactions - before.Transactions; got != 1 {
+		t.Errorf("%d transactions counted, want 1", got)
+	}
+	if during.ActiveTransactions != after.ActiveTransactions+1 {
+		t.Errorf("%d active transactions before closing, %d after", during.ActiveTransactions, after.ActiveTransactions)
+	}
+	if after.Checked-before.Checked != 1 || after.Blocked-before.Blocked != 1 {
+		t.Errorf("checked %d and blocked %d, want 1 and 1", after.Checked-before.Checked, after.Blocked-before.Blocked)
+	}
+	if after.BlockRate <= 0 || after.BlockRate > 1 {
+		t.Errorf("block rate %v out of range", after.BlockRate)
+	}
+	if m := after.Models["snapattack"]; m.Calls != 1 || m.Errors != 0 || m.ErrorRate != 0 {
+		t.Errorf("unexpected metrics %+v of the succeeding model", m)
+	}
+	if m := after.Models["snapslow"]; m.Calls != 1 || m.Errors != 1 || m.ErrorRate != 1 {
+		t.Errorf("unexpected metrics %+v of the timed out model", m)
+	}
+}
@@ -0,0 +1,295 @@
+package statestore
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisTimeout bounds the connection to the Redis server and every
+// command sent to it
+const redisTimeout = 5 * time.Second
+
+// redisMaxIdle is the number of idle connections kept open
+const redisMaxIdle = 8
+
+// Redis is a Store kept in a Redis server, so that several WACE
+// instances can share it. It speaks the subset of the Redis protocol
+// it needs over a small pool of connections.
+type Redis struct {
+	address  string
+	tls      *tls.Config
+	password string
+	username string
+	db       int
+
+	mutex sync.Mutex
+	idle  []*redisConn
+}
+
+// redisConn is a connection to the Redis server
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// redisError is an error reply of the Redis server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// NewRedis returns a store kept in the Redis server at the given URL,
+// redis://[[user]:password@]host[:port][/db], or rediss:// for TLS. It
+// checks that the server can be reached.
+func NewRedis(rawURL string) (*Redis, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %v", err)
+	}
+	r := &Redis{}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		r.tls = &tls.Config{ServerName: u.Hostname()}
+	default:
+		return nil, fmt.Errorf("invalid redis url scheme %s", u.Scheme)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "6379"
+	}
+	r.address = net.JoinHostPort(u.Hostname(), port)
+	if u.User != nil {
+		r.username = u.User.Username()
+		r.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if r.db, err = strconv.Atoi(db); err != nil || r.db < 0 {
+			return nil, fmt.Errorf("invalid redis database %s", db)
+		}
+	}
+	c, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	r.put(c)
+	return r, nil
+}
+
+// dial opens a connection to the server, authenticated and on the
+// database of the URL
+func (r *Redis) dial() (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: redisTimeout}
+	var conn net.Conn
+	var err error
+	if r.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", r.address, r.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", r.address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to redis at %s: %v", r.address, err)
+	}
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	if r.password != "" {
+		args := []string{"AUTH", r.password}
+		if r.username != "" {
+			args = []string{"AUTH", r.username, r.password}
+		}
+		if _, err := c.do(args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if r.db != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(r.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// get returns an idle connection, or a new one
+func (r *Redis) get() (*redisConn, error) {
+	r.mutex.Lock()
+	if n := len(r.idle); n > 0 {
+		c := r.idle[n-1]
+		r.idle = r.idle[:n-1]
+		r.mutex.Unlock()
+		return c, nil
+	}
+	r.mutex.Unlock()
+	return r.dial()
+}
+
+// put returns a healthy connection to the pool
+func (r *Redis) put(c *redisConn) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.idle) >= redisMaxIdle {
+		c.conn.Close()
+		return
+	}
+	r.idle = append(r.idle, c)
+}
+
+// do sends the command on a pooled connection and returns its reply.
+// The connections failing on the network are dropped.
+func (r *Redis) do(args ...string) (interface{}, error) {
+	c, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.do(args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		c.conn.Close()
+		return nil, err
+	}
+	r.put(c)
+	return reply, err
+}
+
+// Close closes the idle connections
+func (r *Redis) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, c := range r.idle {
+		c.conn.Close()
+	}
+	r.idle = nil
+	return nil
+}
+
+// do sends the command and reads its reply
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(redisTimeout))
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// read reads a reply: a string, an int64, nil, a slice of replies or a
+// redisError
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: invalid reply %q", line)
+}
+
+// Get returns the value of key
+func (r *Redis) Get(key string) ([]byte, bool, error) {
+	reply, err := r.do("GET", key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected GET reply %v", reply)
+	}
+	return []byte(value), true, nil
+}
+
+// Set stores the value of key
+func (r *Redis) Set(key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		ms := ttl.Milliseconds()
+		if ms == 0 {
+			ms = 1
+		}
+		args = append(args, "PX", strconv.FormatInt(ms, 10))
+	}
+	_, err := r.do(args...)
+	return err
+}
+
+// Delete removes key
+func (r *Redis) Delete(key string) error {
+	_, err := r.do("DEL", key)
+	return err
+}
+
+// Keys returns the keys with the given prefix, scanning the database
+// incrementally
+func (r *Redis) Keys(prefix string) ([]string, error) {
+	pattern := redisGlobEscaper.Replace(prefix) + "*"
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := r.do("SCAN", cursor, "MATCH", pattern, "COUNT", "1000")
+		if err != nil {
+			return nil, err
+		}
+		items, ok := reply.([]interface{})
+		if !ok || len(items) != 2 {
+			return nil, fmt.Errorf("redis: unexpected SCAN reply %v", reply)
+		}
+		cursor, _ = items[0].(string)
+		batch, _ := items[1].([]interface{})
+		for _, key := range batch {
+			if s, ok := key.(string); ok {
+				keys = append(keys, s)
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			return keys, nil
+		}
+	}
+}
+
+// redisGlobEscaper escapes the glob characters of the SCAN patterns
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
@@ -0,0 +1,136 @@
+package statestore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis serves the commands used by the Redis store from a map
+type fakeRedis struct {
+	mutex    sync.Mutex
+	values   map[string]string
+	password string
+	commands []string
+}
+
+func serveFakeRedis(t *testing.T, f *fakeRedis) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return lis.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := f.password == ""
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			line, _ := reader.ReadString('\n')
+			size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			data := make([]byte, size+2)
+			io.ReadFull(reader, data)
+			args[i] = string(data[:size])
+		}
+		f.mutex.Lock()
+		f.commands = append(f.commands, args[0])
+		reply := "+OK\r\n"
+		switch {
+		case args[0] == "AUTH":
+			authenticated = args[len(args)-1] == f.password
+			if !authenticated {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required\r\n"
+		case args[0] == "GET":
+			if value, ok := f.values[args[1]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case args[0] == "SET":
+			f.values[args[1]] = args[2]
+		case args[0] == "DEL":
+			delete(f.values, args[1])
+			reply = ":1\r\n"
+		case args[0] == "SCAN":
+			prefix := strings.ReplaceAll(strings.TrimSuffix(args[3], "*"), `\`, "")
+			var keys []string
+			for key := range f.values {
+				if strings.HasPrefix(key, prefix) {
+					keys = append(keys, fmt.Sprintf("$%d\r\n%s\r\n", len(key), key))
+				}
+			}
+			reply = fmt.Sprintf("*2\r\n$1\r\n0\r\n*%d\r\n%s", len(keys), strings.Join(keys, ""))
+		}
+		f.mutex.Unlock()
+		conn.Write([]byte(reply))
+	}
+}
+
+func TestRedis(t *testing.T) {
+	f := &fakeRedis{values: make(map[string]string), password: "secret"}
+	address := serveFakeRedis(t, f)
+
+	if _, err := NewRedis("redis://:wrong@" + address); err == nil {
+		t.Errorf("wrong password does not return error")
+	}
+	if _, err := NewRedis("http://" + address); err == nil {
+		t.Errorf("invalid scheme does not return error")
+	}
+
+	store, err := NewRedis("redis://:secret@" + address + "/2")
+	if err != nil {
+		t.Fatalf("NewRedis returned error: %v", err)
+	}
+	defer store.Close()
+
+	if _, ok, err := store.Get("missing"); ok || err != nil {
+		t.Errorf("missing key found: %v", err)
+	}
+	store.Set("a/1", []byte("one\r\ntwo"), time.Minute)
+	store.Set("a*/2", []byte("two"), 0)
+	store.Set("b/1", []byte("three"), 0)
+	if value, ok, err := store.Get("a/1"); !ok || err != nil || string(value) != "one\r\ntwo" {
+		t.Errorf("a/1 is %q, %t, %v", value, ok, err)
+	}
+	keys, err := store.Keys("a/")
+	if err != nil || len(keys) != 1 || keys[0] != "a/1" {
+		t.Errorf("keys with prefix a/ are %v, %v", keys, err)
+	}
+	store.Delete("b/1")
+	if _, ok, _ := store.Get("b/1"); ok {
+		t.Errorf("deleted key found")
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if strings.Join(f.commands[:3], " ") != "AUTH AUTH SELECT" {
+		t.Errorf("connection commands are %v", f.commands)
+	}
+}
@@ -0,0 +1,201 @@
+/*
+Package statestore provides a key-value store where WACE and its
+plugins keep state that outlives a transaction, such as the request
+fingerprints and endpoint baselines learned from the traffic.
+*/
+package statestore
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store is a key-value store with optional expiration of the entries
+type Store interface {
+	// Get returns the value of key, and false if it does not exist or
+	// has expired
+	Get(key string) ([]byte, bool, error)
+	// Set stores the value of key. A zero ttl never expires.
+	Set(key string, value []byte, ttl time.Duration) error
+	// Delete removes key
+	Delete(key string) error
+	// Keys returns the keys with the given prefix
+	Keys(prefix string) ([]string, error)
+}
+
+// DefaultMaxEntries is the number of entries a store created by
+// NewMemory keeps at most
+const DefaultMaxEntries = 100000
+
+// sweepInterval is the time between two purges of the expired entries
+// of a Memory store
+const sweepInterval = time.Minute
+
+// entry is a value stored in a Memory store
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// Memory is an in-process Store. It keeps a bounded number of entries,
+// evicting the least recently set ones beyond, and purges the expired
+// entries periodically as new ones are set.
+type Memory struct {
+	mutex   sync.RWMutex
+	entries map[string]*list.Element
+	// order lists the entries from the least to the most recently set
+	order      *list.List
+	maxEntries int
+	lastSweep  time.Time
+}
+
+// NewMemory creates an empty in-process store keeping at most
+// DefaultMaxEntries entries
+func NewMemory() *Memory {
+	return NewMemoryWithLimit(DefaultMaxEntries)
+}
+
+// NewMemoryWithLimit creates an empty in-process store keeping at most
+// maxEntries entries, without limit if 0
+func NewMemoryWithLimit(maxEntries int) *Memory {
+	return &Memory{entries: make(map[string]*list.Element), order: list.New(), maxEntries: maxEntries, lastSweep: time.Now()}
+}
+
+// expired returns true if the entry has an expiration in the past
+func (e *entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+// Get returns the value of key
+func (m *Memory) Get(key string) ([]byte, bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	element, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := element.Value.(*entry)
+	if e.expired(time.Now()) {
+		return nil, false, nil
+	}
+	return append([]byte(nil), e.value...), true, nil
+}
+
+// Set stores the value of key, evicting the least recently set entry if
+// the store is full
+func (m *Memory) Set(key string, value []byte, ttl time.Duration) error {
+	now := time.Now()
+	e := &entry{key: key, value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.sweep(now)
+	}
+	if element, ok := m.entries[key]; ok {
+		element.Value = e
+		m.order.MoveToBack(element)
+		return nil
+	}
+	if m.maxEntries > 0 && len(m.entries) >= m.maxEntries {
+		m.sweep(now)
+		for len(m.entries) >= m.maxEntries {
+			m.remove(m.order.Front())
+		}
+	}
+	m.entries[key] = m.order.PushBack(e)
+	return nil
+}
+
+// Delete removes key
+func (m *Memory) Delete(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if element, ok := m.entries[key]; ok {
+		m.remove(element)
+	}
+	return nil
+}
+
+// Keys returns the keys with the given prefix. Expired entries are
+// purged along the way.
+func (m *Memory) Keys(prefix string) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sweep(time.Now())
+	var keys []string
+	for key := range m.entries {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Len returns the number of entries in the store, including the expired
+// ones not purged yet
+func (m *Memory) Len() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return len(m.entries)
+}
+
+// sweep purges the expired entries. The mutex must be held.
+func (m *Memory) sweep(now time.Time) {
+	for element := m.order.Front(); element != nil; {
+		next := element.Next()
+		if element.Value.(*entry).expired(now) {
+			m.remove(element)
+		}
+		element = next
+	}
+	m.lastSweep = now
+}
+
+// remove removes the entry of the element. The mutex must be held.
+func (m *Memory) remove(element *list.Element) {
+	delete(m.entries, element.Value.(*entry).key)
+	m.order.Remove(element)
+}
+
+// prefixed is a Store keeping its keys under a prefix of another one
+type prefixed struct {
+	store  Store
+	prefix string
+}
+
+// WithPrefix returns a Store keeping its keys in s under the given
+// prefix, so several users of s do not see the keys of each other
+func WithPrefix(s Store, prefix string) Store {
+	return &prefixed{store: s, prefix: prefix}
+}
+
+// Get returns the value of key
+func (p *prefixed) Get(key string) ([]byte, bool, error) {
+	return p.store.Get(p.prefix + key)
+}
+
+// Set stores the value of key
+func (p *prefixed) Set(key string, value []byte, ttl time.Duration) error {
+	return p.store.Set(p.prefix+key, value, ttl)
+}
+
+// Delete removes key
+func (p *prefixed) Delete(key string) error {
+	return p.store.Delete(p.prefix + key)
+}
+
+// Keys returns the keys with the given prefix, without the prefix of
+// the store
+func (p *prefixed) Keys(prefix string) ([]string, error) {
+	keys, err := p.store.Keys(p.prefix + prefix)
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, p.prefix)
+	}
+	return keys, err
+}
@@ -0,0 +1,100 @@
+package statestore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	store := NewMemory()
+
+	if _, ok, _ := store.Get("missing"); ok {
+		t.Errorf("missing key found")
+	}
+
+	store.Set("a/1", []byte("one"), 0)
+	store.Set("a/2", []byte("two"), time.Nanosecond)
+	store.Set("b/1", []byte("three"), time.Hour)
+	time.Sleep(time.Millisecond)
+
+	if value, ok, _ := store.Get("a/1"); !ok || string(value) != "one" {
+		t.Errorf("a/1 is %q, %t", value, ok)
+	}
+	if _, ok, _ := store.Get("a/2"); ok {
+		t.Errorf("expired key found")
+	}
+	keys, _ := store.Keys("a/")
+	if len(keys) != 1 || keys[0] != "a/1" {
+		t.Errorf("keys with prefix a/ are %v", keys)
+	}
+
+	store.Delete("b/1")
+	if _, ok, _ := store.Get("b/1"); ok {
+		t.Errorf("deleted key found")
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	store := NewMemoryWithLimit(2)
+	store.Set("a", []byte("a"), 0)
+	store.Set("b", []byte("b"), 0)
+	store.Set("a", []byte("a2"), 0)
+	store.Set("c", []byte("c"), 0)
+	if _, ok, _ := store.Get("b"); ok || store.Len() != 2 {
+		t.Errorf("least recently set key kept, %d entries", store.Len())
+	}
+	if value, ok, _ := store.Get("a"); !ok || string(value) != "a2" {
+		t.Errorf("a is %q, %t", value, ok)
+	}
+
+	// the expired entries are evicted first
+	store.Set("d", []byte("d"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	store.Set("e", []byte("e"), 0)
+	if _, ok, _ := store.Get("c"); !ok {
+		t.Errorf("entry evicted instead of an expired one")
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+	store := NewMemory()
+	for _, key := range []string{"a", "b", "c"} {
+		store.Set(key, []byte(key), time.Nanosecond)
+	}
+	time.Sleep(time.Millisecond)
+	store.Set("d", []byte("d"), 0)
+	if store.Len() != 4 {
+		t.Errorf("expired entries purged before the sweep interval, %d entries", store.Len())
+	}
+	store.lastSweep = time.Now().Add(-sweepInterval)
+	store.Set("e", []byte("e"), 0)
+	if store.Len() != 2 {
+		t.Errorf("%d entries after the sweep, expected 2", store.Len())
+	}
+}
+
+func TestWithPrefix(t *testing.T) {
+	store := NewMemory()
+	first, second := WithPrefix(store, "first/"), WithPrefix(store, "second/")
+
+	first.Set("a/1", []byte("one"), 0)
+	second.Set("a/1", []byte("two"), 0)
+	if value, ok, _ := first.Get("a/1"); !ok || string(value) != "one" {
+		t.Errorf("a/1 of the first store is %q, %t", value, ok)
+	}
+	if value, ok, _ := store.Get("second/a/1"); !ok || string(value) != "two" {
+		t.Errorf("second/a/1 is %q, %t", value, ok)
+	}
+	keys, _ := second.Keys("a/")
+	if len(keys) != 1 || keys[0] != "a/1" {
+		t.Errorf("keys of the second store with prefix a/ are %v", keys)
+	}
+
+	first.Delete("a/1")
+	if _, ok, _ := first.Get("a/1"); ok {
+		t.Errorf("deleted key found")
+	}
+	if _, ok, _ := second.Get("a/1"); !ok {
+		t.Errorf("key of the second store deleted with the first one")
+	}
+}
@@ -0,0 +1,236 @@
+package wace
+
+import (
+	"fmt"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// StatusReport describes the running WACE instance
+type StatusReport struct {
+	Started            time.Time
+	Uptime             time.Duration
+	ModelPlugins       []string
+	DecisionPlugins    []string
+	ActiveTransactions int
+	// PluginLoadReport tells whether each configured plugin was loaded
+	// at Init, along with its version and checksum
+	PluginLoadReport []pm.PluginLoadEvent
+	// DisabledPlugins are the plugins disabled at runtime
+	DisabledPlugins []pm.DisabledPlugin
+	// PluginErrors maps the ID of each configured plugin that could not
+	// be loaded to why
+	PluginErrors map[string]string
+	// ServiceChecks are the last reachability checks of the external
+	// services the loaded plugins depend on
+	ServiceChecks []pm.ServiceCheck
+	// PluginHealth are the last health checks of the plugins
+	PluginHealth []pm.PluginHealth
+	// WorkerPools are the use of the worker pools of the model
+	// affinities
+	WorkerPools []pm.WorkerPoolUsage
+	// NATSState is the state of the connection to the NATS server, such
+	// as connected or reconnecting, and empty without one
+	NATSState string
+}
+
+// Status returns the status of the running WACE instance
+func Status() (StatusReport, error) {
+	if defaultCore.plugins.Load() == nil {
+		return StatusReport{}, fmt.Errorf("wace is not initialized")
+	}
+	return defaultCore.Status(), nil
+}
+
+// Status is like the Status function
+func (c *Core) Status() StatusReport {
+	set := c.plugins.Load()
+	p := set.manager
+	active := 0
+	c.analysisMap.Range(func(key, value interface{}) bool {
+		active++
+		return true
+	})
+	var pluginErrors map[string]string
+	if loadErr := p.LoadError(); loadErr != nil {
+		pluginErrors = loadErr.Plugins
+	}
+	return StatusReport{
+		Started:            set.started,
+		Uptime:             time.Since(set.started),
+		ModelPlugins:       p.ModelPluginIDs(),
+		DecisionPlugins:    p.DecisionPluginIDs(),
+		ActiveTransactions: active,
+		PluginLoadReport:   p.LoadReport(),
+		DisabledPlugins:    p.DisabledPlugins(),
+		PluginErrors:       pluginErrors,
+		ServiceChecks:      p.ServiceChecks(),
+		PluginHealth:       p.PluginHealth(),
+		WorkerPools:        p.WorkerPools(),
+		NATSState:          p.NATSState(),
+	}
+}
+
+// Ready returns an error if the instance should not receive traffic
+// yet, because an external service a loaded plugin depends on is
+// unreachable
+func Ready() error {
+	if defaultCore.plugins.Load() == nil {
+		return fmt.Errorf("wace is not initialized")
+	}
+	return defaultCore.Ready()
+}
+
+// Ready is like the Ready function
+func (c *Core) Ready() error {
+	return c.plugins.Load().manager.Ready()
+}
+
+// DisablePlugin disables the model or decision plugin (kind is
+// pm.ModelPluginKind or pm.DecisionPluginKind) with the given ID at
+// runtime, without unloading it. A disabled model plugin is skipped and
+// counted with the disabled reason, and a disabled decision plugin
+// gives the verdict of its fallback, tagged with pm.DisabledTag. The
+// plugin stays disabled across reloads until enabled with EnablePlugin.
+func DisablePlugin(kind, id, reason string) error {
+	if defaultCore.plugins.Load() == nil {
+		return fmt.Errorf("wace is not initialized")
+	}
+	return defaultCore.DisablePlugin(kind, id, reason)
+}
+
+// DisablePlugin is like the DisablePlugin function
+func (c *Core) DisablePlugin(kind, id, reason string) error {
+	c.reloadMutex.Lock()
+	defer c.reloadMutex.Unlock()
+	return c.plugins.Load().manager.DisablePlugin(kind, id, reason)
+}
+
+// EnablePlugin enables a plugin disabled with DisablePlugin
+func EnablePlugin(kind, id string) error {
+	if defaultCore.plugins.Load() == nil {
+		return fmt.Errorf("wace is not initialized")
+	}
+	return defaultCore.EnablePlugin(kind, id)
+}
+
+// EnablePlugin is like the EnablePlugin function
+func (c *Core) EnablePlugin(kind, id string) error {
+	c.reloadMutex.Lock()
+	defer c.reloadMutex.Unlock()
+	return c.plugins.Load().manager.EnablePlugin(kind, id)
+}
+
+// Shutdown releases the plugins of the default core, calling the
+// ShutdownPlugin function of the shared object plugins, and stops its
+// background jobs and the analytics export, the webhooks and the audit
+// events, writing those pending. Connectors should call it on shutdown,
+// once their transactions are closed. It returns the first error found.
+func Shutdown() error {
+	return defaultCore.Shutdown()
+}
+
+// Shutdown is like the Shutdown function. The core must not be used
+// afterwards.
+func (c *Core) Shutdown() error {
+	c.reloadMutex.Lock()
+	defer c.reloadMutex.Unlock()
+	var err error
+	if set := c.plugins.Load(); set != nil {
+		err = set.close()
+	}
+	for _, stop := range []*chan struct{}{&c.geoStop, &c.reanalysisStop, &c.campaignsStop} {
+		if *stop != nil {
+			close(*stop)
+			*stop = nil
+		}
+	}
+	if exportErr := c.StopExport(); err == nil {
+		err = exportErr
+	}
+	c.StopWebhooks()
+	if auditErr := c.StopAudit(); err == nil {
+		err = auditErr
+	}
+	return err
+}
+
+// Reload validates and applies the given configuration, and reloads
+// the plugins with the meter given to Init. If the plugins cannot be
+// reloaded, the configuration in use is rolled back.
+func Reload(inConf cf.ConfigFileData) error {
+	if err := cf.ValidateConfig(inConf); err != nil {
+		return err
+	}
+	return reload(func() (bool, error) {
+		return true, cf.SetConfig(inConf)
+	})
+}
+
+// reload applies a change of the configuration in use and, if change
+// returns true, reloads the plugins with the meter given to Init, one
+// reload at a time, so that the plugins in use are those of the
+// configuration in use. If the plugins cannot be reloaded, the change is
+// rolled back.
+func reload(change func() (bool, error)) error {
+	defaultCore.reloadMutex.Lock()
+	defer defaultCore.reloadMutex.Unlock()
+	structural, err := change()
+	if err != nil || !structural {
+		return err
+	}
+	if err := initCore(defaultCore.meter()); err != nil {
+		if _, rollbackErr := cf.Rollback(); rollbackErr != nil {
+			lg.Get().Printf(lg.ERROR, "core | could not roll back the configuration: %v", rollbackErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// RollbackConfig reverts to the configuration in use before the last
+// reload or tuning change, kept resident so that it is neither read nor
+// checked again, and reloads the plugins with the meter given to Init
+// unless only the weights and thresholds of the models differ. A second
+// call undoes the rollback.
+func RollbackConfig() error {
+	if defaultCore.plugins.Load() == nil {
+		return fmt.Errorf("wace is not initialized")
+	}
+	return reload(cf.Rollback)
+}
+
+// WatchConfig watches the configuration file at path and applies its
+// changes as it is saved: the changes of the weights and thresholds of
+// the models only are applied at once, and the other ones reload the
+// plugins like Reload. The invalid changes are logged and ignored. It
+// returns the function stopping the watch.
+func WatchConfig(path string) (func() error, error) {
+	w, err := cf.Watch(path)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		logger := lg.Get()
+		for change := range w.Changes() {
+			if !change.Structural {
+				if err := reload(func() (bool, error) { return false, cf.ApplyTuning(change.Config) }); err != nil {
+					logger.Printf(lg.ERROR, "core | could not apply the model weights of %s: %v", path, err)
+					continue
+				}
+				logger.Printf(lg.INFO, "core | model weights and thresholds reloaded from %s", path)
+				continue
+			}
+			if err := Reload(change.File); err != nil {
+				logger.Printf(lg.ERROR, "core | could not reload %s: %v", path, err)
+				continue
+			}
+			logger.Printf(lg.INFO, "core | configuration and plugins reloaded from %s", path)
+		}
+	}()
+	return w.Close, nil
+}
@@ -0,0 +1,126 @@
+package wace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+)
+
+func TestWatchConfig(t *testing.T) {
+	config := `---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: protocol
+    kind: builtin
+    weight: 1
+    plugintype: RequestHeaders
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`
+	path := filepath.Join(t.TempDir(), "wace.yaml")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := initilize([]byte(config)); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+	stop, err := WatchConfig(path)
+	if err != nil {
+		t.Fatalf("WatchConfig returned error: %v", err)
+	}
+	defer stop()
+	before := defaultCore.plugins.Load()
+
+	config = strings.Replace(config, "weight: 1", "weight: 0.25", 1)
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline) && cf.Snapshot().ModelPlugins["protocol"].Weight != 0.25; time.Sleep(10 * time.Millisecond) {
+	}
+	if weight := cf.Snapshot().ModelPlugins["protocol"].Weight; weight != 0.25 || defaultCore.plugins.Load() != before {
+		t.Errorf("weight change applied as %v, plugins reloaded: %t", weight, defaultCore.plugins.Load() != before)
+	}
+
+	config += "  - id: strict\n    kind: builtin\n    builtin: combiner\n"
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var status StatusReport
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if status, _ = Status(); len(status.DecisionPlugins) == 2 {
+			break
+		}
+	}
+	if len(status.DecisionPlugins) != 2 {
+		t.Errorf("decision plugins after adding one are %v", status.DecisionPlugins)
+	}
+}
+
+func TestRollbackConfig(t *testing.T) {
+	config := `---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: protocol
+    kind: builtin
+    weight: 1
+    plugintype: RequestHeaders
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`
+	if err := initilize([]byte(config)); err != nil {
+		t.Fatalf("Init returned error: %v", err)
+	}
+	inConf, err := cf.ParseConfig([]byte(config + "  - id: strict\n    kind: builtin\n    builtin: combiner\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(inConf); err != nil {
+		t.Fatalf("Reload returned error: %v", err)
+	}
+
+	if err := RollbackConfig(); err != nil {
+		t.Fatalf("RollbackConfig returned error: %v", err)
+	}
+	if status, _ := Status(); len(status.DecisionPlugins) != 1 || len(cf.Snapshot().DecisionPlugins) != 1 {
+		t.Errorf("decision plugins after the rollback are %v", status.DecisionPlugins)
+	}
+	if err := RollbackConfig(); err != nil {
+		t.Fatalf("second RollbackConfig returned error: %v", err)
+	}
+	if status, _ := Status(); len(status.DecisionPlugins) != 2 {
+		t.Errorf("decision plugins after undoing the rollback are %v", status.DecisionPlugins)
+	}
+
+	// a tuning change is rolled back without reloading the plugins
+	before := defaultCore.plugins.Load()
+	if err := cf.SetModelWeight("protocol", 0.1); err != nil {
+		t.Fatalf("SetModelWeight returned error: %v", err)
+	}
+	if err := RollbackConfig(); err != nil {
+		t.Fatalf("RollbackConfig returned error: %v", err)
+	}
+	if weight := cf.Snapshot().ModelPlugins["protocol"].Weight; weight != 1 || defaultCore.plugins.Load() != before {
+		t.Errorf("weight rolled back to %v, plugins reloaded: %t", weight, defaultCore.plugins.Load() != before)
+	}
+
+	// a reload that cannot load the plugins keeps the configuration of
+	// the plugins in use
+	inConf, err = cf.ParseConfig([]byte(config + "  - id: broken\n    kind: builtin\n    builtin: nosuchdecision\nstrictplugins: true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(inConf); err == nil {
+		t.Errorf("Reload of a broken plugin with strictplugins returned no error")
+	}
+	if conf := cf.Snapshot(); conf.StrictPlugins || defaultCore.plugins.Load() != before {
+		t.Errorf("failed reload applied strictplugins %t, plugins reloaded: %t", conf.StrictPlugins, defaultCore.plugins.Load() != before)
+	}
+}
@@ -0,0 +1,115 @@
+package wace
+
+import (
+	"sync"
+
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// tenantMetrics are the instruments and attributes used to record the
+// metrics of the transactions of a tenant
+type tenantMetrics struct {
+	instruments *pm.Instruments
+	attributes  []attribute.KeyValue
+}
+
+// Sync map with the metrics registered for each tenant
+var tenantMap sync.Map
+
+// RegisterTenantMeter makes the metrics of the transactions of the
+// given tenant be recorded with met, so they can be exported to a
+// different backend than the meter given to Init, and with the given
+// attributes added to every measurement. Tenants are selected per
+// transaction with TransactionOptions. Registering a tenant again
+// replaces its meter.
+func RegisterTenantMeter(tenant string, met metric.Meter, attributes ...attribute.KeyValue) {
+	tenantMap.Store(tenant, &tenantMetrics{
+		instruments: pm.NewInstruments(met),
+		attributes:  append([]attribute.KeyValue(nil), attributes...),
+	})
+}
+
+// UnregisterTenantMeter makes the metrics of the given tenant be
+// recorded with the meter given to Init again
+func UnregisterTenantMeter(tenant string) {
+	tenantMap.Delete(tenant)
+}
+
+// transactionProfile returns the profile of the transaction given in
+// TransactionOptions, or "" if none
+func (c *Core) transactionProfile(transactionID string) string {
+	if value, ok := c.transactionProfiles.Load(transactionID); ok {
+		return value.(string)
+	}
+	return ""
+}
+
+// profileDefaults returns the decision plugin and wafParams of a check
+// of the transaction, completed with the defaults of its profile: the
+// profile decision plugin if none is given, and the profile wafParams
+// and those taken from the metadata for the keys not given
+func (c *Core) profileDefaults(transactionID, decisionPlugin string, wafParams map[string]string) (string, map[string]string) {
+	profile := c.config().Profile(c.transactionProfile(transactionID))
+	if decisionPlugin == "" {
+		decisionPlugin = profile.Decision
+	}
+	if len(profile.WAFParams) == 0 && len(profile.MetaParams) == 0 {
+		return decisionPlugin, wafParams
+	}
+	params := make(map[string]string, len(wafParams)+len(profile.WAFParams)+len(profile.MetaParams))
+	for key, value := range profile.WAFParams {
+		params[key] = value
+	}
+	meta := c.TransactionMetadata(transactionID)
+	for key, metaKey := range profile.MetaParams {
+		if value, ok := meta[metaKey]; ok {
+			params[key] = value
+		}
+	}
+	for key, value := range wafParams {
+		params[key] = value
+	}
+	return decisionPlugin, params
+}
+
+// transactionContext returns the context of the transaction given to
+// the decision plugins
+func (c *Core) transactionContext(transactionID string) pm.TransactionContext {
+	tc := pm.TransactionContext{
+		Profile:  c.transactionProfile(transactionID),
+		Metadata: c.TransactionMetadata(transactionID),
+	}
+	if value, ok := c.transactionTenants.Load(transactionID); ok {
+		tc.Tenant = value.(string)
+	}
+	if value, ok := c.transactionTags.Load(transactionID); ok {
+		tc.Tags = append([]string(nil), value.([]string)...)
+	}
+	return tc
+}
+
+// transactionMetrics returns the instruments and the attributes to
+// record the metrics of the transaction with. Transactions of a tenant
+// without a registered meter use the instruments of their core with a
+// tenant attribute.
+func (c *Core) transactionMetrics(transactionID string) (*pm.Instruments, []attribute.KeyValue) {
+	var inst *pm.Instruments
+	if set := c.pluginsOf(transactionID); set != nil {
+		inst = set.instruments
+	}
+	attributes := append([]attribute.KeyValue(nil), c.attributes...)
+	value, ok := c.transactionTenants.Load(transactionID)
+	if !ok {
+		return inst, attributes
+	}
+	tenant := value.(string)
+	attributes = append(attributes, attribute.String("tenant", tenant))
+	if value, ok := tenantMap.Load(tenant); ok {
+		tm := value.(*tenantMetrics)
+		return tm.instruments, append(attributes, tm.attributes...)
+	}
+	return inst, attributes
+}
@@ -0,0 +1,45 @@
+package wace
+
+import (
+	"context"
+	"testing"
+
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestTenantMeter(t *testing.T) {
+	previous := defaultCore.plugins.Swap(&pluginSet{instruments: pm.NewInstruments(testMeter)})
+	defer defaultCore.plugins.Store(previous)
+	reader := metric.NewManualReader()
+	tenantMeter := metric.NewMeterProvider(metric.WithReader(reader)).Meter("tenant")
+	RegisterTenantMeter("acme", tenantMeter, attribute.String("profile", "strict"))
+	defer UnregisterTenantMeter("acme")
+
+	id := generateRandomID()
+	defaultCore.transactionTenants.Store(id, "acme")
+	defer defaultCore.transactionTenants.Delete(id)
+	defaultCore.recordSkippedModel(id, "model", "test")
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect returned error: %v", err)
+	}
+	if len(rm.ScopeMetrics) != 1 || len(rm.ScopeMetrics[0].Metrics) != 1 {
+		t.Fatalf("tenant meter has metrics %+v", rm.ScopeMetrics)
+	}
+	sum := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Sum[int64])
+	attrs := sum.DataPoints[0].Attributes
+	if v, _ := attrs.Value("tenant"); v.AsString() != "acme" {
+		t.Errorf("tenant attribute is %q", v.AsString())
+	}
+	if v, _ := attrs.Value("profile"); v.AsString() != "strict" {
+		t.Errorf("profile attribute is %q", v.AsString())
+	}
+
+	if inst, attributes := defaultCore.transactionMetrics(generateRandomID()); inst != defaultCore.plugins.Load().instruments || attributes != nil {
+		t.Errorf("transaction without tenant does not use the global instruments")
+	}
+}
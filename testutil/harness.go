@@ -0,0 +1,119 @@
+package testutil
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	wace "github.com/tiroa-tilsor/wacelib"
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// ResultsTimeout is the time WaitResults waits for the results of the
+// models
+const ResultsTimeout = 5 * time.Second
+
+// harnesses numbers the harnesses of the process, so that the names of
+// their cores and the IDs of their transactions are unique
+var harnesses atomic.Int64
+
+// Harness is a WACE core connected to an embedded NATS server
+type Harness struct {
+	// NATS is the embedded NATS server
+	NATS *server.Server
+	// Core is the WACE instance, whose natsurl is the URL of the server
+	Core *wace.Core
+
+	tb           testing.TB
+	name         string
+	transactions atomic.Int64
+}
+
+// New starts a NATS server and a core with the given YAML configuration,
+// both shut down at the end of the test. The natsurl of the
+// configuration is replaced by the URL of the server, and the log goes
+// to /dev/null with the ERROR level unless the configuration sets it.
+// New returns once the core listens to the results of its worker
+// models.
+func New(tb testing.TB, config string) *Harness {
+	tb.Helper()
+	inConf, err := cf.ParseConfig([]byte(config))
+	if err != nil {
+		tb.Fatalf("invalid configuration: %v", err)
+	}
+	h := &Harness{NATS: StartNATS(tb), tb: tb, name: fmt.Sprintf("testutil-%d", harnesses.Add(1))}
+	inConf.NatsURL = h.NATS.ClientURL()
+	if inConf.Logpath == "" {
+		inConf.Logpath = "/dev/null"
+	}
+	if inConf.Loglevel == "" {
+		inConf.Loglevel = "ERROR"
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		tb.Fatalf("invalid configuration: %v", err)
+	}
+	h.Core = wace.NewCore(h.name, conf, noop.NewMeterProvider().Meter(h.name))
+	tb.Cleanup(func() { h.Core.Shutdown() })
+	for id, modelConfig := range conf.ModelPlugins {
+		if modelConfig.Kind == cf.WorkerPlugin && !modelConfig.RequestReply {
+			waitInterest(tb, h.NATS, pm.ModelResultsSubject(id))
+		}
+	}
+	return h
+}
+
+// URL returns the URL of the NATS server
+func (h *Harness) URL() string {
+	return h.NATS.ClientURL()
+}
+
+// Worker serves the model with the given ID with process on the NATS
+// server of the harness, like ServeWorker
+func (h *Harness) Worker(modelID string, process func(pm.ModelInput) (pm.ModelResults, error)) *Worker {
+	h.tb.Helper()
+	return ServeWorker(h.tb, h.URL(), modelID, process)
+}
+
+// Transaction initializes a transaction of the core with a new ID,
+// closed at the end of the test, and returns its ID
+func (h *Harness) Transaction() string {
+	id := fmt.Sprintf("%s-tx-%d", h.name, h.transactions.Add(1))
+	h.Core.InitTransaction(id)
+	h.tb.Cleanup(func() { h.Core.CloseTransaction(id) })
+	return id
+}
+
+// WaitResults waits for the given models to have results in the
+// transaction, e.g. the async ones, and returns the results of the
+// transaction. It fails the test if they have none after
+// ResultsTimeout.
+func (h *Harness) WaitResults(transactionID string, models ...string) wace.TransactionResults {
+	h.tb.Helper()
+	deadline := time.Now().Add(ResultsTimeout)
+	for {
+		res, err := h.Core.GetTransactionResults(transactionID)
+		if err != nil {
+			h.tb.Fatalf("GetTransactionResults returned error: %v", err)
+		}
+		missing := ""
+		for _, id := range models {
+			if _, ok := res.Results[id]; !ok {
+				missing = id
+				break
+			}
+		}
+		if missing == "" {
+			return res
+		}
+		if time.Now().After(deadline) {
+			h.tb.Fatalf("no results of model %s after %v", missing, ResultsTimeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Package testutil runs the WACE flows that depend on a NATS server end
+to end in Go tests, with no external infrastructure: it embeds a NATS
+server in the test process, serves mock remote workers on it, and
+connects a WACE core to it, so that the sync, async and request-reply
+calls of the remote models are covered in CI. A test typically runs:
+
+	h := testutil.New(t, config)
+	h.Worker("roberta", testutil.Score(0.9))
+	id := h.Transaction()
+	err := h.Core.Analyze("RequestBody", id, payload, []string{"roberta"})
+	verdict, err := h.Core.CheckTransactionVerdict(id, "combiner", nil)
+*/
+package testutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// startTimeout is the time given to the embedded NATS server to accept
+// connections, and to the subscriptions to be seen by the server
+const startTimeout = 5 * time.Second
+
+// StartNATS starts a NATS server in the process, listening on a random
+// port of the loopback interface, shut down at the end of the test. Its
+// URL is the ClientURL of the server.
+func StartNATS(tb testing.TB) *server.Server {
+	tb.Helper()
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, NoLog: true, NoSigs: true})
+	if err != nil {
+		tb.Fatalf("cannot create the NATS server: %v", err)
+	}
+	go s.Start()
+	tb.Cleanup(s.Shutdown)
+	if !s.ReadyForConnections(startTimeout) {
+		tb.Fatalf("NATS server not ready after %v", startTimeout)
+	}
+	return s
+}
+
+// waitInterest waits for a client of the server to subscribe to the
+// subject, failing the test if none does in time
+func waitInterest(tb testing.TB, s *server.Server, subject string) {
+	tb.Helper()
+	deadline := time.Now().Add(startTimeout)
+	for !s.GlobalAccount().SubscriptionInterest(subject) {
+		if time.Now().After(deadline) {
+			tb.Fatalf("no subscription to %s after %v", subject, startTimeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
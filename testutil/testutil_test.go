@@ -0,0 +1,113 @@
+package testutil
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+func TestMain(m *testing.M) {
+	lg.Get().LoadLoggerWriter(io.Discard, lg.ERROR)
+	os.Exit(m.Run())
+}
+
+const config = `---
+modelplugins:
+  - id: roberta
+    kind: worker
+    plugintype: RequestBody
+    weight: 1
+    timeout: 5s
+  - id: bert
+    kind: worker
+    plugintype: RequestBody
+    weight: 1
+    timeout: 5s
+    requestreply: true
+  - id: llm
+    kind: worker
+    mode: async
+    plugintype: RequestBody
+    weight: 1
+decisionplugins:
+  - id: combiner
+    kind: builtin
+    params:
+      threshold: "0.5"
+includeasyncresults: true
+`
+
+func TestSyncWorker(t *testing.T) {
+	h := New(t, config)
+	worker := h.Worker("roberta", Score(0.9))
+
+	id := h.Transaction()
+	if err := h.Core.Analyze("RequestBody", id, "q=' or '1'='1", []string{"roberta"}); err != nil {
+		t.Fatalf("Analyze returned error: %v", err)
+	}
+	verdict, err := h.Core.CheckTransactionVerdict(id, "combiner", nil)
+	if err != nil || !verdict.Block {
+		t.Errorf("verdict is %+v, %v", verdict, err)
+	}
+	if inputs := worker.Inputs(); len(inputs) != 1 || inputs[0].Payload != "q=' or '1'='1" {
+		t.Errorf("worker inputs are %+v", inputs)
+	}
+	if res := h.WaitResults(id, "roberta"); res.Results["roberta"].ProbAttack != 0.9 {
+		t.Errorf("results are %+v", res)
+	}
+}
+
+func TestRequestReplyWorker(t *testing.T) {
+	h := New(t, config)
+	h.Worker("bert", Score(0.1))
+
+	id := h.Transaction()
+	if err := h.Core.Analyze("RequestBody", id, "q=shoes", []string{"bert"}); err != nil {
+		t.Fatalf("Analyze returned error: %v", err)
+	}
+	verdict, err := h.Core.CheckTransactionVerdict(id, "combiner", nil)
+	if err != nil || verdict.Block {
+		t.Errorf("verdict is %+v, %v", verdict, err)
+	}
+	if res := h.WaitResults(id, "bert"); res.Results["bert"].ProbAttack != 0.1 {
+		t.Errorf("results are %+v", res)
+	}
+}
+
+func TestAsyncWorker(t *testing.T) {
+	h := New(t, config)
+	h.Worker("llm", Score(0.7))
+
+	id := h.Transaction()
+	if err := h.Core.Analyze("RequestBody", id, "q=shoes", []string{"llm"}); err != nil {
+		t.Fatalf("Analyze returned error: %v", err)
+	}
+	if res := h.WaitResults(id, "llm"); res.Results["llm"].ProbAttack != 0.7 {
+		t.Errorf("results are %+v", res)
+	}
+}
+
+func TestWorkerFailure(t *testing.T) {
+	h := New(t, config)
+	h.Worker("roberta", func(pm.ModelInput) (pm.ModelResults, error) {
+		return pm.ModelResults{}, errors.New("model unavailable")
+	})
+
+	// no worker serves bert
+	id := h.Transaction()
+	if err := h.Core.Analyze("RequestBody", id, "q=shoes", []string{"roberta", "bert"}); err != nil {
+		t.Fatalf("Analyze returned error: %v", err)
+	}
+	if _, err := h.Core.CheckTransactionVerdict(id, "combiner", nil); err != nil {
+		t.Fatalf("CheckTransactionVerdict returned error: %v", err)
+	}
+	res, err := h.Core.GetTransactionResults(id)
+	if err != nil || len(res.Results) != 0 {
+		t.Errorf("results of the failed models are %+v, %v", res, err)
+	}
+}
@@ -0,0 +1,68 @@
+package testutil
+
+import (
+	"sync"
+	"testing"
+
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+	"github.com/tiroa-tilsor/wacelib/remoteworker"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Worker is a mock remote worker of a model, serving it with the
+// remoteworker package on a connection of its own
+type Worker struct {
+	ModelID string
+	conn    *nats.Conn
+
+	mutex  sync.Mutex
+	inputs []pm.ModelInput
+}
+
+// ServeWorker serves the model with the given ID with process on the
+// NATS server at url until the end of the test or Stop. The worker is
+// subscribed when it returns.
+func ServeWorker(tb testing.TB, url, modelID string, process func(pm.ModelInput) (pm.ModelResults, error)) *Worker {
+	tb.Helper()
+	nc, err := nats.Connect(url)
+	if err != nil {
+		tb.Fatalf("worker %s cannot connect to NATS: %v", modelID, err)
+	}
+	w := &Worker{ModelID: modelID, conn: nc}
+	tb.Cleanup(w.Stop)
+	_, err = remoteworker.Serve(nc, modelID, func(input pm.ModelInput) (pm.ModelResults, error) {
+		w.mutex.Lock()
+		w.inputs = append(w.inputs, input)
+		w.mutex.Unlock()
+		return process(input)
+	})
+	if err == nil {
+		err = nc.Flush()
+	}
+	if err != nil {
+		tb.Fatalf("worker %s cannot subscribe: %v", modelID, err)
+	}
+	return w
+}
+
+// Inputs returns the inputs received by the worker so far
+func (w *Worker) Inputs() []pm.ModelInput {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return append([]pm.ModelInput(nil), w.inputs...)
+}
+
+// Stop closes the connection of the worker, so that it serves no more
+// inputs once the server sees it closed
+func (w *Worker) Stop() {
+	w.conn.Close()
+}
+
+// Score returns a model process function answering the given attack
+// probability for every input
+func Score(probAttack float64) func(pm.ModelInput) (pm.ModelResults, error) {
+	return func(pm.ModelInput) (pm.ModelResults, error) {
+		return pm.ModelResults{ProbAttack: probAttack}, nil
+	}
+}
@@ -0,0 +1,46 @@
+package wace
+
+import (
+	"fmt"
+	"strings"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// UnknownModelsError is returned by Analyze with the fail unknown
+// models policy when it is given model IDs that are not configured
+type UnknownModelsError struct {
+	Models []string
+}
+
+func (e *UnknownModelsError) Error() string {
+	return fmt.Sprintf("unknown model plugins: %s", strings.Join(e.Models, ", "))
+}
+
+// resolveModels applies the unknown models policy to the models given
+// to Analyze. It returns the models to call and the unknown ones.
+func (c *Core) resolveModels(conf *cf.ConfigStore, transactionId string, t cf.ModelPluginType, models []string) ([]string, []string, error) {
+	var known, unknown []string
+	for _, id := range models {
+		if _, ok := conf.ModelPlugins[id]; ok {
+			known = append(known, id)
+		} else {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(unknown) == 0 {
+		return models, nil, nil
+	}
+	c.tprintf(lg.WARN, transactionId, "core | unknown model plugins %s, applying the %s policy", strings.Join(unknown, ", "), conf.UnknownModels.Policy)
+	switch conf.UnknownModels.Policy {
+	case cf.UnknownModelsFail:
+		return nil, unknown, &UnknownModelsError{Models: unknown}
+	case cf.UnknownModelsSubstitute:
+		if id, ok := conf.UnknownModels.Defaults[t]; ok && !containsString(known, id) {
+			known = append(known, id)
+		}
+	}
+	return known, unknown, nil
+}
@@ -0,0 +1,67 @@
+package wace
+
+import (
+	"errors"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestUnknownModels(t *testing.T) {
+	for policy, want := range map[string][]string{
+		cf.UnknownModelsContinue:   {"protocol"},
+		cf.UnknownModelsSubstitute: {"fallback", "protocol"},
+		cf.UnknownModelsFail:       nil,
+	} {
+		var inConf cf.ConfigFileData
+		err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: protocol
+    kind: builtin
+    plugintype: RequestHeaders
+  - id: fallback
+    kind: builtin
+    builtin: protocol
+    plugintype: RequestHeaders
+unknownmodels:
+  policy: `+policy+`
+  defaults:
+    RequestHeaders: fallback
+`), &inConf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf, err := cf.Load(inConf)
+		if err != nil {
+			t.Fatalf("Load returned error: %v", err)
+		}
+		engine := NewCore(policy, conf, testMeter)
+		id := generateRandomID()
+		engine.InitTransaction(id)
+
+		receipt, err := AnalyzeWithReceipt("RequestHeaders", id, "GET / HTTP/1.1\nHost: example.com\n", []string{"protocol", "typo"})
+		var unknownErr *UnknownModelsError
+		if (policy == cf.UnknownModelsFail) != errors.As(err, &unknownErr) {
+			t.Errorf("%s policy returned error %v", policy, err)
+		}
+		if unknown := receipt.UnknownModels(); len(unknown) != 1 || unknown[0] != "typo" {
+			t.Errorf("%s policy receipt has unknown models %v", policy, unknown)
+		}
+		receipt.Wait()
+		engine.waitAnalysis(id)
+		results, _ := engine.plugins.Load().manager.TransactionResults(engine.scope(id))
+		if len(results) != len(want) {
+			t.Errorf("%s policy called %v, expected %v", policy, results, want)
+		}
+		for _, model := range want {
+			if _, ok := results[model]; !ok {
+				t.Errorf("%s policy did not call %s", policy, model)
+			}
+		}
+		CloseTransaction(id)
+	}
+}
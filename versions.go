@@ -0,0 +1,73 @@
+package wace
+
+import (
+	"hash/fnv"
+	"strings"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// resolveVersions replaces the logical model names given to Analyze by
+// the ID of the version of the model analyzing the transaction: the one
+// named as "name@version", else the pinned version, else one picked by
+// the traffic split of the versions of type t. The pick only depends on
+// the transaction ID, so all the parts of a transaction are analyzed by
+// the same version. The names that cannot be resolved are left as they
+// are.
+func (c *Core) resolveVersions(conf *cf.ConfigStore, transactionId string, t cf.ModelPluginType, models []string) []string {
+	var resolved []string
+	for i, name := range models {
+		id, ok := resolveVersion(conf, transactionId, t, name)
+		if !ok {
+			if resolved != nil {
+				resolved = append(resolved, name)
+			}
+			continue
+		}
+		if resolved == nil {
+			resolved = append([]string(nil), models[:i]...)
+		}
+		c.tprintf(lg.DEBUG, transactionId, "core | model %s served by %s", name, id)
+		resolved = append(resolved, id)
+	}
+	if resolved == nil {
+		return models
+	}
+	return resolved
+}
+
+// resolveVersion returns the ID of the version of the model that
+// analyzes the transaction, if name is a logical model name
+func resolveVersion(conf *cf.ConfigStore, transactionId string, t cf.ModelPluginType, name string) (string, bool) {
+	if _, ok := conf.ModelPlugins[name]; ok {
+		return "", false
+	}
+	if model, version, found := strings.Cut(name, "@"); found {
+		return conf.VersionID(model, version)
+	}
+	if version, ok := conf.PinnedVersions[name]; ok {
+		return conf.VersionID(name, version)
+	}
+	var ids []string
+	total := 0.0
+	for _, id := range conf.ModelVersions(name) {
+		if modelConfig := conf.ModelPlugins[id]; modelConfig.PluginType == t && modelConfig.Traffic > 0 {
+			ids = append(ids, id)
+			total += modelConfig.Traffic
+		}
+	}
+	if len(ids) == 0 {
+		return "", false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(transactionId + "/" + name))
+	pick := float64(h.Sum64()>>11) / float64(1<<53) * total
+	for _, id := range ids {
+		if pick -= conf.ModelPlugins[id].Traffic; pick < 0 {
+			return id, true
+		}
+	}
+	return ids[len(ids)-1], true
+}
@@ -0,0 +1,79 @@
+package wace
+
+import (
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestModelVersions(t *testing.T) {
+	var inConf cf.ConfigFileData
+	err := yaml.Unmarshal([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: sim-v1
+    kind: builtin
+    builtin: simulated
+    plugintype: RequestHeaders
+    model: sim
+    version: v1
+    traffic: 0
+  - id: sim-v2
+    kind: builtin
+    builtin: simulated
+    plugintype: RequestHeaders
+    model: sim
+    version: v2
+decisionplugins:
+  - id: combiner
+    kind: builtin
+`), &inConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	engine := NewCore("versions", conf, testMeter)
+	inConf.Pinnedversions = map[string]string{"sim": "v1"}
+	pinnedConf, err := cf.Load(inConf)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	pinned := NewCore("versions-pinned", pinnedConf, testMeter)
+
+	analyzedBy := func(engine *Core, model string) map[string]bool {
+		id := generateRandomID()
+		engine.InitTransaction(id)
+		defer CloseTransaction(id)
+		if err := Analyze("RequestHeaders", id, "GET / HTTP/1.1\n", []string{model}); err != nil {
+			t.Fatalf("Analyze returned error: %v", err)
+		}
+		if _, err := CheckTransaction(id, "combiner", nil); err != nil {
+			t.Fatalf("CheckTransaction returned error: %v", err)
+		}
+		res, _ := GetTransactionResults(id)
+		ids := make(map[string]bool)
+		for modelID := range res.Results {
+			ids[modelID] = true
+		}
+		return ids
+	}
+
+	for i := 0; i < 10; i++ {
+		if ids := analyzedBy(engine, "sim"); !ids["sim-v2"] || len(ids) != 1 {
+			t.Fatalf("transaction analyzed by %v, expected only the version with traffic", ids)
+		}
+	}
+	if ids := analyzedBy(engine, "sim@v1"); !ids["sim-v1"] || len(ids) != 1 {
+		t.Errorf("transaction analyzed by %v, expected the explicit version", ids)
+	}
+
+	if ids := analyzedBy(pinned, "sim"); !ids["sim-v1"] || len(ids) != 1 {
+		t.Errorf("transaction analyzed by %v, expected the pinned version", ids)
+	}
+}
@@ -4,8 +4,11 @@ The main package of WACE.
 package wace
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -23,9 +26,7 @@ import (
 	"go.opentelemetry.io/otel/metric"
 )
 
-var plugins *pm.PluginManager
 var ctx = context.Background()
-var meter metric.Meter
 
 // transactionSync is a struct to syncronize the analysis of a given
 // transaction. Each time callPlugins is executed, the counter is
@@ -37,229 +38,1013 @@ var meter metric.Meter
 type transactionSync struct {
 	Channel chan string
 	Counter int64
+	// Analyzed is set once any model is called on the transaction
+	Analyzed atomic.Bool
+	// closed is closed with the transaction, so the analyses still
+	// running stop reporting to it
+	closed chan struct{}
+	// plugins is the plugin set the transaction is pinned to
+	plugins *pluginSet
+	// pending counts the sync models called and not finished yet
+	mutex   sync.Mutex
+	pending map[string]int
 }
 
-var (
-	// Sync map witg channels to receive a notification when all plugins finish
-	// processing a transaction
-	analysisMap sync.Map
-)
+// newTransactionSync creates the synchronization of a transaction
+// whose analysis was started counter times
+func newTransactionSync(counter int64) *transactionSync {
+	return &transactionSync{
+		Channel: make(chan string),
+		Counter: counter,
+		closed:  make(chan struct{}),
+		pending: make(map[string]int),
+	}
+}
+
+// addPending records sync models called on the transaction
+func (s *transactionSync) addPending(models []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, id := range models {
+		s.pending[id]++
+	}
+}
+
+// donePending records a sync model of the transaction that finished
+func (s *transactionSync) donePending(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.pending[id]--; s.pending[id] <= 0 {
+		delete(s.pending, id)
+	}
+}
+
+// pendingModels returns the sorted sync models of the transaction that
+// did not finish yet
+func (s *transactionSync) pendingModels() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	models := make([]string, 0, len(s.pending))
+	for id := range s.pending {
+		models = append(models, id)
+	}
+	sort.Strings(models)
+	return models
+}
 
 // addTransactionAnalysis adds a transaction to the analysis map. If the
 // transaction already exists, it increments the counter of the transaction
 // by one.
-func addTransactionAnalysis(transactionID string) {
-	tSync := transactionSync{
-		Channel: make(chan string),
-		Counter: 1,
-	}
-	value, loaded := analysisMap.LoadOrStore(transactionID, &tSync)
+func (c *Core) addTransactionAnalysis(transactionID string) {
+	tSync := newTransactionSync(1)
+	tSync.Analyzed.Store(true)
+	value, loaded := c.analysisMap.LoadOrStore(transactionID, tSync)
 	if loaded {
+		value.(*transactionSync).Analyzed.Store(true)
 		atomic.AddInt64(&value.(*transactionSync).Counter, 1)
 	}
 }
 
+// queueModel adds the input to the queue of the remote model, reporting
+// to status if it cannot be queued
+func queueModel(p *pm.PluginManager, id, transactionId, input string, status chan pm.ModelStatus) {
+	if err := p.AddToQueue(id, transactionId, input); err != nil {
+		status <- pm.ModelStatus{ModelID: id, Err: err, Transport: pm.TransportNATS}
+	}
+}
+
 // callPlugins calls the model plugins in the given list, with the given input.
 // It waits for all the synchronous model plugins to finish, and sends the
 // result to the client. The asynchronous model plugins are executed in parallel
-func callPlugins(input string, models []string, t cf.ModelPluginType, transactionId string) {
-	logger := lg.Get()
-
+func (c *Core) callPlugins(input string, models []string, t cf.ModelPluginType, transactionId string, receipt *Receipt) {
 	// channel to receive the status of the execution of the analysis
-	// of all the model plugins executed
-	modelPlugStatus := make(chan pm.ModelStatus)
-	asyncModelPlugStatus := make(chan pm.ModelStatus)
+	// of all the model plugins executed. They are buffered so the
+	// models never block reporting to an analysis that stopped waiting
+	// for them because the transaction was closed.
+	modelPlugStatus := make(chan pm.ModelStatus, len(models))
+	asyncModelPlugStatus := make(chan pm.ModelStatus, len(models))
 
-	plugins.AddModelChannel(transactionId, t, asyncModelPlugStatus, "async")
-	plugins.AddModelChannel(transactionId, t, modelPlugStatus, "sync")
+	value, open := c.analysisMap.Load(transactionId)
+	if !open || value.(*transactionSync).plugins == nil {
+		// the transaction was closed before the analysis started
+		c.tprintf(lg.DEBUG, transactionId, "core | transaction closed, analysis skipped")
+		receipt.finish(c, transactionId)
+		return
+	}
+	plugins := value.(*transactionSync).plugins.manager
+	plugins.AddModelChannel(c.scope(transactionId), t, asyncModelPlugStatus, "async")
+	plugins.AddModelChannel(c.scope(transactionId), t, modelPlugStatus, "sync")
 
-	conf := cf.Get()
+	conf := c.config()
 
-	syncCounter := 0
 	asyncCounter := 0
+	var syncModels []string
 
 	startTime := time.Now()
 
 	for _, id := range models {
-		logger.TPrintf(lg.DEBUG, transactionId, "%s | calling from core", id)
+		c.tprintf(lg.DEBUG, transactionId, "%s | calling from core", id)
 		if _, ok := conf.ModelPlugins[id]; !ok {
-			logger.TPrintf(lg.ERROR, transactionId, "core | model plugin %s not found", id)
+			c.tprintf(lg.ERROR, transactionId, "core | model plugin %s not found", id)
 		} else {
 			if conf.ModelPlugins[id].PluginType != t {
-				logger.TPrintf(lg.ERROR, transactionId, "core | model plugin %s is not of type %s", id, t)
+				c.tprintf(lg.ERROR, transactionId, "core | model plugin %s is not of type %s", id, t)
+			} else if conf.ModelPlugins[id].ShadowOf != "" {
+				c.tprintf(lg.DEBUG, transactionId, "%s | skipped, model plugin is a shadow of %s", id, conf.ModelPlugins[id].ShadowOf)
+				c.recordSkippedModel(transactionId, id, "shadow")
+			} else if plugins.Disabled(pm.ModelPluginKind, id) {
+				c.tprintf(lg.DEBUG, transactionId, "%s | skipped, model plugin disabled", id)
+				c.recordSkippedModel(transactionId, id, "disabled")
+			} else if !plugins.Healthy(pm.ModelPluginKind, id) {
+				c.tprintf(lg.DEBUG, transactionId, "%s | skipped, model plugin unhealthy", id)
+				c.recordSkippedModel(transactionId, id, "unhealthy")
 			} else {
 				if conf.IsAsync(id) {
 					asyncCounter++
-					go plugins.AddToQueue(id, transactionId, input)
-				} else {
-					if conf.ModelPlugins[id].Remote {
-						go plugins.AddToQueue(id, transactionId, input)
-					} else {
-						go plugins.Process(id, transactionId, input, t, modelPlugStatus)
-					}
-					syncCounter++
+					go queueModel(plugins, id, c.scope(transactionId), input, asyncModelPlugStatus)
+					c.startShadows(plugins, conf, id, transactionId, input, t)
+				} else if !containsString(syncModels, id) {
+					syncModels = append(syncModels, id)
 				}
 			}
 		}
 	}
 
 	go func() {
-		logger.TPrintf(lg.DEBUG, transactionId, "core | waiting for %d async model plugins to finish", asyncCounter)
+		c.tprintf(lg.DEBUG, transactionId, "core | waiting for %d async model plugins to finish", asyncCounter)
 		wg := sync.WaitGroup{}
 		wg.Add(asyncCounter)
 		for i := 0; i < asyncCounter; i++ {
 			// Await for the execution of the async model plugins
-			logger.TPrintf(lg.DEBUG, transactionId, "core | Waiting for async model plugin %d...", i+1)
+			c.tprintf(lg.DEBUG, transactionId, "core | Waiting for async model plugin %d...", i+1)
 			status := <-asyncModelPlugStatus
 			if status.Err == nil {
-				logger.TPrintf(lg.DEBUG, transactionId, "%s async | success. Result: %.5f", status.ModelID, status.ProbAttack)
-				histogramMeter, err := meter.Int64Histogram("wace.model.duration.nanoseconds")
-				if err != nil {
-					logger.TPrintf(lg.WARN, transactionId, "core | failed to record duration metric: %v", err.Error())
-				}
-				histogramMeter.Record(ctx, time.Since(startTime).Nanoseconds(), metric.WithAttributes(
-					attribute.String("model_id", status.ModelID),
-					attribute.String("model_mode", "async"),
-					attribute.Float64("attack_probability", status.ProbAttack)))
+				c.tprintf(lg.DEBUG, transactionId, "%s async | success over %s in %v. Result: %.5f", status.ModelID, status.Transport, status.End.Sub(status.Start), status.ProbAttack)
+				c.recordModelDuration(transactionId, status, "async", startTime)
 			} else {
-				logger.TPrintf(lg.WARN, transactionId, "%s | %v", status.ModelID, status.Err)
+				c.tprintf(lg.WARN, transactionId, "%s | %v", status.ModelID, status.Err)
 			}
+			c.countModelStatus(status.ModelID, status.Err)
+			c.shadowModelDone(transactionId, status)
 			wg.Done()
 		}
 		wg.Wait()
-		plugins.RemoveAsyncModelChannel(transactionId, t)
+		plugins.RemoveAsyncModelChannel(c.scope(transactionId), t)
 	}()
 
-	logger.TPrintf(lg.DEBUG, transactionId, "core | waiting for %d sync model plugins to finish", syncCounter)
-	for i := 0; i < syncCounter; i++ {
-		// Await for the execution of the model plugins
-		logger.TPrintf(lg.DEBUG, transactionId, "core | Waiting for sync model plugin %d...", i+1)
-		status := <-modelPlugStatus
-		if status.Err == nil {
-			logger.TPrintf(lg.DEBUG, transactionId, "%s sync | success. Result: %.5f", status.ModelID, status.ProbAttack)
+	// the sync models with a timeout that do not answer in time are
+	// reported to timedOut, and their late status is ignored
+	timedOut := make(chan string, len(models))
+	timers := make(map[string]*time.Timer)
+	late := make(map[string]bool)
+	startSync := func(ids []string) {
+		for _, id := range ids {
+			if timeout := conf.ModelDeadline(id); timeout > 0 {
+				id := id
+				timers[id] = time.AfterFunc(timeout, func() { timedOut <- id })
+			}
+			if conf.ModelPlugins[id].Remote {
+				go queueModel(plugins, id, c.scope(transactionId), input, modelPlugStatus)
+			} else {
+				go plugins.Process(id, c.scope(transactionId), input, t, modelPlugStatus)
+			}
+			c.startShadows(plugins, conf, id, transactionId, input, t)
+		}
+	}
+	// the models whose dependencies fail finish without being called
+	failDependents := func(failed []pm.ModelStatus) {
+		for _, status := range failed {
+			c.tprintf(lg.WARN, transactionId, "%s | %v", status.ModelID, status.Err)
+			c.recordSkippedModel(transactionId, status.ModelID, "dependency_failed")
+		}
+	}
+	value, ok := c.analysisMap.Load(transactionId)
+	if !ok {
+		c.tprintf(lg.ERROR, transactionId, "core | could not find transaction %s in analysis map", transactionId)
+		return
+	}
+	tSync := value.(*transactionSync)
+	tSync.addPending(syncModels)
 
-			histogramMeter, err := meter.Int64Histogram("wace.model.duration.nanoseconds")
-			if err != nil {
-				logger.TPrintf(lg.WARN, transactionId, "core | failed to record duration metric: %v", err.Error())
+	scheduler, ready, failed := newDependencyScheduler(conf, plugins, c.scope(transactionId), syncModels)
+	startSync(ready)
+	failDependents(failed)
+	for _, status := range failed {
+		tSync.donePending(status.ModelID)
+	}
+
+	defer func() {
+		for _, timer := range timers {
+			timer.Stop()
+		}
+	}()
+
+	c.tprintf(lg.DEBUG, transactionId, "core | waiting for %d sync model plugins to finish", len(syncModels))
+	for finished := len(failed); finished < len(syncModels); finished++ {
+		// Await for the execution of the model plugins
+		c.tprintf(lg.DEBUG, transactionId, "core | Waiting for sync model plugin %d...", finished+1)
+		var status pm.ModelStatus
+		select {
+		case status = <-modelPlugStatus:
+			if late[status.ModelID] {
+				c.tprintf(lg.DEBUG, transactionId, "%s | answered after timing out", status.ModelID)
+				finished--
+				continue
+			}
+			if timer, ok := timers[status.ModelID]; ok && !timer.Stop() {
+				// the timeout fired along with the answer: the answer
+				// is kept, and the timeout ignored
+				late[status.ModelID] = false
+			}
+		case id := <-timedOut:
+			if _, answered := late[id]; answered {
+				finished--
+				continue
 			}
-			histogramMeter.Record(ctx, time.Since(startTime).Nanoseconds(), metric.WithAttributes(
-				attribute.String("model_id", status.ModelID),
-				attribute.String("model_mode", "sync"),
-				attribute.Float64("attack_probability", status.ProbAttack)))
+			late[id] = true
+			status = pm.ModelStatus{ModelID: id, Err: fmt.Errorf("timed out after %v", conf.ModelDeadline(id))}
+			c.recordModelTimeout(transactionId, id)
+		case <-tSync.closed:
+			c.tprintf(lg.DEBUG, transactionId, "core | transaction closed before the sync model plugins finished")
+			receipt.finish(c, transactionId)
+			return
+		}
+		c.countModelStatus(status.ModelID, status.Err)
+		c.shadowModelDone(transactionId, status)
+		tSync.donePending(status.ModelID)
+		if status.Err == nil {
+			c.tprintf(lg.DEBUG, transactionId, "%s sync | success over %s in %v. Result: %.5f", status.ModelID, status.Transport, status.End.Sub(status.Start), status.ProbAttack)
+			c.recordModelDuration(transactionId, status, "sync", startTime)
+			receipt.need(c, transactionId, status.ModelID, status.NeedParts)
 		} else {
-			logger.TPrintf(lg.WARN, transactionId, "%s | %v", status.ModelID, status.Err)
+			c.tprintf(lg.WARN, transactionId, "%s | %v", status.ModelID, status.Err)
 		}
+		ready, failed := scheduler.finish(status.ModelID, status.Err == nil)
+		startSync(ready)
+		failDependents(failed)
+		for _, status := range failed {
+			tSync.donePending(status.ModelID)
+		}
+		finished += len(failed)
 	}
 
-	value, ok := analysisMap.Load(transactionId)
-	if !ok {
-		logger.TPrintf(lg.ERROR, transactionId, "core | could not find transaction %s in analysis map", transactionId)
+	receipt.finish(c, transactionId)
+	select {
+	case tSync.Channel <- "done":
+	case <-tSync.closed:
+	}
+}
+
+// TransactionOptions holds the optional settings of a transaction
+// given by the connector at initialization
+type TransactionOptions struct {
+	// Debug enables verbose tracing of this transaction only: every
+	// log line is written regardless of the configured log level, and
+	// the redacted payloads, model results and verdicts are kept in a
+	// debug bundle retrievable with GetDebugBundle.
+	Debug bool
+	// Tenant selects the meter registered with RegisterTenantMeter to
+	// record the metrics of this transaction with
+	Tenant string
+	// Profile names the connector profile of the transaction, such as
+	// a site or a policy, recorded with its latency metrics
+	Profile string
+	// Tags are labels of the transaction known by the connector, such
+	// as its route or client type, given to the decision plugins
+	Tags []string
+	// Metadata holds the transaction metadata known by the connector,
+	// such as the client signals
+	Metadata map[string]string
+	// OnNeedParts, if set, is called from another goroutine when the
+	// models of an Analyze call request further parts of the
+	// transaction, once they finish
+	OnNeedParts func(transactionID string, parts []string)
+}
+
+// recordModelDuration records the time elapsed since startTime until
+// the model plugin finished analyzing the transaction
+func (c *Core) recordModelDuration(transactionId string, status pm.ModelStatus, mode string, startTime time.Time) {
+	inst, attributes := c.transactionMetrics(transactionId)
+	histogramMeter, err := inst.Int64Histogram("wace.model.duration.nanoseconds")
+	if err != nil {
+		c.tprintf(lg.WARN, transactionId, "core | failed to record duration metric: %v", err.Error())
 		return
 	}
-	analysisChan := value.(*transactionSync).Channel
-	analysisChan <- "done"
+	modelConfig := c.config().ModelPlugins[status.ModelID]
+	histogramMeter.Record(ctx, time.Since(startTime).Nanoseconds(), metric.WithAttributes(append(attributes,
+		attribute.String("model_id", status.ModelID),
+		attribute.String("model_name", modelConfig.Model),
+		attribute.String("model_version", modelConfig.Version),
+		attribute.String("model_mode", mode),
+		attribute.String("model_transport", status.Transport),
+		attribute.Float64("attack_probability", status.ProbAttack))...))
 }
 
 // InitTransaction initializes a transaction with the given id
 func InitTransaction(transactionId string) {
+	defaultCore.InitTransaction(transactionId)
+}
+
+// InitTransaction is like the InitTransaction function
+func (c *Core) InitTransaction(transactionId string) {
+	c.InitTransactionWithOptions(transactionId, TransactionOptions{})
+}
+
+// InitTransactionWithOptions initializes a transaction with the given
+// id and options
+func InitTransactionWithOptions(transactionId string, opts TransactionOptions) {
+	defaultCore.InitTransactionWithOptions(transactionId, opts)
+}
+
+// InitTransactionWithOptions is like the InitTransactionWithOptions
+// function, binding the transaction to the core
+func (c *Core) InitTransactionWithOptions(transactionId string, opts TransactionOptions) {
 	logger := lg.Get()
-	logger.StartTransaction(transactionId)
-	logger.TPrintf(lg.DEBUG, transactionId, "core | initializing transaction")
-	tSync := transactionSync{
-		Channel: make(chan string),
-		Counter: 0,
+	set := c.pin()
+	if set == nil {
+		c.reportMisuse("InitTransaction", transactionId, MisuseNoEngine)
+		return
+	}
+	if c.transactionOpen(transactionId) {
+		c.reportMisuse("InitTransaction", transactionId, MisuseDoubleInit)
+	}
+	if c != defaultCore {
+		transactionCores.Store(transactionId, c)
+	} else {
+		transactionCores.Delete(transactionId)
+	}
+	c.recentlyClosed.remove(transactionId)
+	logger.StartTransaction(c.scope(transactionId))
+	c.counters.transactions.Add(1)
+	if opts.Debug {
+		c.enableDebug(transactionId)
+	}
+	if opts.Tenant != "" {
+		c.transactionTenants.Store(transactionId, opts.Tenant)
+	}
+	if opts.Profile != "" {
+		c.transactionProfiles.Store(transactionId, opts.Profile)
+	}
+	if len(opts.Tags) > 0 {
+		c.transactionTags.Store(transactionId, append([]string(nil), opts.Tags...))
+	}
+	c.startRequestPhase(transactionId, time.Now())
+	if len(opts.Metadata) > 0 {
+		c.setMetadata(transactionId, opts.Metadata)
+	}
+	if opts.OnNeedParts != nil {
+		c.needPartsCallbacks.Store(transactionId, opts.OnNeedParts)
+	}
+	c.tprintf(lg.DEBUG, transactionId, "core | initializing transaction")
+	tSync := newTransactionSync(0)
+	tSync.plugins = set
+	if previous, loaded := c.analysisMap.Swap(transactionId, tSync); loaded {
+		// a transaction initialized twice stays pinned once
+		if previous := previous.(*transactionSync); previous.plugins != nil {
+			previous.plugins.release()
+		}
 	}
-	analysisMap.Store(transactionId, &tSync)
-	plugins.InitTransaction(transactionId)
+	set.manager.InitTransaction(c.scope(transactionId))
 }
 
 // Analyze calls the model plugins with the given payload and models
 func Analyze(modelsTypeAsString, transactionId, payload string, models []string) error {
+	return coreOf(transactionId).Analyze(modelsTypeAsString, transactionId, payload, models)
+}
+
+// Analyze is like the Analyze function
+func (c *Core) Analyze(modelsTypeAsString, transactionId, payload string, models []string) error {
+	_, err := c.AnalyzeWithReceipt(modelsTypeAsString, transactionId, payload, models)
+	return err
+}
+
+// AnalyzeWithMeta is like Analyze, and also gives the request metadata
+// meta, such as the client address, the URI, the method and the content
+// type keyed by the pm.Meta constants, to the model plugins in the
+// Metadata field of their input. The metadata is kept for the later
+// parts of the transaction, each call adding to it, and is also added
+// to the transaction metadata.
+func AnalyzeWithMeta(modelsTypeAsString, transactionId, payload string, models []string, meta map[string]string) error {
+	return coreOf(transactionId).AnalyzeWithMeta(modelsTypeAsString, transactionId, payload, models, meta)
+}
+
+// AnalyzeWithMeta is like the AnalyzeWithMeta function
+func (c *Core) AnalyzeWithMeta(modelsTypeAsString, transactionId, payload string, models []string, meta map[string]string) error {
+	if err := c.checkOpen("AnalyzeWithMeta", transactionId); err != nil {
+		return err
+	}
+	meta = c.pseudonymize(transactionId, meta)
+	c.pluginsOf(transactionId).manager.SetTransactionMeta(c.scope(transactionId), meta)
+	// also kept in the transaction metadata, the store every core
+	// feature (challenge binding, geolocation) reads from
+	c.storeMetadata(transactionId, meta)
+	return c.Analyze(modelsTypeAsString, transactionId, payload, models)
+}
+
+// AnalyzeWithReceipt is like Analyze, and also returns a receipt that
+// reports the further parts of the transaction requested by the models
+// once they finish, so the connector can send them before checking it
+func AnalyzeWithReceipt(modelsTypeAsString, transactionId, payload string, models []string) (*Receipt, error) {
+	return coreOf(transactionId).AnalyzeWithReceipt(modelsTypeAsString, transactionId, payload, models)
+}
+
+// AnalyzeWithReceipt is like the AnalyzeWithReceipt function
+func (c *Core) AnalyzeWithReceipt(modelsTypeAsString, transactionId, payload string, models []string) (*Receipt, error) {
+	if err := c.checkOpen("Analyze", transactionId); err != nil {
+		return doneReceipt(), err
+	}
 	if len(models) > 0 {
-		logger := lg.Get()
 		modelsType, err := cf.StringToPluginType(modelsTypeAsString)
 		if err != nil {
-			logger.TPrintf(lg.ERROR, transactionId, "core | %s is not a valid type", modelsTypeAsString)
-			return err
+			c.tprintf(lg.ERROR, transactionId, "core | %s is not a valid type", modelsTypeAsString)
+			return doneReceipt(), err
+		}
+		c.startPartPhase(transactionId, modelsType, time.Now())
+		models = c.resolveVersions(c.config(), transactionId, modelsType, models)
+		models, unknown, err := c.resolveModels(c.config(), transactionId, modelsType, models)
+		if err != nil {
+			receipt := doneReceipt()
+			receipt.unknown = unknown
+			return receipt, err
 		}
-		logger.TPrintf(lg.DEBUG, transactionId, "core | analyzing %s: [%s...]", modelsTypeAsString, strings.Split(payload, "\n")[0])
-		addTransactionAnalysis(transactionId)
-		go callPlugins(payload, models, modelsType, transactionId)
+		if c.fastPath(transactionId, modelsType, payload) {
+			for _, id := range models {
+				c.recordSkippedModel(transactionId, id, "fast_path")
+			}
+			receipt := doneReceipt()
+			receipt.unknown = unknown
+			return receipt, nil
+		}
+		if c.debugRequested(modelsType, payload) {
+			c.enableDebug(transactionId)
+		}
+		c.debugCapturePayload(transactionId, modelsTypeAsString, payload, models)
+		c.fingerprintTransaction(transactionId, modelsType, payload)
+		c.learnTransaction(transactionId, modelsType, payload)
+		c.retainForReanalysis(transactionId, modelsTypeAsString, payload)
+		c.collectCampaignFeatures(transactionId, modelsType, payload)
+		c.collectSignals(transactionId, modelsType, payload)
+		c.locateTransaction(transactionId)
+		if c.challengePassed(transactionId, modelsType, payload) {
+			c.tprintf(lg.DEBUG, transactionId, "core | valid challenge token, analysis skipped")
+			for _, id := range models {
+				c.recordSkippedModel(transactionId, id, "challenge_passed")
+			}
+			receipt := doneReceipt()
+			receipt.unknown = unknown
+			return receipt, nil
+		}
+		if models = c.chargeModels(transactionId, models); len(models) == 0 {
+			receipt := doneReceipt()
+			receipt.unknown = unknown
+			return receipt, nil
+		}
+		c.tprintf(lg.DEBUG, transactionId, "core | analyzing %s: [%s...]", modelsTypeAsString, strings.Split(payload, "\n")[0])
+		c.addTransactionAnalysis(transactionId)
+		receipt := newReceipt()
+		receipt.unknown = unknown
+		go c.callPlugins(payload, models, modelsType, transactionId, receipt)
+		return receipt, nil
 	}
-	return nil
+	return doneReceipt(), nil
+}
+
+// Verdict is the detailed result of checking a transaction
+type Verdict struct {
+	// Block is true if the transaction must be blocked
+	Block bool
+	// Challenge is true if the client must solve a challenge before
+	// the transaction is let through. It is never set with Block.
+	Challenge bool
+	// Evidence maps each model plugin ID to the keys of its result
+	// Data allowed by the exposedata setting of the model
+	Evidence map[string]map[string]interface{}
+	// Categories holds the weighted per-category scores of the models
+	Categories map[pm.AttackCategory]float64
+	// Tags are the labels attached to the transaction by the decision
+	Tags []string
+	// Metadata holds the transaction metadata, such as its fingerprint
+	Metadata map[string]string
+	// Missing lists the sync models that had not finished when a check
+	// with a timeout gave up waiting for them
+	Missing []string
+	// Cost is the estimated compute cost of the analyses of the
+	// transaction
+	Cost float64
+	// Hints maps each model plugin ID to the reactions it suggests to
+	// the connector, such as sanitizing a parameter
+	Hints map[string][]pm.Hint
+}
+
+// AnalyzeWithWAF is like Analyze, but only calls the model plugins
+// when the WAF parameters match the configured waf conditions: the
+// global conditions must all match for any model to run, and each model
+// only runs if its own conditions match. It returns the models called.
+func AnalyzeWithWAF(modelsTypeAsString, transactionId, payload string, models []string, wafParams map[string]string) ([]string, error) {
+	return coreOf(transactionId).AnalyzeWithWAF(modelsTypeAsString, transactionId, payload, models, wafParams)
+}
+
+// AnalyzeWithWAF is like the AnalyzeWithWAF function
+func (c *Core) AnalyzeWithWAF(modelsTypeAsString, transactionId, payload string, models []string, wafParams map[string]string) ([]string, error) {
+	conf := c.config()
+	var selected []string
+	if cf.MatchesAll(conf.WAFConditions, wafParams) {
+		for _, id := range models {
+			if cf.MatchesAll(conf.ModelPlugins[id].WAFConditions, wafParams) {
+				selected = append(selected, id)
+			} else {
+				c.tprintf(lg.DEBUG, transactionId, "core | %s skipped, waf conditions not met", id)
+				c.recordSkippedModel(transactionId, id, "waf_condition")
+			}
+		}
+	} else {
+		c.tprintf(lg.DEBUG, transactionId, "core | analysis skipped, global waf conditions not met")
+		for _, id := range models {
+			c.recordSkippedModel(transactionId, id, "waf_condition")
+		}
+	}
+	return selected, c.Analyze(modelsTypeAsString, transactionId, payload, selected)
+}
+
+// AnalyzeSync runs the given sync model plugins over the payload in a
+// transaction of its own and returns their results, for embedders using
+// WACE as a scoring library without the InitTransaction, Analyze and
+// CheckTransaction sequence. The models that fail have no results.
+func AnalyzeSync(modelsTypeAsString, payload string, models []string) (map[string]pm.ModelResults, error) {
+	if defaultCore.plugins.Load() == nil {
+		return nil, fmt.Errorf("wace is not initialized")
+	}
+	return defaultCore.AnalyzeSync(modelsTypeAsString, payload, models)
+}
+
+// AnalyzeSync is like the AnalyzeSync function
+func (c *Core) AnalyzeSync(modelsTypeAsString, payload string, models []string) (map[string]pm.ModelResults, error) {
+	conf := c.config()
+	modelsType, err := cf.StringToPluginType(modelsTypeAsString)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range models {
+		modelConfig, ok := conf.ModelPlugins[id]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("model plugin %s not found", id)
+		case modelConfig.PluginType != modelsType:
+			return nil, fmt.Errorf("model plugin %s is not of type %s", id, modelsType)
+		case conf.IsAsync(id):
+			return nil, fmt.Errorf("model plugin %s is async", id)
+		}
+	}
+
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	transactionId := "sync-" + hex.EncodeToString(random)
+	c.InitTransaction(transactionId)
+	defer c.CloseTransaction(transactionId)
+
+	if err := c.Analyze(modelsTypeAsString, transactionId, payload, models); err != nil {
+		return nil, err
+	}
+	if err := c.waitAnalysis(transactionId); err != nil {
+		return nil, err
+	}
+	return c.pluginsOf(transactionId).manager.TransactionResults(c.scope(transactionId))
+}
+
+// recordModelTimeout counts a sync model plugin that did not answer
+// within its timeout
+func (c *Core) recordModelTimeout(transactionId, modelID string) {
+	inst, attributes := c.transactionMetrics(transactionId)
+	counter, err := inst.Int64Counter("wace.model.timeout.total", metric.WithDescription("Number of sync model analyses timed out"))
+	if err != nil {
+		c.tprintf(lg.WARN, transactionId, "core | failed to record model timeout metric: %v", err.Error())
+		return
+	}
+	counter.Add(ctx, 1, metric.WithAttributes(append(attributes, attribute.String("model_id", modelID))...))
+}
+
+// recordSkippedModel counts a model plugin not called for the given reason
+func (c *Core) recordSkippedModel(transactionId, modelID, reason string) {
+	inst, attributes := c.transactionMetrics(transactionId)
+	counter, err := inst.Int64Counter("wace.model.skipped.total", metric.WithDescription("Number of model analyses skipped"))
+	if err != nil {
+		c.tprintf(lg.WARN, transactionId, "core | failed to record skipped model metric: %v", err.Error())
+		return
+	}
+	counter.Add(ctx, 1, metric.WithAttributes(append(attributes,
+		attribute.String("model_id", modelID),
+		attribute.String("reason", reason))...))
 }
 
 // CheckTransaction checks the result of the analysis of the transaction
-// with the given id and decision plugin
+// with the given id and decision plugin. An empty decision plugin is
+// the one of the profile of the transaction, and the wafParams are
+// completed with those of the profile, so connectors can call
+// CheckTransaction(id, "", nil) on the configured profiles.
 func CheckTransaction(transactionID, decisionPlugin string, wafParams map[string]string) (bool, error) {
-	logger := lg.Get()
-	logger.TPrintf(lg.DEBUG, transactionID, "core | checking transaction")
+	return coreOf(transactionID).CheckTransaction(transactionID, decisionPlugin, wafParams)
+}
+
+// CheckTransaction is like the CheckTransaction function
+func (c *Core) CheckTransaction(transactionID, decisionPlugin string, wafParams map[string]string) (bool, error) {
+	verdict, err := c.CheckTransactionVerdict(transactionID, decisionPlugin, wafParams)
+	return verdict.Block, err
+}
+
+// CheckTransactionWithTimeout is like CheckTransactionVerdict, but
+// waits at most timeout for the sync models. Once it expires, the
+// decision plugin is run with the results that arrived, the models
+// still running are listed in DecisionInput.Missing and in the verdict,
+// and the verdict is tagged with PartialTag. A zero timeout waits for
+// all the models.
+func CheckTransactionWithTimeout(transactionID, decisionPlugin string, wafParams map[string]string, timeout time.Duration) (Verdict, error) {
+	return coreOf(transactionID).CheckTransactionWithTimeout(transactionID, decisionPlugin, wafParams, timeout)
+}
+
+// CheckTransactionWithTimeout is like the CheckTransactionWithTimeout function
+func (c *Core) CheckTransactionWithTimeout(transactionID, decisionPlugin string, wafParams map[string]string, timeout time.Duration) (Verdict, error) {
+	return c.checkTransaction(transactionID, decisionPlugin, wafParams, timeout)
+}
 
-	value, exists := analysisMap.Load(transactionID)
+// PartialTag tags the verdicts decided without the results of some of
+// the models, because the check timed out
+const PartialTag = "decision:partial"
+
+// WarmupTag tags the transactions that would have been blocked during
+// the warmup window after Init
+const WarmupTag = "warmup:block"
+
+// warmingUp returns true if now falls within the configured warmup
+// window after the plugins of the transaction were loaded
+func (c *Core) warmingUp(transactionID string, now time.Time) bool {
+	warmup := c.config().Warmup
+	return warmup > 0 && now.Before(c.pluginsOf(transactionID).started.Add(warmup))
+}
+
+// CheckResult is the outcome of an asynchronous transaction check
+type CheckResult struct {
+	Verdict Verdict
+	Err     error
+}
+
+// CheckTransactionAsync is like CheckTransactionVerdict, but returns at
+// once: the result is sent on the returned channel, which is buffered
+// so it can be read at any time, once the models finish. It lets event
+// loop connectors check transactions without blocking.
+func CheckTransactionAsync(transactionID, decisionPlugin string, wafParams map[string]string) <-chan CheckResult {
+	return coreOf(transactionID).CheckTransactionAsync(transactionID, decisionPlugin, wafParams)
+}
+
+// CheckTransactionAsync is like the CheckTransactionAsync function
+func (c *Core) CheckTransactionAsync(transactionID, decisionPlugin string, wafParams map[string]string) <-chan CheckResult {
+	result := make(chan CheckResult, 1)
+	go func() {
+		verdict, err := c.CheckTransactionVerdict(transactionID, decisionPlugin, wafParams)
+		result <- CheckResult{Verdict: verdict, Err: err}
+	}()
+	return result
+}
+
+// CheckTransactionCallback is like CheckTransactionAsync, but calls
+// callback with the result from another goroutine instead
+func CheckTransactionCallback(transactionID, decisionPlugin string, wafParams map[string]string, callback func(Verdict, error)) {
+	coreOf(transactionID).CheckTransactionCallback(transactionID, decisionPlugin, wafParams, callback)
+}
+
+// CheckTransactionCallback is like the CheckTransactionCallback function
+func (c *Core) CheckTransactionCallback(transactionID, decisionPlugin string, wafParams map[string]string, callback func(Verdict, error)) {
+	go func() {
+		callback(c.CheckTransactionVerdict(transactionID, decisionPlugin, wafParams))
+	}()
+}
+
+// waitAnalysis waits for the sync model plugins called so far by
+// Analyze on the transaction to finish
+func (c *Core) waitAnalysis(transactionID string) error {
+	_, _, err := c.waitModels(transactionID, 0)
+	return err
+}
+
+// waitModels is like waitAnalysis, waiting at most timeout if not
+// zero. It also returns whether any model was called on the
+// transaction, and the sync models still running if the timeout
+// expired. The analyses not finished are left to be waited for by the
+// next check.
+func (c *Core) waitModels(transactionID string, timeout time.Duration) (bool, []string, error) {
+	value, exists := c.analysisMap.Load(transactionID)
 
 	if !exists {
-		return false, fmt.Errorf("transaction with id %s does not exist", transactionID)
+		return false, nil, fmt.Errorf("transaction with id %s does not exist", transactionID)
 	}
 
 	sync := value.(*transactionSync)
 
-	logger.TPrintln(lg.DEBUG, transactionID, "core | waiting for all models to finish...")
+	c.tprintf(lg.DEBUG, transactionID, "core | waiting for all models to finish...")
 
-	for i := 0; i < int(sync.Counter); i++ {
-		<-sync.Channel
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for atomic.LoadInt64(&sync.Counter) > 0 {
+		select {
+		case <-sync.Channel:
+			atomic.AddInt64(&sync.Counter, -1)
+		case <-sync.closed:
+			return false, nil, fmt.Errorf("transaction with id %s was closed", transactionID)
+		case <-expired:
+			missing := sync.pendingModels()
+			c.tprintf(lg.WARN, transactionID, "core | timed out waiting for models %v", missing)
+			return sync.Analyzed.Load(), missing, nil
+		}
 	}
-	sync.Counter = 0
+	return sync.Analyzed.Load(), nil, nil
+}
+
+// CheckTransactionVerdict checks the result of the analysis of the
+// transaction with the given id and decision plugin, and returns the
+// verdict along with the model evidence exposed to the connector
+func CheckTransactionVerdict(transactionID, decisionPlugin string, wafParams map[string]string) (Verdict, error) {
+	return coreOf(transactionID).CheckTransactionVerdict(transactionID, decisionPlugin, wafParams)
+}
+
+// CheckTransactionVerdict is like the CheckTransactionVerdict function
+func (c *Core) CheckTransactionVerdict(transactionID, decisionPlugin string, wafParams map[string]string) (Verdict, error) {
+	return c.checkTransaction(transactionID, decisionPlugin, wafParams, 0)
+}
+
+// checkTransaction checks the transaction, waiting at most timeout for
+// the models if not zero
+func (c *Core) checkTransaction(transactionID, decisionPlugin string, wafParams map[string]string, timeout time.Duration) (Verdict, error) {
+	if err := c.checkOpen("CheckTransaction", transactionID); err != nil {
+		return Verdict{}, err
+	}
+	c.tprintf(lg.DEBUG, transactionID, "core | checking transaction")
+	decisionPlugin, wafParams = c.profileDefaults(transactionID, decisionPlugin, wafParams)
 
-	logger.TPrintln(lg.DEBUG, transactionID, "core | done, checking data...")
-	res, err := plugins.CheckResult(transactionID, decisionPlugin, wafParams)
+	analyzed, missing, err := c.waitModels(transactionID, timeout)
+	if err != nil {
+		return Verdict{}, err
+	}
+	if wafOnly := c.config().WAFOnlyDecision; !analyzed && wafOnly != "" {
+		c.tprintf(lg.DEBUG, transactionID, "core | no model analyzed the transaction, checking it with %s", wafOnly)
+		decisionPlugin = wafOnly
+	}
+
+	defer func() { c.recordPhaseLatency(transactionID, time.Now()) }()
+
+	c.tprintf(lg.DEBUG, transactionID, "core | done, checking data...")
+	decision, err := c.pluginsOf(transactionID).manager.CheckResultWithContext(c.scope(transactionID), decisionPlugin, wafParams, missing, c.transactionContext(transactionID))
+	// the fast path only skips the models: the decision plugin still
+	// checks the data of the WAF
+	if err == nil && c.transactionFastPath(transactionID) {
+		decision.Tags = append(decision.Tags, FastPathTag)
+	}
+	return c.finishCheck(transactionID, decisionPlugin, decision, err, missing)
+}
 
+// finishCheck turns the decision taken on the transaction by the
+// decision plugin, with the results of all the models but the missing
+// ones, into its verdict, recording it
+func (c *Core) finishCheck(transactionID, decisionPlugin string, decision pm.DecisionResult, err error, missing []string) (Verdict, error) {
+	if err == nil && len(missing) > 0 {
+		decision.Tags = append(decision.Tags, PartialTag)
+	}
+	if err == nil && decision.Block && c.warmingUp(transactionID, time.Now()) {
+		c.tprintf(lg.INFO, transactionID, "core | warming up, transaction tagged instead of blocked")
+		decision.Block = false
+		decision.Tags = append(decision.Tags, WarmupTag)
+	}
+	if err == nil && c.transactionChallengePassed(transactionID) {
+		decision.Challenge = false
+		decision.Tags = append(decision.Tags, ChallengePassedTag)
+	}
+	if err == nil && c.transactionBudgetExceeded(transactionID) {
+		decision.Tags = append(decision.Tags, BudgetExceededTag)
+	}
+	res := decision.Block
+
+	verdict := Verdict{Block: res, Challenge: decision.Challenge && !res, Tags: decision.Tags, Metadata: c.TransactionMetadata(transactionID), Missing: missing, Cost: c.TransactionCost(transactionID)}
 	if err == nil {
-		logger.TPrintf(lg.DEBUG, transactionID, "core | transaction checked successfully. Blocking transaction: %t", res)
+		c.tprintf(lg.DEBUG, transactionID, "core | transaction checked successfully. Blocking transaction: %t", res)
+		results, _ := c.pluginsOf(transactionID).manager.TransactionResults(c.scope(transactionID))
+		conf := c.config()
+		verdict.Evidence = exposedEvidence(conf, results)
+		verdict.Hints = modelHints(results)
+		verdict.Categories = pm.AggregateCategories(results, modelWeights(conf, results))
+		c.recordModelFreshness(transactionID, conf, results)
+		c.recordCategoryScores(transactionID, verdict.Categories)
+		if c.IsDebugTransaction(transactionID) {
+			c.debugRecordVerdict(transactionID, results, res)
+		}
+		if !res {
+			c.persistForReanalysis(transactionID)
+		}
+		c.recordCampaignSample(transactionID, verdict, results)
+		c.exportVerdict(transactionID, decisionPlugin, verdict, results)
+		c.notifyWebhooks(transactionID, decisionPlugin, conf, verdict, results)
+		c.auditVerdict(transactionID, decisionPlugin, verdict, results)
+		c.countVerdict(verdict)
 
 		if res {
-			metric, err := meter.Int64Counter("wace.client.request.blocked.total", metric.WithDescription(decisionPlugin))
+			inst, attributes := c.transactionMetrics(transactionID)
+			counter, err := inst.Int64Counter("wace.client.request.blocked.total", metric.WithDescription("Number of transactions blocked"))
 			if err != nil {
-				logger.TPrintf(lg.WARN, transactionID, "core | failed to record blocked request metric: %v", err.Error())
+				c.tprintf(lg.WARN, transactionID, "core | failed to record blocked request metric: %v", err.Error())
+			} else {
+				counter.Add(ctx, 1, metric.WithAttributes(append(attributes, attribute.String("decision_plugin", decisionPlugin))...))
+			}
+		} else if verdict.Challenge {
+			inst, attributes := c.transactionMetrics(transactionID)
+			counter, err := inst.Int64Counter("wace.client.request.challenged.total", metric.WithDescription("Number of transactions challenged"))
+			if err != nil {
+				c.tprintf(lg.WARN, transactionID, "core | failed to record challenged request metric: %v", err.Error())
+			} else {
+				counter.Add(ctx, 1, metric.WithAttributes(append(attributes, attribute.String("decision_plugin", decisionPlugin))...))
 			}
-			metric.Add(ctx, 1)
 		}
 	} else {
-		logger.TPrintf(lg.ERROR, transactionID, "core | could not check transaction: %v", err)
+		c.tprintf(lg.ERROR, transactionID, "core | could not check transaction: %v", err)
+	}
+	return verdict, err
+}
+
+// modelWeights returns the configured weight of each model with
+// results, discounted for the stale models
+func modelWeights(conf *cf.ConfigStore, results map[string]pm.ModelResults) map[string]float64 {
+	now := time.Now()
+	weights := make(map[string]float64, len(results))
+	for modelID := range results {
+		weights[modelID] = conf.ModelWeight(modelID, now)
+	}
+	return weights
+}
+
+// otherCategory is the category attribute of the scores of the
+// categories outside the taxonomy, which would otherwise give the
+// metric an unbounded number of attribute values
+const otherCategory = "other"
+
+// recordCategoryScores records the aggregated score of each attack
+// category of the transaction
+func (c *Core) recordCategoryScores(transactionID string, categories map[pm.AttackCategory]float64) {
+	if len(categories) == 0 {
+		return
+	}
+	inst, attributes := c.transactionMetrics(transactionID)
+	histogramMeter, err := inst.Float64Histogram("wace.category.score")
+	if err != nil {
+		c.tprintf(lg.WARN, transactionID, "core | failed to record category score metric: %v", err.Error())
+		return
+	}
+	for category, score := range categories {
+		name := string(category)
+		if !pm.IsKnownCategory(category) {
+			c.tprintf(lg.DEBUG, transactionID, "core | category %s is not part of the taxonomy, recorded as %s", category, otherCategory)
+			name = otherCategory
+		}
+		histogramMeter.Record(ctx, score, metric.WithAttributes(append(attributes, attribute.String("category", name))...))
+	}
+}
+
+// exposedEvidence filters the Data map of each model result, keeping
+// only the keys that the model configuration allows to expose
+func exposedEvidence(conf *cf.ConfigStore, results map[string]pm.ModelResults) map[string]map[string]interface{} {
+	evidence := make(map[string]map[string]interface{})
+	for modelID, res := range results {
+		for key, value := range res.Data {
+			if !conf.ExposesData(modelID, key) {
+				continue
+			}
+			if _, ok := evidence[modelID]; !ok {
+				evidence[modelID] = make(map[string]interface{})
+			}
+			evidence[modelID][key] = value
+		}
 	}
-	return res, err
+	return evidence
 }
 
 // CloseTransaction closes the transaction with the given id
 // removing the transaction sync model results
 func CloseTransaction(transactionID string) {
-	plugins.CloseTransaction(transactionID)
-	value, ok := analysisMap.Load(transactionID)
-	logger := lg.Get()
-	
+	coreOf(transactionID).CloseTransaction(transactionID)
+}
+
+// CloseTransaction is like the CloseTransaction function
+func (c *Core) CloseTransaction(transactionID string) {
+	value, ok := c.analysisMap.LoadAndDelete(transactionID)
 	if !ok {
-		logger.TPrintf(lg.ERROR, transactionID, "Analysis for transaction %s not found", transactionID)
-	} else {
-		close(value.(*transactionSync).Channel)
-		for range value.(*transactionSync).Channel {}
-		analysisMap.Delete(transactionID)
+		if c.recentlyClosed.contains(transactionID) {
+			c.reportMisuse("CloseTransaction", transactionID, MisuseDoubleClose)
+		} else {
+			c.reportMisuse("CloseTransaction", transactionID, MisuseNotInitialized)
+		}
+		return
 	}
+	tSync := value.(*transactionSync)
+	if tSync.plugins != nil {
+		tSync.plugins.manager.CloseTransaction(c.scope(transactionID))
+		defer tSync.plugins.release()
+	}
+	close(tSync.closed)
+	// the transaction stays bound to the core while it is remembered as
+	// closed, so the misuses of the package functions are reported
+	if forgotten := c.recentlyClosed.add(transactionID); forgotten != "" && !c.transactionOpen(forgotten) {
+		transactionCores.CompareAndDelete(forgotten, c)
+	}
+	c.debugMap.Delete(transactionID)
+	c.metadataMap.Delete(transactionID)
+	c.clientAddresses.Delete(transactionID)
+	c.transactionCosts.Delete(transactionID)
+	c.shadowMap.Delete(transactionID)
+	c.retainedMap.Delete(transactionID)
+	c.rescoredMap.Delete(transactionID)
+	c.campaignFeaturesMap.Delete(transactionID)
+	c.transactionTenants.Delete(transactionID)
+	c.transactionProfiles.Delete(transactionID)
+	c.transactionTags.Delete(transactionID)
+	c.phaseMap.Delete(transactionID)
+	c.needPartsCallbacks.Delete(transactionID)
 }
 
-// Init initializes the WACE core with the given metric meter
-func Init(met metric.Meter) {
-	logger := lg.Get()
-	conf := cf.Get()
-	meter = met
+// logSettings are the settings the log was opened with
+type logSettings struct {
+	path  string
+	level lg.LogLevel
+}
 
-	err := logger.LoadLogger(conf.LogPath, conf.LogLevel)
-	if err != nil {
-		logger.Printf(lg.ERROR, "ERROR: could not open wace log file: %v", err)
-		os.Exit(1)
+// currentLog are the settings of the log opened by Init, nil before,
+// guarded by the reloadMutex of the default core
+var currentLog *logSettings
 
+// Init initializes the WACE core with the given metric meter. It
+// returns an error, leaving the core as it was, if the log file cannot
+// be opened, or with the strictplugins setting if any plugin cannot be
+// loaded, as a *pm.PluginLoadError.
+func Init(met metric.Meter) error {
+	defaultCore.reloadMutex.Lock()
+	defer defaultCore.reloadMutex.Unlock()
+	return initCore(met)
+}
+
+// initCore is Init, with the reloadMutex of the default core held
+func initCore(met metric.Meter) error {
+	c := defaultCore
+	logger := lg.Get()
+	conf := cf.Snapshot()
+
+	// the log is only reopened if its settings changed, as the
+	// transactions in progress keep logging during a reload
+	if settings := (logSettings{conf.LogPath, conf.LogLevel}); currentLog == nil || *currentLog != settings {
+		f, err := openLogFile(conf.LogPath)
+		if err != nil {
+			logger.Printf(lg.ERROR, "ERROR: could not open wace log file: %v", err)
+			return fmt.Errorf("could not open wace log file: %v", err)
+		}
+		logOutput.setOutput(f)
+		logger.LoadLoggerWriter(logOutput, conf.LogLevel)
+		currentLog = &settings
+		logger.Printf(lg.DEBUG, "Writing logs to %s from now", conf.LogPath)
 	}
-	logger.Printf(lg.DEBUG, "Writing logs to %s from now", conf.LogPath)
+	// the lines of the plugins with a log file of their own are also
+	// written to it, from their loading on
+	logOutput.setPluginFiles(conf.PluginLogFiles())
+	version := Version()
+	logger.Printf(lg.INFO, "WACE %s (commit %s, built %s, %s, plugin API %d-%d), transports %v, features %v",
+		version.Version, version.Commit, version.BuildDate, version.GoVersion, version.MinPluginAPIVersion, version.PluginAPIVersion, version.Transports, version.Features)
 
 	logger.Println(lg.DEBUG, "Loading plugin manager...")
-	plugins = pm.New(met)
+	loaded := pm.New(met)
+	if loadErr := loaded.LoadError(); loadErr != nil && conf.StrictPlugins {
+		logger.Printf(lg.ERROR, "ERROR: %v", loadErr)
+		// the plugins loaded are released, the core keeps its own
+		loaded.Shutdown()
+		return loadErr
+	}
+	// the plugins disabled at runtime stay disabled across reloads
+	if previous := c.plugins.Load(); previous != nil {
+		for _, d := range previous.manager.DisabledPlugins() {
+			loaded.DisablePlugin(d.Kind, d.ID, d.Reason)
+		}
+	}
+	// the new transactions use the new plugins, and the previous ones are
+	// shut down once the transactions pinned to them are closed
+	c.swap(newPluginSet(loaded, met))
+
+	c.startJobs()
 	logger.Println(lg.DEBUG, "Plugin manager loaded")
+	return nil
+}
+
+// MustInit is like Init, but exits the process if the core cannot be
+// initialized
+func MustInit(met metric.Meter) {
+	if err := Init(met); err != nil {
+		fmt.Fprintf(os.Stderr, "wace: %v\n", err)
+		os.Exit(1)
+	}
 }
@@ -1,6 +1,8 @@
 package wace
 
 import (
+	"context"
+	"errors"
 	"math/rand"
 	"strconv"
 	"strings"
@@ -8,7 +10,9 @@ import (
 	"time"
 
 	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
 	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 
 	"gopkg.in/yaml.v3"
 )
@@ -246,8 +250,7 @@ func initilize(configuration []byte) error {
 	if err != nil {
 		return err
 	}
-	Init(testMeter)
-	return nil
+	return Init(testMeter)
 }
 
 func generateRandomID() string {
@@ -429,6 +432,55 @@ func TestCheckAttackTransaction(t *testing.T) {
 	CloseTransaction(transactionID)
 }
 
+func TestCheckTransactionAsync(t *testing.T) {
+	transactionID := generateRandomID()
+
+	select {
+	case res := <-CheckTransactionAsync(transactionID, "simple", nil):
+		if res.Err == nil {
+			t.Errorf("checking an unknown transaction does not return error")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("asynchronous check did not finish")
+	}
+
+	done := make(chan error)
+	CheckTransactionCallback(transactionID, "simple", nil, func(verdict Verdict, err error) {
+		done <- err
+	})
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("checking an unknown transaction does not return error")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("callback not called")
+	}
+}
+
+func TestWarmingUp(t *testing.T) {
+	setWarmup := func(warmup time.Duration) {
+		cf.Update(func(conf *cf.ConfigStore) error {
+			conf.Warmup = warmup
+			return nil
+		})
+	}
+	setWarmup(time.Minute)
+	defer setWarmup(0)
+	now := defaultCore.plugins.Load().started.Add(30 * time.Second)
+
+	if !defaultCore.warmingUp("", now) {
+		t.Errorf("not warming up within the warmup window")
+	}
+	if defaultCore.warmingUp("", now.Add(time.Minute)) {
+		t.Errorf("warming up after the warmup window")
+	}
+	setWarmup(0)
+	if defaultCore.warmingUp("", now) {
+		t.Errorf("warming up without warmup window")
+	}
+}
+
 // func TestAnalyzeStress(t *testing.T) {
 // 	for i := 0; i < 1000; i++ {
 // 		transactionID := generateRandomID()
@@ -531,3 +583,145 @@ func BenchmarkTrivialFullNATS(b *testing.B) {
 		CloseTransaction(transactionId)
 	}
 }
+
+func TestAnalyzeSync(t *testing.T) {
+	err := initilize([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: protocol
+    kind: builtin
+    plugintype: RequestHeaders
+`))
+	if err != nil {
+		t.Fatalf("Error initing test: %v", err)
+	}
+
+	results, err := AnalyzeSync("RequestHeaders", requestLine+"\n"+requestHeaders, []string{"protocol"})
+	if err != nil {
+		t.Fatalf("AnalyzeSync returned error: %v", err)
+	}
+	if _, ok := results["protocol"]; !ok || len(results) != 1 {
+		t.Errorf("AnalyzeSync returned %v", results)
+	}
+
+	if _, err := AnalyzeSync("RequestBody", "a=1", []string{"protocol"}); err == nil {
+		t.Errorf("model plugin of another type does not return error")
+	}
+	if _, err := AnalyzeSync("RequestHeaders", requestLine, []string{"missing"}); err == nil {
+		t.Errorf("missing model plugin does not return error")
+	}
+}
+
+func TestInitInvalidLogPath(t *testing.T) {
+	err := initilize([]byte(`---
+loglevel: ERROR
+logpath: /dev/null
+`))
+	if err != nil {
+		t.Fatalf("Error initing test: %v", err)
+	}
+	initialized := defaultCore.plugins.Load()
+
+	cf.Update(func(cs *cf.ConfigStore) error {
+		cs.LogPath = "/nonexistent/wace/wace.log"
+		return nil
+	})
+	defer cf.Update(func(cs *cf.ConfigStore) error {
+		cs.LogPath = "/dev/null"
+		return nil
+	})
+	if err := Init(testMeter); err == nil {
+		t.Errorf("log path in a missing directory does not return error")
+	}
+	if defaultCore.plugins.Load() != initialized {
+		t.Errorf("failed Init replaced the plugin manager")
+	}
+}
+
+func TestInitStrictPlugins(t *testing.T) {
+	config := `---
+loglevel: ERROR
+logpath: /dev/null
+modelplugins:
+  - id: protocol
+    kind: builtin
+    plugintype: RequestHeaders
+  - id: broken
+    kind: builtin
+    builtin: nosuchmodel
+    plugintype: RequestHeaders
+`
+	if err := initilize([]byte(config)); err != nil {
+		t.Fatalf("plugin not loaded returns error without strictplugins: %v", err)
+	}
+	status, _ := Status()
+	if _, ok := status.PluginErrors["broken"]; !ok || len(status.PluginErrors) != 1 {
+		t.Errorf("status plugin errors are %v", status.PluginErrors)
+	}
+
+	err := initilize([]byte(config + "strictplugins: true\n"))
+	var loadErr *pm.PluginLoadError
+	if !errors.As(err, &loadErr) || len(loadErr.Plugins) != 1 {
+		t.Errorf("plugin not loaded with strictplugins returns %v", err)
+	}
+}
+
+func TestWaitModelsTimeout(t *testing.T) {
+	transactionID := generateRandomID()
+	InitTransaction(transactionID)
+	defer CloseTransaction(transactionID)
+
+	defaultCore.addTransactionAnalysis(transactionID)
+	value, _ := defaultCore.analysisMap.Load(transactionID)
+	tSync := value.(*transactionSync)
+	tSync.addPending([]string{"slow", "fast"})
+	tSync.donePending("fast")
+
+	analyzed, missing, err := defaultCore.waitModels(transactionID, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("waitModels returned error: %v", err)
+	}
+	if !analyzed || len(missing) != 1 || missing[0] != "slow" {
+		t.Errorf("timed out wait returned %t, %v", analyzed, missing)
+	}
+
+	go func() {
+		tSync.donePending("slow")
+		tSync.Channel <- "done"
+	}()
+	_, missing, err = defaultCore.waitModels(transactionID, time.Second)
+	if err != nil || len(missing) != 0 {
+		t.Errorf("second wait returned %v, %v", missing, err)
+	}
+	if tSync.Counter != 0 {
+		t.Errorf("counter is %d after the analysis finished", tSync.Counter)
+	}
+}
+
+func TestRecordCategoryScores(t *testing.T) {
+	reader := metric.NewManualReader()
+	meter := metric.NewMeterProvider(metric.WithReader(reader)).Meter("categories")
+	previous := defaultCore.plugins.Swap(&pluginSet{instruments: pm.NewInstruments(meter)})
+	defer defaultCore.plugins.Store(previous)
+
+	defaultCore.recordCategoryScores(generateRandomID(), map[pm.AttackCategory]float64{
+		pm.CategorySQLi:   0.9,
+		"ssrf":            0.5,
+		"deserialization": 0.4,
+	})
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect returned error: %v", err)
+	}
+	histogram := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Histogram[float64])
+	counts := make(map[string]uint64)
+	for _, point := range histogram.DataPoints {
+		v, _ := point.Attributes.Value("category")
+		counts[v.AsString()] += point.Count
+	}
+	if len(counts) != 2 || counts["sqli"] != 1 || counts[otherCategory] != 2 {
+		t.Errorf("category scores recorded as %v", counts)
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Package webhook posts the complete analysis of the transactions with
+high-severity verdicts to SOAR and ticketing webhooks, so detections
+become incidents without scraping the logs. Every webhook receives the
+bundles of at least its minimum severity, rendered with its template or
+as JSON, from a background goroutine so the request path never waits
+for the webhooks.
+*/
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// Severity ranks the verdicts of the transactions
+type Severity int
+
+// Severities, from the lowest
+const (
+	// SeverityLow transactions were allowed
+	SeverityLow Severity = iota
+	// SeverityMedium transactions were challenged
+	SeverityMedium
+	// SeverityHigh transactions were blocked
+	SeverityHigh
+	// SeverityCritical transactions were blocked with a score of at
+	// least CriticalScore
+	SeverityCritical
+)
+
+// CriticalScore is the highest model or category score from which a
+// blocked transaction is critical
+const CriticalScore = 0.9
+
+var severityNames = []string{"low", "medium", "high", "critical"}
+
+// String returns the name of the severity
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// MarshalText encodes the severity as its name
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ParseSeverity returns the severity with the given name
+func ParseSeverity(name string) (Severity, error) {
+	for i, n := range severityNames {
+		if strings.EqualFold(n, name) {
+			return Severity(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity %s", name)
+}
+
+// Model is the outcome of a model in a bundle
+type Model struct {
+	ProbAttack float64 `json:"probattack"`
+	Weight     float64 `json:"weight"`
+	// Evidence holds the keys of the result data exposed by the model
+	Evidence map[string]interface{} `json:"evidence,omitempty"`
+}
+
+// Bundle is the complete analysis of a transaction
+type Bundle struct {
+	TransactionID string             `json:"transaction_id"`
+	Time          time.Time          `json:"time"`
+	Severity      Severity           `json:"severity"`
+	Block         bool               `json:"block"`
+	Challenge     bool               `json:"challenge"`
+	Decision      string             `json:"decision"`
+	Models        map[string]Model   `json:"models"`
+	Categories    map[string]float64 `json:"categories,omitempty"`
+	Tags          []string           `json:"tags,omitempty"`
+	Metadata      map[string]string  `json:"metadata,omitempty"`
+	Missing       []string           `json:"missing,omitempty"`
+}
+
+// Hook is a webhook receiving the bundles of at least MinSeverity
+type Hook struct {
+	Name        string
+	URL         string
+	MinSeverity Severity
+	// Template renders the request body from the bundle, which is sent
+	// as JSON if nil
+	Template *template.Template
+	// ContentType is the content type of the body, application/json
+	// if empty
+	ContentType string
+	// Headers are added to the requests, e.g. to authenticate them
+	Headers map[string]string
+	// Timeout bounds every request to the webhook, 10s if zero
+	Timeout time.Duration
+}
+
+// ParseTemplate parses the body template of a webhook. Besides the
+// text/template builtins, the json function encodes a value as JSON,
+// e.g. {{json .Tags}}.
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(text)
+}
+
+// Body returns the request body of the bundle for the webhook
+func (h Hook) Body(b Bundle) ([]byte, error) {
+	if h.Template == nil {
+		return json.Marshal(b)
+	}
+	var body bytes.Buffer
+	if err := h.Template.Execute(&body, b); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// Post sends the bundle to the webhook
+func (h Hook) Post(client *http.Client, b Bundle) error {
+	body, err := h.Body(b)
+	if err != nil {
+		return err
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	contentType := h.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	for name, value := range h.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// Dispatcher posts the bundles to the webhooks in the background
+type Dispatcher struct {
+	hooks   []Hook
+	client  *http.Client
+	queue   chan Bundle
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Int64
+}
+
+// New creates a dispatcher posting to the webhooks, with at most
+// queueSize bundles waiting (1000 if zero), and starts it
+func New(hooks []Hook, queueSize int) *Dispatcher {
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+	d := &Dispatcher{
+		hooks:  hooks,
+		client: &http.Client{},
+		queue:  make(chan Bundle, queueSize),
+		done:   make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// Wants returns true if a webhook receives the bundles of the severity
+func (d *Dispatcher) Wants(s Severity) bool {
+	for _, h := range d.hooks {
+		if s >= h.MinSeverity {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify queues the bundle to be posted to the webhooks receiving its
+// severity. It never blocks: bundles are dropped when the queue is
+// full.
+func (d *Dispatcher) Notify(b Bundle) {
+	if !d.Wants(b.Severity) {
+		return
+	}
+	select {
+	case d.queue <- b:
+	default:
+		d.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of bundles dropped because the queue was
+// full
+func (d *Dispatcher) Dropped() int64 {
+	return d.dropped.Load()
+}
+
+// Close posts the queued bundles and stops the dispatcher
+func (d *Dispatcher) Close() {
+	d.once.Do(func() { close(d.queue) })
+	<-d.done
+}
+
+// run posts the queued bundles
+func (d *Dispatcher) run() {
+	defer close(d.done)
+	for b := range d.queue {
+		for _, h := range d.hooks {
+			if b.Severity < h.MinSeverity {
+				continue
+			}
+			if err := h.Post(d.client, b); err != nil {
+				lg.Get().Printf(lg.WARN, "webhook | could not post transaction %s to %s: %v", b.TransactionID, h.Name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestDispatcher(t *testing.T) {
+	var mutex sync.Mutex
+	bodies := make(map[string][]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies[r.URL.Path] = append(bodies[r.URL.Path], string(body))
+	}))
+	defer server.Close()
+
+	tmpl, err := ParseTemplate("ticket", `{"summary":"WACE {{.Severity}} {{.TransactionID}}","labels":{{json .Tags}}}`)
+	if err != nil {
+		t.Fatalf("ParseTemplate returned error: %v", err)
+	}
+	auth := map[string]string{"Authorization": "Bearer secret"}
+	d := New([]Hook{
+		{Name: "soar", URL: server.URL + "/soar", MinSeverity: SeverityHigh, Headers: auth},
+		{Name: "tickets", URL: server.URL + "/tickets", MinSeverity: SeverityCritical, Template: tmpl, Headers: auth},
+	}, 0)
+	d.Notify(Bundle{TransactionID: "allowed", Severity: SeverityLow})
+	d.Notify(Bundle{TransactionID: "blocked", Severity: SeverityHigh, Block: true, Models: map[string]Model{"m": {ProbAttack: 0.7, Weight: 1}}})
+	d.Notify(Bundle{TransactionID: "critical", Severity: SeverityCritical, Block: true, Tags: []string{"sqli"}})
+	d.Close()
+
+	if len(bodies["/soar"]) != 2 {
+		t.Fatalf("soar webhook received %v", bodies["/soar"])
+	}
+	var bundle struct {
+		TransactionID string `json:"transaction_id"`
+		Severity      string `json:"severity"`
+		Models        map[string]Model
+	}
+	if err := json.Unmarshal([]byte(bodies["/soar"][0]), &bundle); err != nil {
+		t.Fatalf("invalid bundle %q: %v", bodies["/soar"][0], err)
+	}
+	if bundle.TransactionID != "blocked" || bundle.Severity != "high" || bundle.Models["m"].ProbAttack != 0.7 {
+		t.Errorf("posted bundle is %+v", bundle)
+	}
+	if want := `{"summary":"WACE critical critical","labels":["sqli"]}`; len(bodies["/tickets"]) != 1 || bodies["/tickets"][0] != want {
+		t.Errorf("tickets webhook received %v, expected %s", bodies["/tickets"], want)
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	if s, err := ParseSeverity("Critical"); err != nil || s != SeverityCritical {
+		t.Errorf("critical parsed as %v: %v", s, err)
+	}
+	if _, err := ParseSeverity("urgent"); err == nil {
+		t.Errorf("unknown severity does not return error")
+	}
+}
@@ -0,0 +1,136 @@
+package wace
+
+import (
+	"time"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+	"github.com/tiroa-tilsor/wacelib/webhook"
+
+	lg "github.com/tilsor/ModSecIntl_logging/logging"
+)
+
+// startWebhooks starts posting to the configured webhooks, stopping
+// the previous dispatcher once it posted its queued bundles
+func (c *Core) startWebhooks() {
+	// the previous dispatcher is closed outside of the lock, so posting
+	// its queued bundles does not hold up the transactions checked
+	// meanwhile
+	if old := c.swapDispatcher(c.newDispatcher()); old != nil {
+		old.Close()
+	}
+}
+
+// newDispatcher creates the dispatcher of the webhooks of the
+// configuration of the core, nil if none is configured
+func (c *Core) newDispatcher() *webhook.Dispatcher {
+	conf := c.config().Webhooks
+	var hooks []webhook.Hook
+	for _, hookConf := range conf {
+		hook := webhook.Hook{
+			Name:        hookConf.Name,
+			URL:         hookConf.URL,
+			MinSeverity: hookConf.MinSeverity,
+			ContentType: hookConf.ContentType,
+			Headers:     hookConf.Headers,
+			Timeout:     hookConf.Timeout,
+		}
+		if hookConf.Template != "" {
+			tmpl, err := webhook.ParseTemplate(hookConf.Name, hookConf.Template)
+			if err != nil {
+				lg.Get().Printf(lg.ERROR, "core | could not parse the template of webhook %s: %v", hookConf.Name, err)
+				continue
+			}
+			hook.Template = tmpl
+		}
+		hooks = append(hooks, hook)
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+	lg.Get().Printf(lg.INFO, "Posting high-severity transactions to %d webhooks", len(hooks))
+	return webhook.New(hooks, 0)
+}
+
+// swapDispatcher makes dispatcher the webhook dispatcher of the core and
+// returns the previous one
+func (c *Core) swapDispatcher(dispatcher *webhook.Dispatcher) *webhook.Dispatcher {
+	c.dispatcherMutex.Lock()
+	defer c.dispatcherMutex.Unlock()
+	old := c.dispatcher
+	c.dispatcher = dispatcher
+	return old
+}
+
+// StopWebhooks posts the queued transaction analyses to the webhooks
+// and stops posting. Connectors should call it on shutdown.
+func StopWebhooks() {
+	defaultCore.StopWebhooks()
+}
+
+// StopWebhooks is like the StopWebhooks function
+func (c *Core) StopWebhooks() {
+	if old := c.swapDispatcher(nil); old != nil {
+		old.Close()
+	}
+}
+
+// verdictSeverity ranks the verdict of the transaction: blocked
+// transactions are high, or critical if a model or category score
+// reaches webhook.CriticalScore, challenged ones medium and the others
+// low
+func verdictSeverity(verdict Verdict, results map[string]pm.ModelResults) webhook.Severity {
+	switch {
+	case verdict.Block:
+		for _, res := range results {
+			if res.ProbAttack >= webhook.CriticalScore {
+				return webhook.SeverityCritical
+			}
+		}
+		for _, score := range verdict.Categories {
+			if score >= webhook.CriticalScore {
+				return webhook.SeverityCritical
+			}
+		}
+		return webhook.SeverityHigh
+	case verdict.Challenge:
+		return webhook.SeverityMedium
+	default:
+		return webhook.SeverityLow
+	}
+}
+
+// notifyWebhooks queues the analysis of the checked transaction for the
+// webhooks receiving its severity
+func (c *Core) notifyWebhooks(transactionID, decisionPlugin string, conf *cf.ConfigStore, verdict Verdict, results map[string]pm.ModelResults) {
+	c.dispatcherMutex.RLock()
+	defer c.dispatcherMutex.RUnlock()
+	if c.dispatcher == nil {
+		return
+	}
+	severity := verdictSeverity(verdict, results)
+	if !c.dispatcher.Wants(severity) {
+		return
+	}
+	bundle := webhook.Bundle{
+		TransactionID: c.scope(transactionID),
+		Time:          time.Now(),
+		Severity:      severity,
+		Block:         verdict.Block,
+		Challenge:     verdict.Challenge,
+		Decision:      decisionPlugin,
+		Models:        make(map[string]webhook.Model, len(results)),
+		Categories:    make(map[string]float64, len(verdict.Categories)),
+		Tags:          verdict.Tags,
+		Metadata:      verdict.Metadata,
+		Missing:       verdict.Missing,
+	}
+	weights := modelWeights(conf, results)
+	for id, res := range results {
+		bundle.Models[id] = webhook.Model{ProbAttack: res.ProbAttack, Weight: weights[id], Evidence: verdict.Evidence[id]}
+	}
+	for category, score := range verdict.Categories {
+		bundle.Categories[string(category)] = score
+	}
+	c.dispatcher.Notify(bundle)
+}
@@ -0,0 +1,72 @@
+package wace
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	cf "github.com/tiroa-tilsor/wacelib/configstore"
+	pm "github.com/tiroa-tilsor/wacelib/pluginmanager"
+	"github.com/tiroa-tilsor/wacelib/webhook"
+)
+
+func TestVerdictSeverity(t *testing.T) {
+	tests := []struct {
+		verdict Verdict
+		results map[string]pm.ModelResults
+		want    webhook.Severity
+	}{
+		{Verdict{}, map[string]pm.ModelResults{"m": {ProbAttack: 0.95}}, webhook.SeverityLow},
+		{Verdict{Challenge: true}, nil, webhook.SeverityMedium},
+		{Verdict{Block: true}, map[string]pm.ModelResults{"m": {ProbAttack: 0.6}}, webhook.SeverityHigh},
+		{Verdict{Block: true}, map[string]pm.ModelResults{"m": {ProbAttack: 0.95}}, webhook.SeverityCritical},
+		{Verdict{Block: true, Categories: map[pm.AttackCategory]float64{pm.CategoryRCE: 0.9}}, nil, webhook.SeverityCritical},
+	}
+	for _, test := range tests {
+		if got := verdictSeverity(test.verdict, test.results); got != test.want {
+			t.Errorf("severity of %+v is %v, expected %v", test.verdict, got, test.want)
+		}
+	}
+}
+
+func TestNotifyWebhooks(t *testing.T) {
+	var mutex sync.Mutex
+	var bundles []webhook.Bundle
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var bundle struct {
+			webhook.Bundle
+			Severity string `json:"severity"`
+		}
+		json.NewDecoder(r.Body).Decode(&bundle)
+		mutex.Lock()
+		bundles = append(bundles, bundle.Bundle)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	cf.Update(func(cs *cf.ConfigStore) error {
+		cs.Webhooks = []cf.WebhookConfig{{Name: "soar", URL: server.URL, MinSeverity: webhook.SeverityHigh}}
+		return nil
+	})
+	defer cf.Update(func(cs *cf.ConfigStore) error {
+		cs.Webhooks = nil
+		return nil
+	})
+	defaultCore.startWebhooks()
+
+	conf := cf.Snapshot()
+	defaultCore.notifyWebhooks("tx-allowed", "combiner", conf, Verdict{}, map[string]pm.ModelResults{"m1": {ProbAttack: 0.1}})
+	verdict := Verdict{Block: true, Tags: []string{"sqli"}, Evidence: map[string]map[string]interface{}{"m1": {"token": "union"}}}
+	defaultCore.notifyWebhooks("tx-blocked", "combiner", conf, verdict, map[string]pm.ModelResults{"m1": {ProbAttack: 0.8}})
+	StopWebhooks()
+
+	if len(bundles) != 1 {
+		t.Fatalf("webhook received %d bundles, expected 1", len(bundles))
+	}
+	b := bundles[0]
+	if b.TransactionID != "tx-blocked" || !b.Block || b.Decision != "combiner" || b.Models["m1"].ProbAttack != 0.8 || b.Models["m1"].Evidence["token"] != "union" {
+		t.Errorf("posted bundle is %+v", b)
+	}
+}